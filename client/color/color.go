@@ -1,6 +1,9 @@
 package color
 
-import "fmt"
+import (
+	"fmt"
+	"regexp"
+)
 
 const (
 	Reset  = "\033[0m"
@@ -11,8 +14,11 @@ const (
 	Purple = "\033[35m"
 	Cyan   = "\033[36m"
 	White  = "\033[37m"
+	Bold   = "\033[1m"
 )
 
+var mentionPattern = regexp.MustCompile(`@[\w.-]+`)
+
 // GetColorForUsername returns a consistent color for a given username
 func GetColorForUsername(username string) string {
 	// Simple hash function to get a consistent color for a username
@@ -35,3 +41,16 @@ func ColorizeUsername(username string) string {
 func ColorizeMessage(username, content string) string {
 	return fmt.Sprintf("%s: %s", ColorizeUsername(username), content)
 }
+
+// HighlightMentions highlights mentions of the given user and @room in the content
+func HighlightMentions(content, username string) string {
+	if username == "" {
+		return content
+	}
+	return mentionPattern.ReplaceAllStringFunc(content, func(mention string) string {
+		if mention == "@"+username || mention == "@room" {
+			return Bold + Yellow + mention + Reset
+		}
+		return mention
+	})
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"chatgo/client/color"
+)
+
+// serverCommand reports whether text is a slash command run by the server, such as /roll.
+// Commands the client handles itself never get here, and a double slash sends the text as
+// a message starting with a single slash
+func serverCommand(text string) bool {
+	return strings.HasPrefix(text, "/") && !strings.HasPrefix(text, "//")
+}
+
+// formatMemberChange renders a member_added or member_removed event
+func formatMemberChange(message Message, username string) string {
+	if message.Type == "member_removed" {
+		if message.Content == username {
+			return fmt.Sprintf("  %s removed you from the room", color.ColorizeUsername(message.Username))
+		}
+		return fmt.Sprintf("  %s removed %s from the room", color.ColorizeUsername(message.Username), color.ColorizeUsername(message.Content))
+	}
+	return fmt.Sprintf("  %s added %s to the room", color.ColorizeUsername(message.Username), color.ColorizeUsername(message.Content))
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestServerCommand(t *testing.T) {
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{"/roll 2d6", true},
+		{"/me waves", true},
+		{"//etc/hosts is the file", false},
+		{"hello /roll", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := serverCommand(tt.text); got != tt.want {
+			t.Errorf("serverCommand(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestFormatMemberChange(t *testing.T) {
+	added := formatMemberChange(Message{Type: "member_added", Username: "alice", Content: "bob"}, "carol")
+	if !strings.Contains(added, "added") || !strings.Contains(added, "bob") {
+		t.Errorf("Unexpected member_added line %q", added)
+	}
+
+	removed := formatMemberChange(Message{Type: "member_removed", Username: "alice", Content: "carol"}, "carol")
+	if !strings.Contains(removed, "removed you") {
+		t.Errorf("Unexpected member_removed line %q", removed)
+	}
+}
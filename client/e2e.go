@@ -0,0 +1,398 @@
+package main
+
+// End-to-end encryption for rooms created with -e2e.
+//
+// Every user has a long-term X25519 key pair and only the public key is sent to the server.
+// Each message is encrypted with a fresh content key using AES-256-GCM, and the content key
+// is wrapped for every room member that has published a public key. The wrapping key is
+// derived with HKDF-SHA256 from the X25519 secret shared by the sender and the recipient,
+// so the recipient also learns that the message comes from the sender. Members that join
+// later are not among the recipients of older messages and can't read them.
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+const envelopeVersion = 1
+
+// errNotRecipient means the message was sent before the user joined the room
+// or before they published their key
+var errNotRecipient = errors.New("message was not encrypted for you")
+
+// envelope is the content of an end-to-end encrypted message
+type envelope struct {
+	Version int               `json:"v"`
+	Sender  string            `json:"sender"`
+	Salt    []byte            `json:"salt"`
+	Data    []byte            `json:"data"`
+	Keys    map[string][]byte `json:"keys"`
+}
+
+type PublicKey struct {
+	UserID    string `json:"userId"`
+	Username  string `json:"username"`
+	PublicKey string `json:"publicKey"`
+}
+
+type RoomKeys struct {
+	RoomID string      `json:"roomId"`
+	E2E    bool        `json:"e2e"`
+	Keys   []PublicKey `json:"keys"`
+}
+
+// defaultKeyDir returns ~/.chatgo, or .chatgo when the home directory is unknown
+func defaultKeyDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".chatgo"
+	}
+	return filepath.Join(home, ".chatgo")
+}
+
+// loadIdentity reads the user's private key from dir, generating and saving a new one
+// on the first run
+func loadIdentity(dir, username string) (*ecdh.PrivateKey, error) {
+	path := filepath.Join(dir, filepath.Base(username)+".key")
+
+	data, err := os.ReadFile(path)
+	if err == nil {
+		raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil {
+			return nil, fmt.Errorf("invalid key file %s: %v", path, err)
+		}
+		return ecdh.X25519().NewPrivateKey(raw)
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	encoded := base64.StdEncoding.EncodeToString(key.Bytes())
+	if err := os.WriteFile(path, []byte(encoded+"\n"), 0o600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// publishPublicKey sends the user's public key to the server
+func publishPublicKey(serverAddr, token string, key *ecdh.PublicKey) error {
+	body, _ := json.Marshal(map[string]string{"publicKey": base64.StdEncoding.EncodeToString(key.Bytes())})
+	req, err := http.NewRequest(http.MethodPost, serverAddr+"/keys", bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to publish public key: %s", string(body))
+	}
+	return nil
+}
+
+// fetchRoomKeys returns the public keys of the room members
+func fetchRoomKeys(serverAddr, roomID, userID string) (*RoomKeys, error) {
+	wsScheme := "ws"
+	wsHost := strings.Replace(strings.Replace(serverAddr, "http://", "", 1), "https://", "", 1)
+	wsURL := fmt.Sprintf("%s://%s/ws/getRoomKeys/%s?userId=%s", wsScheme, wsHost, url.PathEscape(roomID), url.QueryEscape(userID))
+
+	keysConn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer keysConn.Close()
+
+	var keys RoomKeys
+	if err := readResponse(keysConn, &keys); err != nil {
+		return nil, err
+	}
+	return &keys, nil
+}
+
+// roomIsE2E reports whether the room was created end-to-end encrypted
+func roomIsE2E(serverAddr, roomID string) bool {
+	wsScheme := "ws"
+	wsHost := strings.Replace(strings.Replace(serverAddr, "http://", "", 1), "https://", "", 1)
+	wsURL := fmt.Sprintf("%s://%s/ws/getAllRooms", wsScheme, wsHost)
+
+	roomsConn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		log.Fatalf("Failed to fetch rooms: %v", err)
+	}
+	defer roomsConn.Close()
+
+	var rooms []Room
+	if err := readResponse(roomsConn, &rooms); err != nil {
+		log.Fatalf("Failed to fetch rooms: %v", err)
+	}
+	for _, room := range rooms {
+		if room.ID == roomID {
+			return room.E2E
+		}
+	}
+	return false
+}
+
+// sealEnvelope encrypts text from senderID to every recipient
+func sealEnvelope(identity *ecdh.PrivateKey, senderID, roomID, text string, recipients map[string]*ecdh.PublicKey) (string, error) {
+	contentKey := make([]byte, 32)
+	salt := make([]byte, 16)
+	if _, err := rand.Read(contentKey); err != nil {
+		return "", err
+	}
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	data, err := seal(contentKey, []byte(text), []byte(roomID+"/"+senderID))
+	if err != nil {
+		return "", err
+	}
+
+	env := envelope{
+		Version: envelopeVersion,
+		Sender:  senderID,
+		Salt:    salt,
+		Data:    data,
+		Keys:    make(map[string][]byte, len(recipients)),
+	}
+	for recipientID, publicKey := range recipients {
+		kek, err := wrappingKey(identity, publicKey, salt, roomID, senderID, recipientID)
+		if err != nil {
+			return "", err
+		}
+		if env.Keys[recipientID], err = seal(kek, contentKey, nil); err != nil {
+			return "", err
+		}
+	}
+
+	raw, err := json.Marshal(env)
+	if err != nil {
+		return "", err
+	}
+	return string(raw), nil
+}
+
+// openEnvelope decrypts a message for recipientID. senderKey looks up the public key
+// of the user the envelope claims to be sent by
+func openEnvelope(identity *ecdh.PrivateKey, recipientID, roomID, content string, senderKey func(senderID string) (*ecdh.PublicKey, error)) (string, error) {
+	var env envelope
+	if err := json.Unmarshal([]byte(content), &env); err != nil {
+		return "", fmt.Errorf("malformed encrypted message")
+	}
+	if env.Version != envelopeVersion {
+		return "", fmt.Errorf("unsupported encrypted message version %d", env.Version)
+	}
+
+	wrapped, ok := env.Keys[recipientID]
+	if !ok {
+		return "", errNotRecipient
+	}
+
+	publicKey, err := senderKey(env.Sender)
+	if err != nil {
+		return "", err
+	}
+	kek, err := wrappingKey(identity, publicKey, env.Salt, roomID, env.Sender, recipientID)
+	if err != nil {
+		return "", err
+	}
+	contentKey, err := open(kek, wrapped, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt message key: %v", err)
+	}
+	text, err := open(contentKey, env.Data, []byte(roomID+"/"+env.Sender))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt message: %v", err)
+	}
+	return string(text), nil
+}
+
+// wrappingKey derives the key that wraps content keys from sender to recipient
+func wrappingKey(identity *ecdh.PrivateKey, peer *ecdh.PublicKey, salt []byte, roomID, senderID, recipientID string) ([]byte, error) {
+	shared, err := identity.ECDH(peer)
+	if err != nil {
+		return nil, err
+	}
+	info := fmt.Sprintf("chatgo-e2e-v1 %s %s %s", roomID, senderID, recipientID)
+	return hkdf.Key(sha256.New, shared, salt, info, 32)
+}
+
+func seal(key, plaintext, additionalData []byte) ([]byte, error) {
+	aesGCM, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aesGCM.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aesGCM.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func open(key, ciphertext, additionalData []byte) ([]byte, error) {
+	aesGCM, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < aesGCM.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := ciphertext[:aesGCM.NonceSize()], ciphertext[aesGCM.NonceSize():]
+	return aesGCM.Open(nil, nonce, ciphertext, additionalData)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// e2eSession encrypts and decrypts messages of one end-to-end encrypted room.
+// Member keys are fetched lazily and refreshed when an unknown sender shows up
+type e2eSession struct {
+	serverAddr string
+	roomID     string
+	userID     string
+	identity   *ecdh.PrivateKey
+
+	mu      sync.Mutex
+	members map[string]PublicKey
+}
+
+func newE2ESession(serverAddr, roomID, userID string, identity *ecdh.PrivateKey) *e2eSession {
+	return &e2eSession{
+		serverAddr: serverAddr,
+		roomID:     roomID,
+		userID:     userID,
+		identity:   identity,
+	}
+}
+
+// refresh reloads the public keys of the room members
+func (s *e2eSession) refresh() error {
+	keys, err := fetchRoomKeys(s.serverAddr, s.roomID, s.userID)
+	if err != nil {
+		return err
+	}
+
+	members := make(map[string]PublicKey, len(keys.Keys))
+	for _, key := range keys.Keys {
+		members[key.UserID] = key
+	}
+
+	s.mu.Lock()
+	s.roomID = keys.RoomID
+	s.members = members
+	s.mu.Unlock()
+	return nil
+}
+
+// member returns the public key of a room member, refreshing the keys once if it's unknown
+func (s *e2eSession) member(userID string) (PublicKey, error) {
+	s.mu.Lock()
+	key, ok := s.members[userID]
+	s.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+
+	if err := s.refresh(); err != nil {
+		return PublicKey{}, err
+	}
+
+	s.mu.Lock()
+	key, ok = s.members[userID]
+	s.mu.Unlock()
+	if !ok {
+		return PublicKey{}, fmt.Errorf("no public key for user %s", userID)
+	}
+	return key, nil
+}
+
+// encrypt encrypts text to every member that has published a public key.
+// Keys are refreshed first so that members who just joined can read the message
+func (s *e2eSession) encrypt(text string) (string, error) {
+	if err := s.refresh(); err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	roomID := s.roomID
+	recipients := make(map[string]*ecdh.PublicKey, len(s.members)+1)
+	for userID, member := range s.members {
+		publicKey, err := parsePublicKey(member.PublicKey)
+		if err != nil {
+			continue
+		}
+		recipients[userID] = publicKey
+	}
+	s.mu.Unlock()
+	recipients[s.userID] = s.identity.PublicKey()
+
+	return sealEnvelope(s.identity, s.userID, roomID, text, recipients)
+}
+
+// decrypt replaces the content of an encrypted message with its text. The sender has to
+// be the member the envelope claims, otherwise anyone could impersonate them
+func (s *e2eSession) decrypt(msg *Message) error {
+	text, err := openEnvelope(s.identity, s.userID, msg.RoomID, msg.Content, func(senderID string) (*ecdh.PublicKey, error) {
+		member, err := s.member(senderID)
+		if err != nil {
+			return nil, err
+		}
+		if member.Username != msg.Username {
+			return nil, fmt.Errorf("message from %s is signed by %s", msg.Username, member.Username)
+		}
+		return parsePublicKey(member.PublicKey)
+	})
+	if err != nil {
+		return err
+	}
+
+	msg.Content = text
+	return nil
+}
+
+func parsePublicKey(encoded string) (*ecdh.PublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return ecdh.X25519().NewPublicKey(raw)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestIdentity(t *testing.T) *ecdh.PrivateKey {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	return key
+}
+
+func TestEnvelope(t *testing.T) {
+	alice, bob, eve := newTestIdentity(t), newTestIdentity(t), newTestIdentity(t)
+	keys := map[string]*ecdh.PublicKey{"1": alice.PublicKey(), "2": bob.PublicKey(), "3": eve.PublicKey()}
+	lookup := func(senderID string) (*ecdh.PublicKey, error) {
+		return keys[senderID], nil
+	}
+
+	content, err := sealEnvelope(alice, "1", "10", "hello", map[string]*ecdh.PublicKey{
+		"1": alice.PublicKey(),
+		"2": bob.PublicKey(),
+	})
+	if err != nil {
+		t.Fatalf("Failed to seal envelope: %v", err)
+	}
+
+	t.Run("Recipient", func(t *testing.T) {
+		text, err := openEnvelope(bob, "2", "10", content, lookup)
+		if err != nil || text != "hello" {
+			t.Errorf("Expected hello, got %q (%v)", text, err)
+		}
+	})
+
+	t.Run("Sender", func(t *testing.T) {
+		text, err := openEnvelope(alice, "1", "10", content, lookup)
+		if err != nil || text != "hello" {
+			t.Errorf("Expected hello, got %q (%v)", text, err)
+		}
+	})
+
+	t.Run("Not a recipient", func(t *testing.T) {
+		if _, err := openEnvelope(eve, "3", "10", content, lookup); !errors.Is(err, errNotRecipient) {
+			t.Errorf("Expected errNotRecipient, got %v", err)
+		}
+	})
+
+	t.Run("Other room", func(t *testing.T) {
+		if _, err := openEnvelope(bob, "2", "11", content, lookup); err == nil {
+			t.Error("Expected an error for a message replayed into another room")
+		}
+	})
+
+	t.Run("Forged sender", func(t *testing.T) {
+		// Eve encrypts to Bob but claims the message comes from Alice
+		forged, err := sealEnvelope(eve, "1", "10", "hi from alice", map[string]*ecdh.PublicKey{"2": bob.PublicKey()})
+		if err != nil {
+			t.Fatalf("Failed to seal envelope: %v", err)
+		}
+		if _, err := openEnvelope(bob, "2", "10", forged, lookup); err == nil {
+			t.Error("Expected an error for a forged sender")
+		}
+	})
+}
+
+func TestLoadIdentity(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "keys")
+
+	first, err := loadIdentity(dir, "alice")
+	if err != nil {
+		t.Fatalf("Failed to create identity: %v", err)
+	}
+	second, err := loadIdentity(dir, "alice")
+	if err != nil {
+		t.Fatalf("Failed to load identity: %v", err)
+	}
+	if !first.Equal(second) {
+		t.Error("Expected the saved identity to be loaded")
+	}
+
+	info, err := os.Stat(filepath.Join(dir, "alice.key"))
+	if err != nil {
+		t.Fatalf("Failed to stat key file: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("Expected key file mode 0600, got %v", info.Mode().Perm())
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+// Disappearing messages: countdown markers, removing expired messages from the screen
+// and setting the room's message TTL
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// timelineSize is how many recent messages are kept to redraw the screen when one expires
+const timelineSize = 50
+
+// timeline holds the messages currently shown in the room, oldest first
+type timeline struct {
+	messages []Message
+}
+
+func (t *timeline) add(msg Message) {
+	t.messages = append(t.messages, msg)
+	if len(t.messages) > timelineSize {
+		t.messages = t.messages[len(t.messages)-timelineSize:]
+	}
+}
+
+// remove drops the message with the given ID and reports whether it was shown
+func (t *timeline) remove(id string) bool {
+	for i, msg := range t.messages {
+		if msg.ID == id {
+			t.messages = append(t.messages[:i], t.messages[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// redraw clears the screen and prints the timeline again, with countdowns updated
+func (t *timeline) redraw() {
+	fmt.Print("\033[H\033[2J")
+	for _, msg := range t.messages {
+		fmt.Println(formatMessage(msg))
+	}
+}
+
+// formatExpiry renders the countdown marker of a disappearing message, e.g. "⏳ 4m59s"
+func formatExpiry(expiresAt string, now time.Time) string {
+	t, err := time.Parse(time.RFC3339, expiresAt)
+	if err != nil {
+		return ""
+	}
+	left := t.Sub(now).Round(time.Second)
+	if left < 0 {
+		left = 0
+	}
+	return "⏳ " + left.String()
+}
+
+// parseTTL parses a duration like 30s, 10m or 24h into seconds. "off" turns the timer off
+func parseTTL(value string) (int, error) {
+	if value == "off" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if d < time.Second {
+		return 0, fmt.Errorf("time-to-live must be at least 1s")
+	}
+	return int(d / time.Second), nil
+}
+
+// setRoomTTL makes messages of the room disappear after ttl seconds, 0 turns it off.
+// Only room admins may change it
+func setRoomTTL(serverAddr, token, roomID string, ttl int) error {
+	body, _ := json.Marshal(map[string]int{"ttl": ttl})
+	req, err := http.NewRequest(http.MethodPut, fmt.Sprintf("%s/rooms/%s/ttl", serverAddr, url.PathEscape(roomID)), bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to set message TTL: %s", string(body))
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormatExpiry(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		expiresAt string
+		want      string
+	}{
+		{"2024-01-01T12:04:59Z", "⏳ 4m59s"},
+		{"2024-01-01T11:59:00Z", "⏳ 0s"},
+		{"not a time", ""},
+	}
+	for _, tt := range tests {
+		if got := formatExpiry(tt.expiresAt, now); got != tt.want {
+			t.Errorf("formatExpiry(%q) = %q, want %q", tt.expiresAt, got, tt.want)
+		}
+	}
+}
+
+func TestParseTTL(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{value: "30s", want: 30},
+		{value: "24h", want: 86400},
+		{value: "off", want: 0},
+		{value: "500ms", wantErr: true},
+		{value: "soon", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseTTL(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseTTL(%q) = %d, %v, want %d, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestTimeline(t *testing.T) {
+	var shown timeline
+	for i := 0; i < timelineSize+2; i++ {
+		shown.add(Message{ID: string(rune('a'+i%26)) + string(rune('0'+i/26))})
+	}
+	if len(shown.messages) != timelineSize {
+		t.Fatalf("Expected %d messages, got %d", timelineSize, len(shown.messages))
+	}
+	if shown.remove("a0") {
+		t.Error("The oldest message should have been dropped")
+	}
+	if !shown.remove("c0") {
+		t.Error("Expected c0 to be removed")
+	}
+	if shown.remove("c0") {
+		t.Error("c0 was already removed")
+	}
+	if len(shown.messages) != timelineSize-1 {
+		t.Errorf("Expected %d messages, got %d", timelineSize-1, len(shown.messages))
+	}
+}
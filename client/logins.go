@@ -0,0 +1,63 @@
+package main
+
+// Login history and unlocking accounts locked after failed logins
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// loginHistoryLimit is how many recent logins /logins shows
+const loginHistoryLimit = 20
+
+type LoginAttempt struct {
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"userAgent"`
+	Success   bool      `json:"success"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// viewLogins prints the recent logins and failed login attempts of your account
+func viewLogins(serverAddr, token string) error {
+	var attempts []LoginAttempt
+	err := scheduleRequest(http.MethodGet, fmt.Sprintf("%s/users/me/logins?limit=%d", serverAddr, loginHistoryLimit), token, nil, &attempts)
+	if err != nil {
+		return err
+	}
+
+	if len(attempts) == 0 {
+		fmt.Println("No logins recorded")
+		return nil
+	}
+	for _, a := range attempts {
+		fmt.Println(formatLoginAttempt(a))
+	}
+	return nil
+}
+
+// formatLoginAttempt renders a login history entry in local time
+func formatLoginAttempt(a LoginAttempt) string {
+	result := "✓ login"
+	switch {
+	case a.Success:
+	case a.Reason == "locked":
+		result = "✗ refused, account locked"
+	case a.Reason == "bad_code":
+		result = "✗ wrong two-factor code"
+	default:
+		result = "✗ wrong password"
+	}
+	line := fmt.Sprintf("  %s  %-15s %s", a.CreatedAt.Local().Format("Mon Jan 2 15:04:05"), a.IP, result)
+	if a.UserAgent != "" {
+		line += " (" + a.UserAgent + ")"
+	}
+	return line
+}
+
+// unlockUser lifts the login lockout of an account, server admins only
+func unlockUser(serverAddr, token, username string) error {
+	return scheduleRequest(http.MethodPost, fmt.Sprintf("%s/admin/users/%s/unlock", serverAddr, url.PathEscape(username)), token, nil, nil)
+}
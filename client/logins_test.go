@@ -0,0 +1,31 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatLoginAttempt(t *testing.T) {
+	at := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	got := formatLoginAttempt(LoginAttempt{IP: "10.0.0.1", UserAgent: "Go-http-client/1.1", Success: true, CreatedAt: at})
+	if !strings.Contains(got, "10.0.0.1") || !strings.Contains(got, "✓ login (Go-http-client/1.1)") {
+		t.Errorf("Unexpected successful login %q", got)
+	}
+
+	got = formatLoginAttempt(LoginAttempt{IP: "10.0.0.9", Reason: "bad_password", CreatedAt: at})
+	if !strings.HasSuffix(got, "✗ wrong password") {
+		t.Errorf("Unexpected failed login %q", got)
+	}
+
+	got = formatLoginAttempt(LoginAttempt{IP: "10.0.0.9", Reason: "locked", CreatedAt: at})
+	if !strings.HasSuffix(got, "✗ refused, account locked") {
+		t.Errorf("Unexpected refused login %q", got)
+	}
+
+	got = formatLoginAttempt(LoginAttempt{IP: "10.0.0.9", Reason: "bad_code", CreatedAt: at})
+	if !strings.HasSuffix(got, "✗ wrong two-factor code") {
+		t.Errorf("Unexpected failed two-factor login %q", got)
+	}
+}
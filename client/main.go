@@ -5,14 +5,21 @@ import (
 	"bytes"
 	"chatgo/client/color"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
@@ -23,27 +30,160 @@ type User struct {
 }
 
 type Room struct {
-	ID        string `json:"id"`
-	Name      string `json:"name"`
-	Type      string `json:"type"`
-	CreatorID string `json:"creator_id"`
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	CreatorID  string `json:"creator_id"`
+	E2E        bool   `json:"e2e,omitempty"`
+	MessageTTL int    `json:"messageTtl,omitempty"`
+	Topic      string `json:"topic,omitempty"`
 }
 
 type LoginResponse struct {
-	ID       string `json:"id"`
-	Username string `json:"username"`
+	ID                     string `json:"id"`
+	Username               string `json:"username"`
+	AccessToken            string `json:"accessToken"`
+	TwoFactorRequired      bool   `json:"twoFactorRequired"`
+	TwoFactorToken         string `json:"twoFactorToken"`
+	TwoFactorSetupRequired bool   `json:"twoFactorSetupRequired"`
 }
 
 type ClientRes struct {
-	ID string `json:"id"`
+	ID          string `json:"id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"displayName"`
+	StatusText  string `json:"statusText"`
 }
 
 type Message struct {
-	ID        string `json:"id"`
-	Content   string `json:"content"`
-	RoomID    string `json:"roomId"`
-	Username  string `json:"username"`
-	CreatedAt string `json:"createdAt"`
+	ID          string `json:"id"`
+	Type        string `json:"type,omitempty"`
+	Content     string `json:"content"`
+	RoomID      string `json:"roomId"`
+	Username    string `json:"username"`
+	CreatedAt   string `json:"createdAt"`
+	ParentID    string `json:"parentId,omitempty"`
+	ReplyCount  int    `json:"replyCount,omitempty"`
+	LastReplyAt string `json:"lastReplyAt,omitempty"`
+	Emoji       string `json:"emoji,omitempty"`
+	Encrypted   bool   `json:"encrypted,omitempty"`
+	TTL         int    `json:"ttl,omitempty"`
+	ExpiresAt   string `json:"expiresAt,omitempty"`
+	Topic       string `json:"topic,omitempty"`
+	Bot         bool   `json:"bot,omitempty"`
+	Error       string `json:"error,omitempty"`
+
+	Reactions     []Reaction   `json:"reactions,omitempty"`
+	AttachmentIDs []string     `json:"attachmentIds,omitempty"`
+	Attachments   []Attachment `json:"attachments,omitempty"`
+	Pins          []Pin        `json:"pins,omitempty"`
+	Poll          *Poll        `json:"poll,omitempty"`
+}
+
+type Attachment struct {
+	ID          string `json:"id"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size"`
+}
+
+type Reaction struct {
+	Emoji string `json:"emoji"`
+	Count int    `json:"count"`
+}
+
+type Thread struct {
+	Root    Message   `json:"root"`
+	Replies []Message `json:"replies"`
+}
+
+type Mention struct {
+	ID      string  `json:"id"`
+	IsRead  bool    `json:"isRead"`
+	Message Message `json:"message"`
+}
+
+type MyRoom struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	UnreadCount int      `json:"unreadCount"`
+	LastMessage *Message `json:"lastMessage,omitempty"`
+}
+
+// currentUser is the logged in username, used to highlight mentions
+var currentUser string
+
+// lastSeenID holds the ID of the latest message shown in the current room.
+// It is written by handleMessages and sent as a read marker by the input loop
+var lastSeenID atomic.Value
+
+// roomSession is set when the current room is end-to-end encrypted
+var roomSession *e2eSession
+
+// openMessage decrypts an end-to-end encrypted message in place. Messages that can't be
+// decrypted are shown with a placeholder instead of their ciphertext
+func openMessage(msg *Message) {
+	if !msg.Encrypted {
+		return
+	}
+	if roomSession == nil {
+		msg.Content = "🔒 encrypted message"
+		return
+	}
+	err := roomSession.decrypt(msg)
+	if errors.Is(err, errNotRecipient) {
+		msg.Content = "🔒 sent before you joined"
+	} else if err != nil {
+		msg.Content = fmt.Sprintf("🔒 unable to decrypt: %v", err)
+	}
+}
+
+// formatMessage renders a message with its ID and thread summary
+func formatMessage(msg Message) string {
+	text := color.ColorizeMessage(msg.Username, color.HighlightMentions(msg.Content, currentUser))
+	if msg.Bot {
+		text = "[bot] " + text
+	}
+	if msg.ID != "" {
+		text = fmt.Sprintf("#%s %s", msg.ID, text)
+	}
+	if len(msg.Reactions) > 0 {
+		text = fmt.Sprintf("%s  %s", text, formatReactions(msg.Reactions))
+	}
+	if msg.ReplyCount > 0 {
+		text = fmt.Sprintf("%s (%d replies, /thread %s)", text, msg.ReplyCount, msg.ID)
+	}
+	if msg.ExpiresAt != "" {
+		text = fmt.Sprintf("%s  %s", text, formatExpiry(msg.ExpiresAt, time.Now()))
+	}
+	for _, a := range msg.Attachments {
+		text = fmt.Sprintf("%s\n    📎 %s (%s, %s, /download %s)", text, a.Filename, a.ContentType, formatSize(a.Size), a.ID)
+	}
+	if msg.Poll != nil {
+		text = fmt.Sprintf("%s\n%s", text, formatPoll(msg.Poll, time.Now()))
+	}
+	return text
+}
+
+// formatSize renders a file size in B, KB or MB
+func formatSize(size int64) string {
+	switch {
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(size)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", size)
+	}
+}
+
+// formatReactions renders reaction counts as [👍 2 🎉 1]
+func formatReactions(reactions []Reaction) string {
+	parts := make([]string, 0, len(reactions))
+	for _, r := range reactions {
+		parts = append(parts, fmt.Sprintf("%s %d", r.Emoji, r.Count))
+	}
+	return "[" + strings.Join(parts, " ") + "]"
 }
 
 func roomExists(serverAddr, roomID string) bool {
@@ -100,14 +240,17 @@ func viewAllRooms(serverAddr string) {
 }
 
 func createNewRoom(serverAddr, roomID, roomName, roomType, creatorID string) {
-	roomData := Room{
+	createRoomWithOptions(serverAddr, Room{
 		ID:        roomID,
 		Name:      roomName,
 		Type:      roomType,
 		CreatorID: creatorID,
-	}
+	})
+}
+
+func createRoomWithOptions(serverAddr string, roomData Room) {
 	roomJSON, _ := json.Marshal(roomData)
-	resp, err := http.Post(fmt.Sprintf("%s/ws/createRoom?userId=%s", serverAddr, creatorID), "application/json", bytes.NewBuffer(roomJSON))
+	resp, err := http.Post(fmt.Sprintf("%s/ws/createRoom?userId=%s", serverAddr, roomData.CreatorID), "application/json", bytes.NewBuffer(roomJSON))
 	if err != nil {
 		log.Fatalf("Failed to create room: %v", err)
 	}
@@ -163,16 +306,156 @@ func displayChatHistory(serverAddr, roomID string, limit int, userID string) {
 	fmt.Printf("\nLast %d messages:\n", limit)
 	fmt.Println("----------------------------------------")
 	for _, msg := range messages {
-		if msgMap, ok := msg.(map[string]interface{}); ok {
-			username, _ := msgMap["username"].(string)
-			content, _ := msgMap["content"].(string)
-			fmt.Println(color.ColorizeMessage(username, content))
+		raw, _ := json.Marshal(msg)
+		var message Message
+		if err := json.Unmarshal(raw, &message); err == nil {
+			openMessage(&message)
+			fmt.Println(formatMessage(message))
 		}
 	}
 	fmt.Println("----------------------------------------")
 }
 
+// readResponse reads a single JSON response from the server into v,
+// turning {"error": "..."} responses into errors
+func readResponse(conn *websocket.Conn, v interface{}) error {
+	var response json.RawMessage
+	if err := conn.ReadJSON(&response); err != nil {
+		return fmt.Errorf("Failed to read response: %v", err)
+	}
+
+	var errorRes struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(response, &errorRes) == nil && errorRes.Error != "" {
+		return fmt.Errorf("Error from server: %s", errorRes.Error)
+	}
+
+	if err := json.Unmarshal(response, v); err != nil {
+		return fmt.Errorf("Unexpected response format from server")
+	}
+	return nil
+}
+
+func viewMentions(serverAddr, token string) {
+	wsScheme := "ws"
+	wsHost := strings.Replace(strings.Replace(serverAddr, "http://", "", 1), "https://", "", 1)
+	wsURL := fmt.Sprintf("%s://%s/ws/getMentions?unread=true", wsScheme, wsHost)
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+token)
+	mentionsConn, _, err := websocket.DefaultDialer.Dial(wsURL, header)
+	if err != nil {
+		log.Printf("Failed to fetch mentions: %v", err)
+		return
+	}
+	defer mentionsConn.Close()
+
+	var mentions []Mention
+	if err := readResponse(mentionsConn, &mentions); err != nil {
+		log.Print(err)
+		return
+	}
+
+	fmt.Printf("\nUnread mentions (%d):\n", len(mentions))
+	fmt.Println("----------------------------------------")
+	ids := make([]string, 0, len(mentions))
+	for _, mention := range mentions {
+		fmt.Printf("[room %s, %s] %s\n", mention.Message.RoomID, mention.Message.CreatedAt, formatMessage(mention.Message))
+		ids = append(ids, mention.ID)
+	}
+	fmt.Println("----------------------------------------")
+
+	if len(ids) == 0 {
+		return
+	}
+
+	body, _ := json.Marshal(map[string][]string{"ids": ids})
+	req, err := http.NewRequest(http.MethodPost, serverAddr+"/ws/readMentions", bytes.NewBuffer(body))
+	if err != nil {
+		log.Printf("Failed to mark mentions as read: %v", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Printf("Failed to mark mentions as read: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		log.Printf("Failed to mark mentions as read: %s", string(body))
+	}
+}
+
+func searchMessages(serverAddr, token, query string) {
+	wsScheme := "ws"
+	wsHost := strings.Replace(strings.Replace(serverAddr, "http://", "", 1), "https://", "", 1)
+	wsURL := fmt.Sprintf("%s://%s/ws/search?q=%s", wsScheme, wsHost, url.QueryEscape(query))
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+token)
+	searchConn, _, err := websocket.DefaultDialer.Dial(wsURL, header)
+	if err != nil {
+		log.Printf("Failed to search messages: %v", err)
+		return
+	}
+	defer searchConn.Close()
+
+	var messages []Message
+	if err := readResponse(searchConn, &messages); err != nil {
+		log.Print(err)
+		return
+	}
+
+	fmt.Printf("\nFound %d messages for %q:\n", len(messages), query)
+	fmt.Println("----------------------------------------")
+	for _, msg := range messages {
+		fmt.Printf("[room %s, %s] %s\n", msg.RoomID, msg.CreatedAt, color.ColorizeMessage(msg.Username, msg.Content))
+	}
+	fmt.Println("----------------------------------------")
+}
+
+// typingStatus describes who is typing, e.g. "alice and bob are typing…"
+func typingStatus(typists []string) string {
+	switch len(typists) {
+	case 0:
+		return ""
+	case 1:
+		return fmt.Sprintf("%s is typing…", typists[0])
+	case 2:
+		return fmt.Sprintf("%s and %s are typing…", typists[0], typists[1])
+	default:
+		return fmt.Sprintf("%d people are typing…", len(typists))
+	}
+}
+
+// showTyping redraws the status line with the current typists, or restores the prompt
+// when nobody is typing
+func showTyping(typists []string) {
+	if status := typingStatus(typists); status != "" {
+		fmt.Printf("\r\033[K%s%s%s ", color.Bold, status, color.Reset)
+		return
+	}
+	fmt.Print("\r\033[K> ")
+}
+
+// removeTypist removes username from the list of typists
+func removeTypist(typists []string, username string) []string {
+	for i, typist := range typists {
+		if typist == username {
+			return append(typists[:i], typists[i+1:]...)
+		}
+	}
+	return typists
+}
+
 func handleMessages(c *websocket.Conn, username, roomID string) {
+	var typists []string
+	var shown timeline
 	for {
 		var message Message
 		err := c.ReadJSON(&message)
@@ -180,8 +463,286 @@ func handleMessages(c *websocket.Conn, username, roomID string) {
 			log.Printf("Error reading message: %v", err)
 			return
 		}
-		fmt.Println(color.ColorizeMessage(message.Username, message.Content))
+		if message.Type == "typing" || message.Type == "typing_stop" {
+			typists = removeTypist(typists, message.Username)
+			if message.Type == "typing" && message.Username != username {
+				typists = append(typists, message.Username)
+			}
+			showTyping(typists)
+			continue
+		}
+		// Clear the typing status line before printing anything else
+		if len(typists) > 0 {
+			fmt.Print("\r\033[K")
+		}
+		if message.Type == "reaction_add" || message.Type == "reaction_remove" {
+			action := "reacted"
+			if message.Type == "reaction_remove" {
+				action = "removed reaction"
+			}
+			fmt.Printf("  %s %s %s on #%s %s\n",
+				color.ColorizeUsername(message.Username), action, message.Emoji, message.ID, formatReactions(message.Reactions))
+			continue
+		}
+		if message.Type == "presence" {
+			if message.Username != username {
+				fmt.Printf("  * %s is now %s\n", color.ColorizeUsername(message.Username), message.Content)
+			}
+			continue
+		}
+		if message.Type == "mention" {
+			fmt.Printf("%s%s mentioned you in room %s:%s %s\n", color.Bold, message.Username, message.RoomID,
+				color.Reset, color.HighlightMentions(message.Content, currentUser))
+			continue
+		}
+		if message.Error != "" {
+			fmt.Printf("  ⚠ %s\n", message.Error)
+			continue
+		}
+		if message.Type == "notice" {
+			fmt.Println(message.Content)
+			continue
+		}
+		if message.Type == "member_added" || message.Type == "member_removed" {
+			fmt.Println(formatMemberChange(message, username))
+			continue
+		}
+		if message.Type == "welcome" {
+			roomPins.Store(message.Pins)
+			showWelcome(message)
+			continue
+		}
+		if message.Type == "topic" {
+			if message.Topic == "" {
+				fmt.Printf("  %s cleared the room topic\n", color.ColorizeUsername(message.Username))
+			} else {
+				fmt.Printf("  %s changed the room topic to: %s\n", color.ColorizeUsername(message.Username), message.Topic)
+			}
+			continue
+		}
+		if message.Type == "pin" || message.Type == "unpin" {
+			showPinChange(message)
+			continue
+		}
+		if message.Type == "poll" && message.Poll != nil {
+			shown.updatePoll(message.Poll)
+			fmt.Println(formatPoll(message.Poll, time.Now()))
+			continue
+		}
+		if message.Type == "expired" {
+			if shown.remove(message.ID) {
+				shown.redraw()
+				fmt.Print("> ")
+			}
+			continue
+		}
+		if message.Type == "thread_update" {
+			fmt.Printf("  ↳ %d new replies in thread #%s, latest from %s (/thread %s)\n",
+				message.ReplyCount, message.ParentID, color.ColorizeUsername(message.Username), message.ParentID)
+			continue
+		}
+		if message.ID != "" && message.ParentID == "" {
+			lastSeenID.Store(message.ID)
+		}
+		openMessage(&message)
+		fmt.Println(formatMessage(message))
+		if message.ID != "" {
+			shown.add(message)
+		}
+		if len(typists) > 0 {
+			showTyping(typists)
+		}
+	}
+}
+
+// markRead sends a read marker for messageID, or for the latest message in the room
+// when messageID is empty
+func markRead(c *websocket.Conn, messageID string) error {
+	return c.WriteJSON(Message{ID: messageID, Type: "read"})
+}
+
+func viewMyRooms(serverAddr, token string) {
+	wsScheme := "ws"
+	wsHost := strings.Replace(strings.Replace(serverAddr, "http://", "", 1), "https://", "", 1)
+	wsURL := fmt.Sprintf("%s://%s/ws/getMyRooms", wsScheme, wsHost)
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+token)
+	roomsConn, _, err := websocket.DefaultDialer.Dial(wsURL, header)
+	if err != nil {
+		log.Printf("Failed to fetch rooms: %v", err)
+		return
+	}
+	defer roomsConn.Close()
+
+	var rooms []MyRoom
+	if err := readResponse(roomsConn, &rooms); err != nil {
+		log.Print(err)
+		return
+	}
+
+	fmt.Println("\nYour rooms:")
+	fmt.Println("----------------------------------------")
+	for _, room := range rooms {
+		unread := ""
+		if room.UnreadCount > 0 {
+			unread = fmt.Sprintf(" %s(%d unread)%s", color.Bold, room.UnreadCount, color.Reset)
+		}
+		fmt.Printf("%s [%s]%s\n", room.Name, room.ID, unread)
+		if room.LastMessage != nil {
+			openMessage(room.LastMessage)
+			fmt.Printf("    %s\n", color.ColorizeMessage(room.LastMessage.Username, room.LastMessage.Content))
+		}
+	}
+	fmt.Println("----------------------------------------")
+}
+
+func viewSeenBy(serverAddr, token, messageID string) {
+	wsScheme := "ws"
+	wsHost := strings.Replace(strings.Replace(serverAddr, "http://", "", 1), "https://", "", 1)
+	wsURL := fmt.Sprintf("%s://%s/ws/getSeenBy/%s", wsScheme, wsHost, url.PathEscape(messageID))
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+token)
+	seenConn, _, err := websocket.DefaultDialer.Dial(wsURL, header)
+	if err != nil {
+		log.Printf("Failed to fetch read receipts: %v", err)
+		return
+	}
+	defer seenConn.Close()
+
+	var usernames []string
+	if err := readResponse(seenConn, &usernames); err != nil {
+		log.Print(err)
+		return
+	}
+
+	if len(usernames) == 0 {
+		fmt.Printf("#%s has not been seen by anyone yet\n", messageID)
+		return
+	}
+	fmt.Printf("#%s seen by: %s\n", messageID, strings.Join(usernames, ", "))
+}
+
+// uploadFile uploads a local file to the room and returns its attachment metadata
+func uploadFile(serverAddr, roomID, token, path string) (*Attachment, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", filepath.Base(path))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(part, f); err != nil {
+		return nil, err
+	}
+	if err := form.Close(); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/attachments/%s", serverAddr, url.PathEscape(roomID)), &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("upload failed: %s", string(body))
+	}
+
+	var attachment Attachment
+	if err := json.NewDecoder(resp.Body).Decode(&attachment); err != nil {
+		return nil, err
+	}
+	return &attachment, nil
+}
+
+// downloadFile saves an attachment to the current directory without overwriting
+// existing files and returns the path it was saved to
+func downloadFile(serverAddr, token, attachmentID string) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/attachments/%s", serverAddr, url.PathEscape(attachmentID)), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("download failed: %s", string(body))
+	}
+
+	filename := "attachment-" + attachmentID
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+		filename = filepath.Base(params["filename"])
+	}
+
+	path := filename
+	ext := filepath.Ext(filename)
+	for i := 1; ; i++ {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			break
+		}
+		path = fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(filename, ext), i, ext)
 	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func displayThread(serverAddr, messageID string, limit int) {
+	wsScheme := "ws"
+	wsHost := strings.Replace(strings.Replace(serverAddr, "http://", "", 1), "https://", "", 1)
+	wsURL := fmt.Sprintf("%s://%s/ws/getThread/%s/%d", wsScheme, wsHost, url.PathEscape(messageID), limit)
+
+	threadConn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		log.Printf("Failed to fetch thread: %v", err)
+		return
+	}
+	defer threadConn.Close()
+
+	var thread Thread
+	if err := readResponse(threadConn, &thread); err != nil {
+		log.Print(err)
+		return
+	}
+
+	fmt.Printf("\nThread #%s:\n", thread.Root.ID)
+	fmt.Println("----------------------------------------")
+	openMessage(&thread.Root)
+	fmt.Println(color.ColorizeMessage(thread.Root.Username, thread.Root.Content))
+	for _, reply := range thread.Replies {
+		openMessage(&reply)
+		fmt.Printf("  ↳ #%s %s\n", reply.ID, color.ColorizeMessage(reply.Username, reply.Content))
+	}
+	fmt.Println("----------------------------------------")
 }
 
 func viewChatHistory(serverAddr string, roomID string, limit int) {
@@ -221,12 +782,23 @@ func main() {
 	viewRooms := flag.Bool("viewRooms", false, "View all available rooms")
 	viewHistory := flag.Bool("history", false, "View chat history")
 	historyLimit := flag.Int("limit", 50, "Number of messages to retrieve for history")
+	e2e := flag.Bool("e2e", false, "Make the new room end-to-end encrypted")
+	keyDir := flag.String("keyDir", defaultKeyDir(), "Directory holding your end-to-end encryption keys")
+	twoFactorCode := flag.String("code", "", "Two-factor code or recovery code, asked for when needed if not given")
+	resetToken := flag.String("resetToken", "", "Password reset token from a server admin, -password becomes the new password")
 	flag.Parse()
 
 	if *username == "" || *password == "" {
 		log.Fatal("Username and password are required")
 	}
 
+	if *resetToken != "" {
+		if err := resetPassword(*serverAddr, *resetToken, *password); err != nil {
+			log.Fatalf("Failed to reset password: %v", err)
+		}
+		fmt.Println("Password reset")
+	}
+
 	// Login
 	loginData := User{
 		Username: *username,
@@ -249,6 +821,31 @@ func main() {
 		log.Fatalf("Failed to decode login response: %v", err)
 	}
 
+	if loginResp.TwoFactorRequired {
+		if *twoFactorCode == "" {
+			fmt.Print("Two-factor code: ")
+			fmt.Scanln(twoFactorCode)
+		}
+		finished, err := loginTwoFactor(*serverAddr, loginResp.TwoFactorToken, *twoFactorCode)
+		if err != nil {
+			log.Fatalf("Login failed: %v", err)
+		}
+		loginResp = *finished
+	}
+	if loginResp.TwoFactorSetupRequired {
+		fmt.Println("Server admins must enable two-factor authentication before using admin commands, see /2fa enable")
+	}
+
+	currentUser = loginResp.Username
+
+	identity, err := loadIdentity(*keyDir, loginResp.Username)
+	if err != nil {
+		log.Fatalf("Failed to load encryption key: %v", err)
+	}
+	if err := publishPublicKey(*serverAddr, loginResp.AccessToken, identity.PublicKey()); err != nil {
+		log.Printf("Failed to publish public key: %v", err)
+	}
+
 	if *viewRooms {
 		viewAllRooms(*serverAddr)
 		return
@@ -266,26 +863,20 @@ func main() {
 		if *roomName == "" {
 			log.Fatal("Room name is required to create a room")
 		}
-		createNewRoom(*serverAddr, "", *roomName, *roomType, loginResp.ID)
+		createRoomWithOptions(*serverAddr, Room{
+			Name:      *roomName,
+			Type:      *roomType,
+			CreatorID: loginResp.ID,
+			E2E:       *e2e,
+		})
 		return
 	}
 
 	// Check if user is already a member of the room
-	wsScheme := "ws"
-	wsHost := strings.Replace(strings.Replace(*serverAddr, "http://", "", 1), "https://", "", 1)
-	wsURL := fmt.Sprintf("%s://%s/ws/getRoomClients/%s", wsScheme, wsHost, *roomID)
-	log.Printf("Checking room members at: %s", wsURL)
-
-	c, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	clients, err := getRoomMembers(*serverAddr, *roomID)
 	if err != nil {
 		log.Fatal("Failed to check room members:", err)
 	}
-	defer c.Close()
-
-	var clients []ClientRes
-	if err := c.ReadJSON(&clients); err != nil {
-		log.Fatal("Failed to decode room members:", err)
-	}
 
 	isMember := false
 	for _, client := range clients {
@@ -299,14 +890,16 @@ func main() {
 		log.Printf("User is not a member of room %s, joining...", *roomID)
 	}
 
-	wsScheme = "ws"
-	wsHost = strings.Replace(strings.Replace(*serverAddr, "http://", "", 1), "https://", "", 1)
-	wsURL = fmt.Sprintf("%s://%s/ws/joinRoom/%s?userId=%s&username=%s", wsScheme, wsHost, *roomID, loginResp.ID, *username)
+	wsScheme := "ws"
+	wsHost := strings.Replace(strings.Replace(*serverAddr, "http://", "", 1), "https://", "", 1)
+	wsURL := fmt.Sprintf("%s://%s/ws/joinRoom/%s", wsScheme, wsHost, *roomID)
 	log.Printf("Connecting to WebSocket server at: %s", wsURL)
 
+	// The server identifies the user by the access token
 	header := http.Header{}
 	header.Add("Origin", *serverAddr)
 	header.Add("User-Agent", "ChatGO-Client")
+	header.Add("Authorization", "Bearer "+loginResp.AccessToken)
 
 	log.Printf("Attempting to connect to WebSocket server at: %s", wsURL)
 	c, wsResp, err := websocket.DefaultDialer.Dial(wsURL, header)
@@ -322,14 +915,52 @@ func main() {
 
 	log.Printf("Successfully connected to room: %s as user: %s", *roomID, *username)
 
+	// Member keys are fetched on first use, when the server already lists us as a member
+	if *roomID != "default" && roomIsE2E(*serverAddr, *roomID) {
+		roomSession = newE2ESession(*serverAddr, *roomID, loginResp.ID, identity)
+		fmt.Println("🔒 Messages in this room are end-to-end encrypted")
+	}
+
 	go handleMessages(c, *username, *roomID)
 
 	reader := bufio.NewReader(os.Stdin)
 	fmt.Println("Connected to chat room. Type your messages (or 'exit' to quit):")
 	fmt.Println("Commands:")
 	fmt.Println("  /history [number] - Show last N messages (default: 10)")
+	fmt.Println("  /reply <id> <text> - Reply to a message in its thread")
+	fmt.Println("  /thread <id> - Show a message thread")
+	fmt.Println("  /react <id> <emoji> - React to a message with an emoji or :shortcode:")
+	fmt.Println("  /unreact <id> <emoji> - Remove your reaction from a message")
+	fmt.Println("  /mentions - Show unread mentions from all rooms")
+	fmt.Println("  /rooms - Show your rooms with unread counts")
+	fmt.Println("  /away, /back - Set your status to away or back online")
+	fmt.Println("  /members - Show who is in the room")
+	fmt.Println("  /whois <user> - Show the profile of a user")
+	fmt.Println("  /profile <name|bio|avatar|tz|status> [value] - Change your profile, without a value the field is cleared")
+	fmt.Println("  /upload <path> - Upload a file to the room")
+	fmt.Println("  /download <id> - Download an attachment to the current directory")
+	fmt.Println("  /seen <id> - Show who has read a message")
+	fmt.Println("  /pin <id>, /unpin <id> - Pin or unpin a message (room admins only)")
+	fmt.Println("  /pins - Show pinned messages")
+	fmt.Println("  /topic [text] - Set the room topic, or clear it without text (room admins only)")
+	fmt.Println("  /schedule <time> <text> - Send a message later, at HH:MM, after a delay like 10m, or at YYYY-MM-DDTHH:MM")
+	fmt.Println("  /scheduled - Show your scheduled messages")
+	fmt.Println("  /unschedule <id> - Cancel a scheduled message")
+	fmt.Println("  /expire <duration> <text> - Send a message that disappears after e.g. 30s, 10m or 24h")
+	fmt.Println("  /ttl <duration|off> - Make all new messages in the room disappear (room admins only)")
+	fmt.Println("  /search <query> - Search messages in your rooms (supports \"phrases\", from:user, after:YYYY-MM-DD, before:YYYY-MM-DD)")
+	fmt.Println("  /poll [-multiple] [-anonymous] [-closes 1h] <question> | <option> | ... - Ask the room a question")
+	fmt.Println("  /vote <poll> <option>..., /closepoll <poll> - Vote in a poll, or close a poll you created")
+	fmt.Println("  /logins - Show recent logins and failed login attempts of your account")
+	fmt.Println("  /unlock <user> - Unlock an account locked after failed logins (server admins only)")
+	fmt.Println("  /2fa enable, /2fa confirm <code>, /2fa disable <code> - Set up or turn off two-factor authentication")
+	fmt.Println("  /passwd - Change your password and log out your other sessions")
+	fmt.Println("  /resetpassword <user> - Issue a one-time password reset token (server admins only)")
+	fmt.Println("  /help - List commands run by the server, such as /me, /roll, /invite and /kick")
+	fmt.Println("  //text - Send a message that starts with a slash")
 	fmt.Println("  exit - Leave the chat room")
 
+	lastMarkedID := ""
 	for {
 		fmt.Print("> ")
 		text, err := reader.ReadString('\n')
@@ -338,6 +969,15 @@ func main() {
 			continue
 		}
 
+		// Any input means the user has seen everything printed so far
+		if id, _ := lastSeenID.Load().(string); id != "" && id != lastMarkedID {
+			if err := markRead(c, id); err != nil {
+				log.Printf("Error sending read marker: %v", err)
+				break
+			}
+			lastMarkedID = id
+		}
+
 		text = strings.TrimSpace(text)
 		if text == "exit" {
 			break
@@ -353,16 +993,428 @@ func main() {
 				}
 			}
 			displayChatHistory(*serverAddr, *roomID, limit, loginResp.ID)
+			if err := markRead(c, ""); err != nil {
+				log.Printf("Error sending read marker: %v", err)
+				break
+			}
+			continue
+		}
+
+		// Handle /away and /back commands
+		if text == "/away" || text == "/back" {
+			status := "away"
+			if text == "/back" {
+				status = "online"
+			}
+			if err := c.WriteJSON(Message{Type: "presence", Content: status}); err != nil {
+				log.Printf("Error sending status: %v", err)
+				break
+			}
+			fmt.Printf("You are now %s\n", status)
+			continue
+		}
+
+		// Handle /members command
+		if text == "/members" {
+			members, err := getRoomMembers(*serverAddr, *roomID)
+			if err != nil {
+				log.Printf("Failed to fetch room members: %v", err)
+				continue
+			}
+			for _, m := range members {
+				fmt.Println(formatMember(m))
+			}
+			continue
+		}
+
+		// Handle /whois command
+		if strings.HasPrefix(text, "/whois") {
+			parts := strings.Fields(text)
+			if len(parts) != 2 {
+				fmt.Println("Usage: /whois <user>")
+				continue
+			}
+			profile, err := getProfile(*serverAddr, loginResp.AccessToken, strings.TrimPrefix(parts[1], "@"))
+			if err != nil {
+				log.Printf("Failed to fetch the profile of %s: %v", parts[1], err)
+				continue
+			}
+			fmt.Print(formatProfile(profile, time.Now()))
+			continue
+		}
+
+		// Handle /profile command
+		if text == "/profile" || strings.HasPrefix(text, "/profile ") {
+			field, value, err := parseProfileCommand(text)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			profile, err := updateProfile(*serverAddr, loginResp.AccessToken, field, value)
+			if err != nil {
+				log.Printf("Failed to update your profile: %v", err)
+				continue
+			}
+			fmt.Print(formatProfile(profile, time.Now()))
+			continue
+		}
+
+		// Handle /upload command
+		if strings.HasPrefix(text, "/upload") {
+			if roomSession != nil {
+				fmt.Println("Attachments are not available in end-to-end encrypted rooms")
+				continue
+			}
+			path := strings.TrimSpace(strings.TrimPrefix(text, "/upload"))
+			if path == "" {
+				fmt.Println("Usage: /upload <path>")
+				continue
+			}
+			attachment, err := uploadFile(*serverAddr, *roomID, loginResp.AccessToken, path)
+			if err != nil {
+				log.Printf("Failed to upload file: %v", err)
+				continue
+			}
+			err = c.WriteJSON(Message{
+				Content:       fmt.Sprintf("shared %s", attachment.Filename),
+				RoomID:        *roomID,
+				Username:      *username,
+				AttachmentIDs: []string{attachment.ID},
+			})
+			if err != nil {
+				log.Printf("Error sending message: %v", err)
+				break
+			}
+			continue
+		}
+
+		// Handle /download command
+		if strings.HasPrefix(text, "/download") {
+			parts := strings.Fields(text)
+			if len(parts) < 2 {
+				fmt.Println("Usage: /download <id>")
+				continue
+			}
+			path, err := downloadFile(*serverAddr, loginResp.AccessToken, parts[1])
+			if err != nil {
+				log.Printf("Failed to download file: %v", err)
+				continue
+			}
+			fmt.Printf("Saved to %s\n", path)
+			continue
+		}
+
+		// Handle /rooms command
+		if text == "/rooms" {
+			viewMyRooms(*serverAddr, loginResp.AccessToken)
 			continue
 		}
 
+		// Handle /seen command
+		if strings.HasPrefix(text, "/seen") {
+			parts := strings.Fields(text)
+			if len(parts) < 2 {
+				fmt.Println("Usage: /seen <id>")
+				continue
+			}
+			viewSeenBy(*serverAddr, loginResp.AccessToken, strings.TrimPrefix(parts[1], "#"))
+			continue
+		}
+
+		// Handle /mentions command
+		if text == "/mentions" {
+			viewMentions(*serverAddr, loginResp.AccessToken)
+			continue
+		}
+
+		// Handle /search command
+		if strings.HasPrefix(text, "/search") {
+			query := strings.TrimSpace(strings.TrimPrefix(text, "/search"))
+			if query == "" {
+				fmt.Println("Usage: /search <query>")
+				continue
+			}
+			searchMessages(*serverAddr, loginResp.AccessToken, query)
+			continue
+		}
+
+		// Handle /thread command
+		if strings.HasPrefix(text, "/thread") {
+			parts := strings.Fields(text)
+			if len(parts) < 2 {
+				fmt.Println("Usage: /thread <id>")
+				continue
+			}
+			displayThread(*serverAddr, strings.TrimPrefix(parts[1], "#"), 50)
+			continue
+		}
+
+		// Handle /react and /unreact commands
+		if strings.HasPrefix(text, "/react") || strings.HasPrefix(text, "/unreact") {
+			parts := strings.Fields(text)
+			if len(parts) != 3 {
+				fmt.Printf("Usage: %s <id> <emoji>\n", parts[0])
+				continue
+			}
+			reactionType := "reaction_add"
+			if parts[0] == "/unreact" {
+				reactionType = "reaction_remove"
+			}
+			err = c.WriteJSON(Message{
+				ID:       strings.TrimPrefix(parts[1], "#"),
+				Type:     reactionType,
+				RoomID:   *roomID,
+				Username: *username,
+				Emoji:    parts[2],
+			})
+			if err != nil {
+				log.Printf("Error sending reaction: %v", err)
+				break
+			}
+			continue
+		}
+
+		// Handle /schedule command
+		if strings.HasPrefix(text, "/schedule ") {
+			parts := strings.SplitN(text, " ", 3)
+			if len(parts) < 3 || strings.TrimSpace(parts[2]) == "" {
+				fmt.Println("Usage: /schedule <time> <text>")
+				continue
+			}
+			sendAt, err := parseSendAt(parts[1], time.Now())
+			if err != nil {
+				fmt.Printf("Invalid time: %v\n", err)
+				continue
+			}
+			content := strings.TrimSpace(parts[2])
+			if roomSession != nil {
+				if content, err = roomSession.encrypt(content); err != nil {
+					log.Printf("Failed to encrypt message: %v", err)
+					continue
+				}
+			}
+			scheduled, err := scheduleMessage(*serverAddr, loginResp.AccessToken, *roomID, content, roomSession != nil, sendAt)
+			if err != nil {
+				log.Printf("Failed to schedule message: %v", err)
+				continue
+			}
+			fmt.Printf("Scheduled #%s for %s (/unschedule %s to cancel)\n", scheduled.ID, formatSendAt(scheduled.SendAt), scheduled.ID)
+			continue
+		}
+
+		// Handle /scheduled command
+		if text == "/scheduled" {
+			if err := viewScheduled(*serverAddr, loginResp.AccessToken, *roomID); err != nil {
+				log.Printf("Failed to fetch scheduled messages: %v", err)
+			}
+			continue
+		}
+
+		// Handle /logins command
+		if text == "/logins" {
+			if err := viewLogins(*serverAddr, loginResp.AccessToken); err != nil {
+				log.Printf("Failed to fetch login history: %v", err)
+			}
+			continue
+		}
+
+		// Handle /2fa command
+		if text == "/2fa" || strings.HasPrefix(text, "/2fa ") {
+			action, code, err := parseTwoFactorCommand(text)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			switch action {
+			case "enable":
+				err = enableTwoFactor(*serverAddr, loginResp.AccessToken)
+			case "confirm":
+				err = confirmTwoFactor(*serverAddr, loginResp.AccessToken, code)
+			case "disable":
+				if err = disableTwoFactor(*serverAddr, loginResp.AccessToken, code); err == nil {
+					fmt.Println("Two-factor authentication is disabled")
+				}
+			}
+			if err != nil {
+				log.Printf("Failed to %s two-factor authentication: %v", action, err)
+			}
+			continue
+		}
+
+		// Handle /passwd command
+		if text == "/passwd" {
+			fmt.Print("Current password: ")
+			current, _ := reader.ReadString('\n')
+			fmt.Print("New password: ")
+			newPassword, _ := reader.ReadString('\n')
+			token, err := changePassword(*serverAddr, loginResp.AccessToken, strings.TrimRight(current, "\r\n"), strings.TrimRight(newPassword, "\r\n"))
+			if err != nil {
+				log.Printf("Failed to change password: %v", err)
+				continue
+			}
+			loginResp.AccessToken = token
+			fmt.Println("Password changed, your other sessions are logged out")
+			continue
+		}
+
+		// Handle /resetpassword command
+		if strings.HasPrefix(text, "/resetpassword") {
+			parts := strings.Fields(text)
+			if len(parts) != 2 {
+				fmt.Println("Usage: /resetpassword <user>")
+				continue
+			}
+			reset, err := createPasswordReset(*serverAddr, loginResp.AccessToken, parts[1])
+			if err != nil {
+				log.Printf("Failed to reset the password of %s: %v", parts[1], err)
+				continue
+			}
+			fmt.Print(formatPasswordReset(parts[1], reset))
+			continue
+		}
+
+		// Handle /unlock command
+		if strings.HasPrefix(text, "/unlock") {
+			parts := strings.Fields(text)
+			if len(parts) != 2 {
+				fmt.Println("Usage: /unlock <user>")
+				continue
+			}
+			if err := unlockUser(*serverAddr, loginResp.AccessToken, parts[1]); err != nil {
+				log.Printf("Failed to unlock %s: %v", parts[1], err)
+				continue
+			}
+			fmt.Printf("Unlocked %s\n", parts[1])
+			continue
+		}
+
+		// Handle /unschedule command
+		if strings.HasPrefix(text, "/unschedule") {
+			parts := strings.Fields(text)
+			if len(parts) != 2 {
+				fmt.Println("Usage: /unschedule <id>")
+				continue
+			}
+			if err := cancelScheduled(*serverAddr, loginResp.AccessToken, strings.TrimPrefix(parts[1], "#")); err != nil {
+				log.Printf("Failed to cancel scheduled message: %v", err)
+				continue
+			}
+			fmt.Println("Scheduled message cancelled")
+			continue
+		}
+
+		// Handle /pins command
+		if text == "/pins" {
+			viewPins()
+			continue
+		}
+
+		// Handle /pin and /unpin commands
+		if strings.HasPrefix(text, "/pin ") || strings.HasPrefix(text, "/unpin") {
+			parts := strings.Fields(text)
+			if len(parts) != 2 {
+				fmt.Printf("Usage: %s <id>\n", parts[0])
+				continue
+			}
+			err = c.WriteJSON(Message{
+				ID:     strings.TrimPrefix(parts[1], "#"),
+				Type:   strings.TrimPrefix(parts[0], "/"),
+				RoomID: *roomID,
+			})
+			if err != nil {
+				log.Printf("Error sending pin: %v", err)
+				break
+			}
+			continue
+		}
+
+		// Handle /topic command
+		if text == "/topic" || strings.HasPrefix(text, "/topic ") {
+			topic := strings.TrimSpace(strings.TrimPrefix(text, "/topic"))
+			if err := updateTopic(*serverAddr, loginResp.AccessToken, *roomID, topic); err != nil {
+				log.Printf("Failed to set topic: %v", err)
+			}
+			continue
+		}
+
+		// Handle /ttl command
+		if strings.HasPrefix(text, "/ttl") {
+			parts := strings.Fields(text)
+			if len(parts) != 2 {
+				fmt.Println("Usage: /ttl <duration|off>")
+				continue
+			}
+			ttl, err := parseTTL(parts[1])
+			if err != nil {
+				fmt.Printf("Invalid duration: %v\n", err)
+				continue
+			}
+			if err := setRoomTTL(*serverAddr, loginResp.AccessToken, *roomID, ttl); err != nil {
+				log.Printf("Failed to set message TTL: %v", err)
+				continue
+			}
+			if ttl == 0 {
+				fmt.Println("Disappearing messages are off")
+			} else {
+				fmt.Printf("New messages will disappear after %s\n", parts[1])
+			}
+			continue
+		}
+
+		// Handle /expire command
+		ttl := 0
+		if strings.HasPrefix(text, "/expire") {
+			parts := strings.SplitN(text, " ", 3)
+			if len(parts) < 3 || strings.TrimSpace(parts[2]) == "" {
+				fmt.Println("Usage: /expire <duration> <text>")
+				continue
+			}
+			if ttl, err = parseTTL(parts[1]); err != nil || ttl == 0 {
+				fmt.Println("Usage: /expire <duration> <text>")
+				continue
+			}
+			text = strings.TrimSpace(parts[2])
+		}
+
+		// Handle /reply command
+		parentID := ""
+		if strings.HasPrefix(text, "/reply") {
+			parts := strings.SplitN(text, " ", 3)
+			if len(parts) < 3 || strings.TrimSpace(parts[2]) == "" {
+				fmt.Println("Usage: /reply <id> <text>")
+				continue
+			}
+			parentID = strings.TrimPrefix(parts[1], "#")
+			text = strings.TrimSpace(parts[2])
+		}
+
 		message := Message{
+			ParentID: parentID,
 			Content:  text,
 			RoomID:   *roomID,
 			Username: *username,
+			TTL:      ttl,
+		}
+		// Server commands are sent as typed, even in end-to-end encrypted rooms,
+		// because the server has to read them
+		if serverCommand(text) {
+			if err := c.WriteJSON(message); err != nil {
+				log.Printf("Error sending command: %v", err)
+				break
+			}
+			continue
+		}
+		if roomSession != nil {
+			// The server only removes the double slash from messages it can read
+			text = strings.TrimPrefix(text, "/")
+			if message.Content, err = roomSession.encrypt(text); err != nil {
+				log.Printf("Failed to encrypt message: %v", err)
+				continue
+			}
+			message.Encrypted = true
 		}
 
-		log.Printf("Sending message to room %s: %s", *roomID, text)
+		log.Printf("Sending message to room %s", *roomID)
 		err = c.WriteJSON(message)
 		if err != nil {
 			log.Printf("Error sending message: %v", err)
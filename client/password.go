@@ -0,0 +1,50 @@
+package main
+
+// Changing passwords and resetting them with tokens issued by server admins
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+type PasswordReset struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// changePassword changes your password and returns the new access token. The server revokes
+// the tokens of all your other sessions
+func changePassword(serverAddr, token, currentPassword, newPassword string) (string, error) {
+	body, _ := json.Marshal(map[string]string{"currentPassword": currentPassword, "newPassword": newPassword})
+	var loginResp LoginResponse
+	if err := scheduleRequest(http.MethodPut, serverAddr+"/users/me/password", token, body, &loginResp); err != nil {
+		return "", err
+	}
+	return loginResp.AccessToken, nil
+}
+
+// createPasswordReset issues a one-time password reset token for an account, server admins only
+func createPasswordReset(serverAddr, token, username string) (*PasswordReset, error) {
+	var reset PasswordReset
+	target := fmt.Sprintf("%s/admin/users/%s/password-reset", serverAddr, url.PathEscape(username))
+	if err := scheduleRequest(http.MethodPost, target, token, nil, &reset); err != nil {
+		return nil, err
+	}
+	return &reset, nil
+}
+
+// resetPassword sets a new password with a reset token
+func resetPassword(serverAddr, resetToken, newPassword string) error {
+	body, _ := json.Marshal(map[string]string{"token": resetToken, "newPassword": newPassword})
+	return scheduleRequest(http.MethodPost, serverAddr+"/password/reset", "", body, nil)
+}
+
+// formatPasswordReset tells the admin how to pass the reset token on
+func formatPasswordReset(username string, reset *PasswordReset) string {
+	return fmt.Sprintf("Password reset token for %s, valid until %s:\n  %s\n"+
+		"They set a new password with: ./client -username %s -password <new password> -resetToken <token>\n",
+		username, reset.ExpiresAt.Local().Format("Mon Jan 2 15:04"), reset.Token, username)
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatPasswordReset(t *testing.T) {
+	reset := &PasswordReset{Token: "chatgo_reset_abc", ExpiresAt: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+
+	got := formatPasswordReset("alice", reset)
+	if !strings.Contains(got, "\n  chatgo_reset_abc\n") {
+		t.Errorf("Expected the token on its own line, got %q", got)
+	}
+	if !strings.Contains(got, "-username alice -password <new password> -resetToken <token>") {
+		t.Errorf("Expected the reset command, got %q", got)
+	}
+}
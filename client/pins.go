@@ -0,0 +1,85 @@
+package main
+
+// Room topic and pinned messages
+
+import (
+	"chatgo/client/color"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gorilla/websocket"
+)
+
+type Pin struct {
+	Message  Message `json:"message"`
+	PinnedBy string  `json:"pinnedBy"`
+	PinnedAt string  `json:"pinnedAt"`
+}
+
+// roomPins holds the pinned messages of the current room. It is written by handleMessages
+// from welcome and pin events and read by the /pins command
+var roomPins atomic.Value
+
+// formatPins renders the pinned messages of the room, one per line
+func formatPins(pins []Pin) string {
+	if len(pins) == 0 {
+		return "No pinned messages"
+	}
+	lines := make([]string, 0, len(pins)+1)
+	lines = append(lines, fmt.Sprintf("📌 %d pinned:", len(pins)))
+	for _, pin := range pins {
+		openMessage(&pin.Message)
+		lines = append(lines, fmt.Sprintf("  %s (pinned by %s)", formatMessage(pin.Message), pin.PinnedBy))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// showWelcome prints the room topic and pinned messages sent on joining
+func showWelcome(message Message) {
+	fmt.Printf("%s%s%s\n", color.Bold, message.Content, color.Reset)
+	if message.Topic != "" {
+		fmt.Printf("Topic: %s\n", message.Topic)
+	}
+	if len(message.Pins) > 0 {
+		fmt.Println(formatPins(message.Pins))
+	}
+}
+
+// updateTopic changes the topic of the room, an empty topic clears it. Only room admins may change it
+func updateTopic(serverAddr, token, roomID, topic string) error {
+	wsScheme := "ws"
+	wsHost := strings.Replace(strings.Replace(serverAddr, "http://", "", 1), "https://", "", 1)
+	wsURL := fmt.Sprintf("%s://%s/ws/updateRoom", wsScheme, wsHost)
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+token)
+	updateConn, _, err := websocket.DefaultDialer.Dial(wsURL, header)
+	if err != nil {
+		return err
+	}
+	defer updateConn.Close()
+
+	if err := updateConn.WriteJSON(map[string]string{"id": roomID, "topic": topic}); err != nil {
+		return err
+	}
+	var room Room
+	return readResponse(updateConn, &room)
+}
+
+// viewPins prints the pinned messages of the current room
+func viewPins() {
+	pins, _ := roomPins.Load().([]Pin)
+	fmt.Println(formatPins(pins))
+}
+
+// showPinChange prints a pin or unpin event and remembers the updated pins
+func showPinChange(message Message) {
+	roomPins.Store(message.Pins)
+	action := "pinned"
+	if message.Type == "unpin" {
+		action = "unpinned"
+	}
+	fmt.Printf("  📌 %s %s #%s\n", color.ColorizeUsername(message.Username), action, message.ID)
+}
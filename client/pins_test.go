@@ -0,0 +1,27 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormatPins(t *testing.T) {
+	if got := formatPins(nil); got != "No pinned messages" {
+		t.Errorf("formatPins(nil) = %q", got)
+	}
+
+	got := formatPins([]Pin{
+		{Message: Message{ID: "10", Username: "bob", Content: "Release on Friday"}, PinnedBy: "alice"},
+		{Message: Message{ID: "12", Username: "carol", Content: "Runbook: docs/release.md"}, PinnedBy: "alice"},
+	})
+	lines := strings.Split(got, "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected a header and 2 pins, got %q", got)
+	}
+	if !strings.Contains(lines[0], "2 pinned") {
+		t.Errorf("Unexpected header %q", lines[0])
+	}
+	if !strings.Contains(lines[1], "#10") || !strings.Contains(lines[1], "Release on Friday") || !strings.HasSuffix(lines[1], "(pinned by alice)") {
+		t.Errorf("Unexpected pin line %q", lines[1])
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+// Polls: numbered options with vote bars, updated live as members vote
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// pollBarWidth is the width of a vote bar at 100% of the voters
+const pollBarWidth = 20
+
+type Poll struct {
+	ID        string       `json:"id"`
+	MessageID string       `json:"messageId"`
+	Question  string       `json:"question"`
+	Options   []PollOption `json:"options"`
+	Multiple  bool         `json:"multiple,omitempty"`
+	Anonymous bool         `json:"anonymous,omitempty"`
+	Voters    int          `json:"voters"`
+	ClosesAt  *time.Time   `json:"closesAt,omitempty"`
+	Closed    bool         `json:"closed,omitempty"`
+}
+
+type PollOption struct {
+	Text   string   `json:"text"`
+	Votes  int      `json:"votes"`
+	Voters []string `json:"voters,omitempty"`
+}
+
+// formatPoll renders a poll as a numbered list of options with vote bars, followed by how to vote
+// or, once the poll is closed, the final results
+func formatPoll(poll *Poll, now time.Time) string {
+	var kind []string
+	if poll.Multiple {
+		kind = append(kind, "multiple choice")
+	}
+	if poll.Anonymous {
+		kind = append(kind, "anonymous")
+	}
+	header := fmt.Sprintf("📊 Poll %s: %s", poll.ID, poll.Question)
+	if len(kind) > 0 {
+		header = fmt.Sprintf("%s (%s)", header, strings.Join(kind, ", "))
+	}
+
+	width := 0
+	for _, option := range poll.Options {
+		width = max(width, len([]rune(option.Text)))
+	}
+
+	lines := []string{header}
+	for i, option := range poll.Options {
+		percent := 0
+		if poll.Voters > 0 {
+			percent = option.Votes * 100 / poll.Voters
+		}
+		filled := percent * pollBarWidth / 100
+		line := fmt.Sprintf("  %2d. %-*s %s%s %d (%d%%)", i+1, width, option.Text,
+			strings.Repeat("█", filled), strings.Repeat("░", pollBarWidth-filled), option.Votes, percent)
+		if len(option.Voters) > 0 {
+			line += " " + strings.Join(option.Voters, ", ")
+		}
+		lines = append(lines, line)
+	}
+
+	voters := fmt.Sprintf("%d voters", poll.Voters)
+	if poll.Voters == 1 {
+		voters = "1 voter"
+	}
+	switch {
+	case poll.Closed:
+		lines = append(lines, fmt.Sprintf("  Final results, %s", voters))
+	case poll.ClosesAt != nil:
+		left := max(poll.ClosesAt.Sub(now).Round(time.Second), 0)
+		lines = append(lines, fmt.Sprintf("  %s, closes in %s, /vote %s <option>", voters, left, poll.ID))
+	default:
+		lines = append(lines, fmt.Sprintf("  %s, /vote %s <option>", voters, poll.ID))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// updatePoll replaces the poll of the shown message it belongs to and reports whether it was shown
+func (t *timeline) updatePoll(poll *Poll) bool {
+	for i := range t.messages {
+		if t.messages[i].Poll != nil && t.messages[i].Poll.ID == poll.ID {
+			t.messages[i].Poll = poll
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatPoll(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	closesAt := now.Add(90 * time.Minute)
+	poll := &Poll{
+		ID:       "3",
+		Question: "Lunch?",
+		Options: []PollOption{
+			{Text: "Pizza", Votes: 3, Voters: []string{"alice", "bob", "carol"}},
+			{Text: "Sushi", Votes: 1, Voters: []string{"dave"}},
+		},
+		Voters:   4,
+		ClosesAt: &closesAt,
+	}
+
+	lines := strings.Split(formatPoll(poll, now), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("Expected a header, 2 options and a footer, got %q", lines)
+	}
+	if lines[0] != "📊 Poll 3: Lunch?" {
+		t.Errorf("Unexpected header %q", lines[0])
+	}
+	if want := "   1. Pizza " + strings.Repeat("█", 15) + strings.Repeat("░", 5) + " 3 (75%) alice, bob, carol"; lines[1] != want {
+		t.Errorf("Option line = %q, want %q", lines[1], want)
+	}
+	if !strings.Contains(lines[3], "4 voters, closes in 1h30m0s, /vote 3 <option>") {
+		t.Errorf("Unexpected footer %q", lines[3])
+	}
+
+	poll.Closed = true
+	poll.Anonymous = true
+	poll.Multiple = true
+	got := formatPoll(poll, now)
+	if !strings.HasPrefix(got, "📊 Poll 3: Lunch? (multiple choice, anonymous)") || !strings.HasSuffix(got, "Final results, 4 voters") {
+		t.Errorf("Unexpected closed poll %q", got)
+	}
+}
+
+func TestFormatPoll_NoVotes(t *testing.T) {
+	poll := &Poll{ID: "3", Question: "Lunch?", Options: []PollOption{{Text: "Pizza"}, {Text: "Sushi"}}}
+
+	got := formatPoll(poll, time.Now())
+	if !strings.Contains(got, strings.Repeat("░", pollBarWidth)+" 0 (0%)") {
+		t.Errorf("Expected empty bars, got %q", got)
+	}
+}
+
+func TestTimelineUpdatePoll(t *testing.T) {
+	var shown timeline
+	shown.add(Message{ID: "10", Poll: &Poll{ID: "3", Voters: 1}})
+
+	if !shown.updatePoll(&Poll{ID: "3", Voters: 2}) {
+		t.Fatal("Expected the poll to be shown")
+	}
+	if shown.messages[0].Poll.Voters != 2 {
+		t.Errorf("Poll was not updated: %+v", shown.messages[0].Poll)
+	}
+	if shown.updatePoll(&Poll{ID: "4"}) {
+		t.Error("Poll 4 is not shown")
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+// User profiles: /whois, /profile and the list of room members
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+type Profile struct {
+	ID          string    `json:"id"`
+	Username    string    `json:"username"`
+	DisplayName string    `json:"displayName"`
+	Bio         string    `json:"bio"`
+	AvatarID    string    `json:"avatarId"`
+	Timezone    string    `json:"timezone"`
+	Status      string    `json:"status"`
+	StatusText  string    `json:"statusText"`
+	IsBot       bool      `json:"isBot"`
+	CreatedAt   time.Time `json:"createdAt"`
+	LastSeenAt  string    `json:"lastSeenAt"`
+}
+
+// profileFields maps the field names of /profile to the fields of the profile request
+var profileFields = map[string]string{
+	"name":   "displayName",
+	"bio":    "bio",
+	"avatar": "avatarId",
+	"tz":     "timezone",
+	"status": "statusText",
+}
+
+// getProfile fetches the profile of a user
+func getProfile(serverAddr, token, username string) (*Profile, error) {
+	var profile Profile
+	target := fmt.Sprintf("%s/users/%s/profile", serverAddr, url.PathEscape(username))
+	if err := scheduleRequest(http.MethodGet, target, token, nil, &profile); err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+// updateProfile sets one field of your profile, an empty value clears it
+func updateProfile(serverAddr, token, field, value string) (*Profile, error) {
+	body, _ := json.Marshal(map[string]string{profileFields[field]: value})
+	var profile Profile
+	if err := scheduleRequest(http.MethodPut, serverAddr+"/users/me/profile", token, body, &profile); err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+// parseProfileCommand parses "/profile <field> [value]"
+func parseProfileCommand(text string) (field, value string, err error) {
+	args := strings.TrimSpace(strings.TrimPrefix(text, "/profile"))
+	field, value, _ = strings.Cut(args, " ")
+	if _, ok := profileFields[field]; !ok {
+		return "", "", errors.New("usage: /profile <name|bio|avatar|tz|status> [value], without a value the field is cleared")
+	}
+	// Bios may span lines, typed as \n
+	if field == "bio" {
+		value = strings.ReplaceAll(value, `\n`, "\n")
+	}
+	return field, strings.TrimSpace(value), nil
+}
+
+// formatProfile renders a profile for /whois, with the user's local time at now
+func formatProfile(p *Profile, now time.Time) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n", memberName(p.Username, p.DisplayName))
+	if p.IsBot {
+		b.WriteString("  Bot account\n")
+	}
+	status := p.Status
+	if p.StatusText != "" {
+		status += ", " + p.StatusText
+	}
+	if status != "" {
+		fmt.Fprintf(&b, "  Status:   %s\n", status)
+	}
+	if p.Bio != "" {
+		fmt.Fprintf(&b, "  Bio:      %s\n", strings.ReplaceAll(p.Bio, "\n", "\n            "))
+	}
+	if p.Timezone != "" {
+		if loc, err := time.LoadLocation(p.Timezone); err == nil {
+			fmt.Fprintf(&b, "  Time:     %s (%s)\n", now.In(loc).Format("Mon 15:04"), p.Timezone)
+		} else {
+			fmt.Fprintf(&b, "  Timezone: %s\n", p.Timezone)
+		}
+	}
+	if p.AvatarID != "" {
+		fmt.Fprintf(&b, "  Avatar:   /download %s\n", p.AvatarID)
+	}
+	if seen, err := time.Parse(time.RFC3339, p.LastSeenAt); err == nil {
+		fmt.Fprintf(&b, "  Seen:     %s\n", seen.Local().Format("Mon Jan 2 15:04"))
+	}
+	if !p.CreatedAt.IsZero() {
+		fmt.Fprintf(&b, "  Joined:   %s\n", p.CreatedAt.Local().Format("Jan 2 2006"))
+	}
+	return b.String()
+}
+
+// getRoomMembers lists the members connected to a room
+func getRoomMembers(serverAddr, roomID string) ([]ClientRes, error) {
+	wsHost := strings.Replace(strings.Replace(serverAddr, "http://", "", 1), "https://", "", 1)
+	c, _, err := websocket.DefaultDialer.Dial(fmt.Sprintf("ws://%s/ws/getRoomClients/%s", wsHost, roomID), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	var clients []ClientRes
+	if err := c.ReadJSON(&clients); err != nil {
+		return nil, err
+	}
+	return clients, nil
+}
+
+// formatMember renders a room member with their display name and status text
+func formatMember(m ClientRes) string {
+	line := "  " + memberName(m.Username, m.DisplayName)
+	if m.StatusText != "" {
+		line += " — " + m.StatusText
+	}
+	return line
+}
+
+// memberName shows the display name, if there is one, with the username
+func memberName(username, displayName string) string {
+	if displayName == "" {
+		return "@" + username
+	}
+	return fmt.Sprintf("%s (@%s)", displayName, username)
+}
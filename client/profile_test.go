@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseProfileCommand(t *testing.T) {
+	field, value, err := parseProfileCommand("/profile name  Alice Liddell ")
+	if err != nil || field != "name" || value != "Alice Liddell" {
+		t.Errorf("Expected name %q, got %q %q, %v", "Alice Liddell", field, value, err)
+	}
+
+	field, value, err = parseProfileCommand(`/profile bio Curious\nand curiouser`)
+	if err != nil || field != "bio" || value != "Curious\nand curiouser" {
+		t.Errorf("Expected a bio on two lines, got %q %q, %v", field, value, err)
+	}
+
+	// Without a value the field is cleared
+	field, value, err = parseProfileCommand("/profile tz")
+	if err != nil || field != "tz" || value != "" {
+		t.Errorf("Expected an empty time zone, got %q %q, %v", field, value, err)
+	}
+
+	for _, text := range []string{"/profile", "/profile email alice@example.com"} {
+		if _, _, err := parseProfileCommand(text); err == nil {
+			t.Errorf("Expected an error for %q", text)
+		}
+	}
+}
+
+func TestFormatProfile(t *testing.T) {
+	profile := &Profile{
+		Username:    "alice",
+		DisplayName: "Alice Liddell",
+		Bio:         "Curious\nand curiouser",
+		AvatarID:    "7",
+		Timezone:    "UTC",
+		Status:      "away",
+		StatusText:  "reading",
+	}
+
+	got := formatProfile(profile, time.Date(2024, 1, 1, 12, 30, 0, 0, time.UTC))
+	for _, want := range []string{
+		"Alice Liddell (@alice)\n",
+		"Status:   away, reading\n",
+		"Bio:      Curious\n            and curiouser\n",
+		"Time:     Mon 12:30 (UTC)\n",
+		"Avatar:   /download 7\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Expected %q in %q", want, got)
+		}
+	}
+
+	got = formatProfile(&Profile{Username: "bob", Timezone: "Mars/Olympus"}, time.Now())
+	if !strings.HasPrefix(got, "@bob\n") || !strings.Contains(got, "Timezone: Mars/Olympus\n") {
+		t.Errorf("Expected the username and the unknown time zone, got %q", got)
+	}
+}
+
+func TestFormatMember(t *testing.T) {
+	if got := formatMember(ClientRes{Username: "bob"}); got != "  @bob" {
+		t.Errorf("Expected %q, got %q", "  @bob", got)
+	}
+	want := "  Alice Liddell (@alice) — reading"
+	if got := formatMember(ClientRes{Username: "alice", DisplayName: "Alice Liddell", StatusText: "reading"}); got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+// Scheduled messages: parsing send times and the scheduling API
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type ScheduledMessage struct {
+	ID        string `json:"id"`
+	RoomID    string `json:"roomId"`
+	Content   string `json:"content"`
+	SendAt    string `json:"sendAt"`
+	Encrypted bool   `json:"encrypted,omitempty"`
+}
+
+// parseSendAt parses when to send a scheduled message: a clock time like 09:00 (the next
+// occurrence, today or tomorrow), a delay like 10m or +1h30m, or a date and time like
+// 2024-05-01T09:00 or RFC 3339
+func parseSendAt(value string, now time.Time) (time.Time, error) {
+	if clock, err := time.ParseInLocation("15:04", value, now.Location()); err == nil {
+		at := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, now.Location())
+		if !at.After(now) {
+			at = at.AddDate(0, 0, 1)
+		}
+		return at, nil
+	}
+	if d, err := time.ParseDuration(strings.TrimPrefix(value, "+")); err == nil {
+		if d <= 0 {
+			return time.Time{}, fmt.Errorf("delay must be positive")
+		}
+		return now.Add(d), nil
+	}
+	if at, err := time.ParseInLocation("2006-01-02T15:04", value, now.Location()); err == nil {
+		return at, nil
+	}
+	if at, err := time.Parse(time.RFC3339, value); err == nil {
+		return at, nil
+	}
+	return time.Time{}, fmt.Errorf("use HH:MM, a delay like 10m or YYYY-MM-DDTHH:MM")
+}
+
+// scheduleMessage asks the server to send content to the room at sendAt
+func scheduleMessage(serverAddr, token, roomID, content string, encrypted bool, sendAt time.Time) (*ScheduledMessage, error) {
+	body, _ := json.Marshal(map[string]interface{}{
+		"content":   content,
+		"sendAt":    sendAt.Format(time.RFC3339),
+		"encrypted": encrypted,
+	})
+	var scheduled ScheduledMessage
+	err := scheduleRequest(http.MethodPost, fmt.Sprintf("%s/rooms/%s/scheduled", serverAddr, url.PathEscape(roomID)), token, body, &scheduled)
+	if err != nil {
+		return nil, err
+	}
+	return &scheduled, nil
+}
+
+// viewScheduled prints your scheduled messages to the room that weren't sent yet
+func viewScheduled(serverAddr, token, roomID string) error {
+	var scheduled []ScheduledMessage
+	err := scheduleRequest(http.MethodGet, fmt.Sprintf("%s/scheduled?roomId=%s", serverAddr, url.QueryEscape(roomID)), token, nil, &scheduled)
+	if err != nil {
+		return err
+	}
+
+	if len(scheduled) == 0 {
+		fmt.Println("No scheduled messages")
+		return nil
+	}
+	for _, m := range scheduled {
+		if m.Encrypted {
+			m.Content = "🔒 encrypted message"
+		}
+		fmt.Printf("  #%s at %s: %s\n", m.ID, formatSendAt(m.SendAt), m.Content)
+	}
+	return nil
+}
+
+// cancelScheduled cancels one of your scheduled messages
+func cancelScheduled(serverAddr, token, id string) error {
+	return scheduleRequest(http.MethodDelete, fmt.Sprintf("%s/scheduled/%s", serverAddr, url.PathEscape(id)), token, nil, nil)
+}
+
+// formatSendAt renders a send time in local time
+func formatSendAt(sendAt string) string {
+	at, err := time.Parse(time.RFC3339, sendAt)
+	if err != nil {
+		return sendAt
+	}
+	return at.Local().Format("Mon Jan 2 15:04")
+}
+
+func scheduleRequest(method, target, token string, body []byte, v interface{}) error {
+	req, err := http.NewRequest(method, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("request failed: %s", string(body))
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
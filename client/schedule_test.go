@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSendAt(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{value: "17:00", want: time.Date(2024, 5, 1, 17, 0, 0, 0, time.UTC)},
+		{value: "09:00", want: time.Date(2024, 5, 2, 9, 0, 0, 0, time.UTC)},
+		{value: "10:30", want: time.Date(2024, 5, 2, 10, 30, 0, 0, time.UTC)},
+		{value: "10m", want: now.Add(10 * time.Minute)},
+		{value: "+1h30m", want: now.Add(90 * time.Minute)},
+		{value: "2024-06-01T09:00", want: time.Date(2024, 6, 1, 9, 0, 0, 0, time.UTC)},
+		{value: "2024-06-01T09:00:00+02:00", want: time.Date(2024, 6, 1, 7, 0, 0, 0, time.UTC)},
+		{value: "-5m", wantErr: true},
+		{value: "tomorrow", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseSendAt(tt.value, now)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseSendAt(%q) = %v, want error", tt.value, got)
+			}
+			continue
+		}
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("parseSendAt(%q) = %v, %v, want %v", tt.value, got, err, tt.want)
+		}
+	}
+}
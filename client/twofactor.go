@@ -0,0 +1,96 @@
+package main
+
+// Two-factor authentication with an authenticator app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type TwoFactorEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+	QRCode string `json:"qrCode"`
+}
+
+// loginTwoFactor finishes a login with two-factor authentication. The code is a code from
+// the authenticator app or a recovery code
+func loginTwoFactor(serverAddr, token, code string) (*LoginResponse, error) {
+	body, _ := json.Marshal(map[string]string{"token": token, "code": code})
+	var loginResp LoginResponse
+	if err := scheduleRequest(http.MethodPost, serverAddr+"/login/2fa", "", body, &loginResp); err != nil {
+		return nil, err
+	}
+	return &loginResp, nil
+}
+
+// parseTwoFactorCommand splits "/2fa enable", "/2fa confirm <code>" and "/2fa disable <code>"
+// into the action and the code
+func parseTwoFactorCommand(text string) (string, string, error) {
+	parts := strings.Fields(text)
+	if len(parts) < 2 {
+		return "", "", errors.New("usage: /2fa enable | /2fa confirm <code> | /2fa disable <code>")
+	}
+
+	action, code := parts[1], strings.Join(parts[2:], "")
+	switch action {
+	case "enable":
+		return action, "", nil
+	case "confirm", "disable":
+		if code == "" {
+			return "", "", fmt.Errorf("usage: /2fa %s <code>", action)
+		}
+		return action, code, nil
+	default:
+		return "", "", fmt.Errorf("unknown /2fa action %q", action)
+	}
+}
+
+// enableTwoFactor creates a new TOTP secret and prints it as a QR code to scan with an
+// authenticator app. Logins require codes once it is confirmed with /2fa confirm
+func enableTwoFactor(serverAddr, token string) error {
+	var enrollment TwoFactorEnrollment
+	if err := scheduleRequest(http.MethodPost, serverAddr+"/users/me/2fa", token, nil, &enrollment); err != nil {
+		return err
+	}
+
+	fmt.Println("Scan this QR code with your authenticator app:")
+	fmt.Println(enrollment.QRCode)
+	fmt.Printf("Or enter the secret manually: %s\n", enrollment.Secret)
+	fmt.Println("Then type /2fa confirm <code> with the code the app shows")
+	return nil
+}
+
+// confirmTwoFactor enables two-factor authentication and prints the recovery codes
+func confirmTwoFactor(serverAddr, token, code string) error {
+	body, _ := json.Marshal(map[string]string{"code": code})
+	var res struct {
+		RecoveryCodes []string `json:"recoveryCodes"`
+	}
+	if err := scheduleRequest(http.MethodPost, serverAddr+"/users/me/2fa/confirm", token, body, &res); err != nil {
+		return err
+	}
+
+	fmt.Println("Two-factor authentication is enabled")
+	fmt.Print(formatRecoveryCodes(res.RecoveryCodes))
+	return nil
+}
+
+// disableTwoFactor turns two-factor authentication off
+func disableTwoFactor(serverAddr, token, code string) error {
+	body, _ := json.Marshal(map[string]string{"code": code})
+	return scheduleRequest(http.MethodDelete, serverAddr+"/users/me/2fa", token, body, nil)
+}
+
+// formatRecoveryCodes renders the recovery codes, which the server shows only once
+func formatRecoveryCodes(codes []string) string {
+	var b strings.Builder
+	b.WriteString("Save these recovery codes somewhere safe. Each can be used once instead of a code:\n")
+	for _, code := range codes {
+		b.WriteString("  " + code + "\n")
+	}
+	return b.String()
+}
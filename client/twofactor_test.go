@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseTwoFactorCommand(t *testing.T) {
+	tests := []struct {
+		text   string
+		action string
+		code   string
+		err    bool
+	}{
+		{text: "/2fa enable", action: "enable"},
+		{text: "/2fa confirm 123456", action: "confirm", code: "123456"},
+		{text: "/2fa confirm 123 456", action: "confirm", code: "123456"},
+		{text: "/2fa disable abcd-efgh-ijkl-mnop", action: "disable", code: "abcd-efgh-ijkl-mnop"},
+		{text: "/2fa", err: true},
+		{text: "/2fa confirm", err: true},
+		{text: "/2fa reset", err: true},
+	}
+	for _, tt := range tests {
+		action, code, err := parseTwoFactorCommand(tt.text)
+		if tt.err {
+			if err == nil {
+				t.Errorf("Expected an error for %q", tt.text)
+			}
+			continue
+		}
+		if err != nil || action != tt.action || code != tt.code {
+			t.Errorf("parseTwoFactorCommand(%q) = %q, %q, %v", tt.text, action, code, err)
+		}
+	}
+}
+
+func TestFormatRecoveryCodes(t *testing.T) {
+	got := formatRecoveryCodes([]string{"aaaa-bbbb-cccc-dddd", "eeee-ffff-gggg-hhhh"})
+	if !strings.Contains(got, "  aaaa-bbbb-cccc-dddd\n  eeee-ffff-gggg-hhhh\n") {
+		t.Errorf("Unexpected recovery codes %q", got)
+	}
+}
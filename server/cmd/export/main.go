@@ -0,0 +1,94 @@
+// Command export writes the decrypted history of a room to a file or stdout.
+//
+//	export [-config path] -room id [-format jsonl|csv|html|text] [-from date] [-to date] [-o file]
+//
+// Dates are YYYY-MM-DD or RFC3339. The command reads the database directly, so it is meant
+// for operators and skips the room admin check of the /export endpoint.
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"chatgo/server/internal/db"
+	"chatgo/server/internal/export"
+	"chatgo/server/internal/interfaces"
+	"chatgo/server/internal/services"
+	"chatgo/server/internal/storage"
+	"chatgo/server/pkg/config"
+)
+
+func main() {
+	configPath := flag.String("config", "/home/sergei/Desktop/mipt/GO/ChatGO/server/pkg/config/config.yaml", "Path to the config file")
+	roomID := flag.String("room", "", "Room ID")
+	format := flag.String("format", string(export.JSONL), "Output format: jsonl, csv, html or text")
+	fromFlag := flag.String("from", "", "Export messages sent at or after this time")
+	toFlag := flag.String("to", "", "Export messages sent before this time")
+	output := flag.String("o", "", "Output file, stdout when empty")
+	flag.Parse()
+
+	if *roomID == "" {
+		fmt.Fprintln(os.Stderr, "Usage: export [-config path] -room id [-format jsonl|csv|html|text] [-from date] [-to date] [-o file]")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+	if _, err := export.ParseFormat(*format); err != nil {
+		log.Fatal(err)
+	}
+	from, err := export.ParseTime(*fromFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	to, err := export.ParseTime(*toFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	database, err := db.NewDatabase(&cfg.Database)
+	if err != nil {
+		log.Fatalf("Could not initialize the database: %v", err)
+	}
+	defer database.Close()
+
+	blobs, err := storage.New(&cfg.Storage)
+	if err != nil {
+		log.Fatalf("Could not initialize the blob storage: %v", err)
+	}
+
+	repository := db.NewRepository(database.GetDB())
+	service := services.NewService(repository, &cfg.Service, blobs)
+
+	out := os.Stdout
+	if *output != "" {
+		out, err = os.Create(*output)
+		if err != nil {
+			log.Fatalf("Failed to create %s: %v", *output, err)
+		}
+	}
+	w := bufio.NewWriter(out)
+
+	err = service.ExportMessagesAsOperator(context.Background(), &interfaces.ExportMessagesReq{
+		RoomID: *roomID,
+		Format: *format,
+		From:   from,
+		To:     to,
+	}, w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil && out != os.Stdout {
+		err = out.Close()
+	}
+	if err != nil {
+		log.Fatalf("Failed to export room %s: %v", *roomID, err)
+	}
+}
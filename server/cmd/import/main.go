@@ -0,0 +1,67 @@
+// Command import moves users, rooms, memberships and messages from a Slack or Mattermost export
+// into the database.
+//
+//	import [-config path] -format slack|mattermost file
+//
+// Slack exports are the zip archive of a workspace export, Mattermost exports are the JSONL file of
+// a bulk export. Everything imported is recorded, so an interrupted import can be run again and
+// continues where it stopped. New users get a random password that nobody knows.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"chatgo/server/internal/db"
+	"chatgo/server/internal/interfaces"
+	"chatgo/server/internal/services"
+	"chatgo/server/internal/storage"
+	"chatgo/server/pkg/config"
+)
+
+func main() {
+	configPath := flag.String("config", "/home/sergei/Desktop/mipt/GO/ChatGO/server/pkg/config/config.yaml", "Path to the config file")
+	format := flag.String("format", "", "Export format: slack or mattermost")
+	flag.Parse()
+
+	if *format == "" || flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: import [-config path] -format slack|mattermost file")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+	path := flag.Arg(0)
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	database, err := db.NewDatabase(&cfg.Database)
+	if err != nil {
+		log.Fatalf("Could not initialize the database: %v", err)
+	}
+	defer database.Close()
+
+	blobs, err := storage.New(&cfg.Storage)
+	if err != nil {
+		log.Fatalf("Could not initialize the blob storage: %v", err)
+	}
+
+	repository := db.NewRepository(database.GetDB())
+	service := services.NewService(repository, &cfg.Service, blobs)
+
+	res, err := service.ImportHistory(context.Background(), &interfaces.ImportHistoryReq{
+		Format: *format,
+		Path:   path,
+	})
+	if res != nil {
+		log.Printf("Imported %d users (%d renamed), %d rooms, %d memberships and %d messages, skipped %d entries of unknown users",
+			res.Users, res.Renamed, res.Rooms, res.Members, res.Messages, res.Skipped)
+	}
+	if err != nil {
+		log.Fatalf("Failed to import %s: %v", path, err)
+	}
+}
@@ -0,0 +1,115 @@
+// Command keys manages per-room encryption keys.
+//
+//	keys [-config path] rotate [-room id]     create a new key version and re-encrypt history
+//	keys [-config path] reencrypt [-room id]  re-encrypt history with the current key version
+//	keys [-config path] rewrap -new-key key   wrap all room keys and TOTP secrets with a new master key
+//
+// Without -room every room is processed. The server may keep running: old key versions
+// are retained, so history stays readable while it's being re-encrypted.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"chatgo/server/internal/db"
+	"chatgo/server/internal/interfaces"
+	"chatgo/server/internal/services"
+	"chatgo/server/internal/storage"
+	"chatgo/server/pkg/config"
+)
+
+func main() {
+	configPath := flag.String("config", "/home/sergei/Desktop/mipt/GO/ChatGO/server/pkg/config/config.yaml", "Path to the config file")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() < 1 {
+		usage()
+		os.Exit(2)
+	}
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	database, err := db.NewDatabase(&cfg.Database)
+	if err != nil {
+		log.Fatalf("Could not initialize the database: %v", err)
+	}
+	defer database.Close()
+
+	blobs, err := storage.New(&cfg.Storage)
+	if err != nil {
+		log.Fatalf("Could not initialize the blob storage: %v", err)
+	}
+
+	repository := db.NewRepository(database.GetDB())
+	service := services.NewService(repository, &cfg.Service, blobs)
+	ctx := context.Background()
+
+	cmd := flag.NewFlagSet(flag.Arg(0), flag.ExitOnError)
+	switch flag.Arg(0) {
+	case "rotate", "reencrypt":
+		roomID := cmd.String("room", "", "Room ID, all rooms when empty")
+		cmd.Parse(flag.Args()[1:])
+
+		roomIDs, err := rooms(ctx, service, *roomID)
+		if err != nil {
+			log.Fatalf("Failed to list rooms: %v", err)
+		}
+		for _, id := range roomIDs {
+			if flag.Arg(0) == "rotate" {
+				version, err := service.RotateRoomKey(ctx, id)
+				if err != nil {
+					log.Fatalf("Failed to rotate key of room %s: %v", id, err)
+				}
+				log.Printf("Room %s: rotated to key version %d", id, version)
+			}
+
+			res, err := service.ReencryptRoom(ctx, id)
+			if err != nil {
+				log.Fatalf("Failed to re-encrypt room %s: %v", id, err)
+			}
+			log.Printf("Room %s: re-encrypted %d messages and %d attachments with key version %d, %d failed",
+				id, res.Messages, res.Attachments, res.KeyVersion, res.Failed)
+		}
+	case "rewrap":
+		newKey := cmd.String("new-key", os.Getenv("CHATGO_NEW_MASTER_KEY"), "New base64 encoded master key")
+		cmd.Parse(flag.Args()[1:])
+
+		n, err := service.RewrapKeys(ctx, *newKey)
+		if err != nil {
+			log.Fatalf("Failed to rewrap keys: %v", err)
+		}
+		log.Printf("Re-wrapped %d room keys, restart the server with the new master key", n)
+	default:
+		usage()
+		os.Exit(2)
+	}
+}
+
+func rooms(ctx context.Context, service interfaces.Service, roomID string) ([]string, error) {
+	if roomID != "" {
+		return []string{roomID}, nil
+	}
+
+	chatRooms, err := service.GetAllChatRooms(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(chatRooms))
+	for i, room := range chatRooms {
+		ids[i] = room.ID
+	}
+	return ids, nil
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: keys [-config path] rotate|reencrypt [-room id]")
+	fmt.Fprintln(os.Stderr, "       keys [-config path] rewrap -new-key key")
+	flag.PrintDefaults()
+}
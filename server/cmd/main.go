@@ -1,18 +1,26 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"log"
 
 	"chatgo/server/internal/db"
+	"chatgo/server/internal/plugins/greeter"
+	"chatgo/server/internal/ratelimit"
 	"chatgo/server/internal/services"
+	"chatgo/server/internal/storage"
 	"chatgo/server/internal/transport"
 	"chatgo/server/pkg/config"
 	"chatgo/server/router"
 )
 
 func main() {
+	configPath := flag.String("config", "/home/sergei/Desktop/mipt/GO/ChatGO/server/pkg/config/config.yaml", "Path to the config file")
+	flag.Parse()
+
 	// Load configuration
-	cfg, err := config.LoadConfig("/home/sergei/Desktop/mipt/GO/ChatGO/server/pkg/config/config.yaml")
+	cfg, err := config.LoadConfig(*configPath)
 	if err != nil {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
@@ -26,18 +34,44 @@ func main() {
 	// Initialize repository
 	repository := db.NewRepository(database.GetDB())
 
+	// Initialize blob storage for attachments
+	blobs, err := storage.New(&cfg.Storage)
+	if err != nil {
+		log.Fatalf("Could not initialize the blob storage: %v", err)
+	}
+
 	// Initialize service
-	service := services.NewService(repository, &cfg.Service)
+	service := services.NewService(repository, &cfg.Service, blobs)
+	if err := service.BuildSearchIndex(context.Background()); err != nil {
+		log.Printf("Failed to build search index: %v", err)
+	}
+
+	// Apply retention policies in the background
+	go service.RunRetention(context.Background())
+
+	// Initialize rate limits, shared by all instances when they are kept in the database
+	limiter, err := ratelimit.New(&cfg.RateLimit, database.GetDB())
+	if err != nil {
+		log.Fatalf("Could not initialize rate limits: %v", err)
+	}
+	go limiter.Run(context.Background())
 
 	// Initialize handlers
-	userHandler := transport.NewUserHandler(service)
+	userHandler := transport.NewUserHandler(service, limiter)
 
 	// Initialize WebSocket hub and handler
-	hub := transport.NewHub(service)
-	wsHandler := transport.NewWSHandler(hub, service)
+	hub := transport.NewHub(service, limiter)
+	wsHandler := transport.NewWSHandler(hub, service, services.MaxAttachmentSize)
+	if cfg.Plugins.Greeter.Token != "" {
+		if err := hub.RegisterPlugin(greeter.New(&cfg.Plugins.Greeter), cfg.Plugins.Greeter.Token); err != nil {
+			log.Fatalf("Could not register the greeter plugin: %v", err)
+		}
+	}
 	go hub.Run()
 
 	// Initialize router with all handlers
-	router.InitRouter(userHandler, wsHandler)
+	if err := router.InitRouter(&cfg.Server, userHandler, wsHandler); err != nil {
+		log.Fatalf("Could not initialize the router: %v", err)
+	}
 	router.Start(&cfg.Server)
 }
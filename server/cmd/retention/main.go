@@ -0,0 +1,153 @@
+// Command retention manages message retention policies.
+//
+//	retention [-config path] show -room id          print the effective policy of a room
+//	retention [-config path] set -room id [-max-age-days n] [-max-messages n]
+//	                                                set the limits of a room
+//	retention [-config path] hold -room id          put a room on legal hold
+//	retention [-config path] release -room id       release a room from legal hold
+//	retention [-config path] purge                  apply all policies now
+//	retention [-config path] log [-room id] [-limit n]
+//	                                                print the purge log
+//
+// Limits of set that are omitted or -1 inherit the global policy, 0 keeps messages forever.
+// The server applies the policies on its own every retention interval, purge is for running them
+// right away.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"chatgo/server/internal/db"
+	"chatgo/server/internal/interfaces"
+	"chatgo/server/internal/services"
+	"chatgo/server/internal/storage"
+	"chatgo/server/pkg/config"
+)
+
+func main() {
+	configPath := flag.String("config", "/home/sergei/Desktop/mipt/GO/ChatGO/server/pkg/config/config.yaml", "Path to the config file")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() < 1 {
+		usage()
+		os.Exit(2)
+	}
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	database, err := db.NewDatabase(&cfg.Database)
+	if err != nil {
+		log.Fatalf("Could not initialize the database: %v", err)
+	}
+	defer database.Close()
+
+	blobs, err := storage.New(&cfg.Storage)
+	if err != nil {
+		log.Fatalf("Could not initialize the blob storage: %v", err)
+	}
+
+	repository := db.NewRepository(database.GetDB())
+	service := services.NewService(repository, &cfg.Service, blobs)
+	ctx := context.Background()
+
+	cmd := flag.NewFlagSet(flag.Arg(0), flag.ExitOnError)
+	roomID := cmd.String("room", "", "Room ID")
+	switch flag.Arg(0) {
+	case "show", "hold", "release":
+		cmd.Parse(flag.Args()[1:])
+		requireRoom(*roomID)
+
+		var policy *interfaces.RetentionPolicyRes
+		switch flag.Arg(0) {
+		case "show":
+			policy, err = service.GetRetentionPolicy(ctx, "", *roomID)
+		default:
+			policy, err = service.SetLegalHold(ctx, *roomID, flag.Arg(0) == "hold")
+		}
+		if err != nil {
+			log.Fatalf("Failed to %s room %s: %v", flag.Arg(0), *roomID, err)
+		}
+		printPolicy(policy)
+	case "set":
+		maxAgeDays := cmd.Int("max-age-days", -1, "Days to keep messages, 0 keeps them forever, -1 inherits the global policy")
+		maxMessages := cmd.Int("max-messages", -1, "Threads to keep, 0 keeps all, -1 inherits the global policy")
+		cmd.Parse(flag.Args()[1:])
+		requireRoom(*roomID)
+
+		policy, err := service.SetRetentionPolicy(ctx, &interfaces.SetRetentionPolicyReq{
+			RoomID:      *roomID,
+			MaxAgeDays:  limit(*maxAgeDays),
+			MaxMessages: limit(*maxMessages),
+		})
+		if err != nil {
+			log.Fatalf("Failed to set the policy of room %s: %v", *roomID, err)
+		}
+		printPolicy(policy)
+	case "purge":
+		cmd.Parse(flag.Args()[1:])
+
+		res, err := service.PurgeExpiredMessages(ctx)
+		if err != nil {
+			log.Fatalf("Failed to purge messages: %v", err)
+		}
+		log.Printf("Purged %d messages and %d attachments in %d rooms", res.Messages, res.Attachments, res.Rooms)
+	case "log":
+		n := cmd.Int("limit", 50, "Number of entries")
+		cmd.Parse(flag.Args()[1:])
+
+		purges, err := service.GetPurgeLog(ctx, *roomID, *n)
+		if err != nil {
+			log.Fatalf("Failed to read the purge log: %v", err)
+		}
+		for _, purge := range purges {
+			action := "deleted"
+			if purge.Archived {
+				action = "archived"
+			}
+			fmt.Printf("%s  room %s  %s %d messages and %d attachments (%s)\n",
+				purge.CreatedAt.Format("2006-01-02 15:04:05"), purge.RoomID, action, purge.Messages, purge.Attachments, purge.Reason)
+		}
+	default:
+		usage()
+		os.Exit(2)
+	}
+}
+
+func requireRoom(roomID string) {
+	if roomID == "" {
+		usage()
+		os.Exit(2)
+	}
+}
+
+// limit turns a flag value into a policy limit, negative values inherit the global policy
+func limit(value int) *int {
+	if value < 0 {
+		return nil
+	}
+	return &value
+}
+
+func printPolicy(policy *interfaces.RetentionPolicyRes) {
+	out, err := json.MarshalIndent(policy, "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(string(out))
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: retention [-config path] show|hold|release -room id")
+	fmt.Fprintln(os.Stderr, "       retention [-config path] set -room id [-max-age-days n] [-max-messages n]")
+	fmt.Fprintln(os.Stderr, "       retention [-config path] purge")
+	fmt.Fprintln(os.Stderr, "       retention [-config path] log [-room id] [-limit n]")
+	flag.PrintDefaults()
+}
@@ -0,0 +1,143 @@
+package db
+
+import (
+	"chatgo/server/internal/models"
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+const attachmentColumns = `id, chat_room_id, uploader_id, message_id, filename, content_type, size, storage_key, key_version, created_at`
+
+func scanAttachment(row rowScanner, attachment *models.Attachment) error {
+	return row.Scan(
+		&attachment.ID,
+		&attachment.ChatRoomID,
+		&attachment.UploaderID,
+		&attachment.MessageID,
+		&attachment.Filename,
+		&attachment.ContentType,
+		&attachment.Size,
+		&attachment.StorageKey,
+		&attachment.KeyVersion,
+		&attachment.CreatedAt,
+	)
+}
+
+// CreateAttachment добавляет запись о загруженном файле, устанавливает created_at CURRENT_TIMESTAMP
+func (r *repository) CreateAttachment(ctx context.Context, attachment *models.Attachment) (*models.Attachment, error) {
+	query := `INSERT INTO attachments (chat_room_id, uploader_id, filename, content_type, size, storage_key, key_version, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, CURRENT_TIMESTAMP)
+			RETURNING ` + attachmentColumns
+
+	err := scanAttachment(r.db.QueryRowContext(ctx, query,
+		attachment.ChatRoomID,
+		attachment.UploaderID,
+		attachment.Filename,
+		attachment.ContentType,
+		attachment.Size,
+		attachment.StorageKey,
+		attachment.KeyVersion,
+	), attachment)
+	if err != nil {
+		return nil, err
+	}
+
+	return attachment, nil
+}
+
+// GetAttachmentByID получает файл по его ID
+func (r *repository) GetAttachmentByID(ctx context.Context, attachmentID string) (*models.Attachment, error) {
+	query := `SELECT ` + attachmentColumns + ` FROM attachments WHERE id = $1`
+
+	attachment := &models.Attachment{}
+	if err := scanAttachment(r.db.QueryRowContext(ctx, query, attachmentID), attachment); err != nil {
+		return nil, err
+	}
+
+	return attachment, nil
+}
+
+// LinkAttachments прикрепляет к сообщению файлы, загруженные тем же пользователем в тот же чат
+// и ещё не прикреплённые к другим сообщениям. Возвращает число прикреплённых файлов
+func (r *repository) LinkAttachments(ctx context.Context, message *models.Message, attachmentIDs []string) (int64, error) {
+	query := `UPDATE attachments SET message_id = $1
+			WHERE id = ANY($2) AND uploader_id = $3 AND chat_room_id = $4 AND message_id IS NULL`
+
+	res, err := r.db.ExecContext(ctx, query, message.ID, pq.Array(attachmentIDs), message.SenderID, message.ChatRoomID)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+// GetAttachmentsByMessageIDs получает файлы, прикреплённые к сообщениям, в порядке загрузки
+func (r *repository) GetAttachmentsByMessageIDs(ctx context.Context, messageIDs []string) ([]*models.Attachment, error) {
+	query := `SELECT ` + attachmentColumns + `
+			FROM attachments
+			WHERE message_id = ANY($1)
+			ORDER BY id`
+
+	rows, err := r.db.QueryContext(ctx, query, pq.Array(messageIDs))
+	if err != nil {
+		return nil, err
+	}
+
+	return scanAttachments(rows)
+}
+
+// GetAttachmentsForReencryption получает файлы чата, зашифрованные версией ключа ниже keyVersion,
+// с ID больше afterID в порядке возрастания ID
+func (r *repository) GetAttachmentsForReencryption(ctx context.Context, chatRoomID string, keyVersion int, afterID string, limit int) ([]*models.Attachment, error) {
+	query := `SELECT ` + attachmentColumns + `
+			FROM attachments
+			WHERE chat_room_id = $1 AND key_version < $2 AND id > $3
+			ORDER BY id
+			LIMIT $4`
+
+	rows, err := r.db.QueryContext(ctx, query, chatRoomID, keyVersion, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanAttachments(rows)
+}
+
+// UpdateAttachmentEncryption переключает файл на перешифрованную копию в хранилище, если файл
+// всё ещё указывает на oldStorageKey. Возвращает false, если файл уже изменился
+func (r *repository) UpdateAttachmentEncryption(ctx context.Context, attachment *models.Attachment, oldStorageKey string) (bool, error) {
+	query := `UPDATE attachments SET storage_key = $1, key_version = $2
+			WHERE id = $3 AND storage_key = $4`
+
+	res, err := r.db.ExecContext(ctx, query, attachment.StorageKey, attachment.KeyVersion, attachment.ID, oldStorageKey)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func scanAttachments(rows *sql.Rows) ([]*models.Attachment, error) {
+	defer rows.Close()
+
+	var attachments []*models.Attachment
+	for rows.Next() {
+		attachment := &models.Attachment{}
+		if err := scanAttachment(rows, attachment); err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, attachment)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return attachments, nil
+}
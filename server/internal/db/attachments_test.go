@@ -0,0 +1,161 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"chatgo/server/internal/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+var attachmentTestColumns = []string{"id", "chat_room_id", "uploader_id", "message_id", "filename", "content_type", "size", "storage_key", "key_version", "created_at"}
+
+func TestRepository_CreateAttachment(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+
+	attachment := &models.Attachment{
+		ChatRoomID:  "5",
+		UploaderID:  "1",
+		Filename:    "build.log",
+		ContentType: "text/plain; charset=utf-8",
+		Size:        42,
+		StorageKey:  "rooms/5/abc",
+		KeyVersion:  1,
+	}
+
+	mock.ExpectQuery("INSERT INTO attachments (.+) RETURNING").
+		WithArgs("5", "1", "build.log", "text/plain; charset=utf-8", int64(42), "rooms/5/abc", 1).
+		WillReturnRows(sqlmock.NewRows(attachmentTestColumns).
+			AddRow("7", "5", "1", nil, "build.log", "text/plain; charset=utf-8", 42, "rooms/5/abc", 1, time.Now()))
+
+	created, err := repo.CreateAttachment(context.Background(), attachment)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "7", created.ID)
+	assert.False(t, created.MessageID.Valid)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_GetAttachmentByID(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+
+	mock.ExpectQuery("SELECT (.+) FROM attachments WHERE id = \\$1").
+		WithArgs("7").
+		WillReturnRows(sqlmock.NewRows(attachmentTestColumns).
+			AddRow("7", "5", "1", "10", "cat.png", "image/png", 1024, "rooms/5/abc", 1, time.Now()))
+	mock.ExpectQuery("SELECT (.+) FROM attachments WHERE id = \\$1").
+		WithArgs("8").
+		WillReturnError(sql.ErrNoRows)
+
+	attachment, err := repo.GetAttachmentByID(context.Background(), "7")
+	assert.NoError(t, err)
+	assert.Equal(t, "10", attachment.MessageID.String)
+	assert.Equal(t, int64(1024), attachment.Size)
+
+	_, err = repo.GetAttachmentByID(context.Background(), "8")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_LinkAttachments(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+
+	mock.ExpectExec("UPDATE attachments SET message_id = \\$1 (.+) AND message_id IS NULL").
+		WithArgs("10", pq.Array([]string{"7", "8"}), "1", "5").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	n, err := repo.LinkAttachments(context.Background(), &models.Message{ID: "10", SenderID: "1", ChatRoomID: "5"}, []string{"7", "8"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_GetAttachmentsByMessageIDs(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+
+	mock.ExpectQuery("SELECT (.+) FROM attachments WHERE message_id = ANY\\(\\$1\\)").
+		WithArgs(pq.Array([]string{"10", "11"})).
+		WillReturnRows(sqlmock.NewRows(attachmentTestColumns).
+			AddRow("7", "5", "1", "10", "cat.png", "image/png", 1024, "rooms/5/abc", 1, time.Now()).
+			AddRow("8", "5", "1", "11", "notes.txt", "text/plain; charset=utf-8", 12, "rooms/5/def", 1, time.Now()))
+
+	attachments, err := repo.GetAttachmentsByMessageIDs(context.Background(), []string{"10", "11"})
+
+	assert.NoError(t, err)
+	assert.Len(t, attachments, 2)
+	assert.Equal(t, "11", attachments[1].MessageID.String)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_UpdateAttachmentEncryption(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+	attachment := &models.Attachment{ID: "7", StorageKey: "rooms/5/new", KeyVersion: 2}
+
+	mock.ExpectQuery("SELECT (.+) FROM attachments WHERE chat_room_id = \\$1 AND key_version < \\$2 AND id > \\$3").
+		WithArgs("5", 2, "0", 100).
+		WillReturnRows(sqlmock.NewRows(attachmentTestColumns).
+			AddRow("7", "5", "1", "10", "cat.png", "image/png", 1024, "rooms/5/abc", 1, time.Now()))
+	mock.ExpectExec("UPDATE attachments SET storage_key = \\$1, key_version = \\$2 WHERE id = \\$3 AND storage_key = \\$4").
+		WithArgs("rooms/5/new", 2, "7", "rooms/5/abc").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	attachments, err := repo.GetAttachmentsForReencryption(context.Background(), "5", 2, "0", 100)
+	assert.NoError(t, err)
+	assert.Len(t, attachments, 1)
+
+	updated, err := repo.UpdateAttachmentEncryption(context.Background(), attachment, attachments[0].StorageKey)
+	assert.NoError(t, err)
+	assert.True(t, updated)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,246 @@
+package db
+
+import (
+	"chatgo/server/internal/models"
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+const botColumns = `
+			b.user_id,
+			u.username,
+			b.owner_id,
+			b.created_at`
+
+const botTokenColumns = `
+			t.id,
+			t.bot_id,
+			t.name,
+			t.kind,
+			t.token_hash,
+			ARRAY(SELECT chat_room_id::text FROM bot_token_rooms WHERE token_id = t.id ORDER BY chat_room_id),
+			t.created_by,
+			t.created_at,
+			t.last_used_at,
+			t.revoked_at`
+
+func scanBot(row rowScanner, bot *models.Bot) error {
+	return row.Scan(
+		&bot.UserID,
+		&bot.Username,
+		&bot.OwnerID,
+		&bot.CreatedAt,
+	)
+}
+
+func scanBotToken(row rowScanner, token *models.BotToken) error {
+	return row.Scan(
+		&token.ID,
+		&token.BotID,
+		&token.Name,
+		&token.Kind,
+		&token.TokenHash,
+		pq.Array(&token.RoomIDs),
+		&token.CreatedBy,
+		&token.CreatedAt,
+		&token.LastUsedAt,
+		&token.RevokedAt,
+	)
+}
+
+// CreateBot в одной транзакции создаёт пользователя-бота и запоминает его владельца.
+// Пароля у бота нет, поэтому войти по паролю от его имени нельзя
+func (r *repository) CreateBot(ctx context.Context, user *models.User, ownerID string) (*models.Bot, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	bot := &models.Bot{Username: user.Username, OwnerID: ownerID}
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO users (username, encrypted_password, created_at, status, is_bot)
+		VALUES ($1, '', CURRENT_TIMESTAMP, $2, true)
+		RETURNING id`,
+		user.Username, user.Status).Scan(&bot.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO bots (user_id, owner_id, created_at)
+		VALUES ($1, $2, CURRENT_TIMESTAMP)
+		RETURNING created_at`,
+		bot.UserID, ownerID).Scan(&bot.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return bot, nil
+}
+
+// GetBotByUserID возвращает бота по ID его пользователя или nil, если это не бот
+func (r *repository) GetBotByUserID(ctx context.Context, userID string) (*models.Bot, error) {
+	var bot models.Bot
+	err := scanBot(r.db.QueryRowContext(ctx, `
+		SELECT`+botColumns+`
+		FROM bots b
+		JOIN users u ON u.id = b.user_id
+		WHERE b.user_id = $1`, userID), &bot)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &bot, nil
+}
+
+// GetBotsByOwnerID возвращает ботов пользователя в порядке создания
+func (r *repository) GetBotsByOwnerID(ctx context.Context, ownerID string) ([]*models.Bot, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT`+botColumns+`
+		FROM bots b
+		JOIN users u ON u.id = b.user_id
+		WHERE b.owner_id = $1
+		ORDER BY b.user_id`, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bots []*models.Bot
+	for rows.Next() {
+		var bot models.Bot
+		if err := scanBot(rows, &bot); err != nil {
+			return nil, err
+		}
+		bots = append(bots, &bot)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return bots, nil
+}
+
+// CreateBotToken в одной транзакции сохраняет токен, выдаёт ему доступ к чатам RoomIDs
+// и добавляет бота в участники этих чатов
+func (r *repository) CreateBotToken(ctx context.Context, token *models.BotToken) (*models.BotToken, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO bot_tokens (bot_id, name, kind, token_hash, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP)
+		RETURNING id, created_at`,
+		token.BotID, token.Name, token.Kind, token.TokenHash, token.CreatedBy).Scan(&token.ID, &token.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO bot_token_rooms (token_id, chat_room_id)
+		SELECT $1, unnest($2::bigint[])`,
+		token.ID, pq.Array(token.RoomIDs))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO chat_room_members (user_id, chat_room_id, joined_at, role)
+		SELECT $1, unnest($2::bigint[]), CURRENT_TIMESTAMP, 'member'
+		ON CONFLICT (user_id, chat_room_id) DO NOTHING`,
+		token.BotID, pq.Array(token.RoomIDs))
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// GetBotTokenByID возвращает токен по идентификатору или nil, если его нет
+func (r *repository) GetBotTokenByID(ctx context.Context, id string) (*models.BotToken, error) {
+	return r.getBotToken(ctx, "t.id = $1", id)
+}
+
+// GetBotTokenByHash возвращает токен по его хешу или nil, если такого токена нет
+func (r *repository) GetBotTokenByHash(ctx context.Context, tokenHash string) (*models.BotToken, error) {
+	return r.getBotToken(ctx, "t.token_hash = $1", tokenHash)
+}
+
+func (r *repository) getBotToken(ctx context.Context, where string, arg string) (*models.BotToken, error) {
+	var token models.BotToken
+	err := scanBotToken(r.db.QueryRowContext(ctx, `
+		SELECT`+botTokenColumns+`
+		FROM bot_tokens t
+		WHERE `+where, arg), &token)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// GetBotTokensByBotID возвращает все токены бота, включая отозванные, в порядке создания
+func (r *repository) GetBotTokensByBotID(ctx context.Context, botID string) ([]*models.BotToken, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT`+botTokenColumns+`
+		FROM bot_tokens t
+		WHERE t.bot_id = $1
+		ORDER BY t.id`, botID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []*models.BotToken
+	for rows.Next() {
+		var token models.BotToken
+		if err := scanBotToken(rows, &token); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, &token)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// RevokeBotToken отзывает токен. Возвращает false, если он уже отозван
+func (r *repository) RevokeBotToken(ctx context.Context, id string) (bool, error) {
+	res, err := r.db.ExecContext(ctx,
+		"UPDATE bot_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE id = $1 AND revoked_at IS NULL", id)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// TouchBotToken запоминает время последнего использования токена
+func (r *repository) TouchBotToken(ctx context.Context, id string) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE bot_tokens SET last_used_at = CURRENT_TIMESTAMP WHERE id = $1", id)
+	return err
+}
@@ -0,0 +1,159 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"chatgo/server/internal/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	botTestColumns      = []string{"user_id", "username", "owner_id", "created_at"}
+	botTokenTestColumns = []string{"id", "bot_id", "name", "kind", "token_hash", "room_ids", "created_by", "created_at", "last_used_at", "revoked_at"}
+)
+
+func TestRepository_CreateBot(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+	now := time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO users \\(username, encrypted_password, created_at, status, is_bot\\) VALUES \\(\\$1, '', CURRENT_TIMESTAMP, \\$2, true\\)").
+		WithArgs("ci-bot", models.UserStatus(models.Offline)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("8"))
+	mock.ExpectQuery("INSERT INTO bots (.+) RETURNING created_at").
+		WithArgs("8", "2").
+		WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(now))
+	mock.ExpectCommit()
+
+	bot, err := repo.CreateBot(context.Background(), &models.User{Username: "ci-bot", Status: models.UserStatus(models.Offline)}, "2")
+
+	assert.NoError(t, err)
+	assert.Equal(t, &models.Bot{UserID: "8", Username: "ci-bot", OwnerID: "2", CreatedAt: now}, bot)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_GetBotByUserID(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+
+	mock.ExpectQuery("SELECT (.+) FROM bots b JOIN users u ON u.id = b.user_id WHERE b.user_id = \\$1").
+		WithArgs("8").
+		WillReturnRows(sqlmock.NewRows(botTestColumns).AddRow("8", "ci-bot", "2", time.Now()))
+	mock.ExpectQuery("SELECT (.+) FROM bots b JOIN users u ON u.id = b.user_id WHERE b.user_id = \\$1").
+		WithArgs("2").
+		WillReturnError(sql.ErrNoRows)
+
+	bot, err := repo.GetBotByUserID(context.Background(), "8")
+	assert.NoError(t, err)
+	assert.Equal(t, "ci-bot", bot.Username)
+
+	bot, err = repo.GetBotByUserID(context.Background(), "2")
+	assert.NoError(t, err)
+	assert.Nil(t, bot)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_CreateBotToken(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+	token := &models.BotToken{BotID: "8", Name: "deploys", Kind: models.BotTokenAPI, TokenHash: "abc", RoomIDs: []string{"1", "3"}, CreatedBy: "2"}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO bot_tokens (.+) RETURNING id, created_at").
+		WithArgs("8", "deploys", models.BotTokenAPI, "abc", "2").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow("4", time.Now()))
+	mock.ExpectExec("INSERT INTO bot_token_rooms \\(token_id, chat_room_id\\) SELECT \\$1, unnest\\(\\$2::bigint\\[\\]\\)").
+		WithArgs("4", pq.Array([]string{"1", "3"})).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("INSERT INTO chat_room_members (.+) ON CONFLICT \\(user_id, chat_room_id\\) DO NOTHING").
+		WithArgs("8", pq.Array([]string{"1", "3"})).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	created, err := repo.CreateBotToken(context.Background(), token)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "4", created.ID)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_GetBotTokenByHash(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+	now := time.Now()
+
+	mock.ExpectQuery("SELECT (.+) FROM bot_tokens t WHERE t.token_hash = \\$1").
+		WithArgs("abc").
+		WillReturnRows(sqlmock.NewRows(botTokenTestColumns).
+			AddRow("4", "8", "deploys", models.BotTokenAPI, "abc", "{1,3}", "2", now, nil, now))
+	mock.ExpectQuery("SELECT (.+) FROM bot_tokens t WHERE t.token_hash = \\$1").
+		WithArgs("def").
+		WillReturnError(sql.ErrNoRows)
+
+	token, err := repo.GetBotTokenByHash(context.Background(), "abc")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1", "3"}, token.RoomIDs)
+	assert.True(t, token.RevokedAt.Valid)
+
+	token, err = repo.GetBotTokenByHash(context.Background(), "def")
+	assert.NoError(t, err)
+	assert.Nil(t, token)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_RevokeBotToken(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+
+	mock.ExpectExec("UPDATE bot_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE id = \\$1 AND revoked_at IS NULL").
+		WithArgs("4").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	revoked, err := repo.RevokeBotToken(context.Background(), "4")
+
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
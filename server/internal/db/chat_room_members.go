@@ -42,7 +42,8 @@ func (r *repository) AddMember(ctx context.Context, member *models.ChatRoomMembe
 // GetMembersByChatRoomID получает участников чата по ID чата
 func (r *repository) GetMembersByChatRoomID(ctx context.Context, chatRoomID string) ([]*models.ChatRoomMember, error) {
 	rows, err := r.db.QueryContext(ctx,
-		"SELECT user_id, chat_room_id, joined_at, role FROM chat_room_members WHERE chat_room_id = $1",
+		`SELECT user_id, chat_room_id, joined_at, role, last_read_message_id, last_read_at
+		FROM chat_room_members WHERE chat_room_id = $1`,
 		chatRoomID)
 	if err != nil {
 		return nil, err
@@ -52,7 +53,8 @@ func (r *repository) GetMembersByChatRoomID(ctx context.Context, chatRoomID stri
 	var members []*models.ChatRoomMember
 	for rows.Next() {
 		var member models.ChatRoomMember
-		if err := rows.Scan(&member.UserID, &member.ChatRoomID, &member.JoinedAt, &member.MemberRole); err != nil {
+		if err := rows.Scan(&member.UserID, &member.ChatRoomID, &member.JoinedAt, &member.MemberRole,
+			&member.LastReadMessageID, &member.LastReadAt); err != nil {
 			return nil, err
 		}
 		members = append(members, &member)
@@ -81,6 +83,26 @@ func (r *repository) UpdateMemberRole(ctx context.Context, member *models.ChatRo
 	return member, nil
 }
 
+// UpdateLastReadMessage передвигает отметку о прочтении участника вперёд до сообщения LastReadMessageID.
+// Отметка никогда не сдвигается назад, в этом случае возвращается false
+func (r *repository) UpdateLastReadMessage(ctx context.Context, member *models.ChatRoomMember) (bool, error) {
+	query := `UPDATE chat_room_members
+			SET last_read_message_id = $1, last_read_at = CURRENT_TIMESTAMP
+			WHERE user_id = $2 AND chat_room_id = $3
+				AND (last_read_message_id IS NULL OR last_read_message_id < $1)`
+
+	res, err := r.db.ExecContext(ctx, query, member.LastReadMessageID, member.UserID, member.ChatRoomID)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
 // RemoveMember удаляет участника чата по ID чата и ID пользователя
 func (r *repository) DeleteMember(ctx context.Context, member *models.ChatRoomMember) error {
 	_, err := r.db.ExecContext(ctx, "DELETE FROM chat_room_members WHERE user_id = $1 AND chat_room_id = $2", member.UserID, member.ChatRoomID)
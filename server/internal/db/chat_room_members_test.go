@@ -100,9 +100,9 @@ func TestRepository_GetMembersByChatRoomID(t *testing.T) {
 			chatRoomID: "1",
 			mockSetup: func(mock sqlmock.Sqlmock, chatRoomID string) {
 				now := time.Now()
-				rows := sqlmock.NewRows([]string{"user_id", "chat_room_id", "joined_at", "role"}).
-					AddRow("1", chatRoomID, now, "admin").
-					AddRow("2", chatRoomID, now, "member")
+				rows := sqlmock.NewRows([]string{"user_id", "chat_room_id", "joined_at", "role", "last_read_message_id", "last_read_at"}).
+					AddRow("1", chatRoomID, now, "admin", "10", now).
+					AddRow("2", chatRoomID, now, "member", nil, nil)
 
 				mock.ExpectQuery("SELECT (.+) FROM chat_room_members WHERE chat_room_id = \\$1").
 					WithArgs(chatRoomID).
@@ -114,7 +114,9 @@ func TestRepository_GetMembersByChatRoomID(t *testing.T) {
 				assert.NotNil(t, members)
 				assert.Len(t, members, 2)
 				assert.Equal(t, "1", members[0].UserID)
+				assert.Equal(t, "10", members[0].LastReadMessageID.String)
 				assert.Equal(t, "2", members[1].UserID)
+				assert.False(t, members[1].LastReadMessageID.Valid)
 			},
 		},
 		{
@@ -123,7 +125,7 @@ func TestRepository_GetMembersByChatRoomID(t *testing.T) {
 			mockSetup: func(mock sqlmock.Sqlmock, chatRoomID string) {
 				mock.ExpectQuery("SELECT (.+) FROM chat_room_members WHERE chat_room_id = \\$1").
 					WithArgs(chatRoomID).
-					WillReturnRows(sqlmock.NewRows([]string{"user_id", "chat_room_id", "joined_at", "role"}))
+					WillReturnRows(sqlmock.NewRows([]string{"user_id", "chat_room_id", "joined_at", "role", "last_read_message_id", "last_read_at"}))
 			},
 			expectError: false,
 			checkResult: func(t *testing.T, members []*models.ChatRoomMember, err error) {
@@ -292,3 +294,52 @@ func TestRepository_DeleteMember(t *testing.T) {
 		})
 	}
 }
+
+func TestRepository_UpdateLastReadMessage(t *testing.T) {
+	testCases := []struct {
+		name            string
+		rowsAffected    int64
+		expectedChanged bool
+	}{
+		{
+			name:            "Marker moves forward",
+			rowsAffected:    1,
+			expectedChanged: true,
+		},
+		{
+			name:            "Marker is not moved back",
+			rowsAffected:    0,
+			expectedChanged: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := MockDB(t)
+			if err != nil {
+				t.Fatalf("Error creating mock DB: %v", err)
+			}
+			defer db.Close()
+
+			repo := &repository{db: db}
+			member := &models.ChatRoomMember{
+				UserID:            "1",
+				ChatRoomID:        "2",
+				LastReadMessageID: sql.NullString{String: "15", Valid: true},
+			}
+
+			mock.ExpectExec("UPDATE chat_room_members SET last_read_message_id = \\$1, last_read_at = CURRENT_TIMESTAMP").
+				WithArgs(member.LastReadMessageID, member.UserID, member.ChatRoomID).
+				WillReturnResult(sqlmock.NewResult(0, tc.rowsAffected))
+
+			changed, err := repo.UpdateLastReadMessage(context.Background(), member)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedChanged, changed)
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
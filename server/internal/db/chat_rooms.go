@@ -15,23 +15,42 @@ func (r *repository) CreateChatRoom(ctx context.Context, chatRoom *models.ChatRo
 	}
 	defer tx.Rollback()
 
-	query := `INSERT INTO chat_rooms (name, type, creator_id, created_at) 
-        	VALUES ($1, $2, $3, CURRENT_TIMESTAMP) 
-			RETURNING id, name, type, creator_id, created_at`
+	if err := insertChatRoom(ctx, tx, chatRoom); err != nil {
+		return nil, err
+	}
 
-	err = tx.QueryRowContext(ctx, query,
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return chatRoom, nil
+}
+
+// insertChatRoom добавляет чат и его создателя как админа в транзакции tx
+func insertChatRoom(ctx context.Context, tx *sql.Tx, chatRoom *models.ChatRoom) error {
+	query := `INSERT INTO chat_rooms (name, type, creator_id, created_at, e2e, message_ttl, topic) 
+        	VALUES ($1, $2, $3, CURRENT_TIMESTAMP, $4, $5, $6) 
+			RETURNING id, name, type, creator_id, created_at, e2e, message_ttl, topic`
+
+	err := tx.QueryRowContext(ctx, query,
 		chatRoom.Name,
 		chatRoom.Type,
 		chatRoom.CreatorID,
+		chatRoom.E2E,
+		chatRoom.MessageTTL,
+		chatRoom.Topic,
 	).Scan(
 		&chatRoom.ID,
 		&chatRoom.Name,
 		&chatRoom.Type,
 		&chatRoom.CreatorID,
 		&chatRoom.CreatedAt,
+		&chatRoom.E2E,
+		&chatRoom.MessageTTL,
+		&chatRoom.Topic,
 	)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	// Добавление админа в таблицу chat_room_members
@@ -55,21 +74,13 @@ func (r *repository) CreateChatRoom(ctx context.Context, chatRoom *models.ChatRo
 		&member.MemberRole,
 		&member.JoinedAt,
 	)
-	if err != nil {
-		return nil, err
-	}
-
-	if err = tx.Commit(); err != nil {
-		return nil, err
-	}
-
-	return chatRoom, nil
+	return err
 }
 
 // GetChatRoomByID возвращает чат по ID чата
 func (r *repository) GetChatRoomByID(ctx context.Context, chatRoomID string) (*models.ChatRoom, error) {
 	var chatRoom models.ChatRoom
-	query := `SELECT id, name, type, creator_id, created_at 
+	query := `SELECT id, name, type, creator_id, created_at, e2e, message_ttl, topic 
 			FROM chat_rooms WHERE id = $1`
 
 	err := r.db.QueryRowContext(ctx, query, chatRoomID).Scan(
@@ -78,6 +89,9 @@ func (r *repository) GetChatRoomByID(ctx context.Context, chatRoomID string) (*m
 		&chatRoom.Type,
 		&chatRoom.CreatorID,
 		&chatRoom.CreatedAt,
+		&chatRoom.E2E,
+		&chatRoom.MessageTTL,
+		&chatRoom.Topic,
 	)
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -91,7 +105,7 @@ func (r *repository) GetChatRoomByID(ctx context.Context, chatRoomID string) (*m
 
 // GetChatRoomsByUserID возвращает все чаты по ID участника
 func (r *repository) GetChatRoomsByUserID(ctx context.Context, userID string) ([]*models.ChatRoom, error) {
-	query := `SELECT cr.id, cr.name, cr.type, cr.creator_id, cr.created_at,
+	query := `SELECT cr.id, cr.name, cr.type, cr.creator_id, cr.created_at, cr.e2e, cr.message_ttl, cr.topic
 			FROM chat_rooms cr
 			JOIN chat_room_members crm ON cr.id = crm.chat_room_id
 			WHERE crm.user_id = $1`
@@ -112,6 +126,9 @@ func (r *repository) GetChatRoomsByUserID(ctx context.Context, userID string) ([
 			&chatRoom.Type,
 			&chatRoom.CreatorID,
 			&chatRoom.CreatedAt,
+			&chatRoom.E2E,
+			&chatRoom.MessageTTL,
+			&chatRoom.Topic,
 		)
 		if err != nil {
 			return nil, err
@@ -125,7 +142,7 @@ func (r *repository) GetChatRoomsByUserID(ctx context.Context, userID string) ([
 
 // GetAllChatRooms возвращает все чаты
 func (r *repository) GetAllChatRooms(ctx context.Context) ([]*models.ChatRoom, error) {
-	rows, err := r.db.QueryContext(ctx, "SELECT id, name, type, created_at, creator_id FROM chat_rooms")
+	rows, err := r.db.QueryContext(ctx, "SELECT id, name, type, created_at, creator_id, e2e, message_ttl, topic FROM chat_rooms")
 	if err != nil {
 		return nil, err
 	}
@@ -135,7 +152,7 @@ func (r *repository) GetAllChatRooms(ctx context.Context) ([]*models.ChatRoom, e
 	for rows.Next() {
 		var chatRoom models.ChatRoom
 		if err := rows.Scan(&chatRoom.ID, &chatRoom.Name, &chatRoom.Type,
-			&chatRoom.CreatedAt, &chatRoom.CreatorID); err != nil {
+			&chatRoom.CreatedAt, &chatRoom.CreatorID, &chatRoom.E2E, &chatRoom.MessageTTL, &chatRoom.Topic); err != nil {
 			return nil, err
 		}
 		chatRooms = append(chatRooms, &chatRoom)
@@ -148,7 +165,7 @@ func (r *repository) UpdateChatRoom(ctx context.Context, chatRoom *models.ChatRo
 	query := `UPDATE chat_rooms 
 			SET name = $1, type = $2 
 			WHERE id = $3 
-			RETURNING id, name, type, creator_id, created_at`
+			RETURNING id, name, type, creator_id, created_at, e2e, message_ttl, topic`
 
 	err := r.db.QueryRowContext(ctx, query,
 		chatRoom.Name,
@@ -160,6 +177,9 @@ func (r *repository) UpdateChatRoom(ctx context.Context, chatRoom *models.ChatRo
 		&chatRoom.Type,
 		&chatRoom.CreatorID,
 		&chatRoom.CreatedAt,
+		&chatRoom.E2E,
+		&chatRoom.MessageTTL,
+		&chatRoom.Topic,
 	)
 	if err != nil {
 		return nil, err
@@ -168,6 +188,12 @@ func (r *repository) UpdateChatRoom(ctx context.Context, chatRoom *models.ChatRo
 	return chatRoom, nil
 }
 
+// SetMessageTTL задаёт время жизни новых сообщений чата в секундах, 0 отключает исчезающие сообщения
+func (r *repository) SetMessageTTL(ctx context.Context, chatRoomID string, ttl int) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE chat_rooms SET message_ttl = $1 WHERE id = $2", ttl, chatRoomID)
+	return err
+}
+
 // DeleteChatRoom удаляет чат по ID чата, а также удаляет все записи
 // в таблице chat_room_members для этого чата, используя метод [RemoveMembersByChatRoomID]
 func (r *repository) DeleteChatRoom(ctx context.Context, chatRoom *models.ChatRoom) error {
@@ -191,3 +217,9 @@ func (r *repository) DeleteChatRoom(ctx context.Context, chatRoom *models.ChatRo
 
 	return tx.Commit()
 }
+
+// SetTopic задаёт тему чата, пустая строка удаляет её
+func (r *repository) SetTopic(ctx context.Context, chatRoomID, topic string) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE chat_rooms SET topic = $1 WHERE id = $2", topic, chatRoomID)
+	return err
+}
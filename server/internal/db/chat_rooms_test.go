@@ -28,11 +28,11 @@ func TestRepository_CreateChatRoom(t *testing.T) {
 
 	mock.ExpectBegin()
 
-	roomRows := sqlmock.NewRows([]string{"id", "name", "type", "creator_id", "created_at"}).
-		AddRow("1", "Test Room", "group", "1", time.Now())
+	roomRows := sqlmock.NewRows([]string{"id", "name", "type", "creator_id", "created_at", "e2e", "message_ttl", "topic"}).
+		AddRow("1", "Test Room", "group", "1", time.Now(), false, 0, "")
 
 	mock.ExpectQuery("INSERT INTO chat_rooms").
-		WithArgs(chatRoom.Name, chatRoom.Type, chatRoom.CreatorID).
+		WithArgs(chatRoom.Name, chatRoom.Type, chatRoom.CreatorID, chatRoom.E2E, chatRoom.MessageTTL, chatRoom.Topic).
 		WillReturnRows(roomRows)
 
 	memberRows := sqlmock.NewRows([]string{"user_id", "chat_room_id", "member_role", "joined_at"}).
@@ -66,8 +66,8 @@ func TestRepository_GetChatRoomByID(t *testing.T) {
 
 	repo := &repository{db: db}
 
-	rows := sqlmock.NewRows([]string{"id", "name", "type", "creator_id", "created_at"}).
-		AddRow("1", "Test Room", "group", "1", time.Now())
+	rows := sqlmock.NewRows([]string{"id", "name", "type", "creator_id", "created_at", "e2e", "message_ttl", "topic"}).
+		AddRow("1", "Test Room", "group", "1", time.Now(), true, 3600, "Release planning")
 
 	mock.ExpectQuery("SELECT (.+) FROM chat_rooms WHERE id = \\$1").
 		WithArgs("1").
@@ -80,12 +80,57 @@ func TestRepository_GetChatRoomByID(t *testing.T) {
 	assert.NotNil(t, room)
 	assert.Equal(t, "1", room.ID)
 	assert.Equal(t, "Test Room", room.Name)
+	assert.True(t, room.E2E)
+	assert.Equal(t, 3600, room.MessageTTL)
+	assert.Equal(t, "Release planning", room.Topic)
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("Unfulfilled expectations: %s", err)
 	}
 }
 
+func TestRepository_SetMessageTTL(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+
+	mock.ExpectExec("UPDATE chat_rooms SET message_ttl = \\$1 WHERE id = \\$2").
+		WithArgs(300, "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err = repo.SetMessageTTL(context.Background(), "1", 300)
+
+	assert.NoError(t, err)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_SetTopic(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+
+	mock.ExpectExec("UPDATE chat_rooms SET topic = \\$1 WHERE id = \\$2").
+		WithArgs("Release planning", "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err = repo.SetTopic(context.Background(), "1", "Release planning")
+
+	assert.NoError(t, err)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
 func TestRepository_UpdateChatRoom(t *testing.T) {
 	db, mock, err := MockDB(t)
 	if err != nil {
@@ -102,8 +147,8 @@ func TestRepository_UpdateChatRoom(t *testing.T) {
 		CreatorID: "1",
 	}
 
-	rows := sqlmock.NewRows([]string{"id", "name", "type", "creator_id", "created_at"}).
-		AddRow("1", "Updated Room", "group", "1", time.Now())
+	rows := sqlmock.NewRows([]string{"id", "name", "type", "creator_id", "created_at", "e2e", "message_ttl", "topic"}).
+		AddRow("1", "Updated Room", "group", "1", time.Now(), false, 0, "")
 
 	mock.ExpectQuery("UPDATE chat_rooms SET name = \\$1, type = \\$2 WHERE id = \\$3").
 		WithArgs(chatRoom.Name, chatRoom.Type, chatRoom.ID).
@@ -28,8 +28,10 @@ func NewDatabase(config *Config) (*Database, error) {
 	retryDelay := 5 * time.Second
 
 	for i := 0; i < maxRetries; i++ {
+		// Столбцы TIMESTAMP хранят время без часового пояса в UTC: сервис передаёт время в UTC,
+		// а сессия в UTC даёт то же время для CURRENT_TIMESTAMP и NOW()
 		dsn := fmt.Sprintf(
-			"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+			"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s timezone=UTC",
 			config.Host, config.Port, config.User, config.Password, config.DBName, config.SSLMode,
 		)
 
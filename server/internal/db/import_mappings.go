@@ -0,0 +1,161 @@
+package db
+
+import (
+	"chatgo/server/internal/models"
+	"context"
+	"database/sql"
+)
+
+// GetImportMapping возвращает локальный ID объекта, импортированного из source, или пустую строку,
+// если объект ещё не импортирован
+func (r *repository) GetImportMapping(ctx context.Context, source, kind, externalID string) (string, error) {
+	query := `
+		SELECT local_id
+		FROM import_mappings
+		WHERE source = $1 AND kind = $2 AND external_id = $3`
+
+	var localID string
+	err := r.db.QueryRowContext(ctx, query, source, kind, externalID).Scan(&localID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return localID, nil
+}
+
+// ImportUser создаёт пользователя и в той же транзакции сохраняет связь mapping с его ID.
+// Возвращает false и ничего не создаёт, если пользователь уже импортирован
+func (r *repository) ImportUser(ctx context.Context, user *models.User, mapping *models.ImportMapping) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if err := insertUser(ctx, tx, user); err != nil {
+		return false, err
+	}
+	inserted, err := insertImportMapping(ctx, tx, mapping, user.ID)
+	if err != nil || !inserted {
+		return false, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// ImportChatRoom создаёт чат с создателем в роли админа и в той же транзакции сохраняет связь
+// mapping с его ID, так что прерванный импорт не создаёт чат повторно. Возвращает false и
+// ничего не создаёт, если чат уже импортирован
+func (r *repository) ImportChatRoom(ctx context.Context, chatRoom *models.ChatRoom, mapping *models.ImportMapping) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if err := insertChatRoom(ctx, tx, chatRoom); err != nil {
+		return false, err
+	}
+	inserted, err := insertImportMapping(ctx, tx, mapping, chatRoom.ID)
+	if err != nil || !inserted {
+		return false, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// ImportMessage добавляет сообщение с исходными created_at и updated_at и в той же транзакции
+// сохраняет связь mapping с ID нового сообщения. Для ответа в ветке обновляет reply_count и
+// last_reply_at корневого сообщения. Возвращает false и ничего не добавляет, если сообщение
+// уже импортировано
+func (r *repository) ImportMessage(ctx context.Context, message *models.Message, mapping *models.ImportMapping) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO messages (
+			sender_id,
+			chat_room_id,
+			encrypted_content,
+			parent_id,
+			key_version,
+			created_at,
+			updated_at,
+			is_edited
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING` + messageColumns
+
+	err = scanMessage(tx.QueryRowContext(
+		ctx,
+		query,
+		message.SenderID,
+		message.ChatRoomID,
+		message.EncryptedContent,
+		message.ParentID,
+		message.KeyVersion,
+		message.CreatedAt,
+		message.UpdatedAt,
+		message.IsEdited,
+	), message)
+	if err != nil {
+		return false, err
+	}
+
+	inserted, err := insertImportMapping(ctx, tx, mapping, message.ID)
+	if err != nil || !inserted {
+		// Если связь уже есть, сообщение импортировано параллельным запуском, откатываем вставку
+		return false, err
+	}
+
+	if message.ParentID.Valid {
+		_, err = tx.ExecContext(ctx,
+			"UPDATE messages SET reply_count = reply_count + 1, last_reply_at = GREATEST(last_reply_at, $1) WHERE id = $2",
+			message.CreatedAt, message.ParentID.String)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// insertImportMapping сохраняет связь mapping с localID внутри транзакции импорта. Возвращает false,
+// если объект уже импортирован параллельным запуском, тогда транзакцию нужно откатить
+func insertImportMapping(ctx context.Context, tx *sql.Tx, mapping *models.ImportMapping, localID string) (bool, error) {
+	query := `
+		INSERT INTO import_mappings (source, kind, external_id, local_id, created_at)
+		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)
+		ON CONFLICT (source, kind, external_id) DO NOTHING`
+
+	res, err := tx.ExecContext(ctx, query, mapping.Source, mapping.Kind, mapping.ExternalID, localID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if n == 0 {
+		return false, nil
+	}
+	mapping.LocalID = localID
+	return true, nil
+}
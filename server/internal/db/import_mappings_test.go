@@ -0,0 +1,204 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"chatgo/server/internal/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository_GetImportMapping(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+
+	mock.ExpectQuery("SELECT local_id FROM import_mappings WHERE source = \\$1 AND kind = \\$2 AND external_id = \\$3").
+		WithArgs("slack", "user", "U1").
+		WillReturnRows(sqlmock.NewRows([]string{"local_id"}).AddRow("7"))
+	mock.ExpectQuery("SELECT local_id FROM import_mappings").
+		WithArgs("slack", "user", "U2").
+		WillReturnError(sql.ErrNoRows)
+
+	localID, err := repo.GetImportMapping(context.Background(), "slack", "user", "U1")
+	assert.NoError(t, err)
+	assert.Equal(t, "7", localID)
+
+	localID, err = repo.GetImportMapping(context.Background(), "slack", "user", "U2")
+	assert.NoError(t, err)
+	assert.Empty(t, localID)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_ImportUser(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO users").
+		WithArgs("alice.slack", "hash", models.UserStatus("offline")).
+		WillReturnRows(sqlmock.NewRows(userTestColumns).
+			AddRow("5", "alice.slack", "hash", time.Now(), time.Now(), nil, "offline", false, nil, 0, nil, 0, "", "", nil, "", ""))
+	mock.ExpectExec("INSERT INTO import_mappings (.+) ON CONFLICT \\(source, kind, external_id\\) DO NOTHING").
+		WithArgs("slack", "user", "U1", "5").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	user := &models.User{Username: "alice.slack", EncryptedPassword: "hash", Status: models.UserStatus("offline")}
+	mapping := &models.ImportMapping{Source: "slack", Kind: "user", ExternalID: "U1"}
+	imported, err := repo.ImportUser(context.Background(), user, mapping)
+
+	assert.NoError(t, err)
+	assert.True(t, imported)
+	assert.Equal(t, "5", user.ID)
+	assert.Equal(t, "5", mapping.LocalID)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_ImportChatRoom(t *testing.T) {
+	testCases := []struct {
+		name     string
+		mapped   int64
+		imported bool
+	}{
+		{name: "New room", mapped: 1, imported: true},
+		// A parallel run mapped the room first, the room and its admin are rolled back
+		{name: "Already imported", mapped: 0, imported: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := MockDB(t)
+			if err != nil {
+				t.Fatalf("Error creating mock DB: %v", err)
+			}
+			defer db.Close()
+
+			repo := &repository{db: db}
+
+			mock.ExpectBegin()
+			mock.ExpectQuery("INSERT INTO chat_rooms").
+				WithArgs("dev", models.Group, "1", false, 0, "").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "name", "type", "creator_id", "created_at", "e2e", "message_ttl", "topic"}).
+					AddRow("3", "dev", "group", "1", time.Now(), false, 0, ""))
+			mock.ExpectQuery("INSERT INTO chat_room_members").
+				WithArgs("1", "3", models.Admin).
+				WillReturnRows(sqlmock.NewRows([]string{"user_id", "chat_room_id", "role", "joined_at"}).
+					AddRow("1", "3", "admin", time.Now()))
+			mock.ExpectExec("INSERT INTO import_mappings").
+				WithArgs("slack", "room", "C1", "3").
+				WillReturnResult(sqlmock.NewResult(0, tc.mapped))
+			if tc.imported {
+				mock.ExpectCommit()
+			} else {
+				mock.ExpectRollback()
+			}
+
+			room := &models.ChatRoom{Name: "dev", Type: models.Group, CreatorID: "1"}
+			mapping := &models.ImportMapping{Source: "slack", Kind: "room", ExternalID: "C1"}
+			imported, err := repo.ImportChatRoom(context.Background(), room, mapping)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.imported, imported)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestRepository_ImportMessage(t *testing.T) {
+	createdAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	parentID := sql.NullString{String: "10", Valid: true}
+
+	testCases := []struct {
+		name      string
+		mockSetup func(mock sqlmock.Sqlmock)
+		imported  bool
+	}{
+		{
+			name: "New reply",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery("INSERT INTO messages").
+					WithArgs("1", "2", "encrypted", parentID, 1, createdAt, createdAt, false).
+					WillReturnRows(sqlmock.NewRows(messageTestColumns).
+						AddRow("11", "1", "2", "encrypted", "10", 0, nil, createdAt, createdAt, false, 1, nil))
+				mock.ExpectExec("INSERT INTO import_mappings").
+					WithArgs("slack", "message", "C1/1704110400.000100", "11").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("UPDATE messages SET reply_count = reply_count \\+ 1, last_reply_at = GREATEST\\(last_reply_at, \\$1\\) WHERE id = \\$2").
+					WithArgs(createdAt, "10").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			imported: true,
+		},
+		{
+			name: "Already imported",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery("INSERT INTO messages").
+					WillReturnRows(sqlmock.NewRows(messageTestColumns).
+						AddRow("12", "1", "2", "encrypted", "10", 0, nil, createdAt, createdAt, false, 1, nil))
+				mock.ExpectExec("INSERT INTO import_mappings").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+			},
+			imported: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := MockDB(t)
+			if err != nil {
+				t.Fatalf("Error creating mock DB: %v", err)
+			}
+			defer db.Close()
+
+			repo := &repository{db: db}
+			tc.mockSetup(mock)
+
+			message := &models.Message{
+				SenderID:         "1",
+				ChatRoomID:       "2",
+				EncryptedContent: "encrypted",
+				ParentID:         parentID,
+				KeyVersion:       1,
+				CreatedAt:        createdAt,
+				UpdatedAt:        createdAt,
+			}
+			mapping := &models.ImportMapping{Source: "slack", Kind: "message", ExternalID: "C1/1704110400.000100"}
+
+			imported, err := repo.ImportMessage(context.Background(), message, mapping)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.imported, imported)
+			if tc.imported {
+				assert.Equal(t, "11", mapping.LocalID)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
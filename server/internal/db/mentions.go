@@ -0,0 +1,83 @@
+package db
+
+import (
+	"chatgo/server/internal/models"
+	"context"
+
+	"github.com/lib/pq"
+)
+
+// CreateMentions добавляет упоминания пользователей в одной транзакции.
+// Повторное упоминание пользователя в том же сообщении игнорируется
+func (r *repository) CreateMentions(ctx context.Context, mentions []*models.Mention) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO mentions (message_id, user_id, chat_room_id, is_read, created_at)
+			VALUES ($1, $2, $3, false, CURRENT_TIMESTAMP)
+			ON CONFLICT (message_id, user_id) DO NOTHING`
+
+	for _, mention := range mentions {
+		_, err := tx.ExecContext(ctx, query, mention.MessageID, mention.UserID, mention.ChatRoomID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetMentionsByUserID получает упоминания пользователя во всех чатах, начиная с самых новых.
+// Если unreadOnly установлен, возвращаются только непрочитанные упоминания
+func (r *repository) GetMentionsByUserID(ctx context.Context, userID string, unreadOnly bool, limit int) ([]*models.Mention, error) {
+	query := `SELECT id, message_id, user_id, chat_room_id, is_read, created_at
+			FROM mentions
+			WHERE user_id = $1 AND (NOT $2 OR NOT is_read)
+			ORDER BY created_at DESC
+			LIMIT $3`
+
+	rows, err := r.db.QueryContext(ctx, query, userID, unreadOnly, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var mentions []*models.Mention
+	for rows.Next() {
+		var mention models.Mention
+		if err := rows.Scan(
+			&mention.ID,
+			&mention.MessageID,
+			&mention.UserID,
+			&mention.ChatRoomID,
+			&mention.IsRead,
+			&mention.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		mentions = append(mentions, &mention)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return mentions, nil
+}
+
+// MarkMentionsRead отмечает упоминания пользователя прочитанными.
+// Если список ID пуст, отмечаются все упоминания пользователя
+func (r *repository) MarkMentionsRead(ctx context.Context, userID string, mentionIDs []string) error {
+	if len(mentionIDs) == 0 {
+		_, err := r.db.ExecContext(ctx, "UPDATE mentions SET is_read = true WHERE user_id = $1 AND NOT is_read", userID)
+		return err
+	}
+
+	_, err := r.db.ExecContext(ctx,
+		"UPDATE mentions SET is_read = true WHERE user_id = $1 AND id = ANY($2)",
+		userID, pq.Array(mentionIDs))
+	return err
+}
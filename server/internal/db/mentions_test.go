@@ -0,0 +1,128 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"chatgo/server/internal/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository_CreateMentions(t *testing.T) {
+	mentions := []*models.Mention{
+		{MessageID: "10", UserID: "1", ChatRoomID: "5"},
+		{MessageID: "10", UserID: "2", ChatRoomID: "5"},
+	}
+
+	testCases := []struct {
+		name        string
+		mockSetup   func(mock sqlmock.Sqlmock)
+		expectError bool
+	}{
+		{
+			name: "Successfully create mentions",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				for _, mention := range mentions {
+					mock.ExpectExec("INSERT INTO mentions (.+) ON CONFLICT").
+						WithArgs(mention.MessageID, mention.UserID, mention.ChatRoomID).
+						WillReturnResult(sqlmock.NewResult(0, 1))
+				}
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "Rollback on error",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec("INSERT INTO mentions").
+					WithArgs("10", "1", "5").
+					WillReturnError(sql.ErrConnDone)
+				mock.ExpectRollback()
+			},
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := MockDB(t)
+			if err != nil {
+				t.Fatalf("Error creating mock DB: %v", err)
+			}
+			defer db.Close()
+
+			repo := &repository{db: db}
+			tc.mockSetup(mock)
+
+			err = repo.CreateMentions(context.Background(), mentions)
+
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestRepository_GetMentionsByUserID(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+
+	rows := sqlmock.NewRows([]string{"id", "message_id", "user_id", "chat_room_id", "is_read", "created_at"}).
+		AddRow("1", "10", "2", "5", false, time.Now())
+
+	mock.ExpectQuery("SELECT (.+) FROM mentions WHERE user_id = \\$1 AND \\(NOT \\$2 OR NOT is_read\\)").
+		WithArgs("2", true, 20).
+		WillReturnRows(rows)
+
+	mentions, err := repo.GetMentionsByUserID(context.Background(), "2", true, 20)
+
+	assert.NoError(t, err)
+	assert.Len(t, mentions, 1)
+	assert.Equal(t, "10", mentions[0].MessageID)
+	assert.False(t, mentions[0].IsRead)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_MarkMentionsRead(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+
+	mock.ExpectExec("UPDATE mentions SET is_read = true WHERE user_id = \\$1 AND id = ANY\\(\\$2\\)").
+		WithArgs("2", pq.Array([]string{"1", "3"})).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("UPDATE mentions SET is_read = true WHERE user_id = \\$1 AND NOT is_read").
+		WithArgs("2").
+		WillReturnResult(sqlmock.NewResult(0, 5))
+
+	assert.NoError(t, repo.MarkMentionsRead(context.Background(), "2", []string{"1", "3"}))
+	assert.NoError(t, repo.MarkMentionsRead(context.Background(), "2", nil))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
@@ -3,57 +3,137 @@ package db
 import (
 	"chatgo/server/internal/models"
 	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
 )
 
-// CreateMessage добавляет новое сообщение в базу данных, устанавливает created_at и updated_at CURRENT_TIMESTAMP
-func (r *repository) CreateMessage(ctx context.Context, message *models.Message) (*models.Message, error) {
-	query := `
-		INSERT INTO messages (
-			sender_id, 
-			chat_room_id, 
+// messageColumns содержит список столбцов, которые возвращают все запросы к таблице messages
+const messageColumns = `
+			id,
+			sender_id,
+			chat_room_id,
 			encrypted_content,
+			parent_id,
+			reply_count,
+			last_reply_at,
 			created_at,
 			updated_at,
-			is_edited
-		) VALUES ($1, $2, $3, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, false)
-		RETURNING id, sender_id, chat_room_id, encrypted_content, created_at, updated_at, is_edited`
+			is_edited,
+			key_version,
+			expires_at`
 
-	err := r.db.QueryRowContext(
-		ctx,
-		query,
-		message.SenderID,
-		message.ChatRoomID,
-		message.EncryptedContent,
-	).Scan(
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanMessage считывает строку с набором столбцов messageColumns в сообщение
+func scanMessage(row rowScanner, message *models.Message) error {
+	return row.Scan(
 		&message.ID,
 		&message.SenderID,
 		&message.ChatRoomID,
 		&message.EncryptedContent,
+		&message.ParentID,
+		&message.ReplyCount,
+		&message.LastReplyAt,
 		&message.CreatedAt,
 		&message.UpdatedAt,
 		&message.IsEdited,
+		&message.KeyVersion,
+		&message.ExpiresAt,
 	)
+}
+
+// scanMessages считывает все строки с набором столбцов messageColumns
+func scanMessages(rows *sql.Rows) ([]*models.Message, error) {
+	defer rows.Close()
+
+	var messages []*models.Message
+	for rows.Next() {
+		message := &models.Message{}
+		if err := scanMessage(rows, message); err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
+	return messages, nil
+}
+
+// CreateMessage добавляет новое сообщение в базу данных, устанавливает created_at и updated_at CURRENT_TIMESTAMP.
+// Если сообщение является ответом в ветке, в той же транзакции обновляет reply_count и last_reply_at корневого сообщения
+func (r *repository) CreateMessage(ctx context.Context, message *models.Message) (*models.Message, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, err
 	}
+	defer tx.Rollback()
+
+	if err = insertMessage(ctx, tx, message); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
 
 	return message, nil
 }
 
-// GetMessagesByChatRoomID получает сообщения по ID чата, используя лимит для ограничения числа возвращаемых сообщений
-func (r *repository) GetMessagesByChatRoomID(ctx context.Context, chatRoomID string, limit int) ([]*models.Message, error) {
+// insertMessage добавляет сообщение и обновляет счётчик ответов корневого сообщения, если это ответ в ветке
+func insertMessage(ctx context.Context, db queryer, message *models.Message) error {
 	query := `
-		SELECT 
-			id,
+		INSERT INTO messages (
 			sender_id,
 			chat_room_id,
 			encrypted_content,
+			parent_id,
+			key_version,
 			created_at,
 			updated_at,
-			is_edited 
-		FROM messages 
-		WHERE chat_room_id = $1
+			is_edited,
+			expires_at
+		) VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, false, $6)
+		RETURNING` + messageColumns
+
+	err := scanMessage(db.QueryRowContext(
+		ctx,
+		query,
+		message.SenderID,
+		message.ChatRoomID,
+		message.EncryptedContent,
+		message.ParentID,
+		message.KeyVersion,
+		message.ExpiresAt,
+	), message)
+	if err != nil {
+		return err
+	}
+
+	if message.ParentID.Valid {
+		_, err = db.ExecContext(ctx,
+			"UPDATE messages SET reply_count = reply_count + 1, last_reply_at = $1 WHERE id = $2",
+			message.CreatedAt, message.ParentID.String)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetMessagesByChatRoomID получает сообщения основной ленты чата (без ответов в ветках),
+// используя лимит для ограничения числа возвращаемых сообщений
+func (r *repository) GetMessagesByChatRoomID(ctx context.Context, chatRoomID string, limit int) ([]*models.Message, error) {
+	query := `
+		SELECT` + messageColumns + `
+		FROM messages
+		WHERE chat_room_id = $1 AND parent_id IS NULL
 		ORDER BY created_at ASC
 		LIMIT $2`
 
@@ -61,60 +141,238 @@ func (r *repository) GetMessagesByChatRoomID(ctx context.Context, chatRoomID str
 	if err != nil {
 		return nil, err
 	}
+
+	return scanMessages(rows)
+}
+
+// GetThreadMessages получает ответы в ветке сообщения parentID в хронологическом порядке
+func (r *repository) GetThreadMessages(ctx context.Context, parentID string, limit int) ([]*models.Message, error) {
+	query := `
+		SELECT` + messageColumns + `
+		FROM messages
+		WHERE parent_id = $1
+		ORDER BY created_at ASC
+		LIMIT $2`
+
+	rows, err := r.db.QueryContext(ctx, query, parentID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanMessages(rows)
+}
+
+// GetMessageByID получает сообщение по ID сообщения
+func (r *repository) GetMessageByID(ctx context.Context, messageID string) (*models.Message, error) {
+	query := `
+		SELECT` + messageColumns + `
+		FROM messages
+		WHERE id = $1`
+
+	message := &models.Message{}
+	err := scanMessage(r.db.QueryRowContext(ctx, query, messageID), message)
+	if err != nil {
+		return nil, err
+	}
+
+	return message, nil
+}
+
+// GetMessagesAfterID получает сообщения всех чатов с ID больше afterID в порядке возрастания ID.
+// Используется для постраничного обхода всей таблицы messages
+func (r *repository) GetMessagesAfterID(ctx context.Context, afterID string, limit int) ([]*models.Message, error) {
+	query := `
+		SELECT` + messageColumns + `
+		FROM messages
+		WHERE id > $1
+		ORDER BY id ASC
+		LIMIT $2`
+
+	rows, err := r.db.QueryContext(ctx, query, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanMessages(rows)
+}
+
+// GetMessagesInRange получает сообщения чата вместе с ответами в ветках, созданные не раньше from
+// и раньше to, в порядке (created_at, id). Страница начинается после сообщения afterID со временем from,
+// для первой страницы afterID равен "0". Нулевое to означает отсутствие верхней границы
+func (r *repository) GetMessagesInRange(ctx context.Context, chatRoomID string, from time.Time, afterID string, to time.Time, limit int) ([]*models.Message, error) {
+	query := `
+		SELECT` + messageColumns + `
+		FROM messages
+		WHERE chat_room_id = $1
+			AND (created_at, id) > ($2, $3)
+			AND ($4::timestamp IS NULL OR created_at < $4)
+		ORDER BY created_at ASC, id ASC
+		LIMIT $5`
+
+	upper := sql.NullTime{Time: to, Valid: !to.IsZero()}
+	rows, err := r.db.QueryContext(ctx, query, chatRoomID, from, afterID, upper, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanMessages(rows)
+}
+
+// GetLastMessagesByChatRoomIDs получает последнее сообщение основной ленты для каждого из чатов
+func (r *repository) GetLastMessagesByChatRoomIDs(ctx context.Context, chatRoomIDs []string) ([]*models.Message, error) {
+	query := `
+		SELECT DISTINCT ON (chat_room_id)` + messageColumns + `
+		FROM messages
+		WHERE chat_room_id = ANY($1) AND parent_id IS NULL
+		ORDER BY chat_room_id, id DESC`
+
+	rows, err := r.db.QueryContext(ctx, query, pq.Array(chatRoomIDs))
+	if err != nil {
+		return nil, err
+	}
+
+	return scanMessages(rows)
+}
+
+// GetUnreadCountsByUserID считает непрочитанные сообщения основной ленты во всех чатах пользователя.
+// Непрочитанными считаются чужие сообщения после отметки last_read_message_id
+func (r *repository) GetUnreadCountsByUserID(ctx context.Context, userID string) (map[string]int, error) {
+	query := `
+		SELECT crm.chat_room_id, COUNT(m.id)
+		FROM chat_room_members crm
+		LEFT JOIN messages m ON m.chat_room_id = crm.chat_room_id
+			AND m.parent_id IS NULL
+			AND m.sender_id <> crm.user_id
+			AND m.id > COALESCE(crm.last_read_message_id, 0)
+		WHERE crm.user_id = $1
+		GROUP BY crm.chat_room_id`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
 	defer rows.Close()
 
-	var messages []*models.Message
+	counts := make(map[string]int)
 	for rows.Next() {
-		message := &models.Message{}
-		if err = rows.Scan(
-			&message.ID,
-			&message.SenderID,
-			&message.ChatRoomID,
-			&message.EncryptedContent,
-			&message.CreatedAt,
-			&message.UpdatedAt,
-			&message.IsEdited,
-		); err != nil {
+		var chatRoomID string
+		var count int
+		if err := rows.Scan(&chatRoomID, &count); err != nil {
 			return nil, err
 		}
-		messages = append(messages, message)
+		counts[chatRoomID] = count
 	}
 
-	if err = rows.Err(); err != nil {
+	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 
-	return messages, nil
+	return counts, nil
 }
 
-// GetMessageByID получает сообщение по ID сообщения
-func (r *repository) GetMessageByID(ctx context.Context, messageID string) (*models.Message, error) {
+// GetMessagesForReencryption получает сообщения чата, зашифрованные версией ключа ниже keyVersion,
+// с ID больше afterID в порядке возрастания ID. Сообщения со сквозным шифрованием не возвращаются
+func (r *repository) GetMessagesForReencryption(ctx context.Context, chatRoomID string, keyVersion int, afterID string, limit int) ([]*models.Message, error) {
 	query := `
-		SELECT 
-			id,
-			sender_id,
-			chat_room_id,
-			encrypted_content,
-			created_at,
-			updated_at,
-			is_edited 
-		FROM messages 
-		WHERE id = $1`
+		SELECT` + messageColumns + `
+		FROM messages
+		WHERE chat_room_id = $1 AND key_version >= 0 AND key_version < $2 AND id > $3
+		ORDER BY id ASC
+		LIMIT $4`
 
-	message := &models.Message{}
-	err := r.db.QueryRowContext(ctx, query, messageID).Scan(
-		&message.ID,
-		&message.SenderID,
-		&message.ChatRoomID,
-		&message.EncryptedContent,
-		&message.CreatedAt,
-		&message.UpdatedAt,
-		&message.IsEdited,
-	)
+	rows, err := r.db.QueryContext(ctx, query, chatRoomID, keyVersion, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanMessages(rows)
+}
+
+// UpdateMessageEncryption сохраняет перешифрованное содержимое сообщения, если с момента чтения
+// оно не было перешифровано другим процессом. Возвращает false, если сообщение уже изменилось
+func (r *repository) UpdateMessageEncryption(ctx context.Context, message *models.Message, oldKeyVersion int) (bool, error) {
+	query := `
+		UPDATE messages
+		SET encrypted_content = $1, key_version = $2
+		WHERE id = $3 AND key_version = $4`
 
+	res, err := r.db.ExecContext(ctx, query, message.EncryptedContent, message.KeyVersion, message.ID, oldKeyVersion)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// DeleteExpiredMessages в одной транзакции удаляет до limit исчезающих сообщений, срок которых истёк
+// к now, вместе с их файлами, а у корневого сообщения — и с ответами в ветке. У веток, из которых
+// удалены только ответы, уменьшается reply_count. Сообщения чатов на удержании не удаляются
+func (r *repository) DeleteExpiredMessages(ctx context.Context, now time.Time, limit int) (*models.PurgedMessages, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, err
 	}
+	defer tx.Rollback()
 
-	return message, nil
+	// SKIP LOCKED позволяет нескольким серверам удалять сообщения, не мешая друг другу
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id
+		FROM messages
+		WHERE expires_at <= $1 AND `+notOnLegalHold+`
+		ORDER BY expires_at
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED`, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return &models.PurgedMessages{}, nil
+	}
+
+	res, err := purgeMessages(ctx, tx, ids, false)
+	if err != nil {
+		return nil, err
+	}
+
+	deleted := make(map[string]bool, len(res.Messages))
+	for _, message := range res.Messages {
+		deleted[message.ID] = true
+	}
+	replies := make(map[string]int)
+	for _, message := range res.Messages {
+		if message.ParentID.Valid && !deleted[message.ParentID.String] {
+			replies[message.ParentID.String]++
+		}
+	}
+	for parentID, n := range replies {
+		_, err = tx.ExecContext(ctx,
+			"UPDATE messages SET reply_count = GREATEST(reply_count - $1, 0) WHERE id = $2",
+			n, parentID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
 }
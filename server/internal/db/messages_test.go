@@ -9,9 +9,16 @@ import (
 	"chatgo/server/internal/models"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
 )
 
+var messageTestColumns = []string{"id", "sender_id", "chat_room_id", "encrypted_content", "parent_id", "reply_count", "last_reply_at", "created_at", "updated_at", "is_edited", "key_version", "expires_at"}
+
+// insertMessageQuery matches the placeholders of the CreateMessage insert, together with WithArgs
+// it checks that every argument has a placeholder
+const insertMessageQuery = "INSERT INTO messages \\((.+)\\) VALUES \\(\\$1, \\$2, \\$3, \\$4, \\$5, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, false, \\$6\\) RETURNING"
+
 func TestRepository_CreateMessage(t *testing.T) {
 	db, mock, err := MockDB(t)
 	if err != nil {
@@ -21,20 +28,20 @@ func TestRepository_CreateMessage(t *testing.T) {
 
 	repo := &repository{db: db}
 
-	// replyID := sql.NullInt64{Int64: 0, Valid: false}
 	message := &models.Message{
 		SenderID:         "1",
 		ChatRoomID:       "1",
 		EncryptedContent: "Test message content",
-		// ReplyToMessageID: replyID,
 	}
 
-	rows := sqlmock.NewRows([]string{"id", "sender_id", "chat_room_id", "encrypted_content" /*"reply_to_message_id",*/, "created_at", "updated_at", "is_edited"}).
-		AddRow("1", "1", "1", "Test message content" /*replyID,*/, time.Now(), time.Now(), false)
+	rows := sqlmock.NewRows(messageTestColumns).
+		AddRow("1", "1", "1", "Test message content", nil, 0, nil, time.Now(), time.Now(), false, 1, nil)
 
-	mock.ExpectQuery("INSERT INTO messages").
-		WithArgs(message.SenderID, message.ChatRoomID, message.EncryptedContent /*message.ReplyToMessageID*/).
+	mock.ExpectBegin()
+	mock.ExpectQuery(insertMessageQuery).
+		WithArgs(message.SenderID, message.ChatRoomID, message.EncryptedContent, message.ParentID, message.KeyVersion, message.ExpiresAt).
 		WillReturnRows(rows)
+	mock.ExpectCommit()
 
 	ctx := context.Background()
 	createdMessage, err := repo.CreateMessage(ctx, message)
@@ -63,11 +70,11 @@ func TestRepository_GetMessagesByChatRoomID(t *testing.T) {
 			chatRoomID: "1",
 			limit:      10,
 			mockSetup: func(mock sqlmock.Sqlmock) {
-				rows := sqlmock.NewRows([]string{"id", "sender_id", "chat_room_id", "encrypted_content", "created_at", "updated_at", "is_edited"}).
-					AddRow("1", "1", "1", "Message 1", time.Now(), time.Now(), false).
-					AddRow("2", "2", "1", "Message 2", time.Now(), time.Now(), false)
+				rows := sqlmock.NewRows(messageTestColumns).
+					AddRow("1", "1", "1", "Message 1", nil, 0, nil, time.Now(), time.Now(), false, 1, nil).
+					AddRow("2", "2", "1", "Message 2", nil, 0, nil, time.Now(), time.Now(), false, 1, nil)
 
-				mock.ExpectQuery("SELECT (.+) FROM messages WHERE chat_room_id = \\$1 ORDER BY created_at ASC LIMIT \\$2").
+				mock.ExpectQuery("SELECT (.+) FROM messages WHERE chat_room_id = \\$1 AND parent_id IS NULL ORDER BY created_at ASC LIMIT \\$2").
 					WithArgs("1", 10).
 					WillReturnRows(rows)
 			},
@@ -85,7 +92,7 @@ func TestRepository_GetMessagesByChatRoomID(t *testing.T) {
 			chatRoomID: "1",
 			limit:      10,
 			mockSetup: func(mock sqlmock.Sqlmock) {
-				mock.ExpectQuery("SELECT (.+) FROM messages WHERE chat_room_id = \\$1 ORDER BY created_at ASC LIMIT \\$2").
+				mock.ExpectQuery("SELECT (.+) FROM messages WHERE chat_room_id = \\$1 AND parent_id IS NULL ORDER BY created_at ASC LIMIT \\$2").
 					WithArgs("1", 10).
 					WillReturnError(sql.ErrConnDone)
 			},
@@ -101,9 +108,9 @@ func TestRepository_GetMessagesByChatRoomID(t *testing.T) {
 			chatRoomID: "999",
 			limit:      10,
 			mockSetup: func(mock sqlmock.Sqlmock) {
-				mock.ExpectQuery("SELECT (.+) FROM messages WHERE chat_room_id = \\$1 ORDER BY created_at ASC LIMIT \\$2").
+				mock.ExpectQuery("SELECT (.+) FROM messages WHERE chat_room_id = \\$1 AND parent_id IS NULL ORDER BY created_at ASC LIMIT \\$2").
 					WithArgs("999", 10).
-					WillReturnRows(sqlmock.NewRows([]string{"id", "sender_id", "chat_room_id", "encrypted_content", "created_at", "updated_at", "is_edited"}))
+					WillReturnRows(sqlmock.NewRows(messageTestColumns))
 			},
 			expectError: false,
 			checkResult: func(t *testing.T, messages []*models.Message, err error) {
@@ -145,8 +152,8 @@ func TestRepository_GetMessageByID(t *testing.T) {
 
 	repo := &repository{db: db}
 
-	rows := sqlmock.NewRows([]string{"id", "sender_id", "chat_room_id", "encrypted_content", "created_at", "updated_at", "is_edited"}).
-		AddRow("1", "1", "1", "Test message", time.Now(), time.Now(), false)
+	rows := sqlmock.NewRows(messageTestColumns).
+		AddRow("1", "1", "1", "Test message", nil, 0, nil, time.Now(), time.Now(), false, 1, nil)
 
 	mock.ExpectQuery("SELECT (.+) FROM messages WHERE id = \\$1").
 		WithArgs("1").
@@ -164,3 +171,289 @@ func TestRepository_GetMessageByID(t *testing.T) {
 		t.Errorf("Unfulfilled expectations: %s", err)
 	}
 }
+
+func TestRepository_GetMessagesAfterID(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+
+	rows := sqlmock.NewRows(messageTestColumns).
+		AddRow("11", "1", "1", "Message 11", nil, 0, nil, time.Now(), time.Now(), false, 1, nil).
+		AddRow("12", "2", "3", "Message 12", nil, 0, nil, time.Now(), time.Now(), false, 1, nil)
+
+	mock.ExpectQuery("SELECT (.+) FROM messages WHERE id > \\$1 ORDER BY id ASC LIMIT \\$2").
+		WithArgs("10", 2).
+		WillReturnRows(rows)
+
+	ctx := context.Background()
+	messages, err := repo.GetMessagesAfterID(ctx, "10", 2)
+
+	assert.NoError(t, err)
+	assert.Len(t, messages, 2)
+	assert.Equal(t, "11", messages[0].ID)
+	assert.Equal(t, "3", messages[1].ChatRoomID)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_GetMessagesInRange(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	rows := sqlmock.NewRows(messageTestColumns).
+		AddRow("4", "1", "1", "Message 4", nil, 1, nil, from.Add(time.Hour), from.Add(time.Hour), false, 1, nil).
+		AddRow("5", "2", "1", "Reply 5", "4", 0, nil, from.Add(2*time.Hour), from.Add(2*time.Hour), false, 1, nil)
+
+	mock.ExpectQuery("SELECT (.+) FROM messages WHERE chat_room_id = \\$1 AND \\(created_at, id\\) > \\(\\$2, \\$3\\) (.+) ORDER BY created_at ASC, id ASC LIMIT \\$5").
+		WithArgs("1", from, "0", sql.NullTime{Time: to, Valid: true}, 100).
+		WillReturnRows(rows)
+	mock.ExpectQuery("SELECT (.+) FROM messages").
+		WithArgs("1", from.Add(2*time.Hour), "5", sql.NullTime{}, 100).
+		WillReturnRows(sqlmock.NewRows(messageTestColumns))
+
+	ctx := context.Background()
+	messages, err := repo.GetMessagesInRange(ctx, "1", from, "0", to, 100)
+
+	assert.NoError(t, err)
+	assert.Len(t, messages, 2)
+	assert.False(t, messages[0].ParentID.Valid)
+	assert.Equal(t, "4", messages[1].ParentID.String)
+
+	messages, err = repo.GetMessagesInRange(ctx, "1", messages[1].CreatedAt, messages[1].ID, time.Time{}, 100)
+
+	assert.NoError(t, err)
+	assert.Empty(t, messages)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_CreateMessage_Reply(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+
+	parentID := sql.NullString{String: "1", Valid: true}
+	message := &models.Message{
+		SenderID:         "2",
+		ChatRoomID:       "1",
+		EncryptedContent: "Reply content",
+		ParentID:         parentID,
+	}
+	createdAt := time.Now()
+
+	rows := sqlmock.NewRows(messageTestColumns).
+		AddRow("2", "2", "1", "Reply content", "1", 0, nil, createdAt, createdAt, false, 1, nil)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(insertMessageQuery).
+		WithArgs(message.SenderID, message.ChatRoomID, message.EncryptedContent, parentID, message.KeyVersion, message.ExpiresAt).
+		WillReturnRows(rows)
+	mock.ExpectExec("UPDATE messages SET reply_count = reply_count \\+ 1, last_reply_at = \\$1 WHERE id = \\$2").
+		WithArgs(createdAt, "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	createdMessage, err := repo.CreateMessage(context.Background(), message)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "2", createdMessage.ID)
+	assert.Equal(t, parentID, createdMessage.ParentID)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_GetThreadMessages(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+
+	rows := sqlmock.NewRows(messageTestColumns).
+		AddRow("2", "2", "1", "Reply 1", "1", 0, nil, time.Now(), time.Now(), false, 1, nil).
+		AddRow("3", "1", "1", "Reply 2", "1", 0, nil, time.Now(), time.Now(), false, 1, nil)
+
+	mock.ExpectQuery("SELECT (.+) FROM messages WHERE parent_id = \\$1 ORDER BY created_at ASC LIMIT \\$2").
+		WithArgs("1", 50).
+		WillReturnRows(rows)
+
+	messages, err := repo.GetThreadMessages(context.Background(), "1", 50)
+
+	assert.NoError(t, err)
+	assert.Len(t, messages, 2)
+	assert.Equal(t, "1", messages[0].ParentID.String)
+	assert.Equal(t, "Reply 2", messages[1].EncryptedContent)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_GetLastMessagesByChatRoomIDs(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+
+	rows := sqlmock.NewRows(messageTestColumns).
+		AddRow("7", "1", "1", "Last in room 1", nil, 0, nil, time.Now(), time.Now(), false, 1, nil).
+		AddRow("9", "2", "2", "Last in room 2", nil, 0, nil, time.Now(), time.Now(), false, 1, nil)
+
+	mock.ExpectQuery("SELECT DISTINCT ON \\(chat_room_id\\) (.+) FROM messages WHERE chat_room_id = ANY\\(\\$1\\) AND parent_id IS NULL").
+		WithArgs(pq.Array([]string{"1", "2"})).
+		WillReturnRows(rows)
+
+	messages, err := repo.GetLastMessagesByChatRoomIDs(context.Background(), []string{"1", "2"})
+
+	assert.NoError(t, err)
+	assert.Len(t, messages, 2)
+	assert.Equal(t, "Last in room 2", messages[1].EncryptedContent)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_GetUnreadCountsByUserID(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+
+	rows := sqlmock.NewRows([]string{"chat_room_id", "count"}).
+		AddRow("1", 3).
+		AddRow("2", 0)
+
+	mock.ExpectQuery("SELECT crm.chat_room_id, COUNT\\(m.id\\) FROM chat_room_members crm LEFT JOIN messages m").
+		WithArgs("5").
+		WillReturnRows(rows)
+
+	counts, err := repo.GetUnreadCountsByUserID(context.Background(), "5")
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"1": 3, "2": 0}, counts)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_GetMessagesForReencryption(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+
+	rows := sqlmock.NewRows(messageTestColumns).
+		AddRow("3", "1", "5", "old ciphertext", nil, 0, nil, time.Now(), time.Now(), false, 1, nil)
+
+	mock.ExpectQuery("SELECT (.+) FROM messages WHERE chat_room_id = \\$1 AND key_version >= 0 AND key_version < \\$2 AND id > \\$3").
+		WithArgs("5", 2, "0", 100).
+		WillReturnRows(rows)
+
+	messages, err := repo.GetMessagesForReencryption(context.Background(), "5", 2, "0", 100)
+
+	assert.NoError(t, err)
+	assert.Len(t, messages, 1)
+	assert.Equal(t, 1, messages[0].KeyVersion)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_UpdateMessageEncryption(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+	message := &models.Message{ID: "3", EncryptedContent: "new ciphertext", KeyVersion: 2}
+
+	mock.ExpectExec("UPDATE messages SET encrypted_content = \\$1, key_version = \\$2 WHERE id = \\$3 AND key_version = \\$4").
+		WithArgs("new ciphertext", 2, "3", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	updated, err := repo.UpdateMessageEncryption(context.Background(), message, 1)
+
+	assert.NoError(t, err)
+	assert.True(t, updated)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_DeleteExpiredMessages(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+	now := time.Now()
+	expiredAt := sql.NullTime{Time: now.Add(-time.Second), Valid: true}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id FROM messages WHERE expires_at <= \\$1 AND chat_room_id NOT IN (.+) ORDER BY expires_at LIMIT \\$2 FOR UPDATE SKIP LOCKED").
+		WithArgs(now, 100).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("4").AddRow("8"))
+	mock.ExpectQuery("DELETE FROM attachments").
+		WithArgs(pq.Array([]string{"4", "8"})).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "chat_room_id", "uploader_id", "message_id", "filename", "content_type", "size", "storage_key", "key_version", "created_at"}))
+	// Message 4 is a thread root and takes its reply 5 along, 8 is a reply in a thread that stays
+	mock.ExpectQuery("DELETE FROM messages").
+		WithArgs(pq.Array([]string{"4", "8"})).
+		WillReturnRows(sqlmock.NewRows(messageTestColumns).
+			AddRow("4", "1", "1", "root", nil, 1, now, now, now, false, 1, expiredAt).
+			AddRow("5", "2", "1", "reply", "4", 0, nil, now, now, false, 1, nil).
+			AddRow("8", "2", "1", "reply", "6", 0, nil, now, now, false, 1, expiredAt))
+	mock.ExpectExec("UPDATE messages SET reply_count = GREATEST\\(reply_count - \\$1, 0\\) WHERE id = \\$2").
+		WithArgs(1, "6").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	purged, err := repo.DeleteExpiredMessages(context.Background(), now, 100)
+
+	assert.NoError(t, err)
+	assert.Len(t, purged.Messages, 3)
+	assert.Empty(t, purged.Attachments)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
@@ -1,4 +1,28 @@
 -- Drop existing tables in reverse order of dependencies
+DROP TABLE IF EXISTS password_resets;
+DROP TABLE IF EXISTS recovery_codes;
+DROP TABLE IF EXISTS user_totp;
+DROP TABLE IF EXISTS login_attempts;
+DROP TABLE IF EXISTS rate_limit_buckets;
+DROP TABLE IF EXISTS poll_votes;
+DROP TABLE IF EXISTS polls;
+DROP TABLE IF EXISTS bot_token_rooms;
+DROP TABLE IF EXISTS bot_tokens;
+DROP TABLE IF EXISTS bots;
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhooks;
+DROP TABLE IF EXISTS retention_purges;
+DROP TABLE IF EXISTS retention_policies;
+DROP TABLE IF EXISTS archived_attachments;
+DROP TABLE IF EXISTS archived_messages;
+DROP TABLE IF EXISTS import_mappings;
+DROP TABLE IF EXISTS scheduled_messages;
+DROP TABLE IF EXISTS pinned_messages;
+DROP TABLE IF EXISTS user_keys;
+DROP TABLE IF EXISTS room_keys;
+DROP TABLE IF EXISTS attachments CASCADE;
+DROP TABLE IF EXISTS mentions;
+DROP TABLE IF EXISTS message_reactions;
 DROP TABLE IF EXISTS chat_room_members;
 DROP TABLE IF EXISTS messages CASCADE;
 DROP TABLE IF EXISTS chat_rooms;
@@ -18,9 +42,26 @@ CREATE TABLE users (
     encrypted_password VARCHAR(255) NOT NULL,
     created_at TIMESTAMP NOT NULL DEFAULT NOW(),
     last_login TIMESTAMP,
-    status user_status NOT NULL DEFAULT 'offline'
+    last_seen_at TIMESTAMP,
+    status user_status NOT NULL DEFAULT 'offline',
+    is_bot BOOLEAN NOT NULL DEFAULT FALSE,
+    last_login_ip VARCHAR(45),
+    -- Failed logins since the last successful one, each of them locks the account for a while
+    failed_logins INTEGER NOT NULL DEFAULT 0,
+    locked_until TIMESTAMP,
+    -- Access tokens carry the version they were issued with, changing the password bumps it
+    -- and so revokes them
+    token_version INTEGER NOT NULL DEFAULT 0,
+    -- Profile, the avatar column is added after the attachments table
+    display_name VARCHAR(64) NOT NULL DEFAULT '',
+    bio VARCHAR(500) NOT NULL DEFAULT '',
+    timezone VARCHAR(64) NOT NULL DEFAULT '',
+    status_text VARCHAR(100) NOT NULL DEFAULT ''
 );
 
+-- Usernames are unique regardless of case, so that "Alice" can't impersonate "alice"
+CREATE UNIQUE INDEX idx_users_username_lower ON users(LOWER(username));
+
 CREATE TYPE chat_room_type AS ENUM ('direct', 'group');
 
 CREATE TABLE chat_rooms (
@@ -28,7 +69,10 @@ CREATE TABLE chat_rooms (
     name VARCHAR(100) NOT NULL,
     type chat_room_type NOT NULL DEFAULT 'direct',
     created_at TIMESTAMP NOT NULL DEFAULT NOW(),
-    creator_id bigserial REFERENCES users(id) NOT NULL
+    creator_id bigserial REFERENCES users(id) NOT NULL,
+    e2e BOOLEAN NOT NULL DEFAULT false,
+    message_ttl INTEGER NOT NULL DEFAULT 0 CHECK (message_ttl >= 0),
+    topic VARCHAR(250) NOT NULL DEFAULT ''
 );
 
 CREATE TABLE messages (
@@ -36,11 +80,20 @@ CREATE TABLE messages (
     sender_id bigserial REFERENCES users(id) NOT NULL,
     chat_room_id bigserial REFERENCES chat_rooms(id) NOT NULL,
     encrypted_content TEXT NOT NULL,
+    parent_id BIGINT REFERENCES messages(id),
+    reply_count INTEGER NOT NULL DEFAULT 0,
+    last_reply_at TIMESTAMP,
     created_at TIMESTAMP NOT NULL DEFAULT NOW(),
     updated_at TIMESTAMP,
-    is_edited BOOLEAN NOT NULL DEFAULT FALSE
+    is_edited BOOLEAN NOT NULL DEFAULT FALSE,
+    key_version INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP
 );
 
+CREATE INDEX idx_messages_parent_id ON messages(parent_id);
+CREATE INDEX idx_messages_expires_at ON messages(expires_at) WHERE expires_at IS NOT NULL;
+CREATE INDEX idx_messages_room_created_at ON messages(chat_room_id, created_at, id);
+
 CREATE TYPE chat_room_role AS ENUM ('admin', 'moderator', 'member');
 
 CREATE TABLE chat_room_members (
@@ -48,5 +101,267 @@ CREATE TABLE chat_room_members (
     chat_room_id bigserial REFERENCES chat_rooms(id) NOT NULL,
     joined_at TIMESTAMP NOT NULL DEFAULT NOW(),
     role chat_room_role NOT NULL DEFAULT 'member',
+    last_read_message_id BIGINT,
+    last_read_at TIMESTAMP,
     PRIMARY KEY (user_id, chat_room_id)
 );
+
+CREATE TABLE message_reactions (
+    message_id BIGINT REFERENCES messages(id) ON DELETE CASCADE NOT NULL,
+    user_id BIGINT REFERENCES users(id) NOT NULL,
+    emoji VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (message_id, user_id, emoji)
+);
+
+CREATE TABLE scheduled_messages (
+    id bigserial PRIMARY KEY,
+    sender_id BIGINT REFERENCES users(id) NOT NULL,
+    chat_room_id BIGINT REFERENCES chat_rooms(id) NOT NULL,
+    encrypted_content TEXT NOT NULL,
+    key_version INTEGER NOT NULL DEFAULT 0,
+    send_at TIMESTAMP NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'pending',
+    message_id BIGINT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_scheduled_messages_due ON scheduled_messages(send_at) WHERE status = 'pending';
+CREATE INDEX idx_scheduled_messages_sender ON scheduled_messages(sender_id, send_at) WHERE status = 'pending';
+
+CREATE TABLE pinned_messages (
+    message_id BIGINT PRIMARY KEY REFERENCES messages(id) ON DELETE CASCADE,
+    chat_room_id BIGINT REFERENCES chat_rooms(id) NOT NULL,
+    pinned_by BIGINT REFERENCES users(id) NOT NULL,
+    pinned_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_pinned_messages_room ON pinned_messages(chat_room_id, pinned_at);
+
+CREATE TABLE mentions (
+    id bigserial PRIMARY KEY,
+    message_id BIGINT REFERENCES messages(id) ON DELETE CASCADE NOT NULL,
+    user_id BIGINT REFERENCES users(id) NOT NULL,
+    chat_room_id BIGINT REFERENCES chat_rooms(id) NOT NULL,
+    is_read BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (message_id, user_id)
+);
+
+CREATE INDEX idx_mentions_user_unread ON mentions(user_id) WHERE NOT is_read;
+
+CREATE TABLE attachments (
+    id bigserial PRIMARY KEY,
+    chat_room_id BIGINT REFERENCES chat_rooms(id) NOT NULL,
+    uploader_id BIGINT REFERENCES users(id) NOT NULL,
+    message_id BIGINT REFERENCES messages(id) ON DELETE SET NULL,
+    filename VARCHAR(255) NOT NULL,
+    content_type VARCHAR(255) NOT NULL,
+    size BIGINT NOT NULL,
+    storage_key VARCHAR(255) UNIQUE NOT NULL,
+    key_version INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_attachments_message_id ON attachments(message_id);
+
+CREATE TABLE room_keys (
+    chat_room_id BIGINT REFERENCES chat_rooms(id) ON DELETE CASCADE NOT NULL,
+    version INTEGER NOT NULL,
+    wrapped_key TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (chat_room_id, version)
+);
+
+CREATE TABLE user_keys (
+    user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    public_key TEXT NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE import_mappings (
+    source VARCHAR(32) NOT NULL,
+    kind VARCHAR(16) NOT NULL,
+    external_id VARCHAR(255) NOT NULL,
+    local_id BIGINT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (source, kind, external_id)
+);
+
+CREATE TABLE retention_policies (
+    chat_room_id BIGINT PRIMARY KEY REFERENCES chat_rooms(id) ON DELETE CASCADE,
+    max_age_days INTEGER CHECK (max_age_days >= 0),
+    max_messages INTEGER CHECK (max_messages >= 0),
+    legal_hold BOOLEAN NOT NULL DEFAULT FALSE,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Purged messages and attachments are moved here when retention archiving is enabled
+CREATE TABLE archived_messages (
+    LIKE messages,
+    archived_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE archived_attachments (
+    LIKE attachments,
+    archived_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE retention_purges (
+    id bigserial PRIMARY KEY,
+    chat_room_id BIGINT NOT NULL,
+    reason VARCHAR(16) NOT NULL,
+    messages INTEGER NOT NULL,
+    attachments INTEGER NOT NULL,
+    archived BOOLEAN NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_retention_purges_room ON retention_purges(chat_room_id, created_at);
+
+CREATE TABLE webhooks (
+    id bigserial PRIMARY KEY,
+    chat_room_id BIGINT NOT NULL REFERENCES chat_rooms(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    events TEXT[] NOT NULL,
+    encrypted_secret TEXT NOT NULL,
+    key_version INTEGER NOT NULL,
+    created_by BIGINT REFERENCES users(id) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_webhooks_room ON webhooks(chat_room_id);
+
+-- Deliveries are kept as the delivery history, dead ones form the dead-letter log. The payload is
+-- encrypted with the room key and cleared once delivered. Deliveries of a message are deleted with it,
+-- so expiry and retention purge its content from the queue too
+CREATE TABLE webhook_deliveries (
+    id bigserial PRIMARY KEY,
+    webhook_id BIGINT NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+    message_id BIGINT REFERENCES messages(id) ON DELETE CASCADE,
+    event VARCHAR(32) NOT NULL,
+    encrypted_payload TEXT NOT NULL,
+    key_version INTEGER NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    last_status_code INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    delivered_at TIMESTAMP
+);
+
+CREATE INDEX idx_webhook_deliveries_due ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+CREATE INDEX idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id, id);
+CREATE INDEX idx_webhook_deliveries_message ON webhook_deliveries(message_id) WHERE message_id IS NOT NULL;
+
+-- Bots are users with is_bot set, they sign in with API tokens instead of a password
+CREATE TABLE bots (
+    user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    owner_id BIGINT REFERENCES users(id) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_bots_owner ON bots(owner_id);
+
+-- Only the SHA-256 hash of a token is stored. Incoming webhook tokens are granted a single room
+CREATE TABLE bot_tokens (
+    id bigserial PRIMARY KEY,
+    bot_id BIGINT NOT NULL REFERENCES bots(user_id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    kind VARCHAR(16) NOT NULL,
+    token_hash CHAR(64) UNIQUE NOT NULL,
+    created_by BIGINT REFERENCES users(id) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMP,
+    revoked_at TIMESTAMP
+);
+
+CREATE TABLE bot_token_rooms (
+    token_id BIGINT REFERENCES bot_tokens(id) ON DELETE CASCADE,
+    chat_room_id BIGINT REFERENCES chat_rooms(id) ON DELETE CASCADE,
+    PRIMARY KEY (token_id, chat_room_id)
+);
+
+-- A poll is shown by its message. The question and the options are encrypted with the room key
+CREATE TABLE polls (
+    id bigserial PRIMARY KEY,
+    message_id BIGINT UNIQUE NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    chat_room_id BIGINT NOT NULL REFERENCES chat_rooms(id) ON DELETE CASCADE,
+    created_by BIGINT REFERENCES users(id) NOT NULL,
+    question TEXT NOT NULL,
+    options TEXT[] NOT NULL,
+    key_version INTEGER NOT NULL,
+    multiple BOOLEAN NOT NULL DEFAULT FALSE,
+    anonymous BOOLEAN NOT NULL DEFAULT FALSE,
+    closes_at TIMESTAMP,
+    closed_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_polls_closing ON polls(closes_at) WHERE closed_at IS NULL AND closes_at IS NOT NULL;
+
+-- Votes are kept after the poll closes, so that its final results stay in the history
+CREATE TABLE poll_votes (
+    poll_id BIGINT REFERENCES polls(id) ON DELETE CASCADE,
+    user_id BIGINT REFERENCES users(id) ON DELETE CASCADE,
+    option_index SMALLINT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (poll_id, user_id, option_index)
+);
+
+-- Token buckets of rate limits, shared by all server instances when the postgres store is configured
+CREATE TABLE rate_limit_buckets (
+    key TEXT PRIMARY KEY,
+    tokens DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_rate_limit_buckets_updated_at ON rate_limit_buckets(updated_at);
+
+-- Login history shown to the user. Attempts with unknown usernames are not recorded
+CREATE TABLE login_attempts (
+    id bigserial PRIMARY KEY,
+    user_id BIGINT REFERENCES users(id) ON DELETE CASCADE,
+    ip VARCHAR(45) NOT NULL,
+    user_agent TEXT NOT NULL DEFAULT '',
+    success BOOLEAN NOT NULL,
+    reason VARCHAR(20) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_login_attempts_user ON login_attempts(user_id, created_at DESC);
+
+-- TOTP secrets are encrypted with the master key. A secret is enabled once the user confirms it
+-- with a code, and codes of last_used_step and earlier are rejected so that a code works only once
+CREATE TABLE user_totp (
+    user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    encrypted_secret TEXT NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    enabled_at TIMESTAMP
+);
+
+-- One-time recovery codes, stored as SHA-256 hashes
+CREATE TABLE recovery_codes (
+    user_id BIGINT REFERENCES users(id) ON DELETE CASCADE,
+    code_hash VARCHAR(64) NOT NULL,
+    used_at TIMESTAMP,
+    PRIMARY KEY (user_id, code_hash)
+);
+
+-- One-time password reset tokens issued by server admins, stored as SHA-256 hashes
+CREATE TABLE password_resets (
+    token_hash VARCHAR(64) PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP
+);
+
+CREATE INDEX idx_password_resets_user ON password_resets(user_id);
+
+-- An avatar is an image attachment uploaded by the user, deleting it clears the avatar
+ALTER TABLE users ADD COLUMN avatar_attachment_id BIGINT REFERENCES attachments(id) ON DELETE SET NULL;
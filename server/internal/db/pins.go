@@ -0,0 +1,84 @@
+package db
+
+import (
+	"chatgo/server/internal/models"
+	"context"
+)
+
+// PinMessage закрепляет сообщение в чате, если в нём закреплено меньше max сообщений.
+// Возвращает false, если сообщение уже закреплено или лимит исчерпан. Строка чата блокируется,
+// чтобы одновременные закрепления не превысили лимит
+func (r *repository) PinMessage(ctx context.Context, pin *models.PinnedMessage, max int) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, "SELECT 1 FROM chat_rooms WHERE id = $1 FOR UPDATE", pin.ChatRoomID); err != nil {
+		return false, err
+	}
+
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO pinned_messages (message_id, chat_room_id, pinned_by, pinned_at)
+		SELECT $1, $2, $3, CURRENT_TIMESTAMP
+		WHERE (SELECT COUNT(*) FROM pinned_messages WHERE chat_room_id = $2) < $4
+		ON CONFLICT (message_id) DO NOTHING`,
+		pin.MessageID, pin.ChatRoomID, pin.PinnedBy, max)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// UnpinMessage открепляет сообщение, возвращает false если оно не было закреплено
+func (r *repository) UnpinMessage(ctx context.Context, chatRoomID, messageID string) (bool, error) {
+	res, err := r.db.ExecContext(ctx,
+		"DELETE FROM pinned_messages WHERE chat_room_id = $1 AND message_id = $2",
+		chatRoomID, messageID)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// GetPinnedMessages возвращает закреплённые сообщения чата в порядке закрепления
+func (r *repository) GetPinnedMessages(ctx context.Context, chatRoomID string) ([]*models.PinnedMessage, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT message_id, chat_room_id, pinned_by, pinned_at
+		FROM pinned_messages
+		WHERE chat_room_id = $1
+		ORDER BY pinned_at, message_id`, chatRoomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pins []*models.PinnedMessage
+	for rows.Next() {
+		var pin models.PinnedMessage
+		if err := rows.Scan(&pin.MessageID, &pin.ChatRoomID, &pin.PinnedBy, &pin.PinnedAt); err != nil {
+			return nil, err
+		}
+		pins = append(pins, &pin)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return pins, nil
+}
@@ -0,0 +1,104 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"chatgo/server/internal/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository_PinMessage(t *testing.T) {
+	testCases := []struct {
+		name           string
+		affected       int64
+		expectedPinned bool
+	}{
+		{name: "Pin message", affected: 1, expectedPinned: true},
+		{name: "Already pinned or limit reached", affected: 0, expectedPinned: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := MockDB(t)
+			if err != nil {
+				t.Fatalf("Error creating mock DB: %v", err)
+			}
+			defer db.Close()
+
+			repo := &repository{db: db}
+			pin := &models.PinnedMessage{MessageID: "10", ChatRoomID: "1", PinnedBy: "2"}
+
+			mock.ExpectBegin()
+			mock.ExpectExec("SELECT 1 FROM chat_rooms WHERE id = \\$1 FOR UPDATE").
+				WithArgs("1").
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec("INSERT INTO pinned_messages (.+) WHERE \\(SELECT COUNT\\(\\*\\) FROM pinned_messages WHERE chat_room_id = \\$2\\) < \\$4 ON CONFLICT").
+				WithArgs("10", "1", "2", 10).
+				WillReturnResult(sqlmock.NewResult(0, tc.affected))
+			mock.ExpectCommit()
+
+			pinned, err := repo.PinMessage(context.Background(), pin, 10)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedPinned, pinned)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestRepository_UnpinMessage(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+
+	mock.ExpectExec("DELETE FROM pinned_messages WHERE chat_room_id = \\$1 AND message_id = \\$2").
+		WithArgs("1", "10").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	unpinned, err := repo.UnpinMessage(context.Background(), "1", "10")
+
+	assert.NoError(t, err)
+	assert.True(t, unpinned)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_GetPinnedMessages(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+	pinnedAt := time.Now()
+
+	rows := sqlmock.NewRows([]string{"message_id", "chat_room_id", "pinned_by", "pinned_at"}).
+		AddRow("10", "1", "2", pinnedAt).
+		AddRow("12", "1", "3", pinnedAt.Add(time.Minute))
+	mock.ExpectQuery("SELECT (.+) FROM pinned_messages WHERE chat_room_id = \\$1 ORDER BY pinned_at").
+		WithArgs("1").
+		WillReturnRows(rows)
+
+	pins, err := repo.GetPinnedMessages(context.Background(), "1")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []*models.PinnedMessage{
+		{MessageID: "10", ChatRoomID: "1", PinnedBy: "2", PinnedAt: pinnedAt},
+		{MessageID: "12", ChatRoomID: "1", PinnedBy: "3", PinnedAt: pinnedAt.Add(time.Minute)},
+	}, pins)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
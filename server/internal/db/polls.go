@@ -0,0 +1,240 @@
+package db
+
+import (
+	"chatgo/server/internal/models"
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const pollColumns = `
+			id,
+			message_id,
+			chat_room_id,
+			created_by,
+			question,
+			options,
+			key_version,
+			multiple,
+			anonymous,
+			closes_at,
+			closed_at,
+			created_at`
+
+func scanPoll(row rowScanner, poll *models.Poll) error {
+	return row.Scan(
+		&poll.ID,
+		&poll.MessageID,
+		&poll.ChatRoomID,
+		&poll.CreatedBy,
+		&poll.EncryptedQuestion,
+		pq.Array(&poll.EncryptedOptions),
+		&poll.KeyVersion,
+		&poll.Multiple,
+		&poll.Anonymous,
+		&poll.ClosesAt,
+		&poll.ClosedAt,
+		&poll.CreatedAt,
+	)
+}
+
+// CreatePoll в одной транзакции сохраняет сообщение с опросом и сам опрос, чтобы в чате не осталось
+// сообщения без опроса
+func (r *repository) CreatePoll(ctx context.Context, message *models.Message, poll *models.Poll) (*models.Message, *models.Poll, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	if err = insertMessage(ctx, tx, message); err != nil {
+		return nil, nil, err
+	}
+
+	poll.MessageID = message.ID
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO polls (message_id, chat_room_id, created_by, question, options, key_version,
+			multiple, anonymous, closes_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, CURRENT_TIMESTAMP)
+		RETURNING id, created_at`,
+		poll.MessageID, poll.ChatRoomID, poll.CreatedBy, poll.EncryptedQuestion, pq.Array(poll.EncryptedOptions),
+		poll.KeyVersion, poll.Multiple, poll.Anonymous, poll.ClosesAt).Scan(&poll.ID, &poll.CreatedAt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+	return message, poll, nil
+}
+
+// GetPollByID возвращает опрос вместе с голосами или nil, если его нет
+func (r *repository) GetPollByID(ctx context.Context, id string) (*models.Poll, error) {
+	var poll models.Poll
+	err := scanPoll(r.db.QueryRowContext(ctx, `
+		SELECT`+pollColumns+`
+		FROM polls
+		WHERE id = $1`, id), &poll)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.loadPollVotes(ctx, []*models.Poll{&poll}); err != nil {
+		return nil, err
+	}
+	return &poll, nil
+}
+
+// GetPollsByMessageIDs возвращает опросы сообщений вместе с голосами
+func (r *repository) GetPollsByMessageIDs(ctx context.Context, messageIDs []string) ([]*models.Poll, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT`+pollColumns+`
+		FROM polls
+		WHERE message_id = ANY($1)`, pq.Array(messageIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var polls []*models.Poll
+	for rows.Next() {
+		var poll models.Poll
+		if err := scanPoll(rows, &poll); err != nil {
+			return nil, err
+		}
+		polls = append(polls, &poll)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := r.loadPollVotes(ctx, polls); err != nil {
+		return nil, err
+	}
+	return polls, nil
+}
+
+// loadPollVotes заполняет голоса опросов в порядке голосования
+func (r *repository) loadPollVotes(ctx context.Context, polls []*models.Poll) error {
+	if len(polls) == 0 {
+		return nil
+	}
+	byID := make(map[string]*models.Poll, len(polls))
+	ids := make([]string, len(polls))
+	for i, poll := range polls {
+		byID[poll.ID] = poll
+		ids[i] = poll.ID
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT v.poll_id, v.user_id, u.username, v.option_index
+		FROM poll_votes v
+		JOIN users u ON u.id = v.user_id
+		WHERE v.poll_id = ANY($1)
+		ORDER BY v.created_at, v.user_id, v.option_index`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var vote models.PollVote
+		if err := rows.Scan(&vote.PollID, &vote.UserID, &vote.Username, &vote.Option); err != nil {
+			return err
+		}
+		if poll, ok := byID[vote.PollID]; ok {
+			poll.Votes = append(poll.Votes, &vote)
+		}
+	}
+	return rows.Err()
+}
+
+// SetPollVotes заменяет голоса пользователя в опросе на options, пустой список отзывает голос.
+// Возвращает false, если опрос закрыт или его нет
+func (r *repository) SetPollVotes(ctx context.Context, pollID, userID string, options []int) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// Блокировка строки опроса не даёт закрыть его посреди голосования
+	var id string
+	err = tx.QueryRowContext(ctx, `
+		SELECT id FROM polls
+		WHERE id = $1 AND closed_at IS NULL AND (closes_at IS NULL OR closes_at > CURRENT_TIMESTAMP)
+		FOR UPDATE`, pollID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM poll_votes WHERE poll_id = $1 AND user_id = $2", pollID, userID)
+	if err != nil {
+		return false, err
+	}
+
+	if len(options) > 0 {
+		indexes := make([]int64, len(options))
+		for i, option := range options {
+			indexes[i] = int64(option)
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO poll_votes (poll_id, user_id, option_index, created_at)
+			SELECT $1, $2, unnest($3::smallint[]), CURRENT_TIMESTAMP`,
+			pollID, userID, pq.Array(indexes))
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// MarkPollClosed закрывает опрос. Возвращает false, если он уже закрыт или его нет
+func (r *repository) MarkPollClosed(ctx context.Context, id string) (bool, error) {
+	res, err := r.db.ExecContext(ctx,
+		"UPDATE polls SET closed_at = CURRENT_TIMESTAMP WHERE id = $1 AND closed_at IS NULL", id)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// CloseDuePolls закрывает опросы, время закрытия которых наступило к now, и возвращает их ID
+func (r *repository) CloseDuePolls(ctx context.Context, now time.Time) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		UPDATE polls SET closed_at = closes_at
+		WHERE closed_at IS NULL AND closes_at <= $1
+		RETURNING id`, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
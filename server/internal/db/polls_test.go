@@ -0,0 +1,248 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"chatgo/server/internal/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	pollTestColumns     = []string{"id", "message_id", "chat_room_id", "created_by", "question", "options", "key_version", "multiple", "anonymous", "closes_at", "closed_at", "created_at"}
+	pollVoteTestColumns = []string{"poll_id", "user_id", "username", "option_index"}
+)
+
+func TestRepository_CreatePoll(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+	now := time.Now()
+	closesAt := sql.NullTime{Time: now.Add(time.Hour), Valid: true}
+	message := &models.Message{SenderID: "2", ChatRoomID: "5", EncryptedContent: "enc-m", KeyVersion: 1}
+	poll := &models.Poll{
+		ChatRoomID:        "5",
+		CreatedBy:         "2",
+		EncryptedQuestion: "enc-q",
+		EncryptedOptions:  []string{"enc-a", "enc-b"},
+		KeyVersion:        1,
+		Multiple:          true,
+		ClosesAt:          closesAt,
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(insertMessageQuery).
+		WithArgs("2", "5", "enc-m", message.ParentID, 1, message.ExpiresAt).
+		WillReturnRows(sqlmock.NewRows(messageTestColumns).
+			AddRow("10", "2", "5", "enc-m", nil, 0, nil, now, now, false, 1, nil))
+	mock.ExpectQuery("INSERT INTO polls (.+) RETURNING id, created_at").
+		WithArgs("10", "5", "2", "enc-q", pq.Array([]string{"enc-a", "enc-b"}), 1, true, false, closesAt).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow("3", now))
+	mock.ExpectCommit()
+
+	message, poll, err = repo.CreatePoll(context.Background(), message, poll)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "10", message.ID)
+	assert.Equal(t, "3", poll.ID)
+	assert.Equal(t, "10", poll.MessageID)
+	assert.Equal(t, now, poll.CreatedAt)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+// TestRepository_CreatePoll_Rollback checks that the message is not kept when the poll can't be stored
+func TestRepository_CreatePoll_Rollback(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+	now := time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(insertMessageQuery).
+		WillReturnRows(sqlmock.NewRows(messageTestColumns).
+			AddRow("10", "2", "5", "enc-m", nil, 0, nil, now, now, false, 1, nil))
+	mock.ExpectQuery("INSERT INTO polls (.+) RETURNING id, created_at").
+		WillReturnError(sql.ErrConnDone)
+	mock.ExpectRollback()
+
+	_, _, err = repo.CreatePoll(context.Background(),
+		&models.Message{SenderID: "2", ChatRoomID: "5", EncryptedContent: "enc-m", KeyVersion: 1},
+		&models.Poll{ChatRoomID: "5", CreatedBy: "2", EncryptedOptions: []string{"enc-a", "enc-b"}})
+
+	assert.ErrorIs(t, err, sql.ErrConnDone)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_GetPollByID(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+
+	mock.ExpectQuery("SELECT (.+) FROM polls WHERE id = \\$1").
+		WithArgs("3").
+		WillReturnRows(sqlmock.NewRows(pollTestColumns).
+			AddRow("3", "10", "5", "2", "enc-q", "{enc-a,enc-b}", 1, false, false, nil, nil, time.Now()))
+	mock.ExpectQuery("SELECT v.poll_id, v.user_id, u.username, v.option_index FROM poll_votes v JOIN users u ON u.id = v.user_id WHERE v.poll_id = ANY\\(\\$1\\)").
+		WithArgs(pq.Array([]string{"3"})).
+		WillReturnRows(sqlmock.NewRows(pollVoteTestColumns).
+			AddRow("3", "2", "alice", 0).
+			AddRow("3", "4", "bob", 1))
+	mock.ExpectQuery("SELECT (.+) FROM polls WHERE id = \\$1").
+		WithArgs("4").
+		WillReturnError(sql.ErrNoRows)
+
+	poll, err := repo.GetPollByID(context.Background(), "3")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"enc-a", "enc-b"}, poll.EncryptedOptions)
+	assert.Equal(t, []*models.PollVote{
+		{PollID: "3", UserID: "2", Username: "alice", Option: 0},
+		{PollID: "3", UserID: "4", Username: "bob", Option: 1},
+	}, poll.Votes)
+
+	poll, err = repo.GetPollByID(context.Background(), "4")
+	assert.NoError(t, err)
+	assert.Nil(t, poll)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_GetPollsByMessageIDs(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+
+	mock.ExpectQuery("SELECT (.+) FROM polls WHERE message_id = ANY\\(\\$1\\)").
+		WithArgs(pq.Array([]string{"10", "11"})).
+		WillReturnRows(sqlmock.NewRows(pollTestColumns).
+			AddRow("3", "10", "5", "2", "enc-q", "{enc-a,enc-b}", 1, false, true, nil, time.Now(), time.Now()))
+	mock.ExpectQuery("SELECT (.+) FROM poll_votes v").
+		WithArgs(pq.Array([]string{"3"})).
+		WillReturnRows(sqlmock.NewRows(pollVoteTestColumns).AddRow("3", "4", "bob", 1))
+
+	polls, err := repo.GetPollsByMessageIDs(context.Background(), []string{"10", "11"})
+
+	assert.NoError(t, err)
+	assert.Len(t, polls, 1)
+	assert.True(t, polls[0].ClosedAt.Valid)
+	assert.Len(t, polls[0].Votes, 1)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_SetPollVotes(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id FROM polls WHERE id = \\$1 AND closed_at IS NULL (.+) FOR UPDATE").
+		WithArgs("3").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("3"))
+	mock.ExpectExec("DELETE FROM poll_votes WHERE poll_id = \\$1 AND user_id = \\$2").
+		WithArgs("3", "2").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO poll_votes (.+) SELECT \\$1, \\$2, unnest\\(\\$3::smallint\\[\\]\\)").
+		WithArgs("3", "2", pq.Array([]int64{0, 2})).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	// A closed poll keeps its votes
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id FROM polls WHERE id = \\$1 AND closed_at IS NULL (.+) FOR UPDATE").
+		WithArgs("4").
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	ok, err := repo.SetPollVotes(context.Background(), "3", "2", []int{0, 2})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = repo.SetPollVotes(context.Background(), "4", "2", []int{1})
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_MarkPollClosed(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+
+	mock.ExpectExec("UPDATE polls SET closed_at = CURRENT_TIMESTAMP WHERE id = \\$1 AND closed_at IS NULL").
+		WithArgs("3").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE polls SET closed_at = CURRENT_TIMESTAMP WHERE id = \\$1 AND closed_at IS NULL").
+		WithArgs("3").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	closed, err := repo.MarkPollClosed(context.Background(), "3")
+	assert.NoError(t, err)
+	assert.True(t, closed)
+
+	closed, err = repo.MarkPollClosed(context.Background(), "3")
+	assert.NoError(t, err)
+	assert.False(t, closed)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_CloseDuePolls(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+	now := time.Now()
+
+	mock.ExpectQuery("UPDATE polls SET closed_at = closes_at WHERE closed_at IS NULL AND closes_at <= \\$1 RETURNING id").
+		WithArgs(now).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("3").AddRow("7"))
+
+	ids, err := repo.CloseDuePolls(context.Background(), now)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"3", "7"}, ids)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
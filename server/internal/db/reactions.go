@@ -0,0 +1,74 @@
+package db
+
+import (
+	"chatgo/server/internal/models"
+	"context"
+
+	"github.com/lib/pq"
+)
+
+// AddReaction добавляет реакцию на сообщение. Повторная реакция тем же эмодзи игнорируется,
+// в этом случае возвращается false
+func (r *repository) AddReaction(ctx context.Context, reaction *models.Reaction) (bool, error) {
+	query := `INSERT INTO message_reactions (message_id, user_id, emoji, created_at)
+			VALUES ($1, $2, $3, CURRENT_TIMESTAMP)
+			ON CONFLICT (message_id, user_id, emoji) DO NOTHING`
+
+	res, err := r.db.ExecContext(ctx, query, reaction.MessageID, reaction.UserID, reaction.Emoji)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// DeleteReaction удаляет реакцию пользователя на сообщение, возвращает false если реакции не было
+func (r *repository) DeleteReaction(ctx context.Context, reaction *models.Reaction) (bool, error) {
+	res, err := r.db.ExecContext(ctx,
+		"DELETE FROM message_reactions WHERE message_id = $1 AND user_id = $2 AND emoji = $3",
+		reaction.MessageID, reaction.UserID, reaction.Emoji)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// GetReactionCountsByMessageIDs получает агрегированные реакции для списка сообщений
+// в порядке появления первой реакции каждым эмодзи
+func (r *repository) GetReactionCountsByMessageIDs(ctx context.Context, messageIDs []string) ([]*models.ReactionCount, error) {
+	query := `SELECT message_id, emoji, COUNT(*)
+			FROM message_reactions
+			WHERE message_id = ANY($1)
+			GROUP BY message_id, emoji
+			ORDER BY MIN(created_at)`
+
+	rows, err := r.db.QueryContext(ctx, query, pq.Array(messageIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []*models.ReactionCount
+	for rows.Next() {
+		var count models.ReactionCount
+		if err := rows.Scan(&count.MessageID, &count.Emoji, &count.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, &count)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,130 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"chatgo/server/internal/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository_AddReaction(t *testing.T) {
+	testCases := []struct {
+		name          string
+		mockSetup     func(mock sqlmock.Sqlmock, reaction *models.Reaction)
+		expectError   bool
+		expectedAdded bool
+	}{
+		{
+			name: "Successfully add reaction",
+			mockSetup: func(mock sqlmock.Sqlmock, reaction *models.Reaction) {
+				mock.ExpectExec("INSERT INTO message_reactions (.+) ON CONFLICT").
+					WithArgs(reaction.MessageID, reaction.UserID, reaction.Emoji).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			expectedAdded: true,
+		},
+		{
+			name: "Duplicate reaction is ignored",
+			mockSetup: func(mock sqlmock.Sqlmock, reaction *models.Reaction) {
+				mock.ExpectExec("INSERT INTO message_reactions (.+) ON CONFLICT").
+					WithArgs(reaction.MessageID, reaction.UserID, reaction.Emoji).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			expectedAdded: false,
+		},
+		{
+			name: "Database error",
+			mockSetup: func(mock sqlmock.Sqlmock, reaction *models.Reaction) {
+				mock.ExpectExec("INSERT INTO message_reactions").
+					WithArgs(reaction.MessageID, reaction.UserID, reaction.Emoji).
+					WillReturnError(sql.ErrConnDone)
+			},
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := MockDB(t)
+			if err != nil {
+				t.Fatalf("Error creating mock DB: %v", err)
+			}
+			defer db.Close()
+
+			repo := &repository{db: db}
+			reaction := &models.Reaction{MessageID: "1", UserID: "2", Emoji: "👍"}
+			tc.mockSetup(mock, reaction)
+
+			added, err := repo.AddReaction(context.Background(), reaction)
+
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedAdded, added)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestRepository_DeleteReaction(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+
+	mock.ExpectExec("DELETE FROM message_reactions WHERE message_id = \\$1 AND user_id = \\$2 AND emoji = \\$3").
+		WithArgs("1", "2", "👍").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	removed, err := repo.DeleteReaction(context.Background(), &models.Reaction{MessageID: "1", UserID: "2", Emoji: "👍"})
+
+	assert.NoError(t, err)
+	assert.True(t, removed)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_GetReactionCountsByMessageIDs(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+
+	rows := sqlmock.NewRows([]string{"message_id", "emoji", "count"}).
+		AddRow("1", "👍", 2).
+		AddRow("2", "🎉", 1)
+
+	mock.ExpectQuery("SELECT message_id, emoji, COUNT\\(\\*\\) FROM message_reactions WHERE message_id = ANY\\(\\$1\\)").
+		WithArgs(pq.Array([]string{"1", "2"})).
+		WillReturnRows(rows)
+
+	counts, err := repo.GetReactionCountsByMessageIDs(context.Background(), []string{"1", "2"})
+
+	assert.NoError(t, err)
+	assert.Len(t, counts, 2)
+	assert.Equal(t, "👍", counts[0].Emoji)
+	assert.Equal(t, 2, counts[0].Count)
+	assert.Equal(t, "2", counts[1].MessageID)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
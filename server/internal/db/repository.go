@@ -15,6 +15,12 @@ type DBTX interface {
 	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
 }
 
+// queryer выполняет запросы как в базе, так и в транзакции
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(context.Context, string, ...interface{}) *sql.Row
+}
+
 type repository struct {
 	db DBTX
 }
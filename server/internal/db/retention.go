@@ -0,0 +1,276 @@
+package db
+
+import (
+	"chatgo/server/internal/models"
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const retentionPolicyColumns = `chat_room_id, max_age_days, max_messages, legal_hold, updated_at`
+
+func scanRetentionPolicy(row rowScanner, policy *models.RetentionPolicy) error {
+	return row.Scan(
+		&policy.ChatRoomID,
+		&policy.MaxAgeDays,
+		&policy.MaxMessages,
+		&policy.LegalHold,
+		&policy.UpdatedAt,
+	)
+}
+
+// notOnLegalHold исключает чаты, на которые наложено удержание
+const notOnLegalHold = `chat_room_id NOT IN (SELECT chat_room_id FROM retention_policies WHERE legal_hold)`
+
+// GetRetentionPolicy получает настройки хранения чата. Возвращает nil, если они не заданы
+func (r *repository) GetRetentionPolicy(ctx context.Context, chatRoomID string) (*models.RetentionPolicy, error) {
+	query := `SELECT ` + retentionPolicyColumns + ` FROM retention_policies WHERE chat_room_id = $1`
+
+	policy := &models.RetentionPolicy{}
+	err := scanRetentionPolicy(r.db.QueryRowContext(ctx, query, chatRoomID), policy)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return policy, nil
+}
+
+// GetRetentionPolicies получает настройки хранения всех чатов, для которых они заданы
+func (r *repository) GetRetentionPolicies(ctx context.Context) ([]*models.RetentionPolicy, error) {
+	query := `SELECT ` + retentionPolicyColumns + ` FROM retention_policies`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var policies []*models.RetentionPolicy
+	for rows.Next() {
+		policy := &models.RetentionPolicy{}
+		if err := scanRetentionPolicy(rows, policy); err != nil {
+			return nil, err
+		}
+		policies = append(policies, policy)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return policies, nil
+}
+
+// SetRetentionLimits задаёт сроки хранения сообщений чата, не меняя удержание
+func (r *repository) SetRetentionLimits(ctx context.Context, policy *models.RetentionPolicy) error {
+	query := `
+		INSERT INTO retention_policies (chat_room_id, max_age_days, max_messages, updated_at)
+		VALUES ($1, $2, $3, CURRENT_TIMESTAMP)
+		ON CONFLICT (chat_room_id) DO UPDATE
+		SET max_age_days = EXCLUDED.max_age_days, max_messages = EXCLUDED.max_messages, updated_at = CURRENT_TIMESTAMP`
+
+	_, err := r.db.ExecContext(ctx, query, policy.ChatRoomID, policy.MaxAgeDays, policy.MaxMessages)
+	return err
+}
+
+// SetLegalHold накладывает или снимает удержание сообщений чата, не меняя сроки хранения
+func (r *repository) SetLegalHold(ctx context.Context, chatRoomID string, hold bool) error {
+	query := `
+		INSERT INTO retention_policies (chat_room_id, legal_hold, updated_at)
+		VALUES ($1, $2, CURRENT_TIMESTAMP)
+		ON CONFLICT (chat_room_id) DO UPDATE
+		SET legal_hold = EXCLUDED.legal_hold, updated_at = CURRENT_TIMESTAMP`
+
+	_, err := r.db.ExecContext(ctx, query, chatRoomID, hold)
+	return err
+}
+
+// GetExpiredMessageIDs получает до limit корневых сообщений чата, в ветках которых не было
+// сообщений после before. Чаты на удержании пропускаются
+func (r *repository) GetExpiredMessageIDs(ctx context.Context, chatRoomID string, before time.Time, limit int) ([]string, error) {
+	query := `
+		SELECT id
+		FROM messages
+		WHERE chat_room_id = $1
+			AND parent_id IS NULL
+			AND COALESCE(last_reply_at, created_at) < $2
+			AND ` + notOnLegalHold + `
+		ORDER BY created_at, id
+		LIMIT $3`
+
+	return r.queryIDs(ctx, query, chatRoomID, before, limit)
+}
+
+// GetOverflowMessageIDs получает до limit корневых сообщений чата, не попадающих в keep последних.
+// Чаты на удержании пропускаются
+func (r *repository) GetOverflowMessageIDs(ctx context.Context, chatRoomID string, keep int, limit int) ([]string, error) {
+	query := `
+		SELECT id
+		FROM messages
+		WHERE chat_room_id = $1
+			AND parent_id IS NULL
+			AND ` + notOnLegalHold + `
+		ORDER BY created_at DESC, id DESC
+		OFFSET $2
+		LIMIT $3`
+
+	return r.queryIDs(ctx, query, chatRoomID, keep, limit)
+}
+
+func (r *repository) queryIDs(ctx context.Context, query string, args ...interface{}) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// PurgeMessages в одной транзакции удаляет сообщения messageIDs вместе с ответами в их ветках
+// и прикреплёнными к ним файлами. Реакции и упоминания удаляются каскадно. Если archive,
+// сообщения и записи о файлах переносятся в archived_messages и archived_attachments.
+// Сообщения чатов на удержании не удаляются. Сами файлы из хранилища не удаляются
+func (r *repository) PurgeMessages(ctx context.Context, messageIDs []string, archive bool) (*models.PurgedMessages, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	res, err := purgeMessages(ctx, tx, messageIDs, archive)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// purgeMessages удаляет сообщения messageIDs, ответы в их ветках и их файлы в транзакции tx
+func purgeMessages(ctx context.Context, tx *sql.Tx, messageIDs []string, archive bool) (*models.PurgedMessages, error) {
+	purged := `
+		SELECT id FROM messages
+		WHERE (id = ANY($1) OR parent_id = ANY($1)) AND ` + notOnLegalHold
+
+	attachmentsQuery := `DELETE FROM attachments WHERE message_id IN (` + purged + `) RETURNING ` + attachmentColumns
+	messagesQuery := `DELETE FROM messages WHERE id IN (` + purged + `) RETURNING ` + messageColumns
+	if archive {
+		attachmentsQuery = `
+			WITH moved AS (` + attachmentsQuery + `)
+			INSERT INTO archived_attachments (` + attachmentColumns + `)
+			SELECT ` + attachmentColumns + ` FROM moved
+			RETURNING ` + attachmentColumns
+		messagesQuery = `
+			WITH moved AS (DELETE FROM messages WHERE id IN (` + purged + `) RETURNING *)
+			INSERT INTO archived_messages (` + messageColumns + `)
+			SELECT ` + messageColumns + ` FROM moved
+			RETURNING ` + messageColumns
+	}
+
+	rows, err := tx.QueryContext(ctx, attachmentsQuery, pq.Array(messageIDs))
+	if err != nil {
+		return nil, err
+	}
+	res := &models.PurgedMessages{}
+	for rows.Next() {
+		attachment := &models.Attachment{}
+		if err := scanAttachment(rows, attachment); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		res.Attachments = append(res.Attachments, attachment)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = tx.QueryContext(ctx, messagesQuery, pq.Array(messageIDs))
+	if err != nil {
+		return nil, err
+	}
+	if res.Messages, err = scanMessages(rows); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// CreateRetentionPurge добавляет запись в журнал очистки, устанавливает created_at CURRENT_TIMESTAMP
+func (r *repository) CreateRetentionPurge(ctx context.Context, purge *models.RetentionPurge) error {
+	query := `
+		INSERT INTO retention_purges (chat_room_id, reason, messages, attachments, archived, created_at)
+		VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP)
+		RETURNING id, created_at`
+
+	return r.db.QueryRowContext(ctx, query,
+		purge.ChatRoomID,
+		purge.Reason,
+		purge.Messages,
+		purge.Attachments,
+		purge.Archived,
+	).Scan(&purge.ID, &purge.CreatedAt)
+}
+
+// GetRetentionPurges получает до limit последних записей журнала очистки чата,
+// или всех чатов, если chatRoomID пуст
+func (r *repository) GetRetentionPurges(ctx context.Context, chatRoomID string, limit int) ([]*models.RetentionPurge, error) {
+	query := `
+		SELECT id, chat_room_id, reason, messages, attachments, archived, created_at
+		FROM retention_purges
+		WHERE $1 = '' OR chat_room_id::text = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2`
+
+	rows, err := r.db.QueryContext(ctx, query, chatRoomID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var purges []*models.RetentionPurge
+	for rows.Next() {
+		purge := &models.RetentionPurge{}
+		err := rows.Scan(
+			&purge.ID,
+			&purge.ChatRoomID,
+			&purge.Reason,
+			&purge.Messages,
+			&purge.Attachments,
+			&purge.Archived,
+			&purge.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		purges = append(purges, purge)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return purges, nil
+}
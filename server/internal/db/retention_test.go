@@ -0,0 +1,199 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"chatgo/server/internal/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository_GetRetentionPolicy(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+	updatedAt := time.Now()
+
+	mock.ExpectQuery("SELECT chat_room_id, max_age_days, max_messages, legal_hold, updated_at FROM retention_policies WHERE chat_room_id = \\$1").
+		WithArgs("1").
+		WillReturnRows(sqlmock.NewRows([]string{"chat_room_id", "max_age_days", "max_messages", "legal_hold", "updated_at"}).
+			AddRow("1", 90, nil, true, updatedAt))
+	mock.ExpectQuery("SELECT (.+) FROM retention_policies").
+		WithArgs("2").
+		WillReturnError(sql.ErrNoRows)
+
+	policy, err := repo.GetRetentionPolicy(context.Background(), "1")
+	assert.NoError(t, err)
+	assert.Equal(t, &models.RetentionPolicy{
+		ChatRoomID: "1",
+		MaxAgeDays: sql.NullInt64{Int64: 90, Valid: true},
+		LegalHold:  true,
+		UpdatedAt:  updatedAt,
+	}, policy)
+
+	policy, err = repo.GetRetentionPolicy(context.Background(), "2")
+	assert.NoError(t, err)
+	assert.Nil(t, policy)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_SetRetentionLimits(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+
+	mock.ExpectExec("INSERT INTO retention_policies \\(chat_room_id, max_age_days, max_messages, updated_at\\) (.+) ON CONFLICT \\(chat_room_id\\) DO UPDATE SET max_age_days = EXCLUDED.max_age_days, max_messages = EXCLUDED.max_messages").
+		WithArgs("1", sql.NullInt64{Int64: 30, Valid: true}, sql.NullInt64{}).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO retention_policies \\(chat_room_id, legal_hold, updated_at\\) (.+) SET legal_hold = EXCLUDED.legal_hold").
+		WithArgs("1", true).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err = repo.SetRetentionLimits(context.Background(), &models.RetentionPolicy{
+		ChatRoomID: "1",
+		MaxAgeDays: sql.NullInt64{Int64: 30, Valid: true},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, repo.SetLegalHold(context.Background(), "1", true))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_GetExpiredMessageIDs(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+	before := time.Now().AddDate(0, 0, -90)
+
+	mock.ExpectQuery("SELECT id FROM messages WHERE chat_room_id = \\$1 AND parent_id IS NULL AND COALESCE\\(last_reply_at, created_at\\) < \\$2 AND chat_room_id NOT IN \\(SELECT chat_room_id FROM retention_policies WHERE legal_hold\\)").
+		WithArgs("1", before, 100).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("4").AddRow("7"))
+	mock.ExpectQuery("SELECT id FROM messages (.+) ORDER BY created_at DESC, id DESC OFFSET \\$2 LIMIT \\$3").
+		WithArgs("1", 10000, 100).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	ids, err := repo.GetExpiredMessageIDs(context.Background(), "1", before, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"4", "7"}, ids)
+
+	ids, err = repo.GetOverflowMessageIDs(context.Background(), "1", 10000, 100)
+	assert.NoError(t, err)
+	assert.Empty(t, ids)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_PurgeMessages(t *testing.T) {
+	attachmentRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "chat_room_id", "uploader_id", "message_id", "filename", "content_type", "size", "storage_key", "key_version", "created_at"}).
+			AddRow("9", "1", "2", "5", "notes.txt", "text/plain", 5, "rooms/1/abc", 1, time.Now())
+	}
+
+	testCases := []struct {
+		name             string
+		archive          bool
+		attachmentsQuery string
+		messagesQuery    string
+	}{
+		{
+			name:             "Delete",
+			attachmentsQuery: "^DELETE FROM attachments WHERE message_id IN \\( SELECT id FROM messages WHERE \\(id = ANY\\(\\$1\\) OR parent_id = ANY\\(\\$1\\)\\) AND chat_room_id NOT IN",
+			messagesQuery:    "^DELETE FROM messages WHERE id IN \\( SELECT id FROM messages (.+)\\) RETURNING id, sender_id",
+		},
+		{
+			name:             "Archive",
+			archive:          true,
+			attachmentsQuery: "WITH moved AS \\(DELETE FROM attachments (.+)\\) INSERT INTO archived_attachments",
+			messagesQuery:    "WITH moved AS \\(DELETE FROM messages (.+) RETURNING \\*\\) INSERT INTO archived_messages (.+) RETURNING id, sender_id",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := MockDB(t)
+			if err != nil {
+				t.Fatalf("Error creating mock DB: %v", err)
+			}
+			defer db.Close()
+
+			repo := &repository{db: db}
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(tc.attachmentsQuery).
+				WithArgs(pq.Array([]string{"4"})).
+				WillReturnRows(attachmentRows())
+			mock.ExpectQuery(tc.messagesQuery).
+				WithArgs(pq.Array([]string{"4"})).
+				WillReturnRows(sqlmock.NewRows(messageTestColumns).
+					AddRow("4", "1", "1", "root", nil, 1, time.Now(), time.Now(), time.Now(), false, 1, nil).
+					AddRow("5", "2", "1", "reply", "4", 0, nil, time.Now(), time.Now(), false, 1, nil))
+			mock.ExpectCommit()
+
+			purged, err := repo.PurgeMessages(context.Background(), []string{"4"}, tc.archive)
+
+			assert.NoError(t, err)
+			assert.Len(t, purged.Messages, 2)
+			assert.Equal(t, "5", purged.Messages[1].ID)
+			assert.Len(t, purged.Attachments, 1)
+			assert.Equal(t, "rooms/1/abc", purged.Attachments[0].StorageKey)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestRepository_RetentionPurges(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+	createdAt := time.Now()
+
+	mock.ExpectQuery("INSERT INTO retention_purges (.+) RETURNING id, created_at").
+		WithArgs("1", models.PurgeReasonMaxAge, 12, 1, false).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow("3", createdAt))
+	mock.ExpectQuery("SELECT (.+) FROM retention_purges WHERE \\$1 = '' OR chat_room_id::text = \\$1 ORDER BY created_at DESC, id DESC LIMIT \\$2").
+		WithArgs("", 50).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "chat_room_id", "reason", "messages", "attachments", "archived", "created_at"}).
+			AddRow("3", "1", models.PurgeReasonMaxAge, 12, 1, false, createdAt))
+
+	purge := &models.RetentionPurge{ChatRoomID: "1", Reason: models.PurgeReasonMaxAge, Messages: 12, Attachments: 1}
+	assert.NoError(t, repo.CreateRetentionPurge(context.Background(), purge))
+	assert.Equal(t, "3", purge.ID)
+
+	purges, err := repo.GetRetentionPurges(context.Background(), "", 50)
+	assert.NoError(t, err)
+	assert.Equal(t, []*models.RetentionPurge{purge}, purges)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
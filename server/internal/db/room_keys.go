@@ -0,0 +1,101 @@
+package db
+
+import (
+	"chatgo/server/internal/models"
+	"context"
+	"database/sql"
+)
+
+// GetRoomKeys получает все версии ключа чата в порядке возрастания версии
+func (r *repository) GetRoomKeys(ctx context.Context, chatRoomID string) ([]*models.RoomKey, error) {
+	query := `SELECT chat_room_id, version, wrapped_key, created_at
+			FROM room_keys
+			WHERE chat_room_id = $1
+			ORDER BY version`
+
+	rows, err := r.db.QueryContext(ctx, query, chatRoomID)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanRoomKeys(rows)
+}
+
+// GetAllRoomKeys получает все версии ключей всех чатов
+func (r *repository) GetAllRoomKeys(ctx context.Context) ([]*models.RoomKey, error) {
+	query := `SELECT chat_room_id, version, wrapped_key, created_at
+			FROM room_keys
+			ORDER BY chat_room_id, version`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanRoomKeys(rows)
+}
+
+// CreateRoomKey добавляет новую версию ключа чата. Если такая версия уже создана
+// другим процессом, возвращает false
+func (r *repository) CreateRoomKey(ctx context.Context, key *models.RoomKey) (bool, error) {
+	query := `INSERT INTO room_keys (chat_room_id, version, wrapped_key, created_at)
+			VALUES ($1, $2, $3, CURRENT_TIMESTAMP)
+			ON CONFLICT (chat_room_id, version) DO NOTHING`
+
+	res, err := r.db.ExecContext(ctx, query, key.ChatRoomID, key.Version, key.WrappedKey)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// UpdateWrappedKeys в одной транзакции заменяет зашифрованные мастер-ключом значения ключей
+// чатов и TOTP-секретов, чтобы после смены мастер-ключа не остались секреты под старым ключом.
+// Используется при смене мастер-ключа
+func (r *repository) UpdateWrappedKeys(ctx context.Context, keys []*models.RoomKey, totps []*models.TOTP) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE room_keys SET wrapped_key = $1 WHERE chat_room_id = $2 AND version = $3`
+	for _, key := range keys {
+		if _, err := tx.ExecContext(ctx, query, key.WrappedKey, key.ChatRoomID, key.Version); err != nil {
+			return err
+		}
+	}
+
+	query = `UPDATE user_totp SET encrypted_secret = $1 WHERE user_id = $2`
+	for _, totp := range totps {
+		if _, err := tx.ExecContext(ctx, query, totp.EncryptedSecret, totp.UserID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func scanRoomKeys(rows *sql.Rows) ([]*models.RoomKey, error) {
+	defer rows.Close()
+
+	var keys []*models.RoomKey
+	for rows.Next() {
+		key := &models.RoomKey{}
+		if err := rows.Scan(&key.ChatRoomID, &key.Version, &key.WrappedKey, &key.CreatedAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
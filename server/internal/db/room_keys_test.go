@@ -0,0 +1,152 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"chatgo/server/internal/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository_GetRoomKeys(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+
+	mock.ExpectQuery("SELECT (.+) FROM room_keys WHERE chat_room_id = \\$1 ORDER BY version").
+		WithArgs("5").
+		WillReturnRows(sqlmock.NewRows([]string{"chat_room_id", "version", "wrapped_key", "created_at"}).
+			AddRow("5", 1, "wrapped1", time.Now()).
+			AddRow("5", 2, "wrapped2", time.Now()))
+
+	keys, err := repo.GetRoomKeys(context.Background(), "5")
+
+	assert.NoError(t, err)
+	assert.Len(t, keys, 2)
+	assert.Equal(t, 2, keys[1].Version)
+	assert.Equal(t, "wrapped2", keys[1].WrappedKey)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_CreateRoomKey(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+	key := &models.RoomKey{ChatRoomID: "5", Version: 2, WrappedKey: "wrapped"}
+
+	mock.ExpectExec("INSERT INTO room_keys (.+) ON CONFLICT \\(chat_room_id, version\\) DO NOTHING").
+		WithArgs("5", 2, "wrapped").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO room_keys").
+		WithArgs("5", 2, "wrapped").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	created, err := repo.CreateRoomKey(context.Background(), key)
+	assert.NoError(t, err)
+	assert.True(t, created)
+
+	created, err = repo.CreateRoomKey(context.Background(), key)
+	assert.NoError(t, err)
+	assert.False(t, created)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_UpdateWrappedKeys(t *testing.T) {
+	keys := []*models.RoomKey{
+		{ChatRoomID: "5", Version: 1, WrappedKey: "new1"},
+		{ChatRoomID: "6", Version: 1, WrappedKey: "new2"},
+	}
+	totps := []*models.TOTP{{UserID: "1", EncryptedSecret: "resealed1"}}
+
+	testCases := []struct {
+		name        string
+		mockSetup   func(mock sqlmock.Sqlmock)
+		expectError bool
+	}{
+		{
+			name: "Successfully rewrap keys and TOTP secrets",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				for _, key := range keys {
+					mock.ExpectExec("UPDATE room_keys SET wrapped_key = \\$1 WHERE chat_room_id = \\$2 AND version = \\$3").
+						WithArgs(key.WrappedKey, key.ChatRoomID, key.Version).
+						WillReturnResult(sqlmock.NewResult(0, 1))
+				}
+				mock.ExpectExec("UPDATE user_totp SET encrypted_secret = \\$1 WHERE user_id = \\$2").
+					WithArgs("resealed1", "1").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "Rollback when a TOTP secret fails",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				for _, key := range keys {
+					mock.ExpectExec("UPDATE room_keys").
+						WithArgs(key.WrappedKey, key.ChatRoomID, key.Version).
+						WillReturnResult(sqlmock.NewResult(0, 1))
+				}
+				mock.ExpectExec("UPDATE user_totp").
+					WithArgs("resealed1", "1").
+					WillReturnError(sql.ErrConnDone)
+				mock.ExpectRollback()
+			},
+			expectError: true,
+		},
+		{
+			name: "Rollback on error",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE room_keys").
+					WithArgs("new1", "5", 1).
+					WillReturnError(sql.ErrConnDone)
+				mock.ExpectRollback()
+			},
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := MockDB(t)
+			if err != nil {
+				t.Fatalf("Error creating mock DB: %v", err)
+			}
+			defer db.Close()
+
+			repo := &repository{db: db}
+			tc.mockSetup(mock)
+
+			err = repo.UpdateWrappedKeys(context.Background(), keys, totps)
+
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
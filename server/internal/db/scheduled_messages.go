@@ -0,0 +1,192 @@
+package db
+
+import (
+	"chatgo/server/internal/models"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const scheduledMessageColumns = `
+			id,
+			sender_id,
+			chat_room_id,
+			encrypted_content,
+			key_version,
+			send_at,
+			status,
+			message_id,
+			created_at`
+
+func scanScheduledMessage(row rowScanner, message *models.ScheduledMessage) error {
+	return row.Scan(
+		&message.ID,
+		&message.SenderID,
+		&message.ChatRoomID,
+		&message.EncryptedContent,
+		&message.KeyVersion,
+		&message.SendAt,
+		&message.Status,
+		&message.MessageID,
+		&message.CreatedAt,
+	)
+}
+
+// CreateScheduledMessage сохраняет сообщение, которое нужно отправить в SendAt
+func (r *repository) CreateScheduledMessage(ctx context.Context, message *models.ScheduledMessage) (*models.ScheduledMessage, error) {
+	query := `
+		INSERT INTO scheduled_messages (sender_id, chat_room_id, encrypted_content, key_version, send_at, status, created_at)
+		VALUES ($1, $2, $3, $4, $5, 'pending', CURRENT_TIMESTAMP)
+		RETURNING` + scheduledMessageColumns
+
+	err := scanScheduledMessage(r.db.QueryRowContext(ctx, query,
+		message.SenderID,
+		message.ChatRoomID,
+		message.EncryptedContent,
+		message.KeyVersion,
+		message.SendAt,
+	), message)
+	if err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// GetPendingScheduledMessages возвращает ещё не отправленные сообщения пользователя в порядке отправки.
+// Если chatRoomID пуст, возвращаются сообщения во все чаты
+func (r *repository) GetPendingScheduledMessages(ctx context.Context, senderID, chatRoomID string) ([]*models.ScheduledMessage, error) {
+	query := `
+		SELECT` + scheduledMessageColumns + `
+		FROM scheduled_messages
+		WHERE sender_id = $1 AND status = 'pending' AND ($2 = '' OR chat_room_id::text = $2)
+		ORDER BY send_at, id`
+
+	rows, err := r.db.QueryContext(ctx, query, senderID, chatRoomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []*models.ScheduledMessage
+	for rows.Next() {
+		var message models.ScheduledMessage
+		if err := scanScheduledMessage(rows, &message); err != nil {
+			return nil, err
+		}
+		messages = append(messages, &message)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// CancelScheduledMessage отменяет ещё не отправленное сообщение автора. Возвращает false, если
+// такого сообщения нет, его отправил другой пользователь или оно уже отправлено
+func (r *repository) CancelScheduledMessage(ctx context.Context, id, senderID string) (bool, error) {
+	res, err := r.db.ExecContext(ctx,
+		"UPDATE scheduled_messages SET status = 'cancelled' WHERE id = $1 AND sender_id = $2 AND status = 'pending'",
+		id, senderID)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// DeliverScheduledMessages в одной транзакции превращает до limit отложенных сообщений, время которых
+// наступило к now, в обычные сообщения и отмечает их отправленными. Строки блокируются с SKIP LOCKED,
+// поэтому каждое сообщение отправляется ровно один раз, даже если серверов несколько. Для чатов
+// с исчезающими сообщениями expires_at отсчитывается от момента отправки. Сообщения пользователей,
+// которые больше не состоят в чате, не отправляются, а отменяются
+func (r *repository) DeliverScheduledMessages(ctx context.Context, now time.Time, limit int) ([]*models.Message, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT`+scheduledMessageColumns+`
+		FROM scheduled_messages
+		WHERE status = 'pending' AND send_at <= $1
+		ORDER BY send_at, id
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED`, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	var due []*models.ScheduledMessage
+	for rows.Next() {
+		var scheduled models.ScheduledMessage
+		if err := scanScheduledMessage(rows, &scheduled); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		due = append(due, &scheduled)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	messages := make([]*models.Message, 0, len(due))
+	for _, scheduled := range due {
+		var message models.Message
+		err = scanMessage(tx.QueryRowContext(ctx, `
+			INSERT INTO messages (
+				sender_id,
+				chat_room_id,
+				encrypted_content,
+				key_version,
+				created_at,
+				updated_at,
+				is_edited,
+				expires_at
+			)
+			SELECT $1, chat_rooms.id, $3, $4, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, false,
+				CASE WHEN chat_rooms.message_ttl > 0 THEN CURRENT_TIMESTAMP + chat_rooms.message_ttl * INTERVAL '1 second' END
+			FROM chat_rooms
+			JOIN chat_room_members ON chat_room_members.chat_room_id = chat_rooms.id
+				AND chat_room_members.user_id = $1
+			WHERE chat_rooms.id = $2
+			RETURNING`+messageColumns,
+			scheduled.SenderID,
+			scheduled.ChatRoomID,
+			scheduled.EncryptedContent,
+			scheduled.KeyVersion,
+		), &message)
+		if errors.Is(err, sql.ErrNoRows) {
+			_, err = tx.ExecContext(ctx,
+				"UPDATE scheduled_messages SET status = 'cancelled' WHERE id = $1", scheduled.ID)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = tx.ExecContext(ctx,
+			"UPDATE scheduled_messages SET status = 'sent', message_id = $1 WHERE id = $2",
+			message.ID, scheduled.ID)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, &message)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
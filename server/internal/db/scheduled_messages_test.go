@@ -0,0 +1,157 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"chatgo/server/internal/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+var scheduledMessageTestColumns = []string{"id", "sender_id", "chat_room_id", "encrypted_content", "key_version", "send_at", "status", "message_id", "created_at"}
+
+func TestRepository_CreateScheduledMessage(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+	sendAt := time.Now().Add(time.Hour)
+	message := &models.ScheduledMessage{SenderID: "2", ChatRoomID: "1", EncryptedContent: "ciphertext", KeyVersion: 1, SendAt: sendAt}
+
+	mock.ExpectQuery("INSERT INTO scheduled_messages (.+) RETURNING").
+		WithArgs("2", "1", "ciphertext", 1, sendAt).
+		WillReturnRows(sqlmock.NewRows(scheduledMessageTestColumns).
+			AddRow("5", "2", "1", "ciphertext", 1, sendAt, models.ScheduledPending, nil, time.Now()))
+
+	created, err := repo.CreateScheduledMessage(context.Background(), message)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "5", created.ID)
+	assert.Equal(t, models.ScheduledPending, created.Status)
+	assert.False(t, created.MessageID.Valid)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_GetPendingScheduledMessages(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+	sendAt := time.Now().Add(time.Hour)
+
+	mock.ExpectQuery("SELECT (.+) FROM scheduled_messages WHERE sender_id = \\$1 AND status = 'pending'").
+		WithArgs("2", "").
+		WillReturnRows(sqlmock.NewRows(scheduledMessageTestColumns).
+			AddRow("5", "2", "1", "ciphertext", 1, sendAt, models.ScheduledPending, nil, time.Now()).
+			AddRow("6", "2", "3", "ciphertext", 1, sendAt.Add(time.Hour), models.ScheduledPending, nil, time.Now()))
+
+	messages, err := repo.GetPendingScheduledMessages(context.Background(), "2", "")
+
+	assert.NoError(t, err)
+	assert.Len(t, messages, 2)
+	assert.Equal(t, "3", messages[1].ChatRoomID)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_CancelScheduledMessage(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+
+	mock.ExpectExec("UPDATE scheduled_messages SET status = 'cancelled' WHERE id = \\$1 AND sender_id = \\$2 AND status = 'pending'").
+		WithArgs("5", "2").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	cancelled, err := repo.CancelScheduledMessage(context.Background(), "5", "2")
+
+	assert.NoError(t, err)
+	assert.False(t, cancelled)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_DeliverScheduledMessages(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+	now := time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM scheduled_messages WHERE status = 'pending' AND send_at <= \\$1 (.+) FOR UPDATE SKIP LOCKED").
+		WithArgs(now, 100).
+		WillReturnRows(sqlmock.NewRows(scheduledMessageTestColumns).
+			AddRow("5", "2", "1", "ciphertext", 1, now.Add(-time.Second), models.ScheduledPending, nil, now.Add(-time.Hour)))
+	mock.ExpectQuery("INSERT INTO messages (.+) SELECT (.+) FROM chat_rooms JOIN chat_room_members (.+) WHERE chat_rooms.id = \\$2 RETURNING").
+		WithArgs("2", "1", "ciphertext", 1).
+		WillReturnRows(sqlmock.NewRows(messageTestColumns).
+			AddRow("40", "2", "1", "ciphertext", nil, 0, nil, now, now, false, 1, nil))
+	mock.ExpectExec("UPDATE scheduled_messages SET status = 'sent', message_id = \\$1 WHERE id = \\$2").
+		WithArgs("40", "5").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	messages, err := repo.DeliverScheduledMessages(context.Background(), now, 100)
+
+	assert.NoError(t, err)
+	assert.Len(t, messages, 1)
+	assert.Equal(t, "40", messages[0].ID)
+	assert.Equal(t, "ciphertext", messages[0].EncryptedContent)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_DeliverScheduledMessages_NotMember(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+	now := time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM scheduled_messages WHERE status = 'pending' AND send_at <= \\$1 (.+) FOR UPDATE SKIP LOCKED").
+		WithArgs(now, 100).
+		WillReturnRows(sqlmock.NewRows(scheduledMessageTestColumns).
+			AddRow("5", "2", "1", "ciphertext", 1, now.Add(-time.Second), models.ScheduledPending, nil, now.Add(-time.Hour)))
+	// The sender left the room, so the join finds no row
+	mock.ExpectQuery("INSERT INTO messages (.+) FROM chat_rooms JOIN chat_room_members (.+) RETURNING").
+		WithArgs("2", "1", "ciphertext", 1).
+		WillReturnRows(sqlmock.NewRows(messageTestColumns))
+	mock.ExpectExec("UPDATE scheduled_messages SET status = 'cancelled' WHERE id = \\$1").
+		WithArgs("5").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	messages, err := repo.DeliverScheduledMessages(context.Background(), now, 100)
+
+	assert.NoError(t, err)
+	assert.Empty(t, messages)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
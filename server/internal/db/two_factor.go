@@ -0,0 +1,178 @@
+package db
+
+import (
+	"chatgo/server/internal/models"
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+const totpColumns = `user_id, encrypted_secret, enabled, last_used_step, created_at, enabled_at`
+
+func scanTOTP(row rowScanner, totp *models.TOTP) error {
+	return row.Scan(
+		&totp.UserID,
+		&totp.EncryptedSecret,
+		&totp.Enabled,
+		&totp.LastUsedStep,
+		&totp.CreatedAt,
+		&totp.EnabledAt,
+	)
+}
+
+// SaveTOTP сохраняет новый, ещё не подтверждённый TOTP-секрет пользователя вместо прежнего
+// неподтверждённого. Если у пользователя уже включён TOTP, секрет не меняется и возвращается false
+func (r *repository) SaveTOTP(ctx context.Context, totp *models.TOTP) (bool, error) {
+	query := `
+		INSERT INTO user_totp (user_id, encrypted_secret)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET encrypted_secret = EXCLUDED.encrypted_secret, last_used_step = 0, created_at = NOW()
+		WHERE user_totp.enabled = FALSE
+		RETURNING ` + totpColumns
+
+	err := scanTOTP(r.db.QueryRowContext(ctx, query, totp.UserID, totp.EncryptedSecret), totp)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// GetTOTP возвращает TOTP-секрет пользователя или nil, если его нет
+func (r *repository) GetTOTP(ctx context.Context, userID string) (*models.TOTP, error) {
+	var totp models.TOTP
+	query := `SELECT ` + totpColumns + ` FROM user_totp WHERE user_id = $1`
+
+	err := scanTOTP(r.db.QueryRowContext(ctx, query, userID), &totp)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &totp, nil
+}
+
+// EnableTOTP в одной транзакции включает подтверждённый кодом шага step TOTP-секрет
+// и заменяет коды восстановления пользователя новыми.
+// Возвращает false, если секрета нет, он уже включён или код этого шага уже использован
+func (r *repository) EnableTOTP(ctx context.Context, userID string, step int64, recoveryCodeHashes []string) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE user_totp
+		SET enabled = TRUE, enabled_at = NOW(), last_used_step = $2
+		WHERE user_id = $1 AND enabled = FALSE AND last_used_step < $2`,
+		userID, step)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if rows == 0 {
+		return false, nil
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO recovery_codes (user_id, code_hash)
+		SELECT $1, unnest($2::text[])`,
+		userID, pq.Array(recoveryCodeHashes)); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// UseTOTPStep запоминает шаг принятого кода. Возвращает false, если код этого или более
+// позднего шага уже использован, то есть код повторяется
+func (r *repository) UseTOTPStep(ctx context.Context, userID string, step int64) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE user_totp
+		SET last_used_step = $2
+		WHERE user_id = $1 AND enabled = TRUE AND last_used_step < $2`,
+		userID, step)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// UseRecoveryCode отмечает код восстановления использованным.
+// Возвращает false, если такого неиспользованного кода у пользователя нет
+func (r *repository) UseRecoveryCode(ctx context.Context, userID, codeHash string) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE recovery_codes
+		SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`,
+		userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// DeleteTOTP удаляет TOTP-секрет и коды восстановления пользователя.
+// Возвращает false, если секрета не было
+func (r *repository) DeleteTOTP(ctx context.Context, userID string) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return false, err
+	}
+	result, err := tx.ExecContext(ctx, `DELETE FROM user_totp WHERE user_id = $1`, userID)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, tx.Commit()
+}
+
+// GetAllTOTP возвращает TOTP-секреты всех пользователей, чтобы перешифровать их новым мастер-ключом
+func (r *repository) GetAllTOTP(ctx context.Context) ([]*models.TOTP, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+totpColumns+` FROM user_totp ORDER BY user_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var totps []*models.TOTP
+	for rows.Next() {
+		var totp models.TOTP
+		if err := scanTOTP(rows, &totp); err != nil {
+			return nil, err
+		}
+		totps = append(totps, &totp)
+	}
+	return totps, rows.Err()
+}
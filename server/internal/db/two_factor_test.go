@@ -0,0 +1,228 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"chatgo/server/internal/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+var totpTestColumns = []string{"user_id", "encrypted_secret", "enabled", "last_used_step", "created_at", "enabled_at"}
+
+func TestRepository_SaveTOTP(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+
+	mock.ExpectQuery("INSERT INTO user_totp (.+) ON CONFLICT \\(user_id\\) DO UPDATE (.+) WHERE user_totp.enabled = FALSE").
+		WithArgs("1", "sealed").
+		WillReturnRows(sqlmock.NewRows(totpTestColumns).AddRow("1", "sealed", false, 0, time.Now(), nil))
+	mock.ExpectQuery("INSERT INTO user_totp").
+		WithArgs("2", "sealed").
+		WillReturnError(sql.ErrNoRows)
+
+	saved, err := repo.SaveTOTP(context.Background(), &models.TOTP{UserID: "1", EncryptedSecret: "sealed"})
+	assert.NoError(t, err)
+	assert.True(t, saved)
+
+	// The secret of a user with TOTP enabled is kept
+	saved, err = repo.SaveTOTP(context.Background(), &models.TOTP{UserID: "2", EncryptedSecret: "sealed"})
+	assert.NoError(t, err)
+	assert.False(t, saved)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_GetTOTP(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+
+	mock.ExpectQuery("SELECT (.+) FROM user_totp WHERE user_id = \\$1").
+		WithArgs("1").
+		WillReturnRows(sqlmock.NewRows(totpTestColumns).AddRow("1", "sealed", true, 5, time.Now(), time.Now()))
+	mock.ExpectQuery("SELECT (.+) FROM user_totp").
+		WithArgs("2").
+		WillReturnError(sql.ErrNoRows)
+
+	totp, err := repo.GetTOTP(context.Background(), "1")
+	assert.NoError(t, err)
+	assert.True(t, totp.Enabled)
+	assert.Equal(t, int64(5), totp.LastUsedStep)
+
+	totp, err = repo.GetTOTP(context.Background(), "2")
+	assert.NoError(t, err)
+	assert.Nil(t, totp)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_EnableTOTP(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+	hashes := []string{"hash1", "hash2"}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE user_totp SET enabled = TRUE, enabled_at = NOW\\(\\), last_used_step = \\$2 WHERE user_id = \\$1 AND enabled = FALSE AND last_used_step < \\$2").
+		WithArgs("1", int64(100)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM recovery_codes WHERE user_id = \\$1").
+		WithArgs("1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO recovery_codes \\(user_id, code_hash\\) SELECT \\$1, unnest\\(\\$2::text\\[\\]\\)").
+		WithArgs("1", pq.Array(hashes)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE user_totp").
+		WithArgs("1", int64(100)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	enabled, err := repo.EnableTOTP(context.Background(), "1", 100, hashes)
+	assert.NoError(t, err)
+	assert.True(t, enabled)
+
+	enabled, err = repo.EnableTOTP(context.Background(), "1", 100, hashes)
+	assert.NoError(t, err)
+	assert.False(t, enabled)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_UseTOTPStep(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+
+	mock.ExpectExec("UPDATE user_totp SET last_used_step = \\$2 WHERE user_id = \\$1 AND enabled = TRUE AND last_used_step < \\$2").
+		WithArgs("1", int64(101)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE user_totp SET last_used_step").
+		WithArgs("1", int64(101)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	used, err := repo.UseTOTPStep(context.Background(), "1", 101)
+	assert.NoError(t, err)
+	assert.True(t, used)
+
+	// The same code can't be used twice
+	used, err = repo.UseTOTPStep(context.Background(), "1", 101)
+	assert.NoError(t, err)
+	assert.False(t, used)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_UseRecoveryCode(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+
+	mock.ExpectExec("UPDATE recovery_codes SET used_at = NOW\\(\\) WHERE user_id = \\$1 AND code_hash = \\$2 AND used_at IS NULL").
+		WithArgs("1", "hash1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE recovery_codes").
+		WithArgs("1", "hash1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	used, err := repo.UseRecoveryCode(context.Background(), "1", "hash1")
+	assert.NoError(t, err)
+	assert.True(t, used)
+
+	used, err = repo.UseRecoveryCode(context.Background(), "1", "hash1")
+	assert.NoError(t, err)
+	assert.False(t, used)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_DeleteTOTP(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM recovery_codes WHERE user_id = \\$1").
+		WithArgs("1").
+		WillReturnResult(sqlmock.NewResult(0, 10))
+	mock.ExpectExec("DELETE FROM user_totp WHERE user_id = \\$1").
+		WithArgs("1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	deleted, err := repo.DeleteTOTP(context.Background(), "1")
+	assert.NoError(t, err)
+	assert.True(t, deleted)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_GetAllTOTP(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+
+	mock.ExpectQuery("SELECT (.+) FROM user_totp ORDER BY user_id").
+		WillReturnRows(sqlmock.NewRows(totpTestColumns).
+			AddRow("1", "sealed1", true, 5, time.Now(), time.Now()).
+			AddRow("2", "sealed2", false, 0, time.Now(), nil))
+
+	totps, err := repo.GetAllTOTP(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, totps, 2)
+	assert.Equal(t, "sealed1", totps[0].EncryptedSecret)
+	assert.Equal(t, "2", totps[1].UserID)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,51 @@
+package db
+
+import (
+	"chatgo/server/internal/models"
+	"context"
+)
+
+// UpsertUserKey сохраняет открытый ключ пользователя, заменяя ранее опубликованный
+func (r *repository) UpsertUserKey(ctx context.Context, key *models.UserKey) error {
+	query := `
+		INSERT INTO user_keys (user_id, public_key, updated_at)
+		VALUES ($1, $2, CURRENT_TIMESTAMP)
+		ON CONFLICT (user_id) DO UPDATE
+		SET public_key = EXCLUDED.public_key, updated_at = EXCLUDED.updated_at`
+
+	_, err := r.db.ExecContext(ctx, query, key.UserID, key.PublicKey)
+	return err
+}
+
+// GetUserKeysByChatRoomID получает открытые ключи участников чата. Участники,
+// не опубликовавшие ключ, в результат не попадают
+func (r *repository) GetUserKeysByChatRoomID(ctx context.Context, chatRoomID string) ([]*models.UserKey, error) {
+	query := `
+		SELECT uk.user_id, u.username, uk.public_key, uk.updated_at
+		FROM chat_room_members crm
+		JOIN user_keys uk ON uk.user_id = crm.user_id
+		JOIN users u ON u.id = crm.user_id
+		WHERE crm.chat_room_id = $1
+		ORDER BY uk.user_id`
+
+	rows, err := r.db.QueryContext(ctx, query, chatRoomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*models.UserKey
+	for rows.Next() {
+		key := &models.UserKey{}
+		if err := rows.Scan(&key.UserID, &key.Username, &key.PublicKey, &key.UpdatedAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,60 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"chatgo/server/internal/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository_UpsertUserKey(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+
+	mock.ExpectExec("INSERT INTO user_keys (.+) ON CONFLICT \\(user_id\\) DO UPDATE").
+		WithArgs("1", "cHVibGlj").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err = repo.UpsertUserKey(context.Background(), &models.UserKey{UserID: "1", PublicKey: "cHVibGlj"})
+
+	assert.NoError(t, err)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_GetUserKeysByChatRoomID(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+
+	mock.ExpectQuery("SELECT (.+) FROM chat_room_members crm JOIN user_keys uk (.+) WHERE crm.chat_room_id = \\$1").
+		WithArgs("5").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "username", "public_key", "updated_at"}).
+			AddRow("1", "alice", "a2V5MQ==", time.Now()).
+			AddRow("2", "bob", "a2V5Mg==", time.Now()))
+
+	keys, err := repo.GetUserKeysByChatRoomID(context.Background(), "5")
+
+	assert.NoError(t, err)
+	assert.Len(t, keys, 2)
+	assert.Equal(t, "bob", keys[1].Username)
+	assert.Equal(t, "a2V5Mg==", keys[1].PublicKey)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
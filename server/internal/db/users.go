@@ -2,66 +2,96 @@ package db
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"chatgo/server/internal/models"
+
+	"github.com/lib/pq"
 )
 
-// CreateUser добавляет нового пользователя в базу данных, устанавливает created_at и last_login CURRENT_TIMESTAMP
-func (r *repository) CreateUser(ctx context.Context, user *models.User) (*models.User, error) {
-	query := `
-		INSERT INTO users(
-			username, 
+const userColumns = `
+			id,
+			username,
 			encrypted_password,
 			created_at,
 			last_login,
-			status
-		) VALUES ($1, $2, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, $3) 
-		RETURNING id, username, encrypted_password, created_at, last_login, status`
+			last_seen_at,
+			status,
+			is_bot,
+			last_login_ip,
+			failed_logins,
+			locked_until,
+			token_version,
+			display_name,
+			bio,
+			avatar_attachment_id,
+			timezone,
+			status_text`
 
-	err := r.db.QueryRowContext(
-		ctx,
-		query,
-		user.Username,
-		user.EncryptedPassword,
-		user.Status,
-	).Scan(
+// scanUser считывает строку с набором столбцов userColumns в пользователя
+func scanUser(row rowScanner, user *models.User) error {
+	return row.Scan(
 		&user.ID,
 		&user.Username,
 		&user.EncryptedPassword,
 		&user.CreatedAt,
 		&user.LastLogin,
+		&user.LastSeenAt,
 		&user.Status,
+		&user.IsBot,
+		&user.LastLoginIP,
+		&user.FailedLogins,
+		&user.LockedUntil,
+		&user.TokenVersion,
+		&user.DisplayName,
+		&user.Bio,
+		&user.AvatarID,
+		&user.Timezone,
+		&user.StatusText,
 	)
-	if err != nil {
+}
+
+// CreateUser добавляет нового пользователя в базу данных, устанавливает created_at и last_login CURRENT_TIMESTAMP
+func (r *repository) CreateUser(ctx context.Context, user *models.User) (*models.User, error) {
+	if err := insertUser(ctx, r.db, user); err != nil {
 		return nil, err
 	}
 
 	return user, nil
 }
 
-// GetUserByUsername получает пользователя по его username
+// insertUser добавляет пользователя и заполняет его столбцы из базы
+func insertUser(ctx context.Context, db queryer, user *models.User) error {
+	query := `
+		INSERT INTO users(
+			username,
+			encrypted_password,
+			created_at,
+			last_login,
+			status
+		) VALUES ($1, $2, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, $3)
+		RETURNING ` + userColumns
+
+	row := db.QueryRowContext(
+		ctx,
+		query,
+		user.Username,
+		user.EncryptedPassword,
+		user.Status,
+	)
+	return scanUser(row, user)
+}
+
+// GetUserByUsername получает пользователя по его username без учёта регистра
 func (r *repository) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
 	user := models.User{}
 	query := `
-		SELECT 
-			id, 
-			username, 
-			encrypted_password, 
-			created_at, 
-			last_login, 
-			status 
-		FROM users 
-		WHERE username = $1`
-
-	err := r.db.QueryRowContext(ctx, query, username).Scan(
-		&user.ID,
-		&user.Username,
-		&user.EncryptedPassword,
-		&user.CreatedAt,
-		&user.LastLogin,
-		&user.Status,
-	)
-	if err != nil {
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE LOWER(username) = LOWER($1)`
+
+	if err := scanUser(r.db.QueryRowContext(ctx, query, username), &user); err != nil {
 		return nil, err
 	}
 
@@ -72,41 +102,21 @@ func (r *repository) GetUserByUsername(ctx context.Context, username string) (*m
 func (r *repository) GetUserByID(ctx context.Context, id string) (*models.User, error) {
 	var user models.User
 	query := `
-		SELECT 
-			id, 
-			username, 
-			encrypted_password, 
-			created_at, 
-			last_login, 
-			status 
-		FROM users 
+		SELECT ` + userColumns + `
+		FROM users
 		WHERE id = $1`
 
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&user.ID,
-		&user.Username,
-		&user.EncryptedPassword,
-		&user.CreatedAt,
-		&user.LastLogin,
-		&user.Status,
-	)
-	if err != nil {
+	if err := scanUser(r.db.QueryRowContext(ctx, query, id), &user); err != nil {
 		return nil, err
 	}
 
-	return &user, err
+	return &user, nil
 }
 
 // GetAllUsers возвращает всех пользователей
 func (r *repository) GetAllUsers(ctx context.Context) ([]*models.User, error) {
 	query := `
-		SELECT 
-			id, 
-			username, 
-			encrypted_password, 
-			created_at, 
-			last_login, 
-			status 
+		SELECT ` + userColumns + `
 		FROM users`
 
 	rows, err := r.db.QueryContext(ctx, query)
@@ -118,14 +128,7 @@ func (r *repository) GetAllUsers(ctx context.Context) ([]*models.User, error) {
 	var users []*models.User
 	for rows.Next() {
 		var user models.User
-		if err = rows.Scan(
-			&user.ID,
-			&user.Username,
-			&user.EncryptedPassword,
-			&user.CreatedAt,
-			&user.LastLogin,
-			&user.Status,
-		); err != nil {
+		if err = scanUser(rows, &user); err != nil {
 			return nil, err
 		}
 		users = append(users, &user)
@@ -137,3 +140,239 @@ func (r *repository) GetAllUsers(ctx context.Context) ([]*models.User, error) {
 
 	return users, nil
 }
+
+// GetUsersByIDs возвращает пользователей с указанными ID, несуществующие ID пропускаются
+func (r *repository) GetUsersByIDs(ctx context.Context, ids []string) ([]*models.User, error) {
+	query := `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE id = ANY($1)`
+
+	rows, err := r.db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*models.User
+	for rows.Next() {
+		var user models.User
+		if err = scanUser(rows, &user); err != nil {
+			return nil, err
+		}
+		users = append(users, &user)
+	}
+
+	return users, rows.Err()
+}
+
+// UpdateUserProfile сохраняет поля профиля пользователя
+func (r *repository) UpdateUserProfile(ctx context.Context, user *models.User) error {
+	query := `
+		UPDATE users
+		SET display_name = $2, bio = $3, avatar_attachment_id = $4, timezone = $5, status_text = $6
+		WHERE id = $1`
+
+	_, err := r.db.ExecContext(ctx, query, user.ID, user.DisplayName, user.Bio, user.AvatarID, user.Timezone, user.StatusText)
+	return err
+}
+
+// UpdateUserStatus обновляет статус присутствия пользователя и время last_seen_at.
+// Статус заблокированного пользователя не меняется, в этом случае возвращается false
+func (r *repository) UpdateUserStatus(ctx context.Context, userID string, status models.UserStatus) (bool, error) {
+	query := `
+		UPDATE users
+		SET status = $1, last_seen_at = CURRENT_TIMESTAMP
+		WHERE id = $2 AND status <> 'banned'`
+
+	result, err := r.db.ExecContext(ctx, query, status, userID)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, nil
+}
+
+// UpdateLastLogin запоминает время и адрес успешного входа и сбрасывает счётчик неудачных входов
+func (r *repository) UpdateLastLogin(ctx context.Context, userID, ip string) error {
+	query := `
+		UPDATE users
+		SET last_login = CURRENT_TIMESTAMP, last_login_ip = $2, failed_logins = 0, locked_until = NULL
+		WHERE id = $1`
+
+	_, err := r.db.ExecContext(ctx, query, userID, ip)
+	return err
+}
+
+// RecordFailedLogin увеличивает счётчик неудачных входов пользователя и возвращает его новое значение
+func (r *repository) RecordFailedLogin(ctx context.Context, userID string) (int, error) {
+	var failures int
+	query := `UPDATE users SET failed_logins = failed_logins + 1 WHERE id = $1 RETURNING failed_logins`
+
+	if err := r.db.QueryRowContext(ctx, query, userID).Scan(&failures); err != nil {
+		return 0, err
+	}
+	return failures, nil
+}
+
+// LockUser запрещает вход пользователя до until
+func (r *repository) LockUser(ctx context.Context, userID string, until time.Time) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE users SET locked_until = $2 WHERE id = $1", userID, until)
+	return err
+}
+
+// UnlockUser снимает блокировку входа и сбрасывает счётчик неудачных входов.
+// Возвращает false, если пользователь не найден
+func (r *repository) UnlockUser(ctx context.Context, userID string) (bool, error) {
+	result, err := r.db.ExecContext(ctx, "UPDATE users SET failed_logins = 0, locked_until = NULL WHERE id = $1", userID)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, nil
+}
+
+// CreateLoginAttempt добавляет попытку входа в историю входов пользователя
+func (r *repository) CreateLoginAttempt(ctx context.Context, attempt *models.LoginAttempt) error {
+	query := `
+		INSERT INTO login_attempts (user_id, ip, user_agent, success, reason)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`
+
+	return r.db.QueryRowContext(
+		ctx,
+		query,
+		attempt.UserID,
+		attempt.IP,
+		attempt.UserAgent,
+		attempt.Success,
+		attempt.Reason,
+	).Scan(&attempt.ID, &attempt.CreatedAt)
+}
+
+// GetLoginAttempts возвращает последние limit попыток входа пользователя, новые первыми
+func (r *repository) GetLoginAttempts(ctx context.Context, userID string, limit int) ([]*models.LoginAttempt, error) {
+	query := `
+		SELECT id, user_id, ip, user_agent, success, reason, created_at
+		FROM login_attempts
+		WHERE user_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2`
+
+	rows, err := r.db.QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attempts []*models.LoginAttempt
+	for rows.Next() {
+		var attempt models.LoginAttempt
+		if err := rows.Scan(
+			&attempt.ID,
+			&attempt.UserID,
+			&attempt.IP,
+			&attempt.UserAgent,
+			&attempt.Success,
+			&attempt.Reason,
+			&attempt.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, &attempt)
+	}
+
+	return attempts, rows.Err()
+}
+
+// UpdatePasswordHash заменяет хеш пароля хешем того же пароля, например с большей стоимостью bcrypt.
+// Токены доступа при этом не отзываются
+func (r *repository) UpdatePasswordHash(ctx context.Context, userID, passwordHash string) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE users SET encrypted_password = $2 WHERE id = $1", userID, passwordHash)
+	return err
+}
+
+// ChangePassword меняет пароль пользователя и отзывает все его токены доступа.
+// Возвращает новую версию токенов
+func (r *repository) ChangePassword(ctx context.Context, userID, passwordHash string) (int, error) {
+	var version int
+	query := `
+		UPDATE users
+		SET encrypted_password = $2, token_version = token_version + 1
+		WHERE id = $1
+		RETURNING token_version`
+
+	if err := r.db.QueryRowContext(ctx, query, userID, passwordHash).Scan(&version); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// CreatePasswordReset в одной транзакции сохраняет токен сброса пароля
+// и удаляет неиспользованные токены, выданные пользователю раньше
+func (r *repository) CreatePasswordReset(ctx context.Context, reset *models.PasswordReset) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM password_resets WHERE user_id = $1 AND used_at IS NULL`, reset.UserID); err != nil {
+		return err
+	}
+	if err := tx.QueryRowContext(ctx, `
+		INSERT INTO password_resets (token_hash, user_id, created_by, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING created_at`,
+		reset.TokenHash, reset.UserID, reset.CreatedBy, reset.ExpiresAt,
+	).Scan(&reset.CreatedAt); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ResetPassword в одной транзакции отмечает токен сброса использованным, меняет пароль,
+// отзывает токены доступа и снимает блокировку входа.
+// Возвращает ID пользователя или пустую строку, если токен не найден, уже использован или истёк
+func (r *repository) ResetPassword(ctx context.Context, tokenHash, passwordHash string) (string, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var userID string
+	err = tx.QueryRowContext(ctx, `
+		UPDATE password_resets
+		SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id`,
+		tokenHash).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE users
+		SET encrypted_password = $2, token_version = token_version + 1, failed_logins = 0, locked_until = NULL
+		WHERE id = $1`,
+		userID, passwordHash); err != nil {
+		return "", err
+	}
+
+	return userID, tx.Commit()
+}
@@ -3,14 +3,18 @@ package db
 import (
 	"chatgo/server/internal/models"
 	"context"
+	"database/sql"
 	"errors"
 	"testing"
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
 )
 
+var userTestColumns = []string{"id", "username", "encrypted_password", "created_at", "last_login", "last_seen_at", "status", "is_bot", "last_login_ip", "failed_logins", "locked_until", "token_version", "display_name", "bio", "avatar_attachment_id", "timezone", "status_text"}
+
 func TestRepository_CreateUser(t *testing.T) {
 	db, mock, err := MockDB(t)
 	if err != nil {
@@ -26,8 +30,8 @@ func TestRepository_CreateUser(t *testing.T) {
 		Status:            models.UserStatus("online"),
 	}
 
-	rows := sqlmock.NewRows([]string{"id", "username", "encrypted_password", "created_at", "last_login", "status"}).
-		AddRow("1", "test", "password", time.Now(), time.Now(), "online")
+	rows := sqlmock.NewRows(userTestColumns).
+		AddRow("1", "test", "password", time.Now(), time.Now(), nil, "online", false, nil, 0, nil, 0, "", "", nil, "", "")
 
 	mock.ExpectQuery("INSERT INTO users").
 		WithArgs(user.Username, user.EncryptedPassword, user.Status).
@@ -58,9 +62,9 @@ func TestRepository_GetUserByUsername(t *testing.T) {
 			name:     "Success",
 			username: "test",
 			mockSetup: func(mock sqlmock.Sqlmock) {
-				rows := sqlmock.NewRows([]string{"id", "username", "encrypted_password", "created_at", "last_login", "status"}).
-					AddRow("1", "test", "password", time.Now(), time.Now(), "online")
-				mock.ExpectQuery("SELECT (.+) FROM users WHERE username = \\$1").
+				rows := sqlmock.NewRows(userTestColumns).
+					AddRow("1", "test", "password", time.Now(), time.Now(), nil, "online", false, nil, 0, nil, 0, "", "", nil, "", "")
+				mock.ExpectQuery("SELECT (.+) FROM users WHERE LOWER\\(username\\) = LOWER\\(\\$1\\)").
 					WithArgs("test").
 					WillReturnRows(rows)
 			},
@@ -74,7 +78,7 @@ func TestRepository_GetUserByUsername(t *testing.T) {
 			name:     "User Not Found",
 			username: "test",
 			mockSetup: func(mock sqlmock.Sqlmock) {
-				mock.ExpectQuery("SELECT (.+) FROM users WHERE username = \\$1").
+				mock.ExpectQuery("SELECT (.+) FROM users WHERE LOWER\\(username\\) = LOWER\\(\\$1\\)").
 					WithArgs("test").
 					WillReturnError(errors.New("user not found"))
 			},
@@ -123,8 +127,8 @@ func TestRepository_GetUserByID(t *testing.T) {
 
 	repo := &repository{db: db}
 
-	rows := sqlmock.NewRows([]string{"id", "username", "encrypted_password", "created_at", "last_login", "status"}).
-		AddRow("1", "test", "password", time.Now(), time.Now(), "online")
+	rows := sqlmock.NewRows(userTestColumns).
+		AddRow("1", "test", "password", time.Now(), time.Now(), nil, "online", false, nil, 0, nil, 0, "", "", nil, "", "")
 
 	mock.ExpectQuery("SELECT (.+) FROM users WHERE id = \\$1").
 		WithArgs("1").
@@ -152,9 +156,9 @@ func TestRepository_GetAllUsers(t *testing.T) {
 
 	repo := &repository{db: db}
 
-	rows := sqlmock.NewRows([]string{"id", "username", "encrypted_password", "created_at", "last_login", "status"}).
-		AddRow("1", "test", "password", time.Now(), time.Now(), "online").
-		AddRow("2", "test2", "password2", time.Now(), time.Now(), "offline")
+	rows := sqlmock.NewRows(userTestColumns).
+		AddRow("1", "test", "password", time.Now(), time.Now(), nil, "online", false, nil, 0, nil, 0, "", "", nil, "", "").
+		AddRow("2", "test2", "password2", time.Now(), time.Now(), nil, "offline", false, nil, 0, nil, 0, "", "", nil, "", "")
 
 	mock.ExpectQuery("SELECT (.+) FROM users").
 		WillReturnRows(rows)
@@ -174,3 +178,287 @@ func TestRepository_GetAllUsers(t *testing.T) {
 		t.Errorf("Unfulfilled expectations: %s", err)
 	}
 }
+
+func TestRepository_GetUsersByIDs(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+
+	rows := sqlmock.NewRows(userTestColumns).
+		AddRow("1", "alice", "password", time.Now(), nil, nil, "online", false, nil, 0, nil, 0, "Alice Liddell", "", "7", "Europe/London", "in a meeting")
+
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE id = ANY\\(\\$1\\)").
+		WithArgs(pq.Array([]string{"1", "2"})).
+		WillReturnRows(rows)
+
+	users, err := repo.GetUsersByIDs(context.Background(), []string{"1", "2"})
+
+	assert.NoError(t, err)
+	assert.Len(t, users, 1)
+	assert.Equal(t, "Alice Liddell", users[0].DisplayName)
+	assert.Equal(t, sql.NullString{String: "7", Valid: true}, users[0].AvatarID)
+	assert.Equal(t, "Europe/London", users[0].Timezone)
+	assert.Equal(t, "in a meeting", users[0].StatusText)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_UpdateUserProfile(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+
+	user := &models.User{ID: "1", DisplayName: "Alice", Bio: "Down the rabbit hole", Timezone: "Europe/London"}
+	mock.ExpectExec("UPDATE users SET display_name = \\$2, bio = \\$3, avatar_attachment_id = \\$4, timezone = \\$5, status_text = \\$6 WHERE id = \\$1").
+		WithArgs("1", "Alice", "Down the rabbit hole", nil, "Europe/London", "").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	assert.NoError(t, repo.UpdateUserProfile(context.Background(), user))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_UpdateUserStatus(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+
+	mock.ExpectExec("UPDATE users SET status = \\$1, last_seen_at = CURRENT_TIMESTAMP WHERE id = \\$2 AND status <> 'banned'").
+		WithArgs(models.UserStatus(models.Away), "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE users SET status").
+		WithArgs(models.UserStatus(models.Online), "2").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	updated, err := repo.UpdateUserStatus(context.Background(), "1", models.UserStatus(models.Away))
+	assert.NoError(t, err)
+	assert.True(t, updated)
+
+	updated, err = repo.UpdateUserStatus(context.Background(), "2", models.UserStatus(models.Online))
+	assert.NoError(t, err)
+	assert.False(t, updated)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_UpdateLastLogin(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+
+	mock.ExpectExec("UPDATE users SET last_login = CURRENT_TIMESTAMP, last_login_ip = \\$2, failed_logins = 0, locked_until = NULL WHERE id = \\$1").
+		WithArgs("1", "10.0.0.1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	assert.NoError(t, repo.UpdateLastLogin(context.Background(), "1", "10.0.0.1"))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_RecordFailedLogin(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+
+	mock.ExpectQuery("UPDATE users SET failed_logins = failed_logins \\+ 1 WHERE id = \\$1 RETURNING failed_logins").
+		WithArgs("1").
+		WillReturnRows(sqlmock.NewRows([]string{"failed_logins"}).AddRow(3))
+
+	failures, err := repo.RecordFailedLogin(context.Background(), "1")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, failures)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_LockUser(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+	until := time.Now().Add(15 * time.Minute)
+
+	mock.ExpectExec("UPDATE users SET locked_until = \\$2 WHERE id = \\$1").
+		WithArgs("1", until).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE users SET failed_logins = 0, locked_until = NULL WHERE id = \\$1").
+		WithArgs("1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE users SET failed_logins = 0").
+		WithArgs("404").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.NoError(t, repo.LockUser(context.Background(), "1", until))
+
+	unlocked, err := repo.UnlockUser(context.Background(), "1")
+	assert.NoError(t, err)
+	assert.True(t, unlocked)
+
+	unlocked, err = repo.UnlockUser(context.Background(), "404")
+	assert.NoError(t, err)
+	assert.False(t, unlocked)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_LoginAttempts(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+	now := time.Now()
+
+	mock.ExpectQuery("INSERT INTO login_attempts \\(user_id, ip, user_agent, success, reason\\)").
+		WithArgs("1", "10.0.0.1", "curl/8.0", false, models.LoginBadPassword).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow("7", now))
+	mock.ExpectQuery("SELECT (.+) FROM login_attempts WHERE user_id = \\$1 ORDER BY created_at DESC, id DESC LIMIT \\$2").
+		WithArgs("1", 20).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "ip", "user_agent", "success", "reason", "created_at"}).
+			AddRow("8", "1", "10.0.0.2", "", true, "", now).
+			AddRow("7", "1", "10.0.0.1", "curl/8.0", false, models.LoginBadPassword, now))
+
+	attempt := &models.LoginAttempt{UserID: "1", IP: "10.0.0.1", UserAgent: "curl/8.0", Reason: models.LoginBadPassword}
+	assert.NoError(t, repo.CreateLoginAttempt(context.Background(), attempt))
+	assert.Equal(t, "7", attempt.ID)
+
+	attempts, err := repo.GetLoginAttempts(context.Background(), "1", 20)
+	assert.NoError(t, err)
+	assert.Len(t, attempts, 2)
+	assert.True(t, attempts[0].Success)
+	assert.Equal(t, models.LoginBadPassword, attempts[1].Reason)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_ChangePassword(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+
+	mock.ExpectExec("UPDATE users SET encrypted_password = \\$2 WHERE id = \\$1").
+		WithArgs("1", "rehashed").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("UPDATE users SET encrypted_password = \\$2, token_version = token_version \\+ 1 WHERE id = \\$1 RETURNING token_version").
+		WithArgs("1", "newhash").
+		WillReturnRows(sqlmock.NewRows([]string{"token_version"}).AddRow(4))
+
+	assert.NoError(t, repo.UpdatePasswordHash(context.Background(), "1", "rehashed"))
+
+	version, err := repo.ChangePassword(context.Background(), "1", "newhash")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, version)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_CreatePasswordReset(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+	now := time.Now()
+	reset := &models.PasswordReset{TokenHash: "hash", UserID: "2", CreatedBy: "1", ExpiresAt: now.Add(time.Hour)}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM password_resets WHERE user_id = \\$1 AND used_at IS NULL").
+		WithArgs("2").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("INSERT INTO password_resets \\(token_hash, user_id, created_by, expires_at\\) VALUES \\(\\$1, \\$2, \\$3, \\$4\\) RETURNING created_at").
+		WithArgs("hash", "2", "1", reset.ExpiresAt).
+		WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(now))
+	mock.ExpectCommit()
+
+	assert.NoError(t, repo.CreatePasswordReset(context.Background(), reset))
+	assert.Equal(t, now, reset.CreatedAt)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_ResetPassword(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("UPDATE password_resets SET used_at = NOW\\(\\) WHERE token_hash = \\$1 AND used_at IS NULL AND expires_at > NOW\\(\\) RETURNING user_id").
+		WithArgs("hash").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow("2"))
+	mock.ExpectExec("UPDATE users SET encrypted_password = \\$2, token_version = token_version \\+ 1, failed_logins = 0, locked_until = NULL WHERE id = \\$1").
+		WithArgs("2", "newhash").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("UPDATE password_resets").
+		WithArgs("hash").
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	userID, err := repo.ResetPassword(context.Background(), "hash", "newhash")
+	assert.NoError(t, err)
+	assert.Equal(t, "2", userID)
+
+	// A used or expired token is refused
+	userID, err = repo.ResetPassword(context.Background(), "hash", "newhash")
+	assert.NoError(t, err)
+	assert.Empty(t, userID)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,246 @@
+package db
+
+import (
+	"chatgo/server/internal/models"
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const webhookColumns = `
+			id,
+			chat_room_id,
+			url,
+			events,
+			encrypted_secret,
+			key_version,
+			created_by,
+			created_at`
+
+const webhookDeliveryColumns = `
+			id,
+			webhook_id,
+			message_id,
+			event,
+			encrypted_payload,
+			key_version,
+			status,
+			attempts,
+			next_attempt_at,
+			last_status_code,
+			last_error,
+			created_at,
+			delivered_at`
+
+func scanWebhook(row rowScanner, webhook *models.Webhook) error {
+	return row.Scan(
+		&webhook.ID,
+		&webhook.ChatRoomID,
+		&webhook.URL,
+		pq.Array(&webhook.Events),
+		&webhook.EncryptedSecret,
+		&webhook.KeyVersion,
+		&webhook.CreatedBy,
+		&webhook.CreatedAt,
+	)
+}
+
+func scanWebhookDelivery(row rowScanner, delivery *models.WebhookDelivery) error {
+	return row.Scan(
+		&delivery.ID,
+		&delivery.WebhookID,
+		&delivery.MessageID,
+		&delivery.Event,
+		&delivery.EncryptedPayload,
+		&delivery.KeyVersion,
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.NextAttemptAt,
+		&delivery.LastStatusCode,
+		&delivery.LastError,
+		&delivery.CreatedAt,
+		&delivery.DeliveredAt,
+	)
+}
+
+// CreateWebhook сохраняет подписку чата на события
+func (r *repository) CreateWebhook(ctx context.Context, webhook *models.Webhook) (*models.Webhook, error) {
+	query := `
+		INSERT INTO webhooks (chat_room_id, url, events, encrypted_secret, key_version, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, CURRENT_TIMESTAMP)
+		RETURNING` + webhookColumns
+
+	err := scanWebhook(r.db.QueryRowContext(ctx, query,
+		webhook.ChatRoomID,
+		webhook.URL,
+		pq.Array(webhook.Events),
+		webhook.EncryptedSecret,
+		webhook.KeyVersion,
+		webhook.CreatedBy,
+	), webhook)
+	if err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+// GetWebhookByID возвращает вебхук по идентификатору или nil, если его нет
+func (r *repository) GetWebhookByID(ctx context.Context, id string) (*models.Webhook, error) {
+	var webhook models.Webhook
+	err := scanWebhook(r.db.QueryRowContext(ctx, `
+		SELECT`+webhookColumns+`
+		FROM webhooks
+		WHERE id = $1`, id), &webhook)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+// GetWebhooksByChatRoomID возвращает вебхуки чата в порядке создания
+func (r *repository) GetWebhooksByChatRoomID(ctx context.Context, chatRoomID string) ([]*models.Webhook, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT`+webhookColumns+`
+		FROM webhooks
+		WHERE chat_room_id = $1
+		ORDER BY id`, chatRoomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhooks []*models.Webhook
+	for rows.Next() {
+		var webhook models.Webhook
+		if err := scanWebhook(rows, &webhook); err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, &webhook)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+// DeleteWebhook удаляет вебхук вместе с историей его доставок
+func (r *repository) DeleteWebhook(ctx context.Context, id string) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM webhooks WHERE id = $1", id)
+	return err
+}
+
+// EnqueueWebhookDeliveries ставит событие delivery в очередь на отправку всем вебхукам чата,
+// подписанным на него. Возвращает число созданных доставок
+func (r *repository) EnqueueWebhookDeliveries(ctx context.Context, chatRoomID string, delivery *models.WebhookDelivery) (int, error) {
+	res, err := r.db.ExecContext(ctx, `
+		INSERT INTO webhook_deliveries (webhook_id, message_id, event, encrypted_payload, key_version, status, next_attempt_at, created_at)
+		SELECT id, $3, $2, $4, $5, 'pending', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP
+		FROM webhooks
+		WHERE chat_room_id = $1 AND $2 = ANY(events)`,
+		chatRoomID, delivery.Event, delivery.MessageID, delivery.EncryptedPayload, delivery.KeyVersion)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(n), nil
+}
+
+// ClaimWebhookDeliveries забирает до limit доставок, время попытки которых наступило к now, и
+// откладывает их следующую попытку на lease. Строки блокируются с SKIP LOCKED, поэтому несколько
+// серверов не заберут одну доставку, а если сервер упадёт во время отправки, доставка будет
+// повторена после lease
+func (r *repository) ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*models.WebhookDelivery, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		UPDATE webhook_deliveries
+		SET next_attempt_at = $2
+		WHERE id IN (
+			SELECT id
+			FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= $1
+			ORDER BY next_attempt_at, id
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING`+webhookDeliveryColumns,
+		now, now.Add(lease), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []*models.WebhookDelivery
+	for rows.Next() {
+		var delivery models.WebhookDelivery
+		if err := scanWebhookDelivery(rows, &delivery); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, &delivery)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// UpdateWebhookDelivery сохраняет результат попытки доставки и тело запроса, которое после
+// доставки очищено
+func (r *repository) UpdateWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET status = $2, attempts = $3, next_attempt_at = $4, last_status_code = $5, last_error = $6, delivered_at = $7,
+			encrypted_payload = $8
+		WHERE id = $1`,
+		delivery.ID,
+		delivery.Status,
+		delivery.Attempts,
+		delivery.NextAttemptAt,
+		delivery.LastStatusCode,
+		delivery.LastError,
+		delivery.DeliveredAt,
+		delivery.EncryptedPayload,
+	)
+	return err
+}
+
+// GetWebhookDeliveries возвращает до limit последних доставок вебхука, начиная с новых.
+// Если status не пуст, возвращаются только доставки с этим статусом
+func (r *repository) GetWebhookDeliveries(ctx context.Context, webhookID, status string, limit int) ([]*models.WebhookDelivery, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT`+webhookDeliveryColumns+`
+		FROM webhook_deliveries
+		WHERE webhook_id = $1 AND ($2 = '' OR status = $2)
+		ORDER BY id DESC
+		LIMIT $3`, webhookID, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []*models.WebhookDelivery
+	for rows.Next() {
+		var delivery models.WebhookDelivery
+		if err := scanWebhookDelivery(rows, &delivery); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, &delivery)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
@@ -0,0 +1,178 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"chatgo/server/internal/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	webhookTestColumns         = []string{"id", "chat_room_id", "url", "events", "encrypted_secret", "key_version", "created_by", "created_at"}
+	webhookDeliveryTestColumns = []string{"id", "webhook_id", "message_id", "event", "encrypted_payload", "key_version", "status", "attempts", "next_attempt_at", "last_status_code", "last_error", "created_at", "delivered_at"}
+)
+
+func TestRepository_CreateWebhook(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+	events := []string{"message.created", "room.renamed"}
+	webhook := &models.Webhook{ChatRoomID: "1", URL: "https://ci.example.com/hook", Events: events, EncryptedSecret: "ciphertext", KeyVersion: 1, CreatedBy: "2"}
+
+	mock.ExpectQuery("INSERT INTO webhooks (.+) RETURNING").
+		WithArgs("1", "https://ci.example.com/hook", pq.Array(events), "ciphertext", 1, "2").
+		WillReturnRows(sqlmock.NewRows(webhookTestColumns).
+			AddRow("3", "1", "https://ci.example.com/hook", "{message.created,room.renamed}", "ciphertext", 1, "2", time.Now()))
+
+	created, err := repo.CreateWebhook(context.Background(), webhook)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "3", created.ID)
+	assert.Equal(t, events, created.Events)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_GetWebhookByID(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+
+	mock.ExpectQuery("SELECT (.+) FROM webhooks WHERE id = \\$1").
+		WithArgs("3").
+		WillReturnRows(sqlmock.NewRows(webhookTestColumns).
+			AddRow("3", "1", "https://ci.example.com/hook", "{member.joined}", "ciphertext", 1, "2", time.Now()))
+	mock.ExpectQuery("SELECT (.+) FROM webhooks WHERE id = \\$1").
+		WithArgs("4").
+		WillReturnError(sql.ErrNoRows)
+
+	webhook, err := repo.GetWebhookByID(context.Background(), "3")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"member.joined"}, webhook.Events)
+
+	webhook, err = repo.GetWebhookByID(context.Background(), "4")
+	assert.NoError(t, err)
+	assert.Nil(t, webhook)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_EnqueueWebhookDeliveries(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+
+	messageID := sql.NullString{String: "40", Valid: true}
+	mock.ExpectExec("INSERT INTO webhook_deliveries (.+) SELECT (.+) FROM webhooks WHERE chat_room_id = \\$1 AND \\$2 = ANY\\(events\\)").
+		WithArgs("1", "message.created", messageID, "ciphertext", 1).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	n, err := repo.EnqueueWebhookDeliveries(context.Background(), "1", &models.WebhookDelivery{
+		MessageID: messageID, Event: "message.created", EncryptedPayload: "ciphertext", KeyVersion: 1,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_ClaimWebhookDeliveries(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+	now := time.Now()
+
+	mock.ExpectQuery("UPDATE webhook_deliveries SET next_attempt_at = \\$2 WHERE id IN \\( SELECT id FROM webhook_deliveries WHERE status = 'pending' AND next_attempt_at <= \\$1 (.+) FOR UPDATE SKIP LOCKED \\) RETURNING").
+		WithArgs(now, now.Add(time.Minute), 50).
+		WillReturnRows(sqlmock.NewRows(webhookDeliveryTestColumns).
+			AddRow("7", "3", "40", "message.created", "ciphertext", 1, models.WebhookDeliveryPending, 2, now.Add(time.Minute), 500, "receiver responded with 500", now, nil))
+
+	deliveries, err := repo.ClaimWebhookDeliveries(context.Background(), now, time.Minute, 50)
+
+	assert.NoError(t, err)
+	assert.Len(t, deliveries, 1)
+	assert.Equal(t, 2, deliveries[0].Attempts)
+	assert.False(t, deliveries[0].DeliveredAt.Valid)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_UpdateWebhookDelivery(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+	now := time.Now()
+	delivery := &models.WebhookDelivery{
+		ID:             "7",
+		Status:         models.WebhookDeliveryDelivered,
+		Attempts:       3,
+		NextAttemptAt:  now,
+		LastStatusCode: 200,
+		DeliveredAt:    sql.NullTime{Time: now, Valid: true},
+	}
+
+	mock.ExpectExec("UPDATE webhook_deliveries SET status = \\$2, attempts = \\$3,(.+) WHERE id = \\$1").
+		WithArgs("7", models.WebhookDeliveryDelivered, 3, now, 200, "", delivery.DeliveredAt, "").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	assert.NoError(t, repo.UpdateWebhookDelivery(context.Background(), delivery))
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepository_GetWebhookDeliveries(t *testing.T) {
+	db, mock, err := MockDB(t)
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	repo := &repository{db: db}
+	now := time.Now()
+
+	mock.ExpectQuery("SELECT (.+) FROM webhook_deliveries WHERE webhook_id = \\$1 AND \\(\\$2 = '' OR status = \\$2\\) ORDER BY id DESC LIMIT \\$3").
+		WithArgs("3", models.WebhookDeliveryDead, 20).
+		WillReturnRows(sqlmock.NewRows(webhookDeliveryTestColumns).
+			AddRow("9", "3", nil, "member.left", "ciphertext", 1, models.WebhookDeliveryDead, 8, now, 0, "connection refused", now, nil))
+
+	deliveries, err := repo.GetWebhookDeliveries(context.Background(), "3", models.WebhookDeliveryDead, 20)
+
+	assert.NoError(t, err)
+	assert.Len(t, deliveries, 1)
+	assert.Equal(t, "connection refused", deliveries[0].LastError)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,254 @@
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ErrUnknownFormat is returned for formats other than jsonl, csv, html and text
+var ErrUnknownFormat = errors.New("unknown export format")
+
+// Format is an export file format
+type Format string
+
+const (
+	JSONL Format = "jsonl"
+	CSV   Format = "csv"
+	HTML  Format = "html"
+	Text  Format = "text"
+)
+
+// Room describes the exported room and time range, zero times mean no bound
+type Room struct {
+	ID   string
+	Name string
+	From time.Time
+	To   time.Time
+}
+
+// Attachment is the metadata of a file attached to a message. File contents are not exported
+type Attachment struct {
+	ID          string `json:"id"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size"`
+}
+
+// Message is a decrypted message. Content of end-to-end encrypted messages is the
+// ciphertext and Encrypted is set
+type Message struct {
+	ID          string       `json:"id"`
+	ParentID    string       `json:"parentId,omitempty"`
+	Username    string       `json:"username"`
+	Content     string       `json:"content"`
+	CreatedAt   time.Time    `json:"createdAt"`
+	EditedAt    *time.Time   `json:"editedAt,omitempty"`
+	Encrypted   bool         `json:"encrypted,omitempty"`
+	Attachments []Attachment `json:"attachments,omitempty"`
+}
+
+// Writer writes messages one by one in a specific format.
+// Close writes the footer, if the format has one, and flushes the output
+type Writer interface {
+	WriteMessage(msg *Message) error
+	Close() error
+}
+
+// ParseFormat validates a format name, an empty name means JSON Lines
+func ParseFormat(name string) (Format, error) {
+	switch format := Format(strings.ToLower(name)); format {
+	case "":
+		return JSONL, nil
+	case JSONL, CSV, HTML, Text:
+		return format, nil
+	default:
+		return "", fmt.Errorf("%w %q", ErrUnknownFormat, name)
+	}
+}
+
+// ParseTime parses a range bound given as YYYY-MM-DD or RFC3339, an empty value is no bound
+func ParseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, expected YYYY-MM-DD or RFC3339", value)
+	}
+	return t, nil
+}
+
+// ContentType returns the MIME type of the format
+func (f Format) ContentType() string {
+	switch f {
+	case CSV:
+		return "text/csv; charset=utf-8"
+	case HTML:
+		return "text/html; charset=utf-8"
+	case Text:
+		return "text/plain; charset=utf-8"
+	default:
+		return "application/x-ndjson"
+	}
+}
+
+// Extension returns the file extension of the format without the dot
+func (f Format) Extension() string {
+	if f == Text {
+		return "txt"
+	}
+	return string(f)
+}
+
+// NewWriter creates a writer for the format and writes the header of the export
+func NewWriter(w io.Writer, format Format, room Room) (Writer, error) {
+	switch format {
+	case JSONL:
+		return newJSONLWriter(w), nil
+	case CSV:
+		return newCSVWriter(w)
+	case HTML:
+		return newHTMLWriter(w, room)
+	case Text:
+		return newTextWriter(w, room)
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnknownFormat, format)
+	}
+}
+
+// jsonlWriter writes one JSON object per line
+type jsonlWriter struct {
+	buf *bufio.Writer
+	enc *json.Encoder
+}
+
+func newJSONLWriter(w io.Writer) *jsonlWriter {
+	buf := bufio.NewWriter(w)
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	return &jsonlWriter{buf: buf, enc: enc}
+}
+
+func (w *jsonlWriter) WriteMessage(msg *Message) error {
+	return w.enc.Encode(msg)
+}
+
+func (w *jsonlWriter) Close() error {
+	return w.buf.Flush()
+}
+
+// csvWriter writes one row per message, attachments are listed in a single column
+type csvWriter struct {
+	w *csv.Writer
+}
+
+var csvHeader = []string{"id", "parent_id", "created_at", "edited_at", "username", "content", "encrypted", "attachments"}
+
+func newCSVWriter(w io.Writer) (*csvWriter, error) {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return nil, err
+	}
+	return &csvWriter{w: cw}, nil
+}
+
+func (w *csvWriter) WriteMessage(msg *Message) error {
+	editedAt := ""
+	if msg.EditedAt != nil {
+		editedAt = msg.EditedAt.UTC().Format(time.RFC3339)
+	}
+	attachments := make([]string, len(msg.Attachments))
+	for i, a := range msg.Attachments {
+		attachments[i] = formatAttachment(a)
+	}
+
+	return w.w.Write([]string{
+		msg.ID,
+		msg.ParentID,
+		msg.CreatedAt.UTC().Format(time.RFC3339),
+		editedAt,
+		csvSafe(msg.Username),
+		csvSafe(msg.Content),
+		fmt.Sprint(msg.Encrypted),
+		csvSafe(strings.Join(attachments, "; ")),
+	})
+}
+
+func (w *csvWriter) Close() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+// csvSafe keeps spreadsheets from evaluating cells that look like formulas
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// textWriter writes a transcript meant to be read by people
+type textWriter struct {
+	buf *bufio.Writer
+}
+
+func newTextWriter(w io.Writer, room Room) (*textWriter, error) {
+	buf := bufio.NewWriter(w)
+	fmt.Fprintf(buf, "%s\n%s\n\n", title(room), rangeLine(room))
+	return &textWriter{buf: buf}, buf.Flush()
+}
+
+func (w *textWriter) WriteMessage(msg *Message) error {
+	indent := ""
+	if msg.ParentID != "" {
+		indent = "    "
+		fmt.Fprintf(w.buf, "%s↳ reply to #%s\n", indent, msg.ParentID)
+	}
+
+	edited := ""
+	if msg.EditedAt != nil {
+		edited = " (edited)"
+	}
+	content := msg.Content
+	if msg.Encrypted {
+		content = "[end-to-end encrypted]"
+	}
+	fmt.Fprintf(w.buf, "%s[%s] #%s %s: %s%s\n", indent, msg.CreatedAt.UTC().Format("2006-01-02 15:04:05"),
+		msg.ID, msg.Username, strings.ReplaceAll(content, "\n", "\n"+indent+"    "), edited)
+	for _, a := range msg.Attachments {
+		fmt.Fprintf(w.buf, "%s    [attachment] %s\n", indent, formatAttachment(a))
+	}
+	return nil
+}
+
+func (w *textWriter) Close() error {
+	return w.buf.Flush()
+}
+
+func title(room Room) string {
+	return fmt.Sprintf("Room %s (#%s)", room.Name, room.ID)
+}
+
+func rangeLine(room Room) string {
+	from, to := "the beginning", "now"
+	if !room.From.IsZero() {
+		from = room.From.UTC().Format(time.RFC3339)
+	}
+	if !room.To.IsZero() {
+		to = room.To.UTC().Format(time.RFC3339)
+	}
+	return fmt.Sprintf("Messages from %s to %s, times in UTC", from, to)
+}
+
+func formatAttachment(a Attachment) string {
+	return fmt.Sprintf("%s (%s, %d bytes, id %s)", a.Filename, a.ContentType, a.Size, a.ID)
+}
@@ -0,0 +1,110 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testMessages() []*Message {
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	edited := base.Add(time.Minute)
+
+	return []*Message{
+		{ID: "1", Username: "alice", Content: "Release <b>today</b>", CreatedAt: base, EditedAt: &edited},
+		{ID: "2", ParentID: "1", Username: "bob", Content: "=SUM(A1:A2)", CreatedAt: base.Add(time.Hour),
+			Attachments: []Attachment{{ID: "7", Filename: "notes.txt", ContentType: "text/plain", Size: 2048}}},
+		{ID: "3", Username: "carol", Content: "ciphertext", CreatedAt: base.Add(2 * time.Hour), Encrypted: true},
+	}
+}
+
+func export(t *testing.T, format Format) string {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, format, Room{ID: "5", Name: "general"})
+	require.NoError(t, err)
+	for _, msg := range testMessages() {
+		require.NoError(t, w.WriteMessage(msg))
+	}
+	require.NoError(t, w.Close())
+	return buf.String()
+}
+
+func TestParseFormat(t *testing.T) {
+	format, err := ParseFormat("")
+	assert.NoError(t, err)
+	assert.Equal(t, JSONL, format)
+
+	format, err = ParseFormat("HTML")
+	assert.NoError(t, err)
+	assert.Equal(t, HTML, format)
+	assert.Equal(t, "txt", Text.Extension())
+
+	_, err = ParseFormat("pdf")
+	assert.ErrorIs(t, err, ErrUnknownFormat)
+}
+
+func TestParseTime(t *testing.T) {
+	tm, err := ParseTime("2024-03-01")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), tm)
+
+	tm, err = ParseTime("")
+	assert.NoError(t, err)
+	assert.True(t, tm.IsZero())
+
+	_, err = ParseTime("yesterday")
+	assert.Error(t, err)
+}
+
+func TestJSONLWriter(t *testing.T) {
+	lines := strings.Split(strings.TrimSpace(export(t, JSONL)), "\n")
+	require.Len(t, lines, 3)
+
+	var msg Message
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &msg))
+	assert.Equal(t, "2", msg.ID)
+	assert.Equal(t, "1", msg.ParentID)
+	assert.Equal(t, "notes.txt", msg.Attachments[0].Filename)
+	assert.Contains(t, lines[0], `"editedAt":"2024-01-01T12:01:00Z"`)
+	assert.Contains(t, lines[0], "<b>today</b>")
+}
+
+func TestCSVWriter(t *testing.T) {
+	records, err := csv.NewReader(strings.NewReader(export(t, CSV))).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 4)
+
+	assert.Equal(t, csvHeader, records[0])
+	assert.Equal(t, "2024-01-01T12:01:00Z", records[1][3])
+	assert.Equal(t, "'=SUM(A1:A2)", records[2][5])
+	assert.Equal(t, "notes.txt (text/plain, 2048 bytes, id 7)", records[2][7])
+	assert.Equal(t, "true", records[3][6])
+}
+
+func TestHTMLWriter(t *testing.T) {
+	page := export(t, HTML)
+
+	assert.True(t, strings.HasPrefix(page, "<!DOCTYPE html>"))
+	assert.True(t, strings.HasSuffix(page, "</html>\n"))
+	assert.Contains(t, page, "Room general (#5)")
+	assert.Contains(t, page, "Release &lt;b&gt;today&lt;/b&gt;")
+	assert.Contains(t, page, "edited 2024-01-01 12:01:00")
+	assert.Contains(t, page, `reply to <a href="#m1">#1</a>`)
+	assert.Contains(t, page, "notes.txt (text/plain, 2.0 KB)")
+	assert.NotContains(t, page, "ciphertext")
+}
+
+func TestTextWriter(t *testing.T) {
+	text := export(t, Text)
+
+	assert.Contains(t, text, "[2024-01-01 12:00:00] #1 alice: Release <b>today</b> (edited)")
+	assert.Contains(t, text, "    ↳ reply to #1\n    [2024-01-01 13:00:00] #2 bob: =SUM(A1:A2)")
+	assert.Contains(t, text, "[attachment] notes.txt")
+	assert.Contains(t, text, "#3 carol: [end-to-end encrypted]")
+}
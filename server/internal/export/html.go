@@ -0,0 +1,84 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"html/template"
+	"io"
+	"time"
+)
+
+// The page has no external resources, so it can be opened offline or attached to an email
+var htmlTemplates = template.Must(template.New("header").Funcs(template.FuncMap{
+	"time": func(t time.Time) string { return t.UTC().Format("2006-01-02 15:04:05") },
+	"size": formatSize,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; max-width: 900px; margin: 2em auto; padding: 0 1em; color: #1d1d1f; }
+h1 { font-size: 1.4em; margin-bottom: 0.2em; }
+.range { color: #6e6e73; margin-top: 0; }
+.message { padding: 0.5em 0; border-bottom: 1px solid #e5e5ea; }
+.reply { margin-left: 2em; }
+.meta { color: #6e6e73; font-size: 0.85em; }
+.username { font-weight: 600; color: #1d1d1f; }
+.content { white-space: pre-wrap; word-wrap: break-word; margin-top: 0.2em; }
+.encrypted { color: #6e6e73; font-style: italic; }
+.attachment { font-size: 0.9em; margin-top: 0.2em; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p class="range">{{.Range}}</p>
+`))
+
+func init() {
+	template.Must(htmlTemplates.New("message").Parse(`<div class="message{{if .ParentID}} reply{{end}}" id="m{{.ID}}">
+<div class="meta"><span class="username">{{.Username}}</span> · {{time .CreatedAt}} · #{{.ID}}{{if .ParentID}} · reply to <a href="#m{{.ParentID}}">#{{.ParentID}}</a>{{end}}{{if .EditedAt}} · edited {{time .EditedAt}}{{end}}</div>
+{{if .Encrypted}}<div class="content encrypted">end-to-end encrypted message</div>{{else}}<div class="content">{{.Content}}</div>{{end}}
+{{range .Attachments}}<div class="attachment">📎 {{.Filename}} ({{.ContentType}}, {{size .Size}})</div>
+{{end}}</div>
+`))
+	template.Must(htmlTemplates.New("footer").Parse(`</body>
+</html>
+`))
+}
+
+// htmlWriter writes a self-contained HTML page
+type htmlWriter struct {
+	buf *bufio.Writer
+}
+
+func newHTMLWriter(w io.Writer, room Room) (*htmlWriter, error) {
+	buf := bufio.NewWriter(w)
+	err := htmlTemplates.ExecuteTemplate(buf, "header", struct{ Title, Range string }{title(room), rangeLine(room)})
+	if err != nil {
+		return nil, err
+	}
+	return &htmlWriter{buf: buf}, buf.Flush()
+}
+
+func (w *htmlWriter) WriteMessage(msg *Message) error {
+	return htmlTemplates.ExecuteTemplate(w.buf, "message", msg)
+}
+
+func (w *htmlWriter) Close() error {
+	if err := htmlTemplates.ExecuteTemplate(w.buf, "footer", nil); err != nil {
+		return err
+	}
+	return w.buf.Flush()
+}
+
+func formatSize(size int64) string {
+	switch {
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(size)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", size)
+	}
+}
@@ -0,0 +1,68 @@
+package importer
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrUnknownFormat is returned for formats other than slack and mattermost
+var ErrUnknownFormat = errors.New("unknown import format")
+
+// Format is the chat system an export comes from
+type Format string
+
+const (
+	Slack      Format = "slack"
+	Mattermost Format = "mattermost"
+)
+
+// User is a user of the source system
+type User struct {
+	ID       string
+	Username string
+}
+
+// Room is a channel of the source system. Direct rooms are one-to-one and group direct messages
+type Room struct {
+	ID      string
+	Name    string
+	Private bool
+	Direct  bool
+	// CreatorID is the source ID of the user who created the room, empty when unknown
+	CreatorID string
+}
+
+// Message is a message of the source system. ParentID is set for thread replies
+type Message struct {
+	ID        string
+	RoomID    string
+	UserID    string
+	ParentID  string
+	Text      string
+	CreatedAt time.Time
+	// EditedAt is zero for messages that were never edited
+	EditedAt time.Time
+}
+
+// Sink receives the contents of an export read by ReadSlack or ReadMattermost. IDs are the IDs
+// of the source system, so a sink can remember what it has already imported and skip it.
+// A user is sent before their memberships and messages, a room before its memberships
+// and messages, and a thread root before its replies
+type Sink interface {
+	User(user *User) error
+	Room(room *Room) error
+	Member(roomID, userID string) error
+	Message(msg *Message) error
+}
+
+// Read reads the export at path in the given format
+func Read(format Format, path string, sink Sink) error {
+	switch format {
+	case Slack:
+		return ReadSlack(path, sink)
+	case Mattermost:
+		return ReadMattermost(path, sink)
+	default:
+		return ErrUnknownFormat
+	}
+}
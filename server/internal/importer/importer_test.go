@@ -0,0 +1,135 @@
+package importer
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recorder is a Sink that keeps everything it receives
+type recorder struct {
+	users    []User
+	rooms    []Room
+	members  [][2]string
+	messages []Message
+}
+
+func (r *recorder) User(user *User) error {
+	r.users = append(r.users, *user)
+	return nil
+}
+
+func (r *recorder) Room(room *Room) error {
+	r.rooms = append(r.rooms, *room)
+	return nil
+}
+
+func (r *recorder) Member(roomID, userID string) error {
+	r.members = append(r.members, [2]string{roomID, userID})
+	return nil
+}
+
+func (r *recorder) Message(msg *Message) error {
+	r.messages = append(r.messages, *msg)
+	return nil
+}
+
+func writeZip(t *testing.T, files map[string]string) string {
+	path := filepath.Join(t.TempDir(), "export.zip")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	w := zip.NewWriter(f)
+	for name, content := range files {
+		fw, err := w.Create(name)
+		require.NoError(t, err)
+		_, err = fw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	return path
+}
+
+func TestReadSlack(t *testing.T) {
+	path := writeZip(t, map[string]string{
+		"users.json":    `[{"id": "U1", "name": "alice"}, {"id": "U2", "name": "bob"}]`,
+		"channels.json": `[{"id": "C1", "name": "general", "creator": "U1", "members": ["U1", "U2"]}]`,
+		"dms.json":      `[{"id": "D1", "members": ["U1", "U2"]}]`,
+		"general/2024-01-02.json": `[
+			{"type": "message", "user": "U2", "text": "second day", "ts": "1704153600.000100"}
+		]`,
+		"general/2024-01-01.json": `[
+			{"type": "message", "subtype": "channel_join", "user": "U2", "text": "<@U2> has joined the channel", "ts": "1704067100.000000"},
+			{"type": "message", "user": "U1", "text": "Hi <@U2> &amp; <!here>, see <https://example.com|the docs>", "ts": "1704067200.000100", "thread_ts": "1704067200.000100", "edited": {"ts": "1704067260.000000"}},
+			{"type": "message", "user": "U2", "text": "thanks", "ts": "1704067300.000200", "thread_ts": "1704067200.000100", "files": [{"name": "notes.txt"}]}
+		]`,
+		"D1/2024-01-01.json": `[{"type": "message", "user": "U1", "text": "psst", "ts": "1704067400.000000"}]`,
+	})
+
+	var r recorder
+	require.NoError(t, Read(Slack, path, &r))
+
+	assert.Equal(t, []User{{ID: "U1", Username: "alice"}, {ID: "U2", Username: "bob"}}, r.users)
+	assert.Equal(t, []Room{
+		{ID: "C1", Name: "general", CreatorID: "U1"},
+		{ID: "D1", Name: "alice, bob", Private: true, Direct: true},
+	}, r.rooms)
+	assert.Len(t, r.members, 4)
+
+	require.Len(t, r.messages, 4)
+	root := r.messages[0]
+	assert.Equal(t, "C1/1704067200.000100", root.ID)
+	assert.Equal(t, "Hi @bob & @room, see the docs (https://example.com)", root.Text)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 100000, time.UTC), root.CreatedAt)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 1, 0, 0, time.UTC), root.EditedAt)
+	assert.Empty(t, root.ParentID)
+
+	assert.Equal(t, root.ID, r.messages[1].ParentID)
+	assert.Equal(t, "thanks\n[file: notes.txt]", r.messages[1].Text)
+	assert.Equal(t, "second day", r.messages[2].Text)
+	assert.Equal(t, "D1", r.messages[3].RoomID)
+}
+
+func TestReadMattermost(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "export.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte(`{"type": "version", "version": 1}
+{"type": "team", "team": {"name": "acme"}}
+{"type": "channel", "channel": {"team": "acme", "name": "town-square", "display_name": "Town Square", "type": "O"}}
+{"type": "user", "user": {"username": "alice", "teams": [{"name": "acme", "channels": [{"name": "town-square"}, {"name": "deleted"}]}]}}
+
+{"type": "post", "post": {"team": "acme", "channel": "town-square", "user": "alice", "message": "hello", "create_at": 1704067200000, "replies": [{"user": "carol", "message": "hi", "create_at": 1704067260000}]}}
+{"type": "direct_channel", "direct_channel": {"members": ["bob", "alice"]}}
+{"type": "direct_post", "direct_post": {"channel_members": ["alice", "bob"], "user": "bob", "message": "psst", "create_at": 1704067300000, "edit_at": 1704067310000}}
+`), 0o600))
+
+	var r recorder
+	require.NoError(t, Read(Mattermost, path, &r))
+
+	assert.Equal(t, []User{{ID: "alice", Username: "alice"}, {ID: "carol", Username: "carol"}, {ID: "bob", Username: "bob"}}, r.users)
+	assert.Equal(t, []Room{
+		{ID: "acme/town-square", Name: "Town Square"},
+		{ID: "direct/alice,bob", Name: "alice, bob", Private: true, Direct: true},
+	}, r.rooms)
+	assert.Equal(t, [][2]string{
+		{"acme/town-square", "alice"},
+		{"direct/alice,bob", "alice"},
+		{"direct/alice,bob", "bob"},
+	}, r.members)
+
+	require.Len(t, r.messages, 3)
+	assert.Equal(t, "acme/town-square/alice/1704067200000", r.messages[0].ID)
+	assert.Equal(t, r.messages[0].ID, r.messages[1].ParentID)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 1, 0, 0, time.UTC), r.messages[1].CreatedAt)
+	assert.Equal(t, "direct/alice,bob", r.messages[2].RoomID)
+	assert.False(t, r.messages[2].EditedAt.IsZero())
+}
+
+func TestRead_UnknownFormat(t *testing.T) {
+	assert.ErrorIs(t, Read("teams", "export.zip", &recorder{}), ErrUnknownFormat)
+}
@@ -0,0 +1,218 @@
+package importer
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+type mattermostLine struct {
+	Type          string               `json:"type"`
+	Channel       *mattermostChannel   `json:"channel"`
+	User          *mattermostUser      `json:"user"`
+	Post          *mattermostPost      `json:"post"`
+	DirectChannel *mattermostDirect    `json:"direct_channel"`
+	DirectPost    *mattermostDirectMsg `json:"direct_post"`
+}
+
+type mattermostChannel struct {
+	Team        string `json:"team"`
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	Type        string `json:"type"`
+}
+
+type mattermostUser struct {
+	Username string `json:"username"`
+	Teams    []struct {
+		Name     string `json:"name"`
+		Channels []struct {
+			Name string `json:"name"`
+		} `json:"channels"`
+	} `json:"teams"`
+}
+
+type mattermostReply struct {
+	User     string `json:"user"`
+	Message  string `json:"message"`
+	CreateAt int64  `json:"create_at"`
+	EditAt   int64  `json:"edit_at"`
+}
+
+type mattermostPost struct {
+	Team    string            `json:"team"`
+	Channel string            `json:"channel"`
+	Replies []mattermostReply `json:"replies"`
+	mattermostReply
+}
+
+type mattermostDirect struct {
+	Members []string `json:"members"`
+}
+
+type mattermostDirectMsg struct {
+	ChannelMembers []string          `json:"channel_members"`
+	Replies        []mattermostReply `json:"replies"`
+	mattermostReply
+}
+
+// ReadMattermost reads a Mattermost bulk export, a JSON Lines file with one object per line.
+// Channels are identified by team and name, users by username. Posts have no IDs in the export,
+// so a post is identified by its channel, author and creation time
+func ReadMattermost(path string, sink Sink) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	// Posts with long messages and many replies don't fit into the default 64 KB
+	scanner.Buffer(make([]byte, 0, 1<<20), 64<<20)
+
+	users := make(map[string]bool)
+	rooms := make(map[string]bool)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+
+		var l mattermostLine
+		if err := json.Unmarshal(line, &l); err != nil {
+			return fmt.Errorf("line %d: %w", n, err)
+		}
+		if err := readMattermostLine(&l, users, rooms, sink); err != nil {
+			return fmt.Errorf("line %d: %w", n, err)
+		}
+	}
+
+	return scanner.Err()
+}
+
+func readMattermostLine(l *mattermostLine, users, rooms map[string]bool, sink Sink) error {
+	switch {
+	case l.Type == "channel" && l.Channel != nil:
+		name := l.Channel.DisplayName
+		if name == "" {
+			name = l.Channel.Name
+		}
+		id := mattermostChannelID(l.Channel.Team, l.Channel.Name)
+		rooms[id] = true
+		return sink.Room(&Room{ID: id, Name: name, Private: l.Channel.Type == "P"})
+
+	case l.Type == "user" && l.User != nil:
+		if err := ensureMattermostUser(l.User.Username, users, sink); err != nil {
+			return err
+		}
+		for _, team := range l.User.Teams {
+			for _, channel := range team.Channels {
+				id := mattermostChannelID(team.Name, channel.Name)
+				if !rooms[id] {
+					continue
+				}
+				if err := sink.Member(id, l.User.Username); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+
+	case l.Type == "direct_channel" && l.DirectChannel != nil:
+		_, err := ensureMattermostDirect(l.DirectChannel.Members, users, rooms, sink)
+		return err
+
+	case l.Type == "post" && l.Post != nil:
+		id := mattermostChannelID(l.Post.Team, l.Post.Channel)
+		if !rooms[id] {
+			return fmt.Errorf("post in unknown channel %s", id)
+		}
+		return readMattermostPost(id, &l.Post.mattermostReply, l.Post.Replies, users, sink)
+
+	case l.Type == "direct_post" && l.DirectPost != nil:
+		id, err := ensureMattermostDirect(l.DirectPost.ChannelMembers, users, rooms, sink)
+		if err != nil {
+			return err
+		}
+		return readMattermostPost(id, &l.DirectPost.mattermostReply, l.DirectPost.Replies, users, sink)
+	}
+
+	// Teams, schemes, emoji and other objects have no counterpart in ChatGO
+	return nil
+}
+
+func readMattermostPost(roomID string, post *mattermostReply, replies []mattermostReply, users map[string]bool, sink Sink) error {
+	root := mattermostMessage(roomID, post, "")
+	if err := ensureMattermostUser(post.User, users, sink); err != nil {
+		return err
+	}
+	if err := sink.Message(root); err != nil {
+		return err
+	}
+
+	for i := range replies {
+		if err := ensureMattermostUser(replies[i].User, users, sink); err != nil {
+			return err
+		}
+		if err := sink.Message(mattermostMessage(roomID, &replies[i], root.ID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func mattermostMessage(roomID string, post *mattermostReply, parentID string) *Message {
+	msg := &Message{
+		ID:        fmt.Sprintf("%s/%s/%d", roomID, post.User, post.CreateAt),
+		RoomID:    roomID,
+		UserID:    post.User,
+		ParentID:  parentID,
+		Text:      post.Message,
+		CreatedAt: time.UnixMilli(post.CreateAt).UTC(),
+	}
+	if post.EditAt > 0 {
+		msg.EditedAt = time.UnixMilli(post.EditAt).UTC()
+	}
+	return msg
+}
+
+// ensureMattermostUser sends users that posted but are missing from the export, such as deactivated ones
+func ensureMattermostUser(username string, users map[string]bool, sink Sink) error {
+	if users[username] {
+		return nil
+	}
+	users[username] = true
+	return sink.User(&User{ID: username, Username: username})
+}
+
+// ensureMattermostDirect sends a direct channel and its members the first time it's seen
+func ensureMattermostDirect(members []string, users, rooms map[string]bool, sink Sink) (string, error) {
+	sorted := append([]string(nil), members...)
+	sort.Strings(sorted)
+	id := "direct/" + strings.Join(sorted, ",")
+	if rooms[id] {
+		return id, nil
+	}
+	rooms[id] = true
+
+	if err := sink.Room(&Room{ID: id, Name: strings.Join(sorted, ", "), Private: true, Direct: true}); err != nil {
+		return "", err
+	}
+	for _, member := range sorted {
+		if err := ensureMattermostUser(member, users, sink); err != nil {
+			return "", err
+		}
+		if err := sink.Member(id, member); err != nil {
+			return "", err
+		}
+	}
+	return id, nil
+}
+
+func mattermostChannelID(team, channel string) string {
+	return team + "/" + channel
+}
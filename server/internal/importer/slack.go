@@ -0,0 +1,254 @@
+package importer
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type slackUser struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type slackChannel struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Creator string   `json:"creator"`
+	Members []string `json:"members"`
+}
+
+type slackFile struct {
+	Name  string `json:"name"`
+	Title string `json:"title"`
+}
+
+type slackMessage struct {
+	Type     string `json:"type"`
+	Subtype  string `json:"subtype"`
+	User     string `json:"user"`
+	Text     string `json:"text"`
+	TS       string `json:"ts"`
+	ThreadTS string `json:"thread_ts"`
+	Edited   *struct {
+		TS string `json:"ts"`
+	} `json:"edited"`
+	Files []slackFile `json:"files"`
+}
+
+// slackSubtypes are the message subtypes that carry user content. Others, such as
+// channel_join or channel_topic, are system events and are skipped
+var slackSubtypes = map[string]bool{
+	"":                 true,
+	"thread_broadcast": true,
+	"file_share":       true,
+	"me_message":       true,
+}
+
+// slackLists are the files of a Slack export that list rooms
+var slackLists = []struct {
+	file    string
+	private bool
+	direct  bool
+}{
+	{"channels.json", false, false},
+	{"groups.json", true, false},
+	{"mpims.json", true, true},
+	{"dms.json", true, true},
+}
+
+var (
+	slackUserRef    = regexp.MustCompile(`<@([A-Z0-9]+)(?:\|[^>]*)?>`)
+	slackChannelRef = regexp.MustCompile(`<#[A-Z0-9]+\|([^>]*)>`)
+	slackSpecialRef = regexp.MustCompile(`<!(here|channel|everyone)(?:\|[^>]*)?>`)
+	slackLinkRef    = regexp.MustCompile(`<((?:https?|mailto):[^>|]+)(?:\|([^>]*))?>`)
+)
+
+// ReadSlack reads a Slack workspace export zip: users.json, the room lists and one
+// file of messages per room and day
+func ReadSlack(path string, sink Sink) error {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	var users []slackUser
+	if err := readJSONFile(archive, "users.json", &users); err != nil {
+		return err
+	}
+	usernames := make(map[string]string, len(users))
+	for _, u := range users {
+		usernames[u.ID] = u.Name
+		if err := sink.User(&User{ID: u.ID, Username: u.Name}); err != nil {
+			return err
+		}
+	}
+
+	for _, list := range slackLists {
+		var channels []slackChannel
+		if err := readJSONFile(archive, list.file, &channels); err != nil {
+			if list.file != "channels.json" && errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return err
+		}
+
+		for _, channel := range channels {
+			if err := readSlackChannel(archive, channel, list.private, list.direct, usernames, sink); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func readSlackChannel(archive *zip.ReadCloser, channel slackChannel, private, direct bool, usernames map[string]string, sink Sink) error {
+	name := channel.Name
+	if name == "" {
+		// Direct messages have no name, their directory is named after the ID
+		names := make([]string, 0, len(channel.Members))
+		for _, member := range channel.Members {
+			names = append(names, usernames[member])
+		}
+		name = strings.Join(names, ", ")
+	}
+
+	err := sink.Room(&Room{ID: channel.ID, Name: name, Private: private, Direct: direct, CreatorID: channel.Creator})
+	if err != nil {
+		return err
+	}
+	for _, member := range channel.Members {
+		if err := sink.Member(channel.ID, member); err != nil {
+			return err
+		}
+	}
+
+	dir := channel.Name
+	if dir == "" {
+		dir = channel.ID
+	}
+	days, err := fs.Glob(archive, path.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	// Day files are named YYYY-MM-DD.json, so sorting them by name sorts them by date
+	sort.Strings(days)
+
+	for _, day := range days {
+		var messages []slackMessage
+		if err := readJSONFile(archive, day, &messages); err != nil {
+			return err
+		}
+		for _, m := range messages {
+			if m.Type != "message" || m.User == "" || !slackSubtypes[m.Subtype] {
+				continue
+			}
+			msg, err := convertSlackMessage(channel.ID, m, usernames)
+			if err != nil {
+				return fmt.Errorf("%s: %w", day, err)
+			}
+			if err := sink.Message(msg); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func convertSlackMessage(channelID string, m slackMessage, usernames map[string]string) (*Message, error) {
+	createdAt, err := parseSlackTS(m.TS)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &Message{
+		ID:        channelID + "/" + m.TS,
+		RoomID:    channelID,
+		UserID:    m.User,
+		Text:      slackText(m.Text, usernames),
+		CreatedAt: createdAt,
+	}
+	if m.ThreadTS != "" && m.ThreadTS != m.TS {
+		msg.ParentID = channelID + "/" + m.ThreadTS
+	}
+	if m.Edited != nil {
+		if msg.EditedAt, err = parseSlackTS(m.Edited.TS); err != nil {
+			return nil, err
+		}
+	}
+	// File contents aren't part of the export, only their names are kept
+	for _, f := range m.Files {
+		name := f.Name
+		if name == "" {
+			name = f.Title
+		}
+		msg.Text = strings.TrimSpace(msg.Text + "\n[file: " + name + "]")
+	}
+
+	return msg, nil
+}
+
+// parseSlackTS parses a Slack timestamp, seconds since the epoch with a fractional part
+func parseSlackTS(ts string) (time.Time, error) {
+	sec, frac, _ := strings.Cut(ts, ".")
+	s, err := strconv.ParseInt(sec, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp %q", ts)
+	}
+	var us int64
+	if frac != "" {
+		frac = (frac + "000000")[:6]
+		if us, err = strconv.ParseInt(frac, 10, 64); err != nil {
+			return time.Time{}, fmt.Errorf("invalid timestamp %q", ts)
+		}
+	}
+	return time.Unix(s, us*int64(time.Microsecond)).UTC(), nil
+}
+
+// slackText converts Slack markup to plain text: user references become @username,
+// @here and @channel become @room, and links keep their label and URL
+func slackText(text string, usernames map[string]string) string {
+	text = slackUserRef.ReplaceAllStringFunc(text, func(ref string) string {
+		id := slackUserRef.FindStringSubmatch(ref)[1]
+		if name, ok := usernames[id]; ok {
+			return "@" + name
+		}
+		return ref
+	})
+	text = slackChannelRef.ReplaceAllString(text, "#$1")
+	text = slackSpecialRef.ReplaceAllString(text, "@room")
+	text = slackLinkRef.ReplaceAllStringFunc(text, func(ref string) string {
+		parts := slackLinkRef.FindStringSubmatch(ref)
+		url := strings.TrimPrefix(parts[1], "mailto:")
+		if parts[2] == "" || parts[2] == url {
+			return url
+		}
+		return parts[2] + " (" + url + ")"
+	})
+	return html.UnescapeString(text)
+}
+
+func readJSONFile(fsys fs.FS, name string, v interface{}) error {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := json.NewDecoder(f).Decode(v); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
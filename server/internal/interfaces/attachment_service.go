@@ -0,0 +1,9 @@
+package interfaces
+
+import "context"
+
+// AttachmentService определяет методы для загрузки и скачивания файлов
+type AttachmentService interface {
+	UploadAttachment(c context.Context, req *UploadAttachmentReq) (*AttachmentRes, error)
+	DownloadAttachment(c context.Context, userID string, attachmentID string) (*DownloadAttachmentRes, error)
+}
@@ -0,0 +1,14 @@
+package interfaces
+
+import "context"
+
+// BotService определяет методы для ботов, их API-токенов и входящих вебхуков
+type BotService interface {
+	CreateBot(c context.Context, req *CreateBotReq) (*BotRes, error)
+	GetBots(c context.Context, userID string) ([]*BotRes, error)
+	CreateBotToken(c context.Context, req *CreateBotTokenReq) (*BotTokenRes, error)
+	CreateIncomingWebhook(c context.Context, req *CreateIncomingWebhookReq) (*BotTokenRes, error)
+	GetBotTokens(c context.Context, userID, botID string) ([]*BotTokenRes, error)
+	RevokeBotToken(c context.Context, userID, tokenID string) error
+	PostBotMessage(c context.Context, req *BotMessageReq) (*CreateMessageRes, error)
+}
@@ -26,4 +26,7 @@ type ChatRoomService interface {
 	AddUserToChatRoom(c context.Context, req *AddUserToChatRoomReq) error
 	RemoveUserFromChatRoom(c context.Context, req *AddUserToChatRoomReq) error
 	GetMembersByChatRoomID(c context.Context, roomID string) ([]*models.ChatRoomMember, error)
+	GetMemberRole(c context.Context, userID, roomID string) (models.MemberRole, error)
+	InviteMember(c context.Context, req *RoomMemberReq) (*RoomMemberRes, error)
+	KickMember(c context.Context, req *RoomMemberReq) (*RoomMemberRes, error)
 }
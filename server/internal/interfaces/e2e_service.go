@@ -0,0 +1,9 @@
+package interfaces
+
+import "context"
+
+// E2EService определяет методы для обмена открытыми ключами в чатах со сквозным шифрованием
+type E2EService interface {
+	PublishPublicKey(c context.Context, req *PublishPublicKeyReq) error
+	GetRoomPublicKeys(c context.Context, userID string, roomID string) (*RoomKeysRes, error)
+}
@@ -0,0 +1,74 @@
+package interfaces
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Errors returned by services that transport maps to specific HTTP statuses
+var (
+	ErrNotRoomMember      = errors.New("user is not a member of the room")
+	ErrNotRoomAdmin       = errors.New("user is not an admin of the room")
+	ErrRoomNotFound       = errors.New("room not found")
+	ErrAttachmentNotFound = errors.New("attachment not found")
+	ErrAttachmentTooLarge = errors.New("attachment is too large")
+	ErrE2ERoom            = errors.New("not available in end-to-end encrypted rooms")
+	ErrInvalidTTL         = errors.New("message time-to-live must be between 0 and 365 days")
+	ErrTooManyPins        = errors.New("too many pinned messages in the room, unpin one first")
+	ErrTopicTooLong       = errors.New("room topic is too long")
+	ErrInvalidSendTime    = errors.New("send time must be in the future and within a year")
+	ErrScheduledNotFound  = errors.New("scheduled message not found")
+	ErrWebhookNotFound    = errors.New("webhook not found")
+	ErrInvalidWebhook     = errors.New("webhook needs an http or https URL and at least one known event")
+	ErrInvalidDelivery    = errors.New("delivery status must be pending, delivered or dead")
+	ErrBotNotFound        = errors.New("bot not found")
+	ErrNotBotOwner        = errors.New("user is not the owner of the bot")
+	ErrBotTokenNotFound   = errors.New("bot token not found")
+	ErrInvalidBotToken    = errors.New("invalid or revoked bot token")
+	ErrRoomNotGranted     = errors.New("bot token is not granted access to the room")
+	ErrUserNotFound       = errors.New("user not found")
+	ErrAlreadyMember      = errors.New("user is already a member of the room")
+	ErrCannotKick         = errors.New("members with the same or a higher role can't be removed")
+	ErrPollNotFound       = errors.New("poll not found")
+	ErrPollClosed         = errors.New("poll is closed")
+	ErrInvalidPoll        = errors.New("a poll needs a question and 2 to 10 different options")
+	ErrInvalidVote        = errors.New("invalid poll option")
+	ErrNotPollCreator     = errors.New("only the creator of the poll or a room admin can close it")
+	// ErrInvalidCredentials is returned both for unknown usernames and wrong passwords,
+	// so that a failed login doesn't reveal whether the account exists
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrAccountLocked      = errors.New("too many failed logins")
+	ErrNotServerAdmin     = errors.New("user is not a server admin")
+	// ErrLoginExpired is returned for a missing, invalid or expired two-factor login token
+	ErrLoginExpired           = errors.New("login has expired, log in again")
+	ErrInvalidTwoFactorCode   = errors.New("invalid two-factor code")
+	ErrTwoFactorEnabled       = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnrolled   = errors.New("two-factor authentication is not set up")
+	ErrAdminTwoFactorRequired = errors.New("server admins must have two-factor authentication enabled")
+	// ErrWeakPassword is wrapped with the policy rule that a new password breaks
+	ErrWeakPassword      = errors.New("password doesn't meet the password policy")
+	ErrWrongPassword     = errors.New("current password is wrong")
+	ErrInvalidResetToken = errors.New("invalid, used or expired password reset token")
+	// ErrInvalidUsername and ErrInvalidProfile are wrapped with the rule that the value breaks
+	ErrInvalidUsername = errors.New("invalid username")
+	ErrUsernameTaken   = errors.New("username is already taken")
+	ErrInvalidProfile  = errors.New("invalid profile")
+)
+
+// LockedError is returned by LoginTwoFactor while the account is locked after failed logins.
+// Login answers ErrInvalidCredentials instead, so that the lock doesn't reveal the account.
+// It matches ErrAccountLocked
+type LockedError struct {
+	Until time.Time
+}
+
+func (e *LockedError) Error() string {
+	wait := max(time.Until(e.Until), time.Second)
+	return fmt.Sprintf("%s, try again in %ds", ErrAccountLocked, int(math.Ceil(wait.Seconds())))
+}
+
+func (e *LockedError) Is(target error) bool {
+	return target == ErrAccountLocked
+}
@@ -0,0 +1,9 @@
+package interfaces
+
+import "context"
+
+// ExpiryService определяет методы для исчезающих сообщений
+type ExpiryService interface {
+	SetRoomMessageTTL(c context.Context, req *SetMessageTTLReq) (*CreateChatRoomRes, error)
+	ExpireMessages(c context.Context) ([]*ExpiredMessageRes, error)
+}
@@ -0,0 +1,12 @@
+package interfaces
+
+import (
+	"context"
+	"io"
+)
+
+// ExportService определяет методы для выгрузки истории чатов
+type ExportService interface {
+	ExportMessages(c context.Context, req *ExportMessagesReq, w io.Writer) error
+	ExportMessagesAsOperator(c context.Context, req *ExportMessagesReq, w io.Writer) error
+}
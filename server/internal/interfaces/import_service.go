@@ -0,0 +1,8 @@
+package interfaces
+
+import "context"
+
+// ImportService определяет методы для переноса истории из других мессенджеров
+type ImportService interface {
+	ImportHistory(c context.Context, req *ImportHistoryReq) (*ImportHistoryRes, error)
+}
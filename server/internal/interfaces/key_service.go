@@ -0,0 +1,10 @@
+package interfaces
+
+import "context"
+
+// KeyService определяет методы для ротации ключей шифрования чатов
+type KeyService interface {
+	RotateRoomKey(c context.Context, roomID string) (int, error)
+	ReencryptRoom(c context.Context, roomID string) (*ReencryptRoomRes, error)
+	RewrapKeys(c context.Context, masterKey string) (int, error)
+}
@@ -0,0 +1,9 @@
+package interfaces
+
+import "context"
+
+// MentionService определяет методы для работы с упоминаниями пользователей
+type MentionService interface {
+	GetMentions(c context.Context, req *GetMentionsReq) ([]*MentionRes, error)
+	MarkMentionsRead(c context.Context, req *MarkMentionsReadReq) error
+}
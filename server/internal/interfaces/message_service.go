@@ -4,5 +4,7 @@ import "context"
 
 type MessageService interface {
 	CreateMessage(c context.Context, req *CreateMessageReq) (*CreateMessageRes, error)
+	GetMessageByID(c context.Context, messageID string) (*CreateMessageRes, error)
 	GetMessagesByRoomID(c context.Context, roomID string, limit int) ([]*CreateMessageRes, error)
+	GetThreadMessages(c context.Context, parentID string, limit int) ([]*CreateMessageRes, error)
 }
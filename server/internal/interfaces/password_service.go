@@ -0,0 +1,10 @@
+package interfaces
+
+import "context"
+
+// PasswordService определяет методы смены и сброса пароля
+type PasswordService interface {
+	ChangePassword(c context.Context, req *ChangePasswordReq) (*LoginUserRes, error)
+	CreatePasswordReset(c context.Context, adminID, username string) (*PasswordResetRes, error)
+	ResetPassword(c context.Context, req *ResetPasswordReq) error
+}
@@ -0,0 +1,10 @@
+package interfaces
+
+import "context"
+
+// PinService определяет методы для закрепления сообщений в чатах
+type PinService interface {
+	PinMessage(c context.Context, req *PinReq) (*PinRes, error)
+	UnpinMessage(c context.Context, req *PinReq) (*PinRes, error)
+	GetPinnedMessages(c context.Context, roomID string) ([]*PinnedMessageRes, error)
+}
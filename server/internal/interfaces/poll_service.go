@@ -0,0 +1,12 @@
+package interfaces
+
+import "context"
+
+// PollService определяет методы для опросов в чатах
+type PollService interface {
+	CreatePoll(c context.Context, req *CreatePollReq) (*CreateMessageRes, error)
+	GetPoll(c context.Context, userID, pollID string) (*PollRes, error)
+	VotePoll(c context.Context, req *PollVoteReq) (*PollRes, error)
+	ClosePoll(c context.Context, userID, pollID string) (*PollRes, error)
+	CloseExpiredPolls(c context.Context) ([]*PollRes, error)
+}
@@ -0,0 +1,8 @@
+package interfaces
+
+import "context"
+
+// PresenceService определяет методы для обновления статуса присутствия пользователей
+type PresenceService interface {
+	SetUserStatus(c context.Context, userID string, status string) error
+}
@@ -0,0 +1,10 @@
+package interfaces
+
+import "context"
+
+// ProfileService определяет методы работы с профилями пользователей
+type ProfileService interface {
+	GetProfile(c context.Context, username string) (*UserProfileRes, error)
+	UpdateProfile(c context.Context, req *UpdateProfileReq) (*UserProfileRes, error)
+	GetUsersByIDs(c context.Context, ids []string) ([]*GetUserRes, error)
+}
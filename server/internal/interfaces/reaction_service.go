@@ -0,0 +1,9 @@
+package interfaces
+
+import "context"
+
+// ReactionService определяет методы для работы с реакциями на сообщения
+type ReactionService interface {
+	AddReaction(c context.Context, req *ReactionReq) (*ReactionRes, error)
+	RemoveReaction(c context.Context, req *ReactionReq) (*ReactionRes, error)
+}
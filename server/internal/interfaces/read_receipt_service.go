@@ -0,0 +1,10 @@
+package interfaces
+
+import "context"
+
+// ReadReceiptService определяет методы для отметок о прочтении и счётчиков непрочитанных сообщений
+type ReadReceiptService interface {
+	MarkRoomRead(c context.Context, req *MarkRoomReadReq) error
+	GetMyRooms(c context.Context, userID string) ([]*MyRoomRes, error)
+	GetSeenBy(c context.Context, userID, messageID string) ([]string, error)
+}
@@ -0,0 +1,13 @@
+package interfaces
+
+import "context"
+
+// RetentionService определяет методы для управления сроками хранения сообщений
+type RetentionService interface {
+	GetRetentionPolicy(c context.Context, userID, roomID string) (*RetentionPolicyRes, error)
+	SetRetentionPolicy(c context.Context, req *SetRetentionPolicyReq) (*RetentionPolicyRes, error)
+	SetLegalHold(c context.Context, roomID string, hold bool) (*RetentionPolicyRes, error)
+	PurgeExpiredMessages(c context.Context) (*PurgeRes, error)
+	GetPurgeLog(c context.Context, roomID string, limit int) ([]*RetentionPurgeRes, error)
+	RunRetention(c context.Context)
+}
@@ -0,0 +1,11 @@
+package interfaces
+
+import "context"
+
+// ScheduleService определяет методы для отложенных сообщений
+type ScheduleService interface {
+	ScheduleMessage(c context.Context, req *ScheduleMessageReq) (*ScheduledMessageRes, error)
+	GetScheduledMessages(c context.Context, userID, roomID string) ([]*ScheduledMessageRes, error)
+	CancelScheduledMessage(c context.Context, userID, id string) error
+	DeliverScheduledMessages(c context.Context) ([]*CreateMessageRes, error)
+}
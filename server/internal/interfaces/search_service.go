@@ -0,0 +1,9 @@
+package interfaces
+
+import "context"
+
+// SearchService определяет методы для поиска по сообщениям
+type SearchService interface {
+	SearchMessages(c context.Context, req *SearchMessagesReq) ([]*CreateMessageRes, error)
+	BuildSearchIndex(c context.Context) error
+}
@@ -1,10 +1,29 @@
 package interfaces
 
+import "time"
+
 // Service defines the interface for all service operations
 type Service interface {
 	UserService
+	BotService
+	PollService
 	MessageService
 	ChatRoomService
+	SearchService
+	ReactionService
+	PinService
+	ScheduleService
+	WebhookService
+	MentionService
+	ReadReceiptService
+	PresenceService
+	AttachmentService
+	KeyService
+	E2EService
+	ExportService
+	ImportService
+	RetentionService
+	ExpiryService
 }
 
 // CreateUserReq represents the request to create a new user
@@ -23,6 +42,9 @@ type CreateUserRes struct {
 type LoginUserReq struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	// IP and UserAgent are recorded in the login history
+	IP        string `json:"-"`
+	UserAgent string `json:"-"`
 }
 
 // LoginUserRes represents the response after logging in
@@ -30,6 +52,72 @@ type LoginUserRes struct {
 	ID          string `json:"id"`
 	Username    string `json:"username"`
 	AccessToken string `json:"accessToken"`
+	// TwoFactorRequired is set instead of AccessToken for accounts with two-factor authentication.
+	// The login is finished by sending TwoFactorToken with a code to POST /login/2fa
+	TwoFactorRequired bool   `json:"twoFactorRequired,omitempty"`
+	TwoFactorToken    string `json:"twoFactorToken,omitempty"`
+	// TwoFactorSetupRequired is set for server admins who must enable two-factor authentication
+	// before they can use admin endpoints
+	TwoFactorSetupRequired bool `json:"twoFactorSetupRequired,omitempty"`
+}
+
+// ChangePasswordReq represents a password change by the account owner. It revokes the
+// access tokens of all the other sessions
+type ChangePasswordReq struct {
+	UserID          string `json:"-"`
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+// PasswordResetRes represents a one-time password reset token issued by a server admin.
+// The admin passes it to the user, who sets a new password with it before ExpiresAt
+type PasswordResetRes struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// ResetPasswordReq represents setting a new password with a reset token
+type ResetPasswordReq struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"newPassword"`
+}
+
+// LoginTwoFactorReq represents the second step of a login with two-factor authentication.
+// Code is a code from the authenticator app or a recovery code
+type LoginTwoFactorReq struct {
+	Token     string `json:"token"`
+	Code      string `json:"code"`
+	IP        string `json:"-"`
+	UserAgent string `json:"-"`
+}
+
+// TwoFactorEnrollRes represents a new TOTP secret that is enabled once it is confirmed with a code.
+// QRCode is URI as a QR code drawn with block characters
+type TwoFactorEnrollRes struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+	QRCode string `json:"qrCode"`
+}
+
+// TwoFactorCodeReq represents a request confirmed with a two-factor code
+type TwoFactorCodeReq struct {
+	UserID string `json:"-"`
+	Code   string `json:"code"`
+}
+
+// TwoFactorConfirmRes represents the recovery codes issued when two-factor authentication is enabled.
+// Each code can be used once instead of a code from the authenticator app
+type TwoFactorConfirmRes struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// LoginAttemptRes represents an entry of the user's login history
+type LoginAttemptRes struct {
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"userAgent,omitempty"`
+	Success   bool      `json:"success"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
 }
 
 // GetUserReq represents the request to get a user
@@ -39,25 +127,71 @@ type GetUserReq struct {
 
 // GetUserRes represents the response after getting a user
 type GetUserRes struct {
-	ID       string `json:"id"`
-	Username string `json:"username"`
+	ID          string `json:"id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"displayName,omitempty"`
+	Status      string `json:"status,omitempty"`
+	StatusText  string `json:"statusText,omitempty"`
+	LastLogin   string `json:"lastLogin,omitempty"`
+	LastSeenAt  string `json:"lastSeenAt,omitempty"`
+	Bot         bool   `json:"bot,omitempty"`
+}
+
+// UserProfileRes represents the public profile of a user
+type UserProfileRes struct {
+	ID          string    `json:"id"`
+	Username    string    `json:"username"`
+	DisplayName string    `json:"displayName,omitempty"`
+	Bio         string    `json:"bio,omitempty"`
+	AvatarID    string    `json:"avatarId,omitempty"`
+	Timezone    string    `json:"timezone,omitempty"`
+	Status      string    `json:"status,omitempty"`
+	StatusText  string    `json:"statusText,omitempty"`
+	IsBot       bool      `json:"isBot,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+	LastSeenAt  string    `json:"lastSeenAt,omitempty"`
+}
+
+// UpdateProfileReq represents changes to the caller's profile. Fields that are not set
+// stay as they are, an empty value clears the field
+type UpdateProfileReq struct {
+	UserID      string  `json:"-"`
+	DisplayName *string `json:"displayName,omitempty"`
+	Bio         *string `json:"bio,omitempty"`
+	// AvatarID is an image attachment uploaded by the caller
+	AvatarID *string `json:"avatarId,omitempty"`
+	// Timezone is an IANA time zone name, such as Europe/Berlin
+	Timezone   *string `json:"timezone,omitempty"`
+	StatusText *string `json:"statusText,omitempty"`
 }
 
 // CreateChatRoomReq represents the request to create a chat room
 type CreateChatRoomReq struct {
 	Name string `json:"name"`
+	// E2E makes an end-to-end encrypted room, it can't be changed later
+	E2E bool `json:"e2e"`
+	// MessageTTL makes messages of the room disappear after this many seconds
+	MessageTTL int `json:"messageTtl,omitempty"`
+	// Topic is the room topic or description shown to new members
+	Topic string `json:"topic,omitempty"`
 }
 
 // CreateChatRoomRes represents the response after creating a chat room
 type CreateChatRoomRes struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	E2E        bool   `json:"e2e"`
+	MessageTTL int    `json:"messageTtl,omitempty"`
+	Topic      string `json:"topic,omitempty"`
 }
 
 // UpdateChatRoomReq represents the request to update a chat room
 type UpdateChatRoomReq struct {
 	ID   string `json:"id"`
 	Name string `json:"name"`
+	// Topic changes the room topic when set, an empty topic clears it. Only room admins may change it
+	Topic  *string `json:"topic,omitempty"`
+	UserID string  `json:"-"`
 }
 
 // AddUserToChatRoomReq represents the request to add a user to a chat room
@@ -66,18 +200,467 @@ type AddUserToChatRoomReq struct {
 	ChatRoomID string `json:"chatRoomId"`
 }
 
+// RoomMemberReq represents a request of a room admin to add or remove the member with the
+// given username
+type RoomMemberReq struct {
+	UserID   string `json:"-"`
+	RoomID   string `json:"-"`
+	Username string `json:"username"`
+}
+
+// RoomMemberRes represents a room member
+type RoomMemberRes struct {
+	UserID   string `json:"userId"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
 // CreateMessageReq represents the request to create a message
 type CreateMessageReq struct {
 	Content  string `json:"content"`
 	RoomID   string `json:"roomId"`
 	Username string `json:"username"`
+	ParentID string `json:"parentId,omitempty"`
+	// Encrypted marks content encrypted by the client, it is required in end-to-end encrypted rooms
+	Encrypted bool `json:"encrypted,omitempty"`
+	// TTL makes the message disappear after this many seconds. The shorter of TTL and
+	// the room's message TTL applies
+	TTL int `json:"ttl,omitempty"`
+
+	AttachmentIDs []string `json:"attachmentIds,omitempty"`
 }
 
 // CreateMessageRes represents the response after creating a message
 type CreateMessageRes struct {
-	ID        string `json:"id"`
-	Content   string `json:"content"`
+	ID          string              `json:"id"`
+	Content     string              `json:"content"`
+	RoomID      string              `json:"roomId"`
+	Username    string              `json:"username"`
+	CreatedAt   string              `json:"createdAt"`
+	ParentID    string              `json:"parentId,omitempty"`
+	ReplyCount  int                 `json:"replyCount"`
+	LastReplyAt string              `json:"lastReplyAt,omitempty"`
+	Reactions   []*ReactionCountRes `json:"reactions,omitempty"`
+	Mentions    []string            `json:"mentions,omitempty"`
+	Attachments []*AttachmentRes    `json:"attachments,omitempty"`
+	Encrypted   bool                `json:"encrypted,omitempty"`
+	ExpiresAt   string              `json:"expiresAt,omitempty"`
+	// Bot marks messages sent by bots
+	Bot bool `json:"bot,omitempty"`
+	// Poll is set for messages that show a poll
+	Poll *PollRes `json:"poll,omitempty"`
+}
+
+// SearchMessagesReq represents the request to search messages in the user's rooms
+type SearchMessagesReq struct {
+	UserID string `json:"userId"`
+	Query  string `json:"query"`
+	Limit  int    `json:"limit"`
+}
+
+// ReactionReq represents the request to add or remove a reaction on a message
+type ReactionReq struct {
+	MessageID string `json:"messageId"`
 	RoomID    string `json:"roomId"`
 	Username  string `json:"username"`
-	CreatedAt string `json:"createdAt"`
+	Emoji     string `json:"emoji"`
+}
+
+// ReactionCountRes represents the number of reactions with one emoji
+type ReactionCountRes struct {
+	Emoji string `json:"emoji"`
+	Count int    `json:"count"`
+}
+
+// ReactionRes represents the response after adding or removing a reaction
+type ReactionRes struct {
+	MessageID string              `json:"messageId"`
+	Emoji     string              `json:"emoji"`
+	Changed   bool                `json:"changed"`
+	Reactions []*ReactionCountRes `json:"reactions"`
+}
+
+// GetMentionsReq represents the request to get the user's mention inbox
+type GetMentionsReq struct {
+	UserID     string `json:"userId"`
+	UnreadOnly bool   `json:"unreadOnly"`
+	Limit      int    `json:"limit"`
+}
+
+// MentionRes represents a mention of the user together with the message
+type MentionRes struct {
+	ID      string            `json:"id"`
+	IsRead  bool              `json:"isRead"`
+	Message *CreateMessageRes `json:"message"`
+}
+
+// MarkMentionsReadReq represents the request to mark mentions as read, all of them when IDs is empty
+type MarkMentionsReadReq struct {
+	UserID string   `json:"userId"`
+	IDs    []string `json:"ids"`
+}
+
+// MarkRoomReadReq represents the request to move the user's read marker in a room,
+// up to the latest message when MessageID is empty
+type MarkRoomReadReq struct {
+	UserID    string `json:"userId"`
+	RoomID    string `json:"roomId"`
+	MessageID string `json:"messageId"`
+}
+
+// MyRoomRes represents a room of the user with unread count and last message preview
+type MyRoomRes struct {
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	UnreadCount int               `json:"unreadCount"`
+	LastMessage *CreateMessageRes `json:"lastMessage,omitempty"`
+}
+
+// UploadAttachmentReq represents an uploaded file
+type UploadAttachmentReq struct {
+	UserID   string
+	RoomID   string
+	Filename string
+	Data     []byte
+}
+
+// AttachmentRes represents file metadata in responses
+type AttachmentRes struct {
+	ID          string `json:"id"`
+	RoomID      string `json:"roomId"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size"`
+}
+
+// DownloadAttachmentRes represents a decrypted file with its metadata
+type DownloadAttachmentRes struct {
+	AttachmentRes
+	Data []byte
+}
+
+// ReencryptRoomRes represents the result of re-encrypting room history with the current key
+type ReencryptRoomRes struct {
+	RoomID      string `json:"roomId"`
+	KeyVersion  int    `json:"keyVersion"`
+	Messages    int    `json:"messages"`
+	Attachments int    `json:"attachments"`
+	Failed      int    `json:"failed"`
+}
+
+// PublishPublicKeyReq represents the request to publish the user's long-term public key
+type PublishPublicKeyReq struct {
+	UserID    string `json:"-"`
+	PublicKey string `json:"publicKey"`
+}
+
+// PublicKeyRes represents a room member's public key
+type PublicKeyRes struct {
+	UserID    string `json:"userId"`
+	Username  string `json:"username"`
+	PublicKey string `json:"publicKey"`
+}
+
+// RoomKeysRes represents public keys of the room members that clients encrypt messages to
+type RoomKeysRes struct {
+	RoomID string          `json:"roomId"`
+	E2E    bool            `json:"e2e"`
+	Keys   []*PublicKeyRes `json:"keys"`
+}
+
+// ExportMessagesReq represents a request to export room history.
+// Zero From and To mean no bound. UserID must be an admin of the room unless the operator exports it
+type ExportMessagesReq struct {
+	UserID string
+	RoomID string
+	Format string
+	From   time.Time
+	To     time.Time
+}
+
+// ImportHistoryReq represents a request to import an export of another chat system.
+// Format is slack for a workspace export zip or mattermost for a bulk export JSONL file
+type ImportHistoryReq struct {
+	Format string
+	Path   string
+}
+
+// ImportHistoryRes counts what an import created. Objects imported by an earlier run are not counted
+type ImportHistoryRes struct {
+	Users    int `json:"users"`
+	Rooms    int `json:"rooms"`
+	Members  int `json:"members"`
+	Messages int `json:"messages"`
+	// Renamed counts new users whose username was taken and who got a suffix
+	Renamed int `json:"renamed"`
+	// Skipped counts messages and memberships of users missing from the export
+	Skipped int `json:"skipped"`
+}
+
+// Sources of a retention limit in RetentionPolicyRes
+const (
+	RetentionSourceRoom   = "room"
+	RetentionSourceGlobal = "global"
+)
+
+// RetentionPolicyRes represents the effective retention policy of a room. Zero limits mean
+// messages are kept forever, the source fields tell whether a limit is set for the room
+// or inherited from the global policy
+type RetentionPolicyRes struct {
+	RoomID            string `json:"roomId"`
+	MaxAgeDays        int    `json:"maxAgeDays"`
+	MaxAgeSource      string `json:"maxAgeSource"`
+	MaxMessages       int    `json:"maxMessages"`
+	MaxMessagesSource string `json:"maxMessagesSource"`
+	LegalHold         bool   `json:"legalHold"`
+	Archive           bool   `json:"archive"`
+}
+
+// SetRetentionPolicyReq represents a request to change the retention limits of a room.
+// A nil limit inherits the global policy, zero keeps messages forever
+type SetRetentionPolicyReq struct {
+	RoomID      string
+	MaxAgeDays  *int
+	MaxMessages *int
+}
+
+// PurgeRes represents the result of applying retention policies to all rooms
+type PurgeRes struct {
+	Rooms       int `json:"rooms"`
+	Messages    int `json:"messages"`
+	Attachments int `json:"attachments"`
+}
+
+// RetentionPurgeRes represents an entry of the purge log
+type RetentionPurgeRes struct {
+	ID          string    `json:"id"`
+	RoomID      string    `json:"roomId"`
+	Reason      string    `json:"reason"`
+	Messages    int       `json:"messages"`
+	Attachments int       `json:"attachments"`
+	Archived    bool      `json:"archived"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// SetMessageTTLReq represents a request to change how long messages of a room live.
+// Zero turns disappearing messages off
+type SetMessageTTLReq struct {
+	UserID string `json:"-"`
+	RoomID string `json:"-"`
+	TTL    int    `json:"ttl"`
+}
+
+// ExpiredMessageRes identifies a disappearing message that was deleted
+type ExpiredMessageRes struct {
+	ID     string `json:"id"`
+	RoomID string `json:"roomId"`
+}
+
+// PinReq represents a request to pin or unpin a message
+type PinReq struct {
+	UserID    string `json:"-"`
+	RoomID    string `json:"roomId"`
+	MessageID string `json:"messageId"`
+}
+
+// PinnedMessageRes represents a pinned message with who pinned it and when
+type PinnedMessageRes struct {
+	Message  *CreateMessageRes `json:"message"`
+	PinnedBy string            `json:"pinnedBy"`
+	PinnedAt string            `json:"pinnedAt"`
+}
+
+// PinRes represents the result of pinning or unpinning a message.
+// Changed is false when the message was already pinned or not pinned
+type PinRes struct {
+	MessageID string              `json:"messageId"`
+	Changed   bool                `json:"changed"`
+	Pins      []*PinnedMessageRes `json:"pins"`
+}
+
+// ScheduleMessageReq represents a request to send a message to a room at a later time
+type ScheduleMessageReq struct {
+	UserID  string `json:"-"`
+	RoomID  string `json:"-"`
+	Content string `json:"content"`
+	// SendAt is an RFC 3339 time within a year from now
+	SendAt string `json:"sendAt"`
+	// Encrypted marks content encrypted by the client, it is required in end-to-end encrypted rooms
+	Encrypted bool `json:"encrypted,omitempty"`
+}
+
+// ScheduledMessageRes represents a message waiting to be sent
+type ScheduledMessageRes struct {
+	ID        string `json:"id"`
+	RoomID    string `json:"roomId"`
+	Content   string `json:"content"`
+	SendAt    string `json:"sendAt"`
+	Encrypted bool   `json:"encrypted,omitempty"`
+}
+
+// Room events that webhooks can subscribe to
+const (
+	WebhookEventMessageCreated = "message.created"
+	WebhookEventMemberJoined   = "member.joined"
+	WebhookEventMemberLeft     = "member.left"
+	WebhookEventRoomRenamed    = "room.renamed"
+)
+
+// CreateWebhookReq represents a request to subscribe an HTTP endpoint to room events
+type CreateWebhookReq struct {
+	UserID string   `json:"-"`
+	RoomID string   `json:"-"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+// WebhookRes represents a webhook subscription. Secret signs the deliveries and is only
+// returned when the webhook is created
+type WebhookRes struct {
+	ID        string    `json:"id"`
+	RoomID    string    `json:"roomId"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// WebhookEventReq represents a room event to deliver to the webhooks subscribed to it.
+// Data is sent as the data field of the payload. MessageID is set for message events,
+// their pending deliveries are dropped when the message is deleted
+type WebhookEventReq struct {
+	Event     string
+	RoomID    string
+	MessageID string
+	Data      interface{}
+}
+
+// WebhookPayload is the JSON body POSTed to webhook receivers
+type WebhookPayload struct {
+	Event     string      `json:"event"`
+	RoomID    string      `json:"roomId"`
+	Timestamp time.Time   `json:"timestamp"`
+	Data      interface{} `json:"data"`
+}
+
+// WebhookDeliveryRes represents a delivery in the delivery history of a webhook
+type WebhookDeliveryRes struct {
+	ID             string     `json:"id"`
+	Event          string     `json:"event"`
+	Payload        string     `json:"payload"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  *time.Time `json:"nextAttemptAt,omitempty"`
+	LastStatusCode int        `json:"lastStatusCode,omitempty"`
+	LastError      string     `json:"lastError,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	DeliveredAt    *time.Time `json:"deliveredAt,omitempty"`
+}
+
+// WebhookDeliveryRunRes represents the result of one delivery run
+type WebhookDeliveryRunRes struct {
+	Delivered int `json:"delivered"`
+	Retried   int `json:"retried"`
+	Dead      int `json:"dead"`
+}
+
+// CreateBotReq represents a request to create a bot user owned by the caller
+type CreateBotReq struct {
+	UserID   string `json:"-"`
+	Username string `json:"username"`
+}
+
+// BotRes represents a bot user
+type BotRes struct {
+	ID        string    `json:"id"`
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// CreateBotTokenReq represents a request to create an API token for a bot,
+// limited to the given rooms
+type CreateBotTokenReq struct {
+	UserID  string   `json:"-"`
+	BotID   string   `json:"-"`
+	Name    string   `json:"name"`
+	RoomIDs []string `json:"roomIds"`
+}
+
+// CreateIncomingWebhookReq represents a request to create an incoming webhook that posts
+// to the room as the given bot
+type CreateIncomingWebhookReq struct {
+	UserID string `json:"-"`
+	RoomID string `json:"-"`
+	BotID  string `json:"botId"`
+	Name   string `json:"name"`
+}
+
+// BotTokenRes represents an API token or an incoming webhook of a bot. Token is only
+// returned when it is created
+type BotTokenRes struct {
+	ID      string   `json:"id"`
+	BotID   string   `json:"botId"`
+	Name    string   `json:"name"`
+	Kind    string   `json:"kind"`
+	RoomIDs []string `json:"roomIds"`
+	Token   string   `json:"token,omitempty"`
+	// URL is the path to POST to for incoming webhooks, it contains the token
+	URL        string     `json:"url,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+}
+
+// BotMessageReq represents a message a bot posts to a room with an API token or an incoming
+// webhook. RoomID may be empty for incoming webhooks
+type BotMessageReq struct {
+	Token    string `json:"-"`
+	RoomID   string `json:"-"`
+	Content  string `json:"content"`
+	ParentID string `json:"parentId,omitempty"`
+}
+
+// CreatePollReq represents a request to post a poll to a room
+type CreatePollReq struct {
+	UserID   string   `json:"-"`
+	RoomID   string   `json:"-"`
+	Question string   `json:"question"`
+	Options  []string `json:"options"`
+	// Multiple allows voting for several options
+	Multiple bool `json:"multiple,omitempty"`
+	// Anonymous hides who voted for what, only the counts are shown
+	Anonymous bool `json:"anonymous,omitempty"`
+	// ClosesAt is an optional RFC 3339 time within 30 days when the poll closes
+	ClosesAt string `json:"closesAt,omitempty"`
+}
+
+// PollVoteReq represents the options a user votes for. Options are numbered from 1, a vote
+// replaces the earlier vote of the user and a vote without options withdraws it
+type PollVoteReq struct {
+	UserID  string `json:"-"`
+	PollID  string `json:"-"`
+	Options []int  `json:"options"`
+}
+
+// PollRes represents a poll with its results so far, or its final results once it is closed
+type PollRes struct {
+	ID        string           `json:"id"`
+	MessageID string           `json:"messageId"`
+	RoomID    string           `json:"roomId"`
+	Question  string           `json:"question"`
+	Options   []*PollOptionRes `json:"options"`
+	Multiple  bool             `json:"multiple,omitempty"`
+	Anonymous bool             `json:"anonymous,omitempty"`
+	// Voters is the number of users who voted
+	Voters   int        `json:"voters"`
+	ClosesAt *time.Time `json:"closesAt,omitempty"`
+	Closed   bool       `json:"closed,omitempty"`
+	ClosedAt *time.Time `json:"closedAt,omitempty"`
+}
+
+// PollOptionRes represents a poll option with its votes. Voters is empty in anonymous polls
+type PollOptionRes struct {
+	Text   string   `json:"text"`
+	Votes  int      `json:"votes"`
+	Voters []string `json:"voters,omitempty"`
 }
@@ -0,0 +1,11 @@
+package interfaces
+
+import "context"
+
+// TwoFactorService определяет методы двухфакторной аутентификации по TOTP
+type TwoFactorService interface {
+	EnrollTwoFactor(c context.Context, userID string) (*TwoFactorEnrollRes, error)
+	ConfirmTwoFactor(c context.Context, req *TwoFactorCodeReq) (*TwoFactorConfirmRes, error)
+	DisableTwoFactor(c context.Context, req *TwoFactorCodeReq) error
+	LoginTwoFactor(c context.Context, req *LoginTwoFactorReq) (*LoginUserRes, error)
+}
@@ -3,8 +3,14 @@ package interfaces
 import "context"
 
 type UserService interface {
+	TwoFactorService
+	PasswordService
+	ProfileService
 	CreateUser(c context.Context, req *CreateUserReq) (*CreateUserRes, error)
 	Login(c context.Context, req *LoginUserReq) (*LoginUserRes, error)
 	GetUserByID(c context.Context, req *GetUserReq) (*GetUserRes, error)
 	GetAllUsers(c context.Context) ([]*GetUserRes, error)
+	ValidateToken(c context.Context, token string) (*GetUserRes, error)
+	GetLoginHistory(c context.Context, userID string, limit int) ([]*LoginAttemptRes, error)
+	UnlockUser(c context.Context, adminID, username string) error
 }
@@ -0,0 +1,13 @@
+package interfaces
+
+import "context"
+
+// WebhookService определяет методы для исходящих вебхуков
+type WebhookService interface {
+	CreateWebhook(c context.Context, req *CreateWebhookReq) (*WebhookRes, error)
+	GetWebhooks(c context.Context, userID, roomID string) ([]*WebhookRes, error)
+	DeleteWebhook(c context.Context, userID, id string) error
+	GetWebhookDeliveries(c context.Context, userID, webhookID, status string, limit int) ([]*WebhookDeliveryRes, error)
+	PublishWebhookEvent(c context.Context, req *WebhookEventReq) error
+	DeliverWebhooks(c context.Context) (*WebhookDeliveryRunRes, error)
+}
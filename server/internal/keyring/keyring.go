@@ -0,0 +1,271 @@
+package keyring
+
+import (
+	"chatgo/server/internal/models"
+	"chatgo/server/internal/util"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// cacheTTL bounds how long the current key version of a room is trusted before it's
+// reloaded, so that a rotation made by another process is picked up
+const cacheTTL = time.Minute
+
+// ErrKeyNotFound is returned when a room has no key of the requested version
+var ErrKeyNotFound = errors.New("room key not found")
+
+// ParseMasterKey decodes a base64 encoded 32-byte master key
+func ParseMasterKey(encoded string) ([]byte, error) {
+	if encoded == "" {
+		return nil, errors.New("master key is not configured")
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("master key is not valid base64: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("master key must be 32 bytes long, got %d", len(key))
+	}
+	return key, nil
+}
+
+type roomKeys struct {
+	keys     map[int][]byte
+	current  int
+	loadedAt time.Time
+}
+
+// Keyring manages per-room data keys. Data keys are stored wrapped by the master key
+// and kept unwrapped in memory only
+type Keyring struct {
+	repo models.RoomKeyRepository
+
+	mu     sync.Mutex
+	master []byte
+	rooms  map[string]*roomKeys
+}
+
+func New(repo models.RoomKeyRepository, master []byte) *Keyring {
+	return &Keyring{
+		repo:   repo,
+		master: master,
+		rooms:  make(map[string]*roomKeys),
+	}
+}
+
+// Current returns the latest data key of a room and its version. The first key
+// of a room is created on demand
+func (k *Keyring) Current(ctx context.Context, roomID string) (int, []byte, error) {
+	rk, err := k.load(ctx, roomID, false)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if rk.current == 0 {
+		if rk, err = k.create(ctx, roomID, 1); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	return rk.current, rk.keys[rk.current], nil
+}
+
+// Key returns the data key of a room with the given version
+func (k *Keyring) Key(ctx context.Context, roomID string, version int) ([]byte, error) {
+	rk, err := k.load(ctx, roomID, false)
+	if err != nil {
+		return nil, err
+	}
+	if key, ok := rk.keys[version]; ok {
+		return key, nil
+	}
+
+	// The version may have been created by another process after the cache was filled
+	rk, err = k.load(ctx, roomID, true)
+	if err != nil {
+		return nil, err
+	}
+	if key, ok := rk.keys[version]; ok {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("%w: room %s, version %d", ErrKeyNotFound, roomID, version)
+}
+
+// Rotate creates a new data key version for a room and returns it. Older versions are
+// kept so existing ciphertexts stay readable until they're re-encrypted
+func (k *Keyring) Rotate(ctx context.Context, roomID string) (int, error) {
+	rk, err := k.load(ctx, roomID, true)
+	if err != nil {
+		return 0, err
+	}
+
+	version := rk.current + 1
+	rk, err = k.create(ctx, roomID, version)
+	if err != nil {
+		return 0, err
+	}
+	if rk.current != version {
+		return 0, fmt.Errorf("room %s was rotated concurrently", roomID)
+	}
+
+	return version, nil
+}
+
+// Rewrap returns every stored data key wrapped with a new master key. Ciphertexts are not
+// touched and nothing is stored: the caller saves the keys with UpdateWrappedKeys, together
+// with other sealed secrets, and then switches to the new master key with SetMaster
+func (k *Keyring) Rewrap(ctx context.Context, newMaster []byte) ([]*models.RoomKey, error) {
+	if len(newMaster) != 32 {
+		return nil, errors.New("master key must be 32 bytes long")
+	}
+
+	keys, err := k.repo.GetAllRoomKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	k.mu.Lock()
+	master := k.master
+	k.mu.Unlock()
+
+	for _, key := range keys {
+		dataKey, err := Unwrap(key.WrappedKey, master)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unwrap key %d of room %s: %w", key.Version, key.ChatRoomID, err)
+		}
+		if key.WrappedKey, err = Wrap(dataKey, newMaster); err != nil {
+			return nil, err
+		}
+	}
+
+	return keys, nil
+}
+
+// SetMaster switches to a new master key once the keys re-wrapped by Rewrap are stored
+func (k *Keyring) SetMaster(master []byte) {
+	k.mu.Lock()
+	k.master = master
+	k.rooms = make(map[string]*roomKeys)
+	k.mu.Unlock()
+}
+
+// load returns the keys of a room from the cache or from the repository. When a stale
+// cache entry can't be refreshed, e.g. right after the master key was rotated,
+// the cached keys keep being used
+func (k *Keyring) load(ctx context.Context, roomID string, force bool) (*roomKeys, error) {
+	k.mu.Lock()
+	cached, ok := k.rooms[roomID]
+	master := k.master
+	k.mu.Unlock()
+
+	if ok && !force && time.Since(cached.loadedAt) < cacheTTL {
+		return cached, nil
+	}
+
+	rk, err := k.fetch(ctx, roomID, master)
+	if err != nil {
+		if ok && !force {
+			log.Printf("Using cached keys of room %s: %v", roomID, err)
+			return cached, nil
+		}
+		return nil, err
+	}
+
+	k.mu.Lock()
+	k.rooms[roomID] = rk
+	k.mu.Unlock()
+
+	return rk, nil
+}
+
+func (k *Keyring) fetch(ctx context.Context, roomID string, master []byte) (*roomKeys, error) {
+	stored, err := k.repo.GetRoomKeys(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	rk := &roomKeys{keys: make(map[int][]byte, len(stored)), loadedAt: time.Now()}
+	for _, key := range stored {
+		dataKey, err := Unwrap(key.WrappedKey, master)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unwrap key %d of room %s: %w", key.Version, roomID, err)
+		}
+		rk.keys[key.Version] = dataKey
+		if key.Version > rk.current {
+			rk.current = key.Version
+		}
+	}
+
+	return rk, nil
+}
+
+// create stores a new data key version and reloads the room. If another process created
+// the same version first, its key wins
+func (k *Keyring) create(ctx context.Context, roomID string, version int) (*roomKeys, error) {
+	dataKey, err := util.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+
+	k.mu.Lock()
+	master := k.master
+	k.mu.Unlock()
+
+	wrapped, err := Wrap(dataKey, master)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := k.repo.CreateRoomKey(ctx, &models.RoomKey{
+		ChatRoomID: roomID,
+		Version:    version,
+		WrappedKey: wrapped,
+	}); err != nil {
+		return nil, err
+	}
+
+	return k.load(ctx, roomID, true)
+}
+
+// Seal encrypts a secret that isn't a room key, such as a TOTP secret, with the master key.
+// Sealed secrets must be re-sealed with Wrap when the master key is rotated
+func (k *Keyring) Seal(secret []byte) (string, error) {
+	k.mu.Lock()
+	master := k.master
+	k.mu.Unlock()
+
+	return Wrap(secret, master)
+}
+
+// Open decrypts a secret sealed with Seal
+func (k *Keyring) Open(sealed string) ([]byte, error) {
+	k.mu.Lock()
+	master := k.master
+	k.mu.Unlock()
+
+	return Unwrap(sealed, master)
+}
+
+// Wrap wraps a data key with a master key in the format used for stored room keys
+func Wrap(dataKey, master []byte) (string, error) {
+	wrapped, err := util.EncryptBytes(dataKey, master)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(wrapped), nil
+}
+
+// Unwrap decrypts a key or secret wrapped with Wrap
+func Unwrap(wrapped string, master []byte) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(wrapped)
+	if err != nil {
+		return nil, err
+	}
+	return util.DecryptBytes(data, master)
+}
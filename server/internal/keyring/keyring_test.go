@@ -0,0 +1,212 @@
+package keyring
+
+import (
+	"bytes"
+	"chatgo/server/internal/models"
+	"context"
+	"encoding/base64"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryRepo keeps room keys in memory
+type memoryRepo struct {
+	mu   sync.Mutex
+	keys []*models.RoomKey
+}
+
+func (r *memoryRepo) GetRoomKeys(ctx context.Context, chatRoomID string) ([]*models.RoomKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var result []*models.RoomKey
+	for _, key := range r.keys {
+		if key.ChatRoomID == chatRoomID {
+			copied := *key
+			result = append(result, &copied)
+		}
+	}
+	return result, nil
+}
+
+func (r *memoryRepo) GetAllRoomKeys(ctx context.Context) ([]*models.RoomKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := make([]*models.RoomKey, len(r.keys))
+	for i, key := range r.keys {
+		copied := *key
+		result[i] = &copied
+	}
+	return result, nil
+}
+
+func (r *memoryRepo) CreateRoomKey(ctx context.Context, key *models.RoomKey) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.keys {
+		if existing.ChatRoomID == key.ChatRoomID && existing.Version == key.Version {
+			return false, nil
+		}
+	}
+	copied := *key
+	r.keys = append(r.keys, &copied)
+	return true, nil
+}
+
+func (r *memoryRepo) UpdateWrappedKeys(ctx context.Context, keys []*models.RoomKey, totps []*models.TOTP) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, key := range keys {
+		for _, existing := range r.keys {
+			if existing.ChatRoomID == key.ChatRoomID && existing.Version == key.Version {
+				existing.WrappedKey = key.WrappedKey
+			}
+		}
+	}
+	return nil
+}
+
+func TestParseMasterKey(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+
+	parsed, err := ParseMasterKey(base64.StdEncoding.EncodeToString(key))
+	assert.NoError(t, err)
+	assert.Equal(t, key, parsed)
+
+	_, err = ParseMasterKey("")
+	assert.Error(t, err)
+	_, err = ParseMasterKey("not base64!")
+	assert.Error(t, err)
+	_, err = ParseMasterKey(base64.StdEncoding.EncodeToString([]byte("short")))
+	assert.Error(t, err)
+}
+
+func TestKeyring_CurrentCreatesFirstKey(t *testing.T) {
+	repo := &memoryRepo{}
+	master := bytes.Repeat([]byte{1}, 32)
+	k := New(repo, master)
+
+	version, key, err := k.Current(context.Background(), "room1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, version)
+	assert.Len(t, key, 32)
+
+	// Stored key is wrapped, not the raw data key
+	assert.Len(t, repo.keys, 1)
+	assert.NotContains(t, repo.keys[0].WrappedKey, base64.StdEncoding.EncodeToString(key))
+
+	// Another keyring with the same master key sees the same data key
+	other := New(repo, master)
+	sameKey, err := other.Key(context.Background(), "room1", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, key, sameKey)
+}
+
+func TestKeyring_Rotate(t *testing.T) {
+	repo := &memoryRepo{}
+	master := bytes.Repeat([]byte{1}, 32)
+	k := New(repo, master)
+	ctx := context.Background()
+
+	_, oldKey, err := k.Current(ctx, "room1")
+	assert.NoError(t, err)
+
+	// A server process with a warm cache
+	server := New(repo, master)
+	_, _, err = server.Current(ctx, "room1")
+	assert.NoError(t, err)
+
+	version, err := k.Rotate(ctx, "room1")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, version)
+
+	current, newKey, err := k.Current(ctx, "room1")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, current)
+	assert.NotEqual(t, oldKey, newKey)
+
+	// Old versions stay readable
+	key, err := k.Key(ctx, "room1", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, oldKey, key)
+
+	// Unknown versions are reloaded from the repository on a cache miss
+	key, err = server.Key(ctx, "room1", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, newKey, key)
+
+	_, err = server.Key(ctx, "room1", 3)
+	assert.True(t, errors.Is(err, ErrKeyNotFound))
+}
+
+func TestKeyring_Rewrap(t *testing.T) {
+	repo := &memoryRepo{}
+	oldMaster := bytes.Repeat([]byte{1}, 32)
+	newMaster := bytes.Repeat([]byte{2}, 32)
+	k := New(repo, oldMaster)
+	ctx := context.Background()
+
+	_, key1, err := k.Current(ctx, "room1")
+	assert.NoError(t, err)
+	_, key2, err := k.Current(ctx, "room2")
+	assert.NoError(t, err)
+
+	keys, err := k.Rewrap(ctx, newMaster)
+	assert.NoError(t, err)
+	assert.Len(t, keys, 2)
+
+	// Nothing is stored until the caller saves the keys
+	key, err := New(repo, oldMaster).Key(ctx, "room1", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, key1, key)
+
+	assert.NoError(t, repo.UpdateWrappedKeys(ctx, keys, nil))
+	k.SetMaster(newMaster)
+	key, err = k.Key(ctx, "room2", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, key2, key)
+
+	// The old master key no longer unwraps stored keys
+	_, err = New(repo, oldMaster).Key(ctx, "room1", 1)
+	assert.Error(t, err)
+
+	rewrapped := New(repo, newMaster)
+	key, err = rewrapped.Key(ctx, "room1", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, key1, key)
+	key, err = rewrapped.Key(ctx, "room2", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, key2, key)
+
+	_, err = k.Rewrap(ctx, []byte("short"))
+	assert.Error(t, err)
+}
+
+func TestKeyring_Seal(t *testing.T) {
+	master := bytes.Repeat([]byte{1}, 32)
+	k := New(&memoryRepo{}, master)
+
+	sealed, err := k.Seal([]byte("totp secret"))
+	assert.NoError(t, err)
+	assert.NotContains(t, sealed, "totp secret")
+
+	secret, err := k.Open(sealed)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("totp secret"), secret)
+
+	// A secret re-sealed for a new master key opens once the keyring uses it
+	newMaster := bytes.Repeat([]byte{2}, 32)
+	resealed, err := Wrap(secret, newMaster)
+	assert.NoError(t, err)
+	_, err = k.Open(resealed)
+	assert.Error(t, err)
+	secret, err = New(&memoryRepo{}, newMaster).Open(resealed)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("totp secret"), secret)
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Attachment представляет собой файл, загруженный в чат. Содержимое файла хранится
+// в зашифрованном виде в хранилище по ключу StorageKey
+type Attachment struct {
+	ID          string         `json:"id"`
+	ChatRoomID  string         `json:"chat_room_id"`
+	UploaderID  string         `json:"uploader_id"`
+	MessageID   sql.NullString `json:"message_id"` // NULL, пока файл не прикреплён к сообщению
+	Filename    string         `json:"filename"`
+	ContentType string         `json:"content_type"`
+	Size        int64          `json:"size"`
+	StorageKey  string         `json:"storage_key"`
+	KeyVersion  int            `json:"key_version"` // версия ключа чата, которым зашифрован файл
+	CreatedAt   time.Time      `json:"created_at"`
+}
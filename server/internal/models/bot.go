@@ -0,0 +1,34 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Виды токенов бота
+const (
+	BotTokenAPI     = "api"
+	BotTokenWebhook = "webhook" // входящий вебхук, выдаётся на один чат и передаётся в URL
+)
+
+// Bot представляет собой бота вместе с пользователем, от имени которого он пишет
+type Bot struct {
+	UserID    string    `json:"user_id"`
+	Username  string    `json:"username"`
+	OwnerID   string    `json:"owner_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BotToken представляет собой отзываемый токен бота, который действует только в выданных чатах
+type BotToken struct {
+	ID         string       `json:"id"`
+	BotID      string       `json:"bot_id"`
+	Name       string       `json:"name"`
+	Kind       string       `json:"kind"`
+	TokenHash  string       `json:"token_hash"` // SHA-256 токена в hex, сам токен не хранится
+	RoomIDs    []string     `json:"room_ids"`
+	CreatedBy  string       `json:"created_by"`
+	CreatedAt  time.Time    `json:"created_at"`
+	LastUsedAt sql.NullTime `json:"last_used_at"`
+	RevokedAt  sql.NullTime `json:"revoked_at"`
+}
@@ -17,4 +17,8 @@ type ChatRoom struct {
 	Type      ChatRoomType `json:"type"`
 	CreatedAt time.Time    `json:"created_at"`
 	CreatorID string       `json:"creator_id"`
+	E2E       bool         `json:"e2e"` // сообщения чата шифруются на клиентах, сервер видит только шифротекст
+	// MessageTTL — время жизни сообщений чата в секундах, 0 — сообщения не исчезают
+	MessageTTL int    `json:"message_ttl"`
+	Topic      string `json:"topic"` // тема или описание чата, показывается новым участникам
 }
@@ -1,6 +1,9 @@
 package models
 
-import "time"
+import (
+	"database/sql"
+	"time"
+)
 
 // MemberRole представляет собой тип роли участника
 type MemberRole string
@@ -11,10 +14,25 @@ const (
 	Member MemberRole = "member"
 )
 
+// roleRanks упорядочивает роли по правам, неизвестная роль имеет ранг 0
+var roleRanks = map[MemberRole]int{
+	Member: 1,
+	Admin:  2,
+	Owner:  3,
+}
+
+// AtLeast сообщает, что у роли не меньше прав, чем у role
+func (r MemberRole) AtLeast(role MemberRole) bool {
+	return roleRanks[r] >= roleRanks[role]
+}
+
 // ChatroomMember представляет собой модель участника чата
 type ChatRoomMember struct {
 	UserID     string     `json:"user_id"`
 	ChatRoomID string     `json:"chat_room_id"`
 	JoinedAt   time.Time  `json:"joined_at"`
 	MemberRole MemberRole `json:"role"`
+
+	LastReadMessageID sql.NullString `json:"last_read_message_id"` // последнее прочитанное сообщение, может быть NULL
+	LastReadAt        sql.NullTime   `json:"last_read_at"`
 }
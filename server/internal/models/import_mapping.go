@@ -0,0 +1,17 @@
+package models
+
+// Виды объектов, которые запоминает импорт истории
+const (
+	ImportKindUser    = "user"
+	ImportKindRoom    = "room"
+	ImportKindMessage = "message"
+)
+
+// ImportMapping связывает объект из экспорта другого мессенджера с объектом, созданным при импорте.
+// По этим связям повторный импорт пропускает уже перенесённые данные
+type ImportMapping struct {
+	Source     string `json:"source"` // формат экспорта: slack или mattermost
+	Kind       string `json:"kind"`
+	ExternalID string `json:"external_id"` // ID объекта в исходной системе
+	LocalID    string `json:"local_id"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// Mention представляет собой упоминание пользователя в сообщении
+type Mention struct {
+	ID         string    `json:"id"`
+	MessageID  string    `json:"message_id"`
+	UserID     string    `json:"user_id"`
+	ChatRoomID string    `json:"chat_room_id"`
+	IsRead     bool      `json:"is_read"`
+	CreatedAt  time.Time `json:"created_at"`
+}
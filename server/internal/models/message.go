@@ -1,16 +1,26 @@
 package models
 
 import (
+	"database/sql"
 	"time"
 )
 
+// E2EKeyVersion отмечает сообщения чатов со сквозным шифрованием. Их шифруют клиенты,
+// а сервер хранит содержимое как есть и не может его расшифровать
+const E2EKeyVersion = -1
+
 // Message представляет собой модель сообщения
 type Message struct {
-	ID               string    `json:"id"`
-	SenderID         string    `json:"sender_id"`
-	ChatRoomID       string    `json:"chat_room_id"`
-	EncryptedContent string    `json:"encrypted_content"`
-	CreatedAt        time.Time `json:"created_at"`
-	UpdatedAt        time.Time `json:"updated_at"`
-	IsEdited         bool      `json:"is_edited"`
+	ID               string         `json:"id"`
+	SenderID         string         `json:"sender_id"`
+	ChatRoomID       string         `json:"chat_room_id"`
+	EncryptedContent string         `json:"encrypted_content"`
+	ParentID         sql.NullString `json:"parent_id"`     // ID корневого сообщения ветки, может быть NULL
+	ReplyCount       int            `json:"reply_count"`   // число ответов в ветке этого сообщения
+	LastReplyAt      sql.NullTime   `json:"last_reply_at"` // время последнего ответа, может быть NULL
+	CreatedAt        time.Time      `json:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at"`
+	IsEdited         bool           `json:"is_edited"`
+	KeyVersion       int            `json:"key_version"` // версия ключа чата, которым зашифровано сообщение, 0 для старых сообщений без шифрования
+	ExpiresAt        sql.NullTime   `json:"expires_at"`  // время, когда исчезающее сообщение будет удалено, может быть NULL
 }
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// PinnedMessage представляет собой сообщение, закреплённое в чате
+type PinnedMessage struct {
+	MessageID  string    `json:"message_id"`
+	ChatRoomID string    `json:"chat_room_id"`
+	PinnedBy   string    `json:"pinned_by"` // ID пользователя, закрепившего сообщение
+	PinnedAt   time.Time `json:"pinned_at"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Poll представляет собой опрос, показанный сообщением MessageID. Вопрос и варианты ответа
+// зашифрованы ключом чата версии KeyVersion
+type Poll struct {
+	ID                string       `json:"id"`
+	MessageID         string       `json:"message_id"`
+	ChatRoomID        string       `json:"chat_room_id"`
+	CreatedBy         string       `json:"created_by"`
+	EncryptedQuestion string       `json:"encrypted_question"`
+	EncryptedOptions  []string     `json:"encrypted_options"`
+	KeyVersion        int          `json:"key_version"`
+	Multiple          bool         `json:"multiple"`  // можно выбрать несколько вариантов
+	Anonymous         bool         `json:"anonymous"` // видно только сколько голосов у варианта, но не чьи они
+	ClosesAt          sql.NullTime `json:"closes_at"`
+	ClosedAt          sql.NullTime `json:"closed_at"`
+	CreatedAt         time.Time    `json:"created_at"`
+
+	Votes []*PollVote `json:"votes"`
+}
+
+// PollVote представляет собой голос пользователя за вариант Option, варианты нумеруются с нуля
+type PollVote struct {
+	PollID   string `json:"poll_id"`
+	UserID   string `json:"user_id"`
+	Username string `json:"username"`
+	Option   int    `json:"option"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Reaction представляет собой реакцию пользователя на сообщение
+type Reaction struct {
+	MessageID string    `json:"message_id"`
+	UserID    string    `json:"user_id"`
+	Emoji     string    `json:"emoji"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ReactionCount представляет собой число реакций одним эмодзи на сообщение
+type ReactionCount struct {
+	MessageID string `json:"message_id"`
+	Emoji     string `json:"emoji"`
+	Count     int    `json:"count"`
+}
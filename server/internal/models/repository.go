@@ -2,6 +2,7 @@ package models
 
 import (
 	"context"
+	"time"
 )
 
 type UserRepository interface {
@@ -9,12 +10,140 @@ type UserRepository interface {
 	GetUserByID(ctx context.Context, id string) (*User, error)
 	GetUserByUsername(ctx context.Context, username string) (*User, error)
 	GetAllUsers(ctx context.Context) ([]*User, error)
+	GetUsersByIDs(ctx context.Context, ids []string) ([]*User, error)
+	UpdateUserProfile(ctx context.Context, user *User) error
+	UpdateUserStatus(ctx context.Context, userID string, status UserStatus) (bool, error)
+	UpdateLastLogin(ctx context.Context, userID, ip string) error
+	RecordFailedLogin(ctx context.Context, userID string) (int, error)
+	LockUser(ctx context.Context, userID string, until time.Time) error
+	UnlockUser(ctx context.Context, userID string) (bool, error)
+	CreateLoginAttempt(ctx context.Context, attempt *LoginAttempt) error
+	GetLoginAttempts(ctx context.Context, userID string, limit int) ([]*LoginAttempt, error)
+	UpdatePasswordHash(ctx context.Context, userID, passwordHash string) error
+	ChangePassword(ctx context.Context, userID, passwordHash string) (int, error)
+	CreatePasswordReset(ctx context.Context, reset *PasswordReset) error
+	ResetPassword(ctx context.Context, tokenHash, passwordHash string) (string, error)
+}
+
+type TwoFactorRepository interface {
+	SaveTOTP(ctx context.Context, totp *TOTP) (bool, error)
+	GetTOTP(ctx context.Context, userID string) (*TOTP, error)
+	EnableTOTP(ctx context.Context, userID string, step int64, recoveryCodeHashes []string) (bool, error)
+	UseTOTPStep(ctx context.Context, userID string, step int64) (bool, error)
+	UseRecoveryCode(ctx context.Context, userID, codeHash string) (bool, error)
+	DeleteTOTP(ctx context.Context, userID string) (bool, error)
+	GetAllTOTP(ctx context.Context) ([]*TOTP, error)
+}
+
+type BotRepository interface {
+	CreateBot(ctx context.Context, user *User, ownerID string) (*Bot, error)
+	GetBotByUserID(ctx context.Context, userID string) (*Bot, error)
+	GetBotsByOwnerID(ctx context.Context, ownerID string) ([]*Bot, error)
+	CreateBotToken(ctx context.Context, token *BotToken) (*BotToken, error)
+	GetBotTokenByID(ctx context.Context, id string) (*BotToken, error)
+	GetBotTokenByHash(ctx context.Context, tokenHash string) (*BotToken, error)
+	GetBotTokensByBotID(ctx context.Context, botID string) ([]*BotToken, error)
+	RevokeBotToken(ctx context.Context, id string) (bool, error)
+	TouchBotToken(ctx context.Context, id string) error
 }
 
 type MessageRepository interface {
 	CreateMessage(ctx context.Context, message *Message) (*Message, error)
 	GetMessageByID(ctx context.Context, messageID string) (*Message, error)
 	GetMessagesByChatRoomID(ctx context.Context, roomID string, limit int) ([]*Message, error)
+	GetMessagesAfterID(ctx context.Context, afterID string, limit int) ([]*Message, error)
+	GetMessagesInRange(ctx context.Context, chatRoomID string, from time.Time, afterID string, to time.Time, limit int) ([]*Message, error)
+	GetThreadMessages(ctx context.Context, parentID string, limit int) ([]*Message, error)
+	GetLastMessagesByChatRoomIDs(ctx context.Context, chatRoomIDs []string) ([]*Message, error)
+	GetUnreadCountsByUserID(ctx context.Context, userID string) (map[string]int, error)
+	GetMessagesForReencryption(ctx context.Context, chatRoomID string, keyVersion int, afterID string, limit int) ([]*Message, error)
+	UpdateMessageEncryption(ctx context.Context, message *Message, oldKeyVersion int) (bool, error)
+	DeleteExpiredMessages(ctx context.Context, now time.Time, limit int) (*PurgedMessages, error)
+}
+
+type ScheduledMessageRepository interface {
+	CreateScheduledMessage(ctx context.Context, message *ScheduledMessage) (*ScheduledMessage, error)
+	GetPendingScheduledMessages(ctx context.Context, senderID, chatRoomID string) ([]*ScheduledMessage, error)
+	CancelScheduledMessage(ctx context.Context, id, senderID string) (bool, error)
+	DeliverScheduledMessages(ctx context.Context, now time.Time, limit int) ([]*Message, error)
+}
+
+type ReactionRepository interface {
+	AddReaction(ctx context.Context, reaction *Reaction) (bool, error)
+	DeleteReaction(ctx context.Context, reaction *Reaction) (bool, error)
+	GetReactionCountsByMessageIDs(ctx context.Context, messageIDs []string) ([]*ReactionCount, error)
+}
+
+type PinRepository interface {
+	PinMessage(ctx context.Context, pin *PinnedMessage, max int) (bool, error)
+	UnpinMessage(ctx context.Context, chatRoomID, messageID string) (bool, error)
+	GetPinnedMessages(ctx context.Context, chatRoomID string) ([]*PinnedMessage, error)
+}
+
+type WebhookRepository interface {
+	CreateWebhook(ctx context.Context, webhook *Webhook) (*Webhook, error)
+	GetWebhookByID(ctx context.Context, id string) (*Webhook, error)
+	GetWebhooksByChatRoomID(ctx context.Context, chatRoomID string) ([]*Webhook, error)
+	DeleteWebhook(ctx context.Context, id string) error
+	EnqueueWebhookDeliveries(ctx context.Context, chatRoomID string, delivery *WebhookDelivery) (int, error)
+	ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*WebhookDelivery, error)
+	UpdateWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) error
+	GetWebhookDeliveries(ctx context.Context, webhookID, status string, limit int) ([]*WebhookDelivery, error)
+}
+
+type PollRepository interface {
+	CreatePoll(ctx context.Context, message *Message, poll *Poll) (*Message, *Poll, error)
+	GetPollByID(ctx context.Context, id string) (*Poll, error)
+	GetPollsByMessageIDs(ctx context.Context, messageIDs []string) ([]*Poll, error)
+	SetPollVotes(ctx context.Context, pollID, userID string, options []int) (bool, error)
+	MarkPollClosed(ctx context.Context, id string) (bool, error)
+	CloseDuePolls(ctx context.Context, now time.Time) ([]string, error)
+}
+
+type MentionRepository interface {
+	CreateMentions(ctx context.Context, mentions []*Mention) error
+	GetMentionsByUserID(ctx context.Context, userID string, unreadOnly bool, limit int) ([]*Mention, error)
+	MarkMentionsRead(ctx context.Context, userID string, mentionIDs []string) error
+}
+
+type AttachmentRepository interface {
+	CreateAttachment(ctx context.Context, attachment *Attachment) (*Attachment, error)
+	GetAttachmentByID(ctx context.Context, attachmentID string) (*Attachment, error)
+	LinkAttachments(ctx context.Context, message *Message, attachmentIDs []string) (int64, error)
+	GetAttachmentsByMessageIDs(ctx context.Context, messageIDs []string) ([]*Attachment, error)
+	GetAttachmentsForReencryption(ctx context.Context, chatRoomID string, keyVersion int, afterID string, limit int) ([]*Attachment, error)
+	UpdateAttachmentEncryption(ctx context.Context, attachment *Attachment, oldStorageKey string) (bool, error)
+}
+
+type RoomKeyRepository interface {
+	GetRoomKeys(ctx context.Context, chatRoomID string) ([]*RoomKey, error)
+	GetAllRoomKeys(ctx context.Context) ([]*RoomKey, error)
+	CreateRoomKey(ctx context.Context, key *RoomKey) (bool, error)
+	UpdateWrappedKeys(ctx context.Context, keys []*RoomKey, totps []*TOTP) error
+}
+
+type UserKeyRepository interface {
+	UpsertUserKey(ctx context.Context, key *UserKey) error
+	GetUserKeysByChatRoomID(ctx context.Context, chatRoomID string) ([]*UserKey, error)
+}
+
+type ImportRepository interface {
+	GetImportMapping(ctx context.Context, source, kind, externalID string) (string, error)
+	ImportUser(ctx context.Context, user *User, mapping *ImportMapping) (bool, error)
+	ImportChatRoom(ctx context.Context, chatRoom *ChatRoom, mapping *ImportMapping) (bool, error)
+	ImportMessage(ctx context.Context, message *Message, mapping *ImportMapping) (bool, error)
+}
+
+type RetentionRepository interface {
+	GetRetentionPolicy(ctx context.Context, chatRoomID string) (*RetentionPolicy, error)
+	GetRetentionPolicies(ctx context.Context) ([]*RetentionPolicy, error)
+	SetRetentionLimits(ctx context.Context, policy *RetentionPolicy) error
+	SetLegalHold(ctx context.Context, chatRoomID string, hold bool) error
+	GetExpiredMessageIDs(ctx context.Context, chatRoomID string, before time.Time, limit int) ([]string, error)
+	GetOverflowMessageIDs(ctx context.Context, chatRoomID string, keep int, limit int) ([]string, error)
+	PurgeMessages(ctx context.Context, messageIDs []string, archive bool) (*PurgedMessages, error)
+	CreateRetentionPurge(ctx context.Context, purge *RetentionPurge) error
+	GetRetentionPurges(ctx context.Context, chatRoomID string, limit int) ([]*RetentionPurge, error)
 }
 
 type ChatRoomRepository interface {
@@ -24,7 +153,10 @@ type ChatRoomRepository interface {
 	GetMembersByChatRoomID(ctx context.Context, chatRoomID string) ([]*ChatRoomMember, error)
 	GetAllChatRooms(ctx context.Context) ([]*ChatRoom, error)
 	UpdateChatRoom(ctx context.Context, chatRoom *ChatRoom) (*ChatRoom, error)
+	SetMessageTTL(ctx context.Context, chatRoomID string, ttl int) error
+	SetTopic(ctx context.Context, chatRoomID, topic string) error
 	UpdateMemberRole(ctx context.Context, member *ChatRoomMember) (*ChatRoomMember, error)
+	UpdateLastReadMessage(ctx context.Context, member *ChatRoomMember) (bool, error)
 	DeleteChatRoom(ctx context.Context, chatRoom *ChatRoom) error
 	AddMember(ctx context.Context, member *ChatRoomMember) (*ChatRoomMember, error)
 	DeleteMember(ctx context.Context, member *ChatRoomMember) error
@@ -44,7 +176,20 @@ type ChatRoomRepository interface {
 
 type Repository interface {
 	UserRepository
+	TwoFactorRepository
+	BotRepository
 	MessageRepository
+	ScheduledMessageRepository
 	ChatRoomRepository
+	ReactionRepository
+	PinRepository
+	WebhookRepository
+	PollRepository
+	MentionRepository
+	AttachmentRepository
+	RoomKeyRepository
+	UserKeyRepository
+	ImportRepository
+	RetentionRepository
 	//ChatRoomMemberRepository
 }
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Причины очистки в журнале retention_purges
+const (
+	PurgeReasonMaxAge      = "max_age"
+	PurgeReasonMaxMessages = "max_messages"
+)
+
+// RetentionPolicy представляет собой настройки хранения сообщений чата. NULL в MaxAgeDays и
+// MaxMessages означает, что действует глобальная настройка, 0 — хранить без ограничений
+type RetentionPolicy struct {
+	ChatRoomID  string        `json:"chat_room_id"`
+	MaxAgeDays  sql.NullInt64 `json:"max_age_days"` // сколько дней хранить сообщения
+	MaxMessages sql.NullInt64 `json:"max_messages"` // сколько последних корневых сообщений хранить
+	LegalHold   bool          `json:"legal_hold"`   // сообщения чата не удаляются, пока действует удержание
+	UpdatedAt   time.Time     `json:"updated_at"`
+}
+
+// RetentionPurge представляет собой запись журнала очистки: сколько сообщений и файлов чата
+// удалено или перенесено в архив по одной из политик
+type RetentionPurge struct {
+	ID          string    `json:"id"`
+	ChatRoomID  string    `json:"chat_room_id"`
+	Reason      string    `json:"reason"`
+	Messages    int       `json:"messages"`
+	Attachments int       `json:"attachments"`
+	Archived    bool      `json:"archived"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// PurgedMessages содержит результат удаления пакета сообщений
+type PurgedMessages struct {
+	Messages    []*Message    // удалённые сообщения, включая ответы в ветках
+	Attachments []*Attachment // файлы удалённых сообщений
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// RoomKey представляет собой версию ключа шифрования данных чата.
+// Ключ хранится только в зашифрованном мастер-ключом виде
+type RoomKey struct {
+	ChatRoomID string    `json:"chat_room_id"`
+	Version    int       `json:"version"`
+	WrappedKey string    `json:"wrapped_key"`
+	CreatedAt  time.Time `json:"created_at"`
+}
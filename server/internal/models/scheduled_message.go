@@ -0,0 +1,26 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Статусы отложенного сообщения
+const (
+	ScheduledPending   = "pending"
+	ScheduledSent      = "sent"
+	ScheduledCancelled = "cancelled"
+)
+
+// ScheduledMessage представляет собой сообщение, которое будет отправлено в чат в SendAt
+type ScheduledMessage struct {
+	ID               string         `json:"id"`
+	SenderID         string         `json:"sender_id"`
+	ChatRoomID       string         `json:"chat_room_id"`
+	EncryptedContent string         `json:"encrypted_content"`
+	KeyVersion       int            `json:"key_version"`
+	SendAt           time.Time      `json:"send_at"`
+	Status           string         `json:"status"`
+	MessageID        sql.NullString `json:"message_id"` // ID отправленного сообщения, NULL пока сообщение не отправлено
+	CreatedAt        time.Time      `json:"created_at"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// TOTP представляет собой TOTP-секрет пользователя, зашифрованный мастер-ключом.
+// До подтверждения первым кодом секрет не включён и вход его не требует
+type TOTP struct {
+	UserID          string       `json:"user_id"`
+	EncryptedSecret string       `json:"encrypted_secret"`
+	Enabled         bool         `json:"enabled"`
+	LastUsedStep    int64        `json:"last_used_step"` // шаг последнего принятого кода, коды этого и прошлых шагов не принимаются
+	CreatedAt       time.Time    `json:"created_at"`
+	EnabledAt       sql.NullTime `json:"enabled_at"`
+}
@@ -17,10 +17,49 @@ const (
 
 // User представляет собой модель пользователя
 type User struct {
-	ID                string       `json:"id"`
-	Username          string       `json:"username"`
-	EncryptedPassword string       `json:"encrypted_password"`
-	CreatedAt         time.Time    `json:"created_at"`
-	LastLogin         sql.NullTime `json:"last_login"` // может быть NULL
-	Status            UserStatus   `json:"status"`
+	ID                string         `json:"id"`
+	Username          string         `json:"username"`
+	EncryptedPassword string         `json:"encrypted_password"`
+	CreatedAt         time.Time      `json:"created_at"`
+	LastLogin         sql.NullTime   `json:"last_login"` // может быть NULL
+	LastSeenAt        sql.NullTime   `json:"last_seen_at"`
+	Status            UserStatus     `json:"status"`
+	IsBot             bool           `json:"is_bot"` // бот входит по API-токенам, а не по паролю
+	LastLoginIP       sql.NullString `json:"last_login_ip"`
+	FailedLogins      int            `json:"failed_logins"` // неудачные входы подряд с последнего успешного
+	LockedUntil       sql.NullTime   `json:"locked_until"`  // до этого времени вход запрещён
+	TokenVersion      int            `json:"token_version"` // токены доступа с другой версией отозваны
+	DisplayName       string         `json:"display_name"`
+	Bio               string         `json:"bio"`
+	AvatarID          sql.NullString `json:"avatar_attachment_id"` // вложение-картинка, загруженное самим пользователем
+	Timezone          string         `json:"timezone"`             // название из базы IANA, например Europe/Berlin
+	StatusText        string         `json:"status_text"`
+}
+
+// Причины неудачного входа в истории входов
+const (
+	LoginBadPassword = "bad_password"
+	LoginLocked      = "locked"
+	LoginBadCode     = "bad_code" // неверный код двухфакторной аутентификации
+)
+
+// LoginAttempt представляет собой попытку входа в аккаунт UserID
+type LoginAttempt struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Success   bool      `json:"success"`
+	Reason    string    `json:"reason"` // пусто для успешного входа
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PasswordReset представляет собой одноразовый токен сброса пароля пользователя UserID,
+// выданный администратором CreatedBy. Хранится только хеш токена
+type PasswordReset struct {
+	TokenHash string    `json:"token_hash"`
+	UserID    string    `json:"user_id"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
 }
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// UserKey представляет собой долговременный открытый ключ пользователя для чатов со сквозным шифрованием
+type UserKey struct {
+	UserID    string    `json:"user_id"`
+	Username  string    `json:"username"`
+	PublicKey string    `json:"public_key"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Статусы доставки вебхука
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryDead      = "dead" // все попытки исчерпаны, доставка осталась в журнале недоставленных
+)
+
+// Webhook представляет собой подписку чата на события, которые отправляются POST-запросами на URL
+type Webhook struct {
+	ID              string    `json:"id"`
+	ChatRoomID      string    `json:"chat_room_id"`
+	URL             string    `json:"url"`
+	Events          []string  `json:"events"`
+	EncryptedSecret string    `json:"encrypted_secret"` // секрет для подписи, зашифрованный ключом чата
+	KeyVersion      int       `json:"key_version"`
+	CreatedBy       string    `json:"created_by"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// WebhookDelivery представляет собой отправку одного события на вебхук вместе с историей попыток
+type WebhookDelivery struct {
+	ID        string         `json:"id"`
+	WebhookID string         `json:"webhook_id"`
+	MessageID sql.NullString `json:"message_id"` // сообщение события, доставка удаляется вместе с ним
+	Event     string         `json:"event"`
+	// EncryptedPayload — тело запроса, зашифрованное ключом чата. После доставки очищается
+	EncryptedPayload string       `json:"encrypted_payload"`
+	KeyVersion       int          `json:"key_version"`
+	Status           string       `json:"status"`
+	Attempts         int          `json:"attempts"`
+	NextAttemptAt    time.Time    `json:"next_attempt_at"`
+	LastStatusCode   int          `json:"last_status_code"` // 0, если ответ не получен
+	LastError        string       `json:"last_error"`
+	CreatedAt        time.Time    `json:"created_at"`
+	DeliveredAt      sql.NullTime `json:"delivered_at"`
+}
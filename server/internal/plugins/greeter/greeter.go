@@ -0,0 +1,115 @@
+// Package greeter is an in-process bot that welcomes members to rooms. It also shows how to
+// write a transport.Plugin
+package greeter
+
+import (
+	"chatgo/server/internal/interfaces"
+	"chatgo/server/internal/transport"
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMessage = "Welcome to the room, @{user}!"
+	// greetInterval keeps members who leave and are added again from being greeted every time
+	greetInterval = 24 * time.Hour
+)
+
+// Config configures the greeter. The greeter is disabled without a token
+type Config struct {
+	// Token is an API token of the bot the greeter posts as. The greeter only greets in the rooms
+	// the token is granted
+	Token string `yaml:"token"`
+	// Message is the greeting, {user} is replaced with the username
+	Message string `yaml:"message"`
+}
+
+// Greeter welcomes members when they join a room and on /greet
+type Greeter struct {
+	message string
+	now     func() time.Time
+
+	mu      sync.Mutex
+	greeted map[string]time.Time
+}
+
+// New creates a greeter
+func New(config *Config) *Greeter {
+	message := config.Message
+	if message == "" {
+		message = defaultMessage
+	}
+	return &Greeter{
+		message: message,
+		now:     time.Now,
+		greeted: make(map[string]time.Time),
+	}
+}
+
+// Name implements transport.Plugin
+func (g *Greeter) Name() string {
+	return "greeter"
+}
+
+// Events implements transport.Plugin
+func (g *Greeter) Events() []string {
+	return []string{interfaces.WebhookEventMemberJoined}
+}
+
+// Commands implements transport.Plugin
+func (g *Greeter) Commands() []*transport.Command {
+	return []*transport.Command{{
+		Name:        "greet",
+		Usage:       "<username>",
+		Description: "Ask the greeter bot to welcome someone",
+		Run:         g.runGreet,
+	}}
+}
+
+// HandleEvent greets a member who joined, unless they were greeted in the room recently
+func (g *Greeter) HandleEvent(ctx context.Context, e *transport.RoomEvent, bot transport.BotPoster) {
+	if !g.shouldGreet(e.RoomID, e.UserID) {
+		return
+	}
+	if err := bot.Post(ctx, e.RoomID, g.greeting(e.Username)); err != nil {
+		log.Printf("Greeter failed to greet %s in room %s: %v", e.Username, e.RoomID, err)
+	}
+}
+
+func (g *Greeter) runGreet(ctx context.Context, call *transport.CommandCall) error {
+	args := call.Fields()
+	if len(args) != 1 {
+		return errors.New("usage: /greet <username>")
+	}
+	return call.Bot.Post(ctx, call.RoomID, g.greeting(strings.TrimPrefix(args[0], "@")))
+}
+
+// shouldGreet records the greeting and reports whether the member wasn't greeted in the room
+// during the last greetInterval
+func (g *Greeter) shouldGreet(roomID, userID string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	key := roomID + "/" + userID
+	if last, ok := g.greeted[key]; ok && now.Sub(last) < greetInterval {
+		return false
+	}
+	g.greeted[key] = now
+
+	// Forget old greetings, so that the map doesn't grow forever
+	for k, t := range g.greeted {
+		if now.Sub(t) >= greetInterval {
+			delete(g.greeted, k)
+		}
+	}
+	return true
+}
+
+func (g *Greeter) greeting(username string) string {
+	return strings.ReplaceAll(g.message, "{user}", username)
+}
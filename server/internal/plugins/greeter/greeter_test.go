@@ -0,0 +1,66 @@
+package greeter
+
+import (
+	"chatgo/server/internal/interfaces"
+	"chatgo/server/internal/transport"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type post struct {
+	roomID string
+	text   string
+}
+
+type fakeBot struct {
+	posts []post
+}
+
+func (b *fakeBot) Post(ctx context.Context, roomID, text string) error {
+	b.posts = append(b.posts, post{roomID, text})
+	return nil
+}
+
+func TestHandleEvent(t *testing.T) {
+	now := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	g := New(&Config{Message: "Hi {user}, see the pins"})
+	g.now = func() time.Time { return now }
+	bot := &fakeBot{}
+
+	join := func(roomID, userID, username string) {
+		g.HandleEvent(context.Background(), &transport.RoomEvent{
+			Type:     interfaces.WebhookEventMemberJoined,
+			RoomID:   roomID,
+			UserID:   userID,
+			Username: username,
+		}, bot)
+	}
+
+	join("5", "1", "alice")
+	join("5", "1", "alice")
+	join("6", "1", "alice")
+	now = now.Add(greetInterval)
+	join("5", "1", "alice")
+
+	// Reconnecting to the same room is not greeted again until greetInterval passes
+	assert.Equal(t, []post{
+		{"5", "Hi alice, see the pins"},
+		{"6", "Hi alice, see the pins"},
+		{"5", "Hi alice, see the pins"},
+	}, bot.posts)
+}
+
+func TestGreetCommand(t *testing.T) {
+	g := New(&Config{})
+	bot := &fakeBot{}
+
+	err := g.runGreet(context.Background(), &transport.CommandCall{Args: "@bob", RoomID: "5", Bot: bot})
+	assert.NoError(t, err)
+	assert.Equal(t, []post{{"5", "Welcome to the room, @bob!"}}, bot.posts)
+
+	err = g.runGreet(context.Background(), &transport.CommandCall{RoomID: "5", Bot: bot})
+	assert.Error(t, err)
+}
@@ -0,0 +1,516 @@
+// Package qrcode encodes short texts, such as otpauth:// provisioning URIs, as QR codes
+// and renders them as text art for terminals. It supports byte mode with error correction
+// level M in versions 1 to 20, which holds up to 666 bytes
+package qrcode
+
+import (
+	"errors"
+	"strings"
+)
+
+// quietZone is the width of the light border around the code, in modules
+const quietZone = 4
+
+// ErrTooLong is returned when the data doesn't fit into the largest supported version
+var ErrTooLong = errors.New("data is too long for a QR code")
+
+// blockLayout describes how the codewords of a version are split into error correction blocks
+// at level M: blocks1 blocks with data1 data codewords, then blocks2 blocks with one more
+type blockLayout struct {
+	ecc     int
+	blocks1 int
+	data1   int
+	blocks2 int
+}
+
+// layouts are indexed by version - 1
+var layouts = []blockLayout{
+	{10, 1, 16, 0}, {16, 1, 28, 0}, {26, 1, 44, 0}, {18, 2, 32, 0}, {24, 2, 43, 0},
+	{16, 4, 27, 0}, {18, 4, 31, 0}, {22, 2, 38, 2}, {22, 3, 36, 2}, {26, 4, 43, 1},
+	{30, 1, 50, 4}, {22, 6, 36, 2}, {22, 8, 37, 1}, {24, 4, 40, 5}, {24, 5, 41, 5},
+	{28, 7, 45, 3}, {28, 10, 46, 1}, {26, 9, 43, 4}, {26, 3, 44, 11}, {26, 3, 41, 13},
+}
+
+func (l blockLayout) dataCodewords() int {
+	return l.blocks1*l.data1 + l.blocks2*(l.data1+1)
+}
+
+// Code is an encoded QR code. Modules are indexed by row, then column, true is dark
+type Code struct {
+	Version int
+	Size    int
+	modules [][]bool
+	// function marks the modules of finder, timing and alignment patterns and of format
+	// and version information, which are not masked
+	function [][]bool
+}
+
+// Encode encodes the data in the smallest version that holds it
+func Encode(data []byte) (*Code, error) {
+	version := 0
+	for v := 1; v <= len(layouts); v++ {
+		if 4+countBits(v)+len(data)*8 <= layouts[v-1].dataCodewords()*8 {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, ErrTooLong
+	}
+
+	c := newCode(version)
+	c.drawFunctionPatterns()
+	c.drawCodewords(interleave(version, encodeData(version, data)))
+
+	bestMask, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		c.applyMask(mask)
+		c.drawFormat(mask)
+		if penalty := c.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			bestMask, bestPenalty = mask, penalty
+		}
+		// Masking twice restores the modules
+		c.applyMask(mask)
+	}
+	c.applyMask(bestMask)
+	c.drawFormat(bestMask)
+
+	return c, nil
+}
+
+func newCode(version int) *Code {
+	size := version*4 + 17
+	c := &Code{Version: version, Size: size, modules: make([][]bool, size), function: make([][]bool, size)}
+	for i := range c.modules {
+		c.modules[i] = make([]bool, size)
+		c.function[i] = make([]bool, size)
+	}
+	return c
+}
+
+// Dark reports whether the module at the row and column is dark
+func (c *Code) Dark(row, col int) bool {
+	return c.modules[row][col]
+}
+
+// Text renders the code with two rows of modules per line of text. Light modules are drawn
+// with block characters, so that the code reads on terminals with a dark background
+func (c *Code) Text() string {
+	light := func(row, col int) bool {
+		row, col = row-quietZone, col-quietZone
+		if row < 0 || col < 0 || row >= c.Size || col >= c.Size {
+			return true
+		}
+		return !c.modules[row][col]
+	}
+
+	var b strings.Builder
+	size := c.Size + 2*quietZone
+	for row := 0; row < size; row += 2 {
+		for col := 0; col < size; col++ {
+			top, bottom := light(row, col), row+1 < size && light(row+1, col)
+			switch {
+			case top && bottom:
+				b.WriteString("█")
+			case top:
+				b.WriteString("▀")
+			case bottom:
+				b.WriteString("▄")
+			default:
+				b.WriteString(" ")
+			}
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// countBits is the length of the character count in byte mode
+func countBits(version int) int {
+	if version < 10 {
+		return 8
+	}
+	return 16
+}
+
+// encodeData returns the data codewords: the mode, the character count, the data, a terminator
+// and padding
+func encodeData(version int, data []byte) []byte {
+	capacity := layouts[version-1].dataCodewords() * 8
+
+	var bits []bool
+	appendBits := func(value, n int) {
+		for i := n - 1; i >= 0; i-- {
+			bits = append(bits, (value>>i)&1 == 1)
+		}
+	}
+	appendBits(0b0100, 4)
+	appendBits(len(data), countBits(version))
+	for _, b := range data {
+		appendBits(int(b), 8)
+	}
+	appendBits(0, min(4, capacity-len(bits)))
+	appendBits(0, (8-len(bits)%8)%8)
+
+	codewords := make([]byte, 0, capacity/8)
+	for i := 0; i < len(bits); i += 8 {
+		var b byte
+		for j := 0; j < 8; j++ {
+			if bits[i+j] {
+				b |= 1 << (7 - j)
+			}
+		}
+		codewords = append(codewords, b)
+	}
+	for pad := byte(0xEC); len(codewords) < capacity/8; pad ^= 0xEC ^ 0x11 {
+		codewords = append(codewords, pad)
+	}
+	return codewords
+}
+
+// interleave splits the data codewords into blocks, appends the error correction codewords
+// of each block and interleaves the blocks
+func interleave(version int, data []byte) []byte {
+	layout := layouts[version-1]
+	divisor := rsDivisor(layout.ecc)
+
+	var blocks, eccs [][]byte
+	for i, offset := 0, 0; i < layout.blocks1+layout.blocks2; i++ {
+		n := layout.data1
+		if i >= layout.blocks1 {
+			n++
+		}
+		block := data[offset : offset+n]
+		offset += n
+		blocks = append(blocks, block)
+		eccs = append(eccs, rsRemainder(block, divisor))
+	}
+
+	var result []byte
+	for i := 0; i <= layout.data1; i++ {
+		for _, block := range blocks {
+			if i < len(block) {
+				result = append(result, block[i])
+			}
+		}
+	}
+	for i := 0; i < layout.ecc; i++ {
+		for _, ecc := range eccs {
+			result = append(result, ecc[i])
+		}
+	}
+	return result
+}
+
+// set sets a function module
+func (c *Code) set(row, col int, dark bool) {
+	c.modules[row][col] = dark
+	c.function[row][col] = true
+}
+
+func (c *Code) drawFunctionPatterns() {
+	for i := 0; i < c.Size; i++ {
+		c.set(6, i, i%2 == 0)
+		c.set(i, 6, i%2 == 0)
+	}
+
+	c.drawFinder(3, 3)
+	c.drawFinder(3, c.Size-4)
+	c.drawFinder(c.Size-4, 3)
+
+	positions := alignmentPositions(c.Version)
+	last := len(positions) - 1
+	for i, row := range positions {
+		for j, col := range positions {
+			// Skip the three corners taken by finder patterns
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			c.drawAlignment(row, col)
+		}
+	}
+
+	// Reserve the format modules, they are drawn once the mask is chosen
+	c.drawFormat(0)
+	c.drawVersion()
+}
+
+// drawFinder draws a finder pattern with its separator around the center
+func (c *Code) drawFinder(row, col int) {
+	for dr := -4; dr <= 4; dr++ {
+		for dc := -4; dc <= 4; dc++ {
+			r, cc := row+dr, col+dc
+			if r < 0 || r >= c.Size || cc < 0 || cc >= c.Size {
+				continue
+			}
+			dist := max(abs(dr), abs(dc))
+			c.set(r, cc, dist != 2 && dist != 4)
+		}
+	}
+}
+
+func (c *Code) drawAlignment(row, col int) {
+	for dr := -2; dr <= 2; dr++ {
+		for dc := -2; dc <= 2; dc++ {
+			c.set(row+dr, col+dc, max(abs(dr), abs(dc)) != 1)
+		}
+	}
+}
+
+// alignmentPositions returns the rows and columns of alignment pattern centers
+func alignmentPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+	n := version/7 + 2
+	step := (version*4 + n*2 + 1) / (n*2 - 2) * 2
+	positions := make([]int, n)
+	positions[0] = 6
+	for i, pos := n-1, version*4+17-7; i >= 1; i, pos = i-1, pos-step {
+		positions[i] = pos
+	}
+	return positions
+}
+
+// formatBits returns the 15 format bits of level M and the mask
+func formatBits(mask int) int {
+	data := mask // level M is 00
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	return (data<<10 | rem) ^ 0x5412
+}
+
+// drawFormat draws both copies of the format information
+func (c *Code) drawFormat(mask int) {
+	bits := formatBits(mask)
+	bit := func(i int) bool { return (bits>>i)&1 == 1 }
+
+	for i := 0; i <= 5; i++ {
+		c.set(i, 8, bit(i))
+	}
+	c.set(7, 8, bit(6))
+	c.set(8, 8, bit(7))
+	c.set(8, 7, bit(8))
+	for i := 9; i < 15; i++ {
+		c.set(8, 14-i, bit(i))
+	}
+
+	for i := 0; i < 8; i++ {
+		c.set(8, c.Size-1-i, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		c.set(c.Size-15+i, 8, bit(i))
+	}
+	// The dark module
+	c.set(c.Size-8, 8, true)
+}
+
+// versionBits returns the 18 version information bits
+func versionBits(version int) int {
+	rem := version
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+	}
+	return version<<12 | rem
+}
+
+// drawVersion draws both copies of the version information of versions 7 and up
+func (c *Code) drawVersion() {
+	if c.Version < 7 {
+		return
+	}
+	bits := versionBits(c.Version)
+	for i := 0; i < 18; i++ {
+		dark := (bits>>i)&1 == 1
+		a, b := c.Size-11+i%3, i/3
+		c.set(b, a, dark)
+		c.set(a, b, dark)
+	}
+}
+
+// drawCodewords fills the data modules in the zigzag order, two columns at a time from the
+// bottom right corner
+func (c *Code) drawCodewords(codewords []byte) {
+	i := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		// The vertical timing pattern is skipped as a whole column
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < c.Size; vert++ {
+			row := vert
+			if upward {
+				row = c.Size - 1 - vert
+			}
+			for j := 0; j < 2; j++ {
+				col := right - j
+				if c.function[row][col] || i >= len(codewords)*8 {
+					continue
+				}
+				c.modules[row][col] = (codewords[i>>3]>>(7-i&7))&1 == 1
+				i++
+			}
+		}
+	}
+}
+
+// applyMask inverts the data modules selected by the mask pattern
+func (c *Code) applyMask(mask int) {
+	for row := 0; row < c.Size; row++ {
+		for col := 0; col < c.Size; col++ {
+			if c.function[row][col] {
+				continue
+			}
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (row+col)%2 == 0
+			case 1:
+				invert = row%2 == 0
+			case 2:
+				invert = col%3 == 0
+			case 3:
+				invert = (row+col)%3 == 0
+			case 4:
+				invert = (row/2+col/3)%2 == 0
+			case 5:
+				invert = row*col%2+row*col%3 == 0
+			case 6:
+				invert = (row*col%2+row*col%3)%2 == 0
+			case 7:
+				invert = ((row+col)%2+row*col%3)%2 == 0
+			}
+			if invert {
+				c.modules[row][col] = !c.modules[row][col]
+			}
+		}
+	}
+}
+
+// penalty scores how hard the code is to scan, lower is better
+func (c *Code) penalty() int {
+	penalty := 0
+	dark := 0
+
+	line := make([]bool, c.Size)
+	for _, horizontal := range []bool{true, false} {
+		for i := 0; i < c.Size; i++ {
+			for j := 0; j < c.Size; j++ {
+				if horizontal {
+					line[j] = c.modules[i][j]
+				} else {
+					line[j] = c.modules[j][i]
+				}
+			}
+			penalty += linePenalty(line)
+		}
+	}
+
+	for row := 0; row < c.Size; row++ {
+		for col := 0; col < c.Size; col++ {
+			if c.modules[row][col] {
+				dark++
+			}
+			if row+1 < c.Size && col+1 < c.Size {
+				m := c.modules[row][col]
+				if m == c.modules[row][col+1] && m == c.modules[row+1][col] && m == c.modules[row+1][col+1] {
+					penalty += 3
+				}
+			}
+		}
+	}
+
+	total := c.Size * c.Size
+	penalty += abs(dark*20-total*10) / total * 10
+	return penalty
+}
+
+// finderLike is a 1:1:3:1:1 pattern with four light modules on one side
+var finderLike = [][]bool{
+	{true, false, true, true, true, false, true, false, false, false, false},
+	{false, false, false, false, true, false, true, true, true, false, true},
+}
+
+// linePenalty scores runs of five or more modules of the same color and patterns that look
+// like finder patterns in a row or a column
+func linePenalty(line []bool) int {
+	penalty := 0
+	run := 1
+	for i := 1; i <= len(line); i++ {
+		if i < len(line) && line[i] == line[i-1] {
+			run++
+			continue
+		}
+		if run >= 5 {
+			penalty += run - 2
+		}
+		run = 1
+	}
+
+	for i := 0; i+11 <= len(line); i++ {
+		for _, pattern := range finderLike {
+			match := true
+			for j, m := range pattern {
+				if line[i+j] != m {
+					match = false
+					break
+				}
+			}
+			if match {
+				penalty += 40
+			}
+		}
+	}
+	return penalty
+}
+
+// rsDivisor returns the generator polynomial of the given degree, without the leading term
+func rsDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = gfMultiply(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+	return result
+}
+
+// rsRemainder returns the error correction codewords of the data
+func rsRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, d := range divisor {
+			result[i] ^= gfMultiply(d, factor)
+		}
+	}
+	return result
+}
+
+// gfMultiply multiplies in GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1
+func gfMultiply(x, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>i)&1) * int(x)
+	}
+	return byte(z)
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
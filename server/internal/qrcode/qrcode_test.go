@@ -0,0 +1,139 @@
+package qrcode
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRSRemainder(t *testing.T) {
+	// "HELLO WORLD" in version 1-M, from the worked example of the standard
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	ecc := rsRemainder(data, rsDivisor(10))
+	assert.Equal(t, []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}, ecc)
+}
+
+func TestFormatBits(t *testing.T) {
+	want := []int{
+		0b101010000010010, 0b101000100100101, 0b101111001111100, 0b101101101001011,
+		0b100010111111001, 0b100000011001110, 0b100111110010111, 0b100101010100000,
+	}
+	for mask, bits := range want {
+		assert.Equal(t, bits, formatBits(mask), "mask %d", mask)
+	}
+}
+
+func TestVersionBits(t *testing.T) {
+	assert.Equal(t, 0b000111110010010100, versionBits(7))
+	assert.Equal(t, 0b010100100110100110, versionBits(20))
+}
+
+func TestAlignmentPositions(t *testing.T) {
+	assert.Empty(t, alignmentPositions(1))
+	assert.Equal(t, []int{6, 18}, alignmentPositions(2))
+	assert.Equal(t, []int{6, 22, 38}, alignmentPositions(7))
+	assert.Equal(t, []int{6, 26, 48, 70}, alignmentPositions(15))
+}
+
+func TestLayouts(t *testing.T) {
+	for i, layout := range layouts {
+		version := i + 1
+		// Modules left for codewords once the function patterns are drawn
+		size := version*4 + 17
+		modules := size*size - 3*64 - 2*(size-16) - 31
+		if n := len(alignmentPositions(version)); n > 0 {
+			modules -= (n*n - 3) * 25
+			modules += 2 * (n - 2) * 5
+		}
+		if version >= 7 {
+			modules -= 36
+		}
+		total := layout.dataCodewords() + (layout.blocks1+layout.blocks2)*layout.ecc
+		assert.Equal(t, modules/8, total, "version %d", version)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	uri := "otpauth://totp/ChatGO:alice?secret=JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP&issuer=ChatGO&algorithm=SHA1&digits=6&period=30"
+	code, err := Encode([]byte(uri))
+	require.NoError(t, err)
+	assert.Equal(t, 7, code.Version)
+	assert.Equal(t, 45, code.Size)
+
+	// Finder pattern in the top left corner, with its separator
+	for i := 0; i < 7; i++ {
+		assert.True(t, code.Dark(0, i))
+		assert.True(t, code.Dark(6, i))
+		assert.False(t, code.Dark(7, i))
+	}
+	assert.True(t, code.Dark(3, 3))
+	assert.False(t, code.Dark(1, 1))
+	// Timing patterns and the dark module
+	for i := 8; i < code.Size-8; i++ {
+		assert.Equal(t, i%2 == 0, code.Dark(6, i))
+		assert.Equal(t, i%2 == 0, code.Dark(i, 6))
+	}
+	assert.True(t, code.Dark(code.Size-8, 8))
+
+	// Both copies of the format information agree
+	var first, second int
+	for i := 0; i < 15; i++ {
+		if code.Dark(formatModule(code.Size, i, false)) {
+			first |= 1 << i
+		}
+		if code.Dark(formatModule(code.Size, i, true)) {
+			second |= 1 << i
+		}
+	}
+	assert.Equal(t, first, second)
+	mask := (first ^ 0x5412) >> 10 & 7
+	assert.Equal(t, formatBits(mask), first)
+}
+
+// formatModule returns the position of a format bit in the first or the second copy
+func formatModule(size, i int, second bool) (int, int) {
+	switch {
+	case second && i < 8:
+		return 8, size - 1 - i
+	case second:
+		return size - 15 + i, 8
+	case i <= 5:
+		return i, 8
+	case i == 6:
+		return 7, 8
+	case i == 7:
+		return 8, 8
+	case i == 8:
+		return 8, 7
+	default:
+		return 8, 14 - i
+	}
+}
+
+func TestEncode_TooLong(t *testing.T) {
+	_, err := Encode(make([]byte, 667))
+	assert.ErrorIs(t, err, ErrTooLong)
+
+	code, err := Encode(make([]byte, 666))
+	require.NoError(t, err)
+	assert.Equal(t, 20, code.Version)
+}
+
+func TestText(t *testing.T) {
+	code, err := Encode([]byte("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, code.Version)
+
+	lines := strings.Split(strings.TrimSuffix(code.Text(), "\n"), "\n")
+	size := code.Size + 2*quietZone
+	assert.Len(t, lines, (size+1)/2)
+	for _, line := range lines {
+		assert.Equal(t, size, len([]rune(line)))
+	}
+	// The quiet zone is light
+	assert.Equal(t, strings.Repeat("█", size), lines[0])
+	// The top of the finder pattern is dark, the row below it is too
+	assert.Equal(t, "████ ", string([]rune(lines[2])[:5]))
+}
@@ -0,0 +1,59 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps the buckets in memory, so each instance limits requests on its own
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, rule Rule) (bool, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: rule.capacity(), updatedAt: now}
+		s.buckets[key] = b
+	}
+
+	b.tokens = min(rule.capacity(), b.tokens+now.Sub(b.updatedAt).Seconds()*rule.refill())
+	b.updatedAt = now
+	if b.tokens < 1 {
+		return false, retryAfter(b.tokens, rule), nil
+	}
+	b.tokens--
+	return true, 0, nil
+}
+
+func (s *MemoryStore) Prune(ctx context.Context, idle time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	before := s.now().Add(-idle)
+	for key, b := range s.buckets {
+		if b.updatedAt.Before(before) {
+			delete(s.buckets, key)
+		}
+	}
+	return nil
+}
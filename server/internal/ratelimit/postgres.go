@@ -0,0 +1,56 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// PostgresStore keeps the buckets in the rate_limit_buckets table, so that all instances share
+// the limits. Buckets are refilled by the database clock, so the clocks of the instances don't matter
+type PostgresStore struct {
+	db *sql.DB
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// Take refills the bucket and takes a token in one statement. The conflicting row stays locked
+// until the statement ends, so concurrent requests can't take the same token
+func (s *PostgresStore) Take(ctx context.Context, key string, rule Rule) (bool, time.Duration, error) {
+	var tokens float64
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO rate_limit_buckets AS b (key, tokens, updated_at)
+		VALUES ($1, $2::float8 - 1, CURRENT_TIMESTAMP)
+		ON CONFLICT (key) DO UPDATE SET
+			tokens = LEAST($2::float8, b.tokens + EXTRACT(EPOCH FROM CURRENT_TIMESTAMP - b.updated_at)::float8 * $3::float8) - 1,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE LEAST($2::float8, b.tokens + EXTRACT(EPOCH FROM CURRENT_TIMESTAMP - b.updated_at)::float8 * $3::float8) >= 1
+		RETURNING tokens`,
+		key, rule.capacity(), rule.refill()).Scan(&tokens)
+	if err == nil {
+		return true, 0, nil
+	}
+	if err != sql.ErrNoRows {
+		return false, 0, err
+	}
+
+	// The bucket is empty, it was not updated
+	err = s.db.QueryRowContext(ctx, `
+		SELECT LEAST($2::float8, tokens + EXTRACT(EPOCH FROM CURRENT_TIMESTAMP - updated_at)::float8 * $3::float8)
+		FROM rate_limit_buckets
+		WHERE key = $1`,
+		key, rule.capacity(), rule.refill()).Scan(&tokens)
+	if err != nil {
+		return false, 0, err
+	}
+	return false, retryAfter(tokens, rule), nil
+}
+
+func (s *PostgresStore) Prune(ctx context.Context, idle time.Duration) error {
+	_, err := s.db.ExecContext(ctx,
+		"DELETE FROM rate_limit_buckets WHERE updated_at < CURRENT_TIMESTAMP - $1 * INTERVAL '1 second'",
+		idle.Seconds())
+	return err
+}
@@ -0,0 +1,61 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPostgresStore_Take(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	store := NewPostgresStore(db)
+	rule := Rule{Rate: 1, Per: 10 * time.Second, Burst: 5}
+
+	mock.ExpectQuery("INSERT INTO rate_limit_buckets (.+) ON CONFLICT \\(key\\) DO UPDATE (.+) RETURNING tokens").
+		WithArgs("route:POST /login|ip:10.0.0.1", 5.0, 0.1).
+		WillReturnRows(sqlmock.NewRows([]string{"tokens"}).AddRow(4.0))
+	mock.ExpectQuery("INSERT INTO rate_limit_buckets").
+		WithArgs("route:POST /login|ip:10.0.0.1", 5.0, 0.1).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery("SELECT (.+) FROM rate_limit_buckets WHERE key = \\$1").
+		WithArgs("route:POST /login|ip:10.0.0.1", 5.0, 0.1).
+		WillReturnRows(sqlmock.NewRows([]string{"tokens"}).AddRow(0.25))
+
+	ok, _, err := store.Take(context.Background(), "route:POST /login|ip:10.0.0.1", rule)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, wait, err := store.Take(context.Background(), "route:POST /login|ip:10.0.0.1", rule)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, 7500*time.Millisecond, wait)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestPostgresStore_Prune(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock DB: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec("DELETE FROM rate_limit_buckets WHERE updated_at < (.+)").
+		WithArgs(86400.0).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	assert.NoError(t, NewPostgresStore(db).Prune(context.Background(), 24*time.Hour))
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,197 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"time"
+)
+
+const (
+	// pruneInterval is how often unused buckets are deleted
+	pruneInterval = 10 * time.Minute
+	// pruneIdle is how long a bucket may stay unused before it is deleted. A deleted bucket
+	// starts full again, so it must be longer than any rule takes to refill
+	pruneIdle = 24 * time.Hour
+)
+
+// Rule is a token bucket that holds up to Burst tokens and gets Rate tokens every Per.
+// Each request takes a token, requests are rejected while the bucket is empty
+type Rule struct {
+	Rate int           `yaml:"rate"`
+	Per  time.Duration `yaml:"per"`
+	// Burst defaults to Rate
+	Burst int `yaml:"burst"`
+}
+
+// enabled reports whether the rule limits anything. A rule with a zero rate turns a default limit off
+func (r Rule) enabled() bool {
+	return r.Rate > 0 && r.Per > 0
+}
+
+// capacity is the number of tokens in a full bucket
+func (r Rule) capacity() float64 {
+	if r.Burst > 0 {
+		return float64(r.Burst)
+	}
+	return float64(r.Rate)
+}
+
+// refill is the number of tokens added per second
+func (r Rule) refill() float64 {
+	return float64(r.Rate) / r.Per.Seconds()
+}
+
+// Config selects the store and overrides the default rules.
+// Store is either "memory" (default), which limits each instance on its own, or "postgres",
+// which shares the buckets between all instances through the database
+type Config struct {
+	Store string `yaml:"store"`
+	// Routes are keyed by the method and the route pattern, e.g. "POST /login"
+	Routes map[string]Rule `yaml:"routes"`
+	// Messages are keyed by the WebSocket message type, e.g. "message" or "reaction_add"
+	Messages map[string]Rule `yaml:"messages"`
+}
+
+// DefaultRoutes limit password and two-factor code guesses, signups and the bot API
+var DefaultRoutes = map[string]Rule{
+	"POST /login":                      {Rate: 10, Per: time.Minute},
+	"POST /login/2fa":                  {Rate: 10, Per: time.Minute},
+	"PUT /users/me/password":           {Rate: 5, Per: time.Minute},
+	"POST /password/reset":             {Rate: 5, Per: time.Minute},
+	"POST /signup":                     {Rate: 5, Per: time.Hour},
+	"POST /attachments/:roomId":        {Rate: 20, Per: time.Minute},
+	"POST /bot/rooms/:roomId/messages": {Rate: 60, Per: time.Minute, Burst: 20},
+	"POST /hooks/:token":               {Rate: 60, Per: time.Minute, Burst: 20},
+}
+
+// DefaultMessages limit how fast a client can post to rooms. Slash commands and messages
+// of unknown types count as messages
+var DefaultMessages = map[string]Rule{
+	"message":         {Rate: 20, Per: 10 * time.Second},
+	"reaction_add":    {Rate: 30, Per: 10 * time.Second},
+	"reaction_remove": {Rate: 30, Per: 10 * time.Second},
+	"read":            {Rate: 30, Per: 10 * time.Second},
+	"pin":             {Rate: 10, Per: time.Minute},
+	"unpin":           {Rate: 10, Per: time.Minute},
+}
+
+// Store keeps the token buckets
+type Store interface {
+	// Take takes a token from the bucket with the given key. When the bucket is empty it returns
+	// false and how long until the next token
+	Take(ctx context.Context, key string, rule Rule) (bool, time.Duration, error)
+	// Prune deletes the buckets unused for longer than idle
+	Prune(ctx context.Context, idle time.Duration) error
+}
+
+// Limiter applies the rules of routes and message types. A nil Limiter allows everything
+type Limiter struct {
+	store    Store
+	routes   map[string]Rule
+	messages map[string]Rule
+}
+
+// New creates the limiter described by the config. db is only used by the postgres store
+func New(config *Config, db *sql.DB) (*Limiter, error) {
+	var store Store
+	switch config.Store {
+	case "", "memory":
+		store = NewMemoryStore()
+	case "postgres":
+		store = NewPostgresStore(db)
+	default:
+		return nil, fmt.Errorf("unknown rate limit store %q", config.Store)
+	}
+	return NewLimiter(store, merge(DefaultRoutes, config.Routes), merge(DefaultMessages, config.Messages)), nil
+}
+
+// NewLimiter creates a limiter with the given rules
+func NewLimiter(store Store, routes, messages map[string]Rule) *Limiter {
+	return &Limiter{store: store, routes: routes, messages: messages}
+}
+
+// merge overrides the default rules with the configured ones and drops disabled rules
+func merge(defaults, configured map[string]Rule) map[string]Rule {
+	rules := make(map[string]Rule, len(defaults)+len(configured))
+	for name, rule := range defaults {
+		rules[name] = rule
+	}
+	for name, rule := range configured {
+		rules[name] = rule
+	}
+	for name, rule := range rules {
+		if !rule.enabled() {
+			delete(rules, name)
+		}
+	}
+	return rules
+}
+
+// AllowRoute takes a token for the route from the bucket of each key, e.g. "ip:10.0.0.1" and
+// "user:5". It returns false and how long to wait when any of the buckets is empty
+func (l *Limiter) AllowRoute(ctx context.Context, route string, keys ...string) (bool, time.Duration, error) {
+	if l == nil {
+		return true, 0, nil
+	}
+	rule, ok := l.routes[route]
+	if !ok {
+		return true, 0, nil
+	}
+	return l.allow(ctx, "route:"+route, rule, keys)
+}
+
+// AllowMessage takes a token for the WebSocket message type from the bucket of each key
+func (l *Limiter) AllowMessage(ctx context.Context, messageType string, keys ...string) (bool, time.Duration, error) {
+	if l == nil {
+		return true, 0, nil
+	}
+	rule, ok := l.messages[messageType]
+	if !ok {
+		return true, 0, nil
+	}
+	return l.allow(ctx, "message:"+messageType, rule, keys)
+}
+
+func (l *Limiter) allow(ctx context.Context, name string, rule Rule, keys []string) (bool, time.Duration, error) {
+	allowed, wait := true, time.Duration(0)
+	for _, key := range keys {
+		ok, retryAfter, err := l.store.Take(ctx, name+"|"+key, rule)
+		if err != nil {
+			return false, 0, err
+		}
+		if !ok {
+			allowed = false
+			wait = max(wait, retryAfter)
+		}
+	}
+	return allowed, wait, nil
+}
+
+// Run deletes unused buckets until the context is canceled
+func (l *Limiter) Run(ctx context.Context) {
+	if l == nil {
+		return
+	}
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := l.store.Prune(ctx, pruneIdle); err != nil {
+				log.Printf("Failed to prune rate limit buckets: %v", err)
+			}
+		}
+	}
+}
+
+// retryAfter returns how long until a bucket with the given tokens has a whole token
+func retryAfter(tokens float64, rule Rule) time.Duration {
+	seconds := (1 - tokens) / rule.refill()
+	return time.Duration(math.Ceil(seconds * float64(time.Second)))
+}
@@ -0,0 +1,105 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestMemoryStore_Take(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Unix(1700000000, 0)
+	store.now = func() time.Time { return now }
+	rule := Rule{Rate: 1, Per: 10 * time.Second, Burst: 2}
+
+	for i := 0; i < 2; i++ {
+		ok, _, err := store.Take(context.Background(), "k", rule)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	}
+	ok, wait, err := store.Take(context.Background(), "k", rule)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, 10*time.Second, wait)
+
+	// Other keys have their own buckets
+	ok, _, _ = store.Take(context.Background(), "other", rule)
+	assert.True(t, ok)
+
+	now = now.Add(4 * time.Second)
+	ok, wait, _ = store.Take(context.Background(), "k", rule)
+	assert.False(t, ok)
+	assert.Equal(t, 6*time.Second, wait)
+
+	now = now.Add(6 * time.Second)
+	ok, _, _ = store.Take(context.Background(), "k", rule)
+	assert.True(t, ok)
+}
+
+func TestMemoryStore_Prune(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Unix(1700000000, 0)
+	store.now = func() time.Time { return now }
+	rule := Rule{Rate: 1, Per: time.Minute}
+
+	store.Take(context.Background(), "old", rule)
+	now = now.Add(time.Hour)
+	store.Take(context.Background(), "new", rule)
+
+	assert.NoError(t, store.Prune(context.Background(), 30*time.Minute))
+	assert.Len(t, store.buckets, 1)
+	assert.Contains(t, store.buckets, "new")
+}
+
+func TestLimiter_AllowRoute(t *testing.T) {
+	store := NewMemoryStore()
+	store.now = func() time.Time { return time.Unix(1700000000, 0) }
+	limiter := NewLimiter(store, map[string]Rule{"POST /login": {Rate: 2, Per: time.Minute}}, nil)
+
+	for i := 0; i < 2; i++ {
+		ok, _, err := limiter.AllowRoute(context.Background(), "POST /login", "ip:10.0.0.1", "username:alice")
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	}
+
+	// The same user from another address is still limited
+	ok, wait, err := limiter.AllowRoute(context.Background(), "POST /login", "ip:10.0.0.2", "username:alice")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, 30*time.Second, wait)
+
+	ok, _, _ = limiter.AllowRoute(context.Background(), "POST /login", "ip:10.0.0.3", "username:bob")
+	assert.True(t, ok)
+
+	// Routes without a rule and a nil limiter allow everything
+	ok, _, _ = limiter.AllowRoute(context.Background(), "GET /users", "ip:10.0.0.1")
+	assert.True(t, ok)
+	ok, _, _ = (*Limiter)(nil).AllowMessage(context.Background(), "message", "user:1")
+	assert.True(t, ok)
+}
+
+func TestNew(t *testing.T) {
+	var config Config
+	err := yaml.Unmarshal([]byte(`
+routes:
+  POST /login: {rate: 3, per: 1m}
+  POST /signup: {rate: 0}
+messages:
+  typing: {rate: 5, per: 10s, burst: 1}
+`), &config)
+	assert.NoError(t, err)
+
+	limiter, err := New(&config, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, Rule{Rate: 3, Per: time.Minute}, limiter.routes["POST /login"])
+	assert.NotContains(t, limiter.routes, "POST /signup")
+	assert.Equal(t, DefaultRoutes["POST /hooks/:token"], limiter.routes["POST /hooks/:token"])
+	assert.Equal(t, Rule{Rate: 5, Per: 10 * time.Second, Burst: 1}, limiter.messages["typing"])
+	assert.Contains(t, limiter.messages, "message")
+
+	_, err = New(&Config{Store: "redis"}, nil)
+	assert.Error(t, err)
+}
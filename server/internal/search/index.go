@@ -0,0 +1,316 @@
+package search
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Document represents a decrypted message stored in the index
+type Document struct {
+	ID        string
+	RoomID    string
+	Username  string
+	Content   string
+	CreatedAt time.Time
+}
+
+type entry struct {
+	doc    Document
+	tokens []string
+}
+
+// Index is an in-memory inverted index over decrypted message content
+type Index struct {
+	mu       sync.RWMutex
+	docs     map[string]*entry
+	postings map[string]map[string]struct{}
+}
+
+func NewIndex() *Index {
+	return &Index{
+		docs:     make(map[string]*entry),
+		postings: make(map[string]map[string]struct{}),
+	}
+}
+
+// Add indexes a document, replacing any previous version with the same ID
+func (i *Index) Add(doc Document) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.remove(doc.ID)
+
+	e := &entry{doc: doc, tokens: Tokenize(doc.Content)}
+	i.docs[doc.ID] = e
+	for _, token := range e.tokens {
+		ids, ok := i.postings[token]
+		if !ok {
+			ids = make(map[string]struct{})
+			i.postings[token] = ids
+		}
+		ids[doc.ID] = struct{}{}
+	}
+}
+
+// Len returns the number of indexed documents
+func (i *Index) Len() int {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	return len(i.docs)
+}
+
+// Remove deletes a document from the index
+func (i *Index) Remove(id string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.remove(id)
+}
+
+func (i *Index) remove(id string) {
+	e, ok := i.docs[id]
+	if !ok {
+		return
+	}
+	for _, token := range e.tokens {
+		if ids, ok := i.postings[token]; ok {
+			delete(ids, id)
+			if len(ids) == 0 {
+				delete(i.postings, token)
+			}
+		}
+	}
+	delete(i.docs, id)
+}
+
+// Search returns documents from the given rooms matching the query, newest first
+func (i *Index) Search(q *Query, roomIDs []string, limit int) []Document {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	rooms := make(map[string]struct{}, len(roomIDs))
+	for _, id := range roomIDs {
+		rooms[id] = struct{}{}
+	}
+
+	var result []Document
+	for _, id := range i.candidates(q) {
+		e := i.docs[id]
+		if _, ok := rooms[e.doc.RoomID]; !ok {
+			continue
+		}
+		if q.matches(e) {
+			result = append(result, e.doc)
+		}
+	}
+
+	sort.Slice(result, func(a, b int) bool {
+		return result[a].CreatedAt.After(result[b].CreatedAt)
+	})
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+
+	return result
+}
+
+// candidates returns IDs of documents containing every query word, or all documents
+// when the query has no words
+func (i *Index) candidates(q *Query) []string {
+	words := q.words()
+	if len(words) == 0 {
+		ids := make([]string, 0, len(i.docs))
+		for id := range i.docs {
+			ids = append(ids, id)
+		}
+		return ids
+	}
+
+	// Start from the rarest word to keep the intersection small
+	sort.Slice(words, func(a, b int) bool {
+		return len(i.postings[words[a]]) < len(i.postings[words[b]])
+	})
+
+	var ids []string
+	for id := range i.postings[words[0]] {
+		found := true
+		for _, word := range words[1:] {
+			if _, ok := i.postings[word][id]; !ok {
+				found = false
+				break
+			}
+		}
+		if found {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// Query represents a parsed search query
+type Query struct {
+	Terms   []string
+	Phrases [][]string
+	From    string
+	After   time.Time
+	Before  time.Time
+}
+
+const dateLayout = "2006-01-02"
+
+// ParseQuery parses a raw search string. Besides plain words it understands
+// "quoted phrases", from:<username>, after:<date> and before:<date>.
+// Dates are either YYYY-MM-DD or RFC3339.
+func ParseQuery(raw string) (*Query, error) {
+	q := &Query{}
+
+	for _, field := range splitFields(raw) {
+		if strings.HasPrefix(field, `"`) {
+			if tokens := Tokenize(strings.Trim(field, `"`)); len(tokens) > 0 {
+				q.Phrases = append(q.Phrases, tokens)
+			}
+			continue
+		}
+
+		key, value, found := strings.Cut(field, ":")
+		if found && value != "" {
+			switch strings.ToLower(key) {
+			case "from":
+				q.From = strings.TrimPrefix(value, "@")
+				continue
+			case "after":
+				t, err := parseDate(value)
+				if err != nil {
+					return nil, err
+				}
+				q.After = t
+				continue
+			case "before":
+				t, err := parseDate(value)
+				if err != nil {
+					return nil, err
+				}
+				q.Before = t
+				continue
+			}
+		}
+
+		q.Terms = append(q.Terms, Tokenize(field)...)
+	}
+
+	if len(q.Terms) == 0 && len(q.Phrases) == 0 && q.From == "" && q.After.IsZero() && q.Before.IsZero() {
+		return nil, errors.New("empty search query")
+	}
+
+	return q, nil
+}
+
+func parseDate(value string) (time.Time, error) {
+	if t, err := time.Parse(dateLayout, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, errors.New("invalid date: " + value)
+	}
+	return t, nil
+}
+
+// splitFields splits a query on whitespace keeping quoted phrases together
+func splitFields(raw string) []string {
+	var fields []string
+	var current strings.Builder
+	quoted := false
+
+	flush := func() {
+		if current.Len() > 0 {
+			fields = append(fields, current.String())
+			current.Reset()
+		}
+	}
+
+	for _, r := range raw {
+		switch {
+		case r == '"':
+			if quoted {
+				current.WriteRune(r)
+				flush()
+			} else {
+				flush()
+				current.WriteRune(r)
+			}
+			quoted = !quoted
+		case unicode.IsSpace(r) && !quoted:
+			flush()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	flush()
+
+	return fields
+}
+
+func (q *Query) words() []string {
+	seen := make(map[string]struct{})
+	var words []string
+	add := func(tokens ...string) {
+		for _, token := range tokens {
+			if _, ok := seen[token]; !ok {
+				seen[token] = struct{}{}
+				words = append(words, token)
+			}
+		}
+	}
+	add(q.Terms...)
+	for _, phrase := range q.Phrases {
+		add(phrase...)
+	}
+	return words
+}
+
+func (q *Query) matches(e *entry) bool {
+	if q.From != "" && !strings.EqualFold(q.From, e.doc.Username) {
+		return false
+	}
+	if !q.After.IsZero() && e.doc.CreatedAt.Before(q.After) {
+		return false
+	}
+	if !q.Before.IsZero() && !e.doc.CreatedAt.Before(q.Before) {
+		return false
+	}
+	for _, phrase := range q.Phrases {
+		if !containsPhrase(e.tokens, phrase) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsPhrase(tokens, phrase []string) bool {
+	for start := 0; start+len(phrase) <= len(tokens); start++ {
+		match := true
+		for j, word := range phrase {
+			if tokens[start+j] != word {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// Tokenize splits text into lowercase words
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
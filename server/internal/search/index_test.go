@@ -0,0 +1,123 @@
+package search
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testIndex() *Index {
+	index := NewIndex()
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	index.Add(Document{ID: "1", RoomID: "1", Username: "alice", Content: "Deploy is broken again", CreatedAt: base})
+	index.Add(Document{ID: "2", RoomID: "1", Username: "bob", Content: "The deploy broke the build", CreatedAt: base.Add(24 * time.Hour)})
+	index.Add(Document{ID: "3", RoomID: "2", Username: "alice", Content: "broken deploy in staging", CreatedAt: base.Add(48 * time.Hour)})
+	index.Add(Document{ID: "4", RoomID: "1", Username: "carol", Content: "Lunch?", CreatedAt: base.Add(72 * time.Hour)})
+
+	return index
+}
+
+func ids(docs []Document) []string {
+	result := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		result = append(result, doc.ID)
+	}
+	return result
+}
+
+func TestParseQuery(t *testing.T) {
+	q, err := ParseQuery(`deploy "is broken" from:@alice after:2024-01-01 before:2024-02-01T00:00:00Z`)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"deploy"}, q.Terms)
+	assert.Equal(t, [][]string{{"is", "broken"}}, q.Phrases)
+	assert.Equal(t, "alice", q.From)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), q.After)
+	assert.Equal(t, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), q.Before)
+
+	_, err = ParseQuery("   ")
+	assert.Error(t, err)
+
+	_, err = ParseQuery("after:yesterday")
+	assert.Error(t, err)
+}
+
+func TestIndex_Search(t *testing.T) {
+	testCases := []struct {
+		name     string
+		query    string
+		rooms    []string
+		expected []string
+	}{
+		{
+			name:     "Words match in any order, newest first",
+			query:    "deploy BROKEN",
+			rooms:    []string{"1", "2"},
+			expected: []string{"3", "1"},
+		},
+		{
+			name:     "Results are scoped to rooms",
+			query:    "deploy",
+			rooms:    []string{"1"},
+			expected: []string{"2", "1"},
+		},
+		{
+			name:     "Phrase requires adjacent words",
+			query:    `"broken deploy"`,
+			rooms:    []string{"1", "2"},
+			expected: []string{"3"},
+		},
+		{
+			name:     "Sender filter",
+			query:    "deploy from:bob",
+			rooms:    []string{"1", "2"},
+			expected: []string{"2"},
+		},
+		{
+			name:     "Date range without words",
+			query:    "after:2024-01-02 before:2024-01-04",
+			rooms:    []string{"1", "2"},
+			expected: []string{"3", "2"},
+		},
+		{
+			name:     "No matches",
+			query:    "kubernetes",
+			rooms:    []string{"1", "2"},
+			expected: []string{},
+		},
+	}
+
+	index := testIndex()
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q, err := ParseQuery(tc.query)
+			assert.NoError(t, err)
+
+			assert.Equal(t, tc.expected, ids(index.Search(q, tc.rooms, 0)))
+		})
+	}
+}
+
+func TestIndex_AddReplacesDocument(t *testing.T) {
+	index := testIndex()
+	index.Add(Document{ID: "4", RoomID: "1", Username: "carol", Content: "Dinner?", CreatedAt: time.Now()})
+
+	q, _ := ParseQuery("lunch")
+	assert.Empty(t, index.Search(q, []string{"1"}, 0))
+
+	q, _ = ParseQuery("dinner")
+	assert.Equal(t, []string{"4"}, ids(index.Search(q, []string{"1"}, 0)))
+	assert.Equal(t, 4, index.Len())
+}
+
+func TestIndex_Remove(t *testing.T) {
+	index := testIndex()
+	index.Remove("2")
+	index.Remove("missing")
+
+	q, _ := ParseQuery("deploy")
+	assert.Equal(t, []string{"1"}, ids(index.Search(q, []string{"1"}, 0)))
+	assert.Equal(t, 3, index.Len())
+}
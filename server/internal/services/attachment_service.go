@@ -0,0 +1,216 @@
+package services
+
+import (
+	"bytes"
+	"chatgo/server/internal/interfaces"
+	"chatgo/server/internal/models"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+const (
+	// MaxAttachmentSize ограничивает размер загружаемого файла
+	MaxAttachmentSize = 10 << 20
+	maxFilenameLength = 255
+)
+
+// UploadAttachment шифрует файл и сохраняет его в хранилище. Файл можно загрузить только в чат,
+// участником которого является пользователь. Тип содержимого определяется по самим данным
+func (s *service) UploadAttachment(c context.Context, req *interfaces.UploadAttachmentReq) (*interfaces.AttachmentRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	if len(req.Data) == 0 {
+		return nil, errors.New("file is empty")
+	}
+	if len(req.Data) > MaxAttachmentSize {
+		return nil, interfaces.ErrAttachmentTooLarge
+	}
+
+	if err := s.checkRoomMember(ctx, req.UserID, req.RoomID); err != nil {
+		return nil, err
+	}
+
+	// Файлы шифруются ключом чата на сервере, что противоречит сквозному шифрованию
+	room, err := s.Repository.GetChatRoomByID(ctx, req.RoomID)
+	if err != nil {
+		return nil, err
+	}
+	if room != nil && room.E2E {
+		return nil, interfaces.ErrE2ERoom
+	}
+
+	encrypted, keyVersion, err := s.encryptBlob(ctx, req.RoomID, req.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := newStorageKey(req.RoomID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.blobs.Put(ctx, key, bytes.NewReader(encrypted), int64(len(encrypted))); err != nil {
+		return nil, err
+	}
+
+	attachment, err := s.Repository.CreateAttachment(ctx, &models.Attachment{
+		ChatRoomID:  req.RoomID,
+		UploaderID:  req.UserID,
+		Filename:    sanitizeFilename(req.Filename),
+		ContentType: http.DetectContentType(req.Data),
+		Size:        int64(len(req.Data)),
+		StorageKey:  key,
+		KeyVersion:  keyVersion,
+	})
+	if err != nil {
+		if err := s.blobs.Delete(ctx, key); err != nil {
+			log.Printf("Failed to delete orphaned blob %s: %v", key, err)
+		}
+		return nil, err
+	}
+
+	return toAttachmentRes(attachment), nil
+}
+
+// DownloadAttachment возвращает расшифрованный файл. Скачать файл могут участники чата,
+// а аватар пользователя — кто угодно
+func (s *service) DownloadAttachment(c context.Context, userID string, attachmentID string) (*interfaces.DownloadAttachmentRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	attachment, err := s.Repository.GetAttachmentByID(ctx, attachmentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, interfaces.ErrAttachmentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkRoomMember(ctx, userID, attachment.ChatRoomID); err != nil {
+		// Аватар виден всем, кто смотрит профиль, а не только участникам чата
+		if !errors.Is(err, interfaces.ErrNotRoomMember) || !s.isAvatar(ctx, attachment) {
+			return nil, err
+		}
+	}
+
+	r, err := s.blobs.Get(ctx, attachment.StorageKey)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	encrypted, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	data, err := s.decryptBlob(ctx, attachment.ChatRoomID, attachment.KeyVersion, encrypted)
+	if err != nil {
+		return nil, err
+	}
+
+	return &interfaces.DownloadAttachmentRes{
+		AttachmentRes: *toAttachmentRes(attachment),
+		Data:          data,
+	}, nil
+}
+
+// linkAttachments прикрепляет загруженные файлы к новому сообщению
+func (s *service) linkAttachments(ctx context.Context, message *models.Message, attachmentIDs []string) ([]*interfaces.AttachmentRes, error) {
+	if len(attachmentIDs) == 0 {
+		return nil, nil
+	}
+
+	n, err := s.Repository.LinkAttachments(ctx, message, attachmentIDs)
+	if err != nil {
+		return nil, err
+	}
+	if n != int64(len(attachmentIDs)) {
+		log.Printf("Linked %d of %d attachments to message %s", n, len(attachmentIDs), message.ID)
+	}
+
+	attachments, err := s.getAttachments(ctx, []string{message.ID})
+	if err != nil {
+		return nil, err
+	}
+	return attachments[message.ID], nil
+}
+
+// getAttachments возвращает файлы, сгруппированные по ID сообщения
+func (s *service) getAttachments(ctx context.Context, messageIDs []string) (map[string][]*interfaces.AttachmentRes, error) {
+	result := make(map[string][]*interfaces.AttachmentRes)
+	if len(messageIDs) == 0 {
+		return result, nil
+	}
+
+	attachments, err := s.Repository.GetAttachmentsByMessageIDs(ctx, messageIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, attachment := range attachments {
+		result[attachment.MessageID.String] = append(result[attachment.MessageID.String], toAttachmentRes(attachment))
+	}
+
+	return result, nil
+}
+
+// checkRoomMember возвращает ErrNotRoomMember, если пользователь не состоит в чате
+func (s *service) checkRoomMember(ctx context.Context, userID, roomID string) error {
+	members, err := s.Repository.GetMembersByChatRoomID(ctx, roomID)
+	if err != nil {
+		return err
+	}
+	for _, member := range members {
+		if member.UserID == userID {
+			return nil
+		}
+	}
+	return interfaces.ErrNotRoomMember
+}
+
+func toAttachmentRes(attachment *models.Attachment) *interfaces.AttachmentRes {
+	return &interfaces.AttachmentRes{
+		ID:          attachment.ID,
+		RoomID:      attachment.ChatRoomID,
+		Filename:    attachment.Filename,
+		ContentType: attachment.ContentType,
+		Size:        attachment.Size,
+	}
+}
+
+// newStorageKey генерирует случайный ключ файла в хранилище
+func newStorageKey(roomID string) (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("rooms/%s/%s", roomID, hex.EncodeToString(buf)), nil
+}
+
+// sanitizeFilename оставляет от имени файла только базовое имя без управляющих символов
+func sanitizeFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+
+	if name == "" || name == "." || name == "/" {
+		name = "file"
+	}
+	if runes := []rune(name); len(runes) > maxFilenameLength {
+		name = string(runes[len(runes)-maxFilenameLength:])
+	}
+	return name
+}
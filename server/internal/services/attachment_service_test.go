@@ -0,0 +1,127 @@
+package services
+
+import (
+	"bytes"
+	"chatgo/server/internal/interfaces"
+	"chatgo/server/internal/models"
+	"chatgo/server/internal/storage"
+	"context"
+	"database/sql"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func TestService_UploadAttachment(t *testing.T) {
+	mockRepo := new(MockRepository)
+	mockRoomKeys(mockRepo)
+	blobs, err := storage.NewLocalStore(t.TempDir())
+	assert.NoError(t, err)
+	service := NewService(mockRepo, config, blobs)
+
+	created := &models.Attachment{}
+	mockRepo.On("GetMembersByChatRoomID", mock.Anything, "room1").Return([]*models.ChatRoomMember{{UserID: "user1"}}, nil)
+	mockRepo.On("GetChatRoomByID", mock.Anything, "room1").Return(&models.ChatRoom{ID: "room1"}, nil)
+	mockRepo.On("CreateAttachment", mock.Anything, mock.MatchedBy(func(a *models.Attachment) bool {
+		return a.Filename == "cat.png" && a.ContentType == "image/png" && a.Size == int64(len(pngHeader))
+	})).Run(func(args mock.Arguments) {
+		*created = *args.Get(1).(*models.Attachment)
+		created.ID = "7"
+		created.CreatedAt = time.Now()
+	}).Return(created, nil)
+
+	res, err := service.UploadAttachment(context.Background(), &interfaces.UploadAttachmentReq{
+		UserID:   "user1",
+		RoomID:   "room1",
+		Filename: "../../photos/cat.png",
+		Data:     pngHeader,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "7", res.ID)
+	assert.Equal(t, "image/png", res.ContentType)
+	assert.Equal(t, 1, created.KeyVersion)
+
+	// The blob must not contain the plaintext
+	r, err := blobs.Get(context.Background(), created.StorageKey)
+	assert.NoError(t, err)
+	stored, _ := io.ReadAll(r)
+	r.Close()
+	assert.False(t, bytes.Contains(stored, pngHeader))
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_UploadAttachment_Rejected(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewService(mockRepo, config, nil)
+
+	mockRepo.On("GetMembersByChatRoomID", mock.Anything, "room1").Return([]*models.ChatRoomMember{{UserID: "user2"}}, nil)
+
+	_, err := service.UploadAttachment(context.Background(), &interfaces.UploadAttachmentReq{
+		UserID: "user1", RoomID: "room1", Filename: "a.txt", Data: []byte("hello"),
+	})
+	assert.ErrorIs(t, err, interfaces.ErrNotRoomMember)
+
+	_, err = service.UploadAttachment(context.Background(), &interfaces.UploadAttachmentReq{
+		UserID: "user1", RoomID: "room1", Filename: "big.bin", Data: make([]byte, MaxAttachmentSize+1),
+	})
+	assert.ErrorIs(t, err, interfaces.ErrAttachmentTooLarge)
+
+	mockRepo.On("GetMembersByChatRoomID", mock.Anything, "room2").Return([]*models.ChatRoomMember{{UserID: "user1"}}, nil)
+	mockRepo.On("GetChatRoomByID", mock.Anything, "room2").Return(&models.ChatRoom{ID: "room2", E2E: true}, nil)
+	_, err = service.UploadAttachment(context.Background(), &interfaces.UploadAttachmentReq{
+		UserID: "user1", RoomID: "room2", Filename: "a.txt", Data: []byte("hello"),
+	})
+	assert.ErrorIs(t, err, interfaces.ErrE2ERoom)
+
+	mockRepo.AssertNotCalled(t, "CreateAttachment", mock.Anything, mock.Anything)
+}
+
+func TestService_DownloadAttachment(t *testing.T) {
+	mockRepo := new(MockRepository)
+	mockRoomKeys(mockRepo)
+	blobs, err := storage.NewLocalStore(t.TempDir())
+	assert.NoError(t, err)
+	service := NewService(mockRepo, config, blobs)
+
+	mockRepo.On("GetMembersByChatRoomID", mock.Anything, "room1").Return([]*models.ChatRoomMember{{UserID: "user1"}}, nil)
+	mockRepo.On("GetChatRoomByID", mock.Anything, "room1").Return(&models.ChatRoom{ID: "room1"}, nil)
+	created := &models.Attachment{}
+	mockRepo.On("CreateAttachment", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		*created = *args.Get(1).(*models.Attachment)
+		created.ID = "7"
+	}).Return(created, nil)
+
+	uploaded, err := service.UploadAttachment(context.Background(), &interfaces.UploadAttachmentReq{
+		UserID: "user1", RoomID: "room1", Filename: "notes.txt", Data: []byte("meeting notes"),
+	})
+	assert.NoError(t, err)
+
+	mockRepo.On("GetAttachmentByID", mock.Anything, "7").Return(created, nil)
+	mockRepo.On("GetAttachmentByID", mock.Anything, "8").Return(nil, sql.ErrNoRows)
+
+	res, err := service.DownloadAttachment(context.Background(), "user1", uploaded.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "meeting notes", string(res.Data))
+	assert.Equal(t, "notes.txt", res.Filename)
+
+	// The attachment isn't the uploader's avatar, so only room members can download it
+	mockRepo.On("GetUserByID", mock.Anything, "user1").Return(&models.User{ID: "user1"}, nil)
+	_, err = service.DownloadAttachment(context.Background(), "user2", uploaded.ID)
+	assert.ErrorIs(t, err, interfaces.ErrNotRoomMember)
+
+	_, err = service.DownloadAttachment(context.Background(), "user1", "8")
+	assert.ErrorIs(t, err, interfaces.ErrAttachmentNotFound)
+}
+
+func TestSanitizeFilename(t *testing.T) {
+	assert.Equal(t, "cat.png", sanitizeFilename("../../cat.png"))
+	assert.Equal(t, "evil.txt", sanitizeFilename("C:\\Users\\me\\evil.txt"))
+	assert.Equal(t, "ab.txt", sanitizeFilename("a\"b\n.txt"))
+	assert.Equal(t, "file", sanitizeFilename(""))
+}
@@ -0,0 +1,276 @@
+package services
+
+import (
+	"chatgo/server/internal/interfaces"
+	"chatgo/server/internal/models"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// botTokenPrefix отличает токены ботов от JWT пользователей
+	botTokenPrefix = "cgb_"
+
+	maxBotTokenNameLength = 100
+)
+
+// CreateBot создаёт бота, владельцем которого становится пользователь UserID
+func (s *service) CreateBot(c context.Context, req *interfaces.CreateBotReq) (*interfaces.BotRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	username := strings.TrimSpace(req.Username)
+	if err := s.validateUsername(username); err != nil {
+		return nil, err
+	}
+	if err := s.checkUsernameAvailable(ctx, username); err != nil {
+		return nil, err
+	}
+
+	bot, err := s.Repository.CreateBot(ctx, &models.User{
+		Username: username,
+		Status:   models.UserStatus(models.Offline),
+	}, req.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	return toBotRes(bot), nil
+}
+
+// GetBots возвращает ботов пользователя
+func (s *service) GetBots(c context.Context, userID string) ([]*interfaces.BotRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	bots, err := s.Repository.GetBotsByOwnerID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*interfaces.BotRes, len(bots))
+	for i, bot := range bots {
+		res[i] = toBotRes(bot)
+	}
+	return res, nil
+}
+
+// CreateBotToken выдаёт боту API-токен, который действует только в чатах RoomIDs. Выдать токен
+// может владелец бота, и только в чаты, где он админ. Сам токен возвращается один раз
+func (s *service) CreateBotToken(c context.Context, req *interfaces.CreateBotTokenReq) (*interfaces.BotTokenRes, error) {
+	if len(req.RoomIDs) == 0 {
+		return nil, errors.New("bot token must be granted at least one room")
+	}
+	return s.createBotToken(c, req.UserID, req.BotID, req.Name, models.BotTokenAPI, req.RoomIDs)
+}
+
+// CreateIncomingWebhook создаёт входящий вебхук чата: токен бота, который действует только в этом чате
+// и передаётся в URL вебхука
+func (s *service) CreateIncomingWebhook(c context.Context, req *interfaces.CreateIncomingWebhookReq) (*interfaces.BotTokenRes, error) {
+	return s.createBotToken(c, req.UserID, req.BotID, req.Name, models.BotTokenWebhook, []string{req.RoomID})
+}
+
+func (s *service) createBotToken(c context.Context, userID, botID, name, kind string, roomIDs []string) (*interfaces.BotTokenRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > maxBotTokenNameLength {
+		return nil, fmt.Errorf("token name must be 1 to %d characters", maxBotTokenNameLength)
+	}
+	if _, err := s.getOwnBot(ctx, userID, botID); err != nil {
+		return nil, err
+	}
+
+	granted := make(map[string]bool, len(roomIDs))
+	unique := make([]string, 0, len(roomIDs))
+	for _, roomID := range roomIDs {
+		if granted[roomID] {
+			continue
+		}
+		granted[roomID] = true
+		unique = append(unique, roomID)
+
+		room, err := s.Repository.GetChatRoomByID(ctx, roomID)
+		if err != nil {
+			return nil, err
+		}
+		if room == nil {
+			return nil, interfaces.ErrRoomNotFound
+		}
+		// Боты пишут открытым текстом, а сервер не может шифровать сообщения таких чатов
+		if room.E2E {
+			return nil, interfaces.ErrE2ERoom
+		}
+		if err := s.checkRoomAdmin(ctx, userID, roomID); err != nil {
+			return nil, err
+		}
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	token := botTokenPrefix + hex.EncodeToString(secret)
+
+	created, err := s.Repository.CreateBotToken(ctx, &models.BotToken{
+		BotID:     botID,
+		Name:      name,
+		Kind:      kind,
+		TokenHash: hashBotToken(token),
+		RoomIDs:   unique,
+		CreatedBy: userID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := toBotTokenRes(created)
+	res.Token = token
+	return res, nil
+}
+
+// GetBotTokens возвращает токены и входящие вебхуки бота без самих токенов, включая отозванные
+func (s *service) GetBotTokens(c context.Context, userID, botID string) ([]*interfaces.BotTokenRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	if _, err := s.getOwnBot(ctx, userID, botID); err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.Repository.GetBotTokensByBotID(ctx, botID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*interfaces.BotTokenRes, len(tokens))
+	for i, token := range tokens {
+		res[i] = toBotTokenRes(token)
+	}
+	return res, nil
+}
+
+// RevokeBotToken отзывает токен или входящий вебхук. Отозвать его может владелец бота
+func (s *service) RevokeBotToken(c context.Context, userID, tokenID string) error {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	token, err := s.Repository.GetBotTokenByID(ctx, tokenID)
+	if err != nil {
+		return err
+	}
+	if token == nil {
+		return interfaces.ErrBotTokenNotFound
+	}
+	if _, err := s.getOwnBot(ctx, userID, token.BotID); err != nil {
+		return err
+	}
+
+	_, err = s.Repository.RevokeBotToken(ctx, tokenID)
+	return err
+}
+
+// PostBotMessage отправляет сообщение от имени бота в чат, к которому у токена есть доступ.
+// Если RoomID пуст, а токен выдан на один чат, как у входящих вебхуков, сообщение уходит в него
+func (s *service) PostBotMessage(c context.Context, req *interfaces.BotMessageReq) (*interfaces.CreateMessageRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	if strings.TrimSpace(req.Content) == "" {
+		return nil, errors.New("message content is required")
+	}
+	if !strings.HasPrefix(req.Token, botTokenPrefix) {
+		return nil, interfaces.ErrInvalidBotToken
+	}
+
+	token, err := s.Repository.GetBotTokenByHash(ctx, hashBotToken(req.Token))
+	if err != nil {
+		return nil, err
+	}
+	if token == nil || token.RevokedAt.Valid {
+		return nil, interfaces.ErrInvalidBotToken
+	}
+
+	roomID := req.RoomID
+	if roomID == "" && len(token.RoomIDs) == 1 {
+		roomID = token.RoomIDs[0]
+	}
+	if !slices.Contains(token.RoomIDs, roomID) {
+		return nil, interfaces.ErrRoomNotGranted
+	}
+
+	bot, err := s.Repository.GetUserByID(ctx, token.BotID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.Repository.TouchBotToken(ctx, token.ID); err != nil {
+		log.Printf("Failed to update last use of bot token %s: %v", token.ID, err)
+	}
+
+	return s.CreateMessage(ctx, &interfaces.CreateMessageReq{
+		Content:  req.Content,
+		RoomID:   roomID,
+		Username: bot.Username,
+		ParentID: req.ParentID,
+	})
+}
+
+// getOwnBot возвращает бота, если userID — его владелец
+func (s *service) getOwnBot(ctx context.Context, userID, botID string) (*models.Bot, error) {
+	bot, err := s.Repository.GetBotByUserID(ctx, botID)
+	if err != nil {
+		return nil, err
+	}
+	if bot == nil {
+		return nil, interfaces.ErrBotNotFound
+	}
+	if bot.OwnerID != userID {
+		return nil, interfaces.ErrNotBotOwner
+	}
+	return bot, nil
+}
+
+// hashBotToken возвращает хеш токена, по которому он хранится. Токены случайные и длинные,
+// поэтому соль и медленный хеш не нужны
+func hashBotToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func toBotRes(bot *models.Bot) *interfaces.BotRes {
+	return &interfaces.BotRes{
+		ID:        bot.UserID,
+		Username:  bot.Username,
+		CreatedAt: bot.CreatedAt,
+	}
+}
+
+func toBotTokenRes(token *models.BotToken) *interfaces.BotTokenRes {
+	res := &interfaces.BotTokenRes{
+		ID:        token.ID,
+		BotID:     token.BotID,
+		Name:      token.Name,
+		Kind:      token.Kind,
+		RoomIDs:   token.RoomIDs,
+		CreatedAt: token.CreatedAt,
+	}
+	if token.LastUsedAt.Valid {
+		lastUsedAt := token.LastUsedAt.Time
+		res.LastUsedAt = &lastUsedAt
+	}
+	if token.RevokedAt.Valid {
+		revokedAt := token.RevokedAt.Time
+		res.RevokedAt = &revokedAt
+	}
+	return res
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"chatgo/server/internal/interfaces"
+	"chatgo/server/internal/models"
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestService_CreateBotToken(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewService(mockRepo, config, nil)
+
+	mockRepo.On("GetBotByUserID", mock.Anything, "8").Return(&models.Bot{UserID: "8", Username: "ci-bot", OwnerID: "owner"}, nil)
+	mockRepo.On("GetBotByUserID", mock.Anything, "9").Return(nil, nil)
+	mockRepo.On("GetChatRoomByID", mock.Anything, "1").Return(&models.ChatRoom{ID: "1"}, nil)
+	mockRepo.On("GetChatRoomByID", mock.Anything, "2").Return(&models.ChatRoom{ID: "2", E2E: true}, nil)
+	mockRepo.On("GetChatRoomByID", mock.Anything, "3").Return(&models.ChatRoom{ID: "3"}, nil)
+	mockRepo.On("GetMembersByChatRoomID", mock.Anything, "1").Return([]*models.ChatRoomMember{{UserID: "owner", MemberRole: models.Admin}}, nil)
+	mockRepo.On("GetMembersByChatRoomID", mock.Anything, "3").Return([]*models.ChatRoomMember{{UserID: "owner", MemberRole: models.Member}}, nil)
+	var stored *models.BotToken
+	mockRepo.On("CreateBotToken", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		stored = args.Get(1).(*models.BotToken)
+		stored.ID = "4"
+	}).Return(&models.BotToken{ID: "4", BotID: "8", Name: "deploys", Kind: models.BotTokenAPI, RoomIDs: []string{"1"}}, nil)
+
+	res, err := service.CreateBotToken(context.Background(), &interfaces.CreateBotTokenReq{
+		UserID: "owner", BotID: "8", Name: "deploys", RoomIDs: []string{"1", "1"},
+	})
+
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(res.Token, botTokenPrefix))
+	assert.Equal(t, []string{"1"}, stored.RoomIDs)
+	// Only the hash of the token is stored
+	assert.Equal(t, hashBotToken(res.Token), stored.TokenHash)
+	assert.NotContains(t, stored.TokenHash, res.Token)
+
+	testCases := []struct {
+		name string
+		req  *interfaces.CreateBotTokenReq
+		err  error
+	}{
+		{
+			name: "Not the owner",
+			req:  &interfaces.CreateBotTokenReq{UserID: "other", BotID: "8", Name: "deploys", RoomIDs: []string{"1"}},
+			err:  interfaces.ErrNotBotOwner,
+		},
+		{
+			name: "Not a bot",
+			req:  &interfaces.CreateBotTokenReq{UserID: "owner", BotID: "9", Name: "deploys", RoomIDs: []string{"1"}},
+			err:  interfaces.ErrBotNotFound,
+		},
+		{
+			name: "End-to-end encrypted room",
+			req:  &interfaces.CreateBotTokenReq{UserID: "owner", BotID: "8", Name: "deploys", RoomIDs: []string{"2"}},
+			err:  interfaces.ErrE2ERoom,
+		},
+		{
+			name: "Not an admin of the room",
+			req:  &interfaces.CreateBotTokenReq{UserID: "owner", BotID: "8", Name: "deploys", RoomIDs: []string{"1", "3"}},
+			err:  interfaces.ErrNotRoomAdmin,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := service.CreateBotToken(context.Background(), tc.req)
+			assert.ErrorIs(t, err, tc.err)
+		})
+	}
+	mockRepo.AssertNumberOfCalls(t, "CreateBotToken", 1)
+}
+
+func TestService_PostBotMessage(t *testing.T) {
+	const token = botTokenPrefix + "0123456789abcdef"
+
+	mockRepo := new(MockRepository)
+	mockRoomKeys(mockRepo)
+	service := NewService(mockRepo, config, nil)
+
+	bot := &models.User{ID: "8", Username: "ci-bot", IsBot: true}
+	mockRepo.On("GetBotTokenByHash", mock.Anything, hashBotToken(token)).Return(&models.BotToken{
+		ID: "4", BotID: "8", Kind: models.BotTokenWebhook, RoomIDs: []string{"1"},
+	}, nil)
+	mockRepo.On("GetUserByID", mock.Anything, "8").Return(bot, nil)
+	mockRepo.On("GetUserByUsername", mock.Anything, "ci-bot").Return(bot, nil)
+	mockRepo.On("TouchBotToken", mock.Anything, "4").Return(nil)
+	mockRepo.On("GetChatRoomByID", mock.Anything, "1").Return(&models.ChatRoom{ID: "1"}, nil)
+	mockRepo.On("CreateMessage", mock.Anything, mock.MatchedBy(func(m *models.Message) bool {
+		return m.SenderID == "8" && m.ChatRoomID == "1"
+	})).Return(&models.Message{ID: "20", SenderID: "8", ChatRoomID: "1", CreatedAt: time.Now()}, nil)
+
+	// Incoming webhooks post to the only room of the token
+	res, err := service.PostBotMessage(context.Background(), &interfaces.BotMessageReq{Token: token, Content: "Build #42 passed"})
+	assert.NoError(t, err)
+	assert.Equal(t, "20", res.ID)
+	assert.Equal(t, "ci-bot", res.Username)
+	assert.True(t, res.Bot)
+	mockRepo.AssertCalled(t, "TouchBotToken", mock.Anything, "4")
+
+	_, err = service.PostBotMessage(context.Background(), &interfaces.BotMessageReq{Token: token, RoomID: "2", Content: "hi"})
+	assert.ErrorIs(t, err, interfaces.ErrRoomNotGranted)
+
+	_, err = service.PostBotMessage(context.Background(), &interfaces.BotMessageReq{Token: "eyJhbGciOi", RoomID: "1", Content: "hi"})
+	assert.ErrorIs(t, err, interfaces.ErrInvalidBotToken)
+	mockRepo.AssertNumberOfCalls(t, "CreateMessage", 1)
+}
+
+func TestService_PostBotMessage_Revoked(t *testing.T) {
+	const token = botTokenPrefix + "0123456789abcdef"
+
+	mockRepo := new(MockRepository)
+	service := NewService(mockRepo, config, nil)
+
+	mockRepo.On("GetBotTokenByHash", mock.Anything, hashBotToken(token)).Return(&models.BotToken{
+		ID: "4", BotID: "8", RoomIDs: []string{"1"}, RevokedAt: sql.NullTime{Time: time.Now(), Valid: true},
+	}, nil)
+	mockRepo.On("GetBotTokenByHash", mock.Anything, mock.Anything).Return(nil, nil)
+
+	_, err := service.PostBotMessage(context.Background(), &interfaces.BotMessageReq{Token: token, RoomID: "1", Content: "hi"})
+	assert.ErrorIs(t, err, interfaces.ErrInvalidBotToken)
+
+	_, err = service.PostBotMessage(context.Background(), &interfaces.BotMessageReq{Token: botTokenPrefix + "unknown", RoomID: "1", Content: "hi"})
+	assert.ErrorIs(t, err, interfaces.ErrInvalidBotToken)
+}
+
+func TestService_RevokeBotToken(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewService(mockRepo, config, nil)
+
+	mockRepo.On("GetBotTokenByID", mock.Anything, "4").Return(&models.BotToken{ID: "4", BotID: "8"}, nil)
+	mockRepo.On("GetBotTokenByID", mock.Anything, "5").Return(nil, nil)
+	mockRepo.On("GetBotByUserID", mock.Anything, "8").Return(&models.Bot{UserID: "8", OwnerID: "owner"}, nil)
+	mockRepo.On("RevokeBotToken", mock.Anything, "4").Return(true, nil).Once()
+
+	assert.NoError(t, service.RevokeBotToken(context.Background(), "owner", "4"))
+	assert.ErrorIs(t, service.RevokeBotToken(context.Background(), "other", "4"), interfaces.ErrNotBotOwner)
+	assert.ErrorIs(t, service.RevokeBotToken(context.Background(), "owner", "5"), interfaces.ErrBotTokenNotFound)
+	mockRepo.AssertExpectations(t)
+}
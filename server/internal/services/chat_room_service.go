@@ -4,10 +4,17 @@ import (
 	"chatgo/server/internal/interfaces"
 	"chatgo/server/internal/models"
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
+	"unicode/utf8"
 )
 
+// maxTopicLength ограничивает длину темы чата в символах
+const maxTopicLength = 250
+
 // CreateChatRoom создает новую чат-комнату с указанными параметрами и возвращает информацию о созданной комнате
 func (s *service) CreateChatRoom(c context.Context, req *interfaces.CreateChatRoomReq) (*interfaces.CreateChatRoomRes, error) {
 	ctx, cancel := context.WithTimeout(c, s.timeout)
@@ -19,10 +26,18 @@ func (s *service) CreateChatRoom(c context.Context, req *interfaces.CreateChatRo
 		return nil, fmt.Errorf("user not authenticated")
 	}
 
+	topic := strings.TrimSpace(req.Topic)
+	if utf8.RuneCountInString(topic) > maxTopicLength {
+		return nil, interfaces.ErrTopicTooLong
+	}
+
 	chatRoom, err := s.Repository.CreateChatRoom(ctx, &models.ChatRoom{
-		Name:      req.Name,
-		Type:      models.Group,
-		CreatorID: userID,
+		Name:       req.Name,
+		Type:       models.Group,
+		CreatorID:  userID,
+		E2E:        req.E2E,
+		MessageTTL: req.MessageTTL,
+		Topic:      topic,
 	})
 
 	if err != nil {
@@ -30,8 +45,11 @@ func (s *service) CreateChatRoom(c context.Context, req *interfaces.CreateChatRo
 	}
 
 	return &interfaces.CreateChatRoomRes{
-		ID:   chatRoom.ID,
-		Name: chatRoom.Name,
+		ID:         chatRoom.ID,
+		Name:       chatRoom.Name,
+		E2E:        chatRoom.E2E,
+		MessageTTL: chatRoom.MessageTTL,
+		Topic:      chatRoom.Topic,
 	}, nil
 }
 
@@ -44,10 +62,16 @@ func (s *service) GetChatRoomByID(c context.Context, roomID string) (*interfaces
 	if err != nil {
 		return nil, err
 	}
+	if chatRoom == nil {
+		return nil, interfaces.ErrRoomNotFound
+	}
 
 	return &interfaces.CreateChatRoomRes{
-		ID:   chatRoom.ID,
-		Name: chatRoom.Name,
+		ID:         chatRoom.ID,
+		Name:       chatRoom.Name,
+		E2E:        chatRoom.E2E,
+		MessageTTL: chatRoom.MessageTTL,
+		Topic:      chatRoom.Topic,
 	}, nil
 }
 
@@ -64,8 +88,11 @@ func (s *service) GetAllChatRooms(c context.Context) ([]*interfaces.CreateChatRo
 	result := make([]*interfaces.CreateChatRoomRes, 0, len(chatRooms))
 	for _, chatRoom := range chatRooms {
 		result = append(result, &interfaces.CreateChatRoomRes{
-			ID:   chatRoom.ID,
-			Name: chatRoom.Name,
+			ID:         chatRoom.ID,
+			Name:       chatRoom.Name,
+			E2E:        chatRoom.E2E,
+			MessageTTL: chatRoom.MessageTTL,
+			Topic:      chatRoom.Topic,
 		})
 	}
 
@@ -85,32 +112,59 @@ func (s *service) GetChatRoomsByUserID(c context.Context, userID string) ([]*int
 	result := make([]*interfaces.CreateChatRoomRes, 0, len(chatRooms))
 	for _, chatRoom := range chatRooms {
 		result = append(result, &interfaces.CreateChatRoomRes{
-			ID:   chatRoom.ID,
-			Name: chatRoom.Name,
+			ID:         chatRoom.ID,
+			Name:       chatRoom.Name,
+			E2E:        chatRoom.E2E,
+			MessageTTL: chatRoom.MessageTTL,
+			Topic:      chatRoom.Topic,
 		})
 	}
 
 	return result, nil
 }
 
-// UpdateChatRoom обновляет существующую чат-комнату новыми данными
+// UpdateChatRoom обновляет существующую чат-комнату новыми данными. Пустое имя не меняется,
+// а тему могут менять только админы чата
 func (s *service) UpdateChatRoom(c context.Context, req *interfaces.UpdateChatRoomReq) (*interfaces.CreateChatRoomRes, error) {
 	ctx, cancel := context.WithTimeout(c, s.timeout)
 	defer cancel()
 
-	chatRoom := &models.ChatRoom{
-		ID:   req.ID,
-		Name: req.Name,
+	if req.Topic != nil {
+		topic := strings.TrimSpace(*req.Topic)
+		if utf8.RuneCountInString(topic) > maxTopicLength {
+			return nil, interfaces.ErrTopicTooLong
+		}
+		if err := s.checkRoomAdmin(ctx, req.UserID, req.ID); err != nil {
+			return nil, err
+		}
+		if err := s.Repository.SetTopic(ctx, req.ID, topic); err != nil {
+			return nil, err
+		}
 	}
 
-	updatedRoom, err := s.Repository.UpdateChatRoom(ctx, chatRoom)
+	var updatedRoom *models.ChatRoom
+	var err error
+	if req.Name != "" {
+		updatedRoom, err = s.Repository.UpdateChatRoom(ctx, &models.ChatRoom{
+			ID:   req.ID,
+			Name: req.Name,
+		})
+	} else {
+		updatedRoom, err = s.Repository.GetChatRoomByID(ctx, req.ID)
+		if err == nil && updatedRoom == nil {
+			err = interfaces.ErrRoomNotFound
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	return &interfaces.CreateChatRoomRes{
-		ID:   updatedRoom.ID,
-		Name: updatedRoom.Name,
+		ID:         updatedRoom.ID,
+		Name:       updatedRoom.Name,
+		E2E:        updatedRoom.E2E,
+		MessageTTL: updatedRoom.MessageTTL,
+		Topic:      updatedRoom.Topic,
 	}, nil
 }
 
@@ -162,3 +216,116 @@ func (s *service) GetMembersByChatRoomID(c context.Context, roomID string) ([]*m
 
 	return s.Repository.GetMembersByChatRoomID(ctx, roomID)
 }
+
+// GetMemberRole возвращает роль пользователя в чате или ErrNotRoomMember, если он не состоит в чате
+func (s *service) GetMemberRole(c context.Context, userID, roomID string) (models.MemberRole, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	members, err := s.Repository.GetMembersByChatRoomID(ctx, roomID)
+	if err != nil {
+		return "", err
+	}
+	for _, member := range members {
+		if member.UserID == userID {
+			return member.MemberRole, nil
+		}
+	}
+	return "", interfaces.ErrNotRoomMember
+}
+
+// InviteMember добавляет пользователя с именем req.Username в чат. Приглашать могут только админы чата
+func (s *service) InviteMember(c context.Context, req *interfaces.RoomMemberReq) (*interfaces.RoomMemberRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	if err := s.checkRoomAdmin(ctx, req.UserID, req.RoomID); err != nil {
+		return nil, err
+	}
+	user, err := s.getUserByUsername(ctx, req.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkRoomMember(ctx, user.ID, req.RoomID); err == nil {
+		return nil, interfaces.ErrAlreadyMember
+	} else if !errors.Is(err, interfaces.ErrNotRoomMember) {
+		return nil, err
+	}
+
+	member, err := s.Repository.AddMember(ctx, &models.ChatRoomMember{
+		UserID:     user.ID,
+		ChatRoomID: req.RoomID,
+		MemberRole: models.Member,
+		JoinedAt:   time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &interfaces.RoomMemberRes{
+		UserID:   user.ID,
+		Username: user.Username,
+		Role:     string(member.MemberRole),
+	}, nil
+}
+
+// KickMember удаляет пользователя с именем req.Username из чата. Удалять могут только админы чата
+// и только участников с ролью ниже своей
+func (s *service) KickMember(c context.Context, req *interfaces.RoomMemberReq) (*interfaces.RoomMemberRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	user, err := s.getUserByUsername(ctx, req.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := s.Repository.GetMembersByChatRoomID(ctx, req.RoomID)
+	if err != nil {
+		return nil, err
+	}
+	var actor, target *models.ChatRoomMember
+	for _, member := range members {
+		switch member.UserID {
+		case req.UserID:
+			actor = member
+		case user.ID:
+			target = member
+		}
+	}
+	if actor == nil {
+		return nil, interfaces.ErrNotRoomMember
+	}
+	if !actor.MemberRole.AtLeast(models.Admin) {
+		return nil, interfaces.ErrNotRoomAdmin
+	}
+	if target == nil {
+		return nil, fmt.Errorf("%s: %w", req.Username, interfaces.ErrNotRoomMember)
+	}
+	if target.MemberRole.AtLeast(actor.MemberRole) {
+		return nil, interfaces.ErrCannotKick
+	}
+
+	if err := s.Repository.DeleteMember(ctx, target); err != nil {
+		return nil, err
+	}
+
+	return &interfaces.RoomMemberRes{
+		UserID:   user.ID,
+		Username: user.Username,
+		Role:     string(target.MemberRole),
+	}, nil
+}
+
+// getUserByUsername возвращает ErrUserNotFound вместо sql.ErrNoRows
+func (s *service) getUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	user, err := s.Repository.GetUserByUsername(ctx, username)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && user == nil) {
+		return nil, interfaces.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
@@ -4,7 +4,9 @@ import (
 	"chatgo/server/internal/interfaces"
 	"chatgo/server/internal/models"
 	"context"
+	"database/sql"
 	"errors"
+	"strings"
 	"testing"
 	"time"
 
@@ -84,7 +86,7 @@ func TestService_CreateChatRoom(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			mockRepo := new(MockRepository)
-			service := NewService(mockRepo, config)
+			service := NewService(mockRepo, config, nil)
 
 			tc.mockSetup(mockRepo)
 
@@ -98,7 +100,7 @@ func TestService_CreateChatRoom(t *testing.T) {
 
 func TestService_GetChatRoomByID(t *testing.T) {
 	mockRepo := new(MockRepository)
-	service := NewService(mockRepo, config)
+	service := NewService(mockRepo, config, nil)
 
 	roomID := "room123"
 	expectedChatRoom := &models.ChatRoom{
@@ -122,7 +124,7 @@ func TestService_GetChatRoomByID(t *testing.T) {
 
 func TestService_GetAllChatRooms(t *testing.T) {
 	mockRepo := new(MockRepository)
-	service := NewService(mockRepo, config)
+	service := NewService(mockRepo, config, nil)
 
 	expectedChatRooms := []*models.ChatRoom{
 		{
@@ -155,7 +157,7 @@ func TestService_GetAllChatRooms(t *testing.T) {
 
 func TestService_GetChatRoomsByUserID(t *testing.T) {
 	mockRepo := new(MockRepository)
-	service := NewService(mockRepo, config)
+	service := NewService(mockRepo, config, nil)
 
 	userID := "user123"
 	expectedChatRooms := []*models.ChatRoom{
@@ -189,7 +191,7 @@ func TestService_GetChatRoomsByUserID(t *testing.T) {
 
 func TestService_UpdateChatRoom(t *testing.T) {
 	mockRepo := new(MockRepository)
-	service := NewService(mockRepo, config)
+	service := NewService(mockRepo, config, nil)
 
 	req := &interfaces.UpdateChatRoomReq{
 		ID:   "room123",
@@ -217,9 +219,38 @@ func TestService_UpdateChatRoom(t *testing.T) {
 	mockRepo.AssertExpectations(t)
 }
 
+func TestService_UpdateChatRoom_Topic(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewService(mockRepo, config, nil)
+
+	mockRepo.On("GetMembersByChatRoomID", mock.Anything, "room123").Return([]*models.ChatRoomMember{
+		{UserID: "admin", MemberRole: models.Admin},
+		{UserID: "member", MemberRole: models.Member},
+	}, nil)
+	mockRepo.On("SetTopic", mock.Anything, "room123", "Release planning").Return(nil)
+	mockRepo.On("GetChatRoomByID", mock.Anything, "room123").
+		Return(&models.ChatRoom{ID: "room123", Name: "General", Topic: "Release planning"}, nil)
+
+	// Without a name only the topic changes
+	topic := "  Release planning "
+	result, err := service.UpdateChatRoom(context.Background(), &interfaces.UpdateChatRoomReq{ID: "room123", Topic: &topic, UserID: "admin"})
+	assert.NoError(t, err)
+	assert.Equal(t, &interfaces.CreateChatRoomRes{ID: "room123", Name: "General", Topic: "Release planning"}, result)
+	mockRepo.AssertNotCalled(t, "UpdateChatRoom", mock.Anything, mock.Anything)
+
+	_, err = service.UpdateChatRoom(context.Background(), &interfaces.UpdateChatRoomReq{ID: "room123", Topic: &topic, UserID: "member"})
+	assert.ErrorIs(t, err, interfaces.ErrNotRoomAdmin)
+
+	long := strings.Repeat("x", maxTopicLength+1)
+	_, err = service.UpdateChatRoom(context.Background(), &interfaces.UpdateChatRoomReq{ID: "room123", Topic: &long, UserID: "admin"})
+	assert.ErrorIs(t, err, interfaces.ErrTopicTooLong)
+
+	mockRepo.AssertNumberOfCalls(t, "SetTopic", 1)
+}
+
 func TestService_DeleteChatRoom(t *testing.T) {
 	mockRepo := new(MockRepository)
-	service := NewService(mockRepo, config)
+	service := NewService(mockRepo, config, nil)
 
 	roomID := "room123"
 
@@ -235,7 +266,7 @@ func TestService_DeleteChatRoom(t *testing.T) {
 
 func TestService_AddUserToChatRoom(t *testing.T) {
 	mockRepo := new(MockRepository)
-	service := NewService(mockRepo, config)
+	service := NewService(mockRepo, config, nil)
 
 	req := &interfaces.AddUserToChatRoomReq{
 		UserID:     "user123",
@@ -261,7 +292,7 @@ func TestService_AddUserToChatRoom(t *testing.T) {
 
 func TestService_RemoveUserFromChatRoom(t *testing.T) {
 	mockRepo := new(MockRepository)
-	service := NewService(mockRepo, config)
+	service := NewService(mockRepo, config, nil)
 
 	req := &interfaces.AddUserToChatRoomReq{
 		UserID:     "user123",
@@ -280,7 +311,7 @@ func TestService_RemoveUserFromChatRoom(t *testing.T) {
 
 func TestService_GetMembersByChatRoomID(t *testing.T) {
 	mockRepo := new(MockRepository)
-	service := NewService(mockRepo, config)
+	service := NewService(mockRepo, config, nil)
 
 	roomID := "room123"
 	expectedMembers := []*models.ChatRoomMember{
@@ -309,3 +340,95 @@ func TestService_GetMembersByChatRoomID(t *testing.T) {
 	assert.Equal(t, expectedMembers[1].UserID, result[1].UserID)
 	mockRepo.AssertExpectations(t)
 }
+
+func TestService_GetMemberRole(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewService(mockRepo, config, nil)
+
+	mockRepo.On("GetMembersByChatRoomID", mock.Anything, "room123").Return([]*models.ChatRoomMember{
+		{UserID: "owner", MemberRole: models.Owner},
+		{UserID: "member", MemberRole: models.Member},
+	}, nil)
+
+	role, err := service.GetMemberRole(context.Background(), "owner", "room123")
+	assert.NoError(t, err)
+	assert.Equal(t, models.Owner, role)
+
+	_, err = service.GetMemberRole(context.Background(), "stranger", "room123")
+	assert.ErrorIs(t, err, interfaces.ErrNotRoomMember)
+}
+
+func TestService_InviteMember(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewService(mockRepo, config, nil)
+
+	mockRepo.On("GetMembersByChatRoomID", mock.Anything, "room123").Return([]*models.ChatRoomMember{
+		{UserID: "admin", MemberRole: models.Admin},
+		{UserID: "member", MemberRole: models.Member},
+	}, nil)
+	mockRepo.On("GetUserByUsername", mock.Anything, "bob").Return(&models.User{ID: "bob", Username: "bob"}, nil)
+	mockRepo.On("GetUserByUsername", mock.Anything, "carol").Return(&models.User{ID: "member", Username: "carol"}, nil)
+	mockRepo.On("GetUserByUsername", mock.Anything, "ghost").Return(nil, sql.ErrNoRows)
+	mockRepo.On("AddMember", mock.Anything, mock.MatchedBy(func(member *models.ChatRoomMember) bool {
+		return member.UserID == "bob" && member.ChatRoomID == "room123" && member.MemberRole == models.Member
+	})).Return(&models.ChatRoomMember{UserID: "bob", ChatRoomID: "room123", MemberRole: models.Member}, nil)
+
+	result, err := service.InviteMember(context.Background(), &interfaces.RoomMemberReq{UserID: "admin", RoomID: "room123", Username: "bob"})
+	assert.NoError(t, err)
+	assert.Equal(t, &interfaces.RoomMemberRes{UserID: "bob", Username: "bob", Role: "member"}, result)
+
+	_, err = service.InviteMember(context.Background(), &interfaces.RoomMemberReq{UserID: "member", RoomID: "room123", Username: "bob"})
+	assert.ErrorIs(t, err, interfaces.ErrNotRoomAdmin)
+
+	_, err = service.InviteMember(context.Background(), &interfaces.RoomMemberReq{UserID: "admin", RoomID: "room123", Username: "carol"})
+	assert.ErrorIs(t, err, interfaces.ErrAlreadyMember)
+
+	_, err = service.InviteMember(context.Background(), &interfaces.RoomMemberReq{UserID: "admin", RoomID: "room123", Username: "ghost"})
+	assert.ErrorIs(t, err, interfaces.ErrUserNotFound)
+
+	mockRepo.AssertNumberOfCalls(t, "AddMember", 1)
+}
+
+func TestService_KickMember(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewService(mockRepo, config, nil)
+
+	mockRepo.On("GetMembersByChatRoomID", mock.Anything, "room123").Return([]*models.ChatRoomMember{
+		{UserID: "1", ChatRoomID: "room123", MemberRole: models.Owner},
+		{UserID: "2", ChatRoomID: "room123", MemberRole: models.Admin},
+		{UserID: "3", ChatRoomID: "room123", MemberRole: models.Admin},
+		{UserID: "4", ChatRoomID: "room123", MemberRole: models.Member},
+	}, nil)
+	for id, username := range map[string]string{"1": "olga", "2": "anna", "3": "alex", "4": "max", "5": "bob"} {
+		mockRepo.On("GetUserByUsername", mock.Anything, username).Return(&models.User{ID: id, Username: username}, nil)
+	}
+	mockRepo.On("DeleteMember", mock.Anything, mock.Anything).Return(nil)
+
+	testCases := []struct {
+		name     string
+		actor    string
+		username string
+		err      error
+	}{
+		{name: "Admin removes a member", actor: "2", username: "max"},
+		{name: "Owner removes an admin", actor: "1", username: "alex"},
+		{name: "Admin can't remove another admin", actor: "2", username: "alex", err: interfaces.ErrCannotKick},
+		{name: "Admin can't remove the owner", actor: "2", username: "olga", err: interfaces.ErrCannotKick},
+		{name: "Members can't remove anyone", actor: "4", username: "anna", err: interfaces.ErrNotRoomAdmin},
+		{name: "Target is not a member", actor: "1", username: "bob", err: interfaces.ErrNotRoomMember},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := service.KickMember(context.Background(), &interfaces.RoomMemberReq{UserID: tc.actor, RoomID: "room123", Username: tc.username})
+			if tc.err != nil {
+				assert.ErrorIs(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.username, result.Username)
+		})
+	}
+
+	mockRepo.AssertNumberOfCalls(t, "DeleteMember", 2)
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"chatgo/server/internal/interfaces"
+	"chatgo/server/internal/models"
+	"context"
+	"encoding/base64"
+	"fmt"
+)
+
+// publicKeySize — размер открытого ключа X25519
+const publicKeySize = 32
+
+// PublishPublicKey сохраняет долговременный открытый ключ пользователя. Ключ должен быть
+// открытым ключом X25519 в base64. Сервер не проверяет владение закрытым ключом
+func (s *service) PublishPublicKey(c context.Context, req *interfaces.PublishPublicKeyReq) error {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	key, err := base64.StdEncoding.DecodeString(req.PublicKey)
+	if err != nil || len(key) != publicKeySize {
+		return fmt.Errorf("public key must be %d bytes in base64", publicKeySize)
+	}
+
+	return s.Repository.UpsertUserKey(ctx, &models.UserKey{
+		UserID:    req.UserID,
+		PublicKey: req.PublicKey,
+	})
+}
+
+// GetRoomPublicKeys возвращает открытые ключи участников чата, которым клиент шифрует сообщения.
+// Для обычных чатов список ключей пуст
+func (s *service) GetRoomPublicKeys(c context.Context, userID string, roomID string) (*interfaces.RoomKeysRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	room, err := s.Repository.GetChatRoomByID(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	if room == nil {
+		return nil, fmt.Errorf("room %s not found", roomID)
+	}
+
+	if err := s.checkRoomMember(ctx, userID, roomID); err != nil {
+		return nil, err
+	}
+
+	res := &interfaces.RoomKeysRes{RoomID: room.ID, E2E: room.E2E, Keys: []*interfaces.PublicKeyRes{}}
+	if !room.E2E {
+		return res, nil
+	}
+
+	keys, err := s.Repository.GetUserKeysByChatRoomID(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		res.Keys = append(res.Keys, &interfaces.PublicKeyRes{
+			UserID:    key.UserID,
+			Username:  key.Username,
+			PublicKey: key.PublicKey,
+		})
+	}
+
+	return res, nil
+}
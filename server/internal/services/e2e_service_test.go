@@ -0,0 +1,83 @@
+package services
+
+import (
+	"chatgo/server/internal/interfaces"
+	"chatgo/server/internal/models"
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestService_PublishPublicKey(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewService(mockRepo, config, nil)
+
+	publicKey := base64.StdEncoding.EncodeToString(make([]byte, publicKeySize))
+	mockRepo.On("UpsertUserKey", mock.Anything, &models.UserKey{UserID: "user1", PublicKey: publicKey}).Return(nil)
+
+	err := service.PublishPublicKey(context.Background(), &interfaces.PublishPublicKeyReq{UserID: "user1", PublicKey: publicKey})
+	assert.NoError(t, err)
+
+	err = service.PublishPublicKey(context.Background(), &interfaces.PublishPublicKeyReq{UserID: "user1", PublicKey: "c2hvcnQ="})
+	assert.Error(t, err)
+
+	mockRepo.AssertNumberOfCalls(t, "UpsertUserKey", 1)
+}
+
+func TestService_GetRoomPublicKeys(t *testing.T) {
+	testCases := []struct {
+		name        string
+		room        *models.ChatRoom
+		userID      string
+		expectError error
+		expectedLen int
+	}{
+		{
+			name:        "Keys of end-to-end encrypted room members",
+			room:        &models.ChatRoom{ID: "room1", E2E: true},
+			userID:      "user1",
+			expectedLen: 2,
+		},
+		{
+			name:        "Regular room has no keys",
+			room:        &models.ChatRoom{ID: "room1"},
+			userID:      "user1",
+			expectedLen: 0,
+		},
+		{
+			name:        "Only members can fetch keys",
+			room:        &models.ChatRoom{ID: "room1", E2E: true},
+			userID:      "user3",
+			expectError: interfaces.ErrNotRoomMember,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockRepo := new(MockRepository)
+			service := NewService(mockRepo, config, nil)
+
+			mockRepo.On("GetChatRoomByID", mock.Anything, "room1").Return(tc.room, nil)
+			mockRepo.On("GetMembersByChatRoomID", mock.Anything, "room1").Return([]*models.ChatRoomMember{
+				{UserID: "user1"}, {UserID: "user2"},
+			}, nil)
+			mockRepo.On("GetUserKeysByChatRoomID", mock.Anything, "room1").Return([]*models.UserKey{
+				{UserID: "user1", Username: "alice", PublicKey: "a2V5MQ=="},
+				{UserID: "user2", Username: "bob", PublicKey: "a2V5Mg=="},
+			}, nil).Maybe()
+
+			res, err := service.GetRoomPublicKeys(context.Background(), tc.userID, "room1")
+
+			if tc.expectError != nil {
+				assert.ErrorIs(t, err, tc.expectError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.room.E2E, res.E2E)
+			assert.Len(t, res.Keys, tc.expectedLen)
+		})
+	}
+}
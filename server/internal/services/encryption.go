@@ -0,0 +1,88 @@
+package services
+
+import (
+	"chatgo/server/internal/models"
+	"chatgo/server/internal/util"
+	"context"
+	"fmt"
+	"log"
+)
+
+// Версия ключа 0 означает, что данные были сохранены до введения ключей чатов и хранятся как есть.
+// Содержимое с версией models.E2EKeyVersion зашифровано клиентами и тоже возвращается как есть
+
+// encryptContent шифрует текст сообщения текущим ключом чата и возвращает версию ключа
+func (s *service) encryptContent(ctx context.Context, roomID string, content string) (string, int, error) {
+	version, key, err := s.keys.Current(ctx, roomID)
+	if err != nil {
+		log.Printf("Failed to get key of room %s: %v", roomID, err)
+		return "", 0, fmt.Errorf("Failed to encrypt message: %v", err)
+	}
+
+	encrypted, err := util.EncryptMessage(content, key)
+	if err != nil {
+		log.Printf("Failed to encrypt message: %v", err)
+		return "", 0, fmt.Errorf("Failed to encrypt message: %v", err)
+	}
+
+	return encrypted, version, nil
+}
+
+// decryptContent расшифровывает текст сообщения ключом той версии, которой он был зашифрован
+func (s *service) decryptContent(ctx context.Context, roomID string, version int, content string) (string, error) {
+	if version == 0 || version == models.E2EKeyVersion {
+		return content, nil
+	}
+
+	key, err := s.keys.Key(ctx, roomID, version)
+	if err != nil {
+		log.Printf("Failed to get key of room %s: %v", roomID, err)
+		return "", fmt.Errorf("Failed to decrypt message: %v", err)
+	}
+
+	decrypted, err := util.DecryptMessage(content, key)
+	if err != nil {
+		log.Printf("Failed to decrypt message: %v", err)
+		return "", fmt.Errorf("Failed to decrypt message: %v", err)
+	}
+
+	return decrypted, nil
+}
+
+// encryptBlob шифрует содержимое файла текущим ключом чата и возвращает версию ключа
+func (s *service) encryptBlob(ctx context.Context, roomID string, data []byte) ([]byte, int, error) {
+	version, key, err := s.keys.Current(ctx, roomID)
+	if err != nil {
+		log.Printf("Failed to get key of room %s: %v", roomID, err)
+		return nil, 0, fmt.Errorf("Failed to encrypt attachment: %v", err)
+	}
+
+	encrypted, err := util.EncryptBytes(data, key)
+	if err != nil {
+		log.Printf("Failed to encrypt attachment: %v", err)
+		return nil, 0, fmt.Errorf("Failed to encrypt attachment: %v", err)
+	}
+
+	return encrypted, version, nil
+}
+
+// decryptBlob расшифровывает содержимое файла ключом той версии, которой оно было зашифровано
+func (s *service) decryptBlob(ctx context.Context, roomID string, version int, data []byte) ([]byte, error) {
+	if version == 0 {
+		return data, nil
+	}
+
+	key, err := s.keys.Key(ctx, roomID, version)
+	if err != nil {
+		log.Printf("Failed to get key of room %s: %v", roomID, err)
+		return nil, fmt.Errorf("Failed to decrypt attachment: %v", err)
+	}
+
+	decrypted, err := util.DecryptBytes(data, key)
+	if err != nil {
+		log.Printf("Failed to decrypt attachment: %v", err)
+		return nil, fmt.Errorf("Failed to decrypt attachment: %v", err)
+	}
+
+	return decrypted, nil
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"chatgo/server/internal/interfaces"
+	"chatgo/server/internal/models"
+	"context"
+	"database/sql"
+	"time"
+)
+
+const (
+	// maxMessageTTL ограничивает время жизни исчезающих сообщений одним годом
+	maxMessageTTL = 365 * 24 * 60 * 60
+
+	expiryBatchSize = 500
+)
+
+// SetRoomMessageTTL задаёт время жизни сообщений чата в секундах, 0 отключает исчезающие сообщения.
+// Менять его могут только админы чата, уже отправленные сообщения сохраняют свой срок
+func (s *service) SetRoomMessageTTL(c context.Context, req *interfaces.SetMessageTTLReq) (*interfaces.CreateChatRoomRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	if req.TTL < 0 || req.TTL > maxMessageTTL {
+		return nil, interfaces.ErrInvalidTTL
+	}
+
+	room, err := s.Repository.GetChatRoomByID(ctx, req.RoomID)
+	if err != nil {
+		return nil, err
+	}
+	if room == nil {
+		return nil, interfaces.ErrRoomNotFound
+	}
+	if err := s.checkRoomAdmin(ctx, req.UserID, req.RoomID); err != nil {
+		return nil, err
+	}
+
+	if err := s.Repository.SetMessageTTL(ctx, req.RoomID, req.TTL); err != nil {
+		return nil, err
+	}
+
+	return &interfaces.CreateChatRoomRes{
+		ID:         room.ID,
+		Name:       room.Name,
+		E2E:        room.E2E,
+		MessageTTL: req.TTL,
+	}, nil
+}
+
+// ExpireMessages удаляет исчезающие сообщения, срок которых истёк, вместе с их ветками и файлами.
+// Сообщения чатов на удержании не удаляются. Возвращает удалённые сообщения, чтобы о них можно
+// было сообщить клиентам
+func (s *service) ExpireMessages(c context.Context) ([]*interfaces.ExpiredMessageRes, error) {
+	var result []*interfaces.ExpiredMessageRes
+	for {
+		n, err := s.expireBatch(c, &result)
+		if err != nil || n < expiryBatchSize {
+			return result, err
+		}
+	}
+}
+
+// expireBatch удаляет один пакет истёкших сообщений и возвращает их число
+func (s *service) expireBatch(c context.Context, result *[]*interfaces.ExpiredMessageRes) (int, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	purged, err := s.Repository.DeleteExpiredMessages(ctx, utcNow(), expiryBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	s.forgetMessages(ctx, purged, true)
+	for _, message := range purged.Messages {
+		*result = append(*result, &interfaces.ExpiredMessageRes{ID: message.ID, RoomID: message.ChatRoomID})
+	}
+	return len(purged.Messages), nil
+}
+
+// expiresAt вычисляет, когда удалить новое сообщение. Из времени жизни, заданного отправителем,
+// и времени жизни сообщений чата действует меньшее
+func expiresAt(room *models.ChatRoom, ttl int) sql.NullTime {
+	if room != nil && room.MessageTTL > 0 && (ttl == 0 || room.MessageTTL < ttl) {
+		ttl = room.MessageTTL
+	}
+	if ttl == 0 {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: utcNow().Add(time.Duration(ttl) * time.Second), Valid: true}
+}
+
+func formatExpiresAt(expiresAt sql.NullTime) string {
+	if !expiresAt.Valid {
+		return ""
+	}
+	return expiresAt.Time.Format(time.RFC3339)
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"bytes"
+	"chatgo/server/internal/interfaces"
+	"chatgo/server/internal/models"
+	"chatgo/server/internal/storage"
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestService_CreateMessage_TTL(t *testing.T) {
+	testCases := []struct {
+		name     string
+		roomTTL  int
+		ttl      int
+		expected time.Duration
+	}{
+		{name: "No timers", expected: 0},
+		{name: "Message timer", ttl: 60, expected: time.Minute},
+		{name: "Room timer", roomTTL: 3600, expected: time.Hour},
+		{name: "Shorter timer wins", roomTTL: 60, ttl: 3600, expected: time.Minute},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockRepo := new(MockRepository)
+			mockRoomKeys(mockRepo)
+			service := NewService(mockRepo, config, nil)
+
+			mockRepo.On("GetUserByUsername", mock.Anything, "testuser").Return(&models.User{ID: "user123", Username: "testuser"}, nil)
+			mockRepo.On("GetChatRoomByID", mock.Anything, "room123").Return(&models.ChatRoom{ID: "room123", MessageTTL: tc.roomTTL}, nil)
+			var stored *models.Message
+			created := &models.Message{ID: "msg1", ChatRoomID: "room123", CreatedAt: time.Now()}
+			mockRepo.On("CreateMessage", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+				stored = args.Get(1).(*models.Message)
+				created.ExpiresAt = stored.ExpiresAt
+			}).Return(created, nil)
+
+			result, err := service.CreateMessage(context.Background(), &interfaces.CreateMessageReq{
+				Content:  "Hello",
+				RoomID:   "room123",
+				Username: "testuser",
+				TTL:      tc.ttl,
+			})
+
+			assert.NoError(t, err)
+			if tc.expected == 0 {
+				assert.False(t, stored.ExpiresAt.Valid)
+				assert.Empty(t, result.ExpiresAt)
+				return
+			}
+			assert.True(t, stored.ExpiresAt.Valid)
+			assert.WithinDuration(t, time.Now().Add(tc.expected), stored.ExpiresAt.Time, 5*time.Second)
+			assert.Equal(t, stored.ExpiresAt.Time.Format(time.RFC3339), result.ExpiresAt)
+		})
+	}
+}
+
+func TestService_CreateMessage_InvalidTTL(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewService(mockRepo, config, nil)
+
+	mockRepo.On("GetUserByUsername", mock.Anything, "testuser").Return(&models.User{ID: "user123", Username: "testuser"}, nil)
+
+	_, err := service.CreateMessage(context.Background(), &interfaces.CreateMessageReq{
+		Content: "Hello", RoomID: "room123", Username: "testuser", TTL: -1,
+	})
+	assert.ErrorIs(t, err, interfaces.ErrInvalidTTL)
+	mockRepo.AssertNotCalled(t, "CreateMessage", mock.Anything, mock.Anything)
+}
+
+func TestService_GetMessagesByRoomID_SkipsExpired(t *testing.T) {
+	mockRepo := new(MockRepository)
+	mockRoomKeys(mockRepo)
+	service := NewService(mockRepo, config, nil)
+
+	mockRepo.On("GetMessagesByChatRoomID", mock.Anything, "room123", 10).Return([]*models.Message{
+		{ID: "1", SenderID: "user1", ChatRoomID: "room123", KeyVersion: models.E2EKeyVersion,
+			ExpiresAt: sql.NullTime{Time: time.Now().Add(-time.Second), Valid: true}},
+		{ID: "2", SenderID: "user1", ChatRoomID: "room123", KeyVersion: models.E2EKeyVersion,
+			ExpiresAt: sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true}},
+	}, nil)
+	mockRepo.On("GetReactionCountsByMessageIDs", mock.Anything, mock.Anything).Return([]*models.ReactionCount{}, nil)
+	mockRepo.On("GetAttachmentsByMessageIDs", mock.Anything, mock.Anything).Return([]*models.Attachment{}, nil)
+	mockRepo.On("GetPollsByMessageIDs", mock.Anything, mock.Anything).Return([]*models.Poll{}, nil)
+	mockRepo.On("GetUserByID", mock.Anything, "user1").Return(&models.User{ID: "user1", Username: "alice"}, nil)
+
+	result, err := service.GetMessagesByRoomID(context.Background(), "room123", 10)
+
+	assert.NoError(t, err)
+	assert.Len(t, result, 1)
+	assert.Equal(t, "2", result[0].ID)
+	assert.NotEmpty(t, result[0].ExpiresAt)
+}
+
+func TestService_SetRoomMessageTTL(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewService(mockRepo, config, nil)
+
+	mockRepo.On("GetChatRoomByID", mock.Anything, "1").Return(&models.ChatRoom{ID: "1", Name: "general"}, nil)
+	mockRepo.On("GetMembersByChatRoomID", mock.Anything, "1").Return([]*models.ChatRoomMember{
+		{UserID: "admin", MemberRole: models.Admin},
+		{UserID: "member", MemberRole: models.Member},
+	}, nil)
+	mockRepo.On("SetMessageTTL", mock.Anything, "1", 86400).Return(nil)
+
+	res, err := service.SetRoomMessageTTL(context.Background(), &interfaces.SetMessageTTLReq{UserID: "admin", RoomID: "1", TTL: 86400})
+	assert.NoError(t, err)
+	assert.Equal(t, &interfaces.CreateChatRoomRes{ID: "1", Name: "general", MessageTTL: 86400}, res)
+
+	_, err = service.SetRoomMessageTTL(context.Background(), &interfaces.SetMessageTTLReq{UserID: "member", RoomID: "1", TTL: 60})
+	assert.ErrorIs(t, err, interfaces.ErrNotRoomAdmin)
+
+	_, err = service.SetRoomMessageTTL(context.Background(), &interfaces.SetMessageTTLReq{UserID: "admin", RoomID: "1", TTL: maxMessageTTL + 1})
+	assert.ErrorIs(t, err, interfaces.ErrInvalidTTL)
+
+	mockRepo.AssertNumberOfCalls(t, "SetMessageTTL", 1)
+}
+
+func TestService_ExpireMessages(t *testing.T) {
+	mockRepo := new(MockRepository)
+	blobs, err := storage.NewLocalStore(t.TempDir())
+	assert.NoError(t, err)
+	assert.NoError(t, blobs.Put(context.Background(), "rooms/1/abc", bytes.NewReader([]byte("data")), 4))
+	service := NewService(mockRepo, config, blobs)
+
+	mockRepo.On("DeleteExpiredMessages", mock.Anything, mock.Anything, expiryBatchSize).Return(&models.PurgedMessages{
+		Messages:    []*models.Message{{ID: "4", ChatRoomID: "1"}, {ID: "5", ChatRoomID: "1"}},
+		Attachments: []*models.Attachment{{ID: "1", StorageKey: "rooms/1/abc"}},
+	}, nil)
+
+	res, err := service.ExpireMessages(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, []*interfaces.ExpiredMessageRes{{ID: "4", RoomID: "1"}, {ID: "5", RoomID: "1"}}, res)
+	_, err = blobs.Get(context.Background(), "rooms/1/abc")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	mockRepo.AssertNumberOfCalls(t, "DeleteExpiredMessages", 1)
+}
+
+// TestService_Expiry_UTC checks that expiry times reach the repository in UTC when the server runs in another zone
+func TestService_Expiry_UTC(t *testing.T) {
+	withLocalZone(t)
+	mockRepo := new(MockRepository)
+	service := NewService(mockRepo, config, nil)
+
+	mockRepo.On("DeleteExpiredMessages", mock.Anything, mock.MatchedBy(isUTC), expiryBatchSize).Return(&models.PurgedMessages{}, nil)
+
+	_, err := service.ExpireMessages(context.Background())
+	assert.NoError(t, err)
+
+	expires := expiresAt(&models.ChatRoom{MessageTTL: 60}, 0)
+	assert.True(t, isUTC(expires.Time))
+	assert.WithinDuration(t, time.Now().Add(time.Minute), expires.Time, 5*time.Second)
+	mockRepo.AssertExpectations(t)
+}
+
+// withLocalZone runs the test with a local time zone far from UTC, so times that reach
+// the repository in local time are caught. Tests using it must not run in parallel
+func withLocalZone(t *testing.T) {
+	local := time.Local
+	time.Local = time.FixedZone("UTC+5", 5*60*60)
+	t.Cleanup(func() { time.Local = local })
+}
+
+// isUTC matches a time in UTC, as TIMESTAMP columns store it
+func isUTC(ts time.Time) bool {
+	return ts.Location() == time.UTC
+}
@@ -0,0 +1,172 @@
+package services
+
+import (
+	"chatgo/server/internal/export"
+	"chatgo/server/internal/interfaces"
+	"chatgo/server/internal/models"
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// exportPageSize — число сообщений, которое выгрузка читает из базы за один запрос
+const exportPageSize = 500
+
+// ExportMessages выгружает расшифрованные сообщения чата за период в w в формате req.Format.
+// Сообщения читаются страницами, поэтому выгрузка не держит всю историю в памяти.
+// Выгружать историю могут только админы чата. Ошибки проверок возвращаются до записи в w
+func (s *service) ExportMessages(c context.Context, req *interfaces.ExportMessagesReq, w io.Writer) error {
+	return s.exportMessages(c, req, w, true)
+}
+
+// ExportMessagesAsOperator выгружает историю чата без проверки прав. Предназначен только
+// для утилиты оператора сервера, req.UserID не используется
+func (s *service) ExportMessagesAsOperator(c context.Context, req *interfaces.ExportMessagesReq, w io.Writer) error {
+	return s.exportMessages(c, req, w, false)
+}
+
+func (s *service) exportMessages(c context.Context, req *interfaces.ExportMessagesReq, w io.Writer, checkAdmin bool) error {
+	format, err := export.ParseFormat(req.Format)
+	if err != nil {
+		return err
+	}
+	if !req.To.IsZero() && !req.To.After(req.From) {
+		return fmt.Errorf("export range end must be after its start")
+	}
+
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	room, err := s.Repository.GetChatRoomByID(ctx, req.RoomID)
+	if err == nil && room == nil {
+		err = interfaces.ErrRoomNotFound
+	}
+	if err == nil && checkAdmin {
+		err = s.checkRoomAdmin(ctx, req.UserID, req.RoomID)
+	}
+	cancel()
+	if err != nil {
+		return err
+	}
+
+	writer, err := export.NewWriter(w, format, export.Room{ID: room.ID, Name: room.Name, From: req.From, To: req.To})
+	if err != nil {
+		return err
+	}
+
+	usernames := make(map[string]string)
+	from, afterID := req.From, "0"
+	for {
+		messages, next, err := s.exportPage(c, room.ID, from, afterID, req.To, usernames)
+		if err != nil {
+			return err
+		}
+		for _, msg := range messages {
+			if err := writer.WriteMessage(msg); err != nil {
+				return err
+			}
+		}
+		if next == nil {
+			break
+		}
+		from, afterID = next.CreatedAt, next.ID
+	}
+
+	return writer.Close()
+}
+
+// exportPage читает и расшифровывает одну страницу выгрузки. Имена отправителей
+// кешируются в usernames между страницами. Истёкшие, но ещё не удалённые сообщения
+// пропускаются. Если страница полная, возвращает её последнее сообщение, после
+// которого начинается следующая
+func (s *service) exportPage(c context.Context, roomID string, from time.Time, afterID string, to time.Time, usernames map[string]string) ([]*export.Message, *models.Message, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	page, err := s.Repository.GetMessagesInRange(ctx, roomID, from, afterID, to, exportPageSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	var next *models.Message
+	if len(page) == exportPageSize {
+		next = page[len(page)-1]
+	}
+
+	now := utcNow()
+	messages := make([]*models.Message, 0, len(page))
+	for _, message := range page {
+		if message.ExpiresAt.Valid && !message.ExpiresAt.Time.After(now) {
+			continue
+		}
+		messages = append(messages, message)
+	}
+
+	messageIDs := make([]string, len(messages))
+	for i, message := range messages {
+		messageIDs[i] = message.ID
+	}
+	attachments, err := s.getAttachments(ctx, messageIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result := make([]*export.Message, 0, len(messages))
+	for _, message := range messages {
+		username, ok := usernames[message.SenderID]
+		if !ok {
+			user, err := s.Repository.GetUserByID(ctx, message.SenderID)
+			if err != nil {
+				return nil, nil, err
+			}
+			username = user.Username
+			usernames[message.SenderID] = username
+		}
+
+		content, err := s.decryptContent(ctx, roomID, message.KeyVersion, message.EncryptedContent)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		msg := &export.Message{
+			ID:        message.ID,
+			ParentID:  message.ParentID.String,
+			Username:  username,
+			Content:   content,
+			CreatedAt: message.CreatedAt,
+			Encrypted: message.KeyVersion == models.E2EKeyVersion,
+		}
+		if message.IsEdited {
+			editedAt := message.UpdatedAt
+			msg.EditedAt = &editedAt
+		}
+		for _, attachment := range attachments[message.ID] {
+			msg.Attachments = append(msg.Attachments, export.Attachment{
+				ID:          attachment.ID,
+				Filename:    attachment.Filename,
+				ContentType: attachment.ContentType,
+				Size:        attachment.Size,
+			})
+		}
+		result = append(result, msg)
+	}
+
+	return result, next, nil
+}
+
+// checkRoomAdmin возвращает ErrNotRoomAdmin, если пользователь не админ чата,
+// и ErrNotRoomMember, если он вообще не состоит в чате
+func (s *service) checkRoomAdmin(ctx context.Context, userID, roomID string) error {
+	members, err := s.Repository.GetMembersByChatRoomID(ctx, roomID)
+	if err != nil {
+		return err
+	}
+	for _, member := range members {
+		if member.UserID != userID {
+			continue
+		}
+		if member.MemberRole == models.Admin || member.MemberRole == models.Owner {
+			return nil
+		}
+		return interfaces.ErrNotRoomAdmin
+	}
+	return interfaces.ErrNotRoomMember
+}
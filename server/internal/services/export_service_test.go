@@ -0,0 +1,145 @@
+package services
+
+import (
+	"bytes"
+	"chatgo/server/internal/export"
+	"chatgo/server/internal/interfaces"
+	"chatgo/server/internal/models"
+	"chatgo/server/internal/util"
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestService_ExportMessages(t *testing.T) {
+	mockRepo := new(MockRepository)
+	mockRoomKeys(mockRepo)
+	service := NewService(mockRepo, config, nil)
+
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	first := make([]*models.Message, exportPageSize)
+	for i := range first {
+		encrypted, err := util.EncryptMessage(fmt.Sprintf("message %d", i+1), testDataKey)
+		assert.NoError(t, err)
+		first[i] = &models.Message{
+			ID:               fmt.Sprint(i + 1),
+			SenderID:         "user1",
+			ChatRoomID:       "room1",
+			EncryptedContent: encrypted,
+			CreatedAt:        base.Add(time.Duration(i) * time.Second),
+			KeyVersion:       1,
+		}
+	}
+	last := first[len(first)-1]
+	second := []*models.Message{{
+		ID:               "1000",
+		SenderID:         "user2",
+		ChatRoomID:       "room1",
+		EncryptedContent: "ciphertext",
+		ParentID:         sql.NullString{String: "1", Valid: true},
+		CreatedAt:        last.CreatedAt,
+		KeyVersion:       models.E2EKeyVersion,
+	}}
+
+	mockRepo.On("GetChatRoomByID", mock.Anything, "room1").Return(&models.ChatRoom{ID: "room1", Name: "general"}, nil)
+	mockRepo.On("GetMembersByChatRoomID", mock.Anything, "room1").Return([]*models.ChatRoomMember{
+		{UserID: "user1", MemberRole: models.Admin},
+		{UserID: "user2", MemberRole: models.Member},
+	}, nil)
+	mockRepo.On("GetMessagesInRange", mock.Anything, "room1", time.Time{}, "0", time.Time{}, exportPageSize).Return(first, nil).Once()
+	mockRepo.On("GetMessagesInRange", mock.Anything, "room1", last.CreatedAt, last.ID, time.Time{}, exportPageSize).Return(second, nil).Once()
+	mockRepo.On("GetAttachmentsByMessageIDs", mock.Anything, mock.Anything).Return([]*models.Attachment{
+		{ID: "7", MessageID: sql.NullString{String: "1", Valid: true}, Filename: "notes.txt", ContentType: "text/plain", Size: 5},
+	}, nil)
+	mockRepo.On("GetUserByID", mock.Anything, "user1").Return(&models.User{ID: "user1", Username: "alice"}, nil).Once()
+	mockRepo.On("GetUserByID", mock.Anything, "user2").Return(&models.User{ID: "user2", Username: "bob"}, nil).Once()
+
+	var buf bytes.Buffer
+	err := service.ExportMessages(context.Background(), &interfaces.ExportMessagesReq{
+		UserID: "user1",
+		RoomID: "room1",
+		Format: "jsonl",
+	}, &buf)
+
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, exportPageSize+1)
+	assert.Contains(t, lines[0], `"content":"message 1"`)
+	assert.Contains(t, lines[0], `"filename":"notes.txt"`)
+	assert.Contains(t, lines[exportPageSize], `"username":"bob"`)
+	assert.Contains(t, lines[exportPageSize], `"encrypted":true`)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_ExportMessages_Rejected(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewService(mockRepo, config, nil)
+
+	mockRepo.On("GetChatRoomByID", mock.Anything, "room1").Return(&models.ChatRoom{ID: "room1"}, nil)
+	mockRepo.On("GetChatRoomByID", mock.Anything, "room2").Return(nil, nil)
+	mockRepo.On("GetMembersByChatRoomID", mock.Anything, "room1").Return([]*models.ChatRoomMember{
+		{UserID: "user1", MemberRole: models.Admin},
+		{UserID: "user2", MemberRole: models.Member},
+	}, nil)
+
+	var buf bytes.Buffer
+	err := service.ExportMessages(context.Background(), &interfaces.ExportMessagesReq{UserID: "user2", RoomID: "room1"}, &buf)
+	assert.ErrorIs(t, err, interfaces.ErrNotRoomAdmin)
+
+	err = service.ExportMessages(context.Background(), &interfaces.ExportMessagesReq{UserID: "user3", RoomID: "room1"}, &buf)
+	assert.ErrorIs(t, err, interfaces.ErrNotRoomMember)
+
+	err = service.ExportMessages(context.Background(), &interfaces.ExportMessagesReq{RoomID: "room1"}, &buf)
+	assert.ErrorIs(t, err, interfaces.ErrNotRoomMember)
+
+	err = service.ExportMessages(context.Background(), &interfaces.ExportMessagesReq{UserID: "user1", RoomID: "room2"}, &buf)
+	assert.ErrorIs(t, err, interfaces.ErrRoomNotFound)
+
+	err = service.ExportMessages(context.Background(), &interfaces.ExportMessagesReq{UserID: "user1", RoomID: "room1", Format: "pdf"}, &buf)
+	assert.ErrorIs(t, err, export.ErrUnknownFormat)
+
+	assert.Zero(t, buf.Len())
+}
+
+func TestService_ExportMessagesAsOperator(t *testing.T) {
+	mockRepo := new(MockRepository)
+	mockRoomKeys(mockRepo)
+	service := NewService(mockRepo, config, nil)
+
+	encrypted, err := util.EncryptMessage("still here", testDataKey)
+	assert.NoError(t, err)
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	messages := []*models.Message{
+		{ID: "1", SenderID: "user1", ChatRoomID: "room1", EncryptedContent: encrypted, CreatedAt: base, KeyVersion: 1},
+		{
+			ID:               "2",
+			SenderID:         "user1",
+			ChatRoomID:       "room1",
+			EncryptedContent: "expired",
+			CreatedAt:        base.Add(time.Second),
+			KeyVersion:       1,
+			ExpiresAt:        sql.NullTime{Time: time.Now().Add(-time.Minute), Valid: true},
+		},
+	}
+
+	mockRepo.On("GetChatRoomByID", mock.Anything, "room1").Return(&models.ChatRoom{ID: "room1", Name: "general"}, nil)
+	mockRepo.On("GetMessagesInRange", mock.Anything, "room1", time.Time{}, "0", time.Time{}, exportPageSize).Return(messages, nil).Once()
+	mockRepo.On("GetAttachmentsByMessageIDs", mock.Anything, mock.Anything).Return([]*models.Attachment{}, nil)
+	mockRepo.On("GetUserByID", mock.Anything, "user1").Return(&models.User{ID: "user1", Username: "alice"}, nil).Once()
+
+	var buf bytes.Buffer
+	err = service.ExportMessagesAsOperator(context.Background(), &interfaces.ExportMessagesReq{RoomID: "room1", Format: "jsonl"}, &buf)
+
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 1)
+	assert.Contains(t, lines[0], `"content":"still here"`)
+	mockRepo.AssertNotCalled(t, "GetMembersByChatRoomID", mock.Anything, mock.Anything)
+	mockRepo.AssertExpectations(t)
+}
@@ -0,0 +1,383 @@
+package services
+
+import (
+	"chatgo/server/internal/importer"
+	"chatgo/server/internal/interfaces"
+	"chatgo/server/internal/models"
+	"chatgo/server/internal/search"
+	"chatgo/server/internal/util"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// roomNameColumnLength — ограничение длины столбца chat_rooms.name
+const roomNameColumnLength = 100
+
+// ImportHistory переносит пользователей, чаты, участников и сообщения из экспорта Slack или Mattermost.
+// Сообщения сохраняются с исходным временем и шифруются текущим ключом чата. Всё импортированное
+// запоминается в import_mappings вместе с созданием объекта, поэтому прерванный импорт можно
+// запустить ещё раз: перенесённое раньше будет пропущено. Пользователь из экспорта, чьё имя уже
+// занято или не подходит для регистрации, получает имя с суффиксом источника. Чтобы перенести историю в существующую учётную
+// запись, связь в import_mappings добавляют до импорта. Новые пользователи получают случайный пароль
+func (s *service) ImportHistory(c context.Context, req *interfaces.ImportHistoryReq) (*interfaces.ImportHistoryRes, error) {
+	format := importer.Format(req.Format)
+
+	h := &historyImport{
+		s:         s,
+		ctx:       c,
+		source:    string(format),
+		users:     make(map[string]string),
+		usernames: make(map[string]string),
+		rooms:     make(map[string]*importer.Room),
+		roomIDs:   make(map[string]string),
+		members:   make(map[string]map[string]bool),
+		messages:  make(map[string]string),
+		res:       &interfaces.ImportHistoryRes{},
+	}
+	if err := importer.Read(format, req.Path, h); err != nil {
+		return h.res, err
+	}
+
+	return h.res, nil
+}
+
+// historyImport сохраняет содержимое экспорта, получаемое от importer
+type historyImport struct {
+	s      *service
+	ctx    context.Context
+	source string
+
+	users     map[string]string          // ID пользователя в экспорте -> локальный ID
+	usernames map[string]string          // локальный ID пользователя -> имя
+	rooms     map[string]*importer.Room  // чаты экспорта, которые ещё не созданы
+	roomIDs   map[string]string          // ID чата в экспорте -> локальный ID
+	members   map[string]map[string]bool // локальный ID чата -> локальные ID участников
+	messages  map[string]string          // ID корневого сообщения в экспорте -> локальный ID
+
+	res *interfaces.ImportHistoryRes
+}
+
+func (h *historyImport) User(u *importer.User) error {
+	ctx, cancel := context.WithTimeout(h.ctx, h.s.timeout)
+	defer cancel()
+
+	localID, err := h.s.Repository.GetImportMapping(ctx, h.source, models.ImportKindUser, u.ID)
+	if err != nil {
+		return err
+	}
+
+	var user *models.User
+	if localID == "" {
+		user, err = h.createUser(ctx, u)
+	} else {
+		user, err = h.s.Repository.GetUserByID(ctx, localID)
+	}
+	if err != nil {
+		return err
+	}
+
+	h.users[u.ID] = user.ID
+	h.usernames[user.ID] = user.Username
+	return nil
+}
+
+// createUser создаёт пользователя экспорта со случайным паролем, который никому не известен
+func (h *historyImport) createUser(ctx context.Context, u *importer.User) (*models.User, error) {
+	username, err := h.freeUsername(ctx, u.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	password := make([]byte, 24)
+	if _, err := rand.Read(password); err != nil {
+		return nil, err
+	}
+	hashedPassword, err := util.HashPassword(hex.EncodeToString(password), h.s.Password.Cost)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &models.User{
+		Username:          username,
+		EncryptedPassword: hashedPassword,
+		Status:            models.UserStatus(models.Offline),
+	}
+	mapping := &models.ImportMapping{Source: h.source, Kind: models.ImportKindUser, ExternalID: u.ID}
+	imported, err := h.s.Repository.ImportUser(ctx, user, mapping)
+	if err != nil {
+		return nil, err
+	}
+	if !imported {
+		log.Printf("User %s is being imported by another run, using its account", u.ID)
+		localID, err := h.s.Repository.GetImportMapping(ctx, h.source, models.ImportKindUser, u.ID)
+		if err != nil {
+			return nil, err
+		}
+		return h.s.Repository.GetUserByID(ctx, localID)
+	}
+
+	h.res.Users++
+	if username != u.Username {
+		log.Printf("Username %s is taken or invalid, imported user %s as %s", u.Username, u.ID, username)
+		h.res.Renamed++
+	}
+	return user, nil
+}
+
+// freeUsername возвращает username, если имя свободно и проходит те же проверки, что и при
+// регистрации, а иначе имя с суффиксом источника вида alice.slack, alice.slack2 и так далее.
+// Недопустимые символы заменяются на '_', а слишком длинное имя обрезается
+func (h *historyImport) freeUsername(ctx context.Context, username string) (string, error) {
+	username = sanitizeUsername(username)
+	candidate := username
+	for i := 1; ; i++ {
+		if h.s.validateUsername(candidate) == nil {
+			err := h.s.checkUsernameAvailable(ctx, candidate)
+			if !errors.Is(err, interfaces.ErrUsernameTaken) {
+				return candidate, err
+			}
+		}
+
+		suffix := "." + h.source
+		if i > 1 {
+			suffix += strconv.Itoa(i)
+		}
+		candidate = limitLength(username, maxUsernameLength-len(suffix)) + suffix
+	}
+}
+
+// sanitizeUsername заменяет символы, которых не может быть в имени пользователя, на '_' и убирает
+// '_', '.' и '-' с краёв. Если ничего не осталось, возвращает "user"
+func sanitizeUsername(username string) string {
+	var b strings.Builder
+	for _, r := range username {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '.', r == '-':
+			b.WriteRune(r)
+		case !strings.HasSuffix(b.String(), "_"):
+			b.WriteByte('_')
+		}
+	}
+	if sanitized := strings.Trim(limitLength(b.String(), maxUsernameLength), "_.-"); sanitized != "" {
+		return sanitized
+	}
+	return "user"
+}
+
+// Room запоминает чат. Сам чат создаётся при первом участнике или сообщении,
+// так как у чата должен быть создатель
+func (h *historyImport) Room(room *importer.Room) error {
+	ctx, cancel := context.WithTimeout(h.ctx, h.s.timeout)
+	defer cancel()
+
+	localID, err := h.s.Repository.GetImportMapping(ctx, h.source, models.ImportKindRoom, room.ID)
+	if err != nil {
+		return err
+	}
+	if localID != "" {
+		h.roomIDs[room.ID] = localID
+		return nil
+	}
+
+	h.rooms[room.ID] = room
+	return nil
+}
+
+// ensureRoom возвращает локальный ID чата, создавая его при необходимости. Создателем становится
+// создатель чата в экспорте, а если он неизвестен, то userID
+func (h *historyImport) ensureRoom(ctx context.Context, roomID, userID string) (string, error) {
+	if localID, ok := h.roomIDs[roomID]; ok {
+		return localID, nil
+	}
+	room, ok := h.rooms[roomID]
+	if !ok {
+		return "", errors.New("room " + roomID + " is not in the export")
+	}
+
+	creatorID, ok := h.users[room.CreatorID]
+	if !ok {
+		creatorID = userID
+	}
+	roomType := models.Group
+	if room.Direct {
+		roomType = models.Direct
+	}
+
+	created := &models.ChatRoom{
+		Name:      limitLength(room.Name, roomNameColumnLength),
+		Type:      roomType,
+		CreatorID: creatorID,
+	}
+	mapping := &models.ImportMapping{Source: h.source, Kind: models.ImportKindRoom, ExternalID: roomID}
+	imported, err := h.s.Repository.ImportChatRoom(ctx, created, mapping)
+	if err != nil {
+		return "", err
+	}
+	delete(h.rooms, roomID)
+
+	if !imported {
+		log.Printf("Room %s is being imported by another run, using its room", roomID)
+		localID, err := h.s.Repository.GetImportMapping(ctx, h.source, models.ImportKindRoom, roomID)
+		if err != nil {
+			return "", err
+		}
+		h.roomIDs[roomID] = localID
+		return localID, nil
+	}
+
+	h.res.Rooms++
+	h.roomIDs[roomID] = created.ID
+	h.members[created.ID] = map[string]bool{creatorID: true}
+	return created.ID, nil
+}
+
+func (h *historyImport) Member(roomID, userID string) error {
+	ctx, cancel := context.WithTimeout(h.ctx, h.s.timeout)
+	defer cancel()
+
+	localUserID, ok := h.users[userID]
+	if !ok {
+		h.res.Skipped++
+		return nil
+	}
+	localRoomID, err := h.ensureRoom(ctx, roomID, localUserID)
+	if err != nil {
+		return err
+	}
+
+	members, ok := h.members[localRoomID]
+	if !ok {
+		list, err := h.s.Repository.GetMembersByChatRoomID(ctx, localRoomID)
+		if err != nil {
+			return err
+		}
+		members = make(map[string]bool, len(list))
+		for _, member := range list {
+			members[member.UserID] = true
+		}
+		h.members[localRoomID] = members
+	}
+	if members[localUserID] {
+		return nil
+	}
+
+	_, err = h.s.Repository.AddMember(ctx, &models.ChatRoomMember{
+		UserID:     localUserID,
+		ChatRoomID: localRoomID,
+		JoinedAt:   time.Now(),
+		MemberRole: models.Member,
+	})
+	if err != nil {
+		return err
+	}
+	members[localUserID] = true
+	h.res.Members++
+	return nil
+}
+
+func (h *historyImport) Message(msg *importer.Message) error {
+	ctx, cancel := context.WithTimeout(h.ctx, h.s.timeout)
+	defer cancel()
+
+	localUserID, ok := h.users[msg.UserID]
+	if !ok {
+		h.res.Skipped++
+		return nil
+	}
+
+	localID, err := h.s.Repository.GetImportMapping(ctx, h.source, models.ImportKindMessage, msg.ID)
+	if err != nil {
+		return err
+	}
+	if localID != "" {
+		h.rememberMessage(msg, localID)
+		return nil
+	}
+
+	localRoomID, err := h.ensureRoom(ctx, msg.RoomID, localUserID)
+	if err != nil {
+		return err
+	}
+
+	// Ответ, корень которого не попал в экспорт, становится обычным сообщением
+	var parentID sql.NullString
+	if msg.ParentID != "" {
+		parent, err := h.messageID(ctx, msg.ParentID)
+		if err != nil {
+			return err
+		}
+		parentID = sql.NullString{String: parent, Valid: parent != ""}
+	}
+
+	encryptedMessage, keyVersion, err := h.s.encryptContent(ctx, localRoomID, msg.Text)
+	if err != nil {
+		return err
+	}
+
+	message := &models.Message{
+		SenderID:         localUserID,
+		ChatRoomID:       localRoomID,
+		EncryptedContent: encryptedMessage,
+		ParentID:         parentID,
+		CreatedAt:        msg.CreatedAt,
+		UpdatedAt:        msg.CreatedAt,
+		KeyVersion:       keyVersion,
+	}
+	if !msg.EditedAt.IsZero() {
+		message.UpdatedAt = msg.EditedAt
+		message.IsEdited = true
+	}
+
+	mapping := &models.ImportMapping{Source: h.source, Kind: models.ImportKindMessage, ExternalID: msg.ID}
+	imported, err := h.s.Repository.ImportMessage(ctx, message, mapping)
+	if err != nil {
+		return err
+	}
+	if !imported {
+		log.Printf("Message %s is being imported by another run, skipping", msg.ID)
+		return nil
+	}
+	h.rememberMessage(msg, message.ID)
+	h.res.Messages++
+
+	h.s.index.Add(search.Document{
+		ID:        message.ID,
+		RoomID:    localRoomID,
+		Username:  h.usernames[localUserID],
+		Content:   msg.Text,
+		CreatedAt: message.CreatedAt,
+	})
+	return nil
+}
+
+// rememberMessage запоминает локальный ID корневого сообщения для его ответов.
+// Ответы не запоминаются, так как ветки одноуровневые
+func (h *historyImport) rememberMessage(msg *importer.Message, localID string) {
+	if msg.ParentID == "" {
+		h.messages[msg.ID] = localID
+	}
+}
+
+// messageID возвращает локальный ID импортированного сообщения или пустую строку
+func (h *historyImport) messageID(ctx context.Context, externalID string) (string, error) {
+	if localID, ok := h.messages[externalID]; ok {
+		return localID, nil
+	}
+	return h.s.Repository.GetImportMapping(ctx, h.source, models.ImportKindMessage, externalID)
+}
+
+// limitLength обрезает значение до maxLength символов, чтобы оно поместилось в столбец
+func limitLength(value string, maxLength int) string {
+	runes := []rune(value)
+	if len(runes) <= maxLength {
+		return value
+	}
+	return string(runes[:maxLength])
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"chatgo/server/internal/interfaces"
+	"chatgo/server/internal/models"
+	"chatgo/server/internal/util"
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+const testMattermostExport = `{"type": "channel", "channel": {"team": "acme", "name": "dev", "display_name": "Dev", "type": "O"}}
+{"type": "user", "user": {"username": "alice", "teams": [{"name": "acme", "channels": [{"name": "dev"}]}]}}
+{"type": "user", "user": {"username": "bob", "teams": [{"name": "acme", "channels": [{"name": "dev"}]}]}}
+{"type": "post", "post": {"team": "acme", "channel": "dev", "user": "alice", "message": "ship it", "create_at": 1704067200000, "replies": [{"user": "bob", "message": "shipped", "create_at": 1704067260000, "edit_at": 1704067270000}]}}
+`
+
+// TestService_ImportHistory_Resume imports an export after a run that stopped right after
+// importing alice, the room and the root post
+func TestService_ImportHistory_Resume(t *testing.T) {
+	mockRepo := new(MockRepository)
+	mockRoomKeys(mockRepo)
+	service := NewService(mockRepo, config, nil)
+
+	path := filepath.Join(t.TempDir(), "export.jsonl")
+	assert.NoError(t, os.WriteFile(path, []byte(testMattermostExport), 0o600))
+
+	mockRepo.On("GetImportMapping", mock.Anything, "mattermost", models.ImportKindRoom, "acme/dev").Return("3", nil)
+	mockRepo.On("GetImportMapping", mock.Anything, "mattermost", models.ImportKindUser, "alice").Return("1", nil)
+	mockRepo.On("GetImportMapping", mock.Anything, "mattermost", models.ImportKindUser, "bob").Return("", nil)
+	mockRepo.On("GetImportMapping", mock.Anything, "mattermost", models.ImportKindMessage, "acme/dev/alice/1704067200000").Return("10", nil)
+	mockRepo.On("GetImportMapping", mock.Anything, "mattermost", models.ImportKindMessage, "acme/dev/bob/1704067260000").Return("", nil)
+
+	mockRepo.On("GetUserByID", mock.Anything, "1").Return(&models.User{ID: "1", Username: "alice"}, nil)
+	mockRepo.On("GetUserByUsername", mock.Anything, "bob").Return(nil, sql.ErrNoRows)
+	mockRepo.On("ImportUser", mock.Anything, mock.MatchedBy(func(u *models.User) bool {
+		return u.Username == "bob" && u.EncryptedPassword != ""
+	}), &models.ImportMapping{Source: "mattermost", Kind: models.ImportKindUser, ExternalID: "bob"}).
+		Run(func(args mock.Arguments) { args.Get(1).(*models.User).ID = "2" }).
+		Return(true, nil)
+
+	mockRepo.On("GetMembersByChatRoomID", mock.Anything, "3").Return([]*models.ChatRoomMember{{UserID: "1", MemberRole: models.Admin}}, nil)
+	mockRepo.On("AddMember", mock.Anything, mock.MatchedBy(func(m *models.ChatRoomMember) bool {
+		return m.UserID == "2" && m.ChatRoomID == "3" && m.MemberRole == models.Member
+	})).Return(&models.ChatRoomMember{}, nil)
+
+	var imported *models.Message
+	mockRepo.On("ImportMessage", mock.Anything, mock.Anything, &models.ImportMapping{
+		Source: "mattermost", Kind: models.ImportKindMessage, ExternalID: "acme/dev/bob/1704067260000",
+	}).Run(func(args mock.Arguments) {
+		imported = args.Get(1).(*models.Message)
+		imported.ID = "11"
+	}).Return(true, nil)
+
+	res, err := service.ImportHistory(context.Background(), &interfaces.ImportHistoryReq{Format: "mattermost", Path: path})
+
+	assert.NoError(t, err)
+	assert.Equal(t, &interfaces.ImportHistoryRes{Users: 1, Members: 1, Messages: 1}, res)
+	mockRepo.AssertNotCalled(t, "ImportChatRoom", mock.Anything, mock.Anything, mock.Anything)
+
+	// The reply keeps its original time, thread and edit, and is encrypted with the room key
+	assert.Equal(t, "2", imported.SenderID)
+	assert.Equal(t, "3", imported.ChatRoomID)
+	assert.Equal(t, sql.NullString{String: "10", Valid: true}, imported.ParentID)
+	assert.Equal(t, time.UnixMilli(1704067260000).UTC(), imported.CreatedAt)
+	assert.True(t, imported.IsEdited)
+	assert.Equal(t, 1, imported.KeyVersion)
+	content, err := util.DecryptMessage(imported.EncryptedContent, testDataKey)
+	assert.NoError(t, err)
+	assert.Equal(t, "shipped", content)
+
+	assert.Equal(t, 1, indexLen(service))
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_ImportHistory_CreatesRoom(t *testing.T) {
+	mockRepo := new(MockRepository)
+	mockRoomKeys(mockRepo)
+	service := NewService(mockRepo, config, nil)
+
+	path := filepath.Join(t.TempDir(), "export.jsonl")
+	assert.NoError(t, os.WriteFile(path, []byte(`{"type": "channel", "channel": {"team": "acme", "name": "dev", "display_name": "Dev", "type": "O"}}
+{"type": "user", "user": {"username": "alice", "teams": [{"name": "acme", "channels": [{"name": "dev"}]}]}}
+`), 0o600))
+
+	mockRepo.On("GetImportMapping", mock.Anything, "mattermost", mock.Anything, mock.Anything).Return("", nil)
+	mockRepo.On("GetUserByUsername", mock.Anything, "alice").Return(&models.User{ID: "1", Username: "alice"}, nil)
+	mockRepo.On("GetUserByUsername", mock.Anything, "alice.mattermost").Return(&models.User{ID: "2", Username: "alice.mattermost"}, nil)
+	mockRepo.On("GetUserByUsername", mock.Anything, "alice.mattermost2").Return(nil, sql.ErrNoRows)
+	mockRepo.On("ImportUser", mock.Anything, mock.MatchedBy(func(u *models.User) bool {
+		return u.Username == "alice.mattermost2"
+	}), mock.Anything).Run(func(args mock.Arguments) { args.Get(1).(*models.User).ID = "4" }).Return(true, nil)
+	mockRepo.On("ImportChatRoom", mock.Anything, &models.ChatRoom{Name: "Dev", Type: models.Group, CreatorID: "4"},
+		&models.ImportMapping{Source: "mattermost", Kind: models.ImportKindRoom, ExternalID: "acme/dev"}).
+		Run(func(args mock.Arguments) { args.Get(1).(*models.ChatRoom).ID = "3" }).
+		Return(true, nil)
+
+	res, err := service.ImportHistory(context.Background(), &interfaces.ImportHistoryReq{Format: "mattermost", Path: path})
+
+	assert.NoError(t, err)
+	// The local alice is not merged with the imported one, who gets a free name and becomes the room's admin
+	assert.Equal(t, &interfaces.ImportHistoryRes{Users: 1, Renamed: 1, Rooms: 1}, res)
+	mockRepo.AssertNotCalled(t, "AddMember", mock.Anything, mock.Anything)
+	mockRepo.AssertExpectations(t)
+}
+
+// TestService_ImportHistory_RoomImportedConcurrently uses the room of a parallel run instead of creating another one
+func TestService_ImportHistory_RoomImportedConcurrently(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewService(mockRepo, config, nil)
+
+	path := filepath.Join(t.TempDir(), "export.jsonl")
+	assert.NoError(t, os.WriteFile(path, []byte(`{"type": "channel", "channel": {"team": "acme", "name": "dev", "display_name": "Dev", "type": "O"}}
+{"type": "user", "user": {"username": "alice", "teams": [{"name": "acme", "channels": [{"name": "dev"}]}]}}
+`), 0o600))
+
+	mockRepo.On("GetImportMapping", mock.Anything, "mattermost", models.ImportKindUser, "alice").Return("1", nil)
+	mockRepo.On("GetImportMapping", mock.Anything, "mattermost", models.ImportKindRoom, "acme/dev").Return("", nil).Once()
+	mockRepo.On("GetImportMapping", mock.Anything, "mattermost", models.ImportKindRoom, "acme/dev").Return("3", nil).Once()
+	mockRepo.On("GetUserByID", mock.Anything, "1").Return(&models.User{ID: "1", Username: "alice"}, nil)
+	mockRepo.On("ImportChatRoom", mock.Anything, mock.Anything, mock.Anything).Return(false, nil)
+	mockRepo.On("GetMembersByChatRoomID", mock.Anything, "3").Return([]*models.ChatRoomMember{{UserID: "1", MemberRole: models.Admin}}, nil)
+
+	res, err := service.ImportHistory(context.Background(), &interfaces.ImportHistoryReq{Format: "mattermost", Path: path})
+
+	assert.NoError(t, err)
+	assert.Equal(t, &interfaces.ImportHistoryRes{}, res)
+	mockRepo.AssertNotCalled(t, "AddMember", mock.Anything, mock.Anything)
+	mockRepo.AssertExpectations(t)
+}
+
+// indexLen returns the number of messages in the search index of the service
+func indexLen(s interfaces.Service) int {
+	return s.(*service).index.Len()
+}
+
+// TestHistoryImport_freeUsername checks that imported users get names that pass the same checks as
+// registration, falling back to the source suffix when the name can't be used as is
+func TestHistoryImport_freeUsername(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewService(mockRepo, config, nil).(*service)
+	h := &historyImport{s: service, ctx: context.Background(), source: "slack"}
+
+	mockRepo.On("GetUserByUsername", mock.Anything, mock.Anything).Return(nil, sql.ErrNoRows)
+
+	testCases := []struct {
+		name     string
+		username string
+		want     string
+	}{
+		{name: "Valid", username: "alice", want: "alice"},
+		{name: "Reserved", username: "admin", want: "admin.slack"},
+		{name: "Too short", username: "al", want: "al.slack"},
+		{name: "Invalid characters", username: "José García", want: "Jos_Garc_a"},
+		{name: "Only invalid characters", username: "日本", want: "user"},
+		{name: "Too long", username: "a-very-long-display-name-from-slack-export", want: "a-very-long-display-name-from-sl"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			username, err := h.freeUsername(context.Background(), tc.username)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, username)
+			assert.NoError(t, service.validateUsername(username))
+		})
+	}
+}
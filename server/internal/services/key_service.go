@@ -0,0 +1,207 @@
+package services
+
+import (
+	"bytes"
+	"chatgo/server/internal/interfaces"
+	"chatgo/server/internal/keyring"
+	"chatgo/server/internal/models"
+	"chatgo/server/internal/util"
+	"context"
+	"io"
+	"log"
+	"time"
+)
+
+const reencryptBatchSize = 100
+
+// rewrapTimeoutPerRow — сколько времени добавляется к таймауту смены мастер-ключа на каждую строку
+const rewrapTimeoutPerRow = 10 * time.Millisecond
+
+// RotateRoomKey создаёт новую версию ключа чата. Новые сообщения и файлы шифруются ей,
+// старые версии сохраняются, пока история не будет перешифрована
+func (s *service) RotateRoomKey(c context.Context, roomID string) (int, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	return s.keys.Rotate(ctx, roomID)
+}
+
+// ReencryptRoom перешифровывает сообщения и файлы чата текущей версией ключа. Обработка идёт
+// пакетами, поэтому её можно выполнять параллельно с работой сервера и безопасно повторять.
+// Данные, которые не удалось расшифровать, пропускаются и учитываются в Failed
+func (s *service) ReencryptRoom(c context.Context, roomID string) (*interfaces.ReencryptRoomRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	version, key, err := s.keys.Current(ctx, roomID)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+
+	res := &interfaces.ReencryptRoomRes{RoomID: roomID, KeyVersion: version}
+	if err := s.reencryptMessages(c, res, key); err != nil {
+		return res, err
+	}
+	if err := s.reencryptAttachments(c, res, key); err != nil {
+		return res, err
+	}
+
+	return res, nil
+}
+
+func (s *service) reencryptMessages(c context.Context, res *interfaces.ReencryptRoomRes, key []byte) error {
+	afterID := "0"
+	for {
+		ctx, cancel := context.WithTimeout(c, s.timeout)
+		messages, err := s.Repository.GetMessagesForReencryption(ctx, res.RoomID, res.KeyVersion, afterID, reencryptBatchSize)
+		if err != nil {
+			cancel()
+			return err
+		}
+
+		for _, message := range messages {
+			content, err := s.decryptContent(ctx, message.ChatRoomID, message.KeyVersion, message.EncryptedContent)
+			if err != nil {
+				log.Printf("Skipping message %s: %v", message.ID, err)
+				res.Failed++
+				continue
+			}
+
+			encrypted, err := util.EncryptMessage(content, key)
+			if err != nil {
+				cancel()
+				return err
+			}
+
+			oldVersion := message.KeyVersion
+			message.EncryptedContent = encrypted
+			message.KeyVersion = res.KeyVersion
+			updated, err := s.Repository.UpdateMessageEncryption(ctx, message, oldVersion)
+			if err != nil {
+				cancel()
+				return err
+			}
+			if updated {
+				res.Messages++
+			}
+		}
+		cancel()
+
+		if len(messages) < reencryptBatchSize {
+			return nil
+		}
+		afterID = messages[len(messages)-1].ID
+	}
+}
+
+func (s *service) reencryptAttachments(c context.Context, res *interfaces.ReencryptRoomRes, key []byte) error {
+	afterID := "0"
+	for {
+		ctx, cancel := context.WithTimeout(c, s.timeout)
+		attachments, err := s.Repository.GetAttachmentsForReencryption(ctx, res.RoomID, res.KeyVersion, afterID, reencryptBatchSize)
+		cancel()
+		if err != nil {
+			return err
+		}
+
+		for _, attachment := range attachments {
+			updated, err := s.reencryptAttachment(c, attachment, res.KeyVersion, key)
+			if err != nil {
+				log.Printf("Skipping attachment %s: %v", attachment.ID, err)
+				res.Failed++
+				continue
+			}
+			if updated {
+				res.Attachments++
+			}
+		}
+
+		if len(attachments) < reencryptBatchSize {
+			return nil
+		}
+		afterID = attachments[len(attachments)-1].ID
+	}
+}
+
+// reencryptAttachment сохраняет перешифрованный файл под новым ключом хранилища и удаляет старый
+func (s *service) reencryptAttachment(c context.Context, attachment *models.Attachment, version int, key []byte) (bool, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	r, err := s.blobs.Get(ctx, attachment.StorageKey)
+	if err != nil {
+		return false, err
+	}
+	encrypted, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		return false, err
+	}
+
+	data, err := s.decryptBlob(ctx, attachment.ChatRoomID, attachment.KeyVersion, encrypted)
+	if err != nil {
+		return false, err
+	}
+	if encrypted, err = util.EncryptBytes(data, key); err != nil {
+		return false, err
+	}
+
+	newKey, err := newStorageKey(attachment.ChatRoomID)
+	if err != nil {
+		return false, err
+	}
+	if err := s.blobs.Put(ctx, newKey, bytes.NewReader(encrypted), int64(len(encrypted))); err != nil {
+		return false, err
+	}
+
+	oldKey := attachment.StorageKey
+	attachment.StorageKey = newKey
+	attachment.KeyVersion = version
+	updated, err := s.Repository.UpdateAttachmentEncryption(ctx, attachment, oldKey)
+	if err != nil || !updated {
+		if err := s.blobs.Delete(ctx, newKey); err != nil {
+			log.Printf("Failed to delete orphaned blob %s: %v", newKey, err)
+		}
+		return false, err
+	}
+
+	if err := s.blobs.Delete(ctx, oldKey); err != nil {
+		log.Printf("Failed to delete old blob %s: %v", oldKey, err)
+	}
+	return true, nil
+}
+
+// RewrapKeys зашифровывает все ключи чатов и TOTP-секреты новым мастер-ключом и сохраняет их
+// одной транзакцией, так что прерванная смена ключа ничего не меняет. Время на транзакцию
+// растёт с числом строк. История не перешифровывается. Возвращает число ключей чатов
+func (s *service) RewrapKeys(c context.Context, masterKey string) (int, error) {
+	newMaster, err := keyring.ParseMasterKey(masterKey)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	keys, err := s.keys.Rewrap(ctx, newMaster)
+	if err != nil {
+		cancel()
+		return 0, err
+	}
+	totps, err := s.rewrapTOTPSecrets(ctx, newMaster)
+	cancel()
+	if err != nil {
+		return 0, err
+	}
+
+	rows := len(keys) + len(totps)
+	ctx, cancel = context.WithTimeout(c, s.timeout+time.Duration(rows)*rewrapTimeoutPerRow)
+	defer cancel()
+
+	if err := s.Repository.UpdateWrappedKeys(ctx, keys, totps); err != nil {
+		return 0, err
+	}
+	s.keys.SetMaster(newMaster)
+
+	if len(totps) > 0 {
+		log.Printf("Rewrapped %d TOTP secrets", len(totps))
+	}
+	return len(keys), nil
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"bytes"
+	"chatgo/server/internal/keyring"
+	"chatgo/server/internal/models"
+	"chatgo/server/internal/storage"
+	"chatgo/server/internal/util"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestService_RotateRoomKey(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewService(mockRepo, config, nil)
+
+	wrapped1, err := keyring.Wrap(testDataKey, testMasterKey)
+	assert.NoError(t, err)
+	rotated := &models.RoomKey{Version: 2}
+	mockRepo.On("GetRoomKeys", mock.Anything, "room1").Return([]*models.RoomKey{{Version: 1, WrappedKey: wrapped1}}, nil).Once()
+	mockRepo.On("CreateRoomKey", mock.Anything, mock.MatchedBy(func(key *models.RoomKey) bool {
+		return key.ChatRoomID == "room1" && key.Version == 2
+	})).Run(func(args mock.Arguments) {
+		rotated.WrappedKey = args.Get(1).(*models.RoomKey).WrappedKey
+	}).Return(true, nil)
+	mockRepo.On("GetRoomKeys", mock.Anything, "room1").Return([]*models.RoomKey{{Version: 1, WrappedKey: wrapped1}, rotated}, nil)
+
+	version, err := service.RotateRoomKey(context.Background(), "room1")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, version)
+	assert.NotEqual(t, wrapped1, rotated.WrappedKey)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_ReencryptRoom(t *testing.T) {
+	mockRepo := new(MockRepository)
+	blobs, err := storage.NewLocalStore(t.TempDir())
+	assert.NoError(t, err)
+	service := NewService(mockRepo, config, blobs)
+
+	newDataKey := bytes.Repeat([]byte{7}, 32)
+	wrapped1, err := keyring.Wrap(testDataKey, testMasterKey)
+	assert.NoError(t, err)
+	wrapped2, err := keyring.Wrap(newDataKey, testMasterKey)
+	assert.NoError(t, err)
+	mockRepo.On("GetRoomKeys", mock.Anything, "room1").Return([]*models.RoomKey{
+		{Version: 1, WrappedKey: wrapped1},
+		{Version: 2, WrappedKey: wrapped2},
+	}, nil)
+
+	encrypted, err := util.EncryptMessage("old secret", testDataKey)
+	assert.NoError(t, err)
+	messages := []*models.Message{
+		{ID: "1", ChatRoomID: "room1", EncryptedContent: "legacy plaintext"},
+		{ID: "2", ChatRoomID: "room1", EncryptedContent: encrypted, KeyVersion: 1},
+		{ID: "3", ChatRoomID: "room1", EncryptedContent: "garbage", KeyVersion: 1},
+	}
+	mockRepo.On("GetMessagesForReencryption", mock.Anything, "room1", 2, "0", reencryptBatchSize).Return(messages, nil)
+
+	reencrypted := make(map[string]string)
+	mockRepo.On("UpdateMessageEncryption", mock.Anything, mock.MatchedBy(func(m *models.Message) bool {
+		return m.KeyVersion == 2
+	}), mock.Anything).Run(func(args mock.Arguments) {
+		m := args.Get(1).(*models.Message)
+		reencrypted[m.ID] = m.EncryptedContent
+	}).Return(true, nil)
+
+	blob, err := util.EncryptBytes([]byte("file data"), testDataKey)
+	assert.NoError(t, err)
+	assert.NoError(t, blobs.Put(context.Background(), "rooms/room1/old", bytes.NewReader(blob), int64(len(blob))))
+	mockRepo.On("GetAttachmentsForReencryption", mock.Anything, "room1", 2, "0", reencryptBatchSize).Return([]*models.Attachment{
+		{ID: "7", ChatRoomID: "room1", StorageKey: "rooms/room1/old", KeyVersion: 1},
+	}, nil)
+	var newStorageKey string
+	mockRepo.On("UpdateAttachmentEncryption", mock.Anything, mock.Anything, "rooms/room1/old").Run(func(args mock.Arguments) {
+		newStorageKey = args.Get(1).(*models.Attachment).StorageKey
+	}).Return(true, nil)
+
+	res, err := service.ReencryptRoom(context.Background(), "room1")
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, res.KeyVersion)
+	assert.Equal(t, 2, res.Messages)
+	assert.Equal(t, 1, res.Attachments)
+	assert.Equal(t, 1, res.Failed)
+
+	for id, expected := range map[string]string{"1": "legacy plaintext", "2": "old secret"} {
+		decrypted, err := util.DecryptMessage(reencrypted[id], newDataKey)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, decrypted)
+	}
+
+	_, err = blobs.Get(context.Background(), "rooms/room1/old")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	r, err := blobs.Get(context.Background(), newStorageKey)
+	assert.NoError(t, err)
+	stored, _ := io.ReadAll(r)
+	r.Close()
+	data, err := util.DecryptBytes(stored, newDataKey)
+	assert.NoError(t, err)
+	assert.Equal(t, "file data", string(data))
+}
+
+func TestService_RewrapKeys(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewService(mockRepo, config, nil)
+
+	newMaster := bytes.Repeat([]byte{9}, 32)
+	wrapped, err := keyring.Wrap(testDataKey, testMasterKey)
+	assert.NoError(t, err)
+	mockRepo.On("GetAllRoomKeys", mock.Anything).Return([]*models.RoomKey{{ChatRoomID: "room1", Version: 1, WrappedKey: wrapped}}, nil)
+
+	totpSecret := []byte("totp secret")
+	sealed, err := keyring.Wrap(totpSecret, testMasterKey)
+	assert.NoError(t, err)
+	mockRepo.On("GetAllTOTP", mock.Anything).Return([]*models.TOTP{{UserID: "user1", EncryptedSecret: sealed}}, nil)
+
+	// Room keys and TOTP secrets are saved together, with a deadline
+	mockRepo.On("UpdateWrappedKeys", mock.MatchedBy(func(ctx context.Context) bool {
+		_, ok := ctx.Deadline()
+		return ok
+	}), mock.MatchedBy(func(keys []*models.RoomKey) bool {
+		return len(keys) == 1 && keys[0].WrappedKey != wrapped
+	}), mock.MatchedBy(func(totps []*models.TOTP) bool {
+		if len(totps) != 1 || totps[0].UserID != "user1" {
+			return false
+		}
+		secret, err := keyring.Unwrap(totps[0].EncryptedSecret, newMaster)
+		return err == nil && bytes.Equal(secret, totpSecret)
+	})).Return(nil)
+
+	_, err = service.RewrapKeys(context.Background(), "invalid")
+	assert.Error(t, err)
+
+	n, err := service.RewrapKeys(context.Background(), base64.StdEncoding.EncodeToString(newMaster))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_RewrapKeys_Failed(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewService(mockRepo, config, nil).(*service)
+
+	newMaster := bytes.Repeat([]byte{9}, 32)
+	wrapped, err := keyring.Wrap(testDataKey, testMasterKey)
+	assert.NoError(t, err)
+	mockRepo.On("GetAllRoomKeys", mock.Anything).Return([]*models.RoomKey{{ChatRoomID: "room1", Version: 1, WrappedKey: wrapped}}, nil)
+	mockRepo.On("GetAllTOTP", mock.Anything).Return([]*models.TOTP{}, nil)
+	mockRepo.On("UpdateWrappedKeys", mock.Anything, mock.Anything, mock.Anything).Return(errors.New("connection reset"))
+
+	_, err = service.RewrapKeys(context.Background(), base64.StdEncoding.EncodeToString(newMaster))
+	assert.Error(t, err)
+
+	// The keyring keeps the old master key when nothing was saved
+	sealed, err := service.keys.Seal([]byte("secret"))
+	assert.NoError(t, err)
+	_, err = keyring.Unwrap(sealed, testMasterKey)
+	assert.NoError(t, err)
+}
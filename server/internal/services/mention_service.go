@@ -0,0 +1,129 @@
+package services
+
+import (
+	"chatgo/server/internal/interfaces"
+	"chatgo/server/internal/models"
+	"chatgo/server/internal/util"
+	"context"
+	"fmt"
+	"log"
+)
+
+const defaultMentionsLimit = 50
+
+// recordMentions сохраняет упоминания @username и @room из текста сообщения и возвращает
+// имена упомянутых пользователей. Упоминаются только участники чата, отправитель пропускается
+func (s *service) recordMentions(ctx context.Context, message *models.Message, sender *models.User, content string) []string {
+	names := util.ParseMentions(content)
+	if len(names) == 0 {
+		return nil
+	}
+
+	members, err := s.Repository.GetMembersByChatRoomID(ctx, message.ChatRoomID)
+	if err != nil {
+		log.Printf("Failed to get members for mentions in message %s: %v", message.ID, err)
+		return nil
+	}
+	isMember := make(map[string]bool, len(members))
+	for _, member := range members {
+		isMember[member.UserID] = true
+	}
+
+	mentioned := make(map[string]string)
+	for _, name := range names {
+		if name == util.RoomMention {
+			for _, member := range members {
+				if _, ok := mentioned[member.UserID]; !ok {
+					mentioned[member.UserID] = ""
+				}
+			}
+			continue
+		}
+
+		user, err := s.Repository.GetUserByUsername(ctx, name)
+		if err != nil || !isMember[user.ID] {
+			continue
+		}
+		mentioned[user.ID] = user.Username
+	}
+	delete(mentioned, sender.ID)
+
+	var mentions []*models.Mention
+	var usernames []string
+	for userID, username := range mentioned {
+		if username == "" {
+			user, err := s.Repository.GetUserByID(ctx, userID)
+			if err != nil {
+				continue
+			}
+			username = user.Username
+		}
+		mentions = append(mentions, &models.Mention{
+			MessageID:  message.ID,
+			UserID:     userID,
+			ChatRoomID: message.ChatRoomID,
+		})
+		usernames = append(usernames, username)
+	}
+	if len(mentions) == 0 {
+		return nil
+	}
+
+	if err := s.Repository.CreateMentions(ctx, mentions); err != nil {
+		log.Printf("Failed to store mentions for message %s: %v", message.ID, err)
+		return nil
+	}
+
+	return usernames
+}
+
+// GetMentions возвращает упоминания пользователя во всех чатах вместе с расшифрованными сообщениями
+func (s *service) GetMentions(c context.Context, req *interfaces.GetMentionsReq) ([]*interfaces.MentionRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	if req.UserID == "" {
+		return nil, fmt.Errorf("user ID is required")
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultMentionsLimit
+	}
+
+	mentions, err := s.Repository.GetMentionsByUserID(ctx, req.UserID, req.UnreadOnly, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*interfaces.MentionRes, 0, len(mentions))
+	for _, mention := range mentions {
+		message, err := s.Repository.GetMessageByID(ctx, mention.MessageID)
+		if err != nil {
+			return nil, err
+		}
+		messageRes, err := s.toMessageRes(ctx, message)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, &interfaces.MentionRes{
+			ID:      mention.ID,
+			IsRead:  mention.IsRead,
+			Message: messageRes,
+		})
+	}
+
+	return result, nil
+}
+
+// MarkMentionsRead отмечает упоминания пользователя прочитанными
+func (s *service) MarkMentionsRead(c context.Context, req *interfaces.MarkMentionsReadReq) error {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	if req.UserID == "" {
+		return fmt.Errorf("user ID is required")
+	}
+
+	return s.Repository.MarkMentionsRead(ctx, req.UserID, req.IDs)
+}
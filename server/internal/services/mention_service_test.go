@@ -0,0 +1,120 @@
+package services
+
+import (
+	"chatgo/server/internal/interfaces"
+	"chatgo/server/internal/models"
+	"chatgo/server/internal/util"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestService_CreateMessage_Mentions(t *testing.T) {
+	testCases := []struct {
+		name      string
+		content   string
+		mockSetup func(mockRepo *MockRepository)
+		expected  []string
+	}{
+		{
+			name:    "Mention members, skip non-members and unknown users",
+			content: "@bob @carol @ghost please review",
+			mockSetup: func(mockRepo *MockRepository) {
+				mockRepo.On("GetUserByUsername", mock.Anything, "bob").Return(&models.User{ID: "user2", Username: "bob"}, nil)
+				mockRepo.On("GetUserByUsername", mock.Anything, "carol").Return(&models.User{ID: "user3", Username: "carol"}, nil)
+				mockRepo.On("GetUserByUsername", mock.Anything, "ghost").Return(nil, errors.New("sql: no rows in result set"))
+				mockRepo.On("CreateMentions", mock.Anything, []*models.Mention{
+					{MessageID: "msg1", UserID: "user2", ChatRoomID: "room1"},
+				}).Return(nil)
+			},
+			expected: []string{"bob"},
+		},
+		{
+			name:    "Room mention notifies everyone but the sender",
+			content: "@room standup in 5 minutes",
+			mockSetup: func(mockRepo *MockRepository) {
+				mockRepo.On("GetUserByID", mock.Anything, "user2").Return(&models.User{ID: "user2", Username: "bob"}, nil)
+				mockRepo.On("CreateMentions", mock.Anything, mock.MatchedBy(func(mentions []*models.Mention) bool {
+					return len(mentions) == 1 && mentions[0].UserID == "user2"
+				})).Return(nil)
+			},
+			expected: []string{"bob"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockRepo := new(MockRepository)
+			mockRoomKeys(mockRepo)
+			service := NewService(mockRepo, config, nil)
+
+			mockRepo.On("GetUserByUsername", mock.Anything, "alice").Return(&models.User{ID: "user1", Username: "alice"}, nil)
+			mockRepo.On("GetChatRoomByID", mock.Anything, "room1").Return(&models.ChatRoom{ID: "room1"}, nil)
+			mockRepo.On("CreateMessage", mock.Anything, mock.Anything).Return(&models.Message{
+				ID:         "msg1",
+				SenderID:   "user1",
+				ChatRoomID: "room1",
+				CreatedAt:  time.Now(),
+			}, nil)
+			mockRepo.On("GetMembersByChatRoomID", mock.Anything, "room1").Return([]*models.ChatRoomMember{
+				{UserID: "user1", ChatRoomID: "room1"},
+				{UserID: "user2", ChatRoomID: "room1"},
+			}, nil)
+			tc.mockSetup(mockRepo)
+
+			result, err := service.CreateMessage(context.Background(), &interfaces.CreateMessageReq{
+				Content:  tc.content,
+				RoomID:   "room1",
+				Username: "alice",
+			})
+
+			assert.NoError(t, err)
+			assert.ElementsMatch(t, tc.expected, result.Mentions)
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestService_GetMentions(t *testing.T) {
+	mockRepo := new(MockRepository)
+	mockRoomKeys(mockRepo)
+	service := NewService(mockRepo, config, nil)
+
+	encrypted, err := util.EncryptMessage("@bob ping", testDataKey)
+	assert.NoError(t, err)
+
+	mockRepo.On("GetMentionsByUserID", mock.Anything, "user2", true, defaultMentionsLimit).Return([]*models.Mention{
+		{ID: "1", MessageID: "msg1", UserID: "user2", ChatRoomID: "room1"},
+	}, nil)
+	mockRepo.On("GetMessageByID", mock.Anything, "msg1").Return(&models.Message{
+		ID:               "msg1",
+		SenderID:         "user1",
+		ChatRoomID:       "room1",
+		EncryptedContent: encrypted, KeyVersion: 1,
+	}, nil)
+	mockRepo.On("GetUserByID", mock.Anything, "user1").Return(&models.User{ID: "user1", Username: "alice"}, nil)
+
+	result, err := service.GetMentions(context.Background(), &interfaces.GetMentionsReq{UserID: "user2", UnreadOnly: true})
+
+	assert.NoError(t, err)
+	assert.Len(t, result, 1)
+	assert.Equal(t, "1", result[0].ID)
+	assert.Equal(t, "@bob ping", result[0].Message.Content)
+	assert.Equal(t, "alice", result[0].Message.Username)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_MarkMentionsRead(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewService(mockRepo, config, nil)
+
+	mockRepo.On("MarkMentionsRead", mock.Anything, "user2", []string{"1"}).Return(nil)
+
+	assert.NoError(t, service.MarkMentionsRead(context.Background(), &interfaces.MarkMentionsReadReq{UserID: "user2", IDs: []string{"1"}}))
+	assert.Error(t, service.MarkMentionsRead(context.Background(), &interfaces.MarkMentionsReadReq{}))
+	mockRepo.AssertExpectations(t)
+}
@@ -3,8 +3,9 @@ package services
 import (
 	"chatgo/server/internal/interfaces"
 	"chatgo/server/internal/models"
-	"chatgo/server/internal/util"
+	"chatgo/server/internal/search"
 	"context"
+	"database/sql"
 	"fmt"
 	"log"
 	"time"
@@ -14,33 +15,150 @@ func (s *service) CreateMessage(c context.Context, req *interfaces.CreateMessage
 	ctx, cancel := context.WithTimeout(c, s.timeout)
 	defer cancel()
 
+	return s.createMessage(ctx, req, nil)
+}
+
+// createMessage сохраняет сообщение. Если poll не nil, опрос сохраняется вместе с сообщением
+// в одной транзакции
+func (s *service) createMessage(ctx context.Context, req *interfaces.CreateMessageReq, poll *models.Poll) (*interfaces.CreateMessageRes, error) {
 	user, err := s.Repository.GetUserByUsername(ctx, req.Username)
 	if err != nil {
 		return nil, err
 	}
 
-	encryptedMessage, err := util.EncryptMessage(req.Content, s.encryptKey)
+	var parentID sql.NullString
+	if req.ParentID != "" {
+		parent, err := s.Repository.GetMessageByID(ctx, req.ParentID)
+		if err != nil {
+			return nil, fmt.Errorf("parent message %s not found", req.ParentID)
+		}
+		if parent.ChatRoomID != req.RoomID {
+			return nil, fmt.Errorf("parent message %s belongs to another room", req.ParentID)
+		}
+
+		// Ветки одноуровневые: ответ на ответ попадает в ветку корневого сообщения
+		parentID = sql.NullString{String: parent.ID, Valid: true}
+		if parent.ParentID.Valid {
+			parentID = parent.ParentID
+		}
+	}
+
+	if req.TTL < 0 || req.TTL > maxMessageTTL {
+		return nil, interfaces.ErrInvalidTTL
+	}
+
+	room, err := s.Repository.GetChatRoomByID(ctx, req.RoomID)
 	if err != nil {
-		log.Printf("Failed to encrypt message: %v", err)
-		return nil, fmt.Errorf("Failed to encrypt message: %v", err)
+		return nil, err
+	}
+	e2e := room != nil && room.E2E
+	if e2e && !req.Encrypted {
+		return nil, fmt.Errorf("messages in room %s must be encrypted by the client", req.RoomID)
+	}
+	if !e2e && req.Encrypted {
+		return nil, fmt.Errorf("room %s is not end-to-end encrypted", req.RoomID)
+	}
+
+	// Сообщения чатов со сквозным шифрованием уже зашифрованы клиентом и сохраняются как есть
+	encryptedMessage, keyVersion := req.Content, models.E2EKeyVersion
+	if !e2e {
+		encryptedMessage, keyVersion, err = s.encryptContent(ctx, req.RoomID, req.Content)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	message, err := s.Repository.CreateMessage(ctx, &models.Message{
+	message := &models.Message{
 		SenderID:         user.ID,
 		ChatRoomID:       req.RoomID,
 		EncryptedContent: encryptedMessage,
-	})
+		ParentID:         parentID,
+		KeyVersion:       keyVersion,
+		ExpiresAt:        expiresAt(room, req.TTL),
+	}
+	if poll != nil {
+		message, poll, err = s.Repository.CreatePoll(ctx, message, poll)
+	} else {
+		message, err = s.Repository.CreateMessage(ctx, message)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Сервер не видит текст сообщений со сквозным шифрованием, поэтому поиск и упоминания для них недоступны
+	var mentions []string
+	if !e2e {
+		s.index.Add(search.Document{
+			ID:        message.ID,
+			RoomID:    message.ChatRoomID,
+			Username:  user.Username,
+			Content:   req.Content,
+			CreatedAt: message.CreatedAt,
+		})
+
+		mentions = s.recordMentions(ctx, message, user, req.Content)
+	}
+
+	attachments, err := s.linkAttachments(ctx, message, req.AttachmentIDs)
+	if err != nil {
+		log.Printf("Failed to link attachments to message %s: %v", message.ID, err)
+	}
+
+	res := &interfaces.CreateMessageRes{
+		ID:          message.ID,
+		Content:     message.EncryptedContent,
+		RoomID:      message.ChatRoomID,
+		Username:    user.Username,
+		CreatedAt:   message.CreatedAt.Format(time.RFC3339),
+		ParentID:    message.ParentID.String,
+		Mentions:    mentions,
+		Attachments: attachments,
+		Encrypted:   e2e,
+		ExpiresAt:   formatExpiresAt(message.ExpiresAt),
+		Bot:         user.IsBot,
+	}
+	if poll != nil {
+		if res.Poll, err = s.toPollRes(ctx, poll); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// GetMessageByID возвращает расшифрованное сообщение вместе со счётчиком ответов в его ветке
+func (s *service) GetMessageByID(c context.Context, messageID string) (*interfaces.CreateMessageRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	message, err := s.Repository.GetMessageByID(ctx, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.toMessageRes(ctx, message)
+	if err != nil {
+		return nil, err
+	}
+
+	reactions, err := s.getReactions(ctx, []string{message.ID})
 	if err != nil {
 		return nil, err
 	}
+	res.Reactions = reactions[message.ID]
 
-	return &interfaces.CreateMessageRes{
-		ID:        message.ID,
-		Content:   message.EncryptedContent,
-		RoomID:    message.ChatRoomID,
-		Username:  user.Username,
-		CreatedAt: message.CreatedAt.Format(time.RFC3339),
-	}, nil
+	attachments, err := s.getAttachments(ctx, []string{message.ID})
+	if err != nil {
+		return nil, err
+	}
+	res.Attachments = attachments[message.ID]
+
+	polls, err := s.getPolls(ctx, []string{message.ID})
+	if err != nil {
+		return nil, err
+	}
+	res.Poll = polls[message.ID]
+
+	return res, nil
 }
 
 func (s *service) GetMessagesByRoomID(c context.Context, roomID string, limit int) ([]*interfaces.CreateMessageRes, error) {
@@ -52,25 +170,86 @@ func (s *service) GetMessagesByRoomID(c context.Context, roomID string, limit in
 		return nil, err
 	}
 
-	result := make([]*interfaces.CreateMessageRes, len(messages))
+	return s.toMessageResList(ctx, messages)
+}
+
+// GetThreadMessages возвращает расшифрованные ответы в ветке сообщения parentID
+func (s *service) GetThreadMessages(c context.Context, parentID string, limit int) ([]*interfaces.CreateMessageRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	messages, err := s.Repository.GetThreadMessages(ctx, parentID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.toMessageResList(ctx, messages)
+}
+
+func (s *service) toMessageResList(ctx context.Context, messages []*models.Message) ([]*interfaces.CreateMessageRes, error) {
+	messageIDs := make([]string, len(messages))
 	for i, message := range messages {
-		user, err := s.Repository.GetUserByID(ctx, message.SenderID)
-		if err != nil {
-			return nil, err
+		messageIDs[i] = message.ID
+	}
+	reactions, err := s.getReactions(ctx, messageIDs)
+	if err != nil {
+		return nil, err
+	}
+	attachments, err := s.getAttachments(ctx, messageIDs)
+	if err != nil {
+		return nil, err
+	}
+	polls, err := s.getPolls(ctx, messageIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Истёкшие сообщения могут ещё лежать в базе до следующего прохода удаления, но их уже не показывают
+	now := utcNow()
+	result := make([]*interfaces.CreateMessageRes, 0, len(messages))
+	for _, message := range messages {
+		if message.ExpiresAt.Valid && !message.ExpiresAt.Time.After(now) {
+			continue
 		}
-		decryptMessage, err := util.DecryptMessage(message.EncryptedContent, s.encryptKey)
+		res, err := s.toMessageRes(ctx, message)
 		if err != nil {
-			log.Printf("Failed to encrypt message: %v", err)
-			return nil, fmt.Errorf("Failed to encrypt message: %v", err)
-		}
-		result[i] = &interfaces.CreateMessageRes{
-			ID:        message.ID,
-			Content:   decryptMessage,
-			RoomID:    message.ChatRoomID,
-			Username:  user.Username,
-			CreatedAt: message.CreatedAt.Format(time.RFC3339),
+			return nil, err
 		}
+		res.Reactions = reactions[message.ID]
+		res.Attachments = attachments[message.ID]
+		res.Poll = polls[message.ID]
+		result = append(result, res)
 	}
 
 	return result, nil
 }
+
+// toMessageRes расшифровывает сообщение и дополняет его именем отправителя
+func (s *service) toMessageRes(ctx context.Context, message *models.Message) (*interfaces.CreateMessageRes, error) {
+	user, err := s.Repository.GetUserByID(ctx, message.SenderID)
+	if err != nil {
+		return nil, err
+	}
+	decryptMessage, err := s.decryptContent(ctx, message.ChatRoomID, message.KeyVersion, message.EncryptedContent)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &interfaces.CreateMessageRes{
+		ID:         message.ID,
+		Content:    decryptMessage,
+		RoomID:     message.ChatRoomID,
+		Username:   user.Username,
+		CreatedAt:  message.CreatedAt.Format(time.RFC3339),
+		ParentID:   message.ParentID.String,
+		ReplyCount: message.ReplyCount,
+		Encrypted:  message.KeyVersion == models.E2EKeyVersion,
+		ExpiresAt:  formatExpiresAt(message.ExpiresAt),
+		Bot:        user.IsBot,
+	}
+	if message.LastReplyAt.Valid {
+		res.LastReplyAt = message.LastReplyAt.Time.Format(time.RFC3339)
+	}
+
+	return res, nil
+}
@@ -1,5 +1,18 @@
 package services
 
+import (
+	"chatgo/server/internal/interfaces"
+	"chatgo/server/internal/models"
+	"chatgo/server/internal/util"
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
 // import (
 // 	"chatgo/server/internal/interfaces"
 // 	"chatgo/server/internal/models"
@@ -14,7 +27,7 @@ package services
 
 // func TestService_CreateMessage(t *testing.T) {
 // 	mockRepo := new(MockRepository)
-// 	service := NewService(mockRepo, config)
+// 	service := NewService(mockRepo, config, nil)
 
 // 	req := &interfaces.CreateMessageReq{
 // 		Content:  "Hello, world!",
@@ -27,7 +40,7 @@ package services
 // 		Username: req.Username,
 // 	}
 
-// 	encryptedMessage, err := util.EncryptMessage(req.Content, config.encryptKey)
+// 	encryptedMessage, err := util.EncryptMessage(req.Content, testDataKey)
 // 	assert.NoError(t, err)
 
 // 	message := &models.Message{
@@ -56,7 +69,7 @@ package services
 
 // func TestService_GetMessagesByRoomID(t *testing.T) {
 // 	mockRepo := new(MockRepository)
-// 	service := NewService(mockRepo, config)
+// 	service := NewService(mockRepo, config, nil)
 
 // 	roomID := "room123"
 // 	limit := 10
@@ -71,9 +84,9 @@ package services
 // 		Username: "testuser2",
 // 	}
 
-// 	encryptedMsg1, err := util.EncryptMessage("Message 1", config.encryptKey)
+// 	encryptedMsg1, err := util.EncryptMessage("Message 1", testDataKey)
 // 	assert.NoError(t, err)
-// 	encryptedMsg2, err := util.EncryptMessage("Message 2", config.encryptKey)
+// 	encryptedMsg2, err := util.EncryptMessage("Message 2", testDataKey)
 // 	assert.NoError(t, err)
 
 // 	messages := []*models.Message{
@@ -105,17 +118,152 @@ package services
 
 // 	// First message assertions
 // 	assert.Equal(t, messages[0].ID, result[0].ID)
-// 	decryptedMsg1, err := util.DecryptMessage(messages[0].EncryptedContent, config.encryptKey)
+// 	decryptedMsg1, err := util.DecryptMessage(messages[0].EncryptedContent, testDataKey)
 // 	assert.NoError(t, err)
 // 	assert.Equal(t, decryptedMsg1, result[0].Content)
 // 	assert.Equal(t, user1.Username, result[0].Username)
 
 // 	// Second message assertions
 // 	assert.Equal(t, messages[1].ID, result[1].ID)
-// 	decryptedMsg2, err := util.DecryptMessage(messages[1].EncryptedContent, config.encryptKey)
+// 	decryptedMsg2, err := util.DecryptMessage(messages[1].EncryptedContent, testDataKey)
 // 	assert.NoError(t, err)
 // 	assert.Equal(t, decryptedMsg2, result[1].Content)
 // 	assert.Equal(t, user2.Username, result[1].Username)
 
 // 	mockRepo.AssertExpectations(t)
 // }
+
+func TestService_CreateMessage_Reply(t *testing.T) {
+	testCases := []struct {
+		name        string
+		parent      *models.Message
+		expectError bool
+		expectedID  string
+	}{
+		{
+			name:       "Reply to root message",
+			parent:     &models.Message{ID: "msg1", ChatRoomID: "room123"},
+			expectedID: "msg1",
+		},
+		{
+			name:       "Reply to reply goes to root thread",
+			parent:     &models.Message{ID: "msg2", ChatRoomID: "room123", ParentID: sql.NullString{String: "msg1", Valid: true}},
+			expectedID: "msg1",
+		},
+		{
+			name:        "Parent in another room",
+			parent:      &models.Message{ID: "msg3", ChatRoomID: "room999"},
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockRepo := new(MockRepository)
+			mockRoomKeys(mockRepo)
+			service := NewService(mockRepo, config, nil)
+
+			mockRepo.On("GetUserByUsername", mock.Anything, "testuser").Return(&models.User{ID: "user123", Username: "testuser"}, nil)
+			mockRepo.On("GetMessageByID", mock.Anything, tc.parent.ID).Return(tc.parent, nil)
+			if !tc.expectError {
+				mockRepo.On("GetChatRoomByID", mock.Anything, "room123").Return(&models.ChatRoom{ID: "room123"}, nil)
+				mockRepo.On("CreateMessage", mock.Anything, mock.MatchedBy(func(m *models.Message) bool {
+					return m.ParentID.Valid && m.ParentID.String == tc.expectedID && m.KeyVersion == 1
+				})).Return(&models.Message{
+					ID:         "reply1",
+					ChatRoomID: "room123",
+					ParentID:   sql.NullString{String: tc.expectedID, Valid: true},
+					CreatedAt:  time.Now(),
+				}, nil)
+			}
+
+			result, err := service.CreateMessage(context.Background(), &interfaces.CreateMessageReq{
+				Content:  "Reply",
+				RoomID:   "room123",
+				Username: "testuser",
+				ParentID: tc.parent.ID,
+			})
+
+			if tc.expectError {
+				assert.Error(t, err)
+				mockRepo.AssertNotCalled(t, "CreateMessage", mock.Anything, mock.Anything)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedID, result.ParentID)
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestService_CreateMessage_E2E(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewService(mockRepo, config, nil)
+
+	mockRepo.On("GetUserByUsername", mock.Anything, "alice").Return(&models.User{ID: "user1", Username: "alice"}, nil)
+	mockRepo.On("GetChatRoomByID", mock.Anything, "room1").Return(&models.ChatRoom{ID: "room1", E2E: true}, nil)
+	mockRepo.On("CreateMessage", mock.Anything, mock.MatchedBy(func(m *models.Message) bool {
+		return m.EncryptedContent == "client ciphertext" && m.KeyVersion == models.E2EKeyVersion
+	})).Return(&models.Message{
+		ID:               "msg1",
+		SenderID:         "user1",
+		ChatRoomID:       "room1",
+		EncryptedContent: "client ciphertext",
+		KeyVersion:       models.E2EKeyVersion,
+		CreatedAt:        time.Now(),
+	}, nil)
+
+	_, err := service.CreateMessage(context.Background(), &interfaces.CreateMessageReq{
+		Content:  "@bob plaintext",
+		RoomID:   "room1",
+		Username: "alice",
+	})
+	assert.Error(t, err)
+
+	result, err := service.CreateMessage(context.Background(), &interfaces.CreateMessageReq{
+		Content:   "client ciphertext",
+		RoomID:    "room1",
+		Username:  "alice",
+		Encrypted: true,
+	})
+	assert.NoError(t, err)
+	assert.True(t, result.Encrypted)
+	assert.Empty(t, result.Mentions)
+
+	// The server never interprets the content of end-to-end encrypted messages
+	mockRepo.AssertNotCalled(t, "GetRoomKeys", mock.Anything, mock.Anything)
+	mockRepo.AssertNotCalled(t, "CreateMentions", mock.Anything, mock.Anything)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_GetThreadMessages(t *testing.T) {
+	mockRepo := new(MockRepository)
+	mockRoomKeys(mockRepo)
+	service := NewService(mockRepo, config, nil)
+
+	encrypted, err := util.EncryptMessage("Thread reply", testDataKey)
+	assert.NoError(t, err)
+
+	mockRepo.On("GetThreadMessages", mock.Anything, "msg1", 20).Return([]*models.Message{
+		{ID: "msg2", SenderID: "user1", ChatRoomID: "room123", EncryptedContent: encrypted, KeyVersion: 1, ParentID: sql.NullString{String: "msg1", Valid: true}},
+	}, nil)
+	mockRepo.On("GetUserByID", mock.Anything, "user1").Return(&models.User{ID: "user1", Username: "testuser1"}, nil)
+	mockRepo.On("GetReactionCountsByMessageIDs", mock.Anything, []string{"msg2"}).Return([]*models.ReactionCount{
+		{MessageID: "msg2", Emoji: "👍", Count: 3},
+	}, nil)
+	mockRepo.On("GetAttachmentsByMessageIDs", mock.Anything, []string{"msg2"}).Return([]*models.Attachment{
+		{ID: "att1", ChatRoomID: "room123", MessageID: sql.NullString{String: "msg2", Valid: true}, Filename: "cat.png", ContentType: "image/png", Size: 10},
+	}, nil)
+	mockRepo.On("GetPollsByMessageIDs", mock.Anything, []string{"msg2"}).Return([]*models.Poll{}, nil)
+
+	result, err := service.GetThreadMessages(context.Background(), "msg1", 20)
+
+	assert.NoError(t, err)
+	assert.Len(t, result, 1)
+	assert.Equal(t, "Thread reply", result[0].Content)
+	assert.Equal(t, "msg1", result[0].ParentID)
+	assert.Equal(t, "testuser1", result[0].Username)
+	assert.Equal(t, []*interfaces.ReactionCountRes{{Emoji: "👍", Count: 3}}, result[0].Reactions)
+	assert.Equal(t, []*interfaces.AttachmentRes{{ID: "att1", RoomID: "room123", Filename: "cat.png", ContentType: "image/png", Size: 10}}, result[0].Attachments)
+	mockRepo.AssertExpectations(t)
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"chatgo/server/internal/interfaces"
+	"chatgo/server/internal/models"
+	"chatgo/server/internal/util"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	defaultMinPasswordLength = 8
+	defaultMaxPasswordLength = 64
+	// maxPasswordBytes — bcrypt не принимает пароли длиннее
+	maxPasswordBytes = 72
+	defaultResetTTL  = time.Hour
+	resetTokenSize   = 32
+	resetTokenPrefix = "chatgo_reset_"
+)
+
+// newDummyHash возвращает хеш, с которым сравнивается пароль несуществующего пользователя.
+// Его стоимость должна совпадать со стоимостью настоящих хешей, иначе время ответа выдаст,
+// что аккаунта нет
+func newDummyHash(cost int) string {
+	if cost == 0 || cost == bcrypt.DefaultCost {
+		return dummyPasswordHash
+	}
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return dummyPasswordHash
+	}
+	hash, err := util.HashPassword(hex.EncodeToString(random), cost)
+	if err != nil {
+		log.Printf("Failed to hash the dummy password: %v", err)
+		return dummyPasswordHash
+	}
+	return hash
+}
+
+// checkPasswordPolicy проверяет новый пароль на соответствие требованиям Password
+func (s *service) checkPasswordPolicy(password string) error {
+	minLength := s.Password.MinLength
+	if minLength == 0 {
+		minLength = defaultMinPasswordLength
+	}
+	maxLength := s.Password.MaxLength
+	if maxLength == 0 {
+		maxLength = defaultMaxPasswordLength
+	}
+
+	length := utf8.RuneCountInString(password)
+	if length < minLength {
+		return fmt.Errorf("%w: it must be at least %d characters long", interfaces.ErrWeakPassword, minLength)
+	}
+	if length > maxLength || len(password) > maxPasswordBytes {
+		return fmt.Errorf("%w: it must be at most %d characters long", interfaces.ErrWeakPassword, maxLength)
+	}
+	if _, ok := s.breached[strings.ToLower(password)]; ok {
+		return fmt.Errorf("%w: it appears in a list of breached passwords", interfaces.ErrWeakPassword)
+	}
+	return nil
+}
+
+// ChangePassword меняет пароль пользователя после проверки текущего. Токены доступа
+// всех сессий отзываются, а для текущей выдаётся новый
+func (s *service) ChangePassword(c context.Context, req *interfaces.ChangePasswordReq) (*interfaces.LoginUserRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	u, err := s.Repository.GetUserByID(ctx, req.UserID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && u == nil) {
+		return nil, interfaces.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := util.CheckPassword(req.CurrentPassword, u.EncryptedPassword, s.Password.Cost); err != nil {
+		return nil, interfaces.ErrWrongPassword
+	}
+	if err := s.checkPasswordPolicy(req.NewPassword); err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := util.HashPassword(req.NewPassword, s.Password.Cost)
+	if err != nil {
+		return nil, err
+	}
+	if u.TokenVersion, err = s.Repository.ChangePassword(ctx, u.ID, hashedPassword); err != nil {
+		return nil, err
+	}
+
+	token, err := s.signToken(u, "", accessTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("User %s changed the password", u.ID)
+	return &interfaces.LoginUserRes{ID: u.ID, Username: u.Username, AccessToken: token}, nil
+}
+
+// CreatePasswordReset выдаёт одноразовый токен сброса пароля пользователя username.
+// Выдавать токены могут только администраторы сервера, прежние неиспользованные токены
+// пользователя перестают действовать
+func (s *service) CreatePasswordReset(c context.Context, adminID, username string) (*interfaces.PasswordResetRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	if err := s.checkServerAdmin(ctx, adminID); err != nil {
+		return nil, err
+	}
+
+	u, err := s.Repository.GetUserByUsername(ctx, username)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && u == nil) {
+		return nil, interfaces.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	secret := make([]byte, resetTokenSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	token := resetTokenPrefix + hex.EncodeToString(secret)
+
+	ttl := s.Password.ResetTTL
+	if ttl == 0 {
+		ttl = defaultResetTTL
+	}
+	reset := &models.PasswordReset{
+		TokenHash: hashResetToken(token),
+		UserID:    u.ID,
+		CreatedBy: adminID,
+		ExpiresAt: utcNow().Add(ttl),
+	}
+	if err := s.Repository.CreatePasswordReset(ctx, reset); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Server admin %s issued a password reset for user %s", adminID, u.ID)
+	return &interfaces.PasswordResetRes{Token: token, ExpiresAt: reset.ExpiresAt}, nil
+}
+
+// ResetPassword задаёт новый пароль по токену сброса. Токены доступа пользователя
+// отзываются, а блокировка входа снимается
+func (s *service) ResetPassword(c context.Context, req *interfaces.ResetPasswordReq) error {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	if !strings.HasPrefix(req.Token, resetTokenPrefix) {
+		return interfaces.ErrInvalidResetToken
+	}
+	if err := s.checkPasswordPolicy(req.NewPassword); err != nil {
+		return err
+	}
+
+	hashedPassword, err := util.HashPassword(req.NewPassword, s.Password.Cost)
+	if err != nil {
+		return err
+	}
+	userID, err := s.Repository.ResetPassword(ctx, hashResetToken(req.Token), hashedPassword)
+	if err != nil {
+		return err
+	}
+	if userID == "" {
+		return interfaces.ErrInvalidResetToken
+	}
+
+	log.Printf("User %s reset the password", userID)
+	return nil
+}
+
+// hashResetToken возвращает хеш токена сброса пароля, по которому он хранится
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
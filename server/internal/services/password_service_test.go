@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"chatgo/server/internal/interfaces"
+	"chatgo/server/internal/models"
+	"chatgo/server/internal/util"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestService_checkPasswordPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	require.NoError(t, os.WriteFile(path, []byte("password123\nletmein!!\n"), 0o600))
+
+	cfg := *config
+	cfg.Password.BreachedList = path
+	s := NewService(new(MockRepository), &cfg, nil).(*service)
+
+	assert.NoError(t, s.checkPasswordPolicy("correct horse battery"))
+	assert.ErrorIs(t, s.checkPasswordPolicy(""), interfaces.ErrWeakPassword)
+	assert.ErrorIs(t, s.checkPasswordPolicy("short"), interfaces.ErrWeakPassword)
+	assert.ErrorIs(t, s.checkPasswordPolicy(strings.Repeat("a", 65)), interfaces.ErrWeakPassword)
+	// 42 characters, but more bytes than bcrypt takes
+	assert.ErrorIs(t, s.checkPasswordPolicy(strings.Repeat("пароль", 7)), interfaces.ErrWeakPassword)
+
+	err := s.checkPasswordPolicy("LetMeIn!!")
+	assert.ErrorIs(t, err, interfaces.ErrWeakPassword)
+	assert.Contains(t, err.Error(), "breached")
+
+	s.Password.MinLength = 12
+	assert.ErrorIs(t, s.checkPasswordPolicy("elevenchars"), interfaces.ErrWeakPassword)
+}
+
+func TestService_CreateUser_WeakPassword(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewService(mockRepo, config, nil)
+
+	_, err := service.CreateUser(context.Background(), &interfaces.CreateUserReq{Username: "alice", Password: ""})
+	assert.ErrorIs(t, err, interfaces.ErrWeakPassword)
+	mockRepo.AssertNotCalled(t, "CreateUser", mock.Anything, mock.Anything)
+}
+
+func TestService_Login_Rehash(t *testing.T) {
+	cfg := *config
+	cfg.Password.Cost = bcrypt.MinCost + 1
+	mockRepo := new(MockRepository)
+	service := NewService(mockRepo, &cfg, nil)
+
+	hashedPassword, err := util.HashPassword("password123", bcrypt.MinCost)
+	require.NoError(t, err)
+	user := &models.User{ID: "1", Username: "alice", EncryptedPassword: hashedPassword}
+
+	mockRepo.On("GetUserByUsername", mock.Anything, "alice").Return(user, nil)
+	mockRepo.On("UpdatePasswordHash", mock.Anything, "1", mock.MatchedBy(func(hash string) bool {
+		cost, err := bcrypt.Cost([]byte(hash))
+		return err == nil && cost == bcrypt.MinCost+1 && bcrypt.CompareHashAndPassword([]byte(hash), []byte("password123")) == nil
+	})).Return(nil)
+	mockRepo.On("GetTOTP", mock.Anything, "1").Return(nil, nil)
+	mockRepo.On("UpdateLastLogin", mock.Anything, "1", "").Return(nil)
+	mockRepo.On("CreateLoginAttempt", mock.Anything, mock.Anything).Return(nil)
+
+	_, err = service.Login(context.Background(), &interfaces.LoginUserReq{Username: "alice", Password: "password123"})
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_ChangePassword(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewService(mockRepo, config, nil)
+
+	hashedPassword, err := util.HashPassword("password123", bcrypt.MinCost)
+	require.NoError(t, err)
+	mockRepo.On("GetUserByID", mock.Anything, "1").Return(&models.User{ID: "1", Username: "alice", EncryptedPassword: hashedPassword, TokenVersion: 1}, nil).Once()
+
+	_, err = service.ChangePassword(context.Background(), &interfaces.ChangePasswordReq{UserID: "1", CurrentPassword: "wrong", NewPassword: "new password"})
+	assert.ErrorIs(t, err, interfaces.ErrWrongPassword)
+
+	mockRepo.On("GetUserByID", mock.Anything, "1").Return(&models.User{ID: "1", Username: "alice", EncryptedPassword: hashedPassword, TokenVersion: 1}, nil).Once()
+	_, err = service.ChangePassword(context.Background(), &interfaces.ChangePasswordReq{UserID: "1", CurrentPassword: "password123", NewPassword: "short"})
+	assert.ErrorIs(t, err, interfaces.ErrWeakPassword)
+	mockRepo.AssertNotCalled(t, "ChangePassword", mock.Anything, mock.Anything, mock.Anything)
+
+	mockRepo.On("GetUserByID", mock.Anything, "1").Return(&models.User{ID: "1", Username: "alice", EncryptedPassword: hashedPassword, TokenVersion: 1}, nil).Once()
+	mockRepo.On("ChangePassword", mock.Anything, "1", mock.MatchedBy(func(hash string) bool {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte("new password")) == nil
+	})).Return(2, nil)
+	res, err := service.ChangePassword(context.Background(), &interfaces.ChangePasswordReq{UserID: "1", CurrentPassword: "password123", NewPassword: "new password"})
+	require.NoError(t, err)
+
+	// The new token carries the new version, so it outlives the tokens of the other sessions
+	mockRepo.On("GetUserByID", mock.Anything, "1").Return(&models.User{ID: "1", Username: "alice", TokenVersion: 2}, nil)
+	user, err := service.ValidateToken(context.Background(), res.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, "1", user.ID)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_CreatePasswordReset(t *testing.T) {
+	withLocalZone(t)
+	cfg := *config
+	cfg.Admins = []string{"9"}
+	mockRepo := new(MockRepository)
+	service := NewService(mockRepo, &cfg, nil)
+
+	mockRepo.On("GetUserByUsername", mock.Anything, "alice").Return(&models.User{ID: "1", Username: "alice"}, nil)
+
+	var stored *models.PasswordReset
+	mockRepo.On("CreatePasswordReset", mock.Anything, mock.MatchedBy(func(r *models.PasswordReset) bool {
+		stored = r
+		// The expiry is compared with NOW() in UTC
+		return r.UserID == "1" && r.CreatedBy == "9" && isUTC(r.ExpiresAt)
+	})).Return(nil)
+
+	_, err := service.CreatePasswordReset(context.Background(), "2", "alice")
+	assert.ErrorIs(t, err, interfaces.ErrNotServerAdmin)
+
+	res, err := service.CreatePasswordReset(context.Background(), "9", "alice")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(res.Token, resetTokenPrefix))
+	// Only the hash of the token is stored
+	assert.Equal(t, hashResetToken(res.Token), stored.TokenHash)
+	assert.Equal(t, stored.ExpiresAt, res.ExpiresAt)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_ResetPassword(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewService(mockRepo, config, nil)
+
+	token := resetTokenPrefix + "abc"
+	mockRepo.On("ResetPassword", mock.Anything, hashResetToken(token), mock.Anything).Return("1", nil).Once()
+	mockRepo.On("ResetPassword", mock.Anything, hashResetToken(token), mock.Anything).Return("", nil).Once()
+
+	err := service.ResetPassword(context.Background(), &interfaces.ResetPasswordReq{Token: "abc", NewPassword: "new password"})
+	assert.ErrorIs(t, err, interfaces.ErrInvalidResetToken)
+
+	err = service.ResetPassword(context.Background(), &interfaces.ResetPasswordReq{Token: token, NewPassword: "short"})
+	assert.ErrorIs(t, err, interfaces.ErrWeakPassword)
+
+	assert.NoError(t, service.ResetPassword(context.Background(), &interfaces.ResetPasswordReq{Token: token, NewPassword: "new password"}))
+
+	// The token works only once
+	err = service.ResetPassword(context.Background(), &interfaces.ResetPasswordReq{Token: token, NewPassword: "new password"})
+	assert.ErrorIs(t, err, interfaces.ErrInvalidResetToken)
+	mockRepo.AssertExpectations(t)
+}
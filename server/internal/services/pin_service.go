@@ -0,0 +1,138 @@
+package services
+
+import (
+	"chatgo/server/internal/interfaces"
+	"chatgo/server/internal/models"
+	"context"
+	"fmt"
+	"time"
+)
+
+// maxPinnedMessages ограничивает число закреплённых сообщений в одном чате
+const maxPinnedMessages = 10
+
+// PinMessage закрепляет сообщение в чате. Закреплять сообщения могут только админы чата,
+// в одном чате может быть не больше maxPinnedMessages закреплённых сообщений
+func (s *service) PinMessage(c context.Context, req *interfaces.PinReq) (*interfaces.PinRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	message, err := s.checkPin(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	pinned, err := s.Repository.PinMessage(ctx, &models.PinnedMessage{
+		MessageID:  message.ID,
+		ChatRoomID: message.ChatRoomID,
+		PinnedBy:   req.UserID,
+	}, maxPinnedMessages)
+	if err != nil {
+		return nil, err
+	}
+
+	pins, err := s.getPinnedMessages(ctx, req.RoomID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Сообщение не закрепилось либо потому, что уже закреплено, либо потому, что лимит исчерпан
+	if !pinned && !isPinned(pins, message.ID) {
+		return nil, interfaces.ErrTooManyPins
+	}
+
+	return &interfaces.PinRes{MessageID: message.ID, Changed: pinned, Pins: pins}, nil
+}
+
+// UnpinMessage открепляет сообщение. Откреплять сообщения могут только админы чата
+func (s *service) UnpinMessage(c context.Context, req *interfaces.PinReq) (*interfaces.PinRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	message, err := s.checkPin(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	unpinned, err := s.Repository.UnpinMessage(ctx, message.ChatRoomID, message.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	pins, err := s.getPinnedMessages(ctx, req.RoomID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &interfaces.PinRes{MessageID: message.ID, Changed: unpinned, Pins: pins}, nil
+}
+
+// GetPinnedMessages возвращает расшифрованные закреплённые сообщения чата в порядке закрепления
+func (s *service) GetPinnedMessages(c context.Context, roomID string) ([]*interfaces.PinnedMessageRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	return s.getPinnedMessages(ctx, roomID)
+}
+
+// checkPin проверяет, что пользователь — админ чата, а сообщение принадлежит этому чату
+func (s *service) checkPin(ctx context.Context, req *interfaces.PinReq) (*models.Message, error) {
+	if err := s.checkRoomAdmin(ctx, req.UserID, req.RoomID); err != nil {
+		return nil, err
+	}
+
+	message, err := s.Repository.GetMessageByID(ctx, req.MessageID)
+	if err != nil {
+		return nil, fmt.Errorf("message %s not found", req.MessageID)
+	}
+	if message.ChatRoomID != req.RoomID {
+		return nil, fmt.Errorf("message %s belongs to another room", req.MessageID)
+	}
+	return message, nil
+}
+
+func (s *service) getPinnedMessages(ctx context.Context, roomID string) ([]*interfaces.PinnedMessageRes, error) {
+	pins, err := s.Repository.GetPinnedMessages(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := utcNow()
+	result := make([]*interfaces.PinnedMessageRes, 0, len(pins))
+	for _, pin := range pins {
+		message, err := s.Repository.GetMessageByID(ctx, pin.MessageID)
+		if err != nil {
+			return nil, err
+		}
+		// Истёкшее исчезающее сообщение остаётся закреплённым, пока его не удалят, но не показывается
+		if message.ExpiresAt.Valid && !message.ExpiresAt.Time.After(now) {
+			continue
+		}
+
+		res, err := s.toMessageRes(ctx, message)
+		if err != nil {
+			return nil, err
+		}
+		pinner, err := s.Repository.GetUserByID(ctx, pin.PinnedBy)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, &interfaces.PinnedMessageRes{
+			Message:  res,
+			PinnedBy: pinner.Username,
+			PinnedAt: pin.PinnedAt.Format(time.RFC3339),
+		})
+	}
+
+	return result, nil
+}
+
+func isPinned(pins []*interfaces.PinnedMessageRes, messageID string) bool {
+	for _, pin := range pins {
+		if pin.Message.ID == messageID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"chatgo/server/internal/interfaces"
+	"chatgo/server/internal/models"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// mockPinRoom sets up room 1 with an admin and a member, and message 10 sent to it by the member
+func mockPinRoom(mockRepo *MockRepository) {
+	mockRepo.On("GetMembersByChatRoomID", mock.Anything, "1").Return([]*models.ChatRoomMember{
+		{UserID: "admin", MemberRole: models.Admin},
+		{UserID: "member", MemberRole: models.Member},
+	}, nil)
+	mockRepo.On("GetMessageByID", mock.Anything, "10").Return(&models.Message{
+		ID: "10", SenderID: "member", ChatRoomID: "1", EncryptedContent: "ciphertext", KeyVersion: models.E2EKeyVersion,
+	}, nil)
+	mockRepo.On("GetUserByID", mock.Anything, "admin").Return(&models.User{ID: "admin", Username: "alice"}, nil)
+	mockRepo.On("GetUserByID", mock.Anything, "member").Return(&models.User{ID: "member", Username: "bob"}, nil)
+}
+
+func TestService_PinMessage(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewService(mockRepo, config, nil)
+	mockPinRoom(mockRepo)
+
+	pinnedAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	mockRepo.On("PinMessage", mock.Anything, &models.PinnedMessage{MessageID: "10", ChatRoomID: "1", PinnedBy: "admin"}, maxPinnedMessages).
+		Return(true, nil)
+	mockRepo.On("GetPinnedMessages", mock.Anything, "1").Return([]*models.PinnedMessage{
+		{MessageID: "10", ChatRoomID: "1", PinnedBy: "admin", PinnedAt: pinnedAt},
+	}, nil)
+
+	res, err := service.PinMessage(context.Background(), &interfaces.PinReq{UserID: "admin", RoomID: "1", MessageID: "10"})
+
+	assert.NoError(t, err)
+	assert.True(t, res.Changed)
+	assert.Len(t, res.Pins, 1)
+	assert.Equal(t, "10", res.Pins[0].Message.ID)
+	assert.Equal(t, "bob", res.Pins[0].Message.Username)
+	assert.Equal(t, "alice", res.Pins[0].PinnedBy)
+	assert.Equal(t, "2024-01-01T12:00:00Z", res.Pins[0].PinnedAt)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_PinMessage_Errors(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewService(mockRepo, config, nil)
+	mockPinRoom(mockRepo)
+	mockRepo.On("GetMessageByID", mock.Anything, "20").Return(&models.Message{ID: "20", ChatRoomID: "2"}, nil)
+
+	// Only admins may pin
+	_, err := service.PinMessage(context.Background(), &interfaces.PinReq{UserID: "member", RoomID: "1", MessageID: "10"})
+	assert.ErrorIs(t, err, interfaces.ErrNotRoomAdmin)
+
+	// Messages of other rooms can't be pinned
+	_, err = service.PinMessage(context.Background(), &interfaces.PinReq{UserID: "admin", RoomID: "1", MessageID: "20"})
+	assert.Error(t, err)
+
+	// The room already has the maximum number of pins and the message isn't one of them
+	mockRepo.On("PinMessage", mock.Anything, mock.Anything, maxPinnedMessages).Return(false, nil)
+	mockRepo.On("GetPinnedMessages", mock.Anything, "1").Return([]*models.PinnedMessage{}, nil)
+	_, err = service.PinMessage(context.Background(), &interfaces.PinReq{UserID: "admin", RoomID: "1", MessageID: "10"})
+	assert.ErrorIs(t, err, interfaces.ErrTooManyPins)
+}
+
+func TestService_UnpinMessage(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewService(mockRepo, config, nil)
+	mockPinRoom(mockRepo)
+
+	mockRepo.On("UnpinMessage", mock.Anything, "1", "10").Return(true, nil)
+	mockRepo.On("GetPinnedMessages", mock.Anything, "1").Return([]*models.PinnedMessage{}, nil)
+
+	res, err := service.UnpinMessage(context.Background(), &interfaces.PinReq{UserID: "admin", RoomID: "1", MessageID: "10"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, &interfaces.PinRes{MessageID: "10", Changed: true, Pins: []*interfaces.PinnedMessageRes{}}, res)
+	mockRepo.AssertCalled(t, "UnpinMessage", mock.Anything, "1", "10")
+}
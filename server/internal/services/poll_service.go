@@ -0,0 +1,316 @@
+package services
+
+import (
+	"chatgo/server/internal/interfaces"
+	"chatgo/server/internal/models"
+	"context"
+	"database/sql"
+	"log"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	minPollOptions        = 2
+	maxPollOptions        = 10
+	maxPollQuestionLength = 300
+	maxPollOptionLength   = 100
+	// maxPollDuration ограничивает, насколько далеко вперёд можно назначить закрытие опроса
+	maxPollDuration = 30 * 24 * time.Hour
+)
+
+// CreatePoll публикует в чате сообщение с опросом. Вопрос и варианты шифруются ключом чата,
+// поэтому в чатах со сквозным шифрованием опросы недоступны
+func (s *service) CreatePoll(c context.Context, req *interfaces.CreatePollReq) (*interfaces.CreateMessageRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	question, options, err := validatePoll(req.Question, req.Options)
+	if err != nil {
+		return nil, err
+	}
+	var closesAt sql.NullTime
+	if req.ClosesAt != "" {
+		t, err := time.Parse(time.RFC3339, req.ClosesAt)
+		if now := utcNow(); err != nil || !t.After(now) || t.After(now.Add(maxPollDuration)) {
+			return nil, interfaces.ErrInvalidPoll
+		}
+		closesAt = sql.NullTime{Time: t.UTC(), Valid: true}
+	}
+
+	room, err := s.Repository.GetChatRoomByID(ctx, req.RoomID)
+	if err != nil {
+		return nil, err
+	}
+	if room == nil {
+		return nil, interfaces.ErrRoomNotFound
+	}
+	if room.E2E {
+		return nil, interfaces.ErrE2ERoom
+	}
+	if err := s.checkRoomMember(ctx, req.UserID, req.RoomID); err != nil {
+		return nil, err
+	}
+	user, err := s.Repository.GetUserByID(ctx, req.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	encryptedQuestion, keyVersion, err := s.encryptContent(ctx, req.RoomID, question)
+	if err != nil {
+		return nil, err
+	}
+	encryptedOptions := make([]string, len(options))
+	for i, option := range options {
+		if encryptedOptions[i], _, err = s.encryptContent(ctx, req.RoomID, option); err != nil {
+			return nil, err
+		}
+	}
+
+	// Сообщение и опрос сохраняются вместе, чтобы в чате не осталось вопроса без опроса
+	content := "📊 " + question
+	res, err := s.createMessage(ctx, &interfaces.CreateMessageReq{
+		Content:  content,
+		RoomID:   req.RoomID,
+		Username: user.Username,
+	}, &models.Poll{
+		ChatRoomID:        req.RoomID,
+		CreatedBy:         req.UserID,
+		EncryptedQuestion: encryptedQuestion,
+		EncryptedOptions:  encryptedOptions,
+		KeyVersion:        keyVersion,
+		Multiple:          req.Multiple,
+		Anonymous:         req.Anonymous,
+		ClosesAt:          closesAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	res.Content = content
+	return res, nil
+}
+
+// validatePoll проверяет вопрос и варианты и возвращает их без лишних пробелов
+func validatePoll(question string, options []string) (string, []string, error) {
+	question = strings.TrimSpace(question)
+	if question == "" || utf8.RuneCountInString(question) > maxPollQuestionLength {
+		return "", nil, interfaces.ErrInvalidPoll
+	}
+	if len(options) < minPollOptions || len(options) > maxPollOptions {
+		return "", nil, interfaces.ErrInvalidPoll
+	}
+
+	seen := make(map[string]bool, len(options))
+	trimmed := make([]string, len(options))
+	for i, option := range options {
+		option = strings.TrimSpace(option)
+		if option == "" || utf8.RuneCountInString(option) > maxPollOptionLength || seen[strings.ToLower(option)] {
+			return "", nil, interfaces.ErrInvalidPoll
+		}
+		seen[strings.ToLower(option)] = true
+		trimmed[i] = option
+	}
+	return question, trimmed, nil
+}
+
+// GetPoll возвращает опрос с текущими результатами. Смотреть его могут только участники чата
+func (s *service) GetPoll(c context.Context, userID, pollID string) (*interfaces.PollRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	poll, err := s.getMemberPoll(ctx, userID, pollID)
+	if err != nil {
+		return nil, err
+	}
+	return s.toPollRes(ctx, poll)
+}
+
+// VotePoll заменяет голос пользователя в опросе. Варианты нумеруются с единицы, в опросе
+// с одним ответом можно выбрать только один вариант, пустой список отзывает голос
+func (s *service) VotePoll(c context.Context, req *interfaces.PollVoteReq) (*interfaces.PollRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	poll, err := s.getMemberPoll(ctx, req.UserID, req.PollID)
+	if err != nil {
+		return nil, err
+	}
+	if poll.ClosedAt.Valid {
+		return nil, interfaces.ErrPollClosed
+	}
+
+	options := make([]int, 0, len(req.Options))
+	seen := make(map[int]bool, len(req.Options))
+	for _, option := range req.Options {
+		if option < 1 || option > len(poll.EncryptedOptions) {
+			return nil, interfaces.ErrInvalidVote
+		}
+		if !seen[option] {
+			seen[option] = true
+			options = append(options, option-1)
+		}
+	}
+	if len(options) > 1 && !poll.Multiple {
+		return nil, interfaces.ErrInvalidVote
+	}
+	sort.Ints(options)
+
+	ok, err := s.Repository.SetPollVotes(ctx, poll.ID, req.UserID, options)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, interfaces.ErrPollClosed
+	}
+
+	return s.getPollRes(ctx, poll.ID)
+}
+
+// ClosePoll закрывает опрос досрочно. Закрыть его могут автор опроса и админы чата
+func (s *service) ClosePoll(c context.Context, userID, pollID string) (*interfaces.PollRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	poll, err := s.getMemberPoll(ctx, userID, pollID)
+	if err != nil {
+		return nil, err
+	}
+	if poll.CreatedBy != userID {
+		if err := s.checkRoomAdmin(ctx, userID, poll.ChatRoomID); err != nil {
+			return nil, interfaces.ErrNotPollCreator
+		}
+	}
+
+	closed, err := s.Repository.MarkPollClosed(ctx, poll.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !closed {
+		return nil, interfaces.ErrPollClosed
+	}
+
+	return s.getPollRes(ctx, poll.ID)
+}
+
+// CloseExpiredPolls закрывает опросы, время закрытия которых наступило, и возвращает их итоги
+func (s *service) CloseExpiredPolls(c context.Context) ([]*interfaces.PollRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	ids, err := s.Repository.CloseDuePolls(ctx, utcNow())
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*interfaces.PollRes, 0, len(ids))
+	for _, id := range ids {
+		res, err := s.getPollRes(ctx, id)
+		if err != nil {
+			log.Printf("Failed to get results of closed poll %s: %v", id, err)
+			continue
+		}
+		result = append(result, res)
+	}
+	return result, nil
+}
+
+// getMemberPoll возвращает опрос, если userID состоит в его чате
+func (s *service) getMemberPoll(ctx context.Context, userID, pollID string) (*models.Poll, error) {
+	poll, err := s.Repository.GetPollByID(ctx, pollID)
+	if err != nil {
+		return nil, err
+	}
+	if poll == nil {
+		return nil, interfaces.ErrPollNotFound
+	}
+	if err := s.checkRoomMember(ctx, userID, poll.ChatRoomID); err != nil {
+		return nil, err
+	}
+	return poll, nil
+}
+
+// getPollRes заново загружает опрос вместе с голосами
+func (s *service) getPollRes(ctx context.Context, pollID string) (*interfaces.PollRes, error) {
+	poll, err := s.Repository.GetPollByID(ctx, pollID)
+	if err != nil {
+		return nil, err
+	}
+	if poll == nil {
+		return nil, interfaces.ErrPollNotFound
+	}
+	return s.toPollRes(ctx, poll)
+}
+
+// getPolls возвращает опросы сообщений по ID сообщения
+func (s *service) getPolls(ctx context.Context, messageIDs []string) (map[string]*interfaces.PollRes, error) {
+	result := make(map[string]*interfaces.PollRes)
+	if len(messageIDs) == 0 {
+		return result, nil
+	}
+
+	polls, err := s.Repository.GetPollsByMessageIDs(ctx, messageIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, poll := range polls {
+		res, err := s.toPollRes(ctx, poll)
+		if err != nil {
+			return nil, err
+		}
+		result[poll.MessageID] = res
+	}
+	return result, nil
+}
+
+// toPollRes расшифровывает опрос и подсчитывает голоса. В анонимных опросах имена проголосовавших
+// не возвращаются
+func (s *service) toPollRes(ctx context.Context, poll *models.Poll) (*interfaces.PollRes, error) {
+	question, err := s.decryptContent(ctx, poll.ChatRoomID, poll.KeyVersion, poll.EncryptedQuestion)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &interfaces.PollRes{
+		ID:        poll.ID,
+		MessageID: poll.MessageID,
+		RoomID:    poll.ChatRoomID,
+		Question:  question,
+		Options:   make([]*interfaces.PollOptionRes, len(poll.EncryptedOptions)),
+		Multiple:  poll.Multiple,
+		Anonymous: poll.Anonymous,
+		Closed:    poll.ClosedAt.Valid,
+	}
+	for i, encrypted := range poll.EncryptedOptions {
+		text, err := s.decryptContent(ctx, poll.ChatRoomID, poll.KeyVersion, encrypted)
+		if err != nil {
+			return nil, err
+		}
+		res.Options[i] = &interfaces.PollOptionRes{Text: text}
+	}
+
+	voters := make(map[string]bool)
+	for _, vote := range poll.Votes {
+		if vote.Option < 0 || vote.Option >= len(res.Options) {
+			continue
+		}
+		voters[vote.UserID] = true
+		option := res.Options[vote.Option]
+		option.Votes++
+		if !poll.Anonymous {
+			option.Voters = append(option.Voters, vote.Username)
+		}
+	}
+	res.Voters = len(voters)
+
+	if poll.ClosesAt.Valid {
+		closesAt := poll.ClosesAt.Time
+		res.ClosesAt = &closesAt
+	}
+	if poll.ClosedAt.Valid {
+		closedAt := poll.ClosedAt.Time
+		res.ClosedAt = &closedAt
+	}
+	return res, nil
+}
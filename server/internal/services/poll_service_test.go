@@ -0,0 +1,253 @@
+package services
+
+import (
+	"chatgo/server/internal/interfaces"
+	"chatgo/server/internal/models"
+	"chatgo/server/internal/util"
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// testPoll returns an open poll in room1 created by user1, encrypted with testDataKey
+func testPoll(t *testing.T, question string, options ...string) *models.Poll {
+	encryptedQuestion, err := util.EncryptMessage(question, testDataKey)
+	assert.NoError(t, err)
+	encryptedOptions := make([]string, len(options))
+	for i, option := range options {
+		encryptedOptions[i], err = util.EncryptMessage(option, testDataKey)
+		assert.NoError(t, err)
+	}
+	return &models.Poll{
+		ID:                "3",
+		MessageID:         "10",
+		ChatRoomID:        "room1",
+		CreatedBy:         "user1",
+		EncryptedQuestion: encryptedQuestion,
+		EncryptedOptions:  encryptedOptions,
+		KeyVersion:        1,
+	}
+}
+
+func TestService_CreatePoll(t *testing.T) {
+	mockRepo := new(MockRepository)
+	mockRoomKeys(mockRepo)
+	service := NewService(mockRepo, config, nil)
+
+	user := &models.User{ID: "user1", Username: "alice"}
+	mockRepo.On("GetChatRoomByID", mock.Anything, "room1").Return(&models.ChatRoom{ID: "room1"}, nil)
+	mockRepo.On("GetChatRoomByID", mock.Anything, "room2").Return(&models.ChatRoom{ID: "room2", E2E: true}, nil)
+	mockRepo.On("GetMembersByChatRoomID", mock.Anything, "room1").Return([]*models.ChatRoomMember{{UserID: "user1", MemberRole: models.Member}}, nil)
+	mockRepo.On("GetUserByID", mock.Anything, "user1").Return(user, nil)
+	mockRepo.On("GetUserByUsername", mock.Anything, "alice").Return(user, nil)
+	closesAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	created := testPoll(t, "Lunch?", "Pizza", "Sushi")
+	created.Multiple = true
+	created.ClosesAt = sql.NullTime{Time: closesAt, Valid: true}
+	var stored *models.Poll
+	mockRepo.On("CreatePoll", mock.Anything, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		stored = args.Get(2).(*models.Poll)
+		stored.MessageID = "10"
+	}).Return(&models.Message{
+		ID: "10", SenderID: "user1", ChatRoomID: "room1", CreatedAt: time.Now(),
+	}, created, nil).Once()
+
+	res, err := service.CreatePoll(context.Background(), &interfaces.CreatePollReq{
+		UserID:   "user1",
+		RoomID:   "room1",
+		Question: " Lunch? ",
+		Options:  []string{"Pizza", " Sushi "},
+		Multiple: true,
+		ClosesAt: closesAt.Format(time.RFC3339),
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "📊 Lunch?", res.Content)
+	assert.Equal(t, "3", res.Poll.ID)
+	assert.Equal(t, "Lunch?", res.Poll.Question)
+	assert.Equal(t, "Sushi", res.Poll.Options[1].Text)
+	assert.True(t, res.Poll.Multiple)
+	assert.Equal(t, closesAt, *res.Poll.ClosesAt)
+	// The question and options are stored encrypted and trimmed
+	assert.Equal(t, "10", stored.MessageID)
+	assert.Equal(t, closesAt, stored.ClosesAt.Time)
+	assert.NotContains(t, stored.EncryptedQuestion, "Lunch")
+	option, err := util.DecryptMessage(stored.EncryptedOptions[1], testDataKey)
+	assert.NoError(t, err)
+	assert.Equal(t, "Sushi", option)
+
+	testCases := []struct {
+		name string
+		req  *interfaces.CreatePollReq
+		err  error
+	}{
+		{
+			name: "One option",
+			req:  &interfaces.CreatePollReq{UserID: "user1", RoomID: "room1", Question: "Lunch?", Options: []string{"Pizza"}},
+			err:  interfaces.ErrInvalidPoll,
+		},
+		{
+			name: "Duplicate options",
+			req:  &interfaces.CreatePollReq{UserID: "user1", RoomID: "room1", Question: "Lunch?", Options: []string{"Pizza", "pizza"}},
+			err:  interfaces.ErrInvalidPoll,
+		},
+		{
+			name: "Closing time in the past",
+			req: &interfaces.CreatePollReq{UserID: "user1", RoomID: "room1", Question: "Lunch?", Options: []string{"Pizza", "Sushi"},
+				ClosesAt: time.Now().Add(-time.Minute).Format(time.RFC3339)},
+			err: interfaces.ErrInvalidPoll,
+		},
+		{
+			name: "End-to-end encrypted room",
+			req:  &interfaces.CreatePollReq{UserID: "user1", RoomID: "room2", Question: "Lunch?", Options: []string{"Pizza", "Sushi"}},
+			err:  interfaces.ErrE2ERoom,
+		},
+		{
+			name: "Not a member",
+			req:  &interfaces.CreatePollReq{UserID: "user2", RoomID: "room1", Question: "Lunch?", Options: []string{"Pizza", "Sushi"}},
+			err:  interfaces.ErrNotRoomMember,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := service.CreatePoll(context.Background(), tc.req)
+			assert.ErrorIs(t, err, tc.err)
+		})
+	}
+	mockRepo.AssertNumberOfCalls(t, "CreatePoll", 1)
+
+	// The message and the poll are stored in one transaction, a failed poll leaves no message behind
+	mockRepo.On("CreatePoll", mock.Anything, mock.Anything, mock.Anything).Return(nil, nil, sql.ErrConnDone).Once()
+	_, err = service.CreatePoll(context.Background(), &interfaces.CreatePollReq{
+		UserID: "user1", RoomID: "room1", Question: "Lunch?", Options: []string{"Pizza", "Sushi"},
+	})
+	assert.ErrorIs(t, err, sql.ErrConnDone)
+	mockRepo.AssertNotCalled(t, "CreateMessage", mock.Anything, mock.Anything)
+}
+
+func TestService_VotePoll(t *testing.T) {
+	mockRepo := new(MockRepository)
+	mockRoomKeys(mockRepo)
+	service := NewService(mockRepo, config, nil)
+
+	poll := testPoll(t, "Lunch?", "Pizza", "Sushi", "Tacos")
+	voted := testPoll(t, "Lunch?", "Pizza", "Sushi", "Tacos")
+	voted.Votes = []*models.PollVote{
+		{PollID: "3", UserID: "user1", Username: "alice", Option: 2},
+		{PollID: "3", UserID: "user2", Username: "bob", Option: 2},
+	}
+	closed := testPoll(t, "Lunch?", "Pizza", "Sushi")
+	closed.ID = "4"
+	closed.ClosedAt = sql.NullTime{Time: time.Now(), Valid: true}
+
+	mockRepo.On("GetPollByID", mock.Anything, "3").Return(poll, nil).Once()
+	mockRepo.On("GetPollByID", mock.Anything, "3").Return(voted, nil).Once()
+	mockRepo.On("GetPollByID", mock.Anything, "3").Return(poll, nil)
+	mockRepo.On("GetPollByID", mock.Anything, "4").Return(closed, nil)
+	mockRepo.On("GetPollByID", mock.Anything, "5").Return(nil, nil)
+	mockRepo.On("GetMembersByChatRoomID", mock.Anything, "room1").Return([]*models.ChatRoomMember{{UserID: "user1", MemberRole: models.Member}}, nil)
+	mockRepo.On("SetPollVotes", mock.Anything, "3", "user1", []int{2}).Return(true, nil)
+
+	// Options are numbered from 1 and repeated options count once
+	res, err := service.VotePoll(context.Background(), &interfaces.PollVoteReq{UserID: "user1", PollID: "3", Options: []int{3, 3}})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, res.Voters)
+	assert.Equal(t, 2, res.Options[2].Votes)
+	assert.Equal(t, []string{"alice", "bob"}, res.Options[2].Voters)
+
+	testCases := []struct {
+		name string
+		req  *interfaces.PollVoteReq
+		err  error
+	}{
+		{
+			name: "Two options in a single choice poll",
+			req:  &interfaces.PollVoteReq{UserID: "user1", PollID: "3", Options: []int{1, 2}},
+			err:  interfaces.ErrInvalidVote,
+		},
+		{
+			name: "Option out of range",
+			req:  &interfaces.PollVoteReq{UserID: "user1", PollID: "3", Options: []int{4}},
+			err:  interfaces.ErrInvalidVote,
+		},
+		{
+			name: "Closed poll",
+			req:  &interfaces.PollVoteReq{UserID: "user1", PollID: "4", Options: []int{1}},
+			err:  interfaces.ErrPollClosed,
+		},
+		{
+			name: "Not a member",
+			req:  &interfaces.PollVoteReq{UserID: "user2", PollID: "3", Options: []int{1}},
+			err:  interfaces.ErrNotRoomMember,
+		},
+		{
+			name: "Unknown poll",
+			req:  &interfaces.PollVoteReq{UserID: "user1", PollID: "5", Options: []int{1}},
+			err:  interfaces.ErrPollNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := service.VotePoll(context.Background(), tc.req)
+			assert.ErrorIs(t, err, tc.err)
+		})
+	}
+	mockRepo.AssertNumberOfCalls(t, "SetPollVotes", 1)
+}
+
+func TestService_ClosePoll(t *testing.T) {
+	mockRepo := new(MockRepository)
+	mockRoomKeys(mockRepo)
+	service := NewService(mockRepo, config, nil)
+
+	poll := testPoll(t, "Lunch?", "Pizza", "Sushi")
+	mockRepo.On("GetPollByID", mock.Anything, "3").Return(poll, nil)
+	mockRepo.On("GetMembersByChatRoomID", mock.Anything, "room1").Return([]*models.ChatRoomMember{
+		{UserID: "user1", MemberRole: models.Member},
+		{UserID: "user2", MemberRole: models.Member},
+		{UserID: "user3", MemberRole: models.Admin},
+	}, nil)
+	mockRepo.On("MarkPollClosed", mock.Anything, "3").Return(true, nil).Once()
+	mockRepo.On("MarkPollClosed", mock.Anything, "3").Return(false, nil)
+
+	_, err := service.ClosePoll(context.Background(), "user2", "3")
+	assert.ErrorIs(t, err, interfaces.ErrNotPollCreator)
+
+	// Room admins may close any poll
+	_, err = service.ClosePoll(context.Background(), "user3", "3")
+	assert.NoError(t, err)
+
+	_, err = service.ClosePoll(context.Background(), "user1", "3")
+	assert.ErrorIs(t, err, interfaces.ErrPollClosed)
+	mockRepo.AssertNumberOfCalls(t, "MarkPollClosed", 2)
+}
+
+func TestService_CloseExpiredPolls(t *testing.T) {
+	// closes_at is stored in UTC, so it is compared with UTC whatever the server's zone
+	withLocalZone(t)
+	mockRepo := new(MockRepository)
+	mockRoomKeys(mockRepo)
+	service := NewService(mockRepo, config, nil)
+
+	poll := testPoll(t, "Lunch?", "Pizza", "Sushi")
+	poll.Anonymous = true
+	poll.ClosedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	poll.Votes = []*models.PollVote{{PollID: "3", UserID: "user1", Username: "alice", Option: 0}}
+	mockRepo.On("CloseDuePolls", mock.Anything, mock.MatchedBy(isUTC)).Return([]string{"3"}, nil)
+	mockRepo.On("GetPollByID", mock.Anything, "3").Return(poll, nil)
+
+	res, err := service.CloseExpiredPolls(context.Background())
+
+	assert.NoError(t, err)
+	assert.Len(t, res, 1)
+	assert.True(t, res[0].Closed)
+	assert.Equal(t, 1, res[0].Options[0].Votes)
+	// Anonymous polls do not reveal who voted
+	assert.Empty(t, res[0].Options[0].Voters)
+}
@@ -0,0 +1,30 @@
+package services
+
+import (
+	"chatgo/server/internal/models"
+	"context"
+	"fmt"
+)
+
+// SetUserStatus сохраняет статус присутствия пользователя. Статус banned нельзя установить
+// или снять через присутствие
+func (s *service) SetUserStatus(c context.Context, userID string, status string) error {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	switch status {
+	case models.Online, models.Offline, models.Away:
+	default:
+		return fmt.Errorf("invalid status %q", status)
+	}
+
+	updated, err := s.Repository.UpdateUserStatus(ctx, userID, models.UserStatus(status))
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return fmt.Errorf("status of user %s can't be changed", userID)
+	}
+
+	return nil
+}
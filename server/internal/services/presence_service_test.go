@@ -0,0 +1,58 @@
+package services
+
+import (
+	"chatgo/server/internal/models"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestService_SetUserStatus(t *testing.T) {
+	testCases := []struct {
+		name        string
+		status      string
+		mockSetup   func(mockRepo *MockRepository)
+		expectError bool
+	}{
+		{
+			name:   "Away",
+			status: models.Away,
+			mockSetup: func(mockRepo *MockRepository) {
+				mockRepo.On("UpdateUserStatus", mock.Anything, "user1", models.UserStatus(models.Away)).Return(true, nil)
+			},
+		},
+		{
+			name:   "Banned user",
+			status: models.Online,
+			mockSetup: func(mockRepo *MockRepository) {
+				mockRepo.On("UpdateUserStatus", mock.Anything, "user1", models.UserStatus(models.Online)).Return(false, nil)
+			},
+			expectError: true,
+		},
+		{
+			name:        "Banned is not a presence status",
+			status:      models.Banned,
+			mockSetup:   func(mockRepo *MockRepository) {},
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockRepo := new(MockRepository)
+			service := NewService(mockRepo, config, nil)
+			tc.mockSetup(mockRepo)
+
+			err := service.SetUserStatus(context.Background(), "user1", tc.status)
+
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
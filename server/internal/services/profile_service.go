@@ -0,0 +1,228 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	_ "time/tzdata" // часовые пояса профилей не должны зависеть от tzdata в системе
+	"unicode"
+	"unicode/utf8"
+
+	"chatgo/server/internal/interfaces"
+	"chatgo/server/internal/models"
+	"chatgo/server/internal/util"
+)
+
+const (
+	minUsernameLength    = 3
+	maxUsernameLength    = 32
+	maxDisplayNameLength = 64
+	maxBioLength         = 500
+	maxStatusTextLength  = 100
+)
+
+// usernamePattern допускает латинские буквы, цифры и '_', '.', '-' внутри имени, так что
+// имя целиком попадает в упоминание @username
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9_.-]*[A-Za-z0-9])?$`)
+
+// reservedUsernames — имена, которые можно спутать с сервером, его администрацией или
+// особыми упоминаниями. Их нельзя занять при регистрации
+var reservedUsernames = map[string]struct{}{
+	"admin":          {},
+	"administrator":  {},
+	"root":           {},
+	"system":         {},
+	"server":         {},
+	"chatgo":         {},
+	"moderator":      {},
+	"support":        {},
+	"help":           {},
+	"bot":            {},
+	"me":             {},
+	"all":            {},
+	"everyone":       {},
+	"here":           {},
+	"default":        {},
+	"anonymous":      {},
+	"null":           {},
+	util.RoomMention: {},
+}
+
+// validateUsername проверяет имя нового пользователя или бота
+func (s *service) validateUsername(username string) error {
+	if n := len(username); n < minUsernameLength || n > maxUsernameLength {
+		return fmt.Errorf("%w: it must be %d to %d characters long", interfaces.ErrInvalidUsername, minUsernameLength, maxUsernameLength)
+	}
+	if !usernamePattern.MatchString(username) {
+		return fmt.Errorf("%w: use latin letters, digits, '_', '.' and '-', starting and ending with a letter or digit", interfaces.ErrInvalidUsername)
+	}
+	if _, ok := reservedUsernames[strings.ToLower(username)]; ok {
+		return fmt.Errorf("%w: %q is reserved", interfaces.ErrInvalidUsername, username)
+	}
+	return nil
+}
+
+// checkUsernameAvailable возвращает ErrUsernameTaken, если имя уже занято без учёта регистра.
+// Одновременную регистрацию одного имени отсекает уникальный индекс в базе
+func (s *service) checkUsernameAvailable(ctx context.Context, username string) error {
+	user, err := s.Repository.GetUserByUsername(ctx, username)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && user == nil) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return interfaces.ErrUsernameTaken
+}
+
+// GetProfile возвращает профиль пользователя username
+func (s *service) GetProfile(c context.Context, username string) (*interfaces.UserProfileRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	user, err := s.getUserByUsername(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	return toProfileRes(user), nil
+}
+
+// UpdateProfile меняет заданные поля профиля пользователя. Аватаром может быть только
+// картинка, которую пользователь загрузил сам
+func (s *service) UpdateProfile(c context.Context, req *interfaces.UpdateProfileReq) (*interfaces.UserProfileRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	user, err := s.Repository.GetUserByID(ctx, req.UserID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && user == nil) {
+		return nil, interfaces.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if req.DisplayName != nil {
+		if user.DisplayName, err = cleanProfileText("display name", *req.DisplayName, maxDisplayNameLength, false); err != nil {
+			return nil, err
+		}
+	}
+	if req.Bio != nil {
+		if user.Bio, err = cleanProfileText("bio", *req.Bio, maxBioLength, true); err != nil {
+			return nil, err
+		}
+	}
+	if req.StatusText != nil {
+		if user.StatusText, err = cleanProfileText("status text", *req.StatusText, maxStatusTextLength, false); err != nil {
+			return nil, err
+		}
+	}
+	if req.Timezone != nil {
+		timezone := strings.TrimSpace(*req.Timezone)
+		if timezone != "" {
+			// Local — это часовой пояс сервера, а не пользователя
+			if _, err := time.LoadLocation(timezone); err != nil || timezone == "Local" {
+				return nil, fmt.Errorf("%w: unknown time zone %q, use a name like Europe/Berlin", interfaces.ErrInvalidProfile, timezone)
+			}
+		}
+		user.Timezone = timezone
+	}
+	if req.AvatarID != nil {
+		avatarID := strings.TrimSpace(*req.AvatarID)
+		if avatarID != "" {
+			if err := s.checkAvatar(ctx, user.ID, avatarID); err != nil {
+				return nil, err
+			}
+		}
+		user.AvatarID = sql.NullString{String: avatarID, Valid: avatarID != ""}
+	}
+
+	if err := s.Repository.UpdateUserProfile(ctx, user); err != nil {
+		return nil, err
+	}
+	return toProfileRes(user), nil
+}
+
+// checkAvatar проверяет, что вложение attachmentID — картинка, загруженная пользователем userID
+func (s *service) checkAvatar(ctx context.Context, userID, attachmentID string) error {
+	attachment, err := s.Repository.GetAttachmentByID(ctx, attachmentID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && attachment == nil) {
+		return fmt.Errorf("%w: avatar attachment not found", interfaces.ErrInvalidProfile)
+	}
+	if err != nil {
+		return err
+	}
+	if attachment.UploaderID != userID || !strings.HasPrefix(attachment.ContentType, "image/") {
+		return fmt.Errorf("%w: the avatar must be an image you uploaded", interfaces.ErrInvalidProfile)
+	}
+	return nil
+}
+
+// isAvatar сообщает, служит ли вложение аватаром загрузившего его пользователя
+func (s *service) isAvatar(ctx context.Context, attachment *models.Attachment) bool {
+	uploader, err := s.Repository.GetUserByID(ctx, attachment.UploaderID)
+	if err != nil || uploader == nil {
+		return false
+	}
+	return uploader.AvatarID.Valid && uploader.AvatarID.String == attachment.ID
+}
+
+// GetUsersByIDs возвращает пользователей с указанными ID для списков участников
+func (s *service) GetUsersByIDs(c context.Context, ids []string) ([]*interfaces.GetUserRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	users, err := s.Repository.GetUsersByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*interfaces.GetUserRes, 0, len(users))
+	for _, u := range users {
+		result = append(result, toUserRes(u))
+	}
+	return result, nil
+}
+
+// cleanProfileText обрезает пробелы по краям текстового поля профиля и проверяет его длину.
+// Управляющие символы запрещены, кроме переводов строки в многострочных полях
+func cleanProfileText(field, value string, maxLength int, multiline bool) (string, error) {
+	value = strings.TrimSpace(value)
+	if utf8.RuneCountInString(value) > maxLength {
+		return "", fmt.Errorf("%w: %s must be at most %d characters long", interfaces.ErrInvalidProfile, field, maxLength)
+	}
+	control := strings.IndexFunc(value, func(r rune) bool {
+		return unicode.IsControl(r) && (!multiline || r != '\n')
+	})
+	if !utf8.ValidString(value) || control >= 0 {
+		return "", fmt.Errorf("%w: %s must be text without control characters", interfaces.ErrInvalidProfile, field)
+	}
+	return value, nil
+}
+
+// toProfileRes преобразует пользователя в его публичный профиль
+func toProfileRes(u *models.User) *interfaces.UserProfileRes {
+	res := &interfaces.UserProfileRes{
+		ID:          u.ID,
+		Username:    u.Username,
+		DisplayName: u.DisplayName,
+		Bio:         u.Bio,
+		AvatarID:    u.AvatarID.String,
+		Timezone:    u.Timezone,
+		Status:      string(u.Status),
+		StatusText:  u.StatusText,
+		IsBot:       u.IsBot,
+		CreatedAt:   u.CreatedAt,
+	}
+	if u.LastSeenAt.Valid {
+		res.LastSeenAt = u.LastSeenAt.Time.Format(time.RFC3339)
+	}
+	return res
+}
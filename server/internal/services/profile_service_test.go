@@ -0,0 +1,165 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+
+	"chatgo/server/internal/interfaces"
+	"chatgo/server/internal/models"
+	"chatgo/server/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_validateUsername(t *testing.T) {
+	// Reserved names stay reserved even when a server admin is configured
+	cfg := *config
+	cfg.Admins = []string{"1"}
+	s := NewService(new(MockRepository), &cfg, nil).(*service)
+
+	for _, username := range []string{"alice", "bob_smith", "j.doe-2", "A1b", strings.Repeat("a", 32)} {
+		assert.NoError(t, s.validateUsername(username), username)
+	}
+	for _, username := range []string{"", "ab", strings.Repeat("a", 33), "al ice", "_alice", "alice.", "алиса", "al@ce", "admin", "root", "Root", "Room", "me"} {
+		assert.ErrorIs(t, s.validateUsername(username), interfaces.ErrInvalidUsername, username)
+	}
+}
+
+func TestService_CreateUser_Username(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewService(mockRepo, config, nil)
+
+	_, err := service.CreateUser(context.Background(), &interfaces.CreateUserReq{Username: "admin", Password: "password123"})
+	assert.ErrorIs(t, err, interfaces.ErrInvalidUsername)
+
+	// Usernames are unique regardless of case
+	mockRepo.On("GetUserByUsername", mock.Anything, "Alice").Return(&models.User{ID: "1", Username: "alice"}, nil)
+	_, err = service.CreateUser(context.Background(), &interfaces.CreateUserReq{Username: "Alice", Password: "password123"})
+	assert.ErrorIs(t, err, interfaces.ErrUsernameTaken)
+
+	mockRepo.AssertNotCalled(t, "CreateUser", mock.Anything, mock.Anything)
+}
+
+func TestService_GetProfile(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewService(mockRepo, config, nil)
+
+	mockRepo.On("GetUserByUsername", mock.Anything, "alice").Return(&models.User{
+		ID:          "1",
+		Username:    "alice",
+		DisplayName: "Alice Liddell",
+		AvatarID:    sql.NullString{String: "7", Valid: true},
+		Timezone:    "Europe/London",
+		Status:      models.UserStatus(models.Away),
+	}, nil)
+	mockRepo.On("GetUserByUsername", mock.Anything, "nobody").Return(nil, sql.ErrNoRows)
+
+	res, err := service.GetProfile(context.Background(), "alice")
+	require.NoError(t, err)
+	assert.Equal(t, "Alice Liddell", res.DisplayName)
+	assert.Equal(t, "7", res.AvatarID)
+	assert.Equal(t, "Europe/London", res.Timezone)
+	assert.Equal(t, "away", res.Status)
+
+	_, err = service.GetProfile(context.Background(), "nobody")
+	assert.ErrorIs(t, err, interfaces.ErrUserNotFound)
+}
+
+func TestService_UpdateProfile(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewService(mockRepo, config, nil)
+
+	mockRepo.On("GetUserByID", mock.Anything, "1").Return(&models.User{ID: "1", Username: "alice", Bio: "Curious", Timezone: "UTC"}, nil)
+	mockRepo.On("GetAttachmentByID", mock.Anything, "7").Return(&models.Attachment{ID: "7", UploaderID: "1", ContentType: "image/png"}, nil)
+	mockRepo.On("GetAttachmentByID", mock.Anything, "8").Return(&models.Attachment{ID: "8", UploaderID: "1", ContentType: "text/plain"}, nil)
+	mockRepo.On("GetAttachmentByID", mock.Anything, "9").Return(&models.Attachment{ID: "9", UploaderID: "2", ContentType: "image/png"}, nil)
+	mockRepo.On("GetAttachmentByID", mock.Anything, "10").Return(nil, sql.ErrNoRows)
+	mockRepo.On("UpdateUserProfile", mock.Anything, mock.MatchedBy(func(u *models.User) bool {
+		// Fields that are not in the request keep their values
+		return u.DisplayName == "Alice Liddell" && u.Bio == "Curious" && u.Timezone == "Europe/Berlin" &&
+			u.AvatarID == sql.NullString{String: "7", Valid: true} && u.StatusText == "on holiday"
+	})).Return(nil).Once()
+
+	name, timezone, avatar, status := "  Alice Liddell ", "Europe/Berlin", "7", "on holiday"
+	res, err := service.UpdateProfile(context.Background(), &interfaces.UpdateProfileReq{
+		UserID: "1", DisplayName: &name, Timezone: &timezone, AvatarID: &avatar, StatusText: &status,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Alice Liddell", res.DisplayName)
+	assert.Equal(t, "Curious", res.Bio)
+
+	invalid := func(req *interfaces.UpdateProfileReq) {
+		t.Helper()
+		req.UserID = "1"
+		_, err := service.UpdateProfile(context.Background(), req)
+		assert.ErrorIs(t, err, interfaces.ErrInvalidProfile)
+	}
+	long, control, unknownZone, local := strings.Repeat("a", 65), "Alice\x1b[31m", "Mars/Olympus", "Local"
+	invalid(&interfaces.UpdateProfileReq{DisplayName: &long})
+	invalid(&interfaces.UpdateProfileReq{DisplayName: &control})
+	invalid(&interfaces.UpdateProfileReq{Timezone: &unknownZone})
+	invalid(&interfaces.UpdateProfileReq{Timezone: &local})
+	for _, id := range []string{"8", "9", "10"} {
+		invalid(&interfaces.UpdateProfileReq{AvatarID: &id})
+	}
+
+	// An empty value clears the field, a bio may span lines
+	mockRepo.On("UpdateUserProfile", mock.Anything, mock.MatchedBy(func(u *models.User) bool {
+		return u.Timezone == "" && !u.AvatarID.Valid && u.Bio == "Curious\nand curiouser"
+	})).Return(nil).Once()
+	empty, bio := "", "Curious\nand curiouser"
+	_, err = service.UpdateProfile(context.Background(), &interfaces.UpdateProfileReq{UserID: "1", Timezone: &empty, AvatarID: &empty, Bio: &bio})
+	require.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_DownloadAttachment_Avatar(t *testing.T) {
+	mockRepo := new(MockRepository)
+	mockRoomKeys(mockRepo)
+	blobs, err := storage.NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+	service := NewService(mockRepo, config, blobs)
+
+	mockRepo.On("GetMembersByChatRoomID", mock.Anything, "room1").Return([]*models.ChatRoomMember{{UserID: "user1"}}, nil)
+	mockRepo.On("GetChatRoomByID", mock.Anything, "room1").Return(&models.ChatRoom{ID: "room1"}, nil)
+	created := &models.Attachment{}
+	mockRepo.On("CreateAttachment", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		*created = *args.Get(1).(*models.Attachment)
+		created.ID = "7"
+	}).Return(created, nil)
+
+	_, err = service.UploadAttachment(context.Background(), &interfaces.UploadAttachmentReq{
+		UserID: "user1", RoomID: "room1", Filename: "me.png", Data: []byte("\x89PNG\r\n\x1a\n"),
+	})
+	require.NoError(t, err)
+
+	// Anyone can download an avatar, not only the members of the room it was uploaded to
+	mockRepo.On("GetAttachmentByID", mock.Anything, "7").Return(created, nil)
+	mockRepo.On("GetUserByID", mock.Anything, "user1").Return(&models.User{ID: "user1", AvatarID: sql.NullString{String: "7", Valid: true}}, nil)
+	res, err := service.DownloadAttachment(context.Background(), "user2", "7")
+	require.NoError(t, err)
+	assert.Equal(t, "me.png", res.Filename)
+}
+
+func TestService_GetUsersByIDs(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewService(mockRepo, config, nil)
+
+	mockRepo.On("GetUsersByIDs", mock.Anything, []string{"1", "2"}).Return([]*models.User{
+		{ID: "1", Username: "alice", DisplayName: "Alice Liddell", StatusText: "reading"},
+	}, nil)
+
+	users, err := service.GetUsersByIDs(context.Background(), []string{"1", "2"})
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	assert.Equal(t, "Alice Liddell", users[0].DisplayName)
+	assert.Equal(t, "reading", users[0].StatusText)
+
+	users, err = service.GetUsersByIDs(context.Background(), nil)
+	assert.NoError(t, err)
+	assert.Empty(t, users)
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"chatgo/server/internal/interfaces"
+	"chatgo/server/internal/models"
+	"chatgo/server/internal/util"
+	"context"
+	"fmt"
+)
+
+// AddReaction добавляет реакцию пользователя на сообщение. Каждый пользователь может поставить
+// каждый эмодзи на сообщение только один раз
+func (s *service) AddReaction(c context.Context, req *interfaces.ReactionReq) (*interfaces.ReactionRes, error) {
+	return s.changeReaction(c, req, s.Repository.AddReaction)
+}
+
+// RemoveReaction удаляет реакцию пользователя на сообщение
+func (s *service) RemoveReaction(c context.Context, req *interfaces.ReactionReq) (*interfaces.ReactionRes, error) {
+	return s.changeReaction(c, req, s.Repository.DeleteReaction)
+}
+
+func (s *service) changeReaction(
+	c context.Context,
+	req *interfaces.ReactionReq,
+	change func(ctx context.Context, reaction *models.Reaction) (bool, error),
+) (*interfaces.ReactionRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	emoji, err := util.NormalizeEmoji(req.Emoji)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.Repository.GetUserByUsername(ctx, req.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	message, err := s.Repository.GetMessageByID(ctx, req.MessageID)
+	if err != nil {
+		return nil, fmt.Errorf("message %s not found", req.MessageID)
+	}
+	if message.ChatRoomID != req.RoomID {
+		return nil, fmt.Errorf("message %s belongs to another room", req.MessageID)
+	}
+
+	changed, err := change(ctx, &models.Reaction{
+		MessageID: message.ID,
+		UserID:    user.ID,
+		Emoji:     emoji,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	reactions, err := s.getReactions(ctx, []string{message.ID})
+	if err != nil {
+		return nil, err
+	}
+
+	return &interfaces.ReactionRes{
+		MessageID: message.ID,
+		Emoji:     emoji,
+		Changed:   changed,
+		Reactions: reactions[message.ID],
+	}, nil
+}
+
+// getReactions возвращает агрегированные реакции, сгруппированные по ID сообщения
+func (s *service) getReactions(ctx context.Context, messageIDs []string) (map[string][]*interfaces.ReactionCountRes, error) {
+	result := make(map[string][]*interfaces.ReactionCountRes)
+	if len(messageIDs) == 0 {
+		return result, nil
+	}
+
+	counts, err := s.Repository.GetReactionCountsByMessageIDs(ctx, messageIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, count := range counts {
+		result[count.MessageID] = append(result[count.MessageID], &interfaces.ReactionCountRes{
+			Emoji: count.Emoji,
+			Count: count.Count,
+		})
+	}
+
+	return result, nil
+}
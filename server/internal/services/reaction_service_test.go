@@ -0,0 +1,97 @@
+package services
+
+import (
+	"chatgo/server/internal/interfaces"
+	"chatgo/server/internal/models"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestService_AddReaction(t *testing.T) {
+	testCases := []struct {
+		name        string
+		req         *interfaces.ReactionReq
+		mockSetup   func(mockRepo *MockRepository)
+		expectError bool
+		checkResult func(t *testing.T, result *interfaces.ReactionRes)
+	}{
+		{
+			name: "Shortcode is stored as emoji",
+			req:  &interfaces.ReactionReq{MessageID: "msg1", RoomID: "room1", Username: "alice", Emoji: ":thumbsup:"},
+			mockSetup: func(mockRepo *MockRepository) {
+				mockRepo.On("GetUserByUsername", mock.Anything, "alice").Return(&models.User{ID: "user1", Username: "alice"}, nil)
+				mockRepo.On("GetMessageByID", mock.Anything, "msg1").Return(&models.Message{ID: "msg1", ChatRoomID: "room1"}, nil)
+				mockRepo.On("AddReaction", mock.Anything, &models.Reaction{MessageID: "msg1", UserID: "user1", Emoji: "👍"}).Return(true, nil)
+				mockRepo.On("GetReactionCountsByMessageIDs", mock.Anything, []string{"msg1"}).Return([]*models.ReactionCount{
+					{MessageID: "msg1", Emoji: "👍", Count: 2},
+				}, nil)
+			},
+			checkResult: func(t *testing.T, result *interfaces.ReactionRes) {
+				assert.True(t, result.Changed)
+				assert.Equal(t, "👍", result.Emoji)
+				assert.Equal(t, []*interfaces.ReactionCountRes{{Emoji: "👍", Count: 2}}, result.Reactions)
+			},
+		},
+		{
+			name: "Invalid emoji",
+			req:  &interfaces.ReactionReq{MessageID: "msg1", RoomID: "room1", Username: "alice", Emoji: "hello"},
+			mockSetup: func(mockRepo *MockRepository) {
+			},
+			expectError: true,
+		},
+		{
+			name: "Message from another room",
+			req:  &interfaces.ReactionReq{MessageID: "msg1", RoomID: "room2", Username: "alice", Emoji: "🎉"},
+			mockSetup: func(mockRepo *MockRepository) {
+				mockRepo.On("GetUserByUsername", mock.Anything, "alice").Return(&models.User{ID: "user1", Username: "alice"}, nil)
+				mockRepo.On("GetMessageByID", mock.Anything, "msg1").Return(&models.Message{ID: "msg1", ChatRoomID: "room1"}, nil)
+			},
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockRepo := new(MockRepository)
+			service := NewService(mockRepo, config, nil)
+			tc.mockSetup(mockRepo)
+
+			result, err := service.AddReaction(context.Background(), tc.req)
+
+			if tc.expectError {
+				assert.Error(t, err)
+				assert.Nil(t, result)
+				mockRepo.AssertNotCalled(t, "AddReaction", mock.Anything, mock.Anything)
+			} else {
+				assert.NoError(t, err)
+				tc.checkResult(t, result)
+			}
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestService_RemoveReaction(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewService(mockRepo, config, nil)
+
+	mockRepo.On("GetUserByUsername", mock.Anything, "alice").Return(&models.User{ID: "user1", Username: "alice"}, nil)
+	mockRepo.On("GetMessageByID", mock.Anything, "msg1").Return(&models.Message{ID: "msg1", ChatRoomID: "room1"}, nil)
+	mockRepo.On("DeleteReaction", mock.Anything, &models.Reaction{MessageID: "msg1", UserID: "user1", Emoji: "🎉"}).Return(true, nil)
+	mockRepo.On("GetReactionCountsByMessageIDs", mock.Anything, []string{"msg1"}).Return([]*models.ReactionCount{}, nil)
+
+	result, err := service.RemoveReaction(context.Background(), &interfaces.ReactionReq{
+		MessageID: "msg1",
+		RoomID:    "room1",
+		Username:  "alice",
+		Emoji:     "🎉",
+	})
+
+	assert.NoError(t, err)
+	assert.True(t, result.Changed)
+	assert.Empty(t, result.Reactions)
+	mockRepo.AssertExpectations(t)
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"chatgo/server/internal/interfaces"
+	"chatgo/server/internal/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strconv"
+)
+
+const (
+	// seenByMaxMembers ограничивает размер чата, для которого доступны списки "прочитано"
+	seenByMaxMembers = 20
+	previewLength    = 80
+)
+
+// MarkRoomRead передвигает отметку о прочтении пользователя в чате
+func (s *service) MarkRoomRead(c context.Context, req *interfaces.MarkRoomReadReq) error {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	if req.UserID == "" || req.RoomID == "" {
+		return fmt.Errorf("user ID and room ID are required")
+	}
+
+	messageID := req.MessageID
+	if messageID == "" {
+		messages, err := s.Repository.GetLastMessagesByChatRoomIDs(ctx, []string{req.RoomID})
+		if err != nil {
+			return err
+		}
+		if len(messages) == 0 {
+			return nil
+		}
+		messageID = messages[0].ID
+	} else {
+		message, err := s.Repository.GetMessageByID(ctx, messageID)
+		if err != nil {
+			return fmt.Errorf("message %s not found", messageID)
+		}
+		if message.ChatRoomID != req.RoomID {
+			return fmt.Errorf("message %s belongs to another room", messageID)
+		}
+	}
+
+	_, err := s.Repository.UpdateLastReadMessage(ctx, &models.ChatRoomMember{
+		UserID:            req.UserID,
+		ChatRoomID:        req.RoomID,
+		LastReadMessageID: sql.NullString{String: messageID, Valid: true},
+	})
+	return err
+}
+
+// GetMyRooms возвращает чаты пользователя с числом непрочитанных сообщений и последним сообщением
+func (s *service) GetMyRooms(c context.Context, userID string) ([]*interfaces.MyRoomRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	chatRooms, err := s.Repository.GetChatRoomsByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(chatRooms) == 0 {
+		return []*interfaces.MyRoomRes{}, nil
+	}
+
+	counts, err := s.Repository.GetUnreadCountsByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	roomIDs := make([]string, 0, len(chatRooms))
+	for _, chatRoom := range chatRooms {
+		roomIDs = append(roomIDs, chatRoom.ID)
+	}
+	lastMessages, err := s.Repository.GetLastMessagesByChatRoomIDs(ctx, roomIDs)
+	if err != nil {
+		return nil, err
+	}
+	lastByRoom := make(map[string]*models.Message, len(lastMessages))
+	for _, message := range lastMessages {
+		lastByRoom[message.ChatRoomID] = message
+	}
+
+	result := make([]*interfaces.MyRoomRes, 0, len(chatRooms))
+	for _, chatRoom := range chatRooms {
+		room := &interfaces.MyRoomRes{
+			ID:          chatRoom.ID,
+			Name:        chatRoom.Name,
+			UnreadCount: counts[chatRoom.ID],
+		}
+		if message, ok := lastByRoom[chatRoom.ID]; ok {
+			preview, err := s.toMessageRes(ctx, message)
+			if err != nil {
+				return nil, err
+			}
+			// Шифротекст нельзя обрезать, иначе клиент не сможет его расшифровать
+			if !preview.Encrypted {
+				preview.Content = truncate(preview.Content, previewLength)
+			}
+			room.LastMessage = preview
+		}
+		result = append(result, room)
+	}
+
+	return result, nil
+}
+
+// GetSeenBy возвращает имена участников, прочитавших сообщение. Доступно только участникам
+// небольших чатов
+func (s *service) GetSeenBy(c context.Context, userID, messageID string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	message, err := s.Repository.GetMessageByID(ctx, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("message %s not found", messageID)
+	}
+	id, err := strconv.ParseInt(message.ID, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := s.Repository.GetMembersByChatRoomID(ctx, message.ChatRoomID)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.ContainsFunc(members, func(m *models.ChatRoomMember) bool { return m.UserID == userID }) {
+		return nil, interfaces.ErrNotRoomMember
+	}
+	if len(members) > seenByMaxMembers {
+		return nil, fmt.Errorf("seen by is only available in rooms with up to %d members", seenByMaxMembers)
+	}
+
+	seenBy := make([]string, 0, len(members))
+	for _, member := range members {
+		if member.UserID == message.SenderID || !member.LastReadMessageID.Valid {
+			continue
+		}
+		lastRead, err := strconv.ParseInt(member.LastReadMessageID.String, 10, 64)
+		if err != nil || lastRead < id {
+			continue
+		}
+		user, err := s.Repository.GetUserByID(ctx, member.UserID)
+		if err != nil {
+			return nil, err
+		}
+		seenBy = append(seenBy, user.Username)
+	}
+
+	return seenBy, nil
+}
+
+// truncate обрезает текст до limit символов
+func truncate(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit]) + "…"
+}
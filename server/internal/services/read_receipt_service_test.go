@@ -0,0 +1,127 @@
+package services
+
+import (
+	"chatgo/server/internal/interfaces"
+	"chatgo/server/internal/models"
+	"chatgo/server/internal/util"
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestService_MarkRoomRead(t *testing.T) {
+	testCases := []struct {
+		name        string
+		req         *interfaces.MarkRoomReadReq
+		mockSetup   func(mockRepo *MockRepository)
+		expectError bool
+	}{
+		{
+			name: "Mark up to a message",
+			req:  &interfaces.MarkRoomReadReq{UserID: "user1", RoomID: "room1", MessageID: "12"},
+			mockSetup: func(mockRepo *MockRepository) {
+				mockRepo.On("GetMessageByID", mock.Anything, "12").Return(&models.Message{ID: "12", ChatRoomID: "room1"}, nil)
+				mockRepo.On("UpdateLastReadMessage", mock.Anything, &models.ChatRoomMember{
+					UserID:            "user1",
+					ChatRoomID:        "room1",
+					LastReadMessageID: sql.NullString{String: "12", Valid: true},
+				}).Return(true, nil)
+			},
+		},
+		{
+			name: "Mark up to the latest message",
+			req:  &interfaces.MarkRoomReadReq{UserID: "user1", RoomID: "room1"},
+			mockSetup: func(mockRepo *MockRepository) {
+				mockRepo.On("GetLastMessagesByChatRoomIDs", mock.Anything, []string{"room1"}).Return([]*models.Message{{ID: "20", ChatRoomID: "room1"}}, nil)
+				mockRepo.On("UpdateLastReadMessage", mock.Anything, mock.MatchedBy(func(member *models.ChatRoomMember) bool {
+					return member.LastReadMessageID.String == "20"
+				})).Return(true, nil)
+			},
+		},
+		{
+			name: "Message from another room",
+			req:  &interfaces.MarkRoomReadReq{UserID: "user1", RoomID: "room1", MessageID: "12"},
+			mockSetup: func(mockRepo *MockRepository) {
+				mockRepo.On("GetMessageByID", mock.Anything, "12").Return(&models.Message{ID: "12", ChatRoomID: "room2"}, nil)
+			},
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockRepo := new(MockRepository)
+			service := NewService(mockRepo, config, nil)
+			tc.mockSetup(mockRepo)
+
+			err := service.MarkRoomRead(context.Background(), tc.req)
+
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestService_GetMyRooms(t *testing.T) {
+	mockRepo := new(MockRepository)
+	mockRoomKeys(mockRepo)
+	service := NewService(mockRepo, config, nil)
+
+	longText := strings.Repeat("a", previewLength+10)
+	encrypted, err := util.EncryptMessage(longText, testDataKey)
+	assert.NoError(t, err)
+
+	mockRepo.On("GetChatRoomsByUserID", mock.Anything, "user1").Return([]*models.ChatRoom{
+		{ID: "room1", Name: "General"},
+		{ID: "room2", Name: "Empty"},
+	}, nil)
+	mockRepo.On("GetUnreadCountsByUserID", mock.Anything, "user1").Return(map[string]int{"room1": 4}, nil)
+	mockRepo.On("GetLastMessagesByChatRoomIDs", mock.Anything, []string{"room1", "room2"}).Return([]*models.Message{
+		{ID: "30", SenderID: "user2", ChatRoomID: "room1", EncryptedContent: encrypted, KeyVersion: 1, CreatedAt: time.Now()},
+	}, nil)
+	mockRepo.On("GetUserByID", mock.Anything, "user2").Return(&models.User{ID: "user2", Username: "bob"}, nil)
+
+	result, err := service.GetMyRooms(context.Background(), "user1")
+
+	assert.NoError(t, err)
+	assert.Len(t, result, 2)
+	assert.Equal(t, 4, result[0].UnreadCount)
+	assert.Equal(t, "bob", result[0].LastMessage.Username)
+	assert.Equal(t, []rune(longText[:previewLength]+"…"), []rune(result[0].LastMessage.Content))
+	assert.Equal(t, 0, result[1].UnreadCount)
+	assert.Nil(t, result[1].LastMessage)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_GetSeenBy(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewService(mockRepo, config, nil)
+
+	mockRepo.On("GetMessageByID", mock.Anything, "10").Return(&models.Message{ID: "10", SenderID: "user1", ChatRoomID: "room1"}, nil)
+	mockRepo.On("GetMembersByChatRoomID", mock.Anything, "room1").Return([]*models.ChatRoomMember{
+		{UserID: "user1", LastReadMessageID: sql.NullString{String: "10", Valid: true}},
+		{UserID: "user2", LastReadMessageID: sql.NullString{String: "11", Valid: true}},
+		{UserID: "user3", LastReadMessageID: sql.NullString{String: "9", Valid: true}},
+		{UserID: "user4"},
+	}, nil)
+	mockRepo.On("GetUserByID", mock.Anything, "user2").Return(&models.User{ID: "user2", Username: "bob"}, nil)
+
+	result, err := service.GetSeenBy(context.Background(), "user4", "10")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"bob"}, result)
+
+	// Only members of the room can see who read its messages
+	_, err = service.GetSeenBy(context.Background(), "user5", "10")
+	assert.ErrorIs(t, err, interfaces.ErrNotRoomMember)
+	mockRepo.AssertExpectations(t)
+}
@@ -0,0 +1,315 @@
+package services
+
+import (
+	"chatgo/server/internal/interfaces"
+	"chatgo/server/internal/models"
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+)
+
+const (
+	defaultRetentionInterval  = time.Hour
+	defaultRetentionBatchSize = 500
+)
+
+// GetRetentionPolicy возвращает действующую политику хранения чата. Смотреть её могут только
+// админы чата, проверка пропускается, если userID пуст
+func (s *service) GetRetentionPolicy(c context.Context, userID, roomID string) (*interfaces.RetentionPolicyRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	room, err := s.Repository.GetChatRoomByID(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	if room == nil {
+		return nil, interfaces.ErrRoomNotFound
+	}
+	if userID != "" {
+		if err := s.checkRoomAdmin(ctx, userID, roomID); err != nil {
+			return nil, err
+		}
+	}
+
+	policy, err := s.Repository.GetRetentionPolicy(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	return s.effectivePolicy(roomID, policy), nil
+}
+
+// SetRetentionPolicy задаёт сроки хранения сообщений чата. Удержание при этом не меняется
+func (s *service) SetRetentionPolicy(c context.Context, req *interfaces.SetRetentionPolicyReq) (*interfaces.RetentionPolicyRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	if err := s.checkRoomExists(ctx, req.RoomID); err != nil {
+		return nil, err
+	}
+
+	maxAgeDays, err := retentionLimit(req.MaxAgeDays)
+	if err != nil {
+		return nil, err
+	}
+	maxMessages, err := retentionLimit(req.MaxMessages)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := &models.RetentionPolicy{ChatRoomID: req.RoomID, MaxAgeDays: maxAgeDays, MaxMessages: maxMessages}
+	if err := s.Repository.SetRetentionLimits(ctx, policy); err != nil {
+		return nil, err
+	}
+
+	policy, err = s.Repository.GetRetentionPolicy(ctx, req.RoomID)
+	if err != nil {
+		return nil, err
+	}
+	return s.effectivePolicy(req.RoomID, policy), nil
+}
+
+// retentionLimit переводит лимит из запроса в значение столбца, nil становится NULL
+func retentionLimit(value *int) (sql.NullInt64, error) {
+	if value == nil {
+		return sql.NullInt64{}, nil
+	}
+	if *value < 0 {
+		return sql.NullInt64{}, errors.New("retention limits must not be negative")
+	}
+	return sql.NullInt64{Int64: int64(*value), Valid: true}, nil
+}
+
+// SetLegalHold накладывает или снимает удержание: пока оно действует, сообщения чата
+// не удаляются никакими политиками
+func (s *service) SetLegalHold(c context.Context, roomID string, hold bool) (*interfaces.RetentionPolicyRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	if err := s.checkRoomExists(ctx, roomID); err != nil {
+		return nil, err
+	}
+	if err := s.Repository.SetLegalHold(ctx, roomID, hold); err != nil {
+		return nil, err
+	}
+
+	policy, err := s.Repository.GetRetentionPolicy(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	return s.effectivePolicy(roomID, policy), nil
+}
+
+func (s *service) checkRoomExists(ctx context.Context, roomID string) error {
+	room, err := s.Repository.GetChatRoomByID(ctx, roomID)
+	if err != nil {
+		return err
+	}
+	if room == nil {
+		return interfaces.ErrRoomNotFound
+	}
+	return nil
+}
+
+// effectivePolicy дополняет настройки чата глобальной политикой. policy может быть nil
+func (s *service) effectivePolicy(roomID string, policy *models.RetentionPolicy) *interfaces.RetentionPolicyRes {
+	res := &interfaces.RetentionPolicyRes{
+		RoomID:            roomID,
+		MaxAgeDays:        s.Retention.MaxAgeDays,
+		MaxAgeSource:      interfaces.RetentionSourceGlobal,
+		MaxMessages:       s.Retention.MaxMessages,
+		MaxMessagesSource: interfaces.RetentionSourceGlobal,
+		Archive:           s.Retention.Archive,
+	}
+	if policy == nil {
+		return res
+	}
+
+	if policy.MaxAgeDays.Valid {
+		res.MaxAgeDays = int(policy.MaxAgeDays.Int64)
+		res.MaxAgeSource = interfaces.RetentionSourceRoom
+	}
+	if policy.MaxMessages.Valid {
+		res.MaxMessages = int(policy.MaxMessages.Int64)
+		res.MaxMessagesSource = interfaces.RetentionSourceRoom
+	}
+	res.LegalHold = policy.LegalHold
+	return res
+}
+
+// PurgeExpiredMessages применяет политики хранения ко всем чатам. Устаревшие ветки удаляются
+// целиком вместе с файлами пакетами по BatchSize, либо переносятся в архив, если включён Archive.
+// Срок хранения отсчитывается от последнего сообщения ветки, а лимит числа сообщений считает
+// только корневые сообщения. Чаты на удержании пропускаются. Каждая очистка записывается в журнал
+func (s *service) PurgeExpiredMessages(c context.Context) (*interfaces.PurgeRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	rooms, err := s.Repository.GetAllChatRooms(ctx)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	policies, err := s.Repository.GetRetentionPolicies(ctx)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+
+	byRoom := make(map[string]*models.RetentionPolicy, len(policies))
+	for _, policy := range policies {
+		byRoom[policy.ChatRoomID] = policy
+	}
+
+	res := &interfaces.PurgeRes{}
+	now := utcNow()
+	for _, room := range rooms {
+		policy := s.effectivePolicy(room.ID, byRoom[room.ID])
+		if policy.LegalHold {
+			continue
+		}
+
+		purged := false
+		if policy.MaxAgeDays > 0 {
+			before := now.AddDate(0, 0, -policy.MaxAgeDays)
+			n, err := s.purgeRoom(c, room.ID, models.PurgeReasonMaxAge, res, func(ctx context.Context, limit int) ([]string, error) {
+				return s.Repository.GetExpiredMessageIDs(ctx, room.ID, before, limit)
+			})
+			if err != nil {
+				return res, err
+			}
+			purged = purged || n > 0
+		}
+		if policy.MaxMessages > 0 {
+			n, err := s.purgeRoom(c, room.ID, models.PurgeReasonMaxMessages, res, func(ctx context.Context, limit int) ([]string, error) {
+				return s.Repository.GetOverflowMessageIDs(ctx, room.ID, policy.MaxMessages, limit)
+			})
+			if err != nil {
+				return res, err
+			}
+			purged = purged || n > 0
+		}
+		if purged {
+			res.Rooms++
+		}
+	}
+
+	return res, nil
+}
+
+// purgeRoom удаляет пакетами ветки, которые возвращает expired, пока они не закончатся.
+// Возвращает число удалённых сообщений
+func (s *service) purgeRoom(c context.Context, roomID, reason string, res *interfaces.PurgeRes,
+	expired func(ctx context.Context, limit int) ([]string, error)) (int, error) {
+	batchSize := s.Retention.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultRetentionBatchSize
+	}
+
+	entry := &models.RetentionPurge{ChatRoomID: roomID, Reason: reason, Archived: s.Retention.Archive}
+	var err error
+	for {
+		var n int
+		if n, err = s.purgeBatch(c, entry, expired, batchSize); err != nil || n < batchSize {
+			break
+		}
+	}
+
+	// Журнал пишется и после ошибки, чтобы в нём было видно уже удалённое
+	if entry.Messages > 0 {
+		ctx, cancel := context.WithTimeout(c, s.timeout)
+		if logErr := s.Repository.CreateRetentionPurge(ctx, entry); logErr != nil {
+			log.Printf("Failed to log purge of room %s: %v", roomID, logErr)
+		}
+		cancel()
+		log.Printf("Retention: purged %d messages and %d attachments of room %s (%s)",
+			entry.Messages, entry.Attachments, roomID, reason)
+	}
+	res.Messages += entry.Messages
+	res.Attachments += entry.Attachments
+	return entry.Messages, err
+}
+
+// purgeBatch удаляет один пакет веток и возвращает число найденных корневых сообщений
+func (s *service) purgeBatch(c context.Context, entry *models.RetentionPurge,
+	expired func(ctx context.Context, limit int) ([]string, error), batchSize int) (int, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	ids, err := expired(ctx, batchSize)
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+	purged, err := s.Repository.PurgeMessages(ctx, ids, entry.Archived)
+	if err != nil {
+		return 0, err
+	}
+
+	s.forgetMessages(ctx, purged, !entry.Archived)
+	entry.Messages += len(purged.Messages)
+	entry.Attachments += len(purged.Attachments)
+	return len(ids), nil
+}
+
+// forgetMessages убирает удалённые сообщения из поискового индекса и, если deleteBlobs,
+// удаляет их файлы из хранилища
+func (s *service) forgetMessages(ctx context.Context, purged *models.PurgedMessages, deleteBlobs bool) {
+	for _, message := range purged.Messages {
+		s.index.Remove(message.ID)
+	}
+	if !deleteBlobs {
+		return
+	}
+	for _, attachment := range purged.Attachments {
+		if err := s.blobs.Delete(ctx, attachment.StorageKey); err != nil {
+			log.Printf("Failed to delete blob %s: %v", attachment.StorageKey, err)
+		}
+	}
+}
+
+// GetPurgeLog возвращает до limit последних записей журнала очистки чата, или всех чатов,
+// если roomID пуст
+func (s *service) GetPurgeLog(c context.Context, roomID string, limit int) ([]*interfaces.RetentionPurgeRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	purges, err := s.Repository.GetRetentionPurges(ctx, roomID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*interfaces.RetentionPurgeRes, len(purges))
+	for i, purge := range purges {
+		res[i] = &interfaces.RetentionPurgeRes{
+			ID:          purge.ID,
+			RoomID:      purge.ChatRoomID,
+			Reason:      purge.Reason,
+			Messages:    purge.Messages,
+			Attachments: purge.Attachments,
+			Archived:    purge.Archived,
+			CreatedAt:   purge.CreatedAt,
+		}
+	}
+	return res, nil
+}
+
+// RunRetention применяет политики хранения сразу и затем раз в Interval, пока не отменён c
+func (s *service) RunRetention(c context.Context) {
+	interval := s.Retention.Interval
+	if interval <= 0 {
+		interval = defaultRetentionInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.PurgeExpiredMessages(c); err != nil {
+			log.Printf("Retention purge failed: %v", err)
+		}
+		select {
+		case <-c.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
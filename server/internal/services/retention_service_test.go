@@ -0,0 +1,128 @@
+package services
+
+import (
+	"bytes"
+	"chatgo/server/internal/interfaces"
+	"chatgo/server/internal/models"
+	"chatgo/server/internal/storage"
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestService_GetRetentionPolicy(t *testing.T) {
+	mockRepo := new(MockRepository)
+	cfg := *config
+	cfg.Retention = RetentionConfig{MaxAgeDays: 365, MaxMessages: 10000}
+	service := NewService(mockRepo, &cfg, nil)
+
+	mockRepo.On("GetChatRoomByID", mock.Anything, "1").Return(&models.ChatRoom{ID: "1"}, nil)
+	mockRepo.On("GetChatRoomByID", mock.Anything, "2").Return(nil, nil)
+	mockRepo.On("GetMembersByChatRoomID", mock.Anything, "1").Return([]*models.ChatRoomMember{
+		{UserID: "admin", MemberRole: models.Admin},
+		{UserID: "member", MemberRole: models.Member},
+	}, nil)
+	mockRepo.On("GetRetentionPolicy", mock.Anything, "1").Return(&models.RetentionPolicy{
+		ChatRoomID: "1",
+		MaxAgeDays: sql.NullInt64{Int64: 0, Valid: true},
+		LegalHold:  true,
+	}, nil)
+
+	res, err := service.GetRetentionPolicy(context.Background(), "admin", "1")
+	assert.NoError(t, err)
+	// The room keeps messages forever, the message limit is inherited
+	assert.Equal(t, &interfaces.RetentionPolicyRes{
+		RoomID:            "1",
+		MaxAgeDays:        0,
+		MaxAgeSource:      interfaces.RetentionSourceRoom,
+		MaxMessages:       10000,
+		MaxMessagesSource: interfaces.RetentionSourceGlobal,
+		LegalHold:         true,
+	}, res)
+
+	_, err = service.GetRetentionPolicy(context.Background(), "member", "1")
+	assert.ErrorIs(t, err, interfaces.ErrNotRoomAdmin)
+
+	_, err = service.GetRetentionPolicy(context.Background(), "admin", "2")
+	assert.ErrorIs(t, err, interfaces.ErrRoomNotFound)
+}
+
+func TestService_SetRetentionPolicy(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewService(mockRepo, config, nil)
+
+	maxAgeDays, negative := 30, -1
+	mockRepo.On("GetChatRoomByID", mock.Anything, "1").Return(&models.ChatRoom{ID: "1"}, nil)
+	mockRepo.On("SetRetentionLimits", mock.Anything, &models.RetentionPolicy{
+		ChatRoomID: "1",
+		MaxAgeDays: sql.NullInt64{Int64: 30, Valid: true},
+	}).Return(nil).Once()
+	mockRepo.On("GetRetentionPolicy", mock.Anything, "1").Return(&models.RetentionPolicy{
+		ChatRoomID: "1",
+		MaxAgeDays: sql.NullInt64{Int64: 30, Valid: true},
+	}, nil)
+
+	res, err := service.SetRetentionPolicy(context.Background(), &interfaces.SetRetentionPolicyReq{RoomID: "1", MaxAgeDays: &maxAgeDays})
+	assert.NoError(t, err)
+	assert.Equal(t, 30, res.MaxAgeDays)
+	assert.Equal(t, interfaces.RetentionSourceRoom, res.MaxAgeSource)
+	assert.Equal(t, interfaces.RetentionSourceGlobal, res.MaxMessagesSource)
+
+	_, err = service.SetRetentionPolicy(context.Background(), &interfaces.SetRetentionPolicyReq{RoomID: "1", MaxMessages: &negative})
+	assert.Error(t, err)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_PurgeExpiredMessages(t *testing.T) {
+	mockRepo := new(MockRepository)
+	blobs, err := storage.NewLocalStore(t.TempDir())
+	assert.NoError(t, err)
+	assert.NoError(t, blobs.Put(context.Background(), "rooms/1/abc", bytes.NewReader([]byte("data")), 4))
+
+	cfg := *config
+	cfg.Retention = RetentionConfig{MaxAgeDays: 90, BatchSize: 2}
+	service := NewService(mockRepo, &cfg, blobs)
+
+	mockRepo.On("GetAllChatRooms", mock.Anything).Return([]*models.ChatRoom{{ID: "1"}, {ID: "2"}, {ID: "3"}}, nil)
+	mockRepo.On("GetRetentionPolicies", mock.Anything).Return([]*models.RetentionPolicy{
+		{ChatRoomID: "2", LegalHold: true},
+		{ChatRoomID: "3", MaxAgeDays: sql.NullInt64{Valid: true}, MaxMessages: sql.NullInt64{Int64: 5, Valid: true}},
+	}, nil)
+
+	// Room 1 follows the global policy and is purged in two batches
+	before := mock.MatchedBy(func(before time.Time) bool {
+		return time.Since(before) > 89*24*time.Hour && time.Since(before) < 91*24*time.Hour
+	})
+	mockRepo.On("GetExpiredMessageIDs", mock.Anything, "1", before, 2).Return([]string{"4", "7"}, nil).Once()
+	mockRepo.On("GetExpiredMessageIDs", mock.Anything, "1", before, 2).Return([]string{"9"}, nil).Once()
+	mockRepo.On("PurgeMessages", mock.Anything, []string{"4", "7"}, false).Return(&models.PurgedMessages{
+		Messages:    []*models.Message{{ID: "4"}, {ID: "5"}, {ID: "7"}},
+		Attachments: []*models.Attachment{{ID: "1", StorageKey: "rooms/1/abc"}},
+	}, nil)
+	mockRepo.On("PurgeMessages", mock.Anything, []string{"9"}, false).Return(&models.PurgedMessages{
+		Messages: []*models.Message{{ID: "9"}},
+	}, nil)
+	mockRepo.On("CreateRetentionPurge", mock.Anything, &models.RetentionPurge{
+		ChatRoomID:  "1",
+		Reason:      models.PurgeReasonMaxAge,
+		Messages:    4,
+		Attachments: 1,
+	}).Return(nil)
+
+	// Room 3 keeps messages forever but only the last 5 of them, and has no more
+	mockRepo.On("GetOverflowMessageIDs", mock.Anything, "3", 5, 2).Return([]string{}, nil)
+
+	res, err := service.PurgeExpiredMessages(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, &interfaces.PurgeRes{Rooms: 1, Messages: 4, Attachments: 1}, res)
+	_, err = blobs.Get(context.Background(), "rooms/1/abc")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	mockRepo.AssertNotCalled(t, "GetExpiredMessageIDs", mock.Anything, "2", mock.Anything, mock.Anything)
+	mockRepo.AssertNotCalled(t, "GetExpiredMessageIDs", mock.Anything, "3", mock.Anything, mock.Anything)
+	mockRepo.AssertExpectations(t)
+}
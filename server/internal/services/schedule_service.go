@@ -0,0 +1,172 @@
+package services
+
+import (
+	"chatgo/server/internal/interfaces"
+	"chatgo/server/internal/models"
+	"chatgo/server/internal/search"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	// maxScheduleAhead ограничивает, насколько далеко вперёд можно отложить сообщение
+	maxScheduleAhead = 365 * 24 * time.Hour
+
+	scheduleBatchSize = 100
+)
+
+// ScheduleMessage откладывает сообщение пользователя до времени SendAt. Содержимое шифруется
+// ключом чата так же, как обычные сообщения
+func (s *service) ScheduleMessage(c context.Context, req *interfaces.ScheduleMessageReq) (*interfaces.ScheduledMessageRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	if strings.TrimSpace(req.Content) == "" {
+		return nil, fmt.Errorf("message content is required")
+	}
+	sendAt, err := time.Parse(time.RFC3339, req.SendAt)
+	if err != nil {
+		return nil, interfaces.ErrInvalidSendTime
+	}
+	if now := utcNow(); !sendAt.After(now) || sendAt.After(now.Add(maxScheduleAhead)) {
+		return nil, interfaces.ErrInvalidSendTime
+	}
+
+	if err := s.checkRoomMember(ctx, req.UserID, req.RoomID); err != nil {
+		return nil, err
+	}
+	room, err := s.Repository.GetChatRoomByID(ctx, req.RoomID)
+	if err != nil {
+		return nil, err
+	}
+	if room == nil {
+		return nil, interfaces.ErrRoomNotFound
+	}
+	if room.E2E != req.Encrypted {
+		if room.E2E {
+			return nil, fmt.Errorf("messages in room %s must be encrypted by the client", req.RoomID)
+		}
+		return nil, fmt.Errorf("room %s is not end-to-end encrypted", req.RoomID)
+	}
+
+	encryptedMessage, keyVersion := req.Content, models.E2EKeyVersion
+	if !room.E2E {
+		encryptedMessage, keyVersion, err = s.encryptContent(ctx, req.RoomID, req.Content)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	scheduled, err := s.Repository.CreateScheduledMessage(ctx, &models.ScheduledMessage{
+		SenderID:         req.UserID,
+		ChatRoomID:       req.RoomID,
+		EncryptedContent: encryptedMessage,
+		KeyVersion:       keyVersion,
+		SendAt:           sendAt.UTC(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &interfaces.ScheduledMessageRes{
+		ID:        scheduled.ID,
+		RoomID:    scheduled.ChatRoomID,
+		Content:   req.Content,
+		SendAt:    scheduled.SendAt.Format(time.RFC3339),
+		Encrypted: room.E2E,
+	}, nil
+}
+
+// GetScheduledMessages возвращает ещё не отправленные сообщения пользователя. Если roomID пуст,
+// возвращаются сообщения во все чаты
+func (s *service) GetScheduledMessages(c context.Context, userID, roomID string) ([]*interfaces.ScheduledMessageRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	messages, err := s.Repository.GetPendingScheduledMessages(ctx, userID, roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*interfaces.ScheduledMessageRes, 0, len(messages))
+	for _, message := range messages {
+		content, err := s.decryptContent(ctx, message.ChatRoomID, message.KeyVersion, message.EncryptedContent)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, &interfaces.ScheduledMessageRes{
+			ID:        message.ID,
+			RoomID:    message.ChatRoomID,
+			Content:   content,
+			SendAt:    message.SendAt.Format(time.RFC3339),
+			Encrypted: message.KeyVersion == models.E2EKeyVersion,
+		})
+	}
+
+	return result, nil
+}
+
+// CancelScheduledMessage отменяет отложенное сообщение. Отменить можно только своё
+// и ещё не отправленное сообщение
+func (s *service) CancelScheduledMessage(c context.Context, userID, id string) error {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	cancelled, err := s.Repository.CancelScheduledMessage(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+	if !cancelled {
+		return interfaces.ErrScheduledNotFound
+	}
+	return nil
+}
+
+// DeliverScheduledMessages отправляет отложенные сообщения, время которых наступило, и возвращает
+// их расшифрованными, чтобы разослать участникам чатов. Каждое сообщение сохраняется ровно один раз
+func (s *service) DeliverScheduledMessages(c context.Context) ([]*interfaces.CreateMessageRes, error) {
+	var result []*interfaces.CreateMessageRes
+	for {
+		n, err := s.deliverBatch(c, &result)
+		if err != nil || n < scheduleBatchSize {
+			return result, err
+		}
+	}
+}
+
+// deliverBatch отправляет один пакет отложенных сообщений и возвращает их число
+func (s *service) deliverBatch(c context.Context, result *[]*interfaces.CreateMessageRes) (int, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	messages, err := s.Repository.DeliverScheduledMessages(ctx, utcNow(), scheduleBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	// Сообщения уже сохранены, поэтому ошибки дальше только пишутся в лог
+	for _, message := range messages {
+		res, err := s.toMessageRes(ctx, message)
+		if err != nil {
+			log.Printf("Failed to prepare scheduled message %s: %v", message.ID, err)
+			continue
+		}
+
+		if !res.Encrypted {
+			s.index.Add(search.Document{
+				ID:        message.ID,
+				RoomID:    message.ChatRoomID,
+				Username:  res.Username,
+				Content:   res.Content,
+				CreatedAt: message.CreatedAt,
+			})
+			sender := &models.User{ID: message.SenderID, Username: res.Username}
+			res.Mentions = s.recordMentions(ctx, message, sender, res.Content)
+		}
+		*result = append(*result, res)
+	}
+	return len(messages), nil
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"chatgo/server/internal/interfaces"
+	"chatgo/server/internal/models"
+	"chatgo/server/internal/util"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestService_ScheduleMessage(t *testing.T) {
+	mockRepo := new(MockRepository)
+	mockRoomKeys(mockRepo)
+	service := NewService(mockRepo, config, nil)
+
+	sendAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	mockRepo.On("GetMembersByChatRoomID", mock.Anything, "1").Return([]*models.ChatRoomMember{{UserID: "2"}}, nil)
+	mockRepo.On("GetChatRoomByID", mock.Anything, "1").Return(&models.ChatRoom{ID: "1"}, nil)
+	var stored *models.ScheduledMessage
+	mockRepo.On("CreateScheduledMessage", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		stored = args.Get(1).(*models.ScheduledMessage)
+		stored.ID = "5"
+	}).Return(&models.ScheduledMessage{ID: "5", ChatRoomID: "1", SendAt: sendAt.UTC()}, nil)
+
+	res, err := service.ScheduleMessage(context.Background(), &interfaces.ScheduleMessageReq{
+		UserID: "2", RoomID: "1", Content: "standup in 5", SendAt: sendAt.Format(time.RFC3339),
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, &interfaces.ScheduledMessageRes{ID: "5", RoomID: "1", Content: "standup in 5", SendAt: sendAt.UTC().Format(time.RFC3339)}, res)
+
+	// The content is stored encrypted with the room key
+	assert.Equal(t, 1, stored.KeyVersion)
+	content, err := util.DecryptMessage(stored.EncryptedContent, testDataKey)
+	assert.NoError(t, err)
+	assert.Equal(t, "standup in 5", content)
+}
+
+func TestService_ScheduleMessage_Invalid(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewService(mockRepo, config, nil)
+	mockRepo.On("GetMembersByChatRoomID", mock.Anything, "1").Return([]*models.ChatRoomMember{{UserID: "2"}}, nil)
+
+	testCases := []struct {
+		name string
+		req  *interfaces.ScheduleMessageReq
+		err  error
+	}{
+		{
+			name: "Time in the past",
+			req:  &interfaces.ScheduleMessageReq{UserID: "2", RoomID: "1", Content: "hi", SendAt: time.Now().Add(-time.Minute).Format(time.RFC3339)},
+			err:  interfaces.ErrInvalidSendTime,
+		},
+		{
+			name: "Time too far ahead",
+			req:  &interfaces.ScheduleMessageReq{UserID: "2", RoomID: "1", Content: "hi", SendAt: time.Now().AddDate(2, 0, 0).Format(time.RFC3339)},
+			err:  interfaces.ErrInvalidSendTime,
+		},
+		{
+			name: "Malformed time",
+			req:  &interfaces.ScheduleMessageReq{UserID: "2", RoomID: "1", Content: "hi", SendAt: "9am"},
+			err:  interfaces.ErrInvalidSendTime,
+		},
+		{
+			name: "Not a member",
+			req:  &interfaces.ScheduleMessageReq{UserID: "3", RoomID: "1", Content: "hi", SendAt: time.Now().Add(time.Hour).Format(time.RFC3339)},
+			err:  interfaces.ErrNotRoomMember,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := service.ScheduleMessage(context.Background(), tc.req)
+			assert.ErrorIs(t, err, tc.err)
+		})
+	}
+	mockRepo.AssertNotCalled(t, "CreateScheduledMessage", mock.Anything, mock.Anything)
+}
+
+func TestService_CancelScheduledMessage(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewService(mockRepo, config, nil)
+
+	mockRepo.On("CancelScheduledMessage", mock.Anything, "5", "2").Return(true, nil)
+	mockRepo.On("CancelScheduledMessage", mock.Anything, "5", "3").Return(false, nil)
+
+	assert.NoError(t, service.CancelScheduledMessage(context.Background(), "2", "5"))
+	// Someone else's or an already sent message can't be cancelled
+	assert.ErrorIs(t, service.CancelScheduledMessage(context.Background(), "3", "5"), interfaces.ErrScheduledNotFound)
+}
+
+func TestService_DeliverScheduledMessages(t *testing.T) {
+	mockRepo := new(MockRepository)
+	mockRoomKeys(mockRepo)
+	service := NewService(mockRepo, config, nil)
+
+	encrypted, err := util.EncryptMessage("standup in 5", testDataKey)
+	assert.NoError(t, err)
+
+	mockRepo.On("DeliverScheduledMessages", mock.Anything, mock.Anything, scheduleBatchSize).Return([]*models.Message{
+		{ID: "40", SenderID: "2", ChatRoomID: "1", EncryptedContent: encrypted, KeyVersion: 1, CreatedAt: time.Now()},
+	}, nil)
+	mockRepo.On("GetUserByID", mock.Anything, "2").Return(&models.User{ID: "2", Username: "alice"}, nil)
+
+	res, err := service.DeliverScheduledMessages(context.Background())
+
+	assert.NoError(t, err)
+	assert.Len(t, res, 1)
+	assert.Equal(t, "40", res[0].ID)
+	assert.Equal(t, "standup in 5", res[0].Content)
+	assert.Equal(t, "alice", res[0].Username)
+	assert.Equal(t, 1, indexLen(service))
+	mockRepo.AssertNumberOfCalls(t, "DeliverScheduledMessages", 1)
+}
+
+// TestService_ScheduledMessages_UTC checks that send_at is stored and compared in UTC when the server runs in another zone
+func TestService_ScheduledMessages_UTC(t *testing.T) {
+	withLocalZone(t)
+	mockRepo := new(MockRepository)
+	mockRoomKeys(mockRepo)
+	service := NewService(mockRepo, config, nil)
+
+	sendAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	mockRepo.On("GetMembersByChatRoomID", mock.Anything, "1").Return([]*models.ChatRoomMember{{UserID: "2"}}, nil)
+	mockRepo.On("GetChatRoomByID", mock.Anything, "1").Return(&models.ChatRoom{ID: "1"}, nil)
+	mockRepo.On("CreateScheduledMessage", mock.Anything, mock.MatchedBy(func(m *models.ScheduledMessage) bool {
+		return isUTC(m.SendAt) && m.SendAt.Equal(sendAt)
+	})).Return(&models.ScheduledMessage{ID: "5", ChatRoomID: "1", SendAt: sendAt.UTC()}, nil)
+	mockRepo.On("DeliverScheduledMessages", mock.Anything, mock.MatchedBy(isUTC), scheduleBatchSize).Return([]*models.Message{}, nil)
+
+	_, err := service.ScheduleMessage(context.Background(), &interfaces.ScheduleMessageReq{
+		UserID: "2", RoomID: "1", Content: "standup in 5", SendAt: sendAt.Format(time.RFC3339),
+	})
+	assert.NoError(t, err)
+
+	_, err = service.DeliverScheduledMessages(context.Background())
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"chatgo/server/internal/interfaces"
+	"chatgo/server/internal/models"
+	"chatgo/server/internal/search"
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+	indexBatchSize     = 500
+)
+
+// SearchMessages ищет сообщения по запросу только в тех чатах, участником которых является пользователь
+func (s *service) SearchMessages(c context.Context, req *interfaces.SearchMessagesReq) ([]*interfaces.CreateMessageRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	if req.UserID == "" {
+		return nil, fmt.Errorf("user ID is required")
+	}
+
+	query, err := search.ParseQuery(req.Query)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+
+	chatRooms, err := s.Repository.GetChatRoomsByUserID(ctx, req.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Чаты со сквозным шифрованием не индексируются и исключаются из поиска
+	roomIDs := make([]string, 0, len(chatRooms))
+	for _, chatRoom := range chatRooms {
+		if chatRoom.E2E {
+			continue
+		}
+		roomIDs = append(roomIDs, chatRoom.ID)
+	}
+
+	docs := s.index.Search(query, roomIDs, limit)
+
+	result := make([]*interfaces.CreateMessageRes, 0, len(docs))
+	for _, doc := range docs {
+		result = append(result, &interfaces.CreateMessageRes{
+			ID:        doc.ID,
+			Content:   doc.Content,
+			RoomID:    doc.RoomID,
+			Username:  doc.Username,
+			CreatedAt: doc.CreatedAt.Format(time.RFC3339),
+		})
+	}
+
+	return result, nil
+}
+
+// BuildSearchIndex заполняет поисковый индекс расшифрованными сообщениями из базы данных,
+// обходя таблицу messages порциями по indexBatchSize
+func (s *service) BuildSearchIndex(c context.Context) error {
+	usernames := make(map[string]string)
+	afterID := "0"
+
+	for {
+		ctx, cancel := context.WithTimeout(c, s.timeout)
+		messages, err := s.Repository.GetMessagesAfterID(ctx, afterID, indexBatchSize)
+		if err != nil {
+			cancel()
+			return err
+		}
+
+		for _, message := range messages {
+			// Текст сообщений со сквозным шифрованием серверу недоступен
+			if message.KeyVersion == models.E2EKeyVersion {
+				continue
+			}
+
+			username, ok := usernames[message.SenderID]
+			if !ok {
+				user, err := s.Repository.GetUserByID(ctx, message.SenderID)
+				if err != nil {
+					cancel()
+					return err
+				}
+				username = user.Username
+				usernames[message.SenderID] = username
+			}
+
+			content, err := s.decryptContent(ctx, message.ChatRoomID, message.KeyVersion, message.EncryptedContent)
+			if err != nil {
+				log.Printf("Skipping message %s in search index: %v", message.ID, err)
+				continue
+			}
+
+			s.index.Add(search.Document{
+				ID:        message.ID,
+				RoomID:    message.ChatRoomID,
+				Username:  username,
+				Content:   content,
+				CreatedAt: message.CreatedAt,
+			})
+		}
+		cancel()
+
+		if len(messages) < indexBatchSize {
+			break
+		}
+		afterID = messages[len(messages)-1].ID
+	}
+
+	log.Printf("Search index built with %d messages", s.index.Len())
+	return nil
+}
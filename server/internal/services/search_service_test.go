@@ -0,0 +1,60 @@
+package services
+
+import (
+	"chatgo/server/internal/interfaces"
+	"chatgo/server/internal/models"
+	"chatgo/server/internal/util"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestService_SearchMessages(t *testing.T) {
+	mockRepo := new(MockRepository)
+	mockRoomKeys(mockRepo)
+	service := NewService(mockRepo, config, nil)
+
+	encrypted1, err := util.EncryptMessage("release notes are ready", testDataKey)
+	assert.NoError(t, err)
+	encrypted2, err := util.EncryptMessage("secret release plans", testDataKey)
+	assert.NoError(t, err)
+
+	messages := []*models.Message{
+		{ID: "1", SenderID: "user1", ChatRoomID: "room1", EncryptedContent: encrypted1, KeyVersion: 1, CreatedAt: time.Now()},
+		{ID: "2", SenderID: "user1", ChatRoomID: "room2", EncryptedContent: encrypted2, KeyVersion: 1, CreatedAt: time.Now()},
+	}
+
+	mockRepo.On("GetMessagesAfterID", mock.Anything, "0", indexBatchSize).Return(messages, nil)
+	mockRepo.On("GetUserByID", mock.Anything, "user1").Return(&models.User{ID: "user1", Username: "alice"}, nil)
+	mockRepo.On("GetChatRoomsByUserID", mock.Anything, "user2").Return([]*models.ChatRoom{{ID: "room1"}}, nil)
+
+	assert.NoError(t, service.BuildSearchIndex(context.Background()))
+
+	result, err := service.SearchMessages(context.Background(), &interfaces.SearchMessagesReq{
+		UserID: "user2",
+		Query:  "release from:alice",
+	})
+
+	assert.NoError(t, err)
+	assert.Len(t, result, 1)
+	assert.Equal(t, "1", result[0].ID)
+	assert.Equal(t, "release notes are ready", result[0].Content)
+	assert.Equal(t, "alice", result[0].Username)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_SearchMessages_InvalidRequest(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewService(mockRepo, config, nil)
+
+	_, err := service.SearchMessages(context.Background(), &interfaces.SearchMessagesReq{Query: "release"})
+	assert.Error(t, err)
+
+	_, err = service.SearchMessages(context.Background(), &interfaces.SearchMessagesReq{UserID: "user1", Query: ""})
+	assert.Error(t, err)
+
+	mockRepo.AssertNotCalled(t, "GetChatRoomsByUserID", mock.Anything, mock.Anything)
+}
@@ -2,25 +2,166 @@ package services
 
 import (
 	"chatgo/server/internal/interfaces"
+	"chatgo/server/internal/keyring"
 	"chatgo/server/internal/models"
+	"chatgo/server/internal/search"
+	"chatgo/server/internal/storage"
+	"chatgo/server/internal/util"
+	"chatgo/server/internal/webhook"
+	"errors"
+	"fmt"
+	"log"
+	"os"
 	"time"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
 type service struct {
 	models.Repository
 	timeout time.Duration
 	Config
+	index *search.Index
+	blobs storage.BlobStore
+	keys  *keyring.Keyring
+	// webhooks отправляет события на исходящие вебхуки
+	webhooks *webhook.Sender
+	// breached — утёкшие пароли из Password.BreachedList в нижнем регистре
+	breached map[string]struct{}
+	// dummyHash — хеш, с которым сравнивается пароль несуществующего пользователя
+	dummyHash string
 }
 
 type Config struct {
-	secretKey  string `yaml:"JWTKey"`
-	encryptKey []byte `yaml:"encryptKey"`
+	JWTKey string `yaml:"JWTKey"`
+	// MasterKey — мастер-ключ в base64 (32 байта), которым шифруются ключи чатов
+	MasterKey string `yaml:"masterKey"`
+	// Retention — глобальная политика хранения сообщений
+	Retention RetentionConfig `yaml:"retention"`
+	// Admins — ID администраторов сервера, они могут разблокировать аккаунты. Права выдаются по ID,
+	// а не по имени, чтобы их нельзя было получить, зарегистрировав имя администратора
+	Admins []string `yaml:"admins"`
+	// Lockout — блокировка входа после неудачных попыток
+	Lockout LockoutConfig `yaml:"lockout"`
+	// TwoFactor — двухфакторная аутентификация по TOTP
+	TwoFactor TwoFactorConfig `yaml:"twoFactor"`
+	// Password — требования к паролям и их хеширование
+	Password PasswordConfig `yaml:"password"`
+	// Webhooks — ограничения исходящих вебхуков
+	Webhooks WebhookConfig `yaml:"webhooks"`
+}
+
+// WebhookConfig задаёт, куда можно отправлять вебхуки. Адреса loopback, частных и link-local сетей
+// запрещены, AllowedNetworks — внутренние сети в нотации CIDR, для которых сделано исключение
+type WebhookConfig struct {
+	AllowedNetworks []string `yaml:"allowedNetworks"`
+}
+
+// PasswordConfig задаёт требования к новым паролям, стоимость bcrypt и срок действия токенов
+// сброса пароля. Хеши с меньшей стоимостью пересчитываются при входе.
+// Нулевые значения заменяются значениями по умолчанию
+type PasswordConfig struct {
+	MinLength    int           `yaml:"minLength"`    // по умолчанию 8 символов
+	MaxLength    int           `yaml:"maxLength"`    // по умолчанию 64 символа
+	BreachedList string        `yaml:"breachedList"` // файл с утёкшими паролями, по одному в строке
+	Cost         int           `yaml:"cost"`         // по умолчанию bcrypt.DefaultCost
+	ResetTTL     time.Duration `yaml:"resetTTL"`     // по умолчанию час
+}
+
+// TwoFactorConfig задаёт двухфакторную аутентификацию. Issuer — название сервиса,
+// которое показывают приложения-аутентификаторы, по умолчанию ChatGO. С RequireForAdmins
+// администраторы сервера не могут пользоваться своими правами, пока не включат её
+type TwoFactorConfig struct {
+	Issuer           string `yaml:"issuer"`
+	RequireForAdmins bool   `yaml:"requireForAdmins"`
 }
 
-func NewService(repository models.Repository, config *Config) interfaces.Service {
+// LockoutConfig задаёт блокировку входа после неудачных попыток. Каждая неудачная попытка
+// запрещает вход на Delay, удваивающийся с каждой следующей, а после MaxFailures попыток
+// подряд вход запрещается на Duration. Нулевые значения заменяются значениями по умолчанию
+type LockoutConfig struct {
+	MaxFailures int           `yaml:"maxFailures"` // по умолчанию 5
+	Delay       time.Duration `yaml:"delay"`       // по умолчанию секунда
+	Duration    time.Duration `yaml:"duration"`    // по умолчанию 15 минут
+}
+
+// RetentionConfig задаёт глобальную политику хранения сообщений и параметры фоновой очистки.
+// Нулевые MaxAgeDays и MaxMessages означают хранить сообщения без ограничений
+type RetentionConfig struct {
+	MaxAgeDays  int           `yaml:"maxAgeDays"`
+	MaxMessages int           `yaml:"maxMessages"`
+	Interval    time.Duration `yaml:"interval"`  // период запуска очистки, по умолчанию час
+	BatchSize   int           `yaml:"batchSize"` // число веток, удаляемых одной транзакцией
+	Archive     bool          `yaml:"archive"`   // переносить сообщения в архивные таблицы вместо удаления
+}
+
+// Validate проверяет, что в конфигурации задан корректный мастер-ключ и политика хранения
+func (c *Config) Validate() error {
+	if _, err := keyring.ParseMasterKey(c.MasterKey); err != nil {
+		return err
+	}
+	r := c.Retention
+	if r.MaxAgeDays < 0 || r.MaxMessages < 0 || r.Interval < 0 || r.BatchSize < 0 {
+		return errors.New("retention settings must not be negative")
+	}
+	l := c.Lockout
+	if l.MaxFailures < 0 || l.Delay < 0 || l.Duration < 0 {
+		return errors.New("lockout settings must not be negative")
+	}
+	p := c.Password
+	if p.MinLength < 0 || p.MaxLength < 0 || p.ResetTTL < 0 {
+		return errors.New("password settings must not be negative")
+	}
+	if p.MaxLength != 0 && p.MinLength > p.MaxLength {
+		return errors.New("password minLength must not exceed maxLength")
+	}
+	if _, err := webhook.ParseNetworks(c.Webhooks.AllowedNetworks); err != nil {
+		return err
+	}
+	if p.Cost != 0 && (p.Cost < bcrypt.MinCost || p.Cost > bcrypt.MaxCost) {
+		return fmt.Errorf("password cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	if p.BreachedList != "" {
+		if _, err := os.Stat(p.BreachedList); err != nil {
+			return fmt.Errorf("breached password list: %w", err)
+		}
+	}
+	return nil
+}
+
+func NewService(repository models.Repository, config *Config, blobs storage.BlobStore) interfaces.Service {
+	masterKey, err := keyring.ParseMasterKey(config.MasterKey)
+	if err != nil {
+		log.Printf("Encryption is unavailable: %v", err)
+	}
+
+	allowedNetworks, err := webhook.ParseNetworks(config.Webhooks.AllowedNetworks)
+	if err != nil {
+		log.Printf("Webhooks can't reach allowed internal networks: %v", err)
+	}
+
+	var breached map[string]struct{}
+	if config.Password.BreachedList != "" {
+		if breached, err = util.LoadPasswordList(config.Password.BreachedList); err != nil {
+			log.Printf("Breached passwords aren't checked: %v", err)
+		}
+	}
+
 	return &service{
 		repository,
 		time.Duration(2) * time.Second,
 		*config,
+		search.NewIndex(),
+		blobs,
+		keyring.New(repository, masterKey),
+		webhook.NewSender(webhookTimeout, allowedNetworks),
+		breached,
+		newDummyHash(config.Password.Cost),
 	}
 }
+
+// utcNow возвращает текущее время в UTC. Столбцы TIMESTAMP хранят время без часового пояса,
+// и база работает в UTC, поэтому время, которое пишется в базу или сравнивается с ней, берётся отсюда
+func utcNow() time.Time {
+	return time.Now().UTC()
+}
@@ -1,15 +1,34 @@
 package services
 
 import (
+	"bytes"
+	"chatgo/server/internal/keyring"
 	"chatgo/server/internal/models"
 	"context"
+	"encoding/base64"
+	"time"
 
 	"github.com/stretchr/testify/mock"
 )
 
+var testMasterKey = bytes.Repeat([]byte{42}, 32)
+
 var config = &Config{
-	secretKey:  "super_secret_key",
-	encryptKey: []byte{79, 85, 171, 46, 87, 74, 21, 200, 132, 109, 97, 192, 13, 104, 79, 132, 186, 137, 253, 43, 19, 74, 75, 51, 64, 35, 238, 142, 168, 103, 122, 195},
+	JWTKey:    "super_secret_key",
+	MasterKey: base64.StdEncoding.EncodeToString(testMasterKey),
+}
+
+// testDataKey is the version 1 data key of every room in tests
+var testDataKey = []byte{79, 85, 171, 46, 87, 74, 21, 200, 132, 109, 97, 192, 13, 104, 79, 132, 186, 137, 253, 43, 19, 74, 75, 51, 64, 35, 238, 142, 168, 103, 122, 195}
+
+// mockRoomKeys makes every room have testDataKey as its version 1 key
+func mockRoomKeys(m *MockRepository) {
+	wrapped, err := keyring.Wrap(testDataKey, testMasterKey)
+	if err != nil {
+		panic(err)
+	}
+	m.On("GetRoomKeys", mock.Anything, mock.Anything).
+		Return([]*models.RoomKey{{Version: 1, WrappedKey: wrapped}}, nil).Maybe()
 }
 
 // MockRepository is a mock implementation of models.Repository
@@ -58,6 +77,16 @@ func (m *MockRepository) DeleteChatRoom(ctx context.Context, chatRoom *models.Ch
 	return args.Error(0)
 }
 
+func (m *MockRepository) SetTopic(ctx context.Context, chatRoomID, topic string) error {
+	args := m.Called(ctx, chatRoomID, topic)
+	return args.Error(0)
+}
+
+func (m *MockRepository) SetMessageTTL(ctx context.Context, chatRoomID string, ttl int) error {
+	args := m.Called(ctx, chatRoomID, ttl)
+	return args.Error(0)
+}
+
 func (m *MockRepository) AddMember(ctx context.Context, member *models.ChatRoomMember) (*models.ChatRoomMember, error) {
 	args := m.Called(ctx, member)
 	if args.Get(0) == nil {
@@ -96,6 +125,19 @@ func (m *MockRepository) GetAllUsers(ctx context.Context) ([]*models.User, error
 	return args.Get(0).([]*models.User), args.Error(1)
 }
 
+func (m *MockRepository) GetUsersByIDs(ctx context.Context, ids []string) ([]*models.User, error) {
+	args := m.Called(ctx, ids)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.User), args.Error(1)
+}
+
+func (m *MockRepository) UpdateUserProfile(ctx context.Context, user *models.User) error {
+	args := m.Called(ctx, user)
+	return args.Error(0)
+}
+
 // Additional mock methods for message service tests
 func (m *MockRepository) CreateMessage(ctx context.Context, message *models.Message) (*models.Message, error) {
 	args := m.Called(ctx, message)
@@ -121,6 +163,30 @@ func (m *MockRepository) GetMessagesByChatRoomID(ctx context.Context, roomID str
 	return args.Get(0).([]*models.Message), args.Error(1)
 }
 
+func (m *MockRepository) GetMessagesInRange(ctx context.Context, chatRoomID string, from time.Time, afterID string, to time.Time, limit int) ([]*models.Message, error) {
+	args := m.Called(ctx, chatRoomID, from, afterID, to, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Message), args.Error(1)
+}
+
+func (m *MockRepository) GetMessagesAfterID(ctx context.Context, afterID string, limit int) ([]*models.Message, error) {
+	args := m.Called(ctx, afterID, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Message), args.Error(1)
+}
+
+func (m *MockRepository) GetThreadMessages(ctx context.Context, parentID string, limit int) ([]*models.Message, error) {
+	args := m.Called(ctx, parentID, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Message), args.Error(1)
+}
+
 func (m *MockRepository) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
 	args := m.Called(ctx, username)
 	if args.Get(0) == nil {
@@ -144,3 +210,557 @@ func (m *MockRepository) UpdateMemberRole(ctx context.Context, member *models.Ch
 	}
 	return args.Get(0).(*models.ChatRoomMember), args.Error(1)
 }
+
+// Additional mock methods for reaction service tests
+func (m *MockRepository) AddReaction(ctx context.Context, reaction *models.Reaction) (bool, error) {
+	args := m.Called(ctx, reaction)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRepository) DeleteReaction(ctx context.Context, reaction *models.Reaction) (bool, error) {
+	args := m.Called(ctx, reaction)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRepository) CreateScheduledMessage(ctx context.Context, message *models.ScheduledMessage) (*models.ScheduledMessage, error) {
+	args := m.Called(ctx, message)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.ScheduledMessage), args.Error(1)
+}
+
+func (m *MockRepository) GetPendingScheduledMessages(ctx context.Context, senderID, chatRoomID string) ([]*models.ScheduledMessage, error) {
+	args := m.Called(ctx, senderID, chatRoomID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.ScheduledMessage), args.Error(1)
+}
+
+func (m *MockRepository) CancelScheduledMessage(ctx context.Context, id, senderID string) (bool, error) {
+	args := m.Called(ctx, id, senderID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRepository) DeliverScheduledMessages(ctx context.Context, now time.Time, limit int) ([]*models.Message, error) {
+	args := m.Called(ctx, now, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Message), args.Error(1)
+}
+
+func (m *MockRepository) CreateBot(ctx context.Context, user *models.User, ownerID string) (*models.Bot, error) {
+	args := m.Called(ctx, user, ownerID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Bot), args.Error(1)
+}
+
+func (m *MockRepository) GetBotByUserID(ctx context.Context, userID string) (*models.Bot, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Bot), args.Error(1)
+}
+
+func (m *MockRepository) GetBotsByOwnerID(ctx context.Context, ownerID string) ([]*models.Bot, error) {
+	args := m.Called(ctx, ownerID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Bot), args.Error(1)
+}
+
+func (m *MockRepository) CreateBotToken(ctx context.Context, token *models.BotToken) (*models.BotToken, error) {
+	args := m.Called(ctx, token)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.BotToken), args.Error(1)
+}
+
+func (m *MockRepository) GetBotTokenByID(ctx context.Context, id string) (*models.BotToken, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.BotToken), args.Error(1)
+}
+
+func (m *MockRepository) GetBotTokenByHash(ctx context.Context, tokenHash string) (*models.BotToken, error) {
+	args := m.Called(ctx, tokenHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.BotToken), args.Error(1)
+}
+
+func (m *MockRepository) GetBotTokensByBotID(ctx context.Context, botID string) ([]*models.BotToken, error) {
+	args := m.Called(ctx, botID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.BotToken), args.Error(1)
+}
+
+func (m *MockRepository) RevokeBotToken(ctx context.Context, id string) (bool, error) {
+	args := m.Called(ctx, id)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRepository) TouchBotToken(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockRepository) CreateWebhook(ctx context.Context, webhook *models.Webhook) (*models.Webhook, error) {
+	args := m.Called(ctx, webhook)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Webhook), args.Error(1)
+}
+
+func (m *MockRepository) GetWebhookByID(ctx context.Context, id string) (*models.Webhook, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Webhook), args.Error(1)
+}
+
+func (m *MockRepository) GetWebhooksByChatRoomID(ctx context.Context, chatRoomID string) ([]*models.Webhook, error) {
+	args := m.Called(ctx, chatRoomID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Webhook), args.Error(1)
+}
+
+func (m *MockRepository) DeleteWebhook(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockRepository) EnqueueWebhookDeliveries(ctx context.Context, chatRoomID string, delivery *models.WebhookDelivery) (int, error) {
+	args := m.Called(ctx, chatRoomID, delivery)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockRepository) ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*models.WebhookDelivery, error) {
+	args := m.Called(ctx, now, lease, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.WebhookDelivery), args.Error(1)
+}
+
+func (m *MockRepository) UpdateWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	args := m.Called(ctx, delivery)
+	return args.Error(0)
+}
+
+func (m *MockRepository) GetWebhookDeliveries(ctx context.Context, webhookID, status string, limit int) ([]*models.WebhookDelivery, error) {
+	args := m.Called(ctx, webhookID, status, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.WebhookDelivery), args.Error(1)
+}
+
+func (m *MockRepository) CreatePoll(ctx context.Context, message *models.Message, poll *models.Poll) (*models.Message, *models.Poll, error) {
+	args := m.Called(ctx, message, poll)
+	if args.Get(0) == nil {
+		return nil, nil, args.Error(2)
+	}
+	return args.Get(0).(*models.Message), args.Get(1).(*models.Poll), args.Error(2)
+}
+
+func (m *MockRepository) GetPollByID(ctx context.Context, id string) (*models.Poll, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Poll), args.Error(1)
+}
+
+func (m *MockRepository) GetPollsByMessageIDs(ctx context.Context, messageIDs []string) ([]*models.Poll, error) {
+	args := m.Called(ctx, messageIDs)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Poll), args.Error(1)
+}
+
+func (m *MockRepository) SetPollVotes(ctx context.Context, pollID, userID string, options []int) (bool, error) {
+	args := m.Called(ctx, pollID, userID, options)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRepository) MarkPollClosed(ctx context.Context, id string) (bool, error) {
+	args := m.Called(ctx, id)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRepository) CloseDuePolls(ctx context.Context, now time.Time) ([]string, error) {
+	args := m.Called(ctx, now)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockRepository) GetReactionCountsByMessageIDs(ctx context.Context, messageIDs []string) ([]*models.ReactionCount, error) {
+	args := m.Called(ctx, messageIDs)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.ReactionCount), args.Error(1)
+}
+
+func (m *MockRepository) PinMessage(ctx context.Context, pin *models.PinnedMessage, max int) (bool, error) {
+	args := m.Called(ctx, pin, max)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRepository) UnpinMessage(ctx context.Context, chatRoomID, messageID string) (bool, error) {
+	args := m.Called(ctx, chatRoomID, messageID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRepository) GetPinnedMessages(ctx context.Context, chatRoomID string) ([]*models.PinnedMessage, error) {
+	args := m.Called(ctx, chatRoomID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.PinnedMessage), args.Error(1)
+}
+
+// Additional mock methods for mention service tests
+func (m *MockRepository) CreateMentions(ctx context.Context, mentions []*models.Mention) error {
+	args := m.Called(ctx, mentions)
+	return args.Error(0)
+}
+
+func (m *MockRepository) GetMentionsByUserID(ctx context.Context, userID string, unreadOnly bool, limit int) ([]*models.Mention, error) {
+	args := m.Called(ctx, userID, unreadOnly, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Mention), args.Error(1)
+}
+
+func (m *MockRepository) MarkMentionsRead(ctx context.Context, userID string, mentionIDs []string) error {
+	args := m.Called(ctx, userID, mentionIDs)
+	return args.Error(0)
+}
+
+// Additional mock methods for read receipt tests
+func (m *MockRepository) UpdateLastReadMessage(ctx context.Context, member *models.ChatRoomMember) (bool, error) {
+	args := m.Called(ctx, member)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRepository) GetLastMessagesByChatRoomIDs(ctx context.Context, chatRoomIDs []string) ([]*models.Message, error) {
+	args := m.Called(ctx, chatRoomIDs)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Message), args.Error(1)
+}
+
+func (m *MockRepository) GetUnreadCountsByUserID(ctx context.Context, userID string) (map[string]int, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[string]int), args.Error(1)
+}
+
+func (m *MockRepository) UpdateUserStatus(ctx context.Context, userID string, status models.UserStatus) (bool, error) {
+	args := m.Called(ctx, userID, status)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRepository) UpdateLastLogin(ctx context.Context, userID, ip string) error {
+	args := m.Called(ctx, userID, ip)
+	return args.Error(0)
+}
+
+func (m *MockRepository) RecordFailedLogin(ctx context.Context, userID string) (int, error) {
+	args := m.Called(ctx, userID)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockRepository) LockUser(ctx context.Context, userID string, until time.Time) error {
+	args := m.Called(ctx, userID, until)
+	return args.Error(0)
+}
+
+func (m *MockRepository) UnlockUser(ctx context.Context, userID string) (bool, error) {
+	args := m.Called(ctx, userID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRepository) CreateLoginAttempt(ctx context.Context, attempt *models.LoginAttempt) error {
+	args := m.Called(ctx, attempt)
+	return args.Error(0)
+}
+
+func (m *MockRepository) GetLoginAttempts(ctx context.Context, userID string, limit int) ([]*models.LoginAttempt, error) {
+	args := m.Called(ctx, userID, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.LoginAttempt), args.Error(1)
+}
+
+func (m *MockRepository) UpdatePasswordHash(ctx context.Context, userID, passwordHash string) error {
+	args := m.Called(ctx, userID, passwordHash)
+	return args.Error(0)
+}
+
+func (m *MockRepository) ChangePassword(ctx context.Context, userID, passwordHash string) (int, error) {
+	args := m.Called(ctx, userID, passwordHash)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockRepository) CreatePasswordReset(ctx context.Context, reset *models.PasswordReset) error {
+	args := m.Called(ctx, reset)
+	return args.Error(0)
+}
+
+func (m *MockRepository) ResetPassword(ctx context.Context, tokenHash, passwordHash string) (string, error) {
+	args := m.Called(ctx, tokenHash, passwordHash)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockRepository) SaveTOTP(ctx context.Context, totp *models.TOTP) (bool, error) {
+	args := m.Called(ctx, totp)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRepository) GetTOTP(ctx context.Context, userID string) (*models.TOTP, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.TOTP), args.Error(1)
+}
+
+func (m *MockRepository) EnableTOTP(ctx context.Context, userID string, step int64, recoveryCodeHashes []string) (bool, error) {
+	args := m.Called(ctx, userID, step, recoveryCodeHashes)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRepository) UseTOTPStep(ctx context.Context, userID string, step int64) (bool, error) {
+	args := m.Called(ctx, userID, step)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRepository) UseRecoveryCode(ctx context.Context, userID, codeHash string) (bool, error) {
+	args := m.Called(ctx, userID, codeHash)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRepository) DeleteTOTP(ctx context.Context, userID string) (bool, error) {
+	args := m.Called(ctx, userID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRepository) GetAllTOTP(ctx context.Context) ([]*models.TOTP, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.TOTP), args.Error(1)
+}
+
+func (m *MockRepository) CreateAttachment(ctx context.Context, attachment *models.Attachment) (*models.Attachment, error) {
+	args := m.Called(ctx, attachment)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Attachment), args.Error(1)
+}
+
+func (m *MockRepository) GetAttachmentByID(ctx context.Context, attachmentID string) (*models.Attachment, error) {
+	args := m.Called(ctx, attachmentID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Attachment), args.Error(1)
+}
+
+func (m *MockRepository) LinkAttachments(ctx context.Context, message *models.Message, attachmentIDs []string) (int64, error) {
+	args := m.Called(ctx, message, attachmentIDs)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockRepository) GetAttachmentsByMessageIDs(ctx context.Context, messageIDs []string) ([]*models.Attachment, error) {
+	args := m.Called(ctx, messageIDs)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Attachment), args.Error(1)
+}
+
+func (m *MockRepository) GetMessagesForReencryption(ctx context.Context, chatRoomID string, keyVersion int, afterID string, limit int) ([]*models.Message, error) {
+	args := m.Called(ctx, chatRoomID, keyVersion, afterID, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Message), args.Error(1)
+}
+
+func (m *MockRepository) UpdateMessageEncryption(ctx context.Context, message *models.Message, oldKeyVersion int) (bool, error) {
+	args := m.Called(ctx, message, oldKeyVersion)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRepository) GetAttachmentsForReencryption(ctx context.Context, chatRoomID string, keyVersion int, afterID string, limit int) ([]*models.Attachment, error) {
+	args := m.Called(ctx, chatRoomID, keyVersion, afterID, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Attachment), args.Error(1)
+}
+
+func (m *MockRepository) UpdateAttachmentEncryption(ctx context.Context, attachment *models.Attachment, oldStorageKey string) (bool, error) {
+	args := m.Called(ctx, attachment, oldStorageKey)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRepository) GetRoomKeys(ctx context.Context, chatRoomID string) ([]*models.RoomKey, error) {
+	args := m.Called(ctx, chatRoomID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.RoomKey), args.Error(1)
+}
+
+func (m *MockRepository) GetAllRoomKeys(ctx context.Context) ([]*models.RoomKey, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.RoomKey), args.Error(1)
+}
+
+func (m *MockRepository) CreateRoomKey(ctx context.Context, key *models.RoomKey) (bool, error) {
+	args := m.Called(ctx, key)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRepository) UpdateWrappedKeys(ctx context.Context, keys []*models.RoomKey, totps []*models.TOTP) error {
+	args := m.Called(ctx, keys, totps)
+	return args.Error(0)
+}
+
+func (m *MockRepository) UpsertUserKey(ctx context.Context, key *models.UserKey) error {
+	args := m.Called(ctx, key)
+	return args.Error(0)
+}
+
+func (m *MockRepository) GetUserKeysByChatRoomID(ctx context.Context, chatRoomID string) ([]*models.UserKey, error) {
+	args := m.Called(ctx, chatRoomID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.UserKey), args.Error(1)
+}
+
+func (m *MockRepository) GetImportMapping(ctx context.Context, source, kind, externalID string) (string, error) {
+	args := m.Called(ctx, source, kind, externalID)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockRepository) ImportUser(ctx context.Context, user *models.User, mapping *models.ImportMapping) (bool, error) {
+	args := m.Called(ctx, user, mapping)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRepository) ImportChatRoom(ctx context.Context, chatRoom *models.ChatRoom, mapping *models.ImportMapping) (bool, error) {
+	args := m.Called(ctx, chatRoom, mapping)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRepository) ImportMessage(ctx context.Context, message *models.Message, mapping *models.ImportMapping) (bool, error) {
+	args := m.Called(ctx, message, mapping)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRepository) GetRetentionPolicy(ctx context.Context, chatRoomID string) (*models.RetentionPolicy, error) {
+	args := m.Called(ctx, chatRoomID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.RetentionPolicy), args.Error(1)
+}
+
+func (m *MockRepository) GetRetentionPolicies(ctx context.Context) ([]*models.RetentionPolicy, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.RetentionPolicy), args.Error(1)
+}
+
+func (m *MockRepository) SetRetentionLimits(ctx context.Context, policy *models.RetentionPolicy) error {
+	args := m.Called(ctx, policy)
+	return args.Error(0)
+}
+
+func (m *MockRepository) SetLegalHold(ctx context.Context, chatRoomID string, hold bool) error {
+	args := m.Called(ctx, chatRoomID, hold)
+	return args.Error(0)
+}
+
+func (m *MockRepository) GetExpiredMessageIDs(ctx context.Context, chatRoomID string, before time.Time, limit int) ([]string, error) {
+	args := m.Called(ctx, chatRoomID, before, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockRepository) GetOverflowMessageIDs(ctx context.Context, chatRoomID string, keep int, limit int) ([]string, error) {
+	args := m.Called(ctx, chatRoomID, keep, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockRepository) PurgeMessages(ctx context.Context, messageIDs []string, archive bool) (*models.PurgedMessages, error) {
+	args := m.Called(ctx, messageIDs, archive)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.PurgedMessages), args.Error(1)
+}
+
+func (m *MockRepository) DeleteExpiredMessages(ctx context.Context, now time.Time, limit int) (*models.PurgedMessages, error) {
+	args := m.Called(ctx, now, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.PurgedMessages), args.Error(1)
+}
+
+func (m *MockRepository) CreateRetentionPurge(ctx context.Context, purge *models.RetentionPurge) error {
+	args := m.Called(ctx, purge)
+	return args.Error(0)
+}
+
+func (m *MockRepository) GetRetentionPurges(ctx context.Context, chatRoomID string, limit int) ([]*models.RetentionPurge, error) {
+	args := m.Called(ctx, chatRoomID, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.RetentionPurge), args.Error(1)
+}
@@ -0,0 +1,292 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"chatgo/server/internal/interfaces"
+	"chatgo/server/internal/keyring"
+	"chatgo/server/internal/models"
+	"chatgo/server/internal/qrcode"
+	"chatgo/server/internal/totp"
+)
+
+const (
+	defaultTwoFactorIssuer = "ChatGO"
+	// twoFactorPurpose — назначение токена второго шага входа
+	twoFactorPurpose = "2fa"
+	// twoFactorLoginTTL — сколько времени даётся на ввод кода после пароля
+	twoFactorLoginTTL = 5 * time.Minute
+	recoveryCodeCount = 10
+	// recoveryCodeSize — длина кода восстановления в байтах, 16 символов base32
+	recoveryCodeSize = 10
+)
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// EnrollTwoFactor создаёт новый TOTP-секрет пользователя. Вход его не требует, пока
+// пользователь не подтвердит его кодом из приложения
+func (s *service) EnrollTwoFactor(c context.Context, userID string) (*interfaces.TwoFactorEnrollRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	user, err := s.Repository.GetUserByID(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && user == nil) {
+		return nil, interfaces.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := s.keys.Seal(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	saved, err := s.Repository.SaveTOTP(ctx, &models.TOTP{UserID: userID, EncryptedSecret: sealed})
+	if err != nil {
+		return nil, err
+	}
+	if !saved {
+		return nil, interfaces.ErrTwoFactorEnabled
+	}
+
+	issuer := s.TwoFactor.Issuer
+	if issuer == "" {
+		issuer = defaultTwoFactorIssuer
+	}
+	uri := totp.URI(issuer, user.Username, secret)
+	code, err := qrcode.Encode([]byte(uri))
+	if err != nil {
+		return nil, err
+	}
+
+	return &interfaces.TwoFactorEnrollRes{
+		Secret: totp.EncodeSecret(secret),
+		URI:    uri,
+		QRCode: code.Text(),
+	}, nil
+}
+
+// ConfirmTwoFactor включает двухфакторную аутентификацию, если код подходит к новому секрету,
+// и выдаёт коды восстановления. Коды показываются один раз, хранятся только их хеши
+func (s *service) ConfirmTwoFactor(c context.Context, req *interfaces.TwoFactorCodeReq) (*interfaces.TwoFactorConfirmRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	stored, err := s.Repository.GetTOTP(ctx, req.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil {
+		return nil, interfaces.ErrTwoFactorNotEnrolled
+	}
+	if stored.Enabled {
+		return nil, interfaces.ErrTwoFactorEnabled
+	}
+
+	secret, err := s.keys.Open(stored.EncryptedSecret)
+	if err != nil {
+		return nil, err
+	}
+	step, ok := totp.Validate(secret, req.Code, time.Now())
+	if !ok {
+		return nil, interfaces.ErrInvalidTwoFactorCode
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	// Не включается, если секрет заменили повторной регистрацией или код уже использован
+	enabled, err := s.Repository.EnableTOTP(ctx, req.UserID, step, hashes)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		return nil, interfaces.ErrInvalidTwoFactorCode
+	}
+
+	log.Printf("User %s enabled two-factor authentication", req.UserID)
+	return &interfaces.TwoFactorConfirmRes{RecoveryCodes: codes}, nil
+}
+
+// DisableTwoFactor выключает двухфакторную аутентификацию, если код подходит.
+// Неподтверждённый секрет удаляется без кода. Администраторы не могут её выключить,
+// если она для них обязательна
+func (s *service) DisableTwoFactor(c context.Context, req *interfaces.TwoFactorCodeReq) error {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	if s.TwoFactor.RequireForAdmins && s.isServerAdmin(req.UserID) {
+		return interfaces.ErrAdminTwoFactorRequired
+	}
+
+	stored, err := s.Repository.GetTOTP(ctx, req.UserID)
+	if err != nil {
+		return err
+	}
+	if stored == nil {
+		return interfaces.ErrTwoFactorNotEnrolled
+	}
+
+	if stored.Enabled {
+		ok, err := s.checkTwoFactorCode(ctx, stored, req.Code)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return interfaces.ErrInvalidTwoFactorCode
+		}
+	}
+
+	if _, err := s.Repository.DeleteTOTP(ctx, req.UserID); err != nil {
+		return err
+	}
+
+	log.Printf("User %s disabled two-factor authentication", req.UserID)
+	return nil
+}
+
+// LoginTwoFactor завершает вход с двухфакторной аутентификацией: проверяет токен, выданный
+// после пароля, и код. Неверные коды блокируют вход так же, как неверные пароли
+func (s *service) LoginTwoFactor(c context.Context, req *interfaces.LoginTwoFactorReq) (*interfaces.LoginUserRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	claims, err := s.parseToken(req.Token)
+	if err != nil || claims.Purpose != twoFactorPurpose {
+		return &interfaces.LoginUserRes{}, interfaces.ErrLoginExpired
+	}
+
+	u, err := s.Repository.GetUserByID(ctx, claims.ID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && u == nil) {
+		return &interfaces.LoginUserRes{}, interfaces.ErrLoginExpired
+	}
+	if err != nil {
+		log.Printf("Failed to get user %s to log in: %v", claims.ID, err)
+		return &interfaces.LoginUserRes{}, errLoginFailed
+	}
+	// Пароль сменили после первого шага
+	if u.TokenVersion != claims.Version {
+		return &interfaces.LoginUserRes{}, interfaces.ErrLoginExpired
+	}
+
+	if u.LockedUntil.Valid && utcNow().Before(u.LockedUntil.Time) {
+		s.recordLoginAttempt(ctx, u.ID, req.IP, req.UserAgent, models.LoginLocked)
+		return &interfaces.LoginUserRes{}, &interfaces.LockedError{Until: u.LockedUntil.Time}
+	}
+
+	stored, err := s.Repository.GetTOTP(ctx, u.ID)
+	if err != nil {
+		log.Printf("Failed to get TOTP of user %s to log in: %v", u.ID, err)
+		return &interfaces.LoginUserRes{}, errLoginFailed
+	}
+	// Двухфакторную аутентификацию выключили после пароля
+	if stored == nil || !stored.Enabled {
+		return &interfaces.LoginUserRes{}, interfaces.ErrLoginExpired
+	}
+
+	ok, err := s.checkTwoFactorCode(ctx, stored, req.Code)
+	if err != nil {
+		log.Printf("Failed to check two-factor code of user %s: %v", u.ID, err)
+		return &interfaces.LoginUserRes{}, errLoginFailed
+	}
+	if !ok {
+		s.recordFailedLogin(ctx, u.ID)
+		s.recordLoginAttempt(ctx, u.ID, req.IP, req.UserAgent, models.LoginBadCode)
+		return &interfaces.LoginUserRes{}, interfaces.ErrInvalidTwoFactorCode
+	}
+
+	return s.completeLogin(ctx, u, req.IP, req.UserAgent, true)
+}
+
+// checkTwoFactorCode проверяет код из приложения или код восстановления и отмечает его
+// использованным, чтобы его нельзя было ввести ещё раз
+func (s *service) checkTwoFactorCode(ctx context.Context, stored *models.TOTP, code string) (bool, error) {
+	secret, err := s.keys.Open(stored.EncryptedSecret)
+	if err != nil {
+		return false, err
+	}
+
+	if step, ok := totp.Validate(secret, code, time.Now()); ok {
+		if step <= stored.LastUsedStep {
+			return false, nil
+		}
+		return s.Repository.UseTOTPStep(ctx, stored.UserID, step)
+	}
+
+	code = normalizeRecoveryCode(code)
+	if len(code) != recoveryCodeEncoding.EncodedLen(recoveryCodeSize) {
+		return false, nil
+	}
+	return s.Repository.UseRecoveryCode(ctx, stored.UserID, hashRecoveryCode(code))
+}
+
+// generateRecoveryCodes возвращает новые коды восстановления в виде xxxx-xxxx-xxxx-xxxx и их хеши
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		random := make([]byte, recoveryCodeSize)
+		if _, err := rand.Read(random); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(recoveryCodeEncoding.EncodeToString(random))
+		hashes = append(hashes, hashRecoveryCode(code))
+
+		var parts []string
+		for j := 0; j < len(code); j += 4 {
+			parts = append(parts, code[j:j+4])
+		}
+		codes = append(codes, strings.Join(parts, "-"))
+	}
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode убирает дефисы и пробелы и приводит код к нижнему регистру
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+// hashRecoveryCode возвращает хеш кода восстановления, по которому он хранится. Коды случайные
+// и длинные, поэтому, как и для токенов ботов, соль и медленный хеш не нужны
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// rewrapTOTPSecrets возвращает TOTP-секреты, зашифрованные мастер-ключом newMaster. Секреты
+// расшифровываются текущим ключом и не сохраняются, их сохраняет RewrapKeys вместе с ключами чатов
+func (s *service) rewrapTOTPSecrets(ctx context.Context, newMaster []byte) ([]*models.TOTP, error) {
+	totps, err := s.Repository.GetAllTOTP(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, t := range totps {
+		secret, err := s.keys.Open(t.EncryptedSecret)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open TOTP secret of user %s: %w", t.UserID, err)
+		}
+		if t.EncryptedSecret, err = keyring.Wrap(secret, newMaster); err != nil {
+			return nil, err
+		}
+	}
+
+	return totps, nil
+}
@@ -0,0 +1,188 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"chatgo/server/internal/interfaces"
+	"chatgo/server/internal/keyring"
+	"chatgo/server/internal/models"
+	"chatgo/server/internal/totp"
+	"chatgo/server/internal/util"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// sealedTOTP returns a TOTP secret and its stored form, sealed with testMasterKey
+func sealedTOTP(t *testing.T, userID string, enabled bool) ([]byte, *models.TOTP) {
+	secret, err := totp.GenerateSecret()
+	require.NoError(t, err)
+	sealed, err := keyring.Wrap(secret, testMasterKey)
+	require.NoError(t, err)
+	return secret, &models.TOTP{UserID: userID, EncryptedSecret: sealed, Enabled: enabled}
+}
+
+func TestService_EnrollTwoFactor(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewService(mockRepo, config, nil)
+
+	var sealed string
+	mockRepo.On("GetUserByID", mock.Anything, "1").Return(&models.User{ID: "1", Username: "alice"}, nil)
+	mockRepo.On("SaveTOTP", mock.Anything, mock.MatchedBy(func(t *models.TOTP) bool {
+		sealed = t.EncryptedSecret
+		return t.UserID == "1" && !t.Enabled
+	})).Return(true, nil).Once()
+
+	res, err := service.EnrollTwoFactor(context.Background(), "1")
+	require.NoError(t, err)
+	assert.Contains(t, res.URI, "otpauth://totp/ChatGO:alice?")
+	assert.Contains(t, res.URI, "secret="+res.Secret)
+	assert.NotEmpty(t, res.QRCode)
+
+	// Only the sealed secret is stored
+	assert.NotContains(t, sealed, res.Secret)
+	secret, err := keyring.Unwrap(sealed, testMasterKey)
+	require.NoError(t, err)
+	assert.Equal(t, res.Secret, totp.EncodeSecret(secret))
+
+	mockRepo.On("SaveTOTP", mock.Anything, mock.Anything).Return(false, nil).Once()
+	_, err = service.EnrollTwoFactor(context.Background(), "1")
+	assert.ErrorIs(t, err, interfaces.ErrTwoFactorEnabled)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_ConfirmTwoFactor(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewService(mockRepo, config, nil)
+
+	secret, stored := sealedTOTP(t, "1", false)
+	now := time.Now()
+	mockRepo.On("GetTOTP", mock.Anything, "1").Return(stored, nil)
+	mockRepo.On("GetTOTP", mock.Anything, "2").Return(nil, nil)
+
+	var hashes []string
+	mockRepo.On("EnableTOTP", mock.Anything, "1", totp.Step(now), mock.MatchedBy(func(h []string) bool {
+		hashes = h
+		return len(h) == recoveryCodeCount
+	})).Return(true, nil)
+
+	_, err := service.ConfirmTwoFactor(context.Background(), &interfaces.TwoFactorCodeReq{UserID: "2", Code: "123456"})
+	assert.ErrorIs(t, err, interfaces.ErrTwoFactorNotEnrolled)
+
+	_, err = service.ConfirmTwoFactor(context.Background(), &interfaces.TwoFactorCodeReq{UserID: "1", Code: "12345"})
+	assert.ErrorIs(t, err, interfaces.ErrInvalidTwoFactorCode)
+
+	res, err := service.ConfirmTwoFactor(context.Background(), &interfaces.TwoFactorCodeReq{UserID: "1", Code: totp.Code(secret, totp.Step(now))})
+	require.NoError(t, err)
+	require.Len(t, res.RecoveryCodes, recoveryCodeCount)
+	for i, code := range res.RecoveryCodes {
+		assert.Len(t, code, 19)
+		assert.Equal(t, hashes[i], hashRecoveryCode(normalizeRecoveryCode(code)))
+	}
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_DisableTwoFactor(t *testing.T) {
+	cfg := *config
+	cfg.Admins = []string{"9"}
+	cfg.TwoFactor.RequireForAdmins = true
+	mockRepo := new(MockRepository)
+	service := NewService(mockRepo, &cfg, nil)
+
+	secret, stored := sealedTOTP(t, "1", true)
+	step := totp.Step(time.Now())
+	mockRepo.On("GetTOTP", mock.Anything, "1").Return(stored, nil)
+	mockRepo.On("UseRecoveryCode", mock.Anything, "1", mock.Anything).Return(false, nil)
+	mockRepo.On("UseTOTPStep", mock.Anything, "1", step).Return(true, nil)
+	mockRepo.On("DeleteTOTP", mock.Anything, "1").Return(true, nil)
+
+	err := service.DisableTwoFactor(context.Background(), &interfaces.TwoFactorCodeReq{UserID: "9", Code: "123456"})
+	assert.ErrorIs(t, err, interfaces.ErrAdminTwoFactorRequired)
+
+	err = service.DisableTwoFactor(context.Background(), &interfaces.TwoFactorCodeReq{UserID: "1", Code: "aaaa-bbbb-cccc-dddd"})
+	assert.ErrorIs(t, err, interfaces.ErrInvalidTwoFactorCode)
+	mockRepo.AssertNotCalled(t, "DeleteTOTP", mock.Anything, mock.Anything)
+
+	err = service.DisableTwoFactor(context.Background(), &interfaces.TwoFactorCodeReq{UserID: "1", Code: totp.Code(secret, step)})
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_LoginTwoFactor(t *testing.T) {
+	mockRepo := new(MockRepository)
+	s := NewService(mockRepo, config, nil).(*service)
+
+	user := &models.User{ID: "1", Username: "alice"}
+	secret, stored := sealedTOTP(t, "1", true)
+	stored.LastUsedStep = totp.Step(time.Now()) - 5
+
+	mockRepo.On("GetUserByID", mock.Anything, "1").Return(user, nil)
+	mockRepo.On("GetTOTP", mock.Anything, "1").Return(stored, nil)
+
+	// The password step only hands out a challenge token, which isn't an access token
+	login, err := s.signToken(user, twoFactorPurpose, twoFactorLoginTTL)
+	require.NoError(t, err)
+	_, err = s.ValidateToken(context.Background(), login)
+	assert.Error(t, err)
+
+	_, err = s.LoginTwoFactor(context.Background(), &interfaces.LoginTwoFactorReq{Token: "garbage", Code: "123456"})
+	assert.ErrorIs(t, err, interfaces.ErrLoginExpired)
+
+	// An access token can't be used in place of the challenge token
+	access, err := s.signToken(user, "", accessTokenTTL)
+	require.NoError(t, err)
+	_, err = s.LoginTwoFactor(context.Background(), &interfaces.LoginTwoFactorReq{Token: access, Code: "123456"})
+	assert.ErrorIs(t, err, interfaces.ErrLoginExpired)
+
+	// A wrong code counts as a failed login
+	mockRepo.On("RecordFailedLogin", mock.Anything, "1").Return(1, nil).Once()
+	mockRepo.On("LockUser", mock.Anything, "1", mock.Anything).Return(nil).Once()
+	mockRepo.On("CreateLoginAttempt", mock.Anything, mock.MatchedBy(func(a *models.LoginAttempt) bool {
+		return !a.Success && a.Reason == models.LoginBadCode
+	})).Return(nil).Once()
+	_, err = s.LoginTwoFactor(context.Background(), &interfaces.LoginTwoFactorReq{Token: login, Code: "abcdef"})
+	assert.ErrorIs(t, err, interfaces.ErrInvalidTwoFactorCode)
+
+	// A recovery code is accepted in place of the TOTP code
+	code := "AAAA-BBBB-CCCC-DDDD"
+	mockRepo.On("UseRecoveryCode", mock.Anything, "1", hashRecoveryCode("aaaabbbbccccdddd")).Return(true, nil).Once()
+	mockRepo.On("UpdateLastLogin", mock.Anything, "1", "10.0.0.1").Return(nil)
+	mockRepo.On("CreateLoginAttempt", mock.Anything, mock.MatchedBy(func(a *models.LoginAttempt) bool {
+		return a.Success
+	})).Return(nil)
+	res, err := s.LoginTwoFactor(context.Background(), &interfaces.LoginTwoFactorReq{Token: login, Code: code, IP: "10.0.0.1"})
+	require.NoError(t, err)
+	got, err := s.ValidateToken(context.Background(), res.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, "1", got.ID)
+
+	// A TOTP code of a step already used is replayed and refused
+	replayed := *stored
+	replayed.LastUsedStep = totp.Step(time.Now()) + 1
+	ok, err := s.checkTwoFactorCode(context.Background(), &replayed, totp.Code(secret, totp.Step(time.Now())))
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	mockRepo.AssertNotCalled(t, "UseTOTPStep", mock.Anything, mock.Anything, mock.Anything)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_Login_TwoFactor(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewService(mockRepo, config, nil)
+
+	hashedPassword, err := util.HashPassword("password123", 0)
+	require.NoError(t, err)
+	_, stored := sealedTOTP(t, "1", true)
+	mockRepo.On("GetUserByUsername", mock.Anything, "alice").Return(&models.User{ID: "1", Username: "alice", EncryptedPassword: hashedPassword}, nil)
+	mockRepo.On("GetTOTP", mock.Anything, "1").Return(stored, nil)
+
+	res, err := service.Login(context.Background(), &interfaces.LoginUserReq{Username: "alice", Password: "password123"})
+	require.NoError(t, err)
+	assert.True(t, res.TwoFactorRequired)
+	assert.NotEmpty(t, res.TwoFactorToken)
+	assert.Empty(t, res.AccessToken)
+	mockRepo.AssertNotCalled(t, "UpdateLastLogin", mock.Anything, mock.Anything, mock.Anything)
+}
@@ -2,7 +2,11 @@ package services
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"log"
+	"slices"
 	"time"
 
 	"chatgo/server/internal/interfaces"
@@ -16,7 +20,17 @@ func (s *service) CreateUser(c context.Context, req *interfaces.CreateUserReq) (
 	ctx, cancel := context.WithTimeout(c, s.timeout)
 	defer cancel()
 
-	hashedPassword, err := util.HashPassword(req.Password)
+	if err := s.validateUsername(req.Username); err != nil {
+		return nil, err
+	}
+	if err := s.checkPasswordPolicy(req.Password); err != nil {
+		return nil, err
+	}
+	if err := s.checkUsernameAvailable(ctx, req.Username); err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := util.HashPassword(req.Password, s.Password.Cost)
 	if err != nil {
 		return nil, err
 	}
@@ -40,9 +54,28 @@ func (s *service) CreateUser(c context.Context, req *interfaces.CreateUserReq) (
 	return res, nil
 }
 
+const (
+	defaultMaxFailedLogins  = 5
+	defaultFailedLoginDelay = time.Second
+	defaultLockoutDuration  = 15 * time.Minute
+	defaultLoginHistory     = 20
+	maxLoginHistory         = 100
+	accessTokenTTL          = 24 * time.Hour
+)
+
+// dummyPasswordHash — bcrypt-хеш, с которым сравнивается пароль, если пользователь не найден
+const dummyPasswordHash = "$2a$10$15dqTO1ywbVcV0AbK91f6.476.E1zi8aNz0g8w0ibRKYdjzrnGxpe"
+
+// errLoginFailed скрывает ошибки базы данных при входе
+var errLoginFailed = errors.New("login failed, try again later")
+
 type MyJWTClaims struct {
 	ID       string `json:"id"`
 	Username string `json:"username"`
+	// Purpose ограничивает, для чего годится токен. У токена доступа он пустой
+	Purpose string `json:"purpose,omitempty"`
+	// Version — версия токенов пользователя на момент выдачи, смена пароля отзывает токены прежних версий
+	Version int `json:"ver,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -51,33 +84,270 @@ func (s *service) Login(c context.Context, req *interfaces.LoginUserReq) (*inter
 	defer cancel()
 
 	u, err := s.Repository.GetUserByUsername(ctx, req.Username)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && u == nil) {
+		// Проверяем пароль и для несуществующего пользователя, чтобы по времени ответа
+		// нельзя было понять, есть ли такой аккаунт
+		util.CheckPassword(req.Password, s.dummyHash, s.Password.Cost)
+		return &interfaces.LoginUserRes{}, interfaces.ErrInvalidCredentials
+	}
 	if err != nil {
-		fmt.Println("After getting user by username")
-		return &interfaces.LoginUserRes{}, err
+		log.Printf("Failed to get user %q to log in: %v", req.Username, err)
+		return &interfaces.LoginUserRes{}, errLoginFailed
+	}
+
+	// У ботов нет пароля, они входят только по API-токенам
+	if u.IsBot {
+		return &interfaces.LoginUserRes{}, interfaces.ErrInvalidCredentials
+	}
+
+	// Пока аккаунт заблокирован, пароль не проверяется, иначе блокировка не мешала бы подбору.
+	// Ответ тот же, что и для несуществующего пользователя, чтобы блокировка не выдавала аккаунт
+	if u.LockedUntil.Valid && utcNow().Before(u.LockedUntil.Time) {
+		util.CheckPassword(req.Password, s.dummyHash, s.Password.Cost)
+		s.recordLoginAttempt(ctx, u.ID, req.IP, req.UserAgent, models.LoginLocked)
+		return &interfaces.LoginUserRes{}, interfaces.ErrInvalidCredentials
+	}
+
+	rehashed, err := util.CheckPassword(req.Password, u.EncryptedPassword, s.Password.Cost)
+	if err != nil {
+		s.recordFailedLogin(ctx, u.ID)
+		s.recordLoginAttempt(ctx, u.ID, req.IP, req.UserAgent, models.LoginBadPassword)
+		return &interfaces.LoginUserRes{}, interfaces.ErrInvalidCredentials
+	}
+	// Стоимость bcrypt в конфигурации повысили, пароль известен только сейчас
+	if rehashed != "" {
+		if err := s.Repository.UpdatePasswordHash(ctx, u.ID, rehashed); err != nil {
+			log.Printf("Failed to rehash the password of user %s: %v", u.ID, err)
+		}
+	}
+
+	stored, err := s.Repository.GetTOTP(ctx, u.ID)
+	if err != nil {
+		log.Printf("Failed to get TOTP of user %s to log in: %v", u.ID, err)
+		return &interfaces.LoginUserRes{}, errLoginFailed
+	}
+	twoFactor := stored != nil && stored.Enabled
+
+	// С двухфакторной аутентификацией вместо токена доступа выдаётся короткий токен второго шага
+	if twoFactor {
+		token, err := s.signToken(u, twoFactorPurpose, twoFactorLoginTTL)
+		if err != nil {
+			return &interfaces.LoginUserRes{}, err
+		}
+		return &interfaces.LoginUserRes{ID: u.ID, Username: u.Username, TwoFactorRequired: true, TwoFactorToken: token}, nil
+	}
+
+	return s.completeLogin(ctx, u, req.IP, req.UserAgent, twoFactor)
+}
+
+// completeLogin запоминает успешный вход и выдаёт токен доступа
+func (s *service) completeLogin(ctx context.Context, u *models.User, ip, userAgent string, twoFactor bool) (*interfaces.LoginUserRes, error) {
+	if err := s.Repository.UpdateLastLogin(ctx, u.ID, ip); err != nil {
+		log.Printf("Failed to update last login of user %s: %v", u.ID, err)
 	}
+	s.recordLoginAttempt(ctx, u.ID, ip, userAgent, "")
 
-	err = util.CheckPassword(req.Password, u.EncryptedPassword)
+	ss, err := s.signToken(u, "", accessTokenTTL)
 	if err != nil {
-		fmt.Println("After checking password")
 		return &interfaces.LoginUserRes{}, err
 	}
 
+	return &interfaces.LoginUserRes{
+		AccessToken:            ss,
+		Username:               u.Username,
+		ID:                     u.ID,
+		TwoFactorSetupRequired: s.TwoFactor.RequireForAdmins && s.isServerAdmin(u.ID) && !twoFactor,
+	}, nil
+}
+
+// signToken выдаёт пользователю JWT с назначением purpose, действующий ttl
+func (s *service) signToken(u *models.User, purpose string, ttl time.Duration) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, MyJWTClaims{
 		ID:       u.ID,
 		Username: u.Username,
+		Purpose:  purpose,
+		Version:  u.TokenVersion,
 		RegisteredClaims: jwt.RegisteredClaims{
 			Issuer:    u.ID,
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
 		},
 	})
 
-	ss, err := token.SignedString([]byte(s.secretKey))
+	return token.SignedString([]byte(s.JWTKey))
+}
+
+// recordFailedLogin увеличивает счётчик неудачных входов и блокирует вход на время, растущее с их числом
+func (s *service) recordFailedLogin(ctx context.Context, userID string) {
+	failures, err := s.Repository.RecordFailedLogin(ctx, userID)
 	if err != nil {
-		fmt.Println("After signing token")
-		return &interfaces.LoginUserRes{}, err
+		log.Printf("Failed to record failed login of user %s: %v", userID, err)
+		return
+	}
+	if err := s.Repository.LockUser(ctx, userID, utcNow().Add(s.lockoutDelay(failures))); err != nil {
+		log.Printf("Failed to lock user %s: %v", userID, err)
 	}
+}
 
-	return &interfaces.LoginUserRes{AccessToken: ss, Username: u.Username, ID: u.ID}, nil
+// lockoutDelay возвращает, на сколько блокируется вход после failures неудачных попыток подряд:
+// Delay, удваивающийся с каждой попыткой, а начиная с MaxFailures попыток — Duration
+func (s *service) lockoutDelay(failures int) time.Duration {
+	maxFailures, delay, duration := s.Lockout.MaxFailures, s.Lockout.Delay, s.Lockout.Duration
+	if maxFailures == 0 {
+		maxFailures = defaultMaxFailedLogins
+	}
+	if delay == 0 {
+		delay = defaultFailedLoginDelay
+	}
+	if duration == 0 {
+		duration = defaultLockoutDuration
+	}
+
+	if failures >= maxFailures {
+		return duration
+	}
+	return min(delay<<(failures-1), duration)
+}
+
+// recordLoginAttempt добавляет попытку входа в историю входов пользователя.
+// Пустая причина означает успешный вход
+func (s *service) recordLoginAttempt(ctx context.Context, userID, ip, userAgent, reason string) {
+	attempt := &models.LoginAttempt{
+		UserID:    userID,
+		IP:        ip,
+		UserAgent: userAgent,
+		Success:   reason == "",
+		Reason:    reason,
+	}
+	if err := s.Repository.CreateLoginAttempt(ctx, attempt); err != nil {
+		log.Printf("Failed to record login attempt of user %s: %v", userID, err)
+	}
+}
+
+// GetLoginHistory возвращает последние попытки входа в аккаунт пользователя, новые первыми
+func (s *service) GetLoginHistory(c context.Context, userID string, limit int) ([]*interfaces.LoginAttemptRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	if limit <= 0 {
+		limit = defaultLoginHistory
+	}
+	if limit > maxLoginHistory {
+		limit = maxLoginHistory
+	}
+
+	attempts, err := s.Repository.GetLoginAttempts(ctx, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*interfaces.LoginAttemptRes, 0, len(attempts))
+	for _, a := range attempts {
+		res = append(res, &interfaces.LoginAttemptRes{
+			IP:        a.IP,
+			UserAgent: a.UserAgent,
+			Success:   a.Success,
+			Reason:    a.Reason,
+			CreatedAt: a.CreatedAt,
+		})
+	}
+	return res, nil
+}
+
+// UnlockUser снимает блокировку входа с аккаунта username. Доступно только администраторам сервера
+func (s *service) UnlockUser(c context.Context, adminID, username string) error {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	if err := s.checkServerAdmin(ctx, adminID); err != nil {
+		return err
+	}
+
+	user, err := s.getUserByUsername(ctx, username)
+	if err != nil {
+		return err
+	}
+
+	unlocked, err := s.Repository.UnlockUser(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	if !unlocked {
+		return interfaces.ErrUserNotFound
+	}
+
+	log.Printf("User %s was unlocked by admin %s", user.ID, adminID)
+	return nil
+}
+
+// checkServerAdmin проверяет, что пользователь указан в списке администраторов сервера,
+// и, если этого требует конфигурация, что у него включена двухфакторная аутентификация
+func (s *service) checkServerAdmin(ctx context.Context, userID string) error {
+	if !s.isServerAdmin(userID) {
+		return interfaces.ErrNotServerAdmin
+	}
+
+	if s.TwoFactor.RequireForAdmins {
+		stored, err := s.Repository.GetTOTP(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if stored == nil || !stored.Enabled {
+			return interfaces.ErrAdminTwoFactorRequired
+		}
+	}
+	return nil
+}
+
+// isServerAdmin сообщает, указан ли ID пользователя в списке администраторов сервера
+func (s *service) isServerAdmin(userID string) bool {
+	return userID != "" && slices.Contains(s.Admins, userID)
+}
+
+// ValidateToken проверяет подпись и срок действия JWT, выданного при входе, и то, что он
+// не отозван сменой пароля, и возвращает пользователя, которому он принадлежит
+func (s *service) ValidateToken(c context.Context, token string) (*interfaces.GetUserRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	claims, err := s.parseToken(token)
+	if err != nil {
+		return nil, err
+	}
+	// Токен второго шага входа не даёт доступа
+	if claims.Purpose != "" {
+		return nil, errors.New("invalid token")
+	}
+
+	u, err := s.Repository.GetUserByID(ctx, claims.ID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && u == nil) {
+		return nil, errors.New("invalid token")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if u.TokenVersion != claims.Version {
+		return nil, errors.New("token has been revoked")
+	}
+
+	return &interfaces.GetUserRes{ID: u.ID, Username: u.Username, Bot: u.IsBot}, nil
+}
+
+// parseToken проверяет подпись и срок действия JWT и возвращает его данные
+func (s *service) parseToken(token string) (*MyJWTClaims, error) {
+	claims := &MyJWTClaims{}
+	parsed, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", t.Header["alg"])
+		}
+		return []byte(s.JWTKey), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !parsed.Valid || claims.ID == "" {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
 }
 
 func (s *service) GetUserByID(c context.Context, req *interfaces.GetUserReq) (*interfaces.GetUserRes, error) {
@@ -89,10 +359,7 @@ func (s *service) GetUserByID(c context.Context, req *interfaces.GetUserReq) (*i
 		return nil, err
 	}
 
-	return &interfaces.GetUserRes{
-		ID:       u.ID,
-		Username: u.Username,
-	}, nil
+	return toUserRes(u), nil
 }
 
 func (s *service) GetAllUsers(c context.Context) ([]*interfaces.GetUserRes, error) {
@@ -106,11 +373,26 @@ func (s *service) GetAllUsers(c context.Context) ([]*interfaces.GetUserRes, erro
 
 	result := make([]*interfaces.GetUserRes, 0, len(users))
 	for _, u := range users {
-		result = append(result, &interfaces.GetUserRes{
-			ID:       u.ID,
-			Username: u.Username,
-		})
+		result = append(result, toUserRes(u))
 	}
 
 	return result, nil
 }
+
+// toUserRes преобразует пользователя в ответ со статусом присутствия
+func toUserRes(u *models.User) *interfaces.GetUserRes {
+	res := &interfaces.GetUserRes{
+		ID:          u.ID,
+		Username:    u.Username,
+		DisplayName: u.DisplayName,
+		Status:      string(u.Status),
+		StatusText:  u.StatusText,
+	}
+	if u.LastLogin.Valid {
+		res.LastLogin = u.LastLogin.Time.Format(time.RFC3339)
+	}
+	if u.LastSeenAt.Valid {
+		res.LastSeenAt = u.LastSeenAt.Time.Format(time.RFC3339)
+	}
+	return res
+}
@@ -3,16 +3,21 @@ package services
 import (
 	"chatgo/server/internal/interfaces"
 	"chatgo/server/internal/models"
+	"chatgo/server/internal/util"
 	"context"
+	"database/sql"
+	"errors"
 	"testing"
+	"time"
 
+	"github.com/golang-jwt/jwt/v4"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
 
 func TestService_CreateUser(t *testing.T) {
 	mockRepo := new(MockRepository)
-	service := NewService(mockRepo, config)
+	service := NewService(mockRepo, config, nil)
 
 	req := &interfaces.CreateUserReq{
 		Username: "testuser",
@@ -25,6 +30,7 @@ func TestService_CreateUser(t *testing.T) {
 		EncryptedPassword: "hashedpassword",
 	}
 
+	mockRepo.On("GetUserByUsername", mock.Anything, req.Username).Return(nil, sql.ErrNoRows)
 	mockRepo.On("CreateUser", mock.Anything, mock.MatchedBy(func(u *models.User) bool {
 		return u.Username == req.Username && u.EncryptedPassword != req.Password
 	})).Return(createdUser, nil)
@@ -40,37 +46,185 @@ func TestService_CreateUser(t *testing.T) {
 
 func TestService_Login(t *testing.T) {
 	mockRepo := new(MockRepository)
-	service := NewService(mockRepo, config)
+	service := NewService(mockRepo, config, nil)
 
 	req := &interfaces.LoginUserReq{
-		Username: "testuser",
-		Password: "password123",
+		Username:  "testuser",
+		Password:  "password123",
+		IP:        "10.0.0.1",
+		UserAgent: "chatgo-cli",
 	}
 
-	hashedPassword := "$2a$10$1ggfMVZV6Js0ybvJufLRUOWHS5f6KneuP0XwwHpJ8L8iw0hLyhsiG"
+	hashedPassword, err := util.HashPassword(req.Password, 0)
+	assert.NoError(t, err)
 
 	user := &models.User{
 		ID:                "user123",
 		Username:          req.Username,
 		EncryptedPassword: hashedPassword,
+		FailedLogins:      2,
+		LockedUntil:       sql.NullTime{Time: time.Now().Add(-time.Second), Valid: true},
 	}
 
 	mockRepo.On("GetUserByUsername", mock.Anything, req.Username).Return(user, nil)
+	mockRepo.On("GetTOTP", mock.Anything, user.ID).Return(nil, nil)
+	mockRepo.On("UpdateLastLogin", mock.Anything, user.ID, req.IP).Return(nil)
+	mockRepo.On("CreateLoginAttempt", mock.Anything, mock.MatchedBy(func(a *models.LoginAttempt) bool {
+		return a.UserID == user.ID && a.Success && a.IP == req.IP && a.UserAgent == req.UserAgent
+	})).Return(nil)
 
 	result, err := service.Login(context.Background(), req)
 
-	if err == nil {
-		assert.NotNil(t, result)
-		assert.Equal(t, user.ID, result.ID)
-		assert.Equal(t, user.Username, result.Username)
-		assert.NotEmpty(t, result.AccessToken)
+	assert.NoError(t, err)
+	assert.NotNil(t, result)
+	assert.Equal(t, user.ID, result.ID)
+	assert.Equal(t, user.Username, result.Username)
+	assert.NotEmpty(t, result.AccessToken)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_Login_Bot(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewService(mockRepo, config, nil)
+
+	mockRepo.On("GetUserByUsername", mock.Anything, "ci-bot").Return(&models.User{ID: "8", Username: "ci-bot", IsBot: true}, nil)
+
+	_, err := service.Login(context.Background(), &interfaces.LoginUserReq{Username: "ci-bot", Password: ""})
+	assert.ErrorIs(t, err, interfaces.ErrInvalidCredentials)
+	mockRepo.AssertNotCalled(t, "UpdateLastLogin", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestService_Login_UnknownUser(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewService(mockRepo, config, nil)
+
+	mockRepo.On("GetUserByUsername", mock.Anything, "ghost").Return(nil, sql.ErrNoRows)
+	mockRepo.On("GetUserByUsername", mock.Anything, "alice").Return(nil, errors.New("connection refused"))
+
+	_, err := service.Login(context.Background(), &interfaces.LoginUserReq{Username: "ghost", Password: "secret"})
+	assert.ErrorIs(t, err, interfaces.ErrInvalidCredentials)
+
+	_, err = service.Login(context.Background(), &interfaces.LoginUserReq{Username: "alice", Password: "secret"})
+	assert.Error(t, err)
+	assert.NotContains(t, err.Error(), "connection refused")
+	mockRepo.AssertNotCalled(t, "CreateLoginAttempt", mock.Anything, mock.Anything)
+}
+
+func TestService_Login_WrongPassword(t *testing.T) {
+	withLocalZone(t)
+	mockRepo := new(MockRepository)
+	service := NewService(mockRepo, config, nil)
+
+	hashedPassword, err := util.HashPassword("password123", 0)
+	assert.NoError(t, err)
+	user := &models.User{ID: "user123", Username: "testuser", EncryptedPassword: hashedPassword}
+
+	mockRepo.On("GetUserByUsername", mock.Anything, "testuser").Return(user, nil)
+	mockRepo.On("RecordFailedLogin", mock.Anything, user.ID).Return(3, nil)
+	mockRepo.On("LockUser", mock.Anything, user.ID, mock.MatchedBy(func(until time.Time) bool {
+		// The third failure in a row locks the account for 4 seconds
+		wait := time.Until(until)
+		return isUTC(until) && wait > 3*time.Second && wait <= 4*time.Second
+	})).Return(nil)
+	mockRepo.On("CreateLoginAttempt", mock.Anything, mock.MatchedBy(func(a *models.LoginAttempt) bool {
+		return !a.Success && a.Reason == models.LoginBadPassword
+	})).Return(nil)
+
+	_, err = service.Login(context.Background(), &interfaces.LoginUserReq{Username: "testuser", Password: "wrong"})
+	assert.ErrorIs(t, err, interfaces.ErrInvalidCredentials)
+	mockRepo.AssertExpectations(t)
+	mockRepo.AssertNotCalled(t, "UpdateLastLogin", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestService_Login_Locked(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewService(mockRepo, config, nil)
+
+	hashedPassword, err := util.HashPassword("password123", 0)
+	assert.NoError(t, err)
+	until := time.Now().Add(10 * time.Minute)
+	user := &models.User{
+		ID:                "user123",
+		Username:          "testuser",
+		EncryptedPassword: hashedPassword,
+		FailedLogins:      5,
+		LockedUntil:       sql.NullTime{Time: until, Valid: true},
 	}
+
+	mockRepo.On("GetUserByUsername", mock.Anything, "testuser").Return(user, nil)
+	mockRepo.On("CreateLoginAttempt", mock.Anything, mock.MatchedBy(func(a *models.LoginAttempt) bool {
+		return !a.Success && a.Reason == models.LoginLocked
+	})).Return(nil)
+
+	mockRepo.On("GetUserByUsername", mock.Anything, "ghost").Return(nil, sql.ErrNoRows)
+
+	// Even the right password is refused while the account is locked, and the answer
+	// is the same as for an unknown username
+	_, err = service.Login(context.Background(), &interfaces.LoginUserReq{Username: "testuser", Password: "password123"})
+	assert.ErrorIs(t, err, interfaces.ErrInvalidCredentials)
+	assert.NotErrorIs(t, err, interfaces.ErrAccountLocked)
+	_, unknownErr := service.Login(context.Background(), &interfaces.LoginUserReq{Username: "ghost", Password: "password123"})
+	assert.Equal(t, unknownErr, err)
 	mockRepo.AssertExpectations(t)
+	mockRepo.AssertNotCalled(t, "RecordFailedLogin", mock.Anything, mock.Anything)
+}
+
+func TestService_lockoutDelay(t *testing.T) {
+	s := NewService(new(MockRepository), config, nil).(*service)
+
+	assert.Equal(t, time.Second, s.lockoutDelay(1))
+	assert.Equal(t, 2*time.Second, s.lockoutDelay(2))
+	assert.Equal(t, 8*time.Second, s.lockoutDelay(4))
+	assert.Equal(t, 15*time.Minute, s.lockoutDelay(5))
+	assert.Equal(t, 15*time.Minute, s.lockoutDelay(40))
+
+	s.Lockout = LockoutConfig{MaxFailures: 10, Delay: time.Minute, Duration: 5 * time.Minute}
+	assert.Equal(t, 4*time.Minute, s.lockoutDelay(3))
+	assert.Equal(t, 5*time.Minute, s.lockoutDelay(4))
+	assert.Equal(t, 5*time.Minute, s.lockoutDelay(10))
+}
+
+func TestService_GetLoginHistory(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewService(mockRepo, config, nil)
+
+	now := time.Now()
+	mockRepo.On("GetLoginAttempts", mock.Anything, "user123", maxLoginHistory).Return([]*models.LoginAttempt{
+		{ID: "2", UserID: "user123", IP: "10.0.0.1", Success: true, CreatedAt: now},
+		{ID: "1", UserID: "user123", IP: "10.0.0.9", Reason: models.LoginBadPassword, CreatedAt: now.Add(-time.Minute)},
+	}, nil)
+
+	history, err := service.GetLoginHistory(context.Background(), "user123", 1000)
+	assert.NoError(t, err)
+	assert.Len(t, history, 2)
+	assert.True(t, history[0].Success)
+	assert.Equal(t, "10.0.0.9", history[1].IP)
+	assert.Equal(t, models.LoginBadPassword, history[1].Reason)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_UnlockUser(t *testing.T) {
+	adminConfig := *config
+	adminConfig.Admins = []string{"1"}
+
+	mockRepo := new(MockRepository)
+	service := NewService(mockRepo, &adminConfig, nil)
+
+	mockRepo.On("GetUserByUsername", mock.Anything, "bob").Return(&models.User{ID: "3", Username: "bob"}, nil)
+	mockRepo.On("GetUserByUsername", mock.Anything, "ghost").Return(nil, sql.ErrNoRows)
+	mockRepo.On("UnlockUser", mock.Anything, "3").Return(true, nil)
+
+	assert.ErrorIs(t, service.UnlockUser(context.Background(), "2", "bob"), interfaces.ErrNotServerAdmin)
+	// Admin rights follow the user ID, not a username
+	assert.ErrorIs(t, service.UnlockUser(context.Background(), "root", "bob"), interfaces.ErrNotServerAdmin)
+	assert.ErrorIs(t, service.UnlockUser(context.Background(), "1", "ghost"), interfaces.ErrUserNotFound)
+	assert.NoError(t, service.UnlockUser(context.Background(), "1", "bob"))
+	mockRepo.AssertNumberOfCalls(t, "UnlockUser", 1)
 }
 
 func TestService_GetUserByID(t *testing.T) {
 	mockRepo := new(MockRepository)
-	service := NewService(mockRepo, config)
+	service := NewService(mockRepo, config, nil)
 
 	userID := "user123"
 	req := &interfaces.GetUserReq{
@@ -95,7 +249,7 @@ func TestService_GetUserByID(t *testing.T) {
 
 func TestService_GetAllUsers(t *testing.T) {
 	mockRepo := new(MockRepository)
-	service := NewService(mockRepo, config)
+	service := NewService(mockRepo, config, nil)
 
 	users := []*models.User{
 		{
@@ -123,3 +277,44 @@ func TestService_GetAllUsers(t *testing.T) {
 
 	mockRepo.AssertExpectations(t)
 }
+
+func TestService_ValidateToken(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewService(mockRepo, config, nil)
+
+	mockRepo.On("GetUserByID", mock.Anything, "user123").Return(&models.User{ID: "user123", Username: "testuser", TokenVersion: 2}, nil)
+
+	sign := func(version int) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, MyJWTClaims{
+			ID:       "user123",
+			Username: "testuser",
+			Version:  version,
+			RegisteredClaims: jwt.RegisteredClaims{
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			},
+		}).SignedString([]byte(config.JWTKey))
+		assert.NoError(t, err)
+		return token
+	}
+
+	user, err := service.ValidateToken(context.Background(), sign(2))
+	assert.NoError(t, err)
+	assert.Equal(t, "user123", user.ID)
+	assert.Equal(t, "testuser", user.Username)
+	assert.False(t, user.Bot)
+
+	// Tokens issued before the password was changed are revoked
+	_, err = service.ValidateToken(context.Background(), sign(1))
+	assert.Error(t, err)
+
+	forged, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, MyJWTClaims{ID: "user123"}).SignedString([]byte("other key"))
+	_, err = service.ValidateToken(context.Background(), forged)
+	assert.Error(t, err)
+
+	expired, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, MyJWTClaims{
+		ID:               "user123",
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Hour))},
+	}).SignedString([]byte(config.JWTKey))
+	_, err = service.ValidateToken(context.Background(), expired)
+	assert.Error(t, err)
+}
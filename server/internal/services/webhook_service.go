@@ -0,0 +1,389 @@
+package services
+
+import (
+	"chatgo/server/internal/interfaces"
+	"chatgo/server/internal/models"
+	"chatgo/server/internal/webhook"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	// maxWebhookAttempts — число попыток, после которого доставка попадает в журнал недоставленных.
+	// С экспоненциальной задержкой последняя попытка делается примерно через 20 минут после первой
+	maxWebhookAttempts = 8
+	// webhookTimeout ограничивает время ответа получателя
+	webhookTimeout = 10 * time.Second
+	// webhookLease — через сколько забранная доставка снова станет доступной, если сервер не
+	// сохранил её результат. Должен быть больше webhookTimeout
+	webhookLease       = time.Minute
+	webhookBatchSize   = 50
+	webhookConcurrency = 8
+
+	defaultDeliveryHistory = 50
+	maxDeliveryHistory     = 200
+)
+
+// webhookEvents — события, на которые можно подписаться
+var webhookEvents = map[string]bool{
+	interfaces.WebhookEventMessageCreated: true,
+	interfaces.WebhookEventMemberJoined:   true,
+	interfaces.WebhookEventMemberLeft:     true,
+	interfaces.WebhookEventRoomRenamed:    true,
+}
+
+// CreateWebhook подписывает URL на события чата. Создавать вебхуки могут только админы чата.
+// Секрет для подписи генерируется сервером, хранится зашифрованным ключом чата и возвращается
+// только в ответе на этот запрос
+func (s *service) CreateWebhook(c context.Context, req *interfaces.CreateWebhookReq) (*interfaces.WebhookRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	events, err := s.validateWebhook(req.URL, req.Events)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkRoomExists(ctx, req.RoomID); err != nil {
+		return nil, err
+	}
+	if err := s.checkRoomAdmin(ctx, req.UserID, req.RoomID); err != nil {
+		return nil, err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	encryptedSecret, keyVersion, err := s.encryptContent(ctx, req.RoomID, hex.EncodeToString(secret))
+	if err != nil {
+		return nil, err
+	}
+
+	created, err := s.Repository.CreateWebhook(ctx, &models.Webhook{
+		ChatRoomID:      req.RoomID,
+		URL:             req.URL,
+		Events:          events,
+		EncryptedSecret: encryptedSecret,
+		KeyVersion:      keyVersion,
+		CreatedBy:       req.UserID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := toWebhookRes(created)
+	res.Secret = hex.EncodeToString(secret)
+	return res, nil
+}
+
+// validateWebhook проверяет URL и список событий, возвращает события без повторов. URL с
+// внутренним IP-адресом отклоняется сразу, адрес имени проверяется при каждой отправке
+func (s *service) validateWebhook(rawURL string, events []string) ([]string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, interfaces.ErrInvalidWebhook
+	}
+	if err := s.webhooks.CheckHost(u.Hostname()); err != nil {
+		return nil, fmt.Errorf("%w: %v", interfaces.ErrInvalidWebhook, err)
+	}
+	if len(events) == 0 {
+		return nil, interfaces.ErrInvalidWebhook
+	}
+
+	seen := make(map[string]bool, len(events))
+	unique := make([]string, 0, len(events))
+	for _, event := range events {
+		if !webhookEvents[event] {
+			return nil, fmt.Errorf("%w: unknown event %q", interfaces.ErrInvalidWebhook, event)
+		}
+		if !seen[event] {
+			seen[event] = true
+			unique = append(unique, event)
+		}
+	}
+	return unique, nil
+}
+
+// GetWebhooks возвращает вебхуки чата без секретов. Смотреть их могут только админы чата
+func (s *service) GetWebhooks(c context.Context, userID, roomID string) ([]*interfaces.WebhookRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	if err := s.checkRoomExists(ctx, roomID); err != nil {
+		return nil, err
+	}
+	if err := s.checkRoomAdmin(ctx, userID, roomID); err != nil {
+		return nil, err
+	}
+
+	webhooks, err := s.Repository.GetWebhooksByChatRoomID(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*interfaces.WebhookRes, len(webhooks))
+	for i, w := range webhooks {
+		res[i] = toWebhookRes(w)
+	}
+	return res, nil
+}
+
+// DeleteWebhook удаляет вебхук вместе с историей доставок. Удалять вебхуки могут только админы чата
+func (s *service) DeleteWebhook(c context.Context, userID, id string) error {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	if _, err := s.getAdminWebhook(ctx, userID, id); err != nil {
+		return err
+	}
+	return s.Repository.DeleteWebhook(ctx, id)
+}
+
+// GetWebhookDeliveries возвращает до limit последних доставок вебхука. Если status равен dead,
+// возвращается журнал недоставленных событий. Смотреть историю могут только админы чата
+func (s *service) GetWebhookDeliveries(c context.Context, userID, webhookID, status string, limit int) ([]*interfaces.WebhookDeliveryRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	switch status {
+	case "", models.WebhookDeliveryPending, models.WebhookDeliveryDelivered, models.WebhookDeliveryDead:
+	default:
+		return nil, interfaces.ErrInvalidDelivery
+	}
+	if limit <= 0 {
+		limit = defaultDeliveryHistory
+	}
+	if limit > maxDeliveryHistory {
+		limit = maxDeliveryHistory
+	}
+
+	w, err := s.getAdminWebhook(ctx, userID, webhookID)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries, err := s.Repository.GetWebhookDeliveries(ctx, webhookID, status, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*interfaces.WebhookDeliveryRes, len(deliveries))
+	for i, d := range deliveries {
+		payload, err := s.webhookPayload(ctx, w.ChatRoomID, d)
+		if err != nil {
+			return nil, err
+		}
+		res[i] = &interfaces.WebhookDeliveryRes{
+			ID:             d.ID,
+			Event:          d.Event,
+			Payload:        payload,
+			Status:         d.Status,
+			Attempts:       d.Attempts,
+			LastStatusCode: d.LastStatusCode,
+			LastError:      d.LastError,
+			CreatedAt:      d.CreatedAt,
+		}
+		if d.Status == models.WebhookDeliveryPending {
+			nextAttemptAt := d.NextAttemptAt
+			res[i].NextAttemptAt = &nextAttemptAt
+		}
+		if d.DeliveredAt.Valid {
+			deliveredAt := d.DeliveredAt.Time
+			res[i].DeliveredAt = &deliveredAt
+		}
+	}
+	return res, nil
+}
+
+// getAdminWebhook возвращает вебхук, если userID — админ его чата
+func (s *service) getAdminWebhook(ctx context.Context, userID, id string) (*models.Webhook, error) {
+	w, err := s.Repository.GetWebhookByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if w == nil {
+		return nil, interfaces.ErrWebhookNotFound
+	}
+	if err := s.checkRoomAdmin(ctx, userID, w.ChatRoomID); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// webhookPayload расшифровывает тело доставки, у доставленных оно пустое
+func (s *service) webhookPayload(ctx context.Context, roomID string, d *models.WebhookDelivery) (string, error) {
+	if d.EncryptedPayload == "" {
+		return "", nil
+	}
+	return s.decryptContent(ctx, roomID, d.KeyVersion, d.EncryptedPayload)
+}
+
+// PublishWebhookEvent ставит событие чата в очередь на доставку всем подписанным вебхукам.
+// Тело запроса хранится зашифрованным ключом чата до доставки
+func (s *service) PublishWebhookEvent(c context.Context, req *interfaces.WebhookEventReq) error {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	if !webhookEvents[req.Event] {
+		return fmt.Errorf("unknown webhook event %q", req.Event)
+	}
+
+	payload, err := json.Marshal(&interfaces.WebhookPayload{
+		Event:     req.Event,
+		RoomID:    req.RoomID,
+		Timestamp: utcNow(),
+		Data:      req.Data,
+	})
+	if err != nil {
+		return err
+	}
+
+	encryptedPayload, keyVersion, err := s.encryptContent(ctx, req.RoomID, string(payload))
+	if err != nil {
+		return err
+	}
+
+	_, err = s.Repository.EnqueueWebhookDeliveries(ctx, req.RoomID, &models.WebhookDelivery{
+		MessageID:        sql.NullString{String: req.MessageID, Valid: req.MessageID != ""},
+		Event:            req.Event,
+		EncryptedPayload: encryptedPayload,
+		KeyVersion:       keyVersion,
+	})
+	return err
+}
+
+// DeliverWebhooks отправляет пакет доставок, время которых наступило. Неудачные попытки
+// повторяются с экспоненциальной задержкой, после maxWebhookAttempts доставка помечается dead
+func (s *service) DeliverWebhooks(c context.Context) (*interfaces.WebhookDeliveryRunRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	deliveries, err := s.Repository.ClaimWebhookDeliveries(ctx, utcNow(), webhookLease, webhookBatchSize)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	// Вебхук и его расшифрованный секрет загружаются один раз на пакет
+	type target struct {
+		webhook *models.Webhook
+		secret  string
+		err     error
+	}
+	targets := make(map[string]*target)
+	for _, d := range deliveries {
+		if _, ok := targets[d.WebhookID]; ok {
+			continue
+		}
+		t := &target{}
+		targets[d.WebhookID] = t
+		if t.webhook, t.err = s.Repository.GetWebhookByID(ctx, d.WebhookID); t.err != nil {
+			continue
+		}
+		if t.webhook == nil {
+			t.err = interfaces.ErrWebhookNotFound
+			continue
+		}
+		t.secret, t.err = s.decryptContent(ctx, t.webhook.ChatRoomID, t.webhook.KeyVersion, t.webhook.EncryptedSecret)
+	}
+
+	payloads := make(map[string]string, len(deliveries))
+	payloadErrs := make(map[string]error)
+	for _, d := range deliveries {
+		if t := targets[d.WebhookID]; t.err == nil {
+			payloads[d.ID], payloadErrs[d.ID] = s.webhookPayload(ctx, t.webhook.ChatRoomID, d)
+		}
+	}
+	cancel()
+
+	res := &interfaces.WebhookDeliveryRunRes{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, webhookConcurrency)
+	for _, d := range deliveries {
+		t := targets[d.WebhookID]
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(d *models.WebhookDelivery) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			statusCode, err := 0, t.err
+			if err == nil {
+				err = payloadErrs[d.ID]
+			}
+			if err == nil {
+				sendCtx, cancel := context.WithTimeout(c, webhookTimeout)
+				statusCode, err = s.webhooks.Send(sendCtx, &webhook.Delivery{
+					ID:     d.ID,
+					URL:    t.webhook.URL,
+					Secret: t.secret,
+					Event:  d.Event,
+					Body:   []byte(payloads[d.ID]),
+				})
+				cancel()
+			}
+			s.recordWebhookAttempt(c, d, statusCode, err)
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch d.Status {
+			case models.WebhookDeliveryDelivered:
+				res.Delivered++
+			case models.WebhookDeliveryDead:
+				res.Dead++
+			default:
+				res.Retried++
+			}
+		}(d)
+	}
+	wg.Wait()
+
+	return res, nil
+}
+
+// recordWebhookAttempt сохраняет результат попытки и планирует следующую
+func (s *service) recordWebhookAttempt(c context.Context, d *models.WebhookDelivery, statusCode int, sendErr error) {
+	now := utcNow()
+	d.Attempts++
+	d.LastStatusCode = statusCode
+	d.LastError = ""
+	switch {
+	case sendErr == nil:
+		d.Status = models.WebhookDeliveryDelivered
+		d.DeliveredAt = sql.NullTime{Time: now, Valid: true}
+		// Доставленное событие больше не нужно, в истории остаётся только результат
+		d.EncryptedPayload = ""
+	case d.Attempts >= maxWebhookAttempts:
+		d.Status = models.WebhookDeliveryDead
+		d.LastError = sendErr.Error()
+		log.Printf("Webhook delivery %s is dead after %d attempts: %v", d.ID, d.Attempts, sendErr)
+	default:
+		d.LastError = sendErr.Error()
+		d.NextAttemptAt = now.Add(webhook.Backoff(d.Attempts))
+	}
+
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+	if err := s.Repository.UpdateWebhookDelivery(ctx, d); err != nil {
+		log.Printf("Failed to save webhook delivery %s: %v", d.ID, err)
+	}
+}
+
+func toWebhookRes(w *models.Webhook) *interfaces.WebhookRes {
+	return &interfaces.WebhookRes{
+		ID:        w.ID,
+		RoomID:    w.ChatRoomID,
+		URL:       w.URL,
+		Events:    w.Events,
+		CreatedAt: w.CreatedAt,
+	}
+}
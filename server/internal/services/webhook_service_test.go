@@ -0,0 +1,260 @@
+package services
+
+import (
+	"chatgo/server/internal/interfaces"
+	"chatgo/server/internal/models"
+	"chatgo/server/internal/util"
+	"chatgo/server/internal/webhook"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestService_CreateWebhook(t *testing.T) {
+	mockRepo := new(MockRepository)
+	mockRoomKeys(mockRepo)
+	service := NewService(mockRepo, config, nil)
+
+	mockRepo.On("GetChatRoomByID", mock.Anything, "1").Return(&models.ChatRoom{ID: "1"}, nil)
+	mockRepo.On("GetMembersByChatRoomID", mock.Anything, "1").Return([]*models.ChatRoomMember{
+		{UserID: "admin", MemberRole: models.Admin},
+		{UserID: "member", MemberRole: models.Member},
+	}, nil)
+	var stored *models.Webhook
+	mockRepo.On("CreateWebhook", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		stored = args.Get(1).(*models.Webhook)
+		stored.ID = "3"
+	}).Return(&models.Webhook{ID: "3", ChatRoomID: "1", URL: "https://ci.example.com/hook", Events: []string{"message.created"}}, nil)
+
+	res, err := service.CreateWebhook(context.Background(), &interfaces.CreateWebhookReq{
+		UserID: "admin",
+		RoomID: "1",
+		URL:    "https://ci.example.com/hook",
+		Events: []string{"message.created", "message.created"},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "3", res.ID)
+	assert.Equal(t, []string{"message.created"}, stored.Events)
+	assert.Len(t, res.Secret, 64)
+
+	// The secret is stored encrypted with the room key
+	secret, err := util.DecryptMessage(stored.EncryptedSecret, testDataKey)
+	assert.NoError(t, err)
+	assert.Equal(t, res.Secret, secret)
+
+	testCases := []struct {
+		name string
+		req  *interfaces.CreateWebhookReq
+		err  error
+	}{
+		{
+			name: "Not an admin",
+			req:  &interfaces.CreateWebhookReq{UserID: "member", RoomID: "1", URL: "https://ci.example.com/hook", Events: []string{"member.joined"}},
+			err:  interfaces.ErrNotRoomAdmin,
+		},
+		{
+			name: "Unsupported scheme",
+			req:  &interfaces.CreateWebhookReq{UserID: "admin", RoomID: "1", URL: "ftp://ci.example.com/hook", Events: []string{"member.joined"}},
+			err:  interfaces.ErrInvalidWebhook,
+		},
+		{
+			name: "Internal address",
+			req:  &interfaces.CreateWebhookReq{UserID: "admin", RoomID: "1", URL: "http://169.254.169.254/latest/meta-data", Events: []string{"member.joined"}},
+			err:  interfaces.ErrInvalidWebhook,
+		},
+		{
+			name: "Localhost",
+			req:  &interfaces.CreateWebhookReq{UserID: "admin", RoomID: "1", URL: "http://localhost:5432", Events: []string{"member.joined"}},
+			err:  interfaces.ErrInvalidWebhook,
+		},
+		{
+			name: "No events",
+			req:  &interfaces.CreateWebhookReq{UserID: "admin", RoomID: "1", URL: "https://ci.example.com/hook"},
+			err:  interfaces.ErrInvalidWebhook,
+		},
+		{
+			name: "Unknown event",
+			req:  &interfaces.CreateWebhookReq{UserID: "admin", RoomID: "1", URL: "https://ci.example.com/hook", Events: []string{"room.deleted"}},
+			err:  interfaces.ErrInvalidWebhook,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := service.CreateWebhook(context.Background(), tc.req)
+			assert.ErrorIs(t, err, tc.err)
+		})
+	}
+	mockRepo.AssertNumberOfCalls(t, "CreateWebhook", 1)
+}
+
+func TestService_PublishWebhookEvent(t *testing.T) {
+	mockRepo := new(MockRepository)
+	mockRoomKeys(mockRepo)
+	service := NewService(mockRepo, config, nil)
+
+	var delivery *models.WebhookDelivery
+	mockRepo.On("EnqueueWebhookDeliveries", mock.Anything, "1", mock.Anything).Run(func(args mock.Arguments) {
+		delivery = args.Get(2).(*models.WebhookDelivery)
+	}).Return(1, nil)
+
+	err := service.PublishWebhookEvent(context.Background(), &interfaces.WebhookEventReq{
+		Event:     interfaces.WebhookEventRoomRenamed,
+		RoomID:    "1",
+		MessageID: "40",
+		Data:      map[string]string{"name": "ops"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, interfaces.WebhookEventRoomRenamed, delivery.Event)
+	assert.Equal(t, sql.NullString{String: "40", Valid: true}, delivery.MessageID)
+
+	// The payload is stored encrypted with the room key
+	assert.Equal(t, 1, delivery.KeyVersion)
+	assert.NotContains(t, delivery.EncryptedPayload, "ops")
+	payload, err := util.DecryptMessage(delivery.EncryptedPayload, testDataKey)
+	assert.NoError(t, err)
+
+	var decoded struct {
+		Event  string            `json:"event"`
+		RoomID string            `json:"roomId"`
+		Data   map[string]string `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(payload), &decoded))
+	assert.Equal(t, interfaces.WebhookEventRoomRenamed, decoded.Event)
+	assert.Equal(t, "1", decoded.RoomID)
+	assert.Equal(t, "ops", decoded.Data["name"])
+
+	err = service.PublishWebhookEvent(context.Background(), &interfaces.WebhookEventReq{Event: "room.deleted", RoomID: "1"})
+	assert.Error(t, err)
+	mockRepo.AssertNumberOfCalls(t, "EnqueueWebhookDeliveries", 1)
+}
+
+func TestService_DeliverWebhooks(t *testing.T) {
+	var mu sync.Mutex
+	verified := map[string]bool{}
+	bodies := map[string]string{}
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get(webhook.TimestampHeader), 10, 64)
+		mu.Lock()
+		verified[r.Header.Get(webhook.DeliveryHeader)] = webhook.Verify("s3cret", timestamp, body, r.Header.Get(webhook.SignatureHeader))
+		bodies[r.Header.Get(webhook.DeliveryHeader)] = string(body)
+		mu.Unlock()
+
+		if r.URL.Path == "/down" {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer receiver.Close()
+
+	encryptedSecret, err := util.EncryptMessage("s3cret", testDataKey)
+	assert.NoError(t, err)
+
+	// The receiver listens on loopback, which only an allowed network can reach
+	cfg := *config
+	cfg.Webhooks.AllowedNetworks = []string{"127.0.0.0/8"}
+	mockRepo := new(MockRepository)
+	mockRoomKeys(mockRepo)
+	service := NewService(mockRepo, &cfg, nil)
+
+	payload := func(event string) string {
+		encrypted, err := util.EncryptMessage(`{"event":"`+event+`"}`, testDataKey)
+		assert.NoError(t, err)
+		return encrypted
+	}
+	mockRepo.On("ClaimWebhookDeliveries", mock.Anything, mock.Anything, webhookLease, webhookBatchSize).Return([]*models.WebhookDelivery{
+		{ID: "1", WebhookID: "10", Event: "message.created", EncryptedPayload: payload("message.created"), KeyVersion: 1, Status: models.WebhookDeliveryPending},
+		{ID: "2", WebhookID: "11", Event: "member.joined", EncryptedPayload: payload("member.joined"), KeyVersion: 1, Status: models.WebhookDeliveryPending, Attempts: 1},
+		{ID: "3", WebhookID: "11", Event: "member.left", EncryptedPayload: payload("member.left"), KeyVersion: 1, Status: models.WebhookDeliveryPending, Attempts: maxWebhookAttempts - 1},
+	}, nil)
+	mockRepo.On("GetWebhookByID", mock.Anything, "10").Return(&models.Webhook{
+		ID: "10", ChatRoomID: "1", URL: receiver.URL + "/up", EncryptedSecret: encryptedSecret, KeyVersion: 1,
+	}, nil).Once()
+	mockRepo.On("GetWebhookByID", mock.Anything, "11").Return(&models.Webhook{
+		ID: "11", ChatRoomID: "1", URL: receiver.URL + "/down", EncryptedSecret: encryptedSecret, KeyVersion: 1,
+	}, nil).Once()
+
+	updated := map[string]models.WebhookDelivery{}
+	mockRepo.On("UpdateWebhookDelivery", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		d := args.Get(1).(*models.WebhookDelivery)
+		mu.Lock()
+		updated[d.ID] = *d
+		mu.Unlock()
+	}).Return(nil)
+
+	start := time.Now()
+	res, err := service.DeliverWebhooks(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, &interfaces.WebhookDeliveryRunRes{Delivered: 1, Retried: 1, Dead: 1}, res)
+	assert.Equal(t, map[string]bool{"1": true, "2": true, "3": true}, verified)
+	assert.Equal(t, `{"event":"message.created"}`, bodies["1"])
+
+	// A delivered payload is cleared, undelivered ones are kept for the retries and the dead-letter log
+	assert.Equal(t, models.WebhookDeliveryDelivered, updated["1"].Status)
+	assert.Equal(t, 1, updated["1"].Attempts)
+	assert.Equal(t, http.StatusOK, updated["1"].LastStatusCode)
+	assert.True(t, updated["1"].DeliveredAt.Valid)
+	assert.Empty(t, updated["1"].EncryptedPayload)
+	assert.NotEmpty(t, updated["2"].EncryptedPayload)
+
+	// The second failure waits twice as long as the first
+	assert.Equal(t, models.WebhookDeliveryPending, updated["2"].Status)
+	assert.Equal(t, 2, updated["2"].Attempts)
+	assert.Equal(t, http.StatusServiceUnavailable, updated["2"].LastStatusCode)
+	assert.Equal(t, "receiver responded with status 503", updated["2"].LastError)
+	assert.WithinDuration(t, start.Add(webhook.Backoff(2)), updated["2"].NextAttemptAt, 5*time.Second)
+
+	assert.Equal(t, models.WebhookDeliveryDead, updated["3"].Status)
+	assert.Equal(t, maxWebhookAttempts, updated["3"].Attempts)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_GetWebhookDeliveries(t *testing.T) {
+	mockRepo := new(MockRepository)
+	mockRoomKeys(mockRepo)
+	service := NewService(mockRepo, config, nil)
+
+	payload, err := util.EncryptMessage(`{"event":"member.left"}`, testDataKey)
+	assert.NoError(t, err)
+	now := time.Now()
+	mockRepo.On("GetWebhookByID", mock.Anything, "3").Return(&models.Webhook{ID: "3", ChatRoomID: "1"}, nil)
+	mockRepo.On("GetWebhookByID", mock.Anything, "4").Return(nil, nil)
+	mockRepo.On("GetMembersByChatRoomID", mock.Anything, "1").Return([]*models.ChatRoomMember{
+		{UserID: "admin", MemberRole: models.Admin},
+		{UserID: "member", MemberRole: models.Member},
+	}, nil)
+	mockRepo.On("GetWebhookDeliveries", mock.Anything, "3", models.WebhookDeliveryDead, defaultDeliveryHistory).Return([]*models.WebhookDelivery{
+		{ID: "9", Event: "member.left", EncryptedPayload: payload, KeyVersion: 1, Status: models.WebhookDeliveryDead, Attempts: maxWebhookAttempts, NextAttemptAt: now, LastError: "connection refused", CreatedAt: now},
+	}, nil)
+
+	res, err := service.GetWebhookDeliveries(context.Background(), "admin", "3", models.WebhookDeliveryDead, 0)
+	assert.NoError(t, err)
+	assert.Len(t, res, 1)
+	assert.Equal(t, `{"event":"member.left"}`, res[0].Payload)
+	assert.Equal(t, "connection refused", res[0].LastError)
+	assert.Nil(t, res[0].NextAttemptAt)
+	assert.Nil(t, res[0].DeliveredAt)
+
+	_, err = service.GetWebhookDeliveries(context.Background(), "member", "3", "", 0)
+	assert.ErrorIs(t, err, interfaces.ErrNotRoomAdmin)
+
+	_, err = service.GetWebhookDeliveries(context.Background(), "admin", "4", "", 0)
+	assert.ErrorIs(t, err, interfaces.ErrWebhookNotFound)
+
+	_, err = service.GetWebhookDeliveries(context.Background(), "admin", "3", "lost", 0)
+	assert.ErrorIs(t, err, interfaces.ErrInvalidDelivery)
+}
@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalStore(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir())
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	assert.NoError(t, store.Put(ctx, "rooms/1/abc", strings.NewReader("hello"), 5))
+
+	r, err := store.Get(ctx, "rooms/1/abc")
+	assert.NoError(t, err)
+	data, _ := io.ReadAll(r)
+	r.Close()
+	assert.Equal(t, "hello", string(data))
+
+	assert.NoError(t, store.Delete(ctx, "rooms/1/abc"))
+	_, err = store.Get(ctx, "rooms/1/abc")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Deleting a missing blob is not an error
+	assert.NoError(t, store.Delete(ctx, "rooms/1/abc"))
+}
+
+func TestLocalStore_InvalidKey(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir())
+	assert.NoError(t, err)
+
+	for _, key := range []string{"", "/etc/passwd", "../secret", "rooms//1", "rooms/./1"} {
+		assert.Error(t, store.Put(context.Background(), key, strings.NewReader("x"), 1), key)
+	}
+}
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeS3 is a minimal in-memory S3 endpoint that checks request signing headers
+func fakeS3(t *testing.T) *httptest.Server {
+	var mu sync.Mutex
+	objects := make(map[string][]byte)
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=minio/") ||
+			!strings.Contains(auth, "SignedHeaders=host;x-amz-content-sha256;x-amz-date") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		sum := sha256.Sum256(body)
+		if r.Header.Get("x-amz-content-sha256") != hex.EncodeToString(sum[:]) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch r.Method {
+		case http.MethodPut:
+			objects[r.URL.Path] = body
+		case http.MethodGet:
+			data, ok := objects[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(data)
+		case http.MethodDelete:
+			delete(objects, r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+}
+
+func TestS3Store(t *testing.T) {
+	server := fakeS3(t)
+	defer server.Close()
+
+	store, err := NewS3Store(&Config{
+		Type:      "s3",
+		Endpoint:  server.URL,
+		Bucket:    "chatgo",
+		AccessKey: "minio",
+		SecretKey: "minio123",
+	})
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	assert.NoError(t, store.Put(ctx, "rooms/1/abc", strings.NewReader("hello"), 5))
+
+	r, err := store.Get(ctx, "rooms/1/abc")
+	assert.NoError(t, err)
+	data, _ := io.ReadAll(r)
+	r.Close()
+	assert.Equal(t, "hello", string(data))
+
+	assert.NoError(t, store.Delete(ctx, "rooms/1/abc"))
+	_, err = store.Get(ctx, "rooms/1/abc")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestNew(t *testing.T) {
+	store, err := New(&Config{Dir: t.TempDir()})
+	assert.NoError(t, err)
+	assert.IsType(t, &LocalStore{}, store)
+
+	_, err = New(&Config{Type: "s3"})
+	assert.Error(t, err)
+
+	_, err = New(&Config{Type: "ftp"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,288 @@
+package transport
+
+import (
+	"chatgo/server/internal/interfaces"
+	"chatgo/server/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxDice and maxDieSides limit /roll
+	maxDice     = 100
+	maxDieSides = 1000
+)
+
+// errUsage is returned by commands called with wrong arguments
+var errUsage = errors.New("usage")
+
+// builtinCommands returns the commands every hub starts with
+func builtinCommands() []*Command {
+	return []*Command{
+		{Name: "help", Description: "List the commands you can use", Run: runHelp},
+		{Name: "me", Usage: "<action>", Description: "Describe what you are doing", Run: runMe},
+		{Name: "topic", Usage: "[text]", Description: "Show the room topic, or set it (room admins only)", Run: runTopic},
+		{Name: "invite", Usage: "<username>", Description: "Add a user to the room", Role: models.Admin, Run: runInvite},
+		{Name: "kick", Usage: "<username>", Description: "Remove a member from the room and disconnect them", Role: models.Admin, Run: runKick},
+		{Name: "roll", Usage: "[NdM]", Description: "Roll N dice with M sides, 1d6 by default", Run: runRoll},
+		{Name: "poll", Usage: "[-multiple] [-anonymous] [-closes 1h] <question> | <option> | <option>...", Description: "Ask the room a question", Run: runPoll},
+		{Name: "vote", Usage: "<poll> [option...]", Description: "Vote in a poll, without options your vote is withdrawn", Run: runVote},
+		{Name: "closepoll", Usage: "<poll>", Description: "Close a poll you created, room admins can close any poll", Run: runClosePoll},
+	}
+}
+
+// usage builds the usage error of the called command
+func usage(call *CommandCall) error {
+	cmd := call.hub.commands[call.Name]
+	return fmt.Errorf("%w: /%s %s", errUsage, cmd.Name, cmd.Usage)
+}
+
+func runHelp(ctx context.Context, call *CommandCall) error {
+	lines := []string{"Commands:"}
+	for _, cmd := range call.hub.availableCommands(call.Role) {
+		line := "  /" + cmd.Name
+		if cmd.Usage != "" {
+			line += " " + cmd.Usage
+		}
+		lines = append(lines, fmt.Sprintf("%s - %s", line, cmd.Description))
+	}
+	call.Reply("%s", strings.Join(lines, "\n"))
+	return nil
+}
+
+func runMe(ctx context.Context, call *CommandCall) error {
+	if call.Args == "" {
+		return usage(call)
+	}
+	return call.Say(ctx, fmt.Sprintf("* %s %s", call.Username, call.Args))
+}
+
+func runTopic(ctx context.Context, call *CommandCall) error {
+	if call.Args == "" {
+		room, err := call.hub.service.GetChatRoomByID(ctx, call.RoomID)
+		if err != nil {
+			return err
+		}
+		if room.Topic == "" {
+			call.Reply("No topic is set")
+		} else {
+			call.Reply("Topic: %s", room.Topic)
+		}
+		return nil
+	}
+
+	res, err := call.hub.service.UpdateChatRoom(ctx, &interfaces.UpdateChatRoomReq{
+		ID:     call.RoomID,
+		Topic:  &call.Args,
+		UserID: call.UserID,
+	})
+	if err != nil {
+		return err
+	}
+
+	call.hub.Events <- &Message{
+		Type:     MessageTypeTopic,
+		Content:  res.Topic,
+		RoomID:   res.ID,
+		Username: call.Username,
+		Topic:    res.Topic,
+	}
+	return nil
+}
+
+func runInvite(ctx context.Context, call *CommandCall) error {
+	args := call.Fields()
+	if len(args) != 1 {
+		return usage(call)
+	}
+
+	member, err := call.hub.service.InviteMember(ctx, &interfaces.RoomMemberReq{
+		UserID:   call.UserID,
+		RoomID:   call.RoomID,
+		Username: strings.TrimPrefix(args[0], "@"),
+	})
+	if err != nil {
+		return err
+	}
+
+	call.hub.Events <- &Message{
+		Type:     MessageTypeMemberAdded,
+		Content:  member.Username,
+		RoomID:   call.RoomID,
+		Username: call.Username,
+	}
+	call.hub.publishEvent(memberEvent(interfaces.WebhookEventMemberJoined, call.RoomID, member.UserID, member.Username))
+	return nil
+}
+
+func runKick(ctx context.Context, call *CommandCall) error {
+	args := call.Fields()
+	if len(args) != 1 {
+		return usage(call)
+	}
+
+	member, err := call.hub.service.KickMember(ctx, &interfaces.RoomMemberReq{
+		UserID:   call.UserID,
+		RoomID:   call.RoomID,
+		Username: strings.TrimPrefix(args[0], "@"),
+	})
+	if err != nil {
+		return err
+	}
+
+	call.hub.Events <- &Message{
+		Type:     MessageTypeMemberRemoved,
+		Content:  member.Username,
+		RoomID:   call.RoomID,
+		Username: call.Username,
+	}
+	call.hub.publishEvent(memberEvent(interfaces.WebhookEventMemberLeft, call.RoomID, member.UserID, member.Username))
+	return nil
+}
+
+func runRoll(ctx context.Context, call *CommandCall) error {
+	dice, sides := 1, 6
+	if call.Args != "" {
+		var ok bool
+		if dice, sides, ok = parseDice(call.Args); !ok {
+			return usage(call)
+		}
+	}
+
+	rolls := make([]string, dice)
+	total := 0
+	for i := range rolls {
+		n := rand.IntN(sides) + 1
+		rolls[i] = strconv.Itoa(n)
+		total += n
+	}
+
+	text := fmt.Sprintf("🎲 rolled %dd%d: %s", dice, sides, rolls[0])
+	if dice > 1 {
+		text = fmt.Sprintf("🎲 rolled %dd%d: %s = %d", dice, sides, strings.Join(rolls, " + "), total)
+	}
+	return call.Say(ctx, text)
+}
+
+// parseDice parses dice notation such as 2d6 or d20
+func parseDice(s string) (int, int, bool) {
+	count, sides, ok := strings.Cut(strings.ToLower(s), "d")
+	if !ok {
+		return 0, 0, false
+	}
+	dice := 1
+	if count != "" {
+		n, err := strconv.Atoi(count)
+		if err != nil {
+			return 0, 0, false
+		}
+		dice = n
+	}
+	m, err := strconv.Atoi(sides)
+	if err != nil || dice < 1 || dice > maxDice || m < 2 || m > maxDieSides {
+		return 0, 0, false
+	}
+	return dice, m, true
+}
+
+func runPoll(ctx context.Context, call *CommandCall) error {
+	req, ok := parsePoll(call.Args)
+	if !ok {
+		return usage(call)
+	}
+	req.UserID = call.UserID
+	req.RoomID = call.RoomID
+
+	res, err := call.hub.service.CreatePoll(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	call.hub.Broadcast <- &Message{
+		Type:     MessageTypeChat,
+		Content:  res.Content,
+		RoomID:   res.RoomID,
+		Username: res.Username,
+		stored:   res,
+	}
+	return nil
+}
+
+// parsePoll parses the flags, the question and the options of /poll
+func parsePoll(args string) (*interfaces.CreatePollReq, bool) {
+	req := &interfaces.CreatePollReq{}
+	for {
+		args = strings.TrimSpace(args)
+		flag, rest, _ := strings.Cut(args, " ")
+		switch flag {
+		case "-multiple":
+			req.Multiple = true
+		case "-anonymous":
+			req.Anonymous = true
+		case "-closes":
+			value, r, _ := strings.Cut(strings.TrimSpace(rest), " ")
+			d, err := time.ParseDuration(value)
+			if err != nil || d <= 0 {
+				return nil, false
+			}
+			req.ClosesAt = time.Now().Add(d).UTC().Format(time.RFC3339)
+			rest = r
+		default:
+			parts := strings.Split(args, "|")
+			if len(parts) < 3 {
+				return nil, false
+			}
+			req.Question = parts[0]
+			req.Options = parts[1:]
+			return req, true
+		}
+		args = rest
+	}
+}
+
+func runVote(ctx context.Context, call *CommandCall) error {
+	args := strings.FieldsFunc(call.Args, func(r rune) bool { return r == ' ' || r == ',' })
+	if len(args) == 0 {
+		return usage(call)
+	}
+	options := make([]int, len(args)-1)
+	for i, arg := range args[1:] {
+		n, err := strconv.Atoi(arg)
+		if err != nil {
+			return usage(call)
+		}
+		options[i] = n
+	}
+
+	res, err := call.hub.service.VotePoll(ctx, &interfaces.PollVoteReq{
+		UserID:  call.UserID,
+		PollID:  strings.TrimPrefix(args[0], "#"),
+		Options: options,
+	})
+	if err != nil {
+		return err
+	}
+
+	call.hub.Events <- pollUpdate(res)
+	return nil
+}
+
+func runClosePoll(ctx context.Context, call *CommandCall) error {
+	args := call.Fields()
+	if len(args) != 1 {
+		return usage(call)
+	}
+
+	res, err := call.hub.service.ClosePoll(ctx, call.UserID, strings.TrimPrefix(args[0], "#"))
+	if err != nil {
+		return err
+	}
+
+	call.hub.Events <- pollUpdate(res)
+	return nil
+}
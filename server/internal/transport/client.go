@@ -1,9 +1,13 @@
 package transport
 
 import (
+	"chatgo/server/internal/interfaces"
+	"context"
+	"fmt"
 	"log"
+	"strings"
+	"time"
 
-	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 )
 
@@ -19,6 +23,14 @@ func (c *Client) writeMessage() {
 		}
 
 		c.Conn.WriteJSON(message)
+
+		// The connection is closed but the channel is drained until the hub unregisters the client
+		if message.disconnect {
+			c.Conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "removed from the room"),
+				time.Now().Add(time.Second))
+			c.Conn.Close()
+		}
 	}
 }
 
@@ -38,23 +50,192 @@ func (c *Client) readMessage(hub *Hub) {
 			break
 		}
 
-		// Set RoomID from client's current room
-		message.RoomID = c.RoomID
+		c.handleMessage(hub, &message)
+	}
+}
 
-		// Validate message
-		if message.Content == "" || message.Username == "" {
-			log.Printf("Invalid message format: %+v", message)
-			c.Conn.WriteJSON(gin.H{"error": "Invalid message format"})
-			continue
+// handleMessage handles a message read from the client. A message without a type is a chat
+// message. Unknown types take a token from the chat limit before they are rejected, so that
+// they can't be used to get around it. The sender is always the connection's user, whatever
+// the client put in the message
+func (c *Client) handleMessage(hub *Hub, message *Message) {
+	// Set RoomID from client's current room
+	message.RoomID = c.RoomID
+	message.Username = c.Username
+	if message.Type == "" {
+		message.Type = MessageTypeChat
+	}
+	limitType := message.Type
+	known := clientMessageTypes[message.Type]
+	if !known {
+		limitType = MessageTypeChat
+	}
+	if !c.allowMessage(hub, limitType) {
+		return
+	}
+	if !known {
+		c.sendError(fmt.Sprintf("unknown message type %q", message.Type))
+		return
+	}
+	if message.Type != MessageTypePresence {
+		hub.presence.activity(c)
+	}
+
+	switch message.Type {
+	case MessageTypeReactionAdd, MessageTypeReactionRemove:
+		c.handleReaction(hub, message)
+		return
+	case MessageTypeRead:
+		c.handleRead(hub, message)
+		return
+	case MessageTypePin, MessageTypeUnpin:
+		c.handlePin(hub, message)
+		return
+	case MessageTypeTyping, MessageTypeTypingStop:
+		c.handleTyping(hub, message.Type)
+		return
+	case MessageTypePresence:
+		if err := hub.presence.setStatus(c, message.Content); err != nil {
+			c.sendError(err.Error())
 		}
+		return
+	}
 
-		if err != nil {
-			log.Printf("Failed to store message: %v", err)
-			c.Conn.WriteJSON(gin.H{"error": "Failed to store message"})
-			continue
+	// Slash commands are run by the server instead of being stored. A double slash
+	// sends the text with a single leading slash
+	if !message.Encrypted && strings.HasPrefix(message.Content, "/") {
+		if !strings.HasPrefix(message.Content, "//") {
+			c.handleCommand(hub, message)
+			return
+		}
+		message.Content = message.Content[1:]
+	}
+
+	// Validate message
+	if message.Content == "" {
+		log.Printf("Invalid message format: %+v", message)
+		c.sendError("Invalid message format")
+		return
+	}
+
+	// Sending a message ends typing
+	if hub.typing.stop(c) {
+		hub.Events <- typingEvent(c, MessageTypeTypingStop)
+	}
+
+	// Broadcast message to room
+	message.sender = c
+	hub.Broadcast <- message
+}
+
+// sendError sends an error notice only to the client. It goes through the Message channel
+// like everything else, because only writeMessage may write to the connection
+func (c *Client) sendError(text string) {
+	c.Message <- &Message{Type: MessageTypeNotice, Error: text, RoomID: c.RoomID}
+}
+
+// handleReaction stores a reaction change and relays the updated counts to the room
+func (c *Client) handleReaction(hub *Hub, message *Message) {
+	req := &interfaces.ReactionReq{
+		MessageID: message.ID,
+		RoomID:    c.RoomID,
+		Username:  c.Username,
+		Emoji:     message.Emoji,
+	}
+
+	var res *interfaces.ReactionRes
+	var err error
+	if message.Type == MessageTypeReactionAdd {
+		res, err = hub.service.AddReaction(context.Background(), req)
+	} else {
+		res, err = hub.service.RemoveReaction(context.Background(), req)
+	}
+	if err != nil {
+		log.Printf("Failed to update reaction: %v", err)
+		c.sendError(err.Error())
+		return
+	}
+
+	// Nothing to tell the room about repeated or missing reactions
+	if !res.Changed {
+		return
+	}
+
+	hub.Events <- &Message{
+		ID:        res.MessageID,
+		Type:      message.Type,
+		RoomID:    c.RoomID,
+		Username:  c.Username,
+		Emoji:     res.Emoji,
+		Reactions: res.Reactions,
+	}
+}
+
+// handlePin pins or unpins a message in the current room and relays the change with the
+// updated list of pins
+func (c *Client) handlePin(hub *Hub, message *Message) {
+	req := &interfaces.PinReq{
+		UserID:    c.ID,
+		RoomID:    c.RoomID,
+		MessageID: message.ID,
+	}
+
+	var res *interfaces.PinRes
+	var err error
+	if message.Type == MessageTypePin {
+		res, err = hub.service.PinMessage(context.Background(), req)
+	} else {
+		res, err = hub.service.UnpinMessage(context.Background(), req)
+	}
+	if err != nil {
+		log.Printf("Failed to update pin: %v", err)
+		c.sendError(err.Error())
+		return
+	}
+
+	if !res.Changed {
+		return
+	}
+
+	hub.Events <- &Message{
+		ID:       res.MessageID,
+		Type:     message.Type,
+		RoomID:   c.RoomID,
+		Username: c.Username,
+		Pins:     res.Pins,
+	}
+}
+
+// handleRead moves the client's read marker in the current room
+func (c *Client) handleRead(hub *Hub, message *Message) {
+	err := hub.service.MarkRoomRead(context.Background(), &interfaces.MarkRoomReadReq{
+		UserID:    c.ID,
+		RoomID:    c.RoomID,
+		MessageID: message.ID,
+	})
+	if err != nil {
+		log.Printf("Failed to mark room as read: %v", err)
+		c.sendError(err.Error())
+	}
+}
+
+// handleTyping updates the typing state of the client and relays changes to the room.
+// Typing signals more frequent than typingMinInterval are dropped
+func (c *Client) handleTyping(hub *Hub, messageType string) {
+	if messageType == MessageTypeTypingStop {
+		if hub.typing.stop(c) {
+			hub.Events <- typingEvent(c, MessageTypeTypingStop)
 		}
+		return
+	}
+
+	now := time.Now()
+	if now.Sub(c.lastTypingAt) < typingMinInterval {
+		return
+	}
+	c.lastTypingAt = now
 
-		// Broadcast message to room
-		hub.Broadcast <- &message
+	if hub.typing.start(c) {
+		hub.Events <- typingEvent(c, MessageTypeTyping)
 	}
 }
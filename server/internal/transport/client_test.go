@@ -0,0 +1,50 @@
+package transport
+
+import (
+	"testing"
+	"time"
+
+	"chatgo/server/internal/ratelimit"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestClient_handleMessage_UnknownType checks that messages of unknown types are rejected and
+// count against the chat limit, so that they can't be used to flood the room
+func TestClient_handleMessage_UnknownType(t *testing.T) {
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryStore(), nil, map[string]ratelimit.Rule{
+		MessageTypeChat: {Rate: 2, Per: time.Minute},
+	})
+	hub := NewHub(nil, limiter)
+	cl := &Client{Message: make(chan *Message, 10), ID: "1", RoomID: "5", Username: "alice", ip: "203.0.113.1"}
+
+	for range 2 {
+		cl.handleMessage(hub, &Message{Type: "x", Content: "spam", Username: "alice"})
+		notice := <-cl.Message
+		assert.Equal(t, MessageTypeNotice, notice.Type)
+		assert.Contains(t, notice.Error, "unknown message type")
+	}
+
+	cl.handleMessage(hub, &Message{Type: "x", Content: "spam", Username: "alice"})
+	notice := <-cl.Message
+	assert.Contains(t, notice.Error, "too many requests")
+	assert.Positive(t, notice.RetryAfter)
+
+	// The unknown types used up the chat limit
+	cl.handleMessage(hub, &Message{Content: "spam", Username: "alice"})
+	notice = <-cl.Message
+	assert.Contains(t, notice.Error, "too many requests")
+	assert.Empty(t, hub.Broadcast)
+}
+
+// TestClient_handleMessage_Username checks that the sender is taken from the connection, not
+// from the username the client put in the message
+func TestClient_handleMessage_Username(t *testing.T) {
+	hub := NewHub(nil, nil)
+	cl := &Client{Message: make(chan *Message, 10), ID: "1", RoomID: "5", Username: "alice", ip: "203.0.113.1"}
+
+	cl.handleMessage(hub, &Message{Content: "hi", Username: "admin"})
+	message := <-hub.Broadcast
+	assert.Equal(t, "alice", message.Username)
+	assert.Equal(t, "5", message.RoomID)
+}
@@ -0,0 +1,155 @@
+package transport
+
+import (
+	"chatgo/server/internal/interfaces"
+	"chatgo/server/internal/models"
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// commandTimeout limits how long a slash command may run
+const commandTimeout = 10 * time.Second
+
+// Command is a slash command run by the server instead of being stored as a message
+type Command struct {
+	// Name is the command without the slash, e.g. "roll"
+	Name string
+	// Usage describes the arguments, e.g. "[NdM]"
+	Usage       string
+	Description string
+	// Role is the lowest member role allowed to run the command
+	Role models.MemberRole
+	Run  CommandFunc
+}
+
+// CommandFunc runs a command. A returned error is sent only to the client that ran it
+type CommandFunc func(ctx context.Context, call *CommandCall) error
+
+// CommandCall is a slash command sent by a client
+type CommandCall struct {
+	Name     string
+	Args     string
+	RoomID   string
+	UserID   string
+	Username string
+	Role     models.MemberRole
+	// Bot posts as the bot of the plugin that registered the command, it is nil for built-in commands
+	Bot BotPoster
+
+	hub    *Hub
+	client *Client
+}
+
+// Fields splits the arguments on white space
+func (c *CommandCall) Fields() []string {
+	return strings.Fields(c.Args)
+}
+
+// Reply sends a notice only to the client that ran the command
+func (c *CommandCall) Reply(format string, args ...interface{}) {
+	c.client.Message <- &Message{
+		Type:    MessageTypeNotice,
+		Content: fmt.Sprintf(format, args...),
+		RoomID:  c.RoomID,
+	}
+}
+
+// Say stores text as a message from the user who ran the command and broadcasts it to the room
+func (c *CommandCall) Say(ctx context.Context, text string) error {
+	res, err := c.hub.service.CreateMessage(ctx, &interfaces.CreateMessageReq{
+		Content:  text,
+		RoomID:   c.RoomID,
+		Username: c.Username,
+	})
+	if err != nil {
+		return err
+	}
+
+	c.hub.Broadcast <- &Message{
+		Type:     MessageTypeChat,
+		Content:  text,
+		RoomID:   c.RoomID,
+		Username: c.Username,
+		stored:   res,
+	}
+	return nil
+}
+
+// RegisterCommand adds a slash command. Commands must be registered before the hub runs
+func (h *Hub) RegisterCommand(cmd *Command) error {
+	if cmd.Name == "" || strings.ContainsAny(cmd.Name, " /") {
+		return fmt.Errorf("invalid command name %q", cmd.Name)
+	}
+	if _, ok := h.commands[cmd.Name]; ok {
+		return fmt.Errorf("command /%s is already registered", cmd.Name)
+	}
+	if cmd.Role == "" {
+		cmd.Role = models.Member
+	}
+	h.commands[cmd.Name] = cmd
+	return nil
+}
+
+// availableCommands returns the commands the role may run, sorted by name
+func (h *Hub) availableCommands(role models.MemberRole) []*Command {
+	commands := make([]*Command, 0, len(h.commands))
+	for _, cmd := range h.commands {
+		if role.AtLeast(cmd.Role) {
+			commands = append(commands, cmd)
+		}
+	}
+	sort.Slice(commands, func(i, j int) bool {
+		return commands[i].Name < commands[j].Name
+	})
+	return commands
+}
+
+// parseCommand splits "/name args" into the command name and its arguments
+func parseCommand(content string) (string, string) {
+	name, args, _ := strings.Cut(strings.TrimPrefix(content, "/"), " ")
+	return strings.ToLower(name), strings.TrimSpace(args)
+}
+
+// handleCommand runs a slash command sent by the client after checking the client's role in the room
+func (c *Client) handleCommand(hub *Hub, message *Message) {
+	name, args := parseCommand(message.Content)
+	cmd, ok := hub.commands[name]
+	if !ok {
+		c.sendError(fmt.Sprintf("unknown command /%s, see /help", name))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	role, err := hub.service.GetMemberRole(ctx, c.ID, c.RoomID)
+	if err != nil {
+		log.Printf("Failed to get role of %s in room %s: %v", c.ID, c.RoomID, err)
+		c.sendError(err.Error())
+		return
+	}
+	if !role.AtLeast(cmd.Role) {
+		c.sendError(fmt.Sprintf("/%s is only available to room %ss", name, cmd.Role))
+		return
+	}
+
+	err = cmd.Run(ctx, &CommandCall{
+		Name:     name,
+		Args:     args,
+		RoomID:   c.RoomID,
+		UserID:   c.ID,
+		Username: c.Username,
+		Role:     role,
+		Bot:      hub.commandBots[name],
+		hub:      hub,
+		client:   c,
+	})
+	if err != nil {
+		log.Printf("Command /%s in room %s failed: %v", name, c.RoomID, err)
+		c.sendError(err.Error())
+	}
+}
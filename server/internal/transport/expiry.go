@@ -0,0 +1,31 @@
+package transport
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// expiryCheckInterval is how often expired disappearing messages are deleted
+const expiryCheckInterval = time.Second
+
+// expireMessages periodically deletes expired disappearing messages and tells their rooms
+// to remove them from the screen
+func (h *Hub) expireMessages() {
+	ticker := time.NewTicker(expiryCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		expired, err := h.service.ExpireMessages(context.Background())
+		if err != nil {
+			log.Printf("Failed to delete expired messages: %v", err)
+		}
+		for _, m := range expired {
+			h.Events <- &Message{
+				ID:     m.ID,
+				Type:   MessageTypeExpired,
+				RoomID: m.RoomID,
+			}
+		}
+	}
+}
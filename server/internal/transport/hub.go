@@ -2,6 +2,7 @@ package transport
 
 import (
 	"chatgo/server/internal/interfaces"
+	"chatgo/server/internal/ratelimit"
 	"context"
 	"log"
 )
@@ -11,20 +12,55 @@ type Hub struct {
 	Register   chan *Client
 	Unregister chan *Client
 	Broadcast  chan *Message
+	Events     chan *Message
+	webhooks   chan *interfaces.WebhookEventReq
 	service    interfaces.Service
+	typing     *typingTracker
+	presence   *presenceTracker
+	limiter    *ratelimit.Limiter
+
+	// commands and plugins are set up before the hub runs and only read afterwards
+	commands    map[string]*Command
+	commandBots map[string]BotPoster
+	plugins     []*pluginRunner
 }
 
-func NewHub(service interfaces.Service) *Hub {
-	return &Hub{
+// NewHub creates the hub. A nil limiter turns the rate limits of WebSocket messages off
+func NewHub(service interfaces.Service, limiter *ratelimit.Limiter) *Hub {
+	events := make(chan *Message, 32)
+	h := &Hub{
 		Rooms:      make(map[string]*Room),
 		Register:   make(chan *Client),
 		Unregister: make(chan *Client),
 		Broadcast:  make(chan *Message, 5),
+		Events:     events,
+		webhooks:   make(chan *interfaces.WebhookEventReq, webhookQueueSize),
 		service:    service,
+		typing:     newTypingTracker(events),
+		presence:   newPresenceTracker(),
+		limiter:    limiter,
+
+		commands:    make(map[string]*Command),
+		commandBots: make(map[string]BotPoster),
+	}
+	for _, cmd := range builtinCommands() {
+		h.commands[cmd.Name] = cmd
 	}
+	return h
 }
 
 func (h *Hub) Run() {
+	go h.publishPresence()
+	go h.checkIdle()
+	go h.expireMessages()
+	go h.deliverScheduled()
+	go h.dispatchWebhooks()
+	go h.deliverWebhooks()
+	go h.closeExpiredPolls()
+	for _, r := range h.plugins {
+		go r.run()
+	}
+
 	for {
 		select {
 		case cl := <-h.Register:
@@ -34,6 +70,7 @@ func (h *Hub) Run() {
 
 				if _, ok := r.Clients[cl.ID]; !ok {
 					r.Clients[cl.ID] = cl
+					h.presence.connect(cl)
 					log.Printf("Client %s added to room %s", cl.ID, cl.RoomID)
 				}
 			} else {
@@ -53,6 +90,13 @@ func (h *Hub) Run() {
 
 					delete(h.Rooms[cl.RoomID].Clients, cl.ID)
 					close(cl.Message)
+					h.presence.disconnect(cl)
+
+					// A disconnected client can't send the stop signal itself
+					if h.typing.stop(cl) {
+						h.relay(typingEvent(cl, MessageTypeTypingStop))
+					}
+
 					log.Printf("Client %s removed from room %s", cl.ID, cl.RoomID)
 				}
 			}
@@ -60,14 +104,63 @@ func (h *Hub) Run() {
 		case m := <-h.Broadcast:
 			log.Printf("Broadcasting message to room %s: %s", m.RoomID, m.Content)
 			if _, ok := h.Rooms[m.RoomID]; ok {
-				// Store message in database
-				_, err := h.service.CreateMessage(context.Background(), &interfaces.CreateMessageReq{
-					Content:  m.Content,
-					RoomID:   m.RoomID,
-					Username: m.Username,
-				})
+				// Store message in database, unless it was stored before it was broadcast
+				res := m.stored
+				var err error
+				if res == nil {
+					res, err = h.service.CreateMessage(context.Background(), &interfaces.CreateMessageReq{
+						Content:   m.Content,
+						RoomID:    m.RoomID,
+						Username:  m.Username,
+						ParentID:  m.ParentID,
+						Encrypted: m.Encrypted,
+						TTL:       m.TTL,
+
+						AttachmentIDs: m.AttachmentIDs,
+					})
+				}
+				// A message that wasn't stored isn't relayed either, so that, for example, plaintext
+				// rejected by an end-to-end encrypted room never reaches its members
 				if err != nil {
 					log.Printf("Failed to store message: %v", err)
+					if m.sender != nil && h.Rooms[m.RoomID].Clients[m.sender.ID] == m.sender {
+						m.sender.sendError(err.Error())
+					}
+					continue
+				}
+				m.ID = res.ID
+				m.ParentID = res.ParentID
+				m.CreatedAt = res.CreatedAt
+				m.Mentions = res.Mentions
+				m.Attachments = res.Attachments
+				m.Encrypted = res.Encrypted
+				m.ExpiresAt = res.ExpiresAt
+				m.Bot = res.Bot
+				m.Poll = res.Poll
+
+				// The stored content is encrypted at rest, webhooks and plugins get the content as it was sent
+				if m.Type == MessageTypeChat {
+					created := *res
+					created.Content = m.Content
+					h.publishEvent(&RoomEvent{
+						Type:     interfaces.WebhookEventMessageCreated,
+						RoomID:   m.RoomID,
+						Username: created.Username,
+						Message:  &created,
+					})
+				}
+				m.AttachmentIDs = nil
+				m.TTL = 0
+				m.stored = nil
+				m.sender = nil
+
+				if len(m.Mentions) > 0 {
+					h.notifyMentions(m)
+				}
+
+				// Replies stay out of the main timeline, the room only learns about the thread activity
+				if m.ParentID != "" {
+					m = h.threadUpdate(m)
 				}
 
 				for _, cl := range h.Rooms[m.RoomID].Clients {
@@ -77,6 +170,87 @@ func (h *Hub) Run() {
 			} else {
 				log.Printf("Room %s not found for message broadcast", m.RoomID)
 			}
+
+		// Events are relayed to the room as is, they are never stored as messages
+		case e := <-h.Events:
+			h.relay(e)
 		}
 	}
 }
+
+// relay sends an event to the room. Typing indicators are not echoed back to the typist,
+// and removed members are disconnected after they are told about it
+func (h *Hub) relay(e *Message) {
+	r, ok := h.Rooms[e.RoomID]
+	if !ok {
+		return
+	}
+	for _, cl := range r.Clients {
+		if isTypingEvent(e) && cl.Username == e.Username {
+			continue
+		}
+		if e.Type == MessageTypeMemberRemoved && cl.Username == e.Content {
+			removed := *e
+			removed.disconnect = true
+			cl.Message <- &removed
+			continue
+		}
+		cl.Message <- e
+	}
+}
+
+// notifyMentions sends a mention event to mentioned users connected to other rooms,
+// once per user
+func (h *Hub) notifyMentions(m *Message) {
+	mentioned := make(map[string]bool, len(m.Mentions))
+	for _, username := range m.Mentions {
+		mentioned[username] = true
+	}
+
+	notified := make(map[string]bool)
+	for roomID, r := range h.Rooms {
+		if roomID == m.RoomID {
+			continue
+		}
+		for _, cl := range r.Clients {
+			if !mentioned[cl.Username] || notified[cl.ID] {
+				continue
+			}
+			notified[cl.ID] = true
+			cl.Message <- &Message{
+				ID:        m.ID,
+				Type:      MessageTypeMention,
+				Content:   m.Content,
+				RoomID:    m.RoomID,
+				Username:  m.Username,
+				ParentID:  m.ParentID,
+				CreatedAt: m.CreatedAt,
+			}
+		}
+	}
+}
+
+// threadUpdate builds a thread_update event for a stored reply
+func (h *Hub) threadUpdate(reply *Message) *Message {
+	update := &Message{
+		ID:          reply.ID,
+		Type:        MessageTypeThreadUpdate,
+		Content:     reply.Content,
+		RoomID:      reply.RoomID,
+		Username:    reply.Username,
+		ParentID:    reply.ParentID,
+		LastReplyAt: reply.CreatedAt,
+		CreatedAt:   reply.CreatedAt,
+		Encrypted:   reply.Encrypted,
+	}
+
+	root, err := h.service.GetMessageByID(context.Background(), reply.ParentID)
+	if err != nil {
+		log.Printf("Failed to get thread root %s: %v", reply.ParentID, err)
+		return update
+	}
+	update.ReplyCount = root.ReplyCount
+	update.LastReplyAt = root.LastReplyAt
+
+	return update
+}
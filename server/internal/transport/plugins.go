@@ -0,0 +1,152 @@
+package transport
+
+import (
+	"chatgo/server/internal/interfaces"
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// pluginQueueSize is how many events may wait for a plugin. When the queue is full,
+	// events are dropped rather than slowing down the hub
+	pluginQueueSize = 256
+	// pluginEventTimeout limits how long a plugin may handle one event
+	pluginEventTimeout = 30 * time.Second
+)
+
+// Plugin is a bot running inside the server. It reacts to room events and its own slash
+// commands, and posts with a bot API token, so it can only post to the rooms the token is granted
+type Plugin interface {
+	// Name identifies the plugin in logs
+	Name() string
+	// Commands returns the slash commands of the plugin, it may be empty
+	Commands() []*Command
+	// Events lists the room events the plugin subscribes to, see interfaces.WebhookEvent*
+	Events() []string
+	// HandleEvent is called for each subscribed event. Events of one plugin are handled
+	// one at a time, in the order they happened
+	HandleEvent(ctx context.Context, e *RoomEvent, bot BotPoster)
+}
+
+// BotPoster posts messages to rooms as a bot
+type BotPoster interface {
+	Post(ctx context.Context, roomID, text string) error
+}
+
+// RoomEvent is a room event sent to plugins and webhooks. Messages from bots and
+// end-to-end encrypted messages are not sent to plugins
+type RoomEvent struct {
+	Type   string
+	RoomID string
+	// UserID and Username identify the member that joined or left, Username is also the author
+	// of a created message
+	UserID   string
+	Username string
+	// Message is the created message for message.created, its content is as it was sent
+	Message *interfaces.CreateMessageRes
+	// Name is the new room name for room.renamed
+	Name string
+}
+
+// data returns the data of the event in webhook payloads
+func (e *RoomEvent) data() interface{} {
+	switch e.Type {
+	case interfaces.WebhookEventMessageCreated:
+		return e.Message
+	case interfaces.WebhookEventRoomRenamed:
+		return gin.H{"name": e.Name}
+	default:
+		return map[string]string{"userId": e.UserID, "username": e.Username}
+	}
+}
+
+// pluginBot posts as the bot that owns the API token of a plugin
+type pluginBot struct {
+	hub   *Hub
+	token string
+}
+
+// Post stores a message from the bot and broadcasts it to the room like any other message
+func (b *pluginBot) Post(ctx context.Context, roomID, text string) error {
+	res, err := b.hub.service.PostBotMessage(ctx, &interfaces.BotMessageReq{
+		Token:   b.token,
+		RoomID:  roomID,
+		Content: text,
+	})
+	if err != nil {
+		return err
+	}
+
+	b.hub.Broadcast <- &Message{
+		Type:     MessageTypeChat,
+		Content:  text,
+		RoomID:   res.RoomID,
+		Username: res.Username,
+		stored:   res,
+	}
+	return nil
+}
+
+// pluginRunner queues events for a plugin and handles them in its own goroutine
+type pluginRunner struct {
+	plugin Plugin
+	bot    *pluginBot
+	events map[string]bool
+	queue  chan *RoomEvent
+}
+
+// RegisterPlugin adds an in-process bot that posts with the given bot API token and registers
+// its commands. Plugins must be registered before the hub runs
+func (h *Hub) RegisterPlugin(p Plugin, token string) error {
+	bot := &pluginBot{hub: h, token: token}
+	for _, cmd := range p.Commands() {
+		if err := h.RegisterCommand(cmd); err != nil {
+			return fmt.Errorf("plugin %s: %w", p.Name(), err)
+		}
+		h.commandBots[cmd.Name] = bot
+	}
+
+	r := &pluginRunner{
+		plugin: p,
+		bot:    bot,
+		events: make(map[string]bool),
+		queue:  make(chan *RoomEvent, pluginQueueSize),
+	}
+	for _, event := range p.Events() {
+		r.events[event] = true
+	}
+	h.plugins = append(h.plugins, r)
+	return nil
+}
+
+// run handles queued events until the queue is closed
+func (r *pluginRunner) run() {
+	for e := range r.queue {
+		ctx, cancel := context.WithTimeout(context.Background(), pluginEventTimeout)
+		r.plugin.HandleEvent(ctx, e, r.bot)
+		cancel()
+	}
+}
+
+// publishEvent sends a room event to the subscribed webhooks and plugins. It never blocks
+func (h *Hub) publishEvent(e *RoomEvent) {
+	h.publishWebhook(e)
+
+	if e.Message != nil && (e.Message.Bot || e.Message.Encrypted) {
+		return
+	}
+	for _, r := range h.plugins {
+		if !r.events[e.Type] {
+			continue
+		}
+		select {
+		case r.queue <- e:
+		default:
+			log.Printf("Plugin %s is too slow, dropping %s event of room %s", r.plugin.Name(), e.Type, e.RoomID)
+		}
+	}
+}
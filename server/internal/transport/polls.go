@@ -0,0 +1,39 @@
+package transport
+
+import (
+	"chatgo/server/internal/interfaces"
+	"context"
+	"log"
+	"time"
+)
+
+// pollCheckInterval is how often polls that reached their closing time are closed
+const pollCheckInterval = 5 * time.Second
+
+// closeExpiredPolls periodically closes polls that reached their closing time and sends
+// their final results to the rooms
+func (h *Hub) closeExpiredPolls() {
+	ticker := time.NewTicker(pollCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		closed, err := h.service.CloseExpiredPolls(context.Background())
+		if err != nil {
+			log.Printf("Failed to close expired polls: %v", err)
+		}
+		for _, poll := range closed {
+			h.Events <- pollUpdate(poll)
+		}
+	}
+}
+
+// pollUpdate builds a poll event with the current results of the poll
+func pollUpdate(poll *interfaces.PollRes) *Message {
+	return &Message{
+		ID:      poll.MessageID,
+		Type:    MessageTypePoll,
+		Content: poll.Question,
+		RoomID:  poll.RoomID,
+		Poll:    poll,
+	}
+}
@@ -0,0 +1,224 @@
+package transport
+
+import (
+	"chatgo/server/internal/models"
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// presenceGracePeriod is how long a user stays online after the last connection closes,
+	// so that reconnects and room switches don't flap the status
+	presenceGracePeriod = 15 * time.Second
+	// autoAwayAfter is the inactivity period after which an online user becomes away
+	autoAwayAfter         = 5 * time.Minute
+	autoAwayCheckInterval = 30 * time.Second
+)
+
+type presenceState struct {
+	username     string
+	connections  int
+	status       string
+	manualAway   bool
+	lastActiveAt time.Time
+	offlineTimer *time.Timer
+}
+
+type presenceChange struct {
+	userID   string
+	username string
+	status   string
+}
+
+// presenceTracker derives user statuses from live connections and activity.
+// Status changes are queued in order and published by Hub.publishPresence
+type presenceTracker struct {
+	mu    sync.Mutex
+	users map[string]*presenceState
+	// pending holds the queued changes, notify wakes up publishPresence. Nothing blocks while
+	// mu is held: publishing may wait for the hub, which calls connect and needs mu
+	pending []presenceChange
+	notify  chan struct{}
+}
+
+func newPresenceTracker() *presenceTracker {
+	return &presenceTracker{
+		users:  make(map[string]*presenceState),
+		notify: make(chan struct{}, 1),
+	}
+}
+
+// connect registers a new connection of the client's user. The first connection makes
+// the user online, a reconnect within the grace period keeps the current status
+func (t *presenceTracker) connect(cl *Client) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state, ok := t.users[cl.ID]
+	if !ok {
+		state = &presenceState{username: cl.Username, status: models.Offline}
+		t.users[cl.ID] = state
+	}
+	state.connections++
+	state.lastActiveAt = time.Now()
+
+	if state.offlineTimer != nil {
+		state.offlineTimer.Stop()
+		state.offlineTimer = nil
+	}
+	if state.status == models.Offline {
+		t.set(cl.ID, state, models.Online)
+	}
+}
+
+// disconnect removes a connection of the client's user. The user goes offline when
+// no connection comes back within presenceGracePeriod
+func (t *presenceTracker) disconnect(cl *Client) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state, ok := t.users[cl.ID]
+	if !ok {
+		return
+	}
+	state.connections--
+	if state.connections > 0 {
+		return
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(presenceGracePeriod, func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		if state.offlineTimer != timer || state.connections > 0 {
+			return
+		}
+		delete(t.users, cl.ID)
+		state.offlineTimer = nil
+		state.manualAway = false
+		t.set(cl.ID, state, models.Offline)
+	})
+	state.offlineTimer = timer
+}
+
+// activity records user activity and brings back users that went away automatically
+func (t *presenceTracker) activity(cl *Client) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state, ok := t.users[cl.ID]
+	if !ok {
+		return
+	}
+	state.lastActiveAt = time.Now()
+	if state.status == models.Away && !state.manualAway {
+		t.set(cl.ID, state, models.Online)
+	}
+}
+
+// setStatus handles a manual status change. Manual away is kept until the user sets
+// online again, activity doesn't reset it
+func (t *presenceTracker) setStatus(cl *Client, status string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state, ok := t.users[cl.ID]
+	if !ok {
+		return fmt.Errorf("user %s is not connected", cl.ID)
+	}
+
+	switch status {
+	case models.Away:
+		state.manualAway = true
+	case models.Online:
+		state.manualAway = false
+		state.lastActiveAt = time.Now()
+	default:
+		return fmt.Errorf("invalid status %q", status)
+	}
+	t.set(cl.ID, state, status)
+
+	return nil
+}
+
+// markIdle makes online users without activity since autoAwayAfter away
+func (t *presenceTracker) markIdle(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for userID, state := range t.users {
+		if state.status == models.Online && state.connections > 0 && now.Sub(state.lastActiveAt) >= autoAwayAfter {
+			t.set(userID, state, models.Away)
+		}
+	}
+}
+
+// set changes the status and queues the change. Must be called with t.mu held
+func (t *presenceTracker) set(userID string, state *presenceState, status string) {
+	if state.status == status {
+		return
+	}
+	state.status = status
+	t.pending = append(t.pending, presenceChange{userID: userID, username: state.username, status: status})
+	select {
+	case t.notify <- struct{}{}:
+	default:
+		// publishPresence is already woken up and takes this change too
+	}
+}
+
+// takeChanges returns the queued changes in order and clears the queue
+func (t *presenceTracker) takeChanges() []presenceChange {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	changes := t.pending
+	t.pending = nil
+	return changes
+}
+
+// publishPresence stores presence changes and broadcasts them to every room the user
+// is a member of
+func (h *Hub) publishPresence() {
+	for range h.presence.notify {
+		for _, change := range h.presence.takeChanges() {
+			h.publishPresenceChange(change)
+		}
+	}
+}
+
+func (h *Hub) publishPresenceChange(change presenceChange) {
+	ctx := context.Background()
+	if err := h.service.SetUserStatus(ctx, change.userID, change.status); err != nil {
+		log.Printf("Failed to update status of user %s: %v", change.userID, err)
+		return
+	}
+
+	rooms, err := h.service.GetChatRoomsByUserID(ctx, change.userID)
+	if err != nil {
+		log.Printf("Failed to get rooms of user %s: %v", change.userID, err)
+		return
+	}
+	for _, room := range rooms {
+		h.Events <- &Message{
+			Type:     MessageTypePresence,
+			Content:  change.status,
+			RoomID:   room.ID,
+			Username: change.username,
+		}
+	}
+}
+
+// checkIdle periodically moves inactive users to away
+func (h *Hub) checkIdle() {
+	ticker := time.NewTicker(autoAwayCheckInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		h.presence.markIdle(now)
+	}
+}
@@ -0,0 +1,77 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimit is a middleware that applies the rate limit of the matched route, keyed by the client IP
+// and, for requests with a valid access token, by the user. Requests over the limit get 429 with
+// a Retry-After header
+func (h *UserHandler) RateLimit(c *gin.Context) {
+	keys := []string{"ip:" + c.ClientIP()}
+	if token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "); token != "" {
+		if user, err := h.UserService.ValidateToken(c.Request.Context(), token); err == nil {
+			keys = append(keys, "user:"+user.ID)
+		}
+	}
+
+	if !h.allowRoute(c, keys...) {
+		return
+	}
+	c.Next()
+}
+
+// allowRoute takes a token for the matched route from the bucket of each key. Over the limit it
+// aborts the request with 429
+func (h *UserHandler) allowRoute(c *gin.Context, keys ...string) bool {
+	ok, wait, err := h.limiter.AllowRoute(c.Request.Context(), c.Request.Method+" "+c.FullPath(), keys...)
+	if err != nil {
+		// A broken store must not take the whole server down
+		log.Printf("Failed to check rate limit: %v", err)
+		return true
+	}
+	if !ok {
+		c.Header("Retry-After", strconv.Itoa(retrySeconds(wait)))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": rateLimitError(wait)})
+		return false
+	}
+	return true
+}
+
+// allowMessage takes a token for the message type from the buckets of the user and the address
+// of the client. Over the limit it sends an error notice and the message is dropped
+func (c *Client) allowMessage(hub *Hub, messageType string) bool {
+	ok, wait, err := hub.limiter.AllowMessage(context.Background(), messageType, "user:"+c.ID, "ip:"+c.ip)
+	if err != nil {
+		log.Printf("Failed to check rate limit: %v", err)
+		return true
+	}
+	if !ok {
+		c.Message <- &Message{
+			Type:       MessageTypeNotice,
+			RoomID:     c.RoomID,
+			Error:      rateLimitError(wait),
+			RetryAfter: retrySeconds(wait),
+		}
+		return false
+	}
+	return true
+}
+
+// retrySeconds rounds the wait up to whole seconds
+func retrySeconds(wait time.Duration) int {
+	return int(math.Ceil(wait.Seconds()))
+}
+
+func rateLimitError(wait time.Duration) string {
+	return fmt.Sprintf("too many requests, try again in %ds", retrySeconds(wait))
+}
@@ -0,0 +1,33 @@
+package transport
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// scheduleCheckInterval is how often due scheduled messages are delivered
+const scheduleCheckInterval = time.Second
+
+// deliverScheduled periodically delivers due scheduled messages. The service stores each of them
+// exactly once, then they go through Broadcast like messages sent by connected clients
+func (h *Hub) deliverScheduled() {
+	ticker := time.NewTicker(scheduleCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		delivered, err := h.service.DeliverScheduledMessages(context.Background())
+		if err != nil {
+			log.Printf("Failed to deliver scheduled messages: %v", err)
+		}
+		for _, res := range delivered {
+			h.Broadcast <- &Message{
+				Type:     MessageTypeChat,
+				Content:  res.Content,
+				RoomID:   res.RoomID,
+				Username: res.Username,
+				stored:   res,
+			}
+		}
+	}
+}
@@ -1,9 +1,71 @@
 package transport
 
 import (
+	"chatgo/server/internal/interfaces"
+	"time"
+
 	"github.com/gorilla/websocket"
 )
 
+// Message types sent over the room WebSocket
+const (
+	// MessageTypeChat is a regular chat message, stored and shown in the timeline
+	MessageTypeChat = "message"
+	// MessageTypeThreadUpdate notifies clients about a new reply in a thread
+	// without putting the reply itself into the main timeline
+	MessageTypeThreadUpdate = "thread_update"
+	// MessageTypeReactionAdd and MessageTypeReactionRemove are sent by clients to
+	// react to the message with the given ID and relayed back with updated counts
+	MessageTypeReactionAdd    = "reaction_add"
+	MessageTypeReactionRemove = "reaction_remove"
+	// MessageTypeMention notifies a user connected to another room that they were mentioned
+	MessageTypeMention = "mention"
+	// MessageTypeRead is sent by clients to move their read marker up to the message
+	// with the given ID, or to the latest message when ID is empty. It is not relayed
+	MessageTypeRead = "read"
+	// MessageTypeTyping and MessageTypeTypingStop are ephemeral indicators relayed to
+	// the other members of the room. They are never stored
+	MessageTypeTyping     = "typing"
+	MessageTypeTypingStop = "typing_stop"
+	// MessageTypePresence carries a user status in Content. Clients send it to set
+	// themselves away or back online, the server broadcasts it to rooms the user shares
+	MessageTypePresence = "presence"
+	// MessageTypeExpired tells clients that the disappearing message with the given ID
+	// was deleted and should be removed from the screen
+	MessageTypeExpired = "expired"
+	// MessageTypePin and MessageTypeUnpin are sent by room admins to pin or unpin the message
+	// with the given ID and relayed to the room with the updated list of pins
+	MessageTypePin   = "pin"
+	MessageTypeUnpin = "unpin"
+	// MessageTypeTopic notifies the room that its topic changed
+	MessageTypeTopic = "topic"
+	// MessageTypeWelcome is sent only to a client that joined the room, with the room topic
+	// and pinned messages
+	MessageTypeWelcome = "welcome"
+	// MessageTypeNotice is a reply to a slash command, sent only to the client that ran it
+	MessageTypeNotice = "notice"
+	// MessageTypeMemberAdded and MessageTypeMemberRemoved tell the room that Username added or
+	// removed the member named in Content. A removed member is disconnected from the room
+	MessageTypeMemberAdded   = "member_added"
+	MessageTypeMemberRemoved = "member_removed"
+	// MessageTypePoll carries the current results of the poll shown by the message with the given ID.
+	// It is sent to the room after each vote and when the poll closes
+	MessageTypePoll = "poll"
+)
+
+// clientMessageTypes are the message types clients may send, other types are rejected
+var clientMessageTypes = map[string]bool{
+	MessageTypeChat:           true,
+	MessageTypeReactionAdd:    true,
+	MessageTypeReactionRemove: true,
+	MessageTypeRead:           true,
+	MessageTypePin:            true,
+	MessageTypeUnpin:          true,
+	MessageTypeTyping:         true,
+	MessageTypeTypingStop:     true,
+	MessageTypePresence:       true,
+}
+
 // Client represents a connected WebSocket client
 type Client struct {
 	Conn     *websocket.Conn
@@ -11,13 +73,54 @@ type Client struct {
 	ID       string `json:"id"`
 	RoomID   string `json:"roomId"`
 	Username string `json:"username"`
+
+	// lastTypingAt is used to rate limit typing signals, it is only accessed by readMessage
+	lastTypingAt time.Time
+	// ip is the address the client connected from, it keys rate limits
+	ip string
 }
 
 // Message represents a chat message
 type Message struct {
-	Content  string `json:"content"`
-	RoomID   string `json:"roomId"`
-	Username string `json:"username"`
+	ID          string `json:"id,omitempty"`
+	Type        string `json:"type,omitempty"`
+	Content     string `json:"content"`
+	RoomID      string `json:"roomId"`
+	Username    string `json:"username"`
+	ParentID    string `json:"parentId,omitempty"`
+	ReplyCount  int    `json:"replyCount,omitempty"`
+	LastReplyAt string `json:"lastReplyAt,omitempty"`
+	CreatedAt   string `json:"createdAt,omitempty"`
+	Emoji       string `json:"emoji,omitempty"`
+	// Encrypted marks content encrypted by the client in an end-to-end encrypted room
+	Encrypted bool `json:"encrypted,omitempty"`
+	// TTL is the time-to-live in seconds a client asks for a disappearing message,
+	// ExpiresAt is when the stored message will be deleted
+	TTL       int    `json:"ttl,omitempty"`
+	ExpiresAt string `json:"expiresAt,omitempty"`
+	// Topic is the room topic in topic and welcome events
+	Topic string `json:"topic,omitempty"`
+	// Bot marks messages sent by bots
+	Bot bool `json:"bot,omitempty"`
+	// Error is set on notices that tell the client its message or command failed, RetryAfter
+	// on those that dropped a message over the rate limit, in seconds
+	Error      string `json:"error,omitempty"`
+	RetryAfter int    `json:"retryAfter,omitempty"`
+
+	Reactions     []*interfaces.ReactionCountRes `json:"reactions,omitempty"`
+	Mentions      []string                       `json:"mentions,omitempty"`
+	AttachmentIDs []string                       `json:"attachmentIds,omitempty"`
+	Attachments   []*interfaces.AttachmentRes    `json:"attachments,omitempty"`
+	Pins          []*interfaces.PinnedMessageRes `json:"pins,omitempty"`
+	Poll          *interfaces.PollRes            `json:"poll,omitempty"`
+
+	// stored is set for messages that are already stored, such as delivered scheduled messages,
+	// so that the hub only broadcasts them
+	stored *interfaces.CreateMessageRes
+	// disconnect closes the connection of the client once the message is written
+	disconnect bool
+	// sender is the client that sent the message, it is told when the message can't be stored
+	sender *Client
 }
 
 // Room represents a chat room
@@ -29,12 +132,27 @@ type Room struct {
 
 // RoomRes represents a chat room in responses
 type RoomRes struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	E2E        bool   `json:"e2e,omitempty"`
+	MessageTTL int    `json:"messageTtl,omitempty"`
 }
 
 // ClientRes represents a client in responses
 type ClientRes struct {
-	ID       string `json:"id"`
-	Username string `json:"username"`
+	ID          string `json:"id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"displayName,omitempty"`
+	StatusText  string `json:"statusText,omitempty"`
+}
+
+// IncomingWebhookReq is the payload accepted by incoming webhooks
+type IncomingWebhookReq struct {
+	Text string `json:"text"`
+}
+
+// ThreadRes represents a thread root message with its replies
+type ThreadRes struct {
+	Root    *interfaces.CreateMessageRes   `json:"root"`
+	Replies []*interfaces.CreateMessageRes `json:"replies"`
 }
@@ -0,0 +1,90 @@
+package transport
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// typingTimeout is how long a typing indicator lives without a refresh or a stop signal
+	typingTimeout = 6 * time.Second
+	// typingMinInterval is the minimum interval between typing signals accepted from one client
+	typingMinInterval = time.Second
+)
+
+// typingTracker keeps the set of clients currently typing in each room and expires
+// indicators whose stop signal never arrived. Its state lives only in memory
+type typingTracker struct {
+	mu     sync.Mutex
+	timers map[string]*time.Timer
+	events chan<- *Message
+}
+
+func newTypingTracker(events chan<- *Message) *typingTracker {
+	return &typingTracker{
+		timers: make(map[string]*time.Timer),
+		events: events,
+	}
+}
+
+func typingKey(cl *Client) string {
+	return cl.RoomID + "/" + cl.ID
+}
+
+// start marks the client as typing and restarts its expiry timer.
+// It reports whether the client was not typing before
+func (t *typingTracker) start(cl *Client) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := typingKey(cl)
+	old, typing := t.timers[key]
+	if typing {
+		old.Stop()
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(typingTimeout, func() {
+		t.mu.Lock()
+		expired := t.timers[key] == timer
+		if expired {
+			delete(t.timers, key)
+		}
+		t.mu.Unlock()
+
+		if expired {
+			t.events <- typingEvent(cl, MessageTypeTypingStop)
+		}
+	})
+	t.timers[key] = timer
+
+	return !typing
+}
+
+// stop clears the typing state of the client and reports whether it was typing
+func (t *typingTracker) stop(cl *Client) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := typingKey(cl)
+	timer, ok := t.timers[key]
+	if !ok {
+		return false
+	}
+	timer.Stop()
+	delete(t.timers, key)
+
+	return true
+}
+
+func typingEvent(cl *Client, messageType string) *Message {
+	return &Message{
+		Type:     messageType,
+		RoomID:   cl.RoomID,
+		Username: cl.Username,
+	}
+}
+
+func isTypingEvent(m *Message) bool {
+	return m.Type == MessageTypeTyping || m.Type == MessageTypeTypingStop
+}
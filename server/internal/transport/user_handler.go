@@ -2,18 +2,26 @@ package transport
 
 import (
 	"chatgo/server/internal/interfaces"
+	"chatgo/server/internal/ratelimit"
+	"errors"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 type UserHandler struct {
 	interfaces.UserService
+	limiter *ratelimit.Limiter
 }
 
-func NewUserHandler(s interfaces.UserService) *UserHandler {
+// NewUserHandler creates the user handler. A nil limiter turns rate limits off
+func NewUserHandler(s interfaces.UserService, limiter *ratelimit.Limiter) *UserHandler {
 	return &UserHandler{
 		UserService: s,
+		limiter:     limiter,
 	}
 }
 
@@ -26,7 +34,7 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 
 	res, err := h.UserService.CreateUser(c.Request.Context(), &u)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(loginErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -39,10 +47,42 @@ func (h *UserHandler) Login(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	// The address is limited by the RateLimit middleware, the account is limited here, so that
+	// guessing a password from many addresses is slow too
+	if !h.allowRoute(c, "username:"+strings.ToLower(user.Username)) {
+		return
+	}
+
+	user.IP = c.ClientIP()
+	user.UserAgent = c.Request.UserAgent()
 
 	u, err := h.UserService.Login(c.Request.Context(), &user)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		loginError(c, err)
+		return
+	}
+
+	// Accounts with two-factor authentication get the access token from LoginTwoFactor
+	if !u.TwoFactorRequired {
+		c.SetCookie("jwt", u.AccessToken, 60*60*24, "/", "localhost", false, true)
+	}
+	c.JSON(http.StatusOK, u)
+}
+
+// LoginTwoFactor finishes a login with two-factor authentication with a code from the
+// authenticator app or a recovery code
+func (h *UserHandler) LoginTwoFactor(c *gin.Context) {
+	var req interfaces.LoginTwoFactorReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.IP = c.ClientIP()
+	req.UserAgent = c.Request.UserAgent()
+
+	u, err := h.UserService.LoginTwoFactor(c.Request.Context(), &req)
+	if err != nil {
+		loginError(c, err)
 		return
 	}
 
@@ -50,6 +90,53 @@ func (h *UserHandler) Login(c *gin.Context) {
 	c.JSON(http.StatusOK, u)
 }
 
+// EnrollTwoFactor creates a new TOTP secret for the caller. It has to be confirmed with
+// ConfirmTwoFactor before logins require it
+func (h *UserHandler) EnrollTwoFactor(c *gin.Context) {
+	res, err := h.UserService.EnrollTwoFactor(c.Request.Context(), c.GetString("userId"))
+	if err != nil {
+		c.JSON(loginErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// ConfirmTwoFactor enables two-factor authentication and returns the recovery codes
+func (h *UserHandler) ConfirmTwoFactor(c *gin.Context) {
+	var req interfaces.TwoFactorCodeReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.UserID = c.GetString("userId")
+
+	res, err := h.UserService.ConfirmTwoFactor(c.Request.Context(), &req)
+	if err != nil {
+		c.JSON(loginErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// DisableTwoFactor turns two-factor authentication off. It takes a current code
+func (h *UserHandler) DisableTwoFactor(c *gin.Context) {
+	var req interfaces.TwoFactorCodeReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.UserID = c.GetString("userId")
+
+	if err := h.UserService.DisableTwoFactor(c.Request.Context(), &req); err != nil {
+		c.JSON(loginErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "two-factor authentication disabled"})
+}
+
 func (h *UserHandler) Logout(c *gin.Context) {
 	c.SetCookie("jwt", "", -1, "", "", false, true)
 	c.JSON(http.StatusOK, gin.H{"message": "logout successful"})
@@ -80,3 +167,173 @@ func (h *UserHandler) GetAllUsers(c *gin.Context) {
 
 	c.JSON(http.StatusOK, users)
 }
+
+// GetLoginHistory lists the recent logins and failed login attempts of the caller's account
+func (h *UserHandler) GetLoginHistory(c *gin.Context) {
+	limit := 0
+	if s := c.Query("limit"); s != "" {
+		var err error
+		if limit, err = strconv.Atoi(s); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+	}
+
+	history, err := h.UserService.GetLoginHistory(c.Request.Context(), c.GetString("userId"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, history)
+}
+
+// UnlockUser lifts the login lockout of an account. Only server admins can do it
+func (h *UserHandler) UnlockUser(c *gin.Context) {
+	if err := h.UserService.UnlockUser(c.Request.Context(), c.GetString("userId"), c.Param("username")); err != nil {
+		c.JSON(loginErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "user unlocked"})
+}
+
+// ChangePassword changes the caller's password. The access tokens of all sessions are
+// revoked and the caller gets a new one
+func (h *UserHandler) ChangePassword(c *gin.Context) {
+	var req interfaces.ChangePasswordReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.UserID = c.GetString("userId")
+
+	u, err := h.UserService.ChangePassword(c.Request.Context(), &req)
+	if err != nil {
+		c.JSON(loginErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.SetCookie("jwt", u.AccessToken, 60*60*24, "/", "localhost", false, true)
+	c.JSON(http.StatusOK, u)
+}
+
+// CreatePasswordReset issues a one-time password reset token for an account. Only server
+// admins can do it
+func (h *UserHandler) CreatePasswordReset(c *gin.Context) {
+	res, err := h.UserService.CreatePasswordReset(c.Request.Context(), c.GetString("userId"), c.Param("username"))
+	if err != nil {
+		c.JSON(loginErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// ResetPassword sets a new password with a reset token issued by a server admin
+func (h *UserHandler) ResetPassword(c *gin.Context) {
+	var req interfaces.ResetPasswordReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.UserService.ResetPassword(c.Request.Context(), &req); err != nil {
+		c.JSON(loginErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "password reset, log in with the new password"})
+}
+
+// GetProfile returns the profile of a user. Requires authentication
+func (h *UserHandler) GetProfile(c *gin.Context) {
+	res, err := h.UserService.GetProfile(c.Request.Context(), c.Param("username"))
+	if err != nil {
+		c.JSON(loginErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// UpdateProfile changes the fields of the caller's profile that are set in the request
+func (h *UserHandler) UpdateProfile(c *gin.Context) {
+	var req interfaces.UpdateProfileReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.UserID = c.GetString("userId")
+
+	res, err := h.UserService.UpdateProfile(c.Request.Context(), &req)
+	if err != nil {
+		c.JSON(loginErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// loginError responds with a failed login, telling locked out clients when to retry
+func loginError(c *gin.Context, err error) {
+	var locked *interfaces.LockedError
+	if errors.As(err, &locked) {
+		c.Header("Retry-After", strconv.Itoa(retrySeconds(time.Until(locked.Until))))
+	}
+	c.JSON(loginErrorStatus(err), gin.H{"error": err.Error()})
+}
+
+func loginErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, interfaces.ErrInvalidCredentials),
+		errors.Is(err, interfaces.ErrInvalidTwoFactorCode),
+		errors.Is(err, interfaces.ErrLoginExpired):
+		return http.StatusUnauthorized
+	case errors.Is(err, interfaces.ErrTwoFactorEnabled),
+		errors.Is(err, interfaces.ErrTwoFactorNotEnrolled),
+		errors.Is(err, interfaces.ErrUsernameTaken):
+		return http.StatusConflict
+	case errors.Is(err, interfaces.ErrAdminTwoFactorRequired),
+		errors.Is(err, interfaces.ErrWrongPassword):
+		return http.StatusForbidden
+	case errors.Is(err, interfaces.ErrWeakPassword),
+		errors.Is(err, interfaces.ErrInvalidResetToken),
+		errors.Is(err, interfaces.ErrInvalidUsername),
+		errors.Is(err, interfaces.ErrInvalidProfile):
+		return http.StatusBadRequest
+	case errors.Is(err, interfaces.ErrAccountLocked):
+		return http.StatusTooManyRequests
+	case errors.Is(err, interfaces.ErrNotServerAdmin):
+		return http.StatusForbidden
+	case errors.Is(err, interfaces.ErrUserNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// Authenticate is a middleware that requires a valid access token, either in the
+// Authorization: Bearer header or in the jwt cookie set on login. The authenticated
+// user ID is stored in the context under "userId"
+func (h *UserHandler) Authenticate(c *gin.Context) {
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if token == "" {
+		token, _ = c.Cookie("jwt")
+	}
+	if token == "" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "access token is required"})
+		return
+	}
+
+	user, err := h.UserService.ValidateToken(c.Request.Context(), token)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid access token"})
+		return
+	}
+
+	c.Set("userId", user.ID)
+	c.Set("username", user.Username)
+	c.Set("bot", user.Bot)
+	c.Next()
+}
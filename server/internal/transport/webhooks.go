@@ -0,0 +1,62 @@
+package transport
+
+import (
+	"chatgo/server/internal/interfaces"
+	"context"
+	"log"
+	"time"
+)
+
+const (
+	// webhookQueueSize is how many room events may wait to be queued for delivery. When the queue
+	// is full, events are dropped rather than slowing down the hub
+	webhookQueueSize = 1024
+	// webhookDeliveryInterval is how often due webhook deliveries are sent
+	webhookDeliveryInterval = time.Second
+)
+
+// publishWebhook queues a room event for the webhooks subscribed to it. It never blocks
+func (h *Hub) publishWebhook(e *RoomEvent) {
+	req := &interfaces.WebhookEventReq{Event: e.Type, RoomID: e.RoomID, Data: e.data()}
+	if e.Message != nil {
+		req.MessageID = e.Message.ID
+	}
+
+	select {
+	case h.webhooks <- req:
+	default:
+		log.Printf("Webhook queue is full, dropping %s event of room %s", e.Type, e.RoomID)
+	}
+}
+
+// dispatchWebhooks stores queued events as deliveries, so that they survive restarts
+func (h *Hub) dispatchWebhooks() {
+	for e := range h.webhooks {
+		if err := h.service.PublishWebhookEvent(context.Background(), e); err != nil {
+			log.Printf("Failed to queue %s webhooks of room %s: %v", e.Event, e.RoomID, err)
+		}
+	}
+}
+
+// deliverWebhooks periodically sends due webhook deliveries and retries failed ones
+func (h *Hub) deliverWebhooks() {
+	ticker := time.NewTicker(webhookDeliveryInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		res, err := h.service.DeliverWebhooks(context.Background())
+		if err != nil {
+			log.Printf("Failed to deliver webhooks: %v", err)
+			continue
+		}
+		if res.Delivered+res.Retried+res.Dead > 0 {
+			log.Printf("Webhooks: %d delivered, %d to retry, %d dead", res.Delivered, res.Retried, res.Dead)
+		}
+	}
+}
+
+// memberEvent builds a member.joined or member.left event. They are published when the
+// membership changes, not when members connect or disconnect
+func memberEvent(event, roomID, userID, username string) *RoomEvent {
+	return &RoomEvent{Type: event, RoomID: roomID, UserID: userID, Username: username}
+}
@@ -1,11 +1,17 @@
 package transport
 
 import (
+	"chatgo/server/internal/export"
 	"chatgo/server/internal/interfaces"
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"log"
+	"mime"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
@@ -22,12 +28,15 @@ var upgrader = websocket.Upgrader{
 type WSHandler struct {
 	hub     *Hub
 	service interfaces.Service
+
+	maxUploadSize int64
 }
 
-func NewWSHandler(h *Hub, service interfaces.Service) *WSHandler {
+func NewWSHandler(h *Hub, service interfaces.Service, maxUploadSize int64) *WSHandler {
 	return &WSHandler{
-		hub:     h,
-		service: service,
+		hub:           h,
+		service:       service,
+		maxUploadSize: maxUploadSize,
 	}
 }
 
@@ -98,8 +107,15 @@ func (h *WSHandler) ensureDefaultRoom(ctx context.Context, userID string) (strin
 	return defaultRoom.ID, nil
 }
 
+// JoinRoom connects the client to the room. Requires authentication: the client is
+// identified by its access token, so that room roles can't be claimed with someone else's ID
 func (h *WSHandler) JoinRoom(c *gin.Context) {
 	log.Printf("New WebSocket connection request")
+	// Bots post through their API tokens and don't hold room connections
+	if c.GetBool("bot") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "bots cannot join rooms over WebSocket"})
+		return
+	}
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		log.Printf("Failed to upgrade connection: %v", err)
@@ -109,15 +125,8 @@ func (h *WSHandler) JoinRoom(c *gin.Context) {
 	defer conn.Close()
 
 	roomID := c.Param("roomId")
-	clientID := c.Query("userId")
-	username := c.Query("username")
-
-	if clientID == "" {
-		log.Printf("User ID is required")
-		conn.WriteJSON(gin.H{"error": "User ID is required"})
-		conn.Close()
-		return
-	}
+	clientID := c.GetString("userId")
+	username := c.GetString("username")
 
 	log.Printf("Client %s (username: %s) attempting to join room %s", clientID, username, roomID)
 
@@ -187,6 +196,7 @@ func (h *WSHandler) JoinRoom(c *gin.Context) {
 			conn.Close()
 			return
 		}
+		h.hub.publishEvent(memberEvent(interfaces.WebhookEventMemberJoined, strconv.FormatInt(roomIDInt, 10), clientID, username))
 	}
 
 	// Create room in hub if it doesn't exist
@@ -205,8 +215,12 @@ func (h *WSHandler) JoinRoom(c *gin.Context) {
 		ID:       clientID,
 		RoomID:   roomID,
 		Username: username,
+		ip:       c.ClientIP(),
 	}
 
+	// The welcome is queued before registering, so it arrives ahead of any room traffic
+	cl.Message <- h.welcome(c.Request.Context(), room)
+
 	log.Printf("Registering client %s in room %s", clientID, roomID)
 	h.hub.Register <- cl
 
@@ -233,6 +247,24 @@ func (h *WSHandler) JoinRoom(c *gin.Context) {
 	cl.readMessage(h.hub)
 }
 
+// welcome builds the welcome event for a client joining the room
+func (h *WSHandler) welcome(ctx context.Context, room *interfaces.CreateChatRoomRes) *Message {
+	m := &Message{
+		Type:    MessageTypeWelcome,
+		Content: fmt.Sprintf("Welcome to %s", room.Name),
+		RoomID:  room.ID,
+		Topic:   room.Topic,
+	}
+
+	pins, err := h.service.GetPinnedMessages(ctx, room.ID)
+	if err != nil {
+		log.Printf("Failed to get pinned messages of room %s: %v", room.ID, err)
+		return m
+	}
+	m.Pins = pins
+	return m
+}
+
 func (h *WSHandler) GetAllRooms(c *gin.Context) {
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
@@ -249,8 +281,10 @@ func (h *WSHandler) GetAllRooms(c *gin.Context) {
 	roomRes := make([]RoomRes, 0)
 	for _, r := range rooms {
 		roomRes = append(roomRes, RoomRes{
-			ID:   r.ID,
-			Name: r.Name,
+			ID:         r.ID,
+			Name:       r.Name,
+			E2E:        r.E2E,
+			MessageTTL: r.MessageTTL,
 		})
 	}
 
@@ -279,11 +313,31 @@ func (h *WSHandler) GetRoomClients(c *gin.Context) {
 	}
 
 	clients := make([]ClientRes, 0)
+	ids := make([]string, 0)
 	for _, c := range h.hub.Rooms[roomId].Clients {
 		clients = append(clients, ClientRes{
 			ID:       c.ID,
 			Username: c.Username,
 		})
+		ids = append(ids, c.ID)
+	}
+
+	// Profiles are looked up on each request, so that changes show up without rejoining. The
+	// stored username replaces the one the client joined with
+	users, err := h.service.GetUsersByIDs(c.Request.Context(), ids)
+	if err != nil {
+		log.Printf("Failed to get profiles of room members: %v", err)
+	}
+	profiles := make(map[string]*interfaces.GetUserRes, len(users))
+	for _, u := range users {
+		profiles[u.ID] = u
+	}
+	for i := range clients {
+		if u, ok := profiles[clients[i].ID]; ok {
+			clients[i].Username = u.Username
+			clients[i].DisplayName = u.DisplayName
+			clients[i].StatusText = u.StatusText
+		}
 	}
 
 	conn.WriteJSON(clients)
@@ -340,6 +394,8 @@ func (h *WSHandler) GetChatRoomsByUserID(c *gin.Context) {
 	conn.WriteJSON(res)
 }
 
+// UpdateChatRoom renames the room or changes its topic. Requires authentication, so that
+// only room admins can change the topic
 func (h *WSHandler) UpdateChatRoom(c *gin.Context) {
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
@@ -353,6 +409,7 @@ func (h *WSHandler) UpdateChatRoom(c *gin.Context) {
 		conn.WriteJSON(gin.H{"error": err.Error()})
 		return
 	}
+	req.UserID = c.GetString("userId")
 
 	res, err := h.service.UpdateChatRoom(c.Request.Context(), &req)
 	if err != nil {
@@ -360,6 +417,19 @@ func (h *WSHandler) UpdateChatRoom(c *gin.Context) {
 		return
 	}
 
+	if req.Name != "" {
+		h.hub.publishEvent(&RoomEvent{Type: interfaces.WebhookEventRoomRenamed, RoomID: res.ID, Name: res.Name})
+	}
+	if req.Topic != nil {
+		h.hub.Events <- &Message{
+			Type:     MessageTypeTopic,
+			Content:  res.Topic,
+			RoomID:   res.ID,
+			Username: c.GetString("username"),
+			Topic:    res.Topic,
+		}
+	}
+
 	conn.WriteJSON(res)
 }
 
@@ -381,3 +451,771 @@ func (h *WSHandler) DeleteChatRoom(c *gin.Context) {
 	delete(h.hub.Rooms, roomID)
 	conn.WriteJSON(gin.H{"message": "Chat room deleted successfully"})
 }
+
+// SearchMessages searches the messages of the user's rooms. Requires authentication
+func (h *WSHandler) SearchMessages(c *gin.Context) {
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	limit := 0
+	if l := c.Query("limit"); l != "" {
+		limit, err = strconv.Atoi(l)
+		if err != nil {
+			conn.WriteJSON(gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	res, err := h.service.SearchMessages(c.Request.Context(), &interfaces.SearchMessagesReq{
+		UserID: c.GetString("userId"),
+		Query:  c.Query("q"),
+		Limit:  limit,
+	})
+	if err != nil {
+		conn.WriteJSON(gin.H{"error": err.Error()})
+		return
+	}
+
+	conn.WriteJSON(res)
+}
+
+func (h *WSHandler) GetThreadMessages(c *gin.Context) {
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	messageID := c.Param("messageId")
+	limit, err := strconv.Atoi(c.Param("limit"))
+	if err != nil {
+		conn.WriteJSON(gin.H{"error": err.Error()})
+		return
+	}
+
+	root, err := h.service.GetMessageByID(c.Request.Context(), messageID)
+	if err != nil {
+		conn.WriteJSON(gin.H{"error": "Message not found"})
+		return
+	}
+
+	// Replies to a reply live in the root message's thread
+	if root.ParentID != "" {
+		root, err = h.service.GetMessageByID(c.Request.Context(), root.ParentID)
+		if err != nil {
+			conn.WriteJSON(gin.H{"error": "Message not found"})
+			return
+		}
+	}
+
+	replies, err := h.service.GetThreadMessages(c.Request.Context(), root.ID, limit)
+	if err != nil {
+		conn.WriteJSON(gin.H{"error": err.Error()})
+		return
+	}
+
+	conn.WriteJSON(ThreadRes{
+		Root:    root,
+		Replies: replies,
+	})
+}
+
+// GetMentions returns the user's mention inbox. Requires authentication
+func (h *WSHandler) GetMentions(c *gin.Context) {
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	limit := 0
+	if l := c.Query("limit"); l != "" {
+		limit, err = strconv.Atoi(l)
+		if err != nil {
+			conn.WriteJSON(gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	res, err := h.service.GetMentions(c.Request.Context(), &interfaces.GetMentionsReq{
+		UserID:     c.GetString("userId"),
+		UnreadOnly: c.Query("unread") == "true",
+		Limit:      limit,
+	})
+	if err != nil {
+		conn.WriteJSON(gin.H{"error": err.Error()})
+		return
+	}
+
+	conn.WriteJSON(res)
+}
+
+// MarkMentionsRead marks the user's mentions as read. Requires authentication
+func (h *WSHandler) MarkMentionsRead(c *gin.Context) {
+	var req interfaces.MarkMentionsReadReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	req.UserID = c.GetString("userId")
+
+	if err := h.service.MarkMentionsRead(c.Request.Context(), &req); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Mentions marked as read"})
+}
+
+// GetMyRooms returns the user's rooms with unread counts. Requires authentication
+func (h *WSHandler) GetMyRooms(c *gin.Context) {
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	res, err := h.service.GetMyRooms(c.Request.Context(), c.GetString("userId"))
+	if err != nil {
+		conn.WriteJSON(gin.H{"error": err.Error()})
+		return
+	}
+
+	conn.WriteJSON(res)
+}
+
+// GetSeenBy returns who has read the message. Requires authentication, and only members of
+// the message's room may see it
+func (h *WSHandler) GetSeenBy(c *gin.Context) {
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	res, err := h.service.GetSeenBy(c.Request.Context(), c.GetString("userId"), c.Param("messageId"))
+	if err != nil {
+		conn.WriteJSON(gin.H{"error": err.Error()})
+		return
+	}
+
+	conn.WriteJSON(res)
+}
+
+// UploadAttachment stores a file sent as the "file" field of a multipart form.
+// Requires authentication
+func (h *WSHandler) UploadAttachment(c *gin.Context) {
+	// Leave some room for the multipart envelope around the file
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.maxUploadSize+1<<20)
+
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": interfaces.ErrAttachmentTooLarge.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, h.maxUploadSize+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.GetString("userId")
+	roomID := c.Param("roomId")
+	if roomID == "default" {
+		roomID, err = h.ensureDefaultRoom(c.Request.Context(), userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to ensure default room"})
+			return
+		}
+	}
+
+	res, err := h.service.UploadAttachment(c.Request.Context(), &interfaces.UploadAttachmentReq{
+		UserID:   userID,
+		RoomID:   roomID,
+		Filename: header.Filename,
+		Data:     data,
+	})
+	if err != nil {
+		c.JSON(attachmentErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// PublishPublicKey stores the caller's long-term public key for end-to-end encrypted rooms.
+// Requires authentication, so that nobody can replace another user's key
+func (h *WSHandler) PublishPublicKey(c *gin.Context) {
+	var req interfaces.PublishPublicKeyReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.UserID = c.GetString("userId")
+
+	if err := h.service.PublishPublicKey(c.Request.Context(), &req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Public key published"})
+}
+
+// GetRoomPublicKeys sends the public keys of the room members along with the room's E2E flag
+func (h *WSHandler) GetRoomPublicKeys(c *gin.Context) {
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	userID := c.Query("userId")
+	if userID == "" {
+		conn.WriteJSON(gin.H{"error": "User ID is required"})
+		return
+	}
+
+	roomID := c.Param("roomId")
+	if roomID == "default" {
+		roomID, err = h.ensureDefaultRoom(c.Request.Context(), userID)
+		if err != nil {
+			conn.WriteJSON(gin.H{"error": "Failed to ensure default room"})
+			return
+		}
+	}
+
+	res, err := h.service.GetRoomPublicKeys(c.Request.Context(), userID, roomID)
+	if err != nil {
+		conn.WriteJSON(gin.H{"error": err.Error()})
+		return
+	}
+
+	conn.WriteJSON(res)
+}
+
+// DownloadAttachment sends a decrypted file to a member of its room. Requires authentication
+func (h *WSHandler) DownloadAttachment(c *gin.Context) {
+	res, err := h.service.DownloadAttachment(c.Request.Context(), c.GetString("userId"), c.Param("attachmentId"))
+	if err != nil {
+		c.JSON(attachmentErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": res.Filename}))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Length", fmt.Sprint(len(res.Data)))
+	c.Data(http.StatusOK, res.ContentType, res.Data)
+}
+
+// ExportMessages streams the history of a room to a room admin as a file download. Requires authentication.
+// Query parameters: format (jsonl, csv, html or text), from and to (YYYY-MM-DD or RFC3339)
+func (h *WSHandler) ExportMessages(c *gin.Context) {
+	format, err := export.ParseFormat(c.Query("format"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	from, err := export.ParseTime(c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	to, err := export.ParseTime(c.Query("to"))
+	if err == nil && !to.IsZero() && !to.After(from) {
+		err = errors.New("to must be after from")
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	roomID := c.Param("roomId")
+	w := &exportResponse{c: c, format: format, filename: fmt.Sprintf("room-%s.%s", roomID, format.Extension())}
+	err = h.service.ExportMessages(c.Request.Context(), &interfaces.ExportMessagesReq{
+		UserID: c.GetString("userId"),
+		RoomID: roomID,
+		Format: string(format),
+		From:   from,
+		To:     to,
+	}, w)
+	if err != nil {
+		if w.started {
+			// The status is already sent, the client sees a truncated file
+			log.Printf("Export of room %s failed: %v", roomID, err)
+			return
+		}
+		c.JSON(exportErrorStatus(err), gin.H{"error": err.Error()})
+	}
+}
+
+// exportResponse sends the download headers right before the first byte of the export,
+// so errors found before that still get a JSON error response
+type exportResponse struct {
+	c        *gin.Context
+	format   export.Format
+	filename string
+	started  bool
+}
+
+func (w *exportResponse) Write(p []byte) (int, error) {
+	if !w.started {
+		w.started = true
+		w.c.Header("Content-Type", w.format.ContentType())
+		w.c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": w.filename}))
+		w.c.Header("X-Content-Type-Options", "nosniff")
+		w.c.Status(http.StatusOK)
+	}
+	return w.c.Writer.Write(p)
+}
+
+func exportErrorStatus(err error) int {
+	if errors.Is(err, export.ErrUnknownFormat) {
+		return http.StatusBadRequest
+	}
+	return roomErrorStatus(err)
+}
+
+// GetRetentionPolicy returns the effective retention policy of a room to a room admin. Requires authentication
+func (h *WSHandler) GetRetentionPolicy(c *gin.Context) {
+	res, err := h.service.GetRetentionPolicy(c.Request.Context(), c.GetString("userId"), c.Param("roomId"))
+	if err != nil {
+		c.JSON(roomErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// SetRoomMessageTTL turns disappearing messages on or off for a room. Only room admins may
+// change it. Requires authentication
+func (h *WSHandler) SetRoomMessageTTL(c *gin.Context) {
+	var req interfaces.SetMessageTTLReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.UserID = c.GetString("userId")
+	req.RoomID = c.Param("roomId")
+
+	res, err := h.service.SetRoomMessageTTL(c.Request.Context(), &req)
+	if err != nil {
+		c.JSON(expiryErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// ScheduleMessage schedules a message to the room for a later time. Requires authentication
+func (h *WSHandler) ScheduleMessage(c *gin.Context) {
+	var req interfaces.ScheduleMessageReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.UserID = c.GetString("userId")
+	req.RoomID = c.Param("roomId")
+
+	res, err := h.service.ScheduleMessage(c.Request.Context(), &req)
+	if err != nil {
+		c.JSON(scheduleErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// GetScheduledMessages lists the caller's scheduled messages that weren't sent yet, optionally
+// only those to the room given by the roomId query parameter. Requires authentication
+func (h *WSHandler) GetScheduledMessages(c *gin.Context) {
+	res, err := h.service.GetScheduledMessages(c.Request.Context(), c.GetString("userId"), c.Query("roomId"))
+	if err != nil {
+		c.JSON(scheduleErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// CancelScheduledMessage cancels one of the caller's scheduled messages. Requires authentication
+func (h *WSHandler) CancelScheduledMessage(c *gin.Context) {
+	if err := h.service.CancelScheduledMessage(c.Request.Context(), c.GetString("userId"), c.Param("id")); err != nil {
+		c.JSON(scheduleErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Scheduled message cancelled"})
+}
+
+// CreateWebhook subscribes a URL to events of the room. Only room admins may create webhooks.
+// The response contains the signing secret, it is not shown again. Requires authentication
+func (h *WSHandler) CreateWebhook(c *gin.Context) {
+	var req interfaces.CreateWebhookReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.UserID = c.GetString("userId")
+	req.RoomID = c.Param("roomId")
+
+	res, err := h.service.CreateWebhook(c.Request.Context(), &req)
+	if err != nil {
+		c.JSON(webhookErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// GetWebhooks lists the webhooks of the room. Requires authentication
+func (h *WSHandler) GetWebhooks(c *gin.Context) {
+	res, err := h.service.GetWebhooks(c.Request.Context(), c.GetString("userId"), c.Param("roomId"))
+	if err != nil {
+		c.JSON(webhookErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// DeleteWebhook deletes a webhook with its delivery history. Requires authentication
+func (h *WSHandler) DeleteWebhook(c *gin.Context) {
+	if err := h.service.DeleteWebhook(c.Request.Context(), c.GetString("userId"), c.Param("id")); err != nil {
+		c.JSON(webhookErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted"})
+}
+
+// GetWebhookDeliveries returns the latest deliveries of a webhook, newest first. The status query
+// parameter filters them, status=dead returns the dead-letter log. Requires authentication
+func (h *WSHandler) GetWebhookDeliveries(c *gin.Context) {
+	limit := 0
+	if s := c.Query("limit"); s != "" {
+		var err error
+		if limit, err = strconv.Atoi(s); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+	}
+
+	res, err := h.service.GetWebhookDeliveries(c.Request.Context(), c.GetString("userId"), c.Param("id"), c.Query("status"), limit)
+	if err != nil {
+		c.JSON(webhookErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// CreateBot creates a bot owned by the caller. Requires authentication
+func (h *WSHandler) CreateBot(c *gin.Context) {
+	var req interfaces.CreateBotReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.UserID = c.GetString("userId")
+
+	res, err := h.service.CreateBot(c.Request.Context(), &req)
+	if err != nil {
+		c.JSON(botErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// GetBots lists the caller's bots. Requires authentication
+func (h *WSHandler) GetBots(c *gin.Context) {
+	res, err := h.service.GetBots(c.Request.Context(), c.GetString("userId"))
+	if err != nil {
+		c.JSON(botErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// CreateBotToken creates an API token for one of the caller's bots, limited to rooms the caller
+// is an admin of. The token is only shown in this response. Requires authentication
+func (h *WSHandler) CreateBotToken(c *gin.Context) {
+	var req interfaces.CreateBotTokenReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.UserID = c.GetString("userId")
+	req.BotID = c.Param("botId")
+
+	res, err := h.service.CreateBotToken(c.Request.Context(), &req)
+	if err != nil {
+		c.JSON(botErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// GetBotTokens lists the API tokens and incoming webhooks of one of the caller's bots.
+// Requires authentication
+func (h *WSHandler) GetBotTokens(c *gin.Context) {
+	res, err := h.service.GetBotTokens(c.Request.Context(), c.GetString("userId"), c.Param("botId"))
+	if err != nil {
+		c.JSON(botErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// RevokeBotToken revokes an API token or an incoming webhook. Requires authentication
+func (h *WSHandler) RevokeBotToken(c *gin.Context) {
+	if err := h.service.RevokeBotToken(c.Request.Context(), c.GetString("userId"), c.Param("id")); err != nil {
+		c.JSON(botErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Token revoked"})
+}
+
+// CreateIncomingWebhook creates an incoming webhook that posts to the room as one of the caller's
+// bots. The webhook URL contains its token and is only shown in this response. Requires authentication
+func (h *WSHandler) CreateIncomingWebhook(c *gin.Context) {
+	var req interfaces.CreateIncomingWebhookReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.UserID = c.GetString("userId")
+	req.RoomID = c.Param("roomId")
+
+	res, err := h.service.CreateIncomingWebhook(c.Request.Context(), &req)
+	if err != nil {
+		c.JSON(botErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	res.URL = "/hooks/" + res.Token
+
+	c.JSON(http.StatusOK, res)
+}
+
+// PostBotMessage posts a message to the room as a bot. The bot API token is passed in the
+// Authorization: Bearer header
+func (h *WSHandler) PostBotMessage(c *gin.Context) {
+	var req interfaces.BotMessageReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Token = strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	req.RoomID = c.Param("roomId")
+
+	h.postBotMessage(c, &req)
+}
+
+// IncomingWebhook posts the text of a JSON payload such as {"text": "Build #42 passed"} to the room
+// of the incoming webhook with the token from the URL
+func (h *WSHandler) IncomingWebhook(c *gin.Context) {
+	var payload IncomingWebhookReq
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.postBotMessage(c, &interfaces.BotMessageReq{Token: c.Param("token"), Content: payload.Text})
+}
+
+// postBotMessage stores a bot message and broadcasts it to the room like any other message
+func (h *WSHandler) postBotMessage(c *gin.Context, req *interfaces.BotMessageReq) {
+	res, err := h.service.PostBotMessage(c.Request.Context(), req)
+	if err != nil {
+		c.JSON(botErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	h.hub.Broadcast <- &Message{
+		Type:     MessageTypeChat,
+		Content:  req.Content,
+		RoomID:   res.RoomID,
+		Username: res.Username,
+		ParentID: res.ParentID,
+		stored:   res,
+	}
+
+	// The stored content is encrypted at rest, the bot gets the message as it was sent
+	sent := *res
+	sent.Content = req.Content
+	c.JSON(http.StatusOK, &sent)
+}
+
+// CreatePoll posts a poll to the room and broadcasts it like any other message. Requires authentication
+func (h *WSHandler) CreatePoll(c *gin.Context) {
+	var req interfaces.CreatePollReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.UserID = c.GetString("userId")
+	req.RoomID = c.Param("roomId")
+
+	res, err := h.service.CreatePoll(c.Request.Context(), &req)
+	if err != nil {
+		c.JSON(pollErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	h.hub.Broadcast <- &Message{
+		Type:     MessageTypeChat,
+		Content:  res.Content,
+		RoomID:   res.RoomID,
+		Username: res.Username,
+		stored:   res,
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// GetPoll returns a poll with its results so far. Requires authentication
+func (h *WSHandler) GetPoll(c *gin.Context) {
+	res, err := h.service.GetPoll(c.Request.Context(), c.GetString("userId"), c.Param("id"))
+	if err != nil {
+		c.JSON(pollErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// VotePoll replaces the caller's vote in a poll and sends the new results to the room.
+// Requires authentication
+func (h *WSHandler) VotePoll(c *gin.Context) {
+	var req interfaces.PollVoteReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.UserID = c.GetString("userId")
+	req.PollID = c.Param("id")
+
+	res, err := h.service.VotePoll(c.Request.Context(), &req)
+	if err != nil {
+		c.JSON(pollErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	h.hub.Events <- pollUpdate(res)
+
+	c.JSON(http.StatusOK, res)
+}
+
+// ClosePoll closes a poll before its closing time and sends the final results to the room.
+// Only the creator of the poll and room admins can close it. Requires authentication
+func (h *WSHandler) ClosePoll(c *gin.Context) {
+	res, err := h.service.ClosePoll(c.Request.Context(), c.GetString("userId"), c.Param("id"))
+	if err != nil {
+		c.JSON(pollErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	h.hub.Events <- pollUpdate(res)
+
+	c.JSON(http.StatusOK, res)
+}
+
+func pollErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, interfaces.ErrInvalidPoll), errors.Is(err, interfaces.ErrInvalidVote), errors.Is(err, interfaces.ErrE2ERoom):
+		return http.StatusBadRequest
+	case errors.Is(err, interfaces.ErrNotPollCreator):
+		return http.StatusForbidden
+	case errors.Is(err, interfaces.ErrPollNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, interfaces.ErrPollClosed):
+		return http.StatusConflict
+	default:
+		return roomErrorStatus(err)
+	}
+}
+
+func botErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, interfaces.ErrInvalidBotToken):
+		return http.StatusUnauthorized
+	case errors.Is(err, interfaces.ErrNotBotOwner), errors.Is(err, interfaces.ErrRoomNotGranted):
+		return http.StatusForbidden
+	case errors.Is(err, interfaces.ErrBotNotFound), errors.Is(err, interfaces.ErrBotTokenNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, interfaces.ErrE2ERoom), errors.Is(err, interfaces.ErrInvalidUsername):
+		return http.StatusBadRequest
+	case errors.Is(err, interfaces.ErrUsernameTaken):
+		return http.StatusConflict
+	default:
+		return roomErrorStatus(err)
+	}
+}
+
+func webhookErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, interfaces.ErrInvalidWebhook), errors.Is(err, interfaces.ErrInvalidDelivery):
+		return http.StatusBadRequest
+	case errors.Is(err, interfaces.ErrWebhookNotFound):
+		return http.StatusNotFound
+	default:
+		return roomErrorStatus(err)
+	}
+}
+
+func scheduleErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, interfaces.ErrScheduledNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, interfaces.ErrInvalidSendTime):
+		return http.StatusBadRequest
+	default:
+		return roomErrorStatus(err)
+	}
+}
+
+func expiryErrorStatus(err error) int {
+	if errors.Is(err, interfaces.ErrInvalidTTL) {
+		return http.StatusBadRequest
+	}
+	return roomErrorStatus(err)
+}
+
+// roomErrorStatus maps the errors of the room membership and role checks. The status functions
+// of the room features fall back to it for the errors they don't handle themselves
+func roomErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, interfaces.ErrNotRoomMember), errors.Is(err, interfaces.ErrNotRoomAdmin):
+		return http.StatusForbidden
+	case errors.Is(err, interfaces.ErrRoomNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func attachmentErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, interfaces.ErrAttachmentNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, interfaces.ErrAttachmentTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, interfaces.ErrE2ERoom):
+		return http.StatusBadRequest
+	default:
+		return roomErrorStatus(err)
+	}
+}
@@ -0,0 +1,37 @@
+package transport
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"chatgo/server/internal/interfaces"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestErrorStatus checks that every room feature maps the room access errors the same way
+func TestErrorStatus(t *testing.T) {
+	features := map[string]func(error) int{
+		"attachment": attachmentErrorStatus,
+		"bot":        botErrorStatus,
+		"export":     exportErrorStatus,
+		"expiry":     expiryErrorStatus,
+		"poll":       pollErrorStatus,
+		"retention":  roomErrorStatus,
+		"schedule":   scheduleErrorStatus,
+		"webhook":    webhookErrorStatus,
+	}
+	room := map[error]int{
+		interfaces.ErrNotRoomMember: http.StatusForbidden,
+		interfaces.ErrNotRoomAdmin:  http.StatusForbidden,
+		interfaces.ErrRoomNotFound:  http.StatusNotFound,
+		fmt.Errorf("db is down"):    http.StatusInternalServerError,
+	}
+
+	for name, status := range features {
+		for err, want := range room {
+			assert.Equal(t, want, status(fmt.Errorf("wrapped: %w", err)), "%s: %v", name, err)
+		}
+	}
+}
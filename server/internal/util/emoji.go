@@ -0,0 +1,71 @@
+package util
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxEmojiLength is the longest emoji sequence accepted, in bytes. Flags and
+// skin tone or ZWJ sequences take several code points.
+const maxEmojiLength = 64
+
+var shortcodes = map[string]string{
+	"+1":               "👍",
+	"thumbsup":         "👍",
+	"-1":               "👎",
+	"thumbsdown":       "👎",
+	"heart":            "❤️",
+	"joy":              "😂",
+	"laughing":         "😆",
+	"smile":            "😄",
+	"slightly_smiling": "🙂",
+	"wink":             "😉",
+	"thinking":         "🤔",
+	"cry":              "😢",
+	"open_mouth":       "😮",
+	"angry":            "😠",
+	"tada":             "🎉",
+	"fire":             "🔥",
+	"eyes":             "👀",
+	"rocket":           "🚀",
+	"clap":             "👏",
+	"pray":             "🙏",
+	"ok_hand":          "👌",
+	"100":              "💯",
+	"white_check_mark": "✅",
+	"x":                "❌",
+	"warning":          "⚠️",
+	"bug":              "🐛",
+	"coffee":           "☕",
+}
+
+// NormalizeEmoji converts a :shortcode: to its emoji and validates that the
+// result is a single emoji rather than arbitrary text
+func NormalizeEmoji(value string) (string, error) {
+	value = strings.TrimSpace(value)
+
+	if len(value) > 2 && strings.HasPrefix(value, ":") && strings.HasSuffix(value, ":") {
+		emoji, ok := shortcodes[strings.ToLower(strings.Trim(value, ":"))]
+		if !ok {
+			return "", errors.New("unknown emoji shortcode: " + value)
+		}
+		return emoji, nil
+	}
+
+	if value == "" || len(value) > maxEmojiLength || !utf8.ValidString(value) {
+		return "", errors.New("invalid emoji")
+	}
+
+	for _, r := range value {
+		if r < 0x80 && !unicode.IsDigit(r) && r != '#' && r != '*' {
+			return "", errors.New("invalid emoji: " + value)
+		}
+		if unicode.IsLetter(r) || unicode.IsSpace(r) {
+			return "", errors.New("invalid emoji: " + value)
+		}
+	}
+
+	return value, nil
+}
@@ -0,0 +1,38 @@
+package util
+
+import (
+	"testing"
+)
+
+func TestNormalizeEmoji(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		wantErr  bool
+	}{
+		{":thumbsup:", "👍", false},
+		{":TADA:", "🎉", false},
+		{"🚀", "🚀", false},
+		{"👍🏽", "👍🏽", false},
+		{":no_such_code:", "", true},
+		{"hello", "", true},
+		{"", "", true},
+		{"привет", "", true},
+	}
+
+	for _, tt := range tests {
+		result, err := NormalizeEmoji(tt.input)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("NormalizeEmoji(%q) expected error, got %q", tt.input, result)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("NormalizeEmoji(%q) unexpected error: %v", tt.input, err)
+		}
+		if result != tt.expected {
+			t.Errorf("NormalizeEmoji(%q) = %q, want %q", tt.input, result, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package util
+
+import (
+	"regexp"
+	"strings"
+)
+
+// RoomMention is the special @room mention that notifies every room member
+const RoomMention = "room"
+
+var mentionPattern = regexp.MustCompile(`(^|[^\w@])@([\w.-]+)`)
+
+// ParseMentions returns the unique names mentioned as @name in the content,
+// in order of appearance
+func ParseMentions(content string) []string {
+	var mentions []string
+	seen := make(map[string]struct{})
+
+	for _, match := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		name := strings.TrimRight(match[2], ".-")
+		if name == "" {
+			continue
+		}
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		seen[name] = struct{}{}
+		mentions = append(mentions, name)
+	}
+
+	return mentions
+}
@@ -0,0 +1,26 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMentions(t *testing.T) {
+	tests := []struct {
+		content  string
+		expected []string
+	}{
+		{"hello @alice and @bob.", []string{"alice", "bob"}},
+		{"@room deploy is done, @alice @alice", []string{"room", "alice"}},
+		{"mail me at alice@example.com", nil},
+		{"(@carol_1) ping", []string{"carol_1"}},
+		{"no mentions here", nil},
+	}
+
+	for _, tt := range tests {
+		result := ParseMentions(tt.content)
+		if !reflect.DeepEqual(result, tt.expected) {
+			t.Errorf("ParseMentions(%q) = %v, want %v", tt.content, result, tt.expected)
+		}
+	}
+}
@@ -7,83 +7,85 @@ import (
 	"encoding/base64"
 	"errors"
 	"io"
-
-	"log"
 )
 
-// EncryptMessage encrypts a string using AES-256 encryption
+// EncryptMessage encrypts a string using AES-256-GCM. A key of the wrong length is an error,
+// the message is never returned as plaintext
 func EncryptMessage(message string, key []byte) (string, error) {
-	if len(key) != 32 {
-		log.Print("Key is not 32 bytes long")
-		return message, nil
-	}
-	plaintext := []byte(message)
-
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return "", err
-	}
-
-	// Create a new GCM cipher
-	aesGCM, err := cipher.NewGCM(block)
+	ciphertext, err := EncryptBytes([]byte(message), key)
 	if err != nil {
 		return "", err
 	}
 
-	// Create a nonce
-	nonce := make([]byte, aesGCM.NonceSize())
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		return "", err
-	}
-
-	// Encrypt the data
-	ciphertext := aesGCM.Seal(nonce, nonce, plaintext, nil)
-
 	// Convert to base64 for easy transmission
 	return base64.StdEncoding.EncodeToString(ciphertext), nil
 }
 
-// DecryptMessage decrypts an encrypted string using AES-256 decryption
+// DecryptMessage decrypts an encrypted string using AES-256-GCM
 func DecryptMessage(encryptedMessage string, key []byte) (string, error) {
-	if len(key) != 32 {
-		log.Print("Key is not 32 bytes long")
-		return encryptedMessage, nil
-	}
 	ciphertext, err := base64.StdEncoding.DecodeString(encryptedMessage)
 	if err != nil {
 		return "", err
 	}
 
-	block, err := aes.NewCipher(key)
+	plaintext, err := DecryptBytes(ciphertext, key)
 	if err != nil {
 		return "", err
 	}
 
-	aesGCM, err := cipher.NewGCM(block)
+	return string(plaintext), nil
+}
+
+// GenerateKey generates a random 32-byte key for AES-256
+func GenerateKey() ([]byte, error) {
+	key := make([]byte, 32) // AES-256 requires 32-byte key
+	_, err := rand.Read(key)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
+	return key, nil
+}
 
-	nonceSize := aesGCM.NonceSize()
-	if len(ciphertext) < nonceSize {
-		return "", errors.New("ciphertext too short")
+// EncryptBytes encrypts binary data using AES-256-GCM
+func EncryptBytes(data []byte, key []byte) ([]byte, error) {
+	aesGCM, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aesGCM.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
 	}
 
-	nonce, ciphertext := ciphertext[:nonceSize], ciphertext[nonceSize:]
-	plaintext, err := aesGCM.Open(nil, nonce, ciphertext, nil)
+	return aesGCM.Seal(nonce, nonce, data, nil), nil
+}
+
+// DecryptBytes decrypts data encrypted with EncryptBytes
+func DecryptBytes(data []byte, key []byte) ([]byte, error) {
+	aesGCM, err := newGCM(key)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return string(plaintext), nil
+	nonceSize := aesGCM.NonceSize()
+	if len(data) < nonceSize {
+		return nil, errors.New("ciphertext too short")
+	}
+
+	nonce, ciphertext := data[:nonceSize], data[nonceSize:]
+	return aesGCM.Open(nil, nonce, ciphertext, nil)
 }
 
-// GenerateKey generates a random 32-byte key for AES-256
-func GenerateKey() ([]byte, error) {
-	key := make([]byte, 32) // AES-256 requires 32-byte key
-	_, err := rand.Read(key)
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, errors.New("encryption key must be 32 bytes long")
+	}
+
+	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
 	}
-	return key, nil
+
+	return cipher.NewGCM(block)
 }
@@ -0,0 +1,61 @@
+package util
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncryptBytes(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	data := []byte("\x89PNG binary data")
+
+	encrypted, err := EncryptBytes(data, key)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if bytes.Contains(encrypted, data) {
+		t.Error("Encrypted data should not contain the plaintext")
+	}
+
+	decrypted, err := DecryptBytes(encrypted, key)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !bytes.Equal(decrypted, data) {
+		t.Errorf("Expected %q, got %q", data, decrypted)
+	}
+
+	if _, err := DecryptBytes(encrypted, bytes.Repeat([]byte{8}, 32)); err == nil {
+		t.Error("Expected error for wrong key, got nil")
+	}
+	if _, err := EncryptBytes(data, []byte("short")); err == nil {
+		t.Error("Expected error for short key, got nil")
+	}
+}
+
+func TestEncryptMessage(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+
+	encrypted, err := EncryptMessage("hello", key)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if encrypted == "hello" {
+		t.Error("Encrypted message should not be plaintext")
+	}
+
+	decrypted, err := DecryptMessage(encrypted, key)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if decrypted != "hello" {
+		t.Errorf("Expected %q, got %q", "hello", decrypted)
+	}
+
+	if _, err := EncryptMessage("hello", []byte("short")); err == nil {
+		t.Error("Expected error for short key, got nil")
+	}
+	if _, err := DecryptMessage(encrypted, nil); err == nil {
+		t.Error("Expected error for missing key, got nil")
+	}
+}
@@ -1,13 +1,20 @@
 package util
 
 import (
+	"bufio"
 	"fmt"
+	"os"
+	"strings"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
-func HashPassword(password string) (string, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+// HashPassword hashes a password with bcrypt at the given cost. Zero means bcrypt.DefaultCost
+func HashPassword(password string, cost int) (string, error) {
+	if cost == 0 {
+		cost = bcrypt.DefaultCost
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), cost)
 	if err != nil {
 		return "", fmt.Errorf("failed to hash password: %w", err)
 	}
@@ -15,6 +22,46 @@ func HashPassword(password string) (string, error) {
 	return string(hashedPassword), nil
 }
 
-func CheckPassword(password string, hashedPassword string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+// CheckPassword compares a password with its hash. When the password matches a hash made with
+// a lower cost than the given one, it also returns a new hash at that cost to store instead,
+// so that raising the cost upgrades hashes as users log in. Otherwise the new hash is empty
+func CheckPassword(password string, hashedPassword string, cost int) (string, error) {
+	if err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password)); err != nil {
+		return "", err
+	}
+
+	if cost == 0 {
+		cost = bcrypt.DefaultCost
+	}
+	current, err := bcrypt.Cost([]byte(hashedPassword))
+	if err != nil || current >= cost {
+		return "", nil
+	}
+	return HashPassword(password, cost)
+}
+
+// LoadPasswordList reads a list of passwords, one per line, such as a list of breached or
+// common passwords. Empty lines and lines starting with # are skipped. Passwords are
+// lowercased, so lookups should lowercase too
+func LoadPasswordList(path string) (map[string]struct{}, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	passwords := make(map[string]struct{})
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		passwords[strings.ToLower(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read password list %s: %w", path, err)
+	}
+
+	return passwords, nil
 }
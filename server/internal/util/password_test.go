@@ -1,13 +1,17 @@
 package util
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestPasswordHashing(t *testing.T) {
 	password := "password123"
 
-	hashedPassword, err := HashPassword(password)
+	hashedPassword, err := HashPassword(password, 0)
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
@@ -16,14 +20,75 @@ func TestPasswordHashing(t *testing.T) {
 		t.Error("Hashed password should not be the same as the original password")
 	}
 
-	err = CheckPassword(password, hashedPassword)
+	_, err = CheckPassword(password, hashedPassword, 0)
 	if err != nil {
 		t.Errorf("Expected no error for correct password, got %v", err)
 	}
 
 	wrongPassword := "wrong password"
-	err = CheckPassword(wrongPassword, hashedPassword)
+	_, err = CheckPassword(wrongPassword, hashedPassword, 0)
 	if err == nil {
 		t.Error("Expected error for incorrect password, got nil")
 	}
 }
+
+func TestCheckPassword_Rehash(t *testing.T) {
+	password := "password123"
+
+	hashedPassword, err := HashPassword(password, bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	rehashed, err := CheckPassword(password, hashedPassword, bcrypt.MinCost)
+	if err != nil || rehashed != "" {
+		t.Errorf("Expected no rehash at the same cost, got %q, %v", rehashed, err)
+	}
+
+	rehashed, err = CheckPassword(password, hashedPassword, bcrypt.MinCost+1)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if cost, _ := bcrypt.Cost([]byte(rehashed)); cost != bcrypt.MinCost+1 {
+		t.Errorf("Expected a rehash at cost %d, got cost %d", bcrypt.MinCost+1, cost)
+	}
+	if _, err := CheckPassword(password, rehashed, 0); err != nil {
+		t.Errorf("Expected the rehash to match the password, got %v", err)
+	}
+
+	// A lower cost doesn't downgrade the hash
+	rehashed, _ = CheckPassword(password, hashedPassword, bcrypt.MinCost-1)
+	if rehashed != "" {
+		t.Error("Expected no rehash at a lower cost")
+	}
+
+	// A wrong password is never rehashed
+	rehashed, err = CheckPassword("wrong password", hashedPassword, bcrypt.MinCost+1)
+	if err == nil || rehashed != "" {
+		t.Errorf("Expected an error and no rehash for a wrong password, got %q, %v", rehashed, err)
+	}
+}
+
+func TestLoadPasswordList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(path, []byte("# common passwords\n123456\n\n  Password1 \nqwerty\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	passwords, err := LoadPasswordList(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(passwords) != 3 {
+		t.Errorf("Expected 3 passwords, got %d", len(passwords))
+	}
+	for _, p := range []string{"123456", "password1", "qwerty"} {
+		if _, ok := passwords[p]; !ok {
+			t.Errorf("Expected %q in the list", p)
+		}
+	}
+
+	if _, err := LoadPasswordList(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
@@ -0,0 +1,202 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Headers sent with every delivery
+const (
+	EventHeader     = "X-ChatGO-Event"
+	DeliveryHeader  = "X-ChatGO-Delivery"
+	TimestampHeader = "X-ChatGO-Timestamp"
+	// SignatureHeader carries "sha256=" and the hex HMAC-SHA256 of the timestamp, a dot and the body,
+	// keyed with the webhook secret
+	SignatureHeader = "X-ChatGO-Signature"
+)
+
+const (
+	baseBackoff = 10 * time.Second
+	maxBackoff  = time.Hour
+	// maxDrainedBody limits how much of a response is read so the connection can be reused
+	maxDrainedBody = 512
+)
+
+// ErrBlockedAddress is returned for receivers on loopback, private, link-local and other
+// internal addresses, unless their network is allowed
+var ErrBlockedAddress = errors.New("webhook receivers on internal addresses are not allowed")
+
+// blockedPrefixes are internal networks not covered by the netip.Addr predicates
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),     // "this" network
+	netip.MustParsePrefix("100.64.0.0/10"), // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),  // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"), // benchmarking
+}
+
+// Sign returns the signature of a payload sent at the given Unix time
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is a valid signature of the payload. Receivers should also
+// reject timestamps that are too old to protect against replays
+func Verify(secret string, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// Backoff returns how long to wait before the next attempt after the given number of failed
+// attempts: 10s, 20s, 40s and so on, up to an hour
+func Backoff(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	d := baseBackoff
+	for i := 1; i < attempts; i++ {
+		d *= 2
+		if d >= maxBackoff {
+			return maxBackoff
+		}
+	}
+	return d
+}
+
+// Delivery is a signed JSON payload to POST to a webhook URL
+type Delivery struct {
+	ID     string
+	URL    string
+	Secret string
+	Event  string
+	Body   []byte
+}
+
+// ParseNetworks parses CIDR networks such as 10.1.2.0/24 for NewSender
+func ParseNetworks(cidrs []string) ([]netip.Prefix, error) {
+	networks := make([]netip.Prefix, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		network, err := netip.ParsePrefix(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, fmt.Errorf("webhook network %q: %w", cidr, err)
+		}
+		networks = append(networks, network.Masked())
+	}
+	return networks, nil
+}
+
+// Sender posts deliveries to webhook receivers
+type Sender struct {
+	client  *http.Client
+	allowed []netip.Prefix
+	now     func() time.Time
+}
+
+// NewSender returns a sender that refuses to connect to internal addresses, except for the allowed
+// networks. The address is checked when connecting, after the host name is resolved, so a receiver
+// can't reach internal services by pointing its DNS name at them
+func NewSender(timeout time.Duration, allowed []netip.Prefix) *Sender {
+	s := &Sender{allowed: allowed, now: time.Now}
+	dialer := &net.Dialer{Timeout: timeout, Control: s.checkDial}
+	s.client = &http.Client{
+		Timeout: timeout,
+		// No proxy: the dialer would check the address of the proxy instead of the receiver
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+		},
+		// A redirect could turn the POST into a GET to another host, receivers must answer directly
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return s
+}
+
+// CheckHost returns ErrBlockedAddress if host is an internal IP address or localhost. Names are
+// resolved only when connecting, this lets webhooks be rejected early when they are created
+func (s *Sender) CheckHost(host string) error {
+	if strings.EqualFold(strings.TrimSuffix(host, "."), "localhost") {
+		host = "127.0.0.1"
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return nil
+	}
+	return s.checkAddr(addr)
+}
+
+// checkDial is the net.Dialer control function, it runs with the resolved address before connecting
+func (s *Sender) checkDial(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, address)
+	}
+	return s.checkAddr(addrPort.Addr())
+}
+
+func (s *Sender) checkAddr(addr netip.Addr) error {
+	addr = addr.Unmap()
+	for _, network := range s.allowed {
+		if network.Contains(addr) {
+			return nil
+		}
+	}
+
+	blocked := addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast()
+	for _, network := range blockedPrefixes {
+		blocked = blocked || network.Contains(addr)
+	}
+	if blocked {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, addr)
+	}
+	return nil
+}
+
+// Send posts the delivery and returns the response status code. Any status other than 2xx is
+// returned as an error together with the code, the code is 0 when no response was received.
+// The response body is never returned, receivers could echo back anything
+func (s *Sender) Send(ctx context.Context, d *Delivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(d.Body))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := s.now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ChatGO-Webhook/1.0")
+	req.Header.Set(EventHeader, d.Event)
+	req.Header.Set(DeliveryHeader, d.ID)
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, Sign(d.Secret, timestamp, d.Body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	// Drain the body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrainedBody))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver responded with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,127 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// loopback lets the tests send to httptest servers
+var loopback = []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")}
+
+func TestSender_Send(t *testing.T) {
+	var received *http.Request
+	var body []byte
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	sender := NewSender(time.Second, loopback)
+	sender.now = func() time.Time { return time.Unix(1700000000, 0) }
+
+	code, err := sender.Send(context.Background(), &Delivery{
+		ID:     "7",
+		URL:    receiver.URL,
+		Secret: "s3cret",
+		Event:  "message.created",
+		Body:   []byte(`{"event":"message.created"}`),
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, code)
+	assert.Equal(t, http.MethodPost, received.Method)
+	assert.Equal(t, "application/json", received.Header.Get("Content-Type"))
+	assert.Equal(t, "message.created", received.Header.Get(EventHeader))
+	assert.Equal(t, "7", received.Header.Get(DeliveryHeader))
+	assert.Equal(t, "1700000000", received.Header.Get(TimestampHeader))
+	assert.Equal(t, `{"event":"message.created"}`, string(body))
+
+	timestamp, _ := strconv.ParseInt(received.Header.Get(TimestampHeader), 10, 64)
+	assert.True(t, Verify("s3cret", timestamp, body, received.Header.Get(SignatureHeader)))
+	assert.False(t, Verify("other", timestamp, body, received.Header.Get(SignatureHeader)))
+	assert.False(t, Verify("s3cret", timestamp+1, body, received.Header.Get(SignatureHeader)))
+}
+
+func TestSender_SendFailure(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "database is down", http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+
+	sender := NewSender(time.Second, loopback)
+	code, err := sender.Send(context.Background(), &Delivery{ID: "1", URL: receiver.URL, Body: []byte("{}")})
+
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	// Only the status is kept, the body could hold anything the receiver echoes back
+	assert.EqualError(t, err, "receiver responded with status 503")
+
+	// Redirects are not followed
+	redirect := httptest.NewServer(http.RedirectHandler(receiver.URL, http.StatusFound))
+	defer redirect.Close()
+
+	code, err = sender.Send(context.Background(), &Delivery{ID: "1", URL: redirect.URL, Body: []byte("{}")})
+	assert.Equal(t, http.StatusFound, code)
+	assert.Error(t, err)
+
+	// Slow receivers time out
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer slow.Close()
+
+	code, err = NewSender(50*time.Millisecond, loopback).Send(context.Background(), &Delivery{ID: "1", URL: slow.URL, Body: []byte("{}")})
+	assert.Equal(t, 0, code)
+	assert.Error(t, err)
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, 10*time.Second, Backoff(0))
+	assert.Equal(t, 10*time.Second, Backoff(1))
+	assert.Equal(t, 20*time.Second, Backoff(2))
+	assert.Equal(t, 80*time.Second, Backoff(4))
+	assert.Equal(t, time.Hour, Backoff(10))
+	assert.Equal(t, time.Hour, Backoff(100))
+}
+
+func TestSender_BlocksInternalAddresses(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer receiver.Close()
+
+	// The address is checked after resolving, so a name pointing at loopback is blocked too
+	sender := NewSender(time.Second, nil)
+	port := strconv.Itoa(receiver.Listener.Addr().(*net.TCPAddr).Port)
+	for _, url := range []string{receiver.URL, "http://localhost:" + port} {
+		code, err := sender.Send(context.Background(), &Delivery{ID: "1", URL: url, Body: []byte("{}")})
+		assert.Equal(t, 0, code)
+		assert.ErrorIs(t, err, ErrBlockedAddress)
+	}
+
+	for _, host := range []string{"127.0.0.1", "localhost", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254", "100.64.0.1", "0.0.0.0", "::1", "fe80::1", "fd00::1", "::ffff:127.0.0.1"} {
+		assert.ErrorIs(t, sender.CheckHost(host), ErrBlockedAddress, host)
+	}
+	for _, host := range []string{"93.184.216.34", "2606:4700::1111", "example.com"} {
+		assert.NoError(t, sender.CheckHost(host), host)
+	}
+
+	networks, err := ParseNetworks([]string{"10.1.2.0/24"})
+	assert.NoError(t, err)
+	allowed := NewSender(time.Second, networks)
+	assert.NoError(t, allowed.CheckHost("10.1.2.3"))
+	assert.ErrorIs(t, allowed.CheckHost("10.1.3.1"), ErrBlockedAddress)
+
+	_, err = ParseNetworks([]string{"10.1.2.0"})
+	assert.Error(t, err)
+}
@@ -2,7 +2,10 @@ package config
 
 import (
 	"chatgo/server/internal/db"
+	"chatgo/server/internal/plugins/greeter"
+	"chatgo/server/internal/ratelimit"
 	"chatgo/server/internal/services"
+	"chatgo/server/internal/storage"
 	"chatgo/server/router"
 	"fmt"
 	"log"
@@ -16,6 +19,15 @@ type Config struct {
 	Database db.Config       `yaml:"database"`
 	Server   router.Config   `yaml:"server"`
 	Service  services.Config `yaml:"service"`
+	Storage  storage.Config  `yaml:"storage"`
+	Plugins  PluginsConfig   `yaml:"plugins"`
+	// RateLimit overrides the default rate limits of routes and WebSocket messages
+	RateLimit ratelimit.Config `yaml:"rateLimit"`
+}
+
+// PluginsConfig configures the in-process bots
+type PluginsConfig struct {
+	Greeter greeter.Config `yaml:"greeter"`
 }
 
 // LoadConfig loads configuration from a YAML file
@@ -38,5 +50,16 @@ func LoadConfig(configPath string) (*Config, error) {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
 
+	// The master key is better kept out of the config file
+	if key := os.Getenv("CHATGO_MASTER_KEY"); key != "" {
+		config.Service.MasterKey = key
+	}
+	if token := os.Getenv("CHATGO_GREETER_TOKEN"); token != "" {
+		config.Plugins.Greeter.Token = token
+	}
+	if err := config.Service.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid service config: %w", err)
+	}
+
 	return config, nil
 }
@@ -9,10 +9,14 @@ import (
 var r *gin.Engine
 
 func InitRouter(
+	config *Config,
 	userHandler *transport.UserHandler,
 	wsHandler *transport.WSHandler,
-) {
-	r = gin.Default()
+) error {
+	var err error
+	if r, err = newEngine(config); err != nil {
+		return err
+	}
 
 	/*r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:3000"},
@@ -25,28 +29,109 @@ func InitRouter(
 		},
 		MaxAge: 12 * time.Hour,
 	}))*/
+	// Rate limits apply to the routes that have a rule, see ratelimit.Config
+	r.Use(userHandler.RateLimit)
+
 	// User routes
 	r.POST("/signup", userHandler.CreateUser)
 	r.POST("/login", userHandler.Login)
+	r.POST("/login/2fa", userHandler.LoginTwoFactor)
+	r.POST("/password/reset", userHandler.ResetPassword)
 	r.GET("/logout", userHandler.Logout)
 	r.GET("/users", userHandler.GetAllUsers)
+	r.GET("/users/me/logins", userHandler.Authenticate, userHandler.GetLoginHistory)
+	r.POST("/users/me/2fa", userHandler.Authenticate, userHandler.EnrollTwoFactor)
+	r.POST("/users/me/2fa/confirm", userHandler.Authenticate, userHandler.ConfirmTwoFactor)
+	r.DELETE("/users/me/2fa", userHandler.Authenticate, userHandler.DisableTwoFactor)
+	r.PUT("/users/me/password", userHandler.Authenticate, userHandler.ChangePassword)
+	r.PUT("/users/me/profile", userHandler.Authenticate, userHandler.UpdateProfile)
+	r.GET("/users/:username/profile", userHandler.Authenticate, userHandler.GetProfile)
+	r.POST("/admin/users/:username/unlock", userHandler.Authenticate, userHandler.UnlockUser)
+	r.POST("/admin/users/:username/password-reset", userHandler.Authenticate, userHandler.CreatePasswordReset)
 
 	// WebSocket routes
 	r.GET("/ws/getMessages/:roomId/:limit", wsHandler.GetMessagesByRoomID)
+	r.GET("/ws/getThread/:messageId/:limit", wsHandler.GetThreadMessages)
 	r.GET("/ws/getRooms", wsHandler.GetChatRoomsByUserID)
-	r.PUT("/ws/updateRoom", wsHandler.UpdateChatRoom)
+	r.PUT("/ws/updateRoom", userHandler.Authenticate, wsHandler.UpdateChatRoom)
 	r.DELETE("/ws/deleteRoom/:roomId", wsHandler.DeleteChatRoom)
 
 	r.POST("/ws/createRoom", wsHandler.CreateRoom)
-	r.GET("/ws/joinRoom/:roomId", wsHandler.JoinRoom)
+	r.GET("/ws/joinRoom/:roomId", userHandler.Authenticate, wsHandler.JoinRoom)
 	r.GET("/ws/getAllRooms", wsHandler.GetAllRooms)
 	r.GET("/ws/getRoomClients/:roomId", wsHandler.GetRoomClients)
+	r.GET("/ws/search", userHandler.Authenticate, wsHandler.SearchMessages)
+	r.GET("/ws/getMentions", userHandler.Authenticate, wsHandler.GetMentions)
+	r.POST("/ws/readMentions", userHandler.Authenticate, wsHandler.MarkMentionsRead)
+	r.GET("/ws/getMyRooms", userHandler.Authenticate, wsHandler.GetMyRooms)
+	r.GET("/ws/getSeenBy/:messageId", userHandler.Authenticate, wsHandler.GetSeenBy)
+	r.GET("/ws/getRoomKeys/:roomId", wsHandler.GetRoomPublicKeys)
+
+	// Attachment routes
+	r.POST("/attachments/:roomId", userHandler.Authenticate, wsHandler.UploadAttachment)
+	r.GET("/attachments/:attachmentId", userHandler.Authenticate, wsHandler.DownloadAttachment)
+
+	// Export routes
+	r.GET("/export/:roomId", userHandler.Authenticate, wsHandler.ExportMessages)
+
+	// Retention routes
+	r.GET("/retention/:roomId", userHandler.Authenticate, wsHandler.GetRetentionPolicy)
+
+	// Disappearing message routes
+	r.PUT("/rooms/:roomId/ttl", userHandler.Authenticate, wsHandler.SetRoomMessageTTL)
+
+	// Scheduled message routes
+	r.POST("/rooms/:roomId/scheduled", userHandler.Authenticate, wsHandler.ScheduleMessage)
+	r.GET("/scheduled", userHandler.Authenticate, wsHandler.GetScheduledMessages)
+	r.DELETE("/scheduled/:id", userHandler.Authenticate, wsHandler.CancelScheduledMessage)
+
+	// Webhook routes
+	r.POST("/rooms/:roomId/webhooks", userHandler.Authenticate, wsHandler.CreateWebhook)
+	r.GET("/rooms/:roomId/webhooks", userHandler.Authenticate, wsHandler.GetWebhooks)
+	r.DELETE("/webhooks/:id", userHandler.Authenticate, wsHandler.DeleteWebhook)
+	r.GET("/webhooks/:id/deliveries", userHandler.Authenticate, wsHandler.GetWebhookDeliveries)
+
+	// Poll routes
+	r.POST("/rooms/:roomId/polls", userHandler.Authenticate, wsHandler.CreatePoll)
+	r.GET("/polls/:id", userHandler.Authenticate, wsHandler.GetPoll)
+	r.POST("/polls/:id/votes", userHandler.Authenticate, wsHandler.VotePoll)
+	r.POST("/polls/:id/close", userHandler.Authenticate, wsHandler.ClosePoll)
+
+	// Bot routes
+	r.POST("/bots", userHandler.Authenticate, wsHandler.CreateBot)
+	r.GET("/bots", userHandler.Authenticate, wsHandler.GetBots)
+	r.POST("/bots/:botId/tokens", userHandler.Authenticate, wsHandler.CreateBotToken)
+	r.GET("/bots/:botId/tokens", userHandler.Authenticate, wsHandler.GetBotTokens)
+	r.DELETE("/bot-tokens/:id", userHandler.Authenticate, wsHandler.RevokeBotToken)
+	r.POST("/rooms/:roomId/incoming-webhooks", userHandler.Authenticate, wsHandler.CreateIncomingWebhook)
+
+	// Bot API routes, authenticated with bot tokens
+	r.POST("/bot/rooms/:roomId/messages", wsHandler.PostBotMessage)
+	r.POST("/hooks/:token", wsHandler.IncomingWebhook)
+
+	// End-to-end encryption routes
+	r.POST("/keys", userHandler.Authenticate, wsHandler.PublishPublicKey)
+	return nil
+}
+
+// newEngine creates the engine that takes the client address from X-Forwarded-For and
+// X-Real-IP only for requests coming from the trusted proxies
+func newEngine(config *Config) (*gin.Engine, error) {
+	engine := gin.Default()
+	if err := engine.SetTrustedProxies(config.TrustedProxies); err != nil {
+		return nil, err
+	}
+	return engine, nil
 }
 
 // Config holds server settings
 type Config struct {
 	Host string `yaml:"host"`
 	Port string `yaml:"port"`
+	// TrustedProxies are the addresses or CIDR networks of the reverse proxies in front of the
+	// server. Client addresses, used for rate limits and the login history, are taken from proxy
+	// headers only when the request comes from one of them. None are trusted by default
+	TrustedProxies []string `yaml:"trustedProxies"`
 }
 
 func (c *Config) GetAddr() string {
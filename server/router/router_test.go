@@ -0,0 +1,64 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"chatgo/server/internal/ratelimit"
+	"chatgo/server/internal/transport"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestNewEngine_RateLimitKey checks that a client can't get a fresh rate limit by sending
+// another X-Forwarded-For, unless the request comes from a trusted proxy
+func TestNewEngine_RateLimitKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	testCases := []struct {
+		name     string
+		config   *Config
+		expected []int
+	}{
+		{
+			name:     "No trusted proxies",
+			config:   &Config{},
+			expected: []int{http.StatusOK, http.StatusTooManyRequests},
+		},
+		{
+			// httptest requests come from 192.0.2.1, so each forwarded address gets its own limit
+			name:     "Trusted proxy",
+			config:   &Config{TrustedProxies: []string{"192.0.2.1"}},
+			expected: []int{http.StatusOK, http.StatusOK},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			engine, err := newEngine(tc.config)
+			assert.NoError(t, err)
+
+			limiter := ratelimit.NewLimiter(ratelimit.NewMemoryStore(), map[string]ratelimit.Rule{
+				"POST /login": {Rate: 1, Per: time.Minute},
+			}, nil)
+			userHandler := transport.NewUserHandler(nil, limiter)
+			engine.POST("/login", userHandler.RateLimit, func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			for i, forwardedFor := range []string{"203.0.113.1", "203.0.113.2"} {
+				req := httptest.NewRequest(http.MethodPost, "/login", nil)
+				req.Header.Set("X-Forwarded-For", forwardedFor)
+				w := httptest.NewRecorder()
+				engine.ServeHTTP(w, req)
+				assert.Equal(t, tc.expected[i], w.Code)
+			}
+		})
+	}
+
+	_, err := newEngine(&Config{TrustedProxies: []string{"not an address"}})
+	assert.Error(t, err)
+}